@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// alertFlashDuration is how long an alert stays highlighted in the status
+// bar
+const alertFlashDuration = 5 * time.Second
+
+// alertWebhookTimeout bounds the call to the -alert-webhook URL
+const alertWebhookTimeout = 10 * time.Second
+
+// Alerts raised when a response misses the expectations of its saved
+// request or a watched value changes, set by -alert and -alert-webhook
+var (
+	alertBell    = true
+	alertFlash   = true
+	alertWebhook string
+)
+
+var alertStyle = lipgloss.NewStyle().
+	Bold(true).
+	Foreground(lipgloss.Color("#FAFAFA")).
+	Background(lipgloss.Color("#E06C75")).
+	Padding(0, 1)
+
+// parseAlertFlag handles -alert, a comma-separated list of bell and
+// flash, or none
+func parseAlertFlag(s string) error {
+	alertBell, alertFlash = false, false
+	for _, kind := range strings.Split(s, ",") {
+		switch strings.TrimSpace(kind) {
+		case "bell":
+			alertBell = true
+		case "flash":
+			alertFlash = true
+		case "none", "":
+		default:
+			return fmt.Errorf("unknown alert %q, expected bell, flash or none", kind)
+		}
+	}
+	return nil
+}
+
+// alertClearMsg ends the status bar flash of the alert with the same seq
+type alertClearMsg struct {
+	seq int
+}
+
+// alertWebhookMsg reports a failed call to the alert webhook
+type alertWebhookMsg struct {
+	err error
+}
+
+// alertEvent is the JSON posted to the alert webhook. Text repeats the
+// rest as one line, which chat webhooks (Slack, Mattermost) show as is.
+type alertEvent struct {
+	Text    string    `json:"text"`
+	Event   string    `json:"event"` // "expectation" or "watch"
+	Method  string    `json:"method"`
+	URL     string    `json:"url"` // with secrets masked
+	Details []string  `json:"details"`
+	Time    time.Time `json:"time"`
+}
+
+// checkResponseAlerts checks the response to the request in flight
+// against its expectations and watched values, raising an alert for
+// what fails or changed
+func (m model) checkResponseAlerts(msg fetchMsg) (model, tea.Cmd) {
+	if m.pending == nil || msg.partial {
+		return m, nil
+	}
+	var failures []string
+	if e := m.sentExpect; e != nil {
+		if msg.err != nil {
+			failures = append(failures, msg.err.Error())
+		} else {
+			failures = e.check(msg.statusCode, responseLatency(msg), int64(len(msg.body)))
+		}
+	}
+
+	var changes []string
+	if msg.err == nil && len(m.sentWatch) > 0 {
+		ctx := templateContext{last: &msg}
+		for _, path := range m.sentWatch {
+			value, _, err := ctx.extract(path)
+			if err != nil {
+				value = "(" + err.Error() + ")"
+			}
+			key := m.pending.Method + " " + m.pending.URL + " " + path
+			previous, seen := m.watched[key]
+			m.watched[key] = value
+			if seen && previous != value {
+				changes = append(changes, fmt.Sprintf("%s changed from %s to %s", path, previous, value))
+			}
+		}
+	}
+
+	var cmds []tea.Cmd
+	var cmd tea.Cmd
+	if len(failures) > 0 {
+		m, cmd = m.raiseAlert(alertEvent{Event: "expectation", Details: failures})
+		cmds = append(cmds, cmd)
+	}
+	if len(changes) > 0 {
+		m, cmd = m.raiseAlert(alertEvent{Event: "watch", Details: changes})
+		cmds = append(cmds, cmd)
+	}
+	return m, tea.Batch(cmds...)
+}
+
+// raiseAlert signals e for the request in flight in all the configured
+// ways
+func (m model) raiseAlert(e alertEvent) (model, tea.Cmd) {
+	e.Method, e.URL, e.Time = m.pending.Method, m.pending.URL, time.Now()
+	summary := "Expectation failed"
+	if e.Event == "watch" {
+		summary = "Watched value changed"
+	}
+	e.Text = fmt.Sprintf("%s for %s %s: %s", summary, e.Method, e.URL, strings.Join(e.Details, "; "))
+
+	var cmds []tea.Cmd
+	if alertFlash {
+		m.alertSeq++
+		m.alert = summary + ": " + strings.Join(e.Details, "; ")
+		seq := m.alertSeq
+		cmds = append(cmds, tea.Tick(alertFlashDuration, func(time.Time) tea.Msg { return alertClearMsg{seq} }))
+	}
+	if alertBell {
+		// The terminal (or tmux, for a background pane) shows the bell
+		// however it is configured to
+		cmds = append(cmds, func() tea.Msg {
+			os.Stdout.WriteString("\a")
+			return nil
+		})
+	}
+	if alertWebhook != "" {
+		cmds = append(cmds, postAlert(e))
+	}
+	return m, tea.Batch(cmds...)
+}
+
+// postAlert posts e as JSON to the alert webhook
+func postAlert(e alertEvent) tea.Cmd {
+	return func() tea.Msg {
+		data, err := json.Marshal(e)
+		if err != nil {
+			return alertWebhookMsg{err}
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), alertWebhookTimeout)
+		defer cancel()
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, alertWebhook, bytes.NewReader(data))
+		if err != nil {
+			return alertWebhookMsg{err}
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("User-Agent", "lazyhttp")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return alertWebhookMsg{err}
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			return alertWebhookMsg{fmt.Errorf("webhook answered %s", resp.Status)}
+		}
+		return nil
+	}
+}
+
+// responseLatency is the time to the last body byte, in milliseconds
+func responseLatency(msg fetchMsg) int64 {
+	t := msg.timing
+	if t == nil {
+		return 0
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.end.IsZero() {
+		return 0
+	}
+	return t.end.Sub(t.start).Milliseconds()
+}
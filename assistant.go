@@ -0,0 +1,406 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// The assistant drafts a request from a question typed after "?" in the
+// input line, using the OpenAPI specs imported into the workspace. It is
+// off unless -assistant names the chat API to ask, as nothing leaves the
+// machine without the user setting it up.
+var (
+	assistantURL   string
+	assistantModel string
+	assistantKey   string // secret reference, e.g. env:OPENAI_API_KEY
+)
+
+// assistantTimeout bounds a call to the assistant
+const assistantTimeout = 2 * time.Minute
+
+// maxAssistantCatalog bounds the operations sent along with a question,
+// in bytes, for specs larger than a model's context
+const maxAssistantCatalog = 100 << 10
+
+// maxAssistantExample bounds the example body listed per operation
+const maxAssistantExample = 600
+
+const assistantInstructions = `You turn questions about HTTP APIs into one request for lazyhttp, an HTTP client.
+Pick the operation of the listed API specs that answers the question and fill in its parameters from the question.
+Write URLs with the {{base_url}} placeholder of the spec, and use {{placeholders}} for values the question doesn't give.
+Reply with a single JSON object and nothing else:
+{"spec": "<spec file, as listed>", "operation": "<METHOD /path, as listed>", "method": "GET", "url": "{{base_url}}/...", "headers": {"Name": "value"}, "body": "<request body, empty if none>", "explanation": "<one sentence on what the request does>"}
+Leave out auth headers, they are added from the spec. Leave spec and operation empty when no listed operation fits.`
+
+// assistantAPI speaks the wire format of a chat API
+type assistantAPI struct {
+	name    string
+	request func(system, question, key string) (map[string]interface{}, http.Header)
+	reply   func(data map[string]interface{}) (string, error)
+}
+
+// assistantAPIs by what their URLs end with, OpenAI's chat completions
+// serving for the many APIs compatible with it (Ollama, vLLM, LM Studio,
+// OpenRouter...)
+var assistantAPIs = []struct {
+	suffix string
+	api    assistantAPI
+}{
+	{"/messages", assistantAPI{"Anthropic", anthropicAssistantRequest, anthropicAssistantReply}},
+	{"", assistantAPI{"OpenAI", openAIAssistantRequest, openAIAssistantReply}},
+}
+
+// assistantAPIFor picks the API of an assistant URL
+func assistantAPIFor(rawURL string) assistantAPI {
+	path := strings.TrimRight(strings.SplitN(rawURL, "?", 2)[0], "/")
+	for _, a := range assistantAPIs {
+		if strings.HasSuffix(path, a.suffix) {
+			return a.api
+		}
+	}
+	return assistantAPIs[len(assistantAPIs)-1].api
+}
+
+func openAIAssistantRequest(system, question, key string) (map[string]interface{}, http.Header) {
+	header := http.Header{}
+	if key != "" {
+		header.Set("Authorization", "Bearer "+key)
+	}
+	return map[string]interface{}{
+		"model":       assistantModel,
+		"temperature": 0,
+		"messages": []map[string]string{
+			{"role": "system", "content": system},
+			{"role": "user", "content": question},
+		},
+	}, header
+}
+
+func openAIAssistantReply(data map[string]interface{}) (string, error) {
+	if err := asMap(data["error"]); err != nil {
+		return "", errors.New(asString(err["message"]))
+	}
+	choices := asList(data["choices"])
+	if len(choices) == 0 {
+		return "", errors.New("the reply has no choices")
+	}
+	return asString(asMap(asMap(choices[0])["message"])["content"]), nil
+}
+
+func anthropicAssistantRequest(system, question, key string) (map[string]interface{}, http.Header) {
+	header := http.Header{}
+	header.Set("anthropic-version", "2023-06-01")
+	if key != "" {
+		header.Set("x-api-key", key)
+	}
+	return map[string]interface{}{
+		"model":       assistantModel,
+		"max_tokens":  2048,
+		"temperature": 0,
+		"system":      system,
+		"messages":    []map[string]string{{"role": "user", "content": question}},
+	}, header
+}
+
+func anthropicAssistantReply(data map[string]interface{}) (string, error) {
+	if err := asMap(data["error"]); err != nil {
+		return "", errors.New(asString(err["message"]))
+	}
+	var text strings.Builder
+	for _, raw := range asList(data["content"]) {
+		if block := asMap(raw); asString(block["type"]) == "text" {
+			text.WriteString(asString(block["text"]))
+		}
+	}
+	return text.String(), nil
+}
+
+// isAssistantPrompt tells whether the input line is a question for the
+// assistant rather than a request
+func isAssistantPrompt(line string) bool {
+	return strings.HasPrefix(strings.TrimSpace(line), "?")
+}
+
+// assistantDraft is the request the assistant replied with
+type assistantDraft struct {
+	Spec        string            `json:"spec"`
+	Operation   string            `json:"operation"`
+	Method      string            `json:"method"`
+	URL         string            `json:"url"`
+	Headers     map[string]string `json:"headers"`
+	Body        string            `json:"body"`
+	Explanation string            `json:"explanation"`
+}
+
+// assistantMsg carries the draft of the assistant, or why there is none
+type assistantMsg struct {
+	question string
+	draft    savedRequest
+	note     string
+	err      error
+}
+
+// assistantCatalog lists the operations of the specs of the workspace,
+// with their parameters and an example body, for the assistant to pick
+// from
+func assistantCatalog() (string, int, error) {
+	files, err := filepath.Glob(filepath.Join(workspaceDir(), specsDir, "*.json"))
+	if err != nil {
+		return "", 0, err
+	}
+	var sb strings.Builder
+	count := 0
+	for _, path := range files {
+		file := filepath.Base(path)
+		s, err := loadOpenAPISpec(file)
+		if err != nil {
+			return "", 0, err
+		}
+		info := asMap(s.doc["info"])
+		fmt.Fprintf(&sb, "Spec %s: %s\n", file, asString(info["title"]))
+		if description := asString(info["description"]); description != "" {
+			fmt.Fprintf(&sb, "%s\n", truncate(description, maxAssistantExample))
+		}
+		paths := asMap(s.doc["paths"])
+		for _, path := range sortedKeys(paths) {
+			item := s.resolve(paths[path])
+			for _, method := range openAPIMethods {
+				op := asMap(item[method])
+				if op == nil {
+					continue
+				}
+				count++
+				sb.WriteString(assistantOperation(s, path, method, item, op))
+				if sb.Len() > maxAssistantCatalog {
+					sb.WriteString("(more operations left out)\n")
+					return sb.String(), count, nil
+				}
+			}
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String(), count, nil
+}
+
+// assistantOperation describes one operation of a spec for the assistant
+func assistantOperation(s *openAPISpec, path, method string, item, op map[string]interface{}) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "- %s %s", strings.ToUpper(method), path)
+	if summary := asString(op["summary"]); summary != "" {
+		sb.WriteString(": " + summary)
+	}
+	if description := asString(op["description"]); description != "" && description != asString(op["summary"]) {
+		sb.WriteString(" (" + truncate(strings.Join(strings.Fields(description), " "), 200) + ")")
+	}
+	sb.WriteString("\n")
+	var params []string
+	for _, list := range []interface{}{item["parameters"], op["parameters"]} {
+		for _, raw := range asList(list) {
+			p := s.resolve(raw)
+			if asString(p["in"]) == "body" {
+				continue
+			}
+			param := asString(p["name"]) + " in " + asString(p["in"])
+			if required, _ := p["required"].(bool); required {
+				param += ", required"
+			}
+			schema := s.resolve(p["schema"])
+			if schema == nil {
+				schema = p // Swagger 2.0 types its parameters directly
+			}
+			if typ := asString(schema["type"]); typ != "" {
+				param += ", " + typ
+			}
+			if enum := asList(schema["enum"]); len(enum) > 0 {
+				param += ", one of " + specJSON(enum)
+			}
+			params = append(params, param)
+		}
+	}
+	if len(params) > 0 {
+		fmt.Fprintf(&sb, "  parameters: %s\n", strings.Join(params, "; "))
+	}
+	r := s.request(path, method, item, op)
+	if r.Body != "" {
+		fmt.Fprintf(&sb, "  body: %s\n", truncate(strings.Join(strings.Fields(r.Body), " "), maxAssistantExample))
+	}
+	return sb.String()
+}
+
+// askAssistant sends the question in the input line to the assistant,
+// which drafts a request to review before sending
+func (m model) askAssistant(line string) (model, tea.Cmd) {
+	question := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), "?"))
+	if assistantURL == "" {
+		m.err = errors.New("the assistant is off: start lazyhttp with -assistant URL (and -assistant-model, -assistant-key) to draft requests from questions")
+		m.response = ""
+		return m, nil
+	}
+	if question == "" {
+		return m, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), assistantTimeout)
+	m.fetching = true
+	m.cancel = cancel
+	m.err = nil
+	m.notice = ""
+	m.response = "Asking the assistant..."
+	m.viewport.SetContent(m.response)
+	return m, func() tea.Msg {
+		draft, note, err := draftFromQuestion(ctx, question)
+		return assistantMsg{question: question, draft: draft, note: note, err: err}
+	}
+}
+
+// draftFromQuestion asks the assistant for a request answering question
+func draftFromQuestion(ctx context.Context, question string) (savedRequest, string, error) {
+	if assistantModel == "" {
+		return savedRequest{}, "", errors.New("set the model to ask with -assistant-model")
+	}
+	catalog, operations, err := assistantCatalog()
+	if err != nil {
+		return savedRequest{}, "", err
+	}
+	system := assistantInstructions
+	if operations > 0 {
+		system += "\n\nAPI specs:\n" + catalog
+	}
+	key := ""
+	if assistantKey != "" {
+		if key, err = readSecret(assistantKey); err != nil {
+			return savedRequest{}, "", fmt.Errorf("assistant key: %w", err)
+		}
+	}
+
+	api := assistantAPIFor(assistantURL)
+	payload, header := api.request(system, question, key)
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return savedRequest{}, "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, assistantURL, bytes.NewReader(data))
+	if err != nil {
+		return savedRequest{}, "", err
+	}
+	req.Header = header
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "lazyhttp")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return savedRequest{}, "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return savedRequest{}, "", err
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(body, &decoded); err != nil {
+		return savedRequest{}, "", fmt.Errorf("%s answered %s, not JSON", api.name, resp.Status)
+	}
+	text, err := api.reply(decoded)
+	if err == nil && resp.StatusCode >= 300 {
+		err = fmt.Errorf("%s answered %s", api.name, resp.Status)
+	}
+	if err != nil {
+		return savedRequest{}, "", fmt.Errorf("assistant: %w", err)
+	}
+
+	// Models wrap JSON in prose or code fences despite being told not to
+	start, end := strings.Index(text, "{"), strings.LastIndex(text, "}")
+	var d assistantDraft
+	if start < 0 || end < start || json.Unmarshal([]byte(text[start:end+1]), &d) != nil || d.URL == "" {
+		return savedRequest{}, "", fmt.Errorf("the assistant didn't reply with a request:\n%s", strings.TrimSpace(text))
+	}
+	if operations == 0 {
+		d.Spec, d.Operation = "", ""
+	}
+	return d.request(), d.note(operations), nil
+}
+
+// request turns the reply into a draft, with the auth of the spec
+// operation it names, whose responses are then checked against the spec
+func (d assistantDraft) request() savedRequest {
+	r := savedRequest{Method: strings.ToUpper(d.Method), URL: d.URL, Headers: d.Headers, Body: d.Body}
+	if r.Method == "GET" {
+		r.Method = ""
+	}
+	s, err := loadOpenAPISpec(filepath.Base(d.Spec))
+	method, path, _ := strings.Cut(d.Operation, " ")
+	if d.Spec == "" || err != nil {
+		return r
+	}
+	item := s.resolve(asMap(s.doc["paths"])[path])
+	op := asMap(item[strings.ToLower(method)])
+	if op == nil {
+		return r
+	}
+	generated := s.request(path, strings.ToLower(method), item, op)
+	r.Auth, r.Variables = generated.Auth, generated.Variables
+	r.OpenAPI = &openAPIRef{Spec: filepath.Base(d.Spec), Operation: strings.ToUpper(method) + " " + path}
+
+	// The collection generated from the spec holds its base_url
+	collections, _ := listCollections()
+	for _, c := range collections {
+		for _, saved := range c.Requests {
+			if saved.OpenAPI != nil && saved.OpenAPI.Spec == r.OpenAPI.Spec {
+				r.inherited = saved.inherited
+				return r
+			}
+		}
+	}
+	return r
+}
+
+// note sums up the reply for the preview
+func (d assistantDraft) note(operations int) string {
+	note := d.Explanation
+	switch {
+	case operations == 0:
+		note += " (no OpenAPI spec is imported in this workspace, the request is a guess)"
+	case d.Operation == "":
+		note += " (no operation of the imported specs fits, the request is a guess)"
+	default:
+		note += " (" + d.Operation + ")"
+	}
+	return strings.TrimSpace(note)
+}
+
+// showAssistantDraft loads the draft of the assistant like an imported
+// curl command, previewed rather than sent
+func (m model) showAssistantDraft(msg assistantMsg) model {
+	m.fetching = false
+	if m.cancel != nil {
+		m.cancel()
+		m.cancel = nil
+	}
+	if msg.err != nil {
+		m.err = msg.err
+		m.response = ""
+		return m
+	}
+	m.draft = &msg.draft
+	m.textInput.SetValue(msg.draft.requestLine())
+	m.textInput.CursorEnd()
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s %s\n", headerStyle.Render("Question:"), msg.question)
+	fmt.Fprintf(&sb, "%s %s\n\n", headerStyle.Render("Assistant:"), msg.note)
+	sb.WriteString(renderPreview(m.resolveInput(m.textInput.Value())))
+	m.err = nil
+	m.response = sb.String()
+	m.viewport.SetContent(m.response)
+	m.viewport.GotoTop()
+	m.notice = "Drafted by the assistant, review it: Enter sends it and Ctrl+S saves it"
+	return m
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// requestAuth is how a saved request authenticates. It is applied once
+// the request's templates are expanded, so credentials can come from
+// variables and secrets, e.g. {"type": "basic", "username": "{{user}}",
+// "password": "{{secret:kv/data/api#password}}"}.
+type requestAuth struct {
+	Type string `json:"type"` // "basic", "bearer", "apikey", "aws-sigv4", "hawk", "http-signature", or "none" not to inherit any
+
+	// basic
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+
+	// bearer
+	Token string `json:"token,omitempty"`
+
+	// apikey: sent as header Key, or as query parameter Key when In is
+	// "query"
+	Key   string `json:"key,omitempty"`
+	Value string `json:"value,omitempty"`
+	In    string `json:"in,omitempty"`
+
+	// aws-sigv4: region and service default to those in the host, like
+	// sqs.eu-west-1.amazonaws.com
+	AccessKey    string `json:"access_key,omitempty"`
+	SecretKey    string `json:"secret_key,omitempty"`
+	SessionToken string `json:"session_token,omitempty"`
+	Region       string `json:"region,omitempty"`
+	Service      string `json:"service,omitempty"`
+
+	// hawk and http-signature: the id of the key and the key, a shared
+	// secret, or a PEM private key for the asymmetric algorithms of
+	// http-signature. Algorithm is sha256 (default) or sha1 for hawk, and
+	// hmac-sha256 (default), ed25519, rsa-pss-sha512 or ecdsa-p256-sha256
+	// for http-signature, whose Components are those it signs.
+	KeyID      string   `json:"key_id,omitempty"`
+	Secret     string   `json:"secret,omitempty"`
+	Algorithm  string   `json:"algorithm,omitempty"`
+	Ext        string   `json:"ext,omitempty"`
+	Components []string `json:"components,omitempty"`
+}
+
+// describe summarizes the auth without its credentials
+func (a *requestAuth) describe() string {
+	switch a.Type {
+	case "basic":
+		return "basic auth as " + a.Username
+	case "apikey":
+		if a.In == "query" {
+			return "API key in query parameter " + a.Key
+		}
+		return "API key in header " + a.Key
+	case "aws-sigv4":
+		return "AWS SigV4"
+	case "hawk":
+		return "Hawk as " + a.KeyID
+	case "http-signature":
+		return "HTTP signature with key " + a.KeyID
+	case "none":
+		return "no auth"
+	}
+	return a.Type + " auth"
+}
+
+// setHeader sets a header of the request, display being its value with
+// secrets masked
+func (r *resolvedRequest) setHeader(name, value, display string) {
+	if r.headers == nil {
+		r.headers, r.displayHeaders = map[string]string{}, map[string]string{}
+	}
+	setHeaderFold(r.headers, name, value)
+	setHeaderFold(r.displayHeaders, name, display)
+}
+
+// applyAuth adds the credentials of a to the resolved request, replacing
+// an Authorization header it sets itself. expand expands a template of the
+// request. Signed schemes sign the request as it is, so they come last.
+func (r *resolvedRequest) applyAuth(a *requestAuth, expand func(string) expansion) {
+	setHeader := r.setHeader
+	var err error
+	switch a.Type {
+	case "basic":
+		user, password := expand(a.Username), expand(a.Password)
+		credentials := base64.StdEncoding.EncodeToString([]byte(user.text + ":" + password.text))
+		setHeader("Authorization", "Basic "+credentials, "Basic "+maskedValue)
+	case "bearer":
+		token := expand(a.Token)
+		setHeader("Authorization", "Bearer "+token.text, "Bearer "+maskedValue)
+	case "apikey":
+		key, value := expand(a.Key), expand(a.Value)
+		if a.In != "query" {
+			setHeader(key.text, value.text, maskedValue)
+			return
+		}
+		sep := "?"
+		if strings.Contains(r.url, "?") {
+			sep = "&"
+		}
+		param := sep + url.QueryEscape(key.text) + "="
+		r.url += param + url.QueryEscape(value.text)
+		r.display += param + maskedValue
+	case "aws-sigv4":
+		err = r.signAWS(a, expand)
+	case "hawk":
+		err = r.signHawk(a, expand)
+	case "http-signature":
+		err = r.signHTTPMessage(a, expand)
+	case "none":
+	default:
+		err = fmt.Errorf("unknown auth type %q, expected basic, bearer, apikey, aws-sigv4, hawk or http-signature", a.Type)
+	}
+	if err != nil {
+		r.missing = append(r.missing, unresolved{name: "auth", err: err})
+	}
+}
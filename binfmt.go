@@ -0,0 +1,457 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"mime"
+	"time"
+)
+
+// maxDecodeDepth guards the binary decoders against hostile nesting
+const maxDecodeDepth = 512
+
+var errTruncated = errors.New("unexpected end of data")
+
+// orderedMap keeps the key order of decoded maps when rendered as JSON
+type orderedMap []mapEntry
+
+type mapEntry struct {
+	key   string
+	value interface{}
+}
+
+func (m orderedMap) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, e := range m {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		k, err := json.Marshal(e.key)
+		if err != nil {
+			return nil, err
+		}
+		v, err := json.Marshal(e.value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(k)
+		buf.WriteByte(':')
+		buf.Write(v)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// binaryFormat maps a Content-Type to "msgpack", "cbor" or ""
+func binaryFormat(contentType string) string {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case "application/msgpack", "application/x-msgpack", "application/vnd.msgpack":
+		return "msgpack"
+	case "application/cbor":
+		return "cbor"
+	}
+	return ""
+}
+
+// decodeBinaryToJSON decodes a MessagePack or CBOR document into indented
+// JSON. Binary strings become base64 and non-string map keys are stringified.
+func decodeBinaryToJSON(body []byte, format string) ([]byte, error) {
+	d := &binDecoder{data: body}
+
+	var (
+		v   interface{}
+		err error
+	)
+	switch format {
+	case "msgpack":
+		v, err = d.msgpack(0)
+	case "cbor":
+		v, err = d.cbor(0)
+	default:
+		return nil, fmt.Errorf("unknown binary format %q", format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w at offset %d", format, err, d.pos)
+	}
+	if d.pos != len(d.data) {
+		return nil, fmt.Errorf("%s: %d trailing bytes after the document", format, len(d.data)-d.pos)
+	}
+	return json.MarshalIndent(v, "", "  ")
+}
+
+type binDecoder struct {
+	data []byte
+	pos  int
+}
+
+func (d *binDecoder) take(n int) ([]byte, error) {
+	if n < 0 || d.pos+n > len(d.data) {
+		return nil, errTruncated
+	}
+	b := d.data[d.pos : d.pos+n]
+	d.pos += n
+	return b, nil
+}
+
+func (d *binDecoder) uint(size int) (uint64, error) {
+	b, err := d.take(size)
+	if err != nil {
+		return 0, err
+	}
+	switch size {
+	case 1:
+		return uint64(b[0]), nil
+	case 2:
+		return uint64(binary.BigEndian.Uint16(b)), nil
+	case 4:
+		return uint64(binary.BigEndian.Uint32(b)), nil
+	default:
+		return binary.BigEndian.Uint64(b), nil
+	}
+}
+
+// jsonFloat makes non-finite floats representable in JSON
+func jsonFloat(f float64) interface{} {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return fmt.Sprint(f)
+	}
+	return f
+}
+
+func mapKey(k interface{}) string {
+	if s, ok := k.(string); ok {
+		return s
+	}
+	b, err := json.Marshal(k)
+	if err != nil {
+		return fmt.Sprint(k)
+	}
+	return string(b)
+}
+
+func (d *binDecoder) msgpack(depth int) (interface{}, error) {
+	if depth > maxDecodeDepth {
+		return nil, errors.New("nesting too deep")
+	}
+	tb, err := d.take(1)
+	if err != nil {
+		return nil, err
+	}
+	t := tb[0]
+
+	switch {
+	case t <= 0x7f:
+		return int64(t), nil
+	case t >= 0xe0:
+		return int64(int8(t)), nil
+	case t&0xf0 == 0x80:
+		return d.msgpackMap(int(t&0x0f), depth)
+	case t&0xf0 == 0x90:
+		return d.msgpackArray(int(t&0x0f), depth)
+	case t&0xe0 == 0xa0:
+		b, err := d.take(int(t & 0x1f))
+		return string(b), err
+	}
+
+	switch t {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xc4, 0xc5, 0xc6:
+		n, err := d.uint(1 << (t - 0xc4))
+		if err != nil {
+			return nil, err
+		}
+		b, err := d.take(int(n))
+		return base64.StdEncoding.EncodeToString(b), err
+	case 0xc7, 0xc8, 0xc9:
+		n, err := d.uint(1 << (t - 0xc7))
+		if err != nil {
+			return nil, err
+		}
+		return d.msgpackExt(int(n))
+	case 0xca:
+		n, err := d.uint(4)
+		return jsonFloat(float64(math.Float32frombits(uint32(n)))), err
+	case 0xcb:
+		n, err := d.uint(8)
+		return jsonFloat(math.Float64frombits(n)), err
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		return d.uint(1 << (t - 0xcc))
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		size := 1 << (t - 0xd0)
+		n, err := d.uint(size)
+		if err != nil {
+			return nil, err
+		}
+		// Sign-extend from the encoded width
+		shift := 64 - 8*size
+		return int64(n<<shift) >> shift, nil
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8:
+		return d.msgpackExt(1 << (t - 0xd4))
+	case 0xd9, 0xda, 0xdb:
+		n, err := d.uint(1 << (t - 0xd9))
+		if err != nil {
+			return nil, err
+		}
+		b, err := d.take(int(n))
+		return string(b), err
+	case 0xdc, 0xdd:
+		n, err := d.uint(2 << (t - 0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return d.msgpackArray(int(n), depth)
+	case 0xde, 0xdf:
+		n, err := d.uint(2 << (t - 0xde))
+		if err != nil {
+			return nil, err
+		}
+		return d.msgpackMap(int(n), depth)
+	}
+	return nil, fmt.Errorf("invalid type byte 0x%02x", t)
+}
+
+func (d *binDecoder) msgpackArray(n int, depth int) (interface{}, error) {
+	if n > len(d.data)-d.pos {
+		return nil, errTruncated
+	}
+	out := make([]interface{}, 0, n)
+	for i := 0; i < n; i++ {
+		v, err := d.msgpack(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	return out, nil
+}
+
+func (d *binDecoder) msgpackMap(n int, depth int) (interface{}, error) {
+	if n > len(d.data)-d.pos {
+		return nil, errTruncated
+	}
+	out := make(orderedMap, 0, n)
+	for i := 0; i < n; i++ {
+		k, err := d.msgpack(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		v, err := d.msgpack(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, mapEntry{mapKey(k), v})
+	}
+	return out, nil
+}
+
+// msgpackExt decodes extension types; only the timestamp (-1) is known
+func (d *binDecoder) msgpackExt(n int) (interface{}, error) {
+	tb, err := d.take(1)
+	if err != nil {
+		return nil, err
+	}
+	data, err := d.take(n)
+	if err != nil {
+		return nil, err
+	}
+
+	if int8(tb[0]) == -1 {
+		switch n {
+		case 4:
+			return time.Unix(int64(binary.BigEndian.Uint32(data)), 0).UTC().Format(time.RFC3339Nano), nil
+		case 8:
+			v := binary.BigEndian.Uint64(data)
+			return time.Unix(int64(v&0x3ffffffff), int64(v>>34)).UTC().Format(time.RFC3339Nano), nil
+		case 12:
+			nsec := binary.BigEndian.Uint32(data[:4])
+			sec := int64(binary.BigEndian.Uint64(data[4:]))
+			return time.Unix(sec, int64(nsec)).UTC().Format(time.RFC3339Nano), nil
+		}
+	}
+	return orderedMap{{"$ext", int64(int8(tb[0]))}, {"data", base64.StdEncoding.EncodeToString(data)}}, nil
+}
+
+func (d *binDecoder) cbor(depth int) (interface{}, error) {
+	if depth > maxDecodeDepth {
+		return nil, errors.New("nesting too deep")
+	}
+	ib, err := d.take(1)
+	if err != nil {
+		return nil, err
+	}
+	major, info := ib[0]>>5, ib[0]&0x1f
+
+	// Simple values and floats carry their payload in the additional info
+	if major == 7 {
+		switch info {
+		case 20:
+			return false, nil
+		case 21:
+			return true, nil
+		case 22, 23:
+			return nil, nil
+		case 25:
+			n, err := d.uint(2)
+			return jsonFloat(halfToFloat(uint16(n))), err
+		case 26:
+			n, err := d.uint(4)
+			return jsonFloat(float64(math.Float32frombits(uint32(n)))), err
+		case 27:
+			n, err := d.uint(8)
+			return jsonFloat(math.Float64frombits(n)), err
+		case 24:
+			n, err := d.uint(1)
+			return orderedMap{{"$simple", n}}, err
+		case 31:
+			return nil, errors.New("unexpected break")
+		}
+		return orderedMap{{"$simple", uint64(info)}}, nil
+	}
+
+	indefinite := info == 31
+	var arg uint64
+	switch {
+	case info < 24:
+		arg = uint64(info)
+	case info <= 27:
+		if arg, err = d.uint(1 << (info - 24)); err != nil {
+			return nil, err
+		}
+	case indefinite && major >= 2 && major <= 5:
+	default:
+		return nil, fmt.Errorf("invalid additional info %d", info)
+	}
+
+	switch major {
+	case 0:
+		return arg, nil
+	case 1:
+		if arg > math.MaxInt64 {
+			return fmt.Sprintf("-%d", arg+1), nil
+		}
+		return -1 - int64(arg), nil
+	case 2, 3:
+		var b []byte
+		if indefinite {
+			for !d.cborBreak() {
+				chunk, err := d.cbor(depth + 1)
+				if err != nil {
+					return nil, err
+				}
+				s, _ := chunk.(string)
+				if major == 2 {
+					raw, _ := base64.StdEncoding.DecodeString(s)
+					b = append(b, raw...)
+				} else {
+					b = append(b, s...)
+				}
+			}
+		} else if b, err = d.take(int(arg)); err != nil {
+			return nil, err
+		}
+		if major == 2 {
+			return base64.StdEncoding.EncodeToString(b), nil
+		}
+		return string(b), nil
+	case 4:
+		out := []interface{}{}
+		for i := uint64(0); indefinite || i < arg; i++ {
+			if indefinite && d.cborBreak() {
+				break
+			}
+			if !indefinite && arg > uint64(len(d.data)-d.pos) {
+				return nil, errTruncated
+			}
+			v, err := d.cbor(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, v)
+		}
+		return out, nil
+	case 5:
+		out := orderedMap{}
+		for i := uint64(0); indefinite || i < arg; i++ {
+			if indefinite && d.cborBreak() {
+				break
+			}
+			if !indefinite && arg > uint64(len(d.data)-d.pos) {
+				return nil, errTruncated
+			}
+			k, err := d.cbor(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			v, err := d.cbor(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, mapEntry{mapKey(k), v})
+		}
+		return out, nil
+	default: // 6: tag
+		v, err := d.cbor(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		switch arg {
+		case 0: // RFC 3339 date/time string
+			return v, nil
+		case 1: // epoch date/time
+			switch t := v.(type) {
+			case uint64:
+				return time.Unix(int64(t), 0).UTC().Format(time.RFC3339), nil
+			case int64:
+				return time.Unix(t, 0).UTC().Format(time.RFC3339), nil
+			case float64:
+				sec, frac := math.Modf(t)
+				return time.Unix(int64(sec), int64(frac*1e9)).UTC().Format(time.RFC3339Nano), nil
+			}
+		}
+		return orderedMap{{"$tag", arg}, {"value", v}}, nil
+	}
+}
+
+// cborBreak consumes the break code ending an indefinite-length item
+func (d *binDecoder) cborBreak() bool {
+	if d.pos < len(d.data) && d.data[d.pos] == 0xff {
+		d.pos++
+		return true
+	}
+	return false
+}
+
+// halfToFloat converts an IEEE 754 half-precision float
+func halfToFloat(h uint16) float64 {
+	exp := int(h>>10) & 0x1f
+	mant := float64(h & 0x3ff)
+	var v float64
+	switch exp {
+	case 0:
+		v = math.Ldexp(mant, -24)
+	case 31:
+		if mant == 0 {
+			v = math.Inf(1)
+		} else {
+			v = math.NaN()
+		}
+	default:
+		v = math.Ldexp(mant+1024, exp-25)
+	}
+	if h&0x8000 != 0 {
+		return -v
+	}
+	return v
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// breakerFile records the circuit breakers of the workspace between
+// headless runs, so a scheduled run doesn't resume hammering a host that
+// was down a minute ago
+const breakerFile = "breakers.json"
+
+// circuitBreakers stop a headless run from sending requests to a host
+// after threshold consecutive failures. Once cooldown has passed a single
+// request probes the host: success closes the circuit, failure opens it
+// for another cooldown.
+type circuitBreakers struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu    sync.Mutex
+	hosts map[string]*hostCircuit
+}
+
+// hostCircuit is the circuit of one host
+type hostCircuit struct {
+	Failures int       `json:"failures"` // consecutive
+	OpenedAt time.Time `json:"opened_at,omitempty"`
+
+	probing bool // a request is probing the host after the cool-down
+	skipped int  // requests skipped in this run
+}
+
+func (c *hostCircuit) open() bool {
+	return !c.OpenedAt.IsZero()
+}
+
+// breakerFailure tells whether a result counts against the circuit of its
+// host: the request got no response, or the server said it is down or
+// overloaded. Other failures, like a missed expectation, say nothing
+// about the host's health.
+func breakerFailure(r runResult) bool {
+	return r.Status == 0 || r.Status == 429 || r.Status >= 500
+}
+
+// requestHost is the host a circuit covers
+func requestHost(rawURL string) string {
+	if u, err := url.Parse(rawURL); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return rawURL
+}
+
+// loadCircuitBreakers restores the circuits left by earlier runs; nil
+// when threshold is 0, which disables them
+func loadCircuitBreakers(threshold int, cooldown time.Duration) (*circuitBreakers, error) {
+	if threshold <= 0 {
+		return nil, nil
+	}
+	b := &circuitBreakers{threshold: threshold, cooldown: cooldown, hosts: map[string]*hostCircuit{}}
+	if incognito {
+		return b, nil
+	}
+	path, err := workspaceFile(breakerFile)
+	if err != nil {
+		return b, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return b, nil
+	}
+	if err != nil {
+		return b, err
+	}
+	if err := json.Unmarshal(data, &b.hosts); err != nil {
+		return b, fmt.Errorf("%s: %w", breakerFile, err)
+	}
+	return b, nil
+}
+
+// save records the circuits with failures for the next run
+func (b *circuitBreakers) save() error {
+	if b == nil || incognito {
+		return nil
+	}
+	b.mu.Lock()
+	hosts := map[string]*hostCircuit{}
+	for host, c := range b.hosts {
+		if c.Failures > 0 {
+			hosts[host] = c
+		}
+	}
+	data, err := json.MarshalIndent(hosts, "", "  ")
+	b.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	path, err := workspaceFile(breakerFile)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o600)
+}
+
+func (b *circuitBreakers) circuit(host string) *hostCircuit {
+	c := b.hosts[host]
+	if c == nil {
+		c = &hostCircuit{}
+		b.hosts[host] = c
+	}
+	return c
+}
+
+// allow tells whether a request may be sent to host. While the circuit is
+// open it may not, and it returns why; after the cool-down the first
+// request is let through to probe the host.
+func (b *circuitBreakers) allow(host string) (bool, string) {
+	if b == nil {
+		return true, ""
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c := b.circuit(host)
+	if !c.open() {
+		return true, ""
+	}
+	wait := time.Until(c.OpenedAt.Add(b.cooldown))
+	if wait <= 0 && !c.probing {
+		c.probing = true
+		return true, ""
+	}
+	why := fmt.Sprintf("circuit open for %s after %d consecutive failures", host, c.Failures)
+	if wait > 0 {
+		why += fmt.Sprintf(", closes for a probe in %s", formatDuration(wait.Round(time.Second)))
+	} else {
+		why += ", a probe is in flight"
+	}
+	return false, why
+}
+
+// skip counts a request not sent because the circuit of host is open
+func (b *circuitBreakers) skip(host string) {
+	b.mu.Lock()
+	b.circuit(host).skipped++
+	b.mu.Unlock()
+}
+
+// record counts the outcome of a request to host, opening the circuit at
+// the threshold and closing it on success
+func (b *circuitBreakers) record(host string, failed bool) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c := b.circuit(host)
+	c.probing = false
+	if !failed {
+		c.Failures, c.OpenedAt = 0, time.Time{}
+		return
+	}
+	c.Failures++
+	if c.Failures >= b.threshold {
+		c.OpenedAt = time.Now()
+	}
+}
+
+// circuitReport describes an open circuit at the end of a run
+type circuitReport struct {
+	Host      string    `json:"host"`
+	Failures  int       `json:"consecutive_failures"`
+	Skipped   int       `json:"skipped"`
+	OpenUntil time.Time `json:"open_until"`
+}
+
+// report lists the circuits open at the end of the run, by host
+func (b *circuitBreakers) report() []circuitReport {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var out []circuitReport
+	for host, c := range b.hosts {
+		if c.open() {
+			out = append(out, circuitReport{Host: host, Failures: c.Failures, Skipped: c.skipped, OpenUntil: c.OpenedAt.Add(b.cooldown)})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Host < out[j].Host })
+	return out
+}
+
+// retryBudgetRatio bounds the retries of a run to a share of its
+// requests, so retries can't multiply the load on a struggling service
+const retryBudgetRatio = 0.2
+
+// retryBackoff is the wait before the first retry, doubled for each next
+const retryBackoff = 250 * time.Millisecond
+
+// retryBudget counts the retries a run has left
+type retryBudget struct {
+	mu   sync.Mutex
+	left int
+}
+
+func newRetryBudget(requests int) *retryBudget {
+	return &retryBudget{left: max(1, int(float64(requests)*retryBudgetRatio))}
+}
+
+// take spends a retry, false when none are left
+func (b *retryBudget) take() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.left == 0 {
+		return false
+	}
+	b.left--
+	return true
+}
+
+// idempotentMethod tells whether a request can be retried without risking
+// doing its work twice
+func idempotentMethod(method string) bool {
+	switch method {
+	case "GET", "HEAD", "OPTIONS", "PUT", "DELETE", "TRACE":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,431 @@
+package main
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// chromeEpochOffset is the number of seconds between 1601-01-01, the epoch
+// Chrome stores cookie times against, and the Unix epoch
+const chromeEpochOffset = 11644473600
+
+// importCookiesCommand implements `lazyhttp import-cookies`: copy the
+// cookies of one domain from a browser profile into lazyhttp's jar after
+// the user has confirmed the list
+func importCookiesCommand(args []string) int {
+	fs := flag.NewFlagSet("import-cookies", flag.ExitOnError)
+	browser := fs.String("browser", "firefox", "browser to read from: firefox, chrome or chromium")
+	domain := fs.String("domain", "", "import cookies for this `domain` and its subdomains")
+	profile := fs.String("profile", "", "cookie database `file` to read (defaults to the browser's default profile)")
+	yes := fs.Bool("yes", false, "import without asking for confirmation")
+	fs.Parse(args)
+
+	if *domain == "" {
+		fmt.Fprintln(os.Stderr, "Usage: lazyhttp import-cookies -domain example.com [-browser firefox|chrome|chromium] [-profile file] [-yes]")
+		return 2
+	}
+
+	db := *profile
+	if db == "" {
+		var err error
+		if db, err = findCookieDB(*browser); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+	}
+
+	var (
+		cookies []storedCookie
+		err     error
+	)
+	switch *browser {
+	case "firefox":
+		cookies, err = readFirefoxCookies(db, *domain)
+	case "chrome", "chromium":
+		cookies, err = readChromeCookies(db, *browser, *domain)
+	default:
+		err = fmt.Errorf("unsupported browser %q", *browser)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	if len(cookies) == 0 {
+		fmt.Printf("No cookies for %s found in %s\n", *domain, db)
+		return 0
+	}
+
+	// Values are never printed, only enough to recognize the cookies
+	fmt.Printf("Found %d cookies for %s in %s:\n", len(cookies), *domain, db)
+	for _, c := range cookies {
+		expires := "session"
+		if !c.Expires.IsZero() {
+			expires = c.Expires.Format("2006-01-02")
+		}
+		fmt.Printf("  %-30s %-30s %s\n", c.Name, c.Domain+c.Path, expires)
+	}
+
+	if !*yes {
+		fmt.Print("Import these cookies into lazyhttp's cookie jar? [y/N] ")
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		if a := strings.ToLower(strings.TrimSpace(answer)); a != "y" && a != "yes" {
+			fmt.Println("Nothing imported")
+			return 0
+		}
+	}
+
+	if err := loadCookieJar(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading cookie jar: %v\n", err)
+		return 1
+	}
+	for _, c := range cookies {
+		cookieJar.add(c)
+	}
+	if err := saveCookieJar(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error saving cookie jar: %v\n", err)
+		return 1
+	}
+	fmt.Printf("Imported %d cookies\n", len(cookies))
+	return 0
+}
+
+// findCookieDB locates the cookie database of the browser's default profile
+func findCookieDB(browser string) (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	var patterns []string
+	switch browser {
+	case "firefox":
+		if runtime.GOOS == "darwin" {
+			patterns = []string{filepath.Join(home, "Library/Application Support/Firefox/Profiles/*/cookies.sqlite")}
+		} else {
+			patterns = []string{
+				filepath.Join(home, ".mozilla/firefox/*.default-release/cookies.sqlite"),
+				filepath.Join(home, ".mozilla/firefox/*.default*/cookies.sqlite"),
+				filepath.Join(home, "snap/firefox/common/.mozilla/firefox/*/cookies.sqlite"),
+			}
+		}
+	case "chrome", "chromium":
+		var base string
+		switch {
+		case runtime.GOOS == "darwin" && browser == "chrome":
+			base = filepath.Join(home, "Library/Application Support/Google/Chrome/Default")
+		case runtime.GOOS == "darwin":
+			base = filepath.Join(home, "Library/Application Support/Chromium/Default")
+		case browser == "chrome":
+			base = filepath.Join(home, ".config/google-chrome/Default")
+		default:
+			base = filepath.Join(home, ".config/chromium/Default")
+		}
+		patterns = []string{filepath.Join(base, "Network/Cookies"), filepath.Join(base, "Cookies")}
+	default:
+		return "", fmt.Errorf("unsupported browser %q", browser)
+	}
+
+	for _, p := range patterns {
+		if matches, _ := filepath.Glob(p); len(matches) > 0 {
+			return matches[0], nil
+		}
+	}
+	return "", fmt.Errorf("no %s cookie database found (use -profile to point at one)", browser)
+}
+
+// querySQLite runs a query through the sqlite3 command line tool on a copy
+// of db (browsers keep their databases locked). Every column must be
+// selected as hex() so values survive the text output untouched.
+func querySQLite(db, query string) ([][]string, error) {
+	if _, err := exec.LookPath("sqlite3"); err != nil {
+		return nil, errors.New("the sqlite3 command line tool is required to read browser cookies")
+	}
+
+	dir, err := os.MkdirTemp("", "lazyhttp-cookies")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	copyPath := filepath.Join(dir, "cookies.db")
+	for _, suffix := range []string{"", "-wal", "-shm"} {
+		if err := copyFile(db+suffix, copyPath+suffix); err != nil && suffix == "" {
+			return nil, err
+		}
+	}
+
+	out, err := exec.Command("sqlite3", "-readonly", "-separator", "|", copyPath, query).Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return nil, fmt.Errorf("sqlite3: %s", strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return nil, err
+	}
+
+	var rows [][]string
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		if line == "" {
+			continue
+		}
+		var row []string
+		for _, field := range strings.Split(line, "|") {
+			b, err := hex.DecodeString(field)
+			if err != nil {
+				return nil, fmt.Errorf("unexpected sqlite3 output: %w", err)
+			}
+			row = append(row, string(b))
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// domainFilter builds the SQL condition selecting a domain and its
+// subdomains; the domain is validated since it ends up in the query
+func domainFilter(column, domain string) (string, error) {
+	domain = strings.TrimPrefix(strings.ToLower(domain), ".")
+	for _, r := range domain {
+		if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '.' || r == '-') {
+			return "", fmt.Errorf("invalid domain %q", domain)
+		}
+	}
+	return fmt.Sprintf("(%[1]s = '%[2]s' OR %[1]s = '.%[2]s' OR %[1]s LIKE '%%.%[2]s')", column, domain), nil
+}
+
+func readFirefoxCookies(db, domain string) ([]storedCookie, error) {
+	filter, err := domainFilter("host", domain)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := querySQLite(db, "SELECT hex(host), hex(path), hex(name), hex(value), hex(expiry), hex(isSecure), hex(isHttpOnly) FROM moz_cookies WHERE "+filter)
+	if err != nil {
+		return nil, err
+	}
+
+	var cookies []storedCookie
+	for _, r := range rows {
+		if len(r) != 7 {
+			continue
+		}
+		c := storedCookie{
+			Domain:   strings.TrimPrefix(r[0], "."),
+			HostOnly: !strings.HasPrefix(r[0], "."),
+			Path:     r[1],
+			Name:     r[2],
+			Value:    r[3],
+			Secure:   r[5] == "1",
+			HTTPOnly: r[6] == "1",
+		}
+		if expiry, err := strconv.ParseInt(r[4], 10, 64); err == nil && expiry > 0 {
+			// Newer Firefox versions store milliseconds
+			if expiry > 1e11 {
+				expiry /= 1000
+			}
+			c.Expires = time.Unix(expiry, 0)
+		}
+		if !c.expired() {
+			cookies = append(cookies, c)
+		}
+	}
+	return cookies, nil
+}
+
+func readChromeCookies(db, browser, domain string) ([]storedCookie, error) {
+	filter, err := domainFilter("host_key", domain)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := querySQLite(db, "SELECT hex(host_key), hex(path), hex(name), hex(value), hex(encrypted_value), hex(expires_utc), hex(is_secure), hex(is_httponly) FROM cookies WHERE "+filter)
+	if err != nil {
+		return nil, err
+	}
+
+	// Since database version 24 the decrypted value is prefixed with a
+	// SHA-256 of the host
+	version := 0
+	if meta, err := querySQLite(db, "SELECT hex(value) FROM meta WHERE key = 'version'"); err == nil && len(meta) == 1 {
+		version, _ = strconv.Atoi(meta[0][0])
+	}
+
+	var keys *chromeKeys
+	var cookies []storedCookie
+	for _, r := range rows {
+		if len(r) != 8 {
+			continue
+		}
+		c := storedCookie{
+			Domain:   strings.TrimPrefix(r[0], "."),
+			HostOnly: !strings.HasPrefix(r[0], "."),
+			Path:     r[1],
+			Name:     r[2],
+			Value:    r[3],
+			Secure:   r[6] == "1",
+			HTTPOnly: r[7] == "1",
+		}
+		if micros, err := strconv.ParseInt(r[5], 10, 64); err == nil && micros > 0 {
+			c.Expires = time.Unix(micros/1e6-chromeEpochOffset, 0)
+		}
+
+		if encrypted := []byte(r[4]); len(encrypted) > 0 {
+			if keys == nil {
+				keys = newChromeKeys(browser)
+			}
+			value, err := keys.decrypt(encrypted)
+			if err != nil {
+				return nil, fmt.Errorf("decrypting %s: %w", c.Name, err)
+			}
+			if version >= 24 && len(value) >= 32 {
+				value = value[32:]
+			}
+			c.Value = string(value)
+		}
+		if !c.expired() {
+			cookies = append(cookies, c)
+		}
+	}
+	return cookies, nil
+}
+
+// chromeKeys derives the AES keys Chrome encrypts cookie values with. The
+// password comes from the OS keychain (which may prompt the user) and falls
+// back to Chrome's hard-coded "peanuts" on Linux systems without a keyring.
+type chromeKeys struct {
+	browser string
+	v10     []byte
+	v11     []byte
+}
+
+func newChromeKeys(browser string) *chromeKeys {
+	return &chromeKeys{browser: browser}
+}
+
+func (k *chromeKeys) decrypt(data []byte) ([]byte, error) {
+	if len(data) < 3 {
+		return nil, errors.New("value too short")
+	}
+	prefix := string(data[:3])
+
+	var key []byte
+	switch {
+	case runtime.GOOS == "darwin" && (prefix == "v10" || prefix == "v11"):
+		if k.v10 == nil {
+			password, err := macKeychainPassword(k.browser)
+			if err != nil {
+				return nil, err
+			}
+			k.v10 = pbkdf2SHA1([]byte(password), []byte("saltysalt"), 1003, 16)
+		}
+		key = k.v10
+	case prefix == "v10":
+		if k.v10 == nil {
+			k.v10 = pbkdf2SHA1([]byte("peanuts"), []byte("saltysalt"), 1, 16)
+		}
+		key = k.v10
+	case prefix == "v11":
+		if k.v11 == nil {
+			password, err := linuxKeyringPassword(k.browser)
+			if err != nil {
+				return nil, err
+			}
+			k.v11 = pbkdf2SHA1([]byte(password), []byte("saltysalt"), 1, 16)
+		}
+		key = k.v11
+	default:
+		return nil, fmt.Errorf("unsupported encryption (prefix %q); on Windows values are DPAPI protected", prefix)
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	ciphertext := data[3:]
+	if len(ciphertext) == 0 || len(ciphertext)%aes.BlockSize != 0 {
+		return nil, errors.New("invalid ciphertext length")
+	}
+	iv := []byte(strings.Repeat(" ", aes.BlockSize))
+	plain := make([]byte, len(ciphertext))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plain, ciphertext)
+
+	pad := int(plain[len(plain)-1])
+	if pad == 0 || pad > aes.BlockSize || pad > len(plain) {
+		return nil, errors.New("bad padding, wrong key?")
+	}
+	return plain[:len(plain)-pad], nil
+}
+
+func macKeychainPassword(browser string) (string, error) {
+	service := "Chrome Safe Storage"
+	if browser == "chromium" {
+		service = "Chromium Safe Storage"
+	}
+	out, err := exec.Command("security", "find-generic-password", "-w", "-s", service).Output()
+	if err != nil {
+		return "", fmt.Errorf("reading %q from the keychain: %w", service, err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func linuxKeyringPassword(browser string) (string, error) {
+	out, err := exec.Command("secret-tool", "lookup", "application", browser).Output()
+	if err != nil {
+		return "", fmt.Errorf("reading the %s key from the keyring (secret-tool): %w", browser, err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// pbkdf2SHA1 implements PBKDF2 (RFC 8018) with HMAC-SHA1
+func pbkdf2SHA1(password, salt []byte, iterations, keyLen int) []byte {
+	prf := hmac.New(sha1.New, password)
+	var out []byte
+	for block := uint32(1); len(out) < keyLen; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		binary.Write(prf, binary.BigEndian, block)
+		u := prf.Sum(nil)
+		t := append([]byte(nil), u...)
+		for i := 1; i < iterations; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+		out = append(out, t...)
+	}
+	return out[:keyLen]
+}
@@ -0,0 +1,475 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// bruBlock is a top-level block of a .bru file. Dictionary blocks such as
+// headers hold pairs, lists such as vars:secret hold items, and the
+// others, bodies, scripts and docs, hold text.
+type bruBlock struct {
+	name  string
+	pairs []bruPair
+	items []string
+	text  string
+}
+
+type bruPair struct {
+	key, value string
+	disabled   bool // prefixed with ~
+}
+
+// get returns the value of an enabled key of the block
+func (b *bruBlock) get(key string) string {
+	if b == nil {
+		return ""
+	}
+	for _, p := range b.pairs {
+		if p.key == key && !p.disabled {
+			return p.value
+		}
+	}
+	return ""
+}
+
+// bruFile is a parsed .bru file
+type bruFile []bruBlock
+
+func (f bruFile) block(name string) *bruBlock {
+	for i := range f {
+		if f[i].name == name {
+			return &f[i]
+		}
+	}
+	return nil
+}
+
+// bruBlockStart matches the first line of a block, e.g. "headers {" or
+// "vars:secret ["
+var bruBlockStart = regexp.MustCompile(`^([\w:-]+)\s*([{\[])\s*$`)
+
+// bruTextBlock tells blocks holding text from dictionaries
+func bruTextBlock(name string) bool {
+	switch {
+	case name == "body:form-urlencoded", name == "body:multipart-form", name == "body:file":
+		return false
+	case strings.HasPrefix(name, "body"), strings.HasPrefix(name, "script"), name == "tests", name == "docs":
+		return true
+	}
+	return false
+}
+
+// parseBru parses the Bru markup of Bruno's request, folder, collection and
+// environment files
+func parseBru(text string) (bruFile, error) {
+	var file bruFile
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		m := bruBlockStart.FindStringSubmatch(line)
+		if m == nil {
+			return nil, fmt.Errorf("line %d: expected the start of a block, got %q", i+1, line)
+		}
+		block := bruBlock{name: m[1]}
+		end := "}"
+		if m[2] == "[" {
+			end = "]"
+		}
+		var body []string
+		for i++; i < len(lines) && strings.TrimRight(lines[i], " \t") != end; i++ {
+			body = append(body, lines[i])
+		}
+		if i == len(lines) {
+			return nil, fmt.Errorf("block %s is not closed", block.name)
+		}
+
+		switch {
+		case m[2] == "[":
+			for _, item := range body {
+				if item = strings.TrimSuffix(strings.TrimSpace(item), ","); item != "" {
+					block.items = append(block.items, item)
+				}
+			}
+		case bruTextBlock(block.name):
+			for j, l := range body {
+				body[j] = strings.TrimPrefix(l, "  ")
+			}
+			block.text = strings.TrimSpace(strings.Join(body, "\n"))
+		default:
+			for _, l := range body {
+				l = strings.TrimSpace(l)
+				if l == "" {
+					continue
+				}
+				key, value, _ := strings.Cut(l, ":")
+				pair := bruPair{key: strings.TrimSpace(key), value: strings.TrimSpace(value)}
+				if k, ok := strings.CutPrefix(pair.key, "~"); ok {
+					pair.key, pair.disabled = k, true
+				}
+				block.pairs = append(block.pairs, pair)
+			}
+		}
+		file = append(file, block)
+	}
+	return file, nil
+}
+
+func readBru(path string) (bruFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	file, err := parseBru(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return file, nil
+}
+
+// bruMethods are the blocks naming the method of a request
+var bruMethods = []string{"get", "post", "put", "patch", "delete", "options", "head", "connect", "trace"}
+
+// bruResponsePath matches the post-response variables lazyhttp can
+// extract, e.g. res.body.data.token
+var bruResponsePath = regexp.MustCompile(`^res\.(status|body(?:\.[\w.\[\]]+)?|headers\.[\w-]+)$`)
+
+// bruDefaults are what a collection or folder passes down to its requests
+type bruDefaults struct {
+	headers []bruPair
+	auth    bruFile // holding the auth mode and block, nil for none
+}
+
+// importBruno converts a Bruno collection directory, or a single .bru
+// request. Folders, requests, headers and auth, inherited from folders
+// and the collection, become a collection; the environments in its
+// environments directory become lazyhttp environments. Request variables
+// become request variables and post-response variables reading the
+// response become extractions. Scripts and tests are not imported.
+func importBruno(path string) (importResult, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return importResult{}, err
+	}
+	root := path
+	if !info.IsDir() {
+		root = filepath.Dir(path)
+	}
+
+	name := filepath.Base(root)
+	if data, err := os.ReadFile(filepath.Join(root, "bruno.json")); err == nil {
+		var config struct {
+			Name string `json:"name"`
+		}
+		if json.Unmarshal(data, &config) == nil && config.Name != "" {
+			name = config.Name
+		}
+	} else if info.IsDir() {
+		return importResult{}, errors.New("not a Bruno collection, it has no bruno.json")
+	}
+	result := importResult{collection: &collection{Name: name}}
+	c := result.collection
+	warn := func(format string, a ...interface{}) {
+		result.warnings = append(result.warnings, fmt.Sprintf(format, a...))
+	}
+	scripts := 0
+
+	defaults := func(file bruFile, parent bruDefaults) bruDefaults {
+		d := bruDefaults{headers: parent.headers, auth: parent.auth}
+		if h := file.block("headers"); h != nil {
+			d.headers = append(append([]bruPair(nil), parent.headers...), h.pairs...)
+		}
+		if a := file.block("auth"); a != nil && a.get("mode") != "" && a.get("mode") != "inherit" {
+			d.auth = file
+		}
+		return d
+	}
+	var top bruDefaults
+	if file, err := readBru(filepath.Join(root, "collection.bru")); err == nil {
+		top = defaults(file, top)
+		scripts += countBruScripts(file)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return importResult{}, err
+	}
+
+	convert := func(file bruFile, folder string, d bruDefaults) {
+		meta := file.block("meta")
+		r := savedRequest{Name: meta.get("name"), Folder: folder}
+		if meta.get("type") == "graphql" {
+			r.Method = "POST"
+		}
+		reqWarn := func(format string, a ...interface{}) {
+			warn("%s: "+format, append([]interface{}{itemPath(r)}, a...)...)
+		}
+		var method *bruBlock
+		for _, m := range bruMethods {
+			if method = file.block(m); method != nil {
+				if m != "get" {
+					r.Method = strings.ToUpper(m)
+				}
+				break
+			}
+		}
+		if method == nil {
+			reqWarn("no method block, left out")
+			return
+		}
+		r.URL = brunoTemplates(method.get("url"))
+		if params := file.block("params:path"); params != nil {
+			for _, p := range params.pairs {
+				pattern := regexp.MustCompile(`/:` + regexp.QuoteMeta(p.key) + `([/?#]|$)`)
+				r.URL = pattern.ReplaceAllString(r.URL, "/"+strings.ReplaceAll(brunoTemplates(p.value), "$", "$$")+"$1")
+			}
+		}
+
+		headers := d.headers
+		if h := file.block("headers"); h != nil {
+			headers = append(append([]bruPair(nil), headers...), h.pairs...)
+		}
+		for _, h := range headers {
+			if h.disabled || h.key == "" {
+				continue
+			}
+			if r.Headers == nil {
+				r.Headers = map[string]string{}
+			}
+			setHeaderFold(r.Headers, h.key, brunoTemplates(h.value))
+		}
+
+		convertBrunoBody(&r, file, method.get("body"), reqWarn)
+
+		mode, authFile := method.get("auth"), file
+		if mode == "inherit" {
+			mode, authFile = d.auth.block("auth").get("mode"), d.auth
+		}
+		r.Auth = convertBrunoAuth(mode, authFile, reqWarn)
+
+		if vars := file.block("vars:pre-request"); vars != nil {
+			for _, v := range vars.pairs {
+				if !v.disabled {
+					if r.Variables == nil {
+						r.Variables = map[string]string{}
+					}
+					r.Variables[v.key] = brunoTemplates(v.value)
+				}
+			}
+		}
+		if vars := file.block("vars:post-response"); vars != nil {
+			for _, v := range vars.pairs {
+				if v.disabled {
+					continue
+				}
+				m := bruResponsePath.FindStringSubmatch(v.value)
+				if m == nil {
+					reqWarn("post-response variable %s = %s can't be extracted and was left out", v.key, v.value)
+					continue
+				}
+				if r.Extract == nil {
+					r.Extract = map[string]string{}
+				}
+				path := strings.NewReplacer("[", ".", "]", "").Replace(m[1])
+				r.Extract[v.key] = strings.Replace(path, "headers.", "header.", 1)
+			}
+		}
+		scripts += countBruScripts(file)
+		c.Requests = append(c.Requests, r)
+	}
+
+	if !info.IsDir() {
+		file, err := readBru(path)
+		if err != nil {
+			return importResult{}, err
+		}
+		convert(file, "", top)
+		return result, nil
+	}
+
+	var walk func(dir, folder string, d bruDefaults) error
+	walk = func(dir, folder string, d bruDefaults) error {
+		if file, err := readBru(filepath.Join(dir, "folder.bru")); err == nil {
+			d = defaults(file, d)
+			scripts += countBruScripts(file)
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return err
+		}
+		type request struct {
+			seq  int
+			file bruFile
+		}
+		var requests []request
+		var subdirs []string
+		for _, e := range entries {
+			switch {
+			case e.IsDir() && !(folder == "" && e.Name() == "environments") && e.Name() != "node_modules" && !strings.HasPrefix(e.Name(), "."):
+				subdirs = append(subdirs, e.Name())
+			case !e.IsDir() && strings.HasSuffix(e.Name(), ".bru") && e.Name() != "folder.bru" && e.Name() != "collection.bru":
+				file, err := readBru(filepath.Join(dir, e.Name()))
+				if err != nil {
+					return err
+				}
+				seq, _ := strconv.Atoi(file.block("meta").get("seq"))
+				requests = append(requests, request{seq, file})
+			}
+		}
+		sort.SliceStable(requests, func(i, j int) bool { return requests[i].seq < requests[j].seq })
+		for _, r := range requests {
+			convert(r.file, folder, d)
+		}
+		for _, sub := range subdirs {
+			path := sub
+			if folder != "" {
+				path = folder + "/" + sub
+			}
+			if err := walk(filepath.Join(dir, sub), path, d); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := walk(root, "", top); err != nil {
+		return importResult{}, err
+	}
+
+	envFiles, _ := filepath.Glob(filepath.Join(root, "environments", "*.bru"))
+	for _, envFile := range envFiles {
+		file, err := readBru(envFile)
+		if err != nil {
+			return importResult{}, err
+		}
+		env := environment{Name: strings.TrimSuffix(filepath.Base(envFile), ".bru"), Variables: map[string]string{}}
+		if vars := file.block("vars"); vars != nil {
+			for _, v := range vars.pairs {
+				if !v.disabled {
+					env.Variables[v.key] = brunoTemplates(v.value)
+				}
+			}
+		}
+		if secrets := file.block("vars:secret"); secrets != nil && len(secrets.items) > 0 {
+			warn("environment %s: the values of secret variables %s are not exported by Bruno, set them in %s", env.Name, strings.Join(secrets.items, ", "), localEnvironmentsFile)
+		}
+		result.environments = append(result.environments, env)
+	}
+
+	if scripts > 0 {
+		warn("%d scripts and tests were not imported", scripts)
+	}
+	return result, nil
+}
+
+// brunoTemplates turns Bruno's {{process.env.NAME}} into lazyhttp's
+// {{$env.NAME}}; other placeholders are the same
+func brunoTemplates(s string) string {
+	return templatePattern.ReplaceAllStringFunc(s, func(placeholder string) string {
+		name := templatePattern.FindStringSubmatch(placeholder)[1]
+		if env, ok := strings.CutPrefix(name, "process.env."); ok {
+			return "{{$env." + env + "}}"
+		}
+		return placeholder
+	})
+}
+
+// countBruScripts counts the script and test blocks that have content
+func countBruScripts(file bruFile) int {
+	n := 0
+	for _, b := range file {
+		if (strings.HasPrefix(b.name, "script") || b.name == "tests") && b.text != "" {
+			n++
+		}
+	}
+	return n
+}
+
+// bruContentTypes are the Content-Types of Bruno's body modes
+var bruContentTypes = map[string]string{
+	"json":    "application/json",
+	"xml":     "application/xml",
+	"text":    "text/plain",
+	"sparql":  "application/sparql-query",
+	"graphql": "application/json",
+}
+
+func convertBrunoBody(r *savedRequest, file bruFile, mode string, warn func(string, ...interface{})) {
+	setDefault := func(name, value string) {
+		if r.Headers == nil {
+			r.Headers = map[string]string{}
+		}
+		if headerValue(r.Headers, name) == "" {
+			r.Headers[name] = value
+		}
+	}
+	switch mode {
+	case "", "none":
+	case "json", "xml", "text", "sparql":
+		if b := file.block("body:" + mode); b != nil && b.text != "" {
+			r.Body = brunoTemplates(b.text)
+			setDefault("Content-Type", bruContentTypes[mode])
+		}
+	case "graphql":
+		var query string
+		if b := file.block("body:graphql"); b != nil {
+			query = b.text
+		}
+		body := map[string]interface{}{"query": query}
+		if vars := file.block("body:graphql:vars"); vars != nil && vars.text != "" {
+			if json.Valid([]byte(vars.text)) {
+				body["variables"] = json.RawMessage(vars.text)
+			} else {
+				warn("GraphQL variables are not valid JSON and were left out")
+			}
+		}
+		data, _ := json.Marshal(body)
+		r.Body = brunoTemplates(string(data))
+		setDefault("Content-Type", bruContentTypes[mode])
+	case "formUrlEncoded":
+		var fields []string
+		if b := file.block("body:form-urlencoded"); b != nil {
+			for _, p := range b.pairs {
+				if !p.disabled {
+					fields = append(fields, formEncode(brunoTemplates(p.key))+"="+formEncode(brunoTemplates(p.value)))
+				}
+			}
+		}
+		r.Body = strings.Join(fields, "&")
+		setDefault("Content-Type", "application/x-www-form-urlencoded")
+	case "multipartForm":
+		warn("multipart form bodies are not supported and were left out")
+	default:
+		warn("%s bodies are not supported and were left out", mode)
+	}
+}
+
+// convertBrunoAuth reads the auth:<mode> block of a request, folder or
+// collection file
+func convertBrunoAuth(mode string, file bruFile, warn func(string, ...interface{})) *requestAuth {
+	b := file.block("auth:" + mode)
+	switch mode {
+	case "", "none", "inherit":
+		return nil
+	case "basic":
+		return &requestAuth{Type: "basic", Username: brunoTemplates(b.get("username")), Password: brunoTemplates(b.get("password"))}
+	case "bearer":
+		return &requestAuth{Type: "bearer", Token: brunoTemplates(b.get("token"))}
+	case "apikey":
+		in := "header"
+		if b.get("placement") == "queryparams" {
+			in = "query"
+		}
+		return &requestAuth{Type: "apikey", Key: brunoTemplates(b.get("key")), Value: brunoTemplates(b.get("value")), In: in}
+	}
+	warn("%s auth is not supported and was left out", mode)
+	return nil
+}
@@ -0,0 +1,317 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// bundleManifest is the first entry of a workspace bundle and describes
+// the rest
+type bundleManifest struct {
+	Format    string    `json:"format"` // always bundleFormat
+	Version   int       `json:"version"`
+	Workspace string    `json:"workspace"`
+	Created   time.Time `json:"created"`
+	Files     []string  `json:"files"`
+
+	// Excluded lists what was deliberately left out of the bundle
+	Excluded []string `json:"excluded"`
+}
+
+const (
+	bundleFormat       = "lazyhttp-workspace"
+	bundleVersion      = 1
+	bundleManifestName = "manifest.json"
+)
+
+// bundleExcluded describes what a bundle never holds: secrets and
+// credentials, and state that only makes sense on the machine it was
+// recorded on
+var bundleExcluded = []string{
+	localEnvironmentsFile + " (secrets)",
+	"sessions and cookies (credentials)",
+	"the chosen environment, monitoring samples, circuit breakers and quota usage (local state)",
+}
+
+// bundleEntry is a file of the bundle, by its path inside the bundle
+type bundleEntry struct {
+	name, path string
+}
+
+// workspaceBundleEntries lists the files of the current workspace that go
+// into a bundle: collections, shared environments, views, OpenAPI specs and
+// schemas, and the history when asked for
+func workspaceBundleEntries(history bool) ([]bundleEntry, error) {
+	var entries []bundleEntry
+	add := func(name, path string) error {
+		info, err := os.Stat(path)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+			return nil
+		case err != nil:
+			return err
+		case !info.IsDir():
+			entries = append(entries, bundleEntry{name, path})
+			return nil
+		}
+		return filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+			if ext := filepath.Ext(p); err != nil || d.IsDir() || ext != ".json" && ext != viewExt {
+				return err
+			}
+			rel, err := filepath.Rel(path, p)
+			if err != nil {
+				return err
+			}
+			entries = append(entries, bundleEntry{name + "/" + filepath.ToSlash(rel), p})
+			return nil
+		})
+	}
+	if err := add(collectionsDir, filepath.Join(workspaceDir(), collectionsDir)); err != nil {
+		return nil, err
+	}
+	if err := add(environmentsFile, filepath.Join(workspaceDir(), environmentsFile)); err != nil {
+		return nil, err
+	}
+	if err := add(viewsDir, filepath.Join(workspaceDir(), viewsDir)); err != nil {
+		return nil, err
+	}
+	if err := add(specsDir, filepath.Join(workspaceDir(), specsDir)); err != nil {
+		return nil, err
+	}
+	if err := add(schemaDir, filepath.Join(workspaceStateDir(), schemaDir)); err != nil {
+		return nil, err
+	}
+	if history {
+		if err := add(historyFile, filepath.Join(workspaceStateDir(), historyFile)); err != nil {
+			return nil, err
+		}
+	}
+	return entries, nil
+}
+
+// literalSecrets lists the saved requests of the bundled collections that
+// hold credentials in the clear rather than as {{placeholders}}, which a
+// bundle can't tell from the rest and keeps as they are
+func literalSecrets(entries []bundleEntry) []string {
+	var found []string
+	for _, e := range entries {
+		if !strings.HasPrefix(e.name, collectionsDir+"/") {
+			continue
+		}
+		c, err := loadCollection(e.path)
+		if err != nil {
+			continue
+		}
+		for _, r := range c.Requests {
+			literal := func(v string) bool { return v != "" && !templatePattern.MatchString(v) }
+			secret := false
+			for name, value := range r.Headers {
+				if secretNamePattern.MatchString(name) && literal(value) {
+					secret = true
+				}
+			}
+			if a := r.Auth; a != nil && (literal(a.Password) || literal(a.Token) || literal(a.Value)) {
+				secret = true
+			}
+			if secret {
+				found = append(found, c.Name+" / "+itemPath(r))
+			}
+		}
+	}
+	return found
+}
+
+// exportWorkspaceCommand implements `lazyhttp export-workspace`: pack a
+// workspace into one .tar.gz to move it to another machine or share it
+func exportWorkspaceCommand(args []string) int {
+	fs := flag.NewFlagSet("export-workspace", flag.ExitOnError)
+	output := fs.String("o", "", "`file` to write (default: <workspace>.lazyhttp.tar.gz)")
+	name := fs.String("workspace", "", "workspace to export (default: the current one)")
+	history := fs.Bool("history", false, "include the request history, which may hold tokens in URLs")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: lazyhttp export-workspace [flags]\n\n")
+		fmt.Fprintf(fs.Output(), "Packs the collections, environments and schemas of a workspace into one file,\n")
+		fmt.Fprintf(fs.Output(), "leaving out secrets, sessions and cookies\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return 2
+	}
+	if *name != "" {
+		currentWorkspace = *name
+	}
+	if *output == "" {
+		*output = slugify(strings.TrimPrefix(currentWorkspace, "project:")) + ".lazyhttp.tar.gz"
+	}
+
+	entries, err := workspaceBundleEntries(*history)
+	if err == nil && len(entries) == 0 {
+		err = fmt.Errorf("workspace %q has nothing to export", currentWorkspace)
+	}
+	if err == nil {
+		err = writeBundle(*output, entries)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	if found := literalSecrets(entries); len(found) > 0 {
+		fmt.Fprintf(os.Stderr, "Warning: these requests hold credentials in the clear and were exported as they are: %s\n", strings.Join(found, ", "))
+	}
+	fmt.Printf("Exported workspace %q (%d files) to %s\n", currentWorkspace, len(entries), *output)
+	return 0
+}
+
+// writeBundle writes the manifest and entries as a .tar.gz
+func writeBundle(path string, entries []bundleEntry) error {
+	manifest := bundleManifest{
+		Format:    bundleFormat,
+		Version:   bundleVersion,
+		Workspace: currentWorkspace,
+		Created:   time.Now().UTC(),
+		Excluded:  bundleExcluded,
+	}
+	for _, e := range entries {
+		manifest.Files = append(manifest.Files, e.name)
+	}
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	gz := gzip.NewWriter(file)
+	tw := tar.NewWriter(gz)
+	write := func(name string, content []byte) error {
+		hdr := &tar.Header{Name: name, Mode: 0o600, Size: int64(len(content)), ModTime: manifest.Created, Typeflag: tar.TypeReg}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		_, err := tw.Write(content)
+		return err
+	}
+	err = write(bundleManifestName, append(data, '\n'))
+	for _, e := range entries {
+		if err != nil {
+			break
+		}
+		var content []byte
+		if content, err = os.ReadFile(e.path); err == nil {
+			err = write(e.name, content)
+		}
+	}
+	for _, closer := range []io.Closer{tw, gz, file} {
+		if closeErr := closer.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		os.Remove(path)
+	}
+	return err
+}
+
+// importWorkspaceCommand implements `lazyhttp import-workspace`: unpack a
+// bundle made by export-workspace into a workspace of its own
+func importWorkspaceCommand(args []string) int {
+	fs := flag.NewFlagSet("import-workspace", flag.ExitOnError)
+	name := fs.String("name", "", "`name` of the workspace to create (default: the name in the bundle)")
+	force := fs.Bool("force", false, "import into an existing workspace, replacing files of the same names")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: lazyhttp import-workspace [flags] <bundle.tar.gz>\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	fail := func(err error) int {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	staging, err := os.MkdirTemp("", "lazyhttp-bundle-")
+	if err != nil {
+		return fail(err)
+	}
+	defer os.RemoveAll(staging)
+	file, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return fail(err)
+	}
+	err = extractTarball(file, staging)
+	file.Close()
+	if err != nil {
+		return fail(err)
+	}
+	var manifest bundleManifest
+	data, err := os.ReadFile(filepath.Join(staging, bundleManifestName))
+	if err == nil {
+		err = json.Unmarshal(data, &manifest)
+	}
+	if err != nil || manifest.Format != bundleFormat {
+		return fail(fmt.Errorf("%s is not a workspace bundle made by lazyhttp export-workspace", fs.Arg(0)))
+	}
+	if manifest.Version > bundleVersion {
+		return fail(fmt.Errorf("the bundle is of version %d, this lazyhttp reads up to version %d", manifest.Version, bundleVersion))
+	}
+
+	target := manifest.Workspace
+	if *name != "" {
+		target = *name
+	}
+	if target == "" || strings.HasPrefix(target, "project:") || isRemoteWorkspace(target) {
+		return fail(fmt.Errorf("can't import into workspace %q, pass -name", target))
+	}
+	currentWorkspace = target
+	dest := workspaceDir()
+	if _, err := os.Stat(filepath.Join(dest, collectionsDir)); err == nil && !*force {
+		return fail(fmt.Errorf("workspace %q already exists, pass -force to import into it or -name to pick another name", target))
+	}
+
+	for _, f := range manifest.Files {
+		src := filepath.Join(staging, filepath.FromSlash(f))
+		if !filepath.IsLocal(filepath.FromSlash(f)) {
+			return fail(fmt.Errorf("bundle entry %q escapes the workspace", f))
+		}
+		content, err := os.ReadFile(src)
+		if err != nil {
+			return fail(fmt.Errorf("bundle is missing %s", f))
+		}
+		path := filepath.Join(dest, filepath.FromSlash(f))
+		if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+			return fail(err)
+		}
+		if err := os.WriteFile(path, content, 0o600); err != nil {
+			return fail(err)
+		}
+	}
+	if target != defaultWorkspace {
+		file, err := workspaceFile(workspaceNameFile)
+		if err == nil {
+			err = os.WriteFile(file, []byte(target+"\n"), 0o600)
+		}
+		if err != nil {
+			return fail(err)
+		}
+	}
+	fmt.Printf("Imported %d files into workspace %q (%s)\n", len(manifest.Files), target, dest)
+	fmt.Printf("Secrets weren't bundled: add them to %s of the workspace, or enter them when prompted\n", localEnvironmentsFile)
+	return 0
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// certExpiryWarning is how soon before expiring a certificate is
+// highlighted
+const certExpiryWarning = 30 * 24 * time.Hour
+
+// toggleCertificates shows the certificate chain of the last response in
+// place of the timing view, or the response again
+func (m model) toggleCertificates() model {
+	if m.fetching {
+		return m
+	}
+	m.dns.open = false
+	if m.showTiming && m.showCerts {
+		m.showTiming, m.showCerts = false, false
+	} else {
+		m.showTiming, m.showCerts = true, true
+	}
+	switch {
+	case m.showTiming:
+		m.response = m.renderTimingView()
+	case m.lastResponse != nil && m.err == nil:
+		m.response = m.renderLastResponse()
+	default:
+		m.response = ""
+	}
+	m.viewport.SetContent(m.response)
+	m.viewport.GotoTop()
+	return m
+}
+
+// renderCertificates draws the certificate chain the server of the last
+// request presented, leaf first, toggled with Alt+C
+func renderCertificates(t *requestTiming) string {
+	if t == nil {
+		return "No request sent yet."
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var sb strings.Builder
+	row := func(label, value string) {
+		fmt.Fprintf(&sb, "  %s %s\n", headerStyle.Render(fmt.Sprintf("%-13s", label)), value)
+	}
+	sb.WriteString(headerStyle.Render("Certificate chain"))
+	sb.WriteString("\n\n")
+	if len(t.certs) == 0 {
+		sb.WriteString(historyDimStyle.Render("The last request got no certificates: it wasn't made over TLS, or failed before the server sent them."))
+		sb.WriteString("\n")
+		return sb.String()
+	}
+	switch {
+	case t.verified:
+		sb.WriteString("Verified against the trusted certificate authorities.\n\n")
+	case t.unverified:
+		sb.WriteString(insecureBadgeStyle.Render("NOT VERIFIED") + timingLoseStyle.Render(" (-insecure or Alt+I)") + "\n\n")
+	default:
+		sb.WriteString(errorStyle.Render("This chain didn't verify, see the error of the request.") + "\n\n")
+	}
+
+	now := time.Now()
+	for i, cert := range t.certs {
+		role := "intermediate"
+		switch {
+		case i == 0:
+			role = "leaf"
+		case bytes.Equal(cert.RawSubject, cert.RawIssuer):
+			role = "root"
+		}
+		fmt.Fprintf(&sb, "%s %s\n", headerStyle.Render(fmt.Sprintf("%d. %s", i, cert.Subject.CommonName)), timingLoseStyle.Render("("+role+")"))
+		row("Subject", cert.Subject.String())
+		row("Issuer", cert.Issuer.String())
+		if sans := certificateSANs(cert); len(sans) > 0 {
+			row("Names", strings.Join(sans, ", "))
+		}
+		row("Valid", fmt.Sprintf("%s to %s", cert.NotBefore.Local().Format("2006-01-02 15:04"), cert.NotAfter.Local().Format("2006-01-02 15:04")))
+		row("Expires", describeExpiry(cert, now))
+		row("Key", describePublicKey(cert))
+		row("Signature", cert.SignatureAlgorithm.String())
+		if cert.IsCA {
+			row("CA", "yes")
+		}
+		sum := sha256.Sum256(cert.Raw)
+		row("SHA-256", hex.EncodeToString(sum[:]))
+		key := spkiPin(cert)
+		if t.serverName != "" && slices.Contains(t.pinnable, cert) && pinnedBy(t.serverName, cert) != "" {
+			key += timingWinStyle.Render(" ✓ pinned")
+		}
+		row("Key pin", key)
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// certificateSANs lists the subject alternative names of a certificate
+func certificateSANs(cert *x509.Certificate) []string {
+	sans := append([]string(nil), cert.DNSNames...)
+	for _, ip := range cert.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	sans = append(sans, cert.EmailAddresses...)
+	for _, u := range cert.URIs {
+		sans = append(sans, u.String())
+	}
+	return sans
+}
+
+// describeExpiry says how long a certificate has left, highlighted when
+// it has expired, isn't valid yet or expires soon
+func describeExpiry(cert *x509.Certificate, now time.Time) string {
+	switch left := cert.NotAfter.Sub(now); {
+	case now.Before(cert.NotBefore):
+		return errorStyle.Render(fmt.Sprintf("not valid for %s more days", daysText(cert.NotBefore.Sub(now))))
+	case left < 0:
+		return errorStyle.Render(fmt.Sprintf("EXPIRED %s days ago", daysText(-left)))
+	case left < certExpiryWarning:
+		return timingWarnStyle.Render(fmt.Sprintf("in %s days", daysText(left)))
+	default:
+		return fmt.Sprintf("in %s days", daysText(left))
+	}
+}
+
+// daysText is a duration in whole days
+func daysText(d time.Duration) string {
+	return fmt.Sprint(int(d.Hours() / 24))
+}
+
+// describePublicKey names the key algorithm of a certificate and its size
+func describePublicKey(cert *x509.Certificate) string {
+	switch key := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		return fmt.Sprintf("RSA %d bits", key.N.BitLen())
+	case *ecdsa.PublicKey:
+		return "ECDSA " + key.Curve.Params().Name
+	case ed25519.PublicKey:
+		return "Ed25519"
+	}
+	return cert.PublicKeyAlgorithm.String()
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"os"
+
+	"github.com/atotto/clipboard"
+	"github.com/aymanbagabas/go-osc52/v2"
+)
+
+// copyToClipboard puts text on the clipboard with the system's clipboard
+// tool (pbcopy, wl-copy, xclip, ...), or else asks the terminal to through
+// the OSC 52 escape sequence, which also works over SSH. It returns where
+// the text went, for the status bar.
+func copyToClipboard(text string) string {
+	if !clipboard.Unsupported && clipboard.WriteAll(text) == nil {
+		return "the clipboard"
+	}
+	seq := osc52.New(text)
+	if os.Getenv("TMUX") != "" {
+		seq = seq.Tmux()
+	}
+	// Stderr is the terminal too, and is left alone by the renderer
+	seq.WriteTo(os.Stderr)
+	return "the terminal clipboard via OSC 52"
+}
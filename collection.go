@@ -0,0 +1,342 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// collectionsDir is where the TUI keeps collections inside the workspace
+// directory, one file per collection in the format `lazyhttp run` reads
+const collectionsDir = "collections"
+
+// defaultCollection receives requests saved without a collection name
+const defaultCollection = "default"
+
+// savedRequest is a named request as stored in a collection file
+type savedRequest struct {
+	Name    string            `json:"name"`
+	Folder  string            `json:"folder,omitempty"` // e.g. "admin/users", shown as nested folders
+	Method  string            `json:"method,omitempty"`
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    string            `json:"body,omitempty"`
+
+	// BodyFile is sent as the body instead of Body when set
+	BodyFile string `json:"body_file,omitempty"`
+
+	// Auth adds credentials, taking precedence over an Authorization
+	// header
+	Auth *requestAuth `json:"auth,omitempty"`
+
+	// Variables pin template variables for this request, overriding the
+	// environment and -var flags
+	Variables map[string]string `json:"variables,omitempty"`
+
+	// Extract sets variables from the response for later requests, e.g.
+	// {"token": "body.access_token"}
+	Extract map[string]string `json:"extract,omitempty"`
+
+	// Timeouts override the -*-timeout flags for this request
+	Timeouts *requestTimeouts `json:"timeouts,omitempty"`
+
+	// HTTPVersion forces "1.1", "2" or "3" instead of the -http-version flag
+	HTTPVersion string `json:"http_version,omitempty"`
+
+	// Redirects is what to do with redirects instead of the -redirects
+	// flag: "follow", "none", "prompt" or the most hops to follow
+	Redirects string `json:"redirects,omitempty"`
+
+	// Resolve connects to other addresses than the hosts resolve to, e.g.
+	// {"api.example.com:443": "203.0.113.10"}, see resolveoverride.go
+	Resolve map[string]string `json:"resolve,omitempty"`
+
+	// Proxy sends the request through a proxy URL, or direct, instead of
+	// the one of its environment or -proxy
+	Proxy string `json:"proxy,omitempty"`
+
+	// Session sends the request in the named session instead of the
+	// active one, e.g. to run a step as "admin" in a collection otherwise
+	// run as "user"
+	Session string `json:"session,omitempty"`
+
+	// Expect holds the assertions checked by headless runs, and in the
+	// TUI where a miss raises an alert
+	Expect *expectations `json:"expect,omitempty"`
+
+	// Watch lists response values, as paths like those of Extract, that
+	// raise an alert when they change between two responses
+	Watch []string `json:"watch,omitempty"`
+
+	// Cost tallies what sending the request uses up of a daily quota, see
+	// quota.go
+	Cost *requestCost `json:"cost,omitempty"`
+
+	// OpenAPI is the operation of an imported spec the request was
+	// generated from, whose responses are checked against it
+	OpenAPI *openAPIRef `json:"openapi,omitempty"`
+
+	// DependsOn names requests that must complete successfully before this
+	// one is sent in a parallel run
+	DependsOn []string `json:"depends_on,omitempty"`
+
+	// Views name the custom views of the workspace offered as extra tabs
+	// on the response, see views.go
+	Views []string `json:"views,omitempty"`
+
+	// Filter is a jq or JSONPath expression the response is shown
+	// through, see filter.go
+	Filter string `json:"filter,omitempty"`
+
+	// inherited are the variables of the collection the request was loaded
+	// from
+	inherited variableLayer
+
+	// folders are the defaults of the folders the request is in, and
+	// folderVars their variables, outermost first
+	folders    []defaultsLayer
+	folderVars []variableLayer
+
+	// file is the collection file the request was loaded from, where
+	// changes made in the TUI are written back; empty for .http files
+	file string
+
+	// line is where the request starts in a .http file, at its ###
+	// separator, for editors sending the request under the cursor
+	line int
+}
+
+// expectations are the per-request budgets a headless run enforces. Zero
+// values are not checked.
+type expectations struct {
+	Status       int   `json:"status,omitempty"`
+	MaxLatencyMs int64 `json:"max_latency_ms,omitempty"`
+	MaxSizeBytes int64 `json:"max_size_bytes,omitempty"`
+}
+
+// check describes how a response misses the expectations
+func (e *expectations) check(status int, latencyMs, size int64) []string {
+	var failures []string
+	if e.Status != 0 && status != e.Status {
+		failures = append(failures, fmt.Sprintf("status %d, expected %d", status, e.Status))
+	}
+	if e.MaxLatencyMs > 0 && latencyMs > e.MaxLatencyMs {
+		failures = append(failures, fmt.Sprintf("latency %dms exceeds budget of %dms", latencyMs, e.MaxLatencyMs))
+	}
+	if e.MaxSizeBytes > 0 && size > e.MaxSizeBytes {
+		failures = append(failures, fmt.Sprintf("size %d bytes exceeds budget of %d bytes", size, e.MaxSizeBytes))
+	}
+	return failures
+}
+
+// collection is an ordered, named set of requests
+type collection struct {
+	Name string `json:"name"`
+
+	// Variables are defaults for the templates of the requests, under
+	// those of the environment
+	Variables map[string]string `json:"variables,omitempty"`
+
+	// Folders hold the variables and defaults of the requests in a folder
+	// and those nested in it, by folder path, e.g.
+	// {"billing": {"variables": {"base_path": "/billing/v2"}}}
+	Folders map[string]*collectionFolder `json:"folders,omitempty"`
+
+	Requests []savedRequest `json:"requests"`
+}
+
+// collectionFolder holds the settings of a folder of a collection
+type collectionFolder struct {
+	// Variables are defaults for the templates of the requests in the
+	// folder, over those of the collection and outer folders and under
+	// those of the environment
+	Variables map[string]string `json:"variables,omitempty"`
+
+	// The defaults of the requests in the folder, see defaults.go
+	requestDefaults
+}
+
+// loadCollection reads a collection file, or a .http or .rest file
+func loadCollection(path string) (*collection, error) {
+	if isHTTPFile(path) {
+		result, err := parseHTTPFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		c := result.collection
+		for i := range c.Requests {
+			c.Requests[i].inherited = variableLayer{source: "file " + c.Name, vars: c.Variables}
+		}
+		return c, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var c collection
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if c.Name == "" {
+		c.Name = path
+	}
+	for i := range c.Requests {
+		c.Requests[i].inherited = variableLayer{source: "collection " + c.Name, vars: c.Variables}
+		c.Requests[i].folders = c.folderDefaults(c.Requests[i].Folder)
+		c.Requests[i].folderVars = c.folderVariables(c.Requests[i].Folder)
+		c.Requests[i].file = path
+	}
+	return &c, nil
+}
+
+// validateDependencies checks that every dependency names a request in the
+// collection and that there are no cycles
+func (c *collection) validateDependencies() error {
+	index := map[string]int{}
+	duplicate := map[string]bool{}
+	for i, r := range c.Requests {
+		if _, seen := index[r.Name]; seen {
+			duplicate[r.Name] = true
+		}
+		index[r.Name] = i
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := make([]int, len(c.Requests))
+	var visit func(i int) error
+	visit = func(i int) error {
+		switch state[i] {
+		case visiting:
+			return fmt.Errorf("dependency cycle through %q", c.Requests[i].Name)
+		case done:
+			return nil
+		}
+		state[i] = visiting
+		for _, dep := range c.Requests[i].DependsOn {
+			j, ok := index[dep]
+			if !ok {
+				return fmt.Errorf("%q depends on unknown request %q", c.Requests[i].Name, dep)
+			}
+			if duplicate[dep] {
+				return fmt.Errorf("%q depends on %q, which names more than one request", c.Requests[i].Name, dep)
+			}
+			if err := visit(j); err != nil {
+				return err
+			}
+		}
+		state[i] = done
+		return nil
+	}
+	for i := range c.Requests {
+		if err := visit(i); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// method returns the request method, defaulting to GET
+func (r savedRequest) method() string {
+	if r.Method == "" {
+		return "GET"
+	}
+	return r.Method
+}
+
+// collectionPath is the file of the named collection
+func collectionPath(name string) string {
+	return filepath.Join(workspaceDir(), collectionsDir, slugify(name)+".json")
+}
+
+// listCollections loads every collection in the data directory, along
+// with the .http and .rest files there and those opened with -http, sorted
+// by name
+func listCollections() ([]*collection, error) {
+	var paths []string
+	for _, pattern := range []string{"*.json", "*.http", "*.rest"} {
+		matches, err := filepath.Glob(filepath.Join(workspaceDir(), collectionsDir, pattern))
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, matches...)
+	}
+	paths = append(paths, httpFiles...)
+	var collections []*collection
+	for _, path := range paths {
+		c, err := loadCollection(path)
+		if err != nil {
+			return collections, err
+		}
+		// Edits made outside lazyhttp are recorded as they're noticed
+		trackCollectionFile(path, c.Requests, "edit")
+		collections = append(collections, c)
+	}
+	sort.Slice(collections, func(i, j int) bool {
+		return strings.ToLower(collections[i].Name) < strings.ToLower(collections[j].Name)
+	})
+	return collections, nil
+}
+
+// saveToCollection adds r to the named collection, creating it if needed.
+// A request with the same name in the same folder is replaced.
+func saveToCollection(name string, r savedRequest) error {
+	if isRemoteWorkspace(currentWorkspace) {
+		return errReadOnlyWorkspace
+	}
+	path := collectionPath(name)
+	c, err := loadCollection(path)
+	if errors.Is(err, os.ErrNotExist) {
+		c, err = &collection{Name: name}, nil
+	}
+	if err != nil {
+		return err
+	}
+
+	replaced := false
+	for i := range c.Requests {
+		if c.Requests[i].Name == r.Name && c.Requests[i].Folder == r.Folder {
+			c.Requests[i] = r
+			replaced = true
+		}
+	}
+	if !replaced {
+		c.Requests = append(c.Requests, r)
+	}
+	return writeCollection(path, c)
+}
+
+// writeCollection writes a collection file, creating its directory
+func writeCollection(path string, c *collection) error {
+	return writeCollectionVia(path, c, "save")
+}
+
+// writeCollectionVia writes a collection file and records the changes to
+// its requests as made via "save", "import" or "revert"
+func writeCollectionVia(path string, c *collection, via string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	// A new file starts out empty, so its requests are recorded as added
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		trackCollectionFile(path, nil, via)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0o600); err != nil {
+		return err
+	}
+	// The collection is already written, a history that can't be isn't
+	// reported as its failure
+	trackCollectionFile(path, c.Requests, via)
+	return nil
+}
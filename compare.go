@@ -0,0 +1,329 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// compareMsg carries the responses to one request sent in two sessions
+type compareMsg struct {
+	sessions [2]string
+	method   string
+	url      string // secrets masked
+	results  [2]fetchMsg
+}
+
+// startCompare sends the request in the input line in two sessions at
+// once, "" standing for no session, to diff what each is allowed to see
+func (m model) startCompare(line string, sessions [2]string) (model, tea.Cmd) {
+	r := m.resolveInput(line)
+	var blocked bool
+	retry := func(m model) (model, tea.Cmd) { return m.startCompare(line, sessions) }
+	if m, blocked = m.checkUnresolved(r.missing, retry); blocked {
+		m.viewport.SetContent(m.response)
+		return m, nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	m.fetching = true
+	m.cancel = cancel
+	m.err = nil
+	m.notice = ""
+	m.response = fmt.Sprintf("Sending as %s and as %s...", sessionLabel(sessions[0]), sessionLabel(sessions[1]))
+	m.viewport.SetContent(m.response)
+	return m, func() tea.Msg {
+		msg := compareMsg{sessions: sessions, method: r.method, url: r.display}
+		done := make(chan struct{})
+		for i := range sessions {
+			go func(i int) {
+				sent := r
+				sent.session = sessions[i]
+				msg.results[i] = fetchQuietly(ctx, sent)
+				msg.results[i].err = maskSecrets(msg.results[i].err, r.url, r.display)
+				done <- struct{}{}
+			}(i)
+		}
+		<-done
+		<-done
+		return msg
+	}
+}
+
+// fetchQuietly sends r like streamFetch and returns the final result,
+// dropping the progress updates
+func fetchQuietly(ctx context.Context, r resolvedRequest) fetchMsg {
+	stream := make(chan tea.Msg, 16)
+	go streamFetch(ctx, r, stream)
+	for msg := range stream {
+		if done, ok := msg.(fetchMsg); ok {
+			return done
+		}
+	}
+	return fetchMsg{}
+}
+
+func sessionLabel(name string) string {
+	if name == "" {
+		return "no session"
+	}
+	return "session " + name
+}
+
+var (
+	compareSameStyle  = lipgloss.NewStyle().Foreground(lipgloss.Color("#98C379"))
+	compareFirstStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("#E06C75"))
+	compareOtherStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("#61AFEF"))
+	compareDimStyle   = lipgloss.NewStyle().Foreground(lipgloss.Color("#888888"))
+)
+
+// compareIgnoredHeaders differ between any two responses, or with the
+// body, which is compared on its own
+var compareIgnoredHeaders = map[string]bool{
+	"Date": true, "Content-Length": true, "Set-Cookie": true, "Age": true, "Expires": true,
+	"X-Request-Id": true, "X-Amzn-Requestid": true, "X-Amzn-Trace-Id": true, "Cf-Ray": true,
+}
+
+// maxCompareLines bounds each section of the comparison
+const maxCompareLines = 200
+
+// renderCompare shows the responses side by side where short, and what
+// differs between them: status, headers and, by JSON path or by line,
+// the body
+func renderCompare(msg compareMsg) string {
+	var sb strings.Builder
+	a, b := sessionLabel(msg.sessions[0]), sessionLabel(msg.sessions[1])
+	sb.WriteString(headerStyle.Render("Comparison"))
+	sb.WriteString(compareDimStyle.Render(fmt.Sprintf(" %s %s", msg.method, msg.url)))
+	sb.WriteString("\n\n")
+	fmt.Fprintf(&sb, "%s %s\n", compareFirstStyle.Render("−"), a)
+	fmt.Fprintf(&sb, "%s %s\n\n", compareOtherStyle.Render("+"), b)
+
+	for i, r := range msg.results {
+		label := []string{a, b}[i]
+		switch {
+		case r.err != nil:
+			fmt.Fprintf(&sb, "%s %s\n", headerStyle.Render(fmt.Sprintf("%-24s", label)), errorStyle.Render(r.err.Error()))
+		default:
+			fmt.Fprintf(&sb, "%s %s, %s\n", headerStyle.Render(fmt.Sprintf("%-24s", label)), r.status, formatBytes(int64(len(r.body))))
+		}
+	}
+	first, other := msg.results[0], msg.results[1]
+	if first.err != nil || other.err != nil {
+		return sb.String()
+	}
+
+	var differences []string
+	if first.statusCode != other.statusCode {
+		differences = append(differences, "status")
+	}
+
+	headerDiff := diffHeaders(first.header, other.header)
+	if len(headerDiff) > 0 {
+		differences = append(differences, "headers")
+	}
+	bodyDiff, how := diffBodies(first.body, other.body)
+	if len(bodyDiff) > 0 {
+		differences = append(differences, "body")
+	}
+
+	sb.WriteString("\n")
+	if len(differences) == 0 {
+		sb.WriteString(compareSameStyle.Render("✓ Same status, headers and body"))
+		sb.WriteString(compareDimStyle.Render(" (Date, Set-Cookie and request IDs aside)"))
+		sb.WriteString("\n")
+		return sb.String()
+	}
+	sb.WriteString(errorStyle.Render("≠ Different " + strings.Join(differences, ", ")))
+	sb.WriteString("\n")
+
+	if len(headerDiff) > 0 {
+		sb.WriteString("\n")
+		sb.WriteString(headerStyle.Render("Headers"))
+		sb.WriteString("\n")
+		writeDiffLines(&sb, headerDiff)
+	}
+	if len(bodyDiff) > 0 {
+		sb.WriteString("\n")
+		sb.WriteString(headerStyle.Render("Body") + compareDimStyle.Render(" "+how))
+		sb.WriteString("\n")
+		writeDiffLines(&sb, bodyDiff)
+	}
+	return sb.String()
+}
+
+// diffLine is a line of a diff: '-' only in the first response, '+' only
+// in the other, ' ' in both
+type diffLine struct {
+	op   byte
+	text string
+}
+
+func writeDiffLines(sb *strings.Builder, lines []diffLine) {
+	for i, l := range lines {
+		if i == maxCompareLines {
+			sb.WriteString(compareDimStyle.Render(fmt.Sprintf("  … %d more", len(lines)-i)))
+			sb.WriteString("\n")
+			break
+		}
+		switch l.op {
+		case '-':
+			sb.WriteString(compareFirstStyle.Render("− " + l.text))
+		case '+':
+			sb.WriteString(compareOtherStyle.Render("+ " + l.text))
+		default:
+			sb.WriteString(compareDimStyle.Render("  " + l.text))
+		}
+		sb.WriteString("\n")
+	}
+}
+
+func diffHeaders(a, b http.Header) []diffLine {
+	names := map[string]bool{}
+	for name := range a {
+		names[name] = true
+	}
+	for name := range b {
+		names[name] = true
+	}
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		if !compareIgnoredHeaders[name] {
+			sorted = append(sorted, name)
+		}
+	}
+	sort.Strings(sorted)
+
+	var out []diffLine
+	for _, name := range sorted {
+		va, vb := strings.Join(a.Values(name), ", "), strings.Join(b.Values(name), ", ")
+		if va == vb {
+			continue
+		}
+		if _, ok := a[name]; ok {
+			out = append(out, diffLine{'-', name + ": " + va})
+		}
+		if _, ok := b[name]; ok {
+			out = append(out, diffLine{'+', name + ": " + vb})
+		}
+	}
+	return out
+}
+
+// diffBodies compares JSON bodies by path, so fields one session sees and
+// the other doesn't stand out, and other bodies by line
+func diffBodies(a, b []byte) ([]diffLine, string) {
+	var ja, jb interface{}
+	if json.Unmarshal(a, &ja) == nil && json.Unmarshal(b, &jb) == nil {
+		return diffJSON(ja, jb), "(by JSON path)"
+	}
+	return diffLines(strings.Split(string(a), "\n"), strings.Split(string(b), "\n")), "(by line)"
+}
+
+func diffJSON(a, b interface{}) []diffLine {
+	fa, fb := map[string]string{}, map[string]string{}
+	flattenJSON(a, "", fa)
+	flattenJSON(b, "", fb)
+	paths := map[string]bool{}
+	for p := range fa {
+		paths[p] = true
+	}
+	for p := range fb {
+		paths[p] = true
+	}
+	sorted := make([]string, 0, len(paths))
+	for p := range paths {
+		sorted = append(sorted, p)
+	}
+	sort.Strings(sorted)
+
+	var out []diffLine
+	for _, p := range sorted {
+		va, inA := fa[p]
+		vb, inB := fb[p]
+		if inA && inB && va == vb {
+			continue
+		}
+		if inA {
+			out = append(out, diffLine{'-', p + " = " + va})
+		}
+		if inB {
+			out = append(out, diffLine{'+', p + " = " + vb})
+		}
+	}
+	return out
+}
+
+// flattenJSON records the scalar values of v by path, e.g. ".users[0].id",
+// and empty objects and arrays as such
+func flattenJSON(v interface{}, path string, out map[string]string) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if len(v) == 0 {
+			out[path] = "{}"
+		}
+		for k, child := range v {
+			flattenJSON(child, path+"."+k, out)
+		}
+	case []interface{}:
+		if len(v) == 0 {
+			out[path] = "[]"
+		}
+		for i, child := range v {
+			flattenJSON(child, fmt.Sprintf("%s[%d]", path, i), out)
+		}
+	default:
+		text, _ := json.Marshal(v)
+		if path == "" {
+			path = "."
+		}
+		out[path] = string(text)
+	}
+}
+
+// maxDiffLines bounds the line diff, which takes quadratic time
+const maxDiffLines = 2000
+
+// diffLines diffs two texts by their longest common subsequence of lines,
+// keeping only changed lines
+func diffLines(a, b []string) []diffLine {
+	if len(a) > maxDiffLines || len(b) > maxDiffLines {
+		return []diffLine{{' ', fmt.Sprintf("too long to diff by line (%d and %d lines)", len(a), len(b))}}
+	}
+	// lcs[i][j] is the length of the LCS of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+	var out []diffLine
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			out = append(out, diffLine{'-', a[i]})
+			i++
+		default:
+			out = append(out, diffLine{'+', b[j]})
+			j++
+		}
+	}
+	return out
+}
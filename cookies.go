@@ -0,0 +1,207 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// cookieJarFile is the jar's file name inside the data directory
+const cookieJarFile = "cookies.json"
+
+// storedCookie is the on-disk form of a cookie
+type storedCookie struct {
+	Domain   string    `json:"domain"`
+	HostOnly bool      `json:"host_only,omitempty"`
+	Path     string    `json:"path"`
+	Name     string    `json:"name"`
+	Value    string    `json:"value"`
+	Expires  time.Time `json:"expires,omitempty"`
+	Secure   bool      `json:"secure,omitempty"`
+	HTTPOnly bool      `json:"http_only,omitempty"`
+}
+
+func (c storedCookie) key() string {
+	return c.Domain + ";" + c.Path + ";" + c.Name
+}
+
+func (c storedCookie) expired() bool {
+	return !c.Expires.IsZero() && c.Expires.Before(time.Now())
+}
+
+// persistentJar wraps the standard cookie jar, which does all the matching,
+// and keeps a copy of every cookie it accepts so the jar can be saved
+type persistentJar struct {
+	*cookiejar.Jar
+
+	mu      sync.Mutex
+	cookies map[string]storedCookie
+}
+
+// cookieJar is shared by every client lazyhttp creates
+var cookieJar = newPersistentJar()
+
+func newPersistentJar() *persistentJar {
+	// Without the list, a cookie for Domain=com would be kept for every
+	// .com site
+	jar, _ := cookiejar.New(&cookiejar.Options{PublicSuffixList: publicsuffix.List})
+	return &persistentJar{Jar: jar, cookies: map[string]storedCookie{}}
+}
+
+// SetCookies records cookies set by a response before handing them to the
+// underlying jar. Cookies the jar refuses, for a domain the response's host
+// isn't in, aren't recorded either, or they would be loaded as valid by the
+// next session.
+func (j *persistentJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	j.Jar.SetCookies(u, cookies)
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for _, c := range cookies {
+		sc := storedCookie{
+			Domain:   strings.TrimPrefix(strings.ToLower(c.Domain), "."),
+			Path:     c.Path,
+			Name:     c.Name,
+			Value:    c.Value,
+			Expires:  c.Expires,
+			Secure:   c.Secure,
+			HTTPOnly: c.HttpOnly,
+		}
+		if sc.Domain == "" {
+			sc.Domain = strings.ToLower(u.Hostname())
+			sc.HostOnly = true
+		}
+		if !cookieDomainAllowed(u.Hostname(), sc.Domain) {
+			continue
+		}
+		if sc.Path == "" || !strings.HasPrefix(sc.Path, "/") {
+			sc.Path = defaultCookiePath(u.Path)
+		}
+		if c.MaxAge > 0 {
+			sc.Expires = time.Now().Add(time.Duration(c.MaxAge) * time.Second)
+		}
+		if c.MaxAge < 0 || sc.expired() {
+			delete(j.cookies, sc.key())
+			continue
+		}
+		j.cookies[sc.key()] = sc
+	}
+}
+
+// cookieDomainAllowed tells whether a response from host may set cookies
+// for domain: host itself, or a domain host is in that isn't a public
+// suffix such as com or co.uk (RFC 6265 5.3)
+func cookieDomainAllowed(host, domain string) bool {
+	host = strings.ToLower(host)
+	if domain == host {
+		return true
+	}
+	if net.ParseIP(host) != nil || !strings.HasSuffix(host, "."+domain) {
+		return false
+	}
+	suffix, _ := publicsuffix.PublicSuffix(domain)
+	return suffix != domain
+}
+
+// defaultCookiePath implements the default-path rule of RFC 6265 5.1.4
+func defaultCookiePath(p string) string {
+	if p == "" || p[0] != '/' {
+		return "/"
+	}
+	dir := path.Dir(p)
+	if dir == "." {
+		return "/"
+	}
+	return dir
+}
+
+// add puts a stored cookie back into the jar, e.g. when loading or
+// importing
+func (j *persistentJar) add(c storedCookie) {
+	scheme := "http"
+	if c.Secure {
+		scheme = "https"
+	}
+	u := &url.URL{Scheme: scheme, Host: c.Domain, Path: c.Path}
+	hc := &http.Cookie{
+		Name:     c.Name,
+		Value:    c.Value,
+		Path:     c.Path,
+		Expires:  c.Expires,
+		Secure:   c.Secure,
+		HttpOnly: c.HTTPOnly,
+	}
+	if !c.HostOnly {
+		hc.Domain = c.Domain
+	}
+	j.SetCookies(u, []*http.Cookie{hc})
+}
+
+// snapshot returns the live cookies of the jar
+func (j *persistentJar) snapshot() []storedCookie {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	var out []storedCookie
+	for _, c := range j.cookies {
+		if !c.expired() {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// loadCookieJar restores the jar saved by a previous session. Incognito
+// sessions start empty.
+func loadCookieJar() error {
+	if incognito {
+		return nil
+	}
+	file, err := dataFile(cookieJarFile)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var cookies []storedCookie
+	if err := json.Unmarshal(data, &cookies); err != nil {
+		return err
+	}
+	for _, c := range cookies {
+		if !c.expired() {
+			cookieJar.add(c)
+		}
+	}
+	return nil
+}
+
+// saveCookieJar writes the jar to disk; a no-op in incognito sessions
+func saveCookieJar() error {
+	if incognito {
+		return nil
+	}
+	file, err := dataFile(cookieJarFile)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(cookieJar.snapshot(), "", "  ")
+	if err != nil {
+		return err
+	}
+	// Cookies are credentials, keep them private
+	return os.WriteFile(file, data, 0o600)
+}
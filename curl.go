@@ -0,0 +1,764 @@
+package main
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// isCurlCommand reports whether the input line is a pasted curl command
+// rather than a request line
+func isCurlCommand(line string) bool {
+	return strings.HasPrefix(strings.TrimSpace(line), "curl ")
+}
+
+// curlValueOptions are the long names of the curl options taking a value,
+// which must be known to tell the value from the URL
+var curlValueOptions = map[string]bool{
+	"request": true, "header": true, "data": true, "data-raw": true, "data-binary": true,
+	"data-ascii": true, "data-urlencode": true, "json": true, "user": true, "user-agent": true,
+	"referer": true, "cookie": true, "form": true, "form-string": true, "url": true,
+	"oauth2-bearer": true, "upload-file": true, "output": true, "max-time": true,
+	"connect-timeout": true, "proxy": true, "proxy-user": true, "cert": true, "key": true,
+	"cacert": true, "capath": true, "resolve": true, "connect-to": true, "cookie-jar": true,
+	"write-out": true, "range": true, "retry": true, "retry-delay": true, "retry-max-time": true,
+	"max-redirs": true, "limit-rate": true, "interface": true, "dns-servers": true,
+	"trace": true, "trace-ascii": true, "stderr": true, "config": true, "unix-socket": true,
+	"aws-sigv4": true, "ciphers": true, "pinnedpubkey": true, "noproxy": true,
+	"tls-max": true,
+}
+
+// curlShortOptions maps curl's one-letter options to their long names
+var curlShortOptions = map[byte]string{
+	'X': "request", 'H': "header", 'd': "data", 'u': "user", 'A': "user-agent",
+	'e': "referer", 'b': "cookie", 'F': "form", 'T': "upload-file", 'o': "output",
+	'm': "max-time", 'x': "proxy", 'U': "proxy-user", 'E': "cert", 'c': "cookie-jar",
+	'w': "write-out", 'r': "range", 'K': "config", 'G': "get", 'I': "head",
+	'k': "insecure", 'L': "location", 's': "silent", 'S': "show-error", 'v': "verbose",
+	'i': "include", 'f': "fail", 'N': "no-buffer", 'g': "globoff", 'O': "remote-name",
+	'#': "progress-bar", 'n': "netrc", '4': "ipv4", '6': "ipv6",
+}
+
+// curlIgnoredOptions only change how curl itself reports or stores the
+// response, so dropping them changes nothing about the request
+var curlIgnoredOptions = map[string]bool{
+	"silent": true, "show-error": true, "verbose": true, "include": true, "fail": true,
+	"fail-with-body": true, "no-buffer": true, "globoff": true, "progress-bar": true,
+	"compressed": true, "location": true, "output": true, "remote-name": true,
+	"write-out": true, "stderr": true, "trace": true, "trace-ascii": true, "http1.1": true,
+	"no-progress-meter": true, "retry": true, "retry-delay": true,
+	"retry-max-time": true,
+}
+
+// parseCurl turns a curl command line, as API docs show them, into a
+// request. Options lazyhttp can't reproduce are left out and reported in
+// the warnings.
+func parseCurl(command string) (savedRequest, []string, error) {
+	args, err := shellWords(command)
+	if err != nil {
+		return savedRequest{}, nil, err
+	}
+	if len(args) == 0 || args[0] != "curl" {
+		return savedRequest{}, nil, errors.New("not a curl command")
+	}
+
+	r := savedRequest{Headers: map[string]string{}}
+	var (
+		warnings   []string
+		data       []string
+		dataFile   string
+		isJSON     bool
+		get, head  bool
+		extraURLs  int
+		unixSocket string
+		proxyUser  string
+		setHeader  = func(name, value string) { setHeaderFold(r.Headers, name, value) }
+		addWarning = func(format string, a ...interface{}) { warnings = append(warnings, fmt.Sprintf(format, a...)) }
+		setDefault = func(name, value string) {
+			if headerValue(r.Headers, name) == "" {
+				setHeader(name, value)
+			}
+		}
+	)
+
+	apply := func(flag, name, value string) {
+		switch name {
+		case "request":
+			r.Method = strings.ToUpper(value)
+		case "header":
+			key, v, ok := strings.Cut(value, ":")
+			switch {
+			case ok && strings.TrimSpace(v) == "":
+				// "Name:" removes a header curl would send
+				deleteHeaderFold(r.Headers, strings.TrimSpace(key))
+			case ok:
+				setHeader(strings.TrimSpace(key), strings.TrimSpace(v))
+			case strings.HasSuffix(value, ";"):
+				setHeader(strings.TrimSuffix(value, ";"), "")
+			default:
+				addWarning("%s %q ignored: not a header", flag, value)
+			}
+		case "data", "data-ascii", "data-binary":
+			if strings.HasPrefix(value, "@") {
+				if dataFile != "" || value == "@-" {
+					addWarning("%s %s ignored: only one body file is supported, and not stdin", flag, value)
+					return
+				}
+				dataFile = value[1:]
+				return
+			}
+			data = append(data, value)
+		case "data-raw":
+			data = append(data, value)
+		case "data-urlencode":
+			name, content, found := strings.Cut(value, "=")
+			switch {
+			case !found && strings.Contains(value, "@"):
+				addWarning("%s %s ignored: reading the value from a file is not supported", flag, value)
+			case !found:
+				data = append(data, url.QueryEscape(value))
+			case name == "":
+				data = append(data, url.QueryEscape(content))
+			default:
+				data = append(data, name+"="+url.QueryEscape(content))
+			}
+		case "json":
+			data = append(data, value)
+			isJSON = true
+		case "user":
+			user, password, ok := strings.Cut(value, ":")
+			if !ok {
+				addWarning("%s %s has no password, curl would prompt for it; an empty one is sent", flag, value)
+			}
+			r.Auth = &requestAuth{Type: "basic", Username: user, Password: password}
+		case "oauth2-bearer":
+			r.Auth = &requestAuth{Type: "bearer", Token: value}
+		case "user-agent":
+			setHeader("User-Agent", value)
+		case "referer":
+			setHeader("Referer", strings.TrimSuffix(value, ";auto"))
+		case "cookie":
+			if !strings.Contains(value, "=") {
+				addWarning("%s %s ignored: reading cookies from a file is not supported, the cookie jar is used", flag, value)
+				return
+			}
+			setHeader("Cookie", value)
+		case "url":
+			if r.URL != "" {
+				extraURLs++
+				return
+			}
+			r.URL = value
+		case "upload-file":
+			r.BodyFile = value
+			if r.Method == "" {
+				r.Method = "PUT"
+			}
+		case "get":
+			get = true
+		case "head":
+			head = true
+		case "connect-timeout", "max-time":
+			seconds, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				addWarning("%s %s ignored: not a number of seconds", flag, value)
+				return
+			}
+			if r.Timeouts == nil {
+				r.Timeouts = &requestTimeouts{}
+			}
+			if name == "max-time" {
+				r.Timeouts.TotalMs = int64(seconds * 1000)
+			} else {
+				r.Timeouts.ConnectMs = int64(seconds * 1000)
+			}
+		case "form", "form-string":
+			addWarning("%s ignored: multipart forms are not supported", flag)
+		case "insecure":
+			addWarning("%s ignored: certificates are verified unless lazyhttp runs with -insecure or Alt+I turns it off", flag)
+		case "cacert":
+			addWarning("%s %s ignored: give lazyhttp -cacert %s to trust it", flag, value, value)
+		case "tlsv1", "tlsv1.0", "tlsv1.1", "tlsv1.2", "tlsv1.3":
+			version := strings.TrimPrefix(name, "tlsv")
+			if version == "1" {
+				version = "1.0"
+			}
+			addWarning("%s ignored: give lazyhttp -tls-min %s", flag, version)
+		case "tls-max":
+			addWarning("%s %s ignored: give lazyhttp -tls-max %s", flag, value, value)
+		case "ciphers":
+			addWarning("%s ignored: give lazyhttp -ciphers with the IANA names of the suites", flag)
+		case "pinnedpubkey":
+			addWarning("%s ignored: give lazyhttp -pin host=%s, or add it to %s", flag, value, pinsFile)
+		case "max-redirs":
+			policy, err := parseRedirects(value)
+			if n, _ := strconv.Atoi(value); err != nil || n < 0 {
+				addWarning("%s %s ignored: not a number of redirects", flag, value)
+				return
+			}
+			r.Redirects = policy
+		case "unix-socket":
+			unixSocket = value
+		case "proxy":
+			if value == "" {
+				// curl -x "" turns a proxy of the environment off
+				r.Proxy = proxyDirect
+				return
+			}
+			if _, err := parseProxyURL(value); err != nil {
+				addWarning("%s %s ignored: %v", flag, value, err)
+				return
+			}
+			r.Proxy = value
+		case "proxy-user":
+			proxyUser = value
+		case "noproxy":
+			if value != "*" {
+				addWarning("%s %s ignored: only * is supported, NO_PROXY of the environment applies", flag, value)
+				return
+			}
+			r.Proxy = proxyDirect
+		case "resolve", "connect-to":
+			// host:port:address, and connect-to a port after the address
+			parts := strings.SplitN(value, ":", 3)
+			if len(parts) < 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+				addWarning("%s %s ignored: only host:port:address overrides are supported", flag, value)
+				return
+			}
+			addr := parts[2]
+			if name == "resolve" {
+				addr = strings.Trim(addr, "[]")
+			} else if host, port, ok := strings.Cut(addr, ":"); ok && port == "" {
+				addr = host
+			}
+			if r.Resolve == nil {
+				r.Resolve = map[string]string{}
+			}
+			r.Resolve[net.JoinHostPort(parts[0], parts[1])] = addr
+		default:
+			if !curlIgnoredOptions[name] {
+				addWarning("%s ignored: not supported", flag)
+			}
+		}
+	}
+
+	endOfOptions := false
+	for i := 1; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--" && !endOfOptions:
+			endOfOptions = true
+		case endOfOptions || !strings.HasPrefix(arg, "-") || arg == "-":
+			apply(arg, "url", arg)
+		case strings.HasPrefix(arg, "--"):
+			name := arg[2:]
+			if !curlValueOptions[name] {
+				apply(arg, name, "")
+				continue
+			}
+			if i+1 >= len(args) {
+				return savedRequest{}, nil, fmt.Errorf("%s needs a value", arg)
+			}
+			i++
+			apply(arg, name, args[i])
+		default:
+			// Short options cluster (-sSL) and take their value attached
+			// (-XPOST) or from the next argument
+			for j := 1; j < len(arg); j++ {
+				flag := "-" + string(arg[j])
+				name, ok := curlShortOptions[arg[j]]
+				if !ok {
+					addWarning("%s ignored: not supported", flag)
+					continue
+				}
+				if !curlValueOptions[name] {
+					apply(flag, name, "")
+					continue
+				}
+				value := arg[j+1:]
+				if value == "" {
+					if i+1 >= len(args) {
+						return savedRequest{}, nil, fmt.Errorf("%s needs a value", flag)
+					}
+					i++
+					value = args[i]
+				}
+				apply(flag, name, value)
+				break
+			}
+		}
+	}
+
+	if r.URL == "" {
+		return savedRequest{}, nil, errors.New("no URL in the curl command")
+	}
+	if extraURLs > 0 {
+		addWarning("%d more URL(s) ignored: only the first one is imported", extraURLs)
+	}
+	// Like curl, default to http:// rather than lazyhttp's https://
+	if !strings.Contains(r.URL, "://") {
+		r.URL = "http://" + r.URL
+	}
+	if proxyUser != "" {
+		if u, err := parseProxyURL(r.Proxy); r.Proxy != proxyDirect && err == nil {
+			if name, password, ok := strings.Cut(proxyUser, ":"); ok {
+				u.User = url.UserPassword(name, password)
+			} else {
+				u.User = url.User(name)
+			}
+			r.Proxy = u.String()
+		} else {
+			addWarning("--proxy-user ignored: no proxy to log in to")
+		}
+	}
+	if unixSocket != "" {
+		if u, err := url.Parse(r.URL); err == nil && u.Scheme == "http" {
+			r.URL = unixSocketScheme + unixSocket + ":" + u.RequestURI()
+		} else {
+			addWarning("--unix-socket %s ignored: only http:// URLs are sent over a socket", unixSocket)
+		}
+	}
+
+	if dataFile != "" && len(data) > 0 {
+		addWarning("inline data ignored: it can't be combined with a @file body, which is sent")
+		data = nil
+	}
+	switch {
+	case get && (len(data) > 0 || dataFile != ""):
+		if dataFile != "" {
+			addWarning("-G ignored for the @file body: only inline data goes into the query")
+		}
+		sep := "?"
+		if strings.Contains(r.URL, "?") {
+			sep = "&"
+		}
+		if len(data) > 0 {
+			r.URL += sep + strings.Join(data, "&")
+		}
+	case isJSON:
+		r.Body = strings.Join(data, "")
+		setDefault("Content-Type", "application/json")
+		setDefault("Accept", "application/json")
+	case len(data) > 0:
+		r.Body = strings.Join(data, "&")
+		setDefault("Content-Type", "application/x-www-form-urlencoded")
+	case dataFile != "":
+		r.BodyFile = dataFile
+	}
+
+	if r.Method == "" {
+		switch {
+		case head:
+			r.Method = "HEAD"
+		case !get && (r.Body != "" || r.BodyFile != ""):
+			r.Method = "POST"
+		default:
+			r.Method = "GET"
+		}
+	}
+	if len(r.Headers) == 0 {
+		r.Headers = nil
+	}
+	return r, warnings, nil
+}
+
+// setHeaderFold sets a header, replacing one whose name differs only in
+// case
+func setHeaderFold(headers map[string]string, name, value string) {
+	deleteHeaderFold(headers, name)
+	headers[name] = value
+}
+
+func deleteHeaderFold(headers map[string]string, name string) {
+	for k := range headers {
+		if strings.EqualFold(k, name) {
+			delete(headers, k)
+		}
+	}
+}
+
+// headerValue looks a header up regardless of the case of its name
+func headerValue(headers map[string]string, name string) string {
+	for k, v := range headers {
+		if strings.EqualFold(k, name) {
+			return v
+		}
+	}
+	return ""
+}
+
+// hasHeaderFold reports whether headers set name, in any case
+func hasHeaderFold(headers map[string]string, name string) bool {
+	for k := range headers {
+		if strings.EqualFold(k, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// shellWords splits a command line the way a POSIX shell would, with
+// single, double and $'…' quotes and backslash escapes. Shell variables
+// like $TOKEN, which docs use for credentials, become {{TOKEN}}
+// placeholders. Pasting a multi-line command turns its "\" line
+// continuations into "\ ", which are dropped like the continuations they
+// were.
+func shellWords(s string) ([]string, error) {
+	var (
+		words   []string
+		word    strings.Builder
+		inWord  bool
+		runes   = []rune(s)
+		isSpace = func(r rune) bool { return r == ' ' || r == '\t' || r == '\n' || r == '\r' }
+	)
+	for i := 0; i < len(runes); i++ {
+		c := runes[i]
+		switch {
+		case isSpace(c):
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		case c == '\\':
+			if i+1 >= len(runes) {
+				continue
+			}
+			i++
+			if isSpace(runes[i]) && (!inWord || runes[i] == '\n') {
+				continue
+			}
+			word.WriteRune(runes[i])
+			inWord = true
+		case c == '\'':
+			end := i + 1
+			for end < len(runes) && runes[end] != '\'' {
+				end++
+			}
+			if end >= len(runes) {
+				return nil, errors.New("unterminated ' quote")
+			}
+			word.WriteString(string(runes[i+1 : end]))
+			i = end
+			inWord = true
+		case c == '$' && i+1 < len(runes) && runes[i+1] == '\'':
+			n, err := ansiCQuote(runes[i+2:], &word)
+			if err != nil {
+				return nil, err
+			}
+			i += n + 2
+			inWord = true
+		case c == '$' && shellVariable(runes[i+1:]) > 0:
+			i += writeShellVariable(runes[i+1:], &word)
+			inWord = true
+		case c == '"':
+			closed := false
+			for i++; i < len(runes); i++ {
+				if runes[i] == '"' {
+					closed = true
+					break
+				}
+				if runes[i] == '\\' && i+1 < len(runes) && strings.ContainsRune("\"\\$`\n", runes[i+1]) {
+					i++
+					if runes[i] == '\n' {
+						continue
+					}
+				} else if runes[i] == '$' && shellVariable(runes[i+1:]) > 0 {
+					i += writeShellVariable(runes[i+1:], &word)
+					continue
+				}
+				word.WriteRune(runes[i])
+			}
+			if !closed {
+				return nil, errors.New(`unterminated " quote`)
+			}
+			inWord = true
+		default:
+			word.WriteRune(c)
+			inWord = true
+		}
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
+
+// shellVariable returns the length of the variable reference following a
+// $, NAME or {NAME}, or 0 when there is none
+func shellVariable(runes []rune) int {
+	isName := func(r rune, first bool) bool {
+		return r == '_' || r >= 'A' && r <= 'Z' || r >= 'a' && r <= 'z' || !first && r >= '0' && r <= '9'
+	}
+	if len(runes) > 0 && runes[0] == '{' {
+		end := 1
+		for end < len(runes) && isName(runes[end], end == 1) {
+			end++
+		}
+		if end > 1 && end < len(runes) && runes[end] == '}' {
+			return end + 1
+		}
+		return 0
+	}
+	n := 0
+	for n < len(runes) && isName(runes[n], n == 0) {
+		n++
+	}
+	return n
+}
+
+// writeShellVariable writes the variable reference at the start of runes
+// as a template placeholder, returning its length
+func writeShellVariable(runes []rune, word *strings.Builder) int {
+	n := shellVariable(runes)
+	word.WriteString("{{" + strings.Trim(string(runes[:n]), "{}") + "}}")
+	return n
+}
+
+// ansiCQuote decodes the inside of a $'…' quote into word, returning how
+// many runes it read including the closing quote
+func ansiCQuote(runes []rune, word *strings.Builder) (int, error) {
+	escapes := map[rune]string{'n': "\n", 't': "\t", 'r': "\r", '\\': "\\", '\'': "'", '"': "\"", 'e': "\x1b"}
+	for i := 0; i < len(runes); i++ {
+		switch {
+		case runes[i] == '\'':
+			return i, nil
+		case runes[i] == '\\' && i+1 < len(runes):
+			i++
+			if e, ok := escapes[runes[i]]; ok {
+				word.WriteString(e)
+			} else {
+				word.WriteRune('\\')
+				word.WriteRune(runes[i])
+			}
+		default:
+			word.WriteRune(runes[i])
+		}
+	}
+	return 0, errors.New("unterminated $' quote")
+}
+
+var curlWarningStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("#FFCC00"))
+
+// importCurl loads a pasted curl command into the request being edited:
+// its method and URL into the input line, its headers and body into the
+// draft sent with them. It is previewed rather than sent.
+func (m model) importCurl(command string) model {
+	r, warnings, err := parseCurl(command)
+	if err != nil {
+		m.notice = errorStyle.Render("curl import failed: " + err.Error())
+		return m
+	}
+	m.draft = &r
+	m.textInput.SetValue(r.requestLine())
+	m.textInput.CursorEnd()
+
+	var sb strings.Builder
+	for _, w := range warnings {
+		sb.WriteString(curlWarningStyle.Render("⚠ " + w))
+		sb.WriteString("\n")
+	}
+	if len(warnings) > 0 {
+		sb.WriteString("\n")
+	}
+	sb.WriteString(renderPreview(m.resolveInput(m.textInput.Value())))
+	m.err = nil
+	m.response = sb.String()
+	m.viewport.SetContent(m.response)
+	m.viewport.GotoTop()
+	m.notice = "Imported curl command, Enter sends it and Ctrl+S saves it"
+	return m
+}
+
+// sentHeaders lists the headers a resolved request goes out with, in
+// order: lazyhttp's own, the session's and cookies from the jar, then the
+// request's, which replace lazyhttp's defaults. masked leaves secret values
+// out, for display.
+func sentHeaders(r resolvedRequest, masked bool) [][2]string {
+	body, headers := r.body, r.headers
+	if masked {
+		body, headers = r.displayBody, r.displayHeaders
+	}
+	sent := [][2]string{{"User-Agent", defaultUserAgent}}
+	switch {
+	case r.bodyFile != "":
+		if file, _, contentType, err := openUploadBody(r.bodyFile); err == nil {
+			file.Close()
+			sent = append(sent, [2]string{"Content-Type", contentType})
+		}
+	case body != "" && json.Valid([]byte(body)):
+		sent = append(sent, [2]string{"Content-Type", "application/json"})
+	case body != "":
+		sent = append(sent, [2]string{"Content-Type", "text/plain; charset=utf-8"})
+	}
+	jar := http.CookieJar(cookieJar)
+	if sess, _ := requestSession(r.session, r.url); sess != nil {
+		jar = sess.jar
+		sessionHeaders := sess.headers()
+		for _, name := range sortedKeys(sessionHeaders) {
+			value := sessionHeaders[name]
+			if masked && secretNamePattern.MatchString(name) {
+				value = maskedValue
+			}
+			sent = append(sent, [2]string{name, value})
+		}
+	}
+	if u, err := url.Parse(r.url); err == nil {
+		var cookies []string
+		for _, c := range jar.Cookies(u) {
+			value := c.Value
+			if masked {
+				value = maskedValue
+			}
+			cookies = append(cookies, c.Name+"="+value)
+		}
+		if len(cookies) > 0 {
+			sent = append(sent, [2]string{"Cookie", strings.Join(cookies, "; ")})
+		}
+	}
+	for _, name := range sortedKeys(headers) {
+		value := headers[name]
+		if masked && secretNamePattern.MatchString(name) {
+			value = maskedValue
+		}
+		sent = append(sent, [2]string{name, value})
+	}
+	var kept [][2]string
+	for i, h := range sent {
+		if i < len(sent)-len(headers) && headerValue(headers, h[0]) != "" {
+			continue
+		}
+		kept = append(kept, h)
+	}
+	return kept
+}
+
+// curlCommand renders a resolved request as a curl command sending the
+// same: method, URL, headers (lazyhttp's own, the session's and cookies
+// from the jar included), body and connect timeout. masked leaves secret
+// values out, for display.
+func curlCommand(r resolvedRequest, masked bool) string {
+	target, body := r.url, r.body
+	if masked {
+		target, body = r.display, r.displayBody
+	}
+	socket, socketURL, overSocket := parseUnixSocketURL(target)
+	if overSocket {
+		target = socketURL
+	}
+	hasBody := body != "" || r.bodyFile != ""
+
+	first := "curl"
+	switch {
+	case r.method == "HEAD":
+		first += " --head"
+	case r.method == "GET" && !hasBody, r.method == "POST" && hasBody:
+	default:
+		first += " -X " + r.method
+	}
+	args := []string{first + " " + shellQuote(target)}
+	for _, h := range sentHeaders(r, masked) {
+		args = append(args, "-H "+shellQuote(h[0]+": "+h[1]))
+	}
+	args = append(args, "--compressed")
+	// curl doesn't follow redirects unless told to
+	switch policy, _ := parseRedirects(r.redirects); policy {
+	case redirectsNone, redirectsPrompt:
+	case "":
+		args = append(args, "--location")
+	default:
+		args = append(args, "--location --max-redirs "+policy)
+	}
+	if overSocket {
+		args = append(args, "--unix-socket "+shellQuote(socket))
+	}
+	switch p := strings.TrimSpace(r.proxy); p {
+	case "":
+	case proxyDirect:
+		args = append(args, "--noproxy "+shellQuote("*"))
+	default:
+		if u, err := parseProxyURL(p); err == nil && masked {
+			p = u.Redacted()
+		}
+		args = append(args, "--proxy "+shellQuote(p))
+	}
+
+	switch {
+	case r.bodyFile != "":
+		args = append(args, "--data-binary "+shellQuote("@"+r.bodyFile))
+	case body != "":
+		args = append(args, "--data-raw "+shellQuote(body))
+	}
+	if strings.HasPrefix(r.url, "https://") {
+		if insecureTLS.Load() {
+			args = append(args, "--insecure")
+		}
+		// curl takes a single bundle, in place of the system's
+		if len(caFiles) == 1 {
+			args = append(args, "--cacert "+shellQuote(caFiles[0]))
+		}
+		// curl names ciphers after its TLS library, so -ciphers isn't
+		// carried over
+		cfg := tlsConfig()
+		if cfg.MinVersion != 0 {
+			args = append(args, "--"+strings.ReplaceAll(strings.ToLower(tls.VersionName(cfg.MinVersion)), "tls ", "tlsv"))
+		}
+		if cfg.MaxVersion != 0 {
+			args = append(args, "--tls-max "+strings.TrimPrefix(tls.VersionName(cfg.MaxVersion), "TLS "))
+		}
+		// curl pins public keys only, not whole certificates
+		if u, err := url.Parse(r.url); err == nil {
+			pins, _ := pinsFor(u.Hostname())
+			var keys []string
+			for _, pin := range pins {
+				if strings.HasPrefix(pin, "sha256//") {
+					keys = append(keys, pin)
+				}
+			}
+			if len(keys) > 0 {
+				args = append(args, "--pinnedpubkey "+shellQuote(strings.Join(keys, ";")))
+			}
+		}
+	}
+	if r.timeouts.ConnectMs > 0 {
+		args = append(args, "--connect-timeout "+strconv.FormatFloat(float64(r.timeouts.ConnectMs)/1000, 'f', -1, 64))
+	}
+	if r.timeouts.TotalMs > 0 {
+		args = append(args, "--max-time "+strconv.FormatFloat(float64(r.timeouts.TotalMs)/1000, 'f', -1, 64))
+	}
+	if u, err := url.Parse(r.url); err == nil {
+		from := requestAddr(u)
+		if to := r.resolve.target(from); to != "" {
+			// --resolve keeps the port, --connect-to changes it too
+			_, fromPort, _ := net.SplitHostPort(from)
+			toHost, toPort, _ := net.SplitHostPort(to)
+			if strings.Contains(toHost, ":") {
+				toHost = "[" + toHost + "]"
+			}
+			if toPort == fromPort {
+				args = append(args, "--resolve "+shellQuote(from+":"+toHost))
+			} else {
+				args = append(args, "--connect-to "+shellQuote(from+":"+toHost+":"+toPort))
+			}
+		}
+	}
+	return strings.Join(args, " \\\n  ")
+}
+
+// shellQuote quotes s for POSIX shells when it needs it
+func shellQuote(s string) string {
+	if s != "" && strings.IndexFunc(s, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_./:@%+=,", r))
+	}) < 0 {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
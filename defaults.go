@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// defaultsFile holds the request defaults of a workspace, inherited by
+// the requests of all its collections, e.g.
+//
+//	{"headers": {"X-Team": "payments"}, "auth": {"type": "bearer", "token": "{{api_token}}"}}
+const defaultsFile = "defaults.json"
+
+// requestDefaults are settings saved requests inherit from their
+// workspace and folders unless they set their own
+type requestDefaults struct {
+	Headers     map[string]string `json:"headers,omitempty"`
+	Auth        *requestAuth      `json:"auth,omitempty"`
+	Timeouts    *requestTimeouts  `json:"timeouts,omitempty"`
+	HTTPVersion string            `json:"http_version,omitempty"`
+	Redirects   string            `json:"redirects,omitempty"`
+	Resolve     map[string]string `json:"resolve,omitempty"`
+}
+
+// defaultsLayer is a set of defaults and where it comes from
+type defaultsLayer struct {
+	source   string // "workspace" or "folder admin/users"
+	defaults *requestDefaults
+}
+
+// loadWorkspaceDefaults reads the request defaults of the current
+// workspace, nil when it has none. The file is read for each request
+// resolved, so edits apply to the next one.
+func loadWorkspaceDefaults() (*requestDefaults, error) {
+	data, err := os.ReadFile(filepath.Join(workspaceDir(), defaultsFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var d requestDefaults
+	if err := json.Unmarshal(data, &d); err != nil {
+		return nil, fmt.Errorf("%s: %w", defaultsFile, err)
+	}
+	return &d, nil
+}
+
+// folderPaths are the paths of the folder and those it is nested in,
+// outermost first: "admin", then "admin/users"
+func folderPaths(folder string) []string {
+	if folder == "" {
+		return nil
+	}
+	var paths []string
+	parts := strings.Split(folder, "/")
+	for i := range parts {
+		paths = append(paths, strings.Join(parts[:i+1], "/"))
+	}
+	return paths
+}
+
+// folderDefaults are the defaults of the folders a request is in,
+// outermost first
+func (c *collection) folderDefaults(folder string) []defaultsLayer {
+	var layers []defaultsLayer
+	for _, path := range folderPaths(folder) {
+		if f := c.Folders[path]; f != nil {
+			layers = append(layers, defaultsLayer{source: "folder " + path, defaults: &f.requestDefaults})
+		}
+	}
+	return layers
+}
+
+// folderVariables are the variables of the folders a request is in,
+// outermost first
+func (c *collection) folderVariables(folder string) []variableLayer {
+	var layers []variableLayer
+	for _, path := range folderPaths(folder) {
+		if f := c.Folders[path]; f != nil && len(f.Variables) > 0 {
+			layers = append(layers, variableLayer{source: "folder " + path, vars: f.Variables})
+		}
+	}
+	return layers
+}
+
+// withDefaults fills in what a request inherits from its workspace and
+// folders, nearer ones taking precedence, and lists what it inherited
+// from where. Requests typed in rather than loaded from a collection
+// inherit nothing.
+func (r savedRequest) withDefaults() (savedRequest, []string, error) {
+	if r.inherited.source == "" {
+		return r, nil, nil
+	}
+	workspace, err := loadWorkspaceDefaults()
+	if err != nil {
+		return r, nil, err
+	}
+	layers := r.folders
+	if workspace != nil {
+		layers = append([]defaultsLayer{{source: "workspace", defaults: workspace}}, layers...)
+	}
+	if len(layers) == 0 {
+		return r, nil, nil
+	}
+
+	// Walk from the nearest layer out, so the first to set a value wins
+	var inherited []string
+	headers := make(map[string]string, len(r.Headers))
+	for k, v := range r.Headers {
+		headers[k] = v
+	}
+	resolve := make(map[string]string, len(r.Resolve))
+	for k, v := range r.Resolve {
+		resolve[k] = v
+	}
+	var timeouts requestTimeouts
+	if r.Timeouts != nil {
+		timeouts = *r.Timeouts
+	}
+	for i := len(layers) - 1; i >= 0; i-- {
+		l := layers[i]
+		d := l.defaults
+		var names []string
+		for _, name := range sortedKeys(d.Headers) {
+			if !hasHeaderFold(headers, name) {
+				headers[name] = d.Headers[name]
+				names = append(names, name)
+			}
+		}
+		if len(names) > 0 {
+			inherited = append(inherited, fmt.Sprintf("headers %s (%s)", strings.Join(names, ", "), l.source))
+		}
+		if r.Auth == nil && d.Auth != nil {
+			auth := *d.Auth
+			r.Auth = &auth
+			inherited = append(inherited, fmt.Sprintf("%s (%s)", auth.describe(), l.source))
+		}
+		if d.Timeouts != nil {
+			if merged := d.Timeouts.merge(&timeouts); merged != timeouts {
+				timeouts = merged
+				r.Timeouts = &timeouts
+				inherited = append(inherited, fmt.Sprintf("timeouts (%s)", l.source))
+			}
+		}
+		if r.HTTPVersion == "" && d.HTTPVersion != "" {
+			r.HTTPVersion = d.HTTPVersion
+			inherited = append(inherited, fmt.Sprintf("HTTP version %s (%s)", d.HTTPVersion, l.source))
+		}
+		if r.Redirects == "" && d.Redirects != "" {
+			r.Redirects = d.Redirects
+			inherited = append(inherited, fmt.Sprintf("redirects %s (%s)", d.Redirects, l.source))
+		}
+		names = nil
+		for _, from := range sortedKeys(d.Resolve) {
+			if _, ok := resolve[from]; !ok {
+				resolve[from] = d.Resolve[from]
+				names = append(names, from)
+			}
+		}
+		if len(names) > 0 {
+			r.Resolve = resolve
+			inherited = append(inherited, fmt.Sprintf("connect to for %s (%s)", strings.Join(names, ", "), l.source))
+		}
+	}
+	r.Headers = headers
+	return r, inherited, nil
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// displayRulesFile holds the display rules of the workspace, adapting how
+// responses are shown to a team's conventions, e.g.
+// [{"status": "4xx", "open": "headers"}, {"contains": "error", "color": "red"}]
+const displayRulesFile = "display-rules.json"
+
+// displayRule applies its effects to the responses matching all of its
+// conditions
+type displayRule struct {
+	// Status is a status code, a class like 4xx or a range like 500-599,
+	// or a comma-separated list of those
+	Status statusPattern `json:"status,omitempty"`
+
+	// Contains is text the body holds, in any case
+	Contains string `json:"contains,omitempty"`
+
+	// Header is a header the response has, or "Name: text" for one whose
+	// value holds text
+	Header string `json:"header,omitempty"`
+
+	// URL is text the URL of the request holds
+	URL string `json:"url,omitempty"`
+
+	// Color draws the border and status of the response in a color, by
+	// name or as #rrggbb
+	Color string `json:"color,omitempty"`
+
+	// Label is shown above the response
+	Label string `json:"label,omitempty"`
+
+	// Collapse hides the body
+	Collapse bool `json:"collapse,omitempty"`
+
+	// Open shows the response with all its headers ("headers"), its
+	// timing ("timing") or through a custom view of its request
+	Open string `json:"open,omitempty"`
+}
+
+// statusPattern is a status code pattern, given as a string or a number
+type statusPattern string
+
+func (p *statusPattern) UnmarshalJSON(data []byte) error {
+	var code int
+	if err := json.Unmarshal(data, &code); err == nil {
+		*p = statusPattern(strconv.Itoa(code))
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return errors.New("status must be a code or a pattern like 4xx")
+	}
+	*p = statusPattern(s)
+	return p.check()
+}
+
+// check reports a pattern that can't match any status
+func (p statusPattern) check() error {
+	for _, part := range strings.Split(string(p), ",") {
+		part = strings.ToLower(strings.TrimSpace(part))
+		if lo, hi, ok := strings.Cut(part, "-"); ok {
+			a, errA := strconv.Atoi(strings.TrimSpace(lo))
+			b, errB := strconv.Atoi(strings.TrimSpace(hi))
+			if errA != nil || errB != nil || a > b {
+				return fmt.Errorf("status %q: expected a range like 500-599", part)
+			}
+			continue
+		}
+		if len(part) != 3 || part[0] < '1' || part[0] > '5' || strings.Trim(part[1:], "0123456789x") != "" {
+			return fmt.Errorf("status %q: expected a code like 404 or a class like 4xx", part)
+		}
+	}
+	return nil
+}
+
+// matches reports whether code is among the statuses of the pattern
+func (p statusPattern) matches(code int) bool {
+	s := strconv.Itoa(code)
+	for _, part := range strings.Split(string(p), ",") {
+		part = strings.ToLower(strings.TrimSpace(part))
+		if lo, hi, ok := strings.Cut(part, "-"); ok {
+			a, _ := strconv.Atoi(strings.TrimSpace(lo))
+			b, _ := strconv.Atoi(strings.TrimSpace(hi))
+			if code >= a && code <= b {
+				return true
+			}
+			continue
+		}
+		if len(part) != len(s) {
+			continue
+		}
+		match := true
+		for i := range part {
+			if part[i] != 'x' && part[i] != s[i] {
+				match = false
+			}
+		}
+		if match {
+			return true
+		}
+	}
+	return false
+}
+
+// ruleColors are the color names rules can use
+var ruleColors = map[string]string{
+	"red":     "#FF5555",
+	"orange":  "#D19A66",
+	"yellow":  "#E5C07B",
+	"green":   "#98C379",
+	"cyan":    "#56B6C2",
+	"blue":    "#61AFEF",
+	"magenta": "#C678DD",
+	"gray":    "#888888",
+}
+
+// ruleColor is the color a rule names, "" when it names none
+func ruleColor(name string) (string, error) {
+	if name == "" {
+		return "", nil
+	}
+	if hex, ok := ruleColors[strings.ToLower(name)]; ok {
+		return hex, nil
+	}
+	if len(name) == 7 && name[0] == '#' {
+		if _, err := strconv.ParseUint(name[1:], 16, 32); err == nil {
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("unknown color %q, use #rrggbb or one of %s", name, strings.Join(sortedKeys(ruleColors), ", "))
+}
+
+// loadDisplayRules reads the display rules of the workspace. The file is
+// read for every response, so edits apply to the next one.
+func loadDisplayRules() ([]displayRule, error) {
+	path, err := workspaceFile(displayRulesFile)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var rules []displayRule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("%s: %w", displayRulesFile, err)
+	}
+	for i, r := range rules {
+		if _, err := ruleColor(r.Color); err != nil {
+			return nil, fmt.Errorf("%s: rule %d: %w", displayRulesFile, i+1, err)
+		}
+	}
+	return rules, nil
+}
+
+// matches reports whether a response to the request at url meets all the
+// conditions of the rule
+func (r displayRule) matches(resp fetchMsg, url string) bool {
+	if r.Status != "" && !r.Status.matches(resp.statusCode) {
+		return false
+	}
+	if r.Contains != "" && !bytes.Contains(bytes.ToLower(resp.body), []byte(strings.ToLower(r.Contains))) {
+		return false
+	}
+	if r.Header != "" {
+		name, text, hasText := strings.Cut(r.Header, ":")
+		values := resp.header.Values(strings.TrimSpace(name))
+		if len(values) == 0 {
+			return false
+		}
+		if text = strings.ToLower(strings.TrimSpace(text)); hasText && text != "" {
+			found := false
+			for _, v := range values {
+				found = found || strings.Contains(strings.ToLower(v), text)
+			}
+			if !found {
+				return false
+			}
+		}
+	}
+	return r.URL == "" || strings.Contains(url, r.URL)
+}
+
+// displayEffects is what the rules matching a response do to it; later
+// rules override the color and what's opened of earlier ones
+type displayEffects struct {
+	color  string
+	labels []string
+	open   string
+
+	// collapsible is set when a rule collapses the body, and collapse
+	// while it's collapsed, Ctrl+_ toggling it
+	collapsible bool
+	collapse    bool
+
+	// format is the format the body is forced to with Alt+P, "" leaving
+	// it to detection
+	format string
+}
+
+// applyDisplayRules gathers the effects of the rules matching a response
+func applyDisplayRules(rules []displayRule, resp fetchMsg, url string) displayEffects {
+	var d displayEffects
+	for _, r := range rules {
+		if !r.matches(resp, url) {
+			continue
+		}
+		if color, _ := ruleColor(r.Color); color != "" {
+			d.color = color
+		}
+		if r.Label != "" {
+			d.labels = append(d.labels, r.Label)
+		}
+		d.collapsible = d.collapsible || r.Collapse
+		d.collapse = d.collapsible
+		if r.Open != "" {
+			d.open = r.Open
+		}
+	}
+	return d
+}
+
+// defaultResponseBorder is the border color of the response pane
+const defaultResponseBorder = "#7D56F4"
+
+// applyDisplayEffects shows the last response as its display rules have
+// it: the border in their color, and the headers, timing or custom view
+// they open
+func (m model) applyDisplayEffects() model {
+	d := m.display
+	border := defaultResponseBorder
+	if d.color != "" {
+		border = d.color
+	}
+	m.viewport.Style = m.viewport.Style.BorderForeground(lipgloss.Color(border))
+	switch d.open {
+	case "", "headers":
+	case "timing":
+		m.showTiming, m.showCerts = true, false
+	default:
+		for i, view := range m.views {
+			if view == d.open {
+				m.viewTab = i + 1
+			}
+		}
+	}
+	return m
+}
+
+// renderDisplayLabels shows the labels of the rules matching a response
+func renderDisplayLabels(d displayEffects) string {
+	if len(d.labels) == 0 {
+		return ""
+	}
+	style := lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("#FFCC00"))
+	if d.color != "" {
+		style = style.Foreground(lipgloss.Color(d.color))
+	}
+	return style.Render("⚑ "+strings.Join(d.labels, " • ")) + "\n\n"
+}
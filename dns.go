@@ -0,0 +1,304 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// dnsLookupTimeout bounds a lookup from the DNS panel
+const dnsLookupTimeout = 10 * time.Second
+
+// dnsRecords is one kind of record looked up for the DNS panel
+type dnsRecords struct {
+	values []string
+	took   time.Duration
+	err    error
+}
+
+// dnsLookup is a fresh resolution of a host, each record type queried on
+// its own so a slow or failing one stands out
+type dnsLookup struct {
+	host     string
+	at       time.Time
+	cname    dnsRecords
+	a, aaaa  dnsRecords
+	total    time.Duration
+	resolver string
+	literal  bool // the host is an address, nothing to resolve
+}
+
+// dnsPanel is the DNS panel shown instead of the response while open;
+// seq drops lookups superseded by a newer one
+type dnsPanel struct {
+	open   bool
+	host   string
+	seq    int
+	lookup *dnsLookup
+}
+
+// dnsLookupMsg carries a lookup started with Alt+R
+type dnsLookupMsg struct {
+	seq    int
+	lookup dnsLookup
+}
+
+// lookupHost resolves host the way requests do, with -resolver or the
+// system's
+func lookupHost(ctx context.Context, host string) dnsLookup {
+	l := dnsLookup{host: host, at: time.Now(), resolver: describeResolver()}
+	if net.ParseIP(host) != nil {
+		l.literal = true
+		return l
+	}
+	query := func(rec *dnsRecords, lookup func() ([]string, error)) {
+		start := time.Now()
+		rec.values, rec.err = lookup()
+		rec.took = time.Since(start)
+	}
+	ips := func(network string) func() ([]string, error) {
+		return func() ([]string, error) {
+			found, err := activeResolver().LookupIP(ctx, network, host)
+			var addrs []string
+			for _, ip := range found {
+				addrs = append(addrs, ip.String())
+			}
+			return addrs, err
+		}
+	}
+	var wg sync.WaitGroup
+	for _, q := range []struct {
+		rec    *dnsRecords
+		lookup func() ([]string, error)
+	}{
+		{&l.cname, func() ([]string, error) {
+			name, err := activeResolver().LookupCNAME(ctx, host)
+			// Without a CNAME the name comes back as it was asked for
+			if err != nil || strings.TrimSuffix(name, ".") == strings.TrimSuffix(host, ".") {
+				return nil, err
+			}
+			return []string{strings.TrimSuffix(name, ".")}, nil
+		}},
+		{&l.a, ips("ip4")},
+		{&l.aaaa, ips("ip6")},
+	} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			query(q.rec, q.lookup)
+		}()
+	}
+	wg.Wait()
+	l.total = time.Since(l.at)
+	return l
+}
+
+// lookupDNS runs a lookup for the DNS panel
+func lookupDNS(seq int, host string) tea.Cmd {
+	return func() tea.Msg {
+		ctx, cancel := context.WithTimeout(context.Background(), dnsLookupTimeout)
+		defer cancel()
+		return dnsLookupMsg{seq: seq, lookup: lookupHost(ctx, host)}
+	}
+}
+
+// describeResolver names the resolver requests use, with the last error of
+// DNS over HTTPS, which the lookups only see as SERVFAIL
+func describeResolver() string {
+	if customResolver == nil {
+		if servers := systemNameservers(); len(servers) > 0 {
+			return "system, " + strings.Join(servers, ", ") + " from /etc/resolv.conf"
+		}
+		return "system"
+	}
+	if err := dohError(); err != nil {
+		return resolverName + " " + errorStyle.Render("("+err.Error()+")")
+	}
+	return resolverName
+}
+
+// systemNameservers are the servers of /etc/resolv.conf, none where there
+// is no such file
+func systemNameservers() []string {
+	f, err := os.Open("/etc/resolv.conf")
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	var servers []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "nameserver" {
+			servers = append(servers, fields[1])
+		}
+	}
+	return servers
+}
+
+// isNoRecords reports whether a lookup found the name but no record of
+// the type asked for, or no name at all. Names from /etc/hosts without an
+// address of the family come back as an AddrError.
+func isNoRecords(err error) bool {
+	var dnsErr *net.DNSError
+	var addrErr *net.AddrError
+	return errors.As(err, &dnsErr) && dnsErr.IsNotFound || errors.As(err, &addrErr)
+}
+
+// describeDNSError is what the panel shows for a failed lookup
+func describeDNSError(err error) string {
+	var dnsErr *net.DNSError
+	switch {
+	case errors.As(err, &dnsErr) && dnsErr.IsTimeout:
+		return "timed out, the resolver didn't answer"
+	case errors.As(err, &dnsErr) && dnsErr.IsNotFound:
+		return "no records"
+	case errors.As(err, &dnsErr):
+		return dnsErr.Err
+	}
+	return err.Error()
+}
+
+// dnsDiagnosis sums up whether a host's problem is DNS, comparing the
+// lookup with the address the last request to it connected to
+func dnsDiagnosis(l dnsLookup, used string) string {
+	found := len(l.a.values) + len(l.aaaa.values)
+	var dnsErr *net.DNSError
+	switch {
+	case found == 0 && (errors.As(l.a.err, &dnsErr) && dnsErr.IsTimeout || errors.As(l.aaaa.err, &dnsErr) && dnsErr.IsTimeout):
+		return "The resolver doesn't answer: a DNS problem, requests to this host can't even start."
+	case found == 0 && isNoRecords(l.a.err) && isNoRecords(l.aaaa.err):
+		return "The name doesn't resolve: a DNS problem (typo, missing record or split-horizon DNS), not an HTTP one."
+	case found == 0:
+		return "The lookup failed: a DNS problem, not an HTTP one."
+	case used != "":
+		host, _, err := net.SplitHostPort(used)
+		if err != nil {
+			host = used
+		}
+		for _, addr := range append(l.a.values, l.aaaa.values...) {
+			if addr == host {
+				return "The name resolves and the last request reached one of its addresses: look at HTTP rather than DNS."
+			}
+		}
+		return fmt.Sprintf("The last request went to %s, which the name no longer resolves to: the records changed or something cached the old ones.", host)
+	}
+	return "The name resolves: failures connecting to it or in the response aren't DNS problems."
+}
+
+// renderDNS draws the DNS panel, toggled with Alt+R; used is the address
+// the last request to the host connected to, "" for none
+func renderDNS(l *dnsLookup, used string) string {
+	var sb strings.Builder
+	row := func(label, value string) {
+		fmt.Fprintf(&sb, "%s %s\n", headerStyle.Render(fmt.Sprintf("%-15s", label)), value)
+	}
+	records := func(label string, rec dnsRecords, none string) {
+		took := timingLoseStyle.Render(" (" + formatDuration(rec.took) + ")")
+		switch {
+		case rec.err != nil && !isNoRecords(rec.err):
+			row(label, errorStyle.Render(describeDNSError(rec.err))+took)
+		case len(rec.values) == 0:
+			row(label, timingLoseStyle.Render(none)+took)
+		default:
+			row(label, strings.Join(rec.values, ", ")+took)
+		}
+	}
+	sb.WriteString(headerStyle.Render("DNS " + l.host))
+	sb.WriteString("\n\n")
+	row("Resolver", l.resolver)
+	if l.literal {
+		row("Lookup", timingLoseStyle.Render("none, the host is an address"))
+		return sb.String()
+	}
+	records("CNAME", l.cname, "none")
+	records("A", l.a, "no records")
+	records("AAAA", l.aaaa, "no records")
+	row("Resolved in", formatDuration(l.total)+timingLoseStyle.Render(" at "+l.at.Format("15:04:05")))
+	if used != "" {
+		row("Last request", "connected to "+used)
+	}
+	sb.WriteString("\n")
+	sb.WriteString(timingWarnStyle.Render(dnsDiagnosis(*l, used)))
+	sb.WriteString("\n")
+	return sb.String()
+}
+
+// dnsTarget is the host the DNS panel looks up: that of the input line,
+// or of the last response when the line has no URL
+func (m model) dnsTarget() string {
+	if line := strings.TrimSpace(m.textInput.Value()); line != "" {
+		if u, err := url.Parse(m.resolveInput(line).url); err == nil && u.Hostname() != "" {
+			return u.Hostname()
+		}
+	}
+	if m.lastResponse != nil {
+		if u, err := url.Parse(m.lastResponse.url); err == nil {
+			return u.Hostname()
+		}
+	}
+	return ""
+}
+
+// toggleDNS opens the DNS panel with a fresh lookup, or closes it back to
+// the response
+func (m model) toggleDNS() (model, tea.Cmd) {
+	if m.fetching {
+		return m, nil
+	}
+	if m.dns.open {
+		m.dns.open = false
+		m.response = ""
+		if m.lastResponse != nil && m.err == nil {
+			m.response = m.renderLastResponse()
+		}
+		m.viewport.SetContent(m.response)
+		return m, nil
+	}
+	host := m.dnsTarget()
+	if host == "" {
+		m.notice = "Type a URL to look up its host"
+		return m, nil
+	}
+	m.showTiming, m.showCerts = false, false
+	m.dns.open, m.dns.host, m.dns.lookup = true, host, nil
+	m.dns.seq++
+	m.response = "Looking up " + host + "..."
+	m.viewport.SetContent(m.response)
+	m.viewport.GotoTop()
+	return m, lookupDNS(m.dns.seq, host)
+}
+
+// dnsLooked shows a finished lookup, if the panel still waits for it
+func (m model) dnsLooked(msg dnsLookupMsg) model {
+	if !m.dns.open || msg.seq != m.dns.seq {
+		return m
+	}
+	m.dns.lookup = &msg.lookup
+	m.response = renderDNS(m.dns.lookup, m.dnsUsedAddr())
+	m.viewport.SetContent(m.response)
+	return m
+}
+
+// dnsUsedAddr is the address the last request connected to, when it went
+// to the host of the panel
+func (m model) dnsUsedAddr() string {
+	if m.timing == nil || m.lastResponse == nil {
+		return ""
+	}
+	if u, err := url.Parse(m.lastResponse.url); err != nil || u.Hostname() != m.dns.host {
+		return ""
+	}
+	m.timing.mu.Lock()
+	defer m.timing.mu.Unlock()
+	return m.timing.remote
+}
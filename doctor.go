@@ -0,0 +1,429 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/atotto/clipboard"
+	"github.com/muesli/termenv"
+)
+
+// doctorCheck is the outcome of one check of `lazyhttp doctor`
+type doctorCheck struct {
+	status string // "ok", "warn" or "FAIL"
+	text   string
+	fix    string // what to do about a warning or failure
+}
+
+// doctorSection groups the checks of one area
+type doctorSection struct {
+	title  string
+	checks []doctorCheck
+}
+
+func (s *doctorSection) ok(format string, args ...interface{}) {
+	s.checks = append(s.checks, doctorCheck{status: "ok", text: fmt.Sprintf(format, args...)})
+}
+
+func (s *doctorSection) warn(text, fix string) {
+	s.checks = append(s.checks, doctorCheck{status: "warn", text: text, fix: fix})
+}
+
+func (s *doctorSection) fail(text, fix string) {
+	s.checks = append(s.checks, doctorCheck{status: "FAIL", text: text, fix: fix})
+}
+
+// doctorCommand implements `lazyhttp doctor`: it checks what lazyhttp
+// depends on around it and says how to fix what's wrong. It exits with 1
+// when a check failed, and reads secrets only to see that they can be,
+// never printing them.
+func doctorCommand(args []string) int {
+	fs := flag.NewFlagSet("doctor", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: lazyhttp doctor")
+		fmt.Fprintln(fs.Output(), "\nChecks the terminal, the clipboard, proxy settings, secret stores and the files of the current workspace.")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	sections := []doctorSection{
+		doctorTerminal(),
+		doctorClipboard(),
+		doctorProxy(),
+		doctorSecrets(),
+		doctorWorkspace(),
+	}
+	return printDoctorReport(os.Stdout, sections)
+}
+
+func printDoctorReport(w io.Writer, sections []doctorSection) int {
+	warnings, failures := 0, 0
+	for i, s := range sections {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintln(w, s.title)
+		for _, c := range s.checks {
+			fmt.Fprintf(w, "  %-4s  %s\n", c.status, c.text)
+			if c.fix != "" {
+				fmt.Fprintf(w, "        fix: %s\n", c.fix)
+			}
+			switch c.status {
+			case "warn":
+				warnings++
+			case "FAIL":
+				failures++
+			}
+		}
+	}
+	fmt.Fprintf(w, "\n%d failed, %d warning(s)\n", failures, warnings)
+	if failures > 0 {
+		return 1
+	}
+	return 0
+}
+
+// doctorTerminal checks what the TUI needs from the terminal: colors, a
+// UTF-8 locale for borders and icons, and a TTY at all
+func doctorTerminal() doctorSection {
+	s := doctorSection{title: "Terminal"}
+	if info, err := os.Stdout.Stat(); err == nil && info.Mode()&os.ModeCharDevice != 0 {
+		s.ok("output is a terminal")
+	} else {
+		s.warn("output is not a terminal, so what follows describes the environment rather than a terminal",
+			"run lazyhttp doctor in the terminal you use lazyhttp in")
+	}
+
+	term := os.Getenv("TERM")
+	switch term {
+	case "":
+		s.warn("TERM is not set", "set TERM to your terminal's type, e.g. export TERM=xterm-256color")
+	case "dumb":
+		s.fail("TERM=dumb: the terminal can't draw the TUI", "run lazyhttp in a terminal emulator, or set TERM=xterm-256color")
+	}
+
+	// As the terminal would have it, even with the output piped
+	profile := termenv.NewOutput(os.Stdout, termenv.WithTTY(true)).EnvColorProfile()
+	colors := map[termenv.Profile]string{
+		termenv.TrueColor: "true color",
+		termenv.ANSI256:   "256 colors",
+		termenv.ANSI:      "16 colors",
+		termenv.Ascii:     "no colors",
+	}[profile]
+	switch {
+	case os.Getenv("NO_COLOR") != "":
+		s.warn("NO_COLOR is set, so responses aren't highlighted", "unset NO_COLOR for colors")
+	case profile == termenv.Ascii:
+		s.warn(fmt.Sprintf("the terminal has %s (TERM=%s)", colors, term), "set TERM=xterm-256color, or COLORTERM=truecolor if the terminal supports it")
+	case profile == termenv.ANSI:
+		s.warn("the terminal has 16 colors, so some highlighting merges", "set TERM=xterm-256color, or COLORTERM=truecolor if the terminal supports it")
+	default:
+		s.ok("%s (TERM=%s)", colors, term)
+	}
+
+	locale := os.Getenv("LC_ALL")
+	if locale == "" {
+		locale = os.Getenv("LC_CTYPE")
+	}
+	if locale == "" {
+		locale = os.Getenv("LANG")
+	}
+	upper := strings.ToUpper(locale)
+	if runtime.GOOS != "windows" && !strings.Contains(upper, "UTF-8") && !strings.Contains(upper, "UTF8") {
+		s.warn(fmt.Sprintf("the locale %q isn't UTF-8, so borders and icons may show as garbage", locale), "export LANG=en_US.UTF-8, or another UTF-8 locale")
+	} else if runtime.GOOS != "windows" {
+		s.ok("UTF-8 locale (%s)", locale)
+	}
+	return s
+}
+
+// doctorClipboard checks how copying (Ctrl+Y) reaches the clipboard: a
+// system tool, or the terminal through OSC 52
+func doctorClipboard() doctorSection {
+	s := doctorSection{title: "Clipboard"}
+	if !clipboard.Unsupported {
+		s.ok("copying uses the system clipboard")
+		return s
+	}
+	switch {
+	case os.Getenv("WAYLAND_DISPLAY") != "":
+		s.warn("no clipboard tool found, copying falls back to OSC 52", "install wl-clipboard for wl-copy")
+	case os.Getenv("DISPLAY") != "":
+		s.warn("no clipboard tool found, copying falls back to OSC 52", "install xclip or xsel")
+	default:
+		s.ok("no display, copying asks the terminal through OSC 52, which works over SSH in most terminals")
+	}
+	if os.Getenv("TMUX") != "" {
+		out, err := exec.Command("tmux", "show-options", "-gv", "set-clipboard").Output()
+		if setting := strings.TrimSpace(string(out)); err == nil && setting == "off" {
+			s.warn("tmux has set-clipboard off, so it drops OSC 52", "add set -g set-clipboard on to ~/.tmux.conf")
+		} else if err == nil {
+			s.ok("tmux passes OSC 52 on (set-clipboard %s)", setting)
+		}
+	}
+	return s
+}
+
+// doctorProxy checks the proxy settings of the environment and of the
+// active lazyhttp environment
+func doctorProxy() doctorSection {
+	s := doctorSection{title: "Proxy"}
+	set := false
+	for _, name := range []string{"HTTPS_PROXY", "https_proxy", "HTTP_PROXY", "http_proxy"} {
+		value := os.Getenv(name)
+		if value == "" {
+			continue
+		}
+		set = true
+		u, err := parseProxyURL(value)
+		if err != nil {
+			s.fail(fmt.Sprintf("%s: %v", name, err), "fix or unset "+name)
+			continue
+		}
+		s.ok("%s=%s", name, u.Redacted())
+	}
+	for _, name := range []string{"ALL_PROXY", "all_proxy"} {
+		if value := os.Getenv(name); value != "" {
+			set = true
+			s.warn(name+" is set but not used: Go reads HTTPS_PROXY and HTTP_PROXY only",
+				"export HTTPS_PROXY="+value+" HTTP_PROXY="+value+", or pass -proxy "+value)
+		}
+	}
+	if v := noProxy(); v != "" {
+		s.ok("NO_PROXY=%s", v)
+	}
+	if !set {
+		s.ok("no proxy in the environment, requests go direct")
+	}
+
+	if err := loadEnvironments(); err != nil {
+		return s
+	}
+	if setting := environmentProxy(); setting != "" {
+		if described, err := describeProxySetting(setting); err != nil {
+			s.fail(fmt.Sprintf("the proxy of environment %s: %v", activeEnvironment, err), "fix its proxy in "+environmentsFile)
+		} else {
+			s.ok("environment %s uses %s", activeEnvironment, described)
+		}
+	}
+	return s
+}
+
+// doctorSecrets checks that the secrets the environments refer to can be
+// read: the variables of env: references, the keychain tool and Vault
+func doctorSecrets() doctorSection {
+	s := doctorSection{title: "Secrets"}
+	if err := loadEnvironments(); err != nil {
+		s.fail("can't read the environments: "+err.Error(), "fix "+environmentsFile+" or "+localEnvironmentsFile)
+		return s
+	}
+	refs := map[string][]string{} // by provider, "env/variable" of each
+	for _, env := range environments {
+		for _, name := range sortedKeys(env.Secrets) {
+			kind, _, _ := strings.Cut(env.Secrets[name], ":")
+			refs[kind] = append(refs[kind], env.Name+"/"+name)
+		}
+	}
+	if len(refs) == 0 {
+		s.ok("the environments refer to no secrets")
+		return s
+	}
+
+	for _, env := range environments {
+		for _, name := range sortedKeys(env.Secrets) {
+			ref := env.Secrets[name]
+			kind, rest, _ := strings.Cut(ref, ":")
+			where := fmt.Sprintf("%s of environment %s (%s)", name, env.Name, ref)
+			switch kind {
+			case "env":
+				if _, ok := os.LookupEnv(rest); !ok {
+					s.warn(where+": "+rest+" is not set", "export "+rest+" before starting lazyhttp")
+				} else {
+					s.ok("%s", where)
+				}
+			case "keychain":
+				if _, err := readSecret(ref); err != nil {
+					s.fail(where+": "+err.Error(), keychainFix())
+				} else {
+					s.ok("%s", where)
+				}
+			case "vault":
+				// Vault is checked once below rather than for every secret
+			default:
+				s.fail(where+": unknown secret source", "use env:, keychain: or vault:")
+			}
+		}
+	}
+	if vault := refs["vault"]; len(vault) > 0 {
+		switch _, err := vaultToken(); {
+		case os.Getenv("VAULT_ADDR") == "":
+			s.fail(fmt.Sprintf("%d secret(s) are in Vault, but VAULT_ADDR is not set", len(vault)), "export VAULT_ADDR=https://vault.example.com:8200")
+		case err != nil:
+			s.fail(err.Error(), "run vault login, or export VAULT_TOKEN")
+		default:
+			s.ok("Vault at %s, with a token, for %d secret(s)", os.Getenv("VAULT_ADDR"), len(vault))
+		}
+	}
+	return s
+}
+
+// keychainFix says how to make the keychain readable on this system
+func keychainFix() string {
+	switch runtime.GOOS {
+	case "darwin":
+		return "add the item with security add-generic-password -s SERVICE -a ACCOUNT -w, and allow lazyhttp when asked"
+	case "windows":
+		return "use env: references on Windows"
+	}
+	if _, err := exec.LookPath("secret-tool"); err != nil {
+		return "install secret-tool (libsecret-tools), and run a Secret Service like GNOME Keyring"
+	}
+	if os.Getenv("DBUS_SESSION_BUS_ADDRESS") == "" {
+		return "secret-tool needs a D-Bus session, unlock the keyring from a desktop session or start one with dbus-run-session"
+	}
+	return "store the item with secret-tool store --label=NAME service SERVICE account ACCOUNT"
+}
+
+// doctorWorkspace checks that the files of the current workspace parse and
+// hang together, and that the state directory can be written
+func doctorWorkspace() doctorSection {
+	s := doctorSection{title: "Workspace " + currentWorkspace}
+	dir := workspaceDir()
+	if _, err := os.Stat(dir); errors.Is(err, os.ErrNotExist) {
+		s.ok("%s doesn't exist yet, it is created on the first save", dir)
+		return s
+	}
+	s.ok("files in %s", dir)
+	if isRemoteWorkspace(currentWorkspace) {
+		s.ok("remote workspace, read-only")
+	}
+
+	if state, err := workspaceFile(".doctor"); err != nil {
+		s.fail("the state directory can't be created: "+err.Error(), "check the permissions of "+workspaceStateDir())
+	} else if err := os.WriteFile(state, nil, 0o600); err != nil {
+		s.fail("the state directory can't be written: "+err.Error(), "check the permissions of "+workspaceStateDir())
+	} else {
+		os.Remove(state)
+	}
+
+	// Environments
+	for _, path := range []string{filepath.Join(dir, environmentsFile), filepath.Join(workspaceStateDir(), localEnvironmentsFile)} {
+		data, err := os.ReadFile(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		name := filepath.Base(path)
+		var envs []environment
+		if err == nil {
+			err = json.Unmarshal(data, &envs)
+		}
+		if err != nil {
+			s.fail(name+": "+err.Error(), "fix the JSON of "+path)
+			continue
+		}
+		s.ok("%s: %d environment(s)", name, len(envs))
+		if info, err := os.Stat(path); err == nil && name == localEnvironmentsFile && info.Mode().Perm()&0o077 != 0 {
+			s.warn(name+" is readable by other users, and is meant for secrets", "chmod 600 "+path)
+		}
+	}
+	if err := loadEnvironments(); err == nil {
+		data, err := os.ReadFile(filepath.Join(workspaceStateDir(), currentEnvironmentFile))
+		if name := strings.TrimSpace(string(data)); err == nil && name != "" && findEnvironment(name) == nil {
+			s.warn("the current environment "+name+" no longer exists", "pick another with Ctrl+E")
+		}
+	}
+
+	// Collections, each on its own so one broken file doesn't hide others
+	var paths []string
+	for _, pattern := range []string{"*.json", "*.http", "*.rest"} {
+		matches, _ := filepath.Glob(filepath.Join(dir, collectionsDir, pattern))
+		paths = append(paths, matches...)
+	}
+	loaded, requests := 0, 0
+	for _, path := range paths {
+		c, err := loadCollection(path)
+		if err != nil {
+			s.fail(err.Error(), "fix the file, lazyhttp leaves it out of the sidebar until then")
+			continue
+		}
+		loaded++
+		requests += len(c.Requests)
+		if err := c.validateDependencies(); err != nil {
+			s.fail(fmt.Sprintf("%s: %v", filepath.Base(path), err), "fix the depends_on of the requests in "+path)
+		}
+		seen := map[string]bool{}
+		for _, r := range c.Requests {
+			key := requestKey(r.Folder, r.Name)
+			if seen[key] {
+				s.warn(fmt.Sprintf("%s: %q is there twice, saving replaces only the first", filepath.Base(path), itemPath(r)), "rename one of them")
+			}
+			seen[key] = true
+			if r.BodyFile != "" {
+				body := r.BodyFile
+				if !filepath.IsAbs(body) {
+					body = filepath.Join(filepath.Dir(path), body)
+				}
+				if _, err := os.Stat(body); err != nil && !strings.Contains(r.BodyFile, "{{") {
+					s.warn(fmt.Sprintf("%s: the body_file of %q: %v", filepath.Base(path), itemPath(r), err), "fix its body_file")
+				}
+			}
+		}
+	}
+	s.ok("%d collection file(s), %d request(s)", loaded, requests)
+
+	if _, err := loadWorkspaceDefaults(); err != nil {
+		s.fail(err.Error(), "fix the JSON of "+filepath.Join(dir, defaultsFile))
+	}
+	if pins, err := loadWorkspacePins(); err != nil {
+		s.fail(err.Error(), "fix the JSON of "+filepath.Join(dir, pinsFile))
+	} else {
+		for _, host := range sortedKeys(pins) {
+			for _, pin := range pins[host] {
+				if _, err := parsePin(pin); err != nil {
+					s.fail(fmt.Sprintf("%s: pin of %s: %v", pinsFile, host, err), "fix the pin, the host can't be reached while it is wrong")
+				}
+			}
+		}
+	}
+
+	// Logs kept one JSON object per line skip lines that don't parse, so a
+	// damaged one only loses what it says
+	logs, _ := filepath.Glob(filepath.Join(workspaceStateDir(), "*.jsonl"))
+	sort.Strings(logs)
+	for _, path := range logs {
+		if bad, err := countBadJSONLines(path); err != nil {
+			s.fail(filepath.Base(path)+": "+err.Error(), "check the permissions of "+path)
+		} else if bad > 0 {
+			s.warn(fmt.Sprintf("%s: %d line(s) don't parse and are skipped", filepath.Base(path), bad), "nothing to do unless the file matters to you, lazyhttp keeps working")
+		}
+	}
+	return s
+}
+
+// countBadJSONLines counts the lines of a JSON Lines file that aren't JSON
+func countBadJSONLines(path string) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	bad := 0
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 4<<20)
+	for scanner.Scan() {
+		if line := scanner.Bytes(); len(line) > 0 && !json.Valid(line) {
+			bad++
+		}
+	}
+	return bad, scanner.Err()
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/progress"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// downloadState tracks an in-flight download to disk
+type downloadState struct {
+	url      string
+	path     string
+	received int64
+	total    int64
+	started  time.Time
+	bar      progress.Model
+}
+
+// downloadProgressMsg reports bytes written so far
+type downloadProgressMsg struct {
+	stream   <-chan tea.Msg
+	path     string
+	received int64
+	total    int64
+}
+
+// downloadDoneMsg ends a download. On cancellation the partial file is kept
+// next to the destination with a .part suffix.
+type downloadDoneMsg struct {
+	path    string
+	size    int64
+	elapsed time.Duration
+	partial bool
+	err     error
+}
+
+// downloadDir is where downloads land: $XDG_DOWNLOAD_DIR, ~/Downloads or
+// the working directory, whichever exists first
+func downloadDir() string {
+	if dir := os.Getenv("XDG_DOWNLOAD_DIR"); dir != "" {
+		return dir
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		dir := filepath.Join(home, "Downloads")
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			return dir
+		}
+	}
+	return "."
+}
+
+// downloadFileName picks a file name from Content-Disposition or the URL
+func downloadFileName(resp *http.Response) string {
+	if _, params, err := mime.ParseMediaType(resp.Header.Get("Content-Disposition")); err == nil {
+		if name := filepath.Base(params["filename"]); name != "." && name != "/" && name != "" {
+			return name
+		}
+	}
+	if name := path.Base(resp.Request.URL.Path); name != "." && name != "/" && name != "" {
+		if unescaped, err := url.PathUnescape(name); err == nil {
+			return filepath.Base(unescaped)
+		}
+		return name
+	}
+	return "download"
+}
+
+// uniquePath appends " (n)" before the extension until the name is free
+func uniquePath(dir, name string) string {
+	candidate := filepath.Join(dir, name)
+	ext := filepath.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+	for i := 1; ; i++ {
+		if _, err := os.Stat(candidate); errors.Is(err, os.ErrNotExist) {
+			if _, err := os.Stat(candidate + ".part"); errors.Is(err, os.ErrNotExist) {
+				return candidate
+			}
+		}
+		candidate = filepath.Join(dir, fmt.Sprintf("%s (%d)%s", stem, i, ext))
+	}
+}
+
+func downloadURL(ctx context.Context, url string) tea.Cmd {
+	stream := make(chan tea.Msg)
+	go streamDownload(ctx, url, stream)
+	return waitForFetch(stream)
+}
+
+// streamDownload writes the response body straight to disk, reporting
+// progress along the way
+func streamDownload(ctx context.Context, url string, stream chan tea.Msg) {
+	start := time.Now()
+	fail := func(err error) {
+		stream <- downloadDoneMsg{err: err, elapsed: time.Since(start)}
+	}
+
+	target, resolve, err := unixSocketRequest(url, defaultResolve)
+	if err != nil {
+		fail(err)
+		return
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", target, nil)
+	if err != nil {
+		fail(err)
+		return
+	}
+	req.Header.Set("User-Agent", defaultUserAgent)
+
+	resp, err := newHTTPClient(defaultTimeouts, defaultHTTPVersion, resolve, environmentProxy()).Do(req)
+	if err != nil {
+		fail(describeTimeout(err, defaultTimeouts))
+		return
+	}
+	resp.Body = withIdleTimeout(resp.Body, defaultTimeouts.idle())
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		fail(fmt.Errorf("server responded %s", resp.Status))
+		return
+	}
+
+	dest := uniquePath(downloadDir(), downloadFileName(resp))
+	file, err := os.Create(dest + ".part")
+	if err != nil {
+		fail(err)
+		return
+	}
+
+	var written int64
+	lastSent := time.Time{}
+	buf := make([]byte, 64*1024)
+	for {
+		n, readErr := resp.Body.Read(buf)
+		if n > 0 {
+			if _, err := file.Write(buf[:n]); err != nil {
+				file.Close()
+				fail(err)
+				return
+			}
+			written += int64(n)
+		}
+		if time.Since(lastSent) >= progressInterval {
+			stream <- downloadProgressMsg{stream: stream, path: dest, received: written, total: resp.ContentLength}
+			lastSent = time.Now()
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			file.Close()
+			stream <- downloadDoneMsg{path: dest + ".part", size: written, elapsed: time.Since(start),
+				partial: ctx.Err() != nil, err: readErr}
+			return
+		}
+	}
+
+	if err := file.Close(); err != nil {
+		fail(err)
+		return
+	}
+	if err := os.Rename(dest+".part", dest); err != nil {
+		fail(err)
+		return
+	}
+	stream <- downloadDoneMsg{path: dest, size: written, elapsed: time.Since(start)}
+}
+
+// startDownload begins downloading rawURL to disk instead of the viewport
+func (m model) startDownload(rawURL string) (model, tea.Cmd) {
+	url := rawURL
+	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+		url = "https://" + url
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	m.fetching = true
+	m.cancel = cancel
+	m.err = nil
+	m.suggestions = nil
+	m.download = &downloadState{
+		url:     url,
+		total:   -1,
+		started: time.Now(),
+		bar:     progress.New(progress.WithDefaultGradient()),
+	}
+	m.response = "Starting download..."
+	m.viewport.SetContent(m.response)
+	return m, downloadURL(ctx, url)
+}
+
+// bytesPerSecond is the average transfer rate since start
+func bytesPerSecond(n int64, elapsed time.Duration) float64 {
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(n) / elapsed.Seconds()
+}
+
+// renderDownload draws the progress panel of an in-flight download
+func renderDownload(d *downloadState, width int) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s %s\n", headerStyle.Render("Downloading:"), d.url)
+	if d.path != "" {
+		fmt.Fprintf(&sb, "%s %s\n", headerStyle.Render("Saving to:"), d.path)
+	}
+	sb.WriteString("\n")
+
+	rate := bytesPerSecond(d.received, time.Since(d.started))
+	stats := formatBytes(d.received)
+	if d.total > 0 {
+		d.bar.Width = width
+		sb.WriteString(d.bar.ViewAs(float64(d.received) / float64(d.total)))
+		sb.WriteString("\n\n")
+		stats += " of " + formatBytes(d.total)
+	}
+	stats += fmt.Sprintf(" • %s/s", formatBytes(int64(rate)))
+	if d.total > 0 && rate > 0 {
+		eta := time.Duration(float64(d.total-d.received)/rate) * time.Second
+		stats += fmt.Sprintf(" • ETA %s", eta.Round(time.Second))
+	}
+	sb.WriteString(lipgloss.NewStyle().Foreground(lipgloss.Color("#FFCC00")).Render(stats))
+	return sb.String()
+}
+
+// renderDownloadDone summarizes a finished or aborted download
+func renderDownloadDone(msg downloadDoneMsg) string {
+	var sb strings.Builder
+	switch {
+	case msg.partial:
+		fmt.Fprintf(&sb, "%s %s\n", headerStyle.Render("Cancelled:"),
+			lipgloss.NewStyle().Foreground(lipgloss.Color("#FFCC00")).
+				Render(fmt.Sprintf("partial file kept at %s", msg.path)))
+	case msg.err != nil:
+		sb.WriteString(errorStyle.Render(fmt.Sprintf("Download failed: %v", msg.err)))
+		sb.WriteString("\n")
+		if msg.path != "" {
+			fmt.Fprintf(&sb, "%s %s\n", headerStyle.Render("Partial file:"), msg.path)
+		}
+	default:
+		fmt.Fprintf(&sb, "%s %s\n", headerStyle.Render("Saved to:"), msg.path)
+	}
+	fmt.Fprintf(&sb, "%s %s in %s (%s/s)\n", headerStyle.Render("Size:"),
+		formatBytes(msg.size), msg.elapsed.Round(time.Millisecond),
+		formatBytes(int64(bytesPerSecond(msg.size, msg.elapsed))))
+	return sb.String()
+}
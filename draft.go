@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// The draft is the request being edited beyond what the input line can
+// hold: the headers, body and settings of a saved request that was run or
+// a curl command that was imported. The input line still decides the
+// method, URL and body file, so they can be edited before sending. The
+// draft is dropped once the line is cleared or replaced from history.
+
+// withLine returns r with the method, URL and body file of a request line
+func (r savedRequest) withLine(line string) savedRequest {
+	method, url, bodyFile := parseRequestLine(line)
+	r.Method, r.URL, r.BodyFile = method, url, bodyFile
+	return r
+}
+
+// requestLine is the input line showing r
+func (r savedRequest) requestLine() string {
+	line := r.method() + " " + r.URL
+	if r.BodyFile != "" {
+		line += " @" + r.BodyFile
+	}
+	return line
+}
+
+// resolveInput resolves the input line along with the draft, if any
+func (m model) resolveInput(line string) resolvedRequest {
+	if m.draft == nil {
+		return resolveRequestLine(line, m.templateContext())
+	}
+	return resolveSavedRequest(m.draft.withLine(line), m.templateContext())
+}
+
+// draftSummary lists what the draft adds to the input line, for the status
+// bar
+func (m model) draftSummary() string {
+	if m.draft == nil {
+		return ""
+	}
+	var parts []string
+	if n := len(m.draft.Headers); n == 1 {
+		parts = append(parts, "1 header")
+	} else if n > 1 {
+		parts = append(parts, fmt.Sprintf("%d headers", n))
+	}
+	if m.draft.Auth != nil {
+		parts = append(parts, m.draft.Auth.describe())
+	}
+	if m.draft.Body != "" {
+		parts = append(parts, fmt.Sprintf("%d B body", len(m.draft.Body)))
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/x/ansi"
+)
+
+// Editors send the request under the cursor of a .http file to a running
+// lazyhttp, `lazyhttp serve` or the TUI started with -listen, and get the
+// response back formatted as the TUI shows it:
+//
+//	POST /api/send
+//	{"file": "/abs/path/api.http", "line": 12, "text": "<unsaved buffer>"}
+//
+// The TUI also shows the request and its response, becoming the response
+// viewer of the editor.
+
+// defaultEditorWidth is the width responses are formatted to for editors
+// that don't give theirs
+const defaultEditorWidth = 100
+
+// editorCall is the body of POST /api/send
+type editorCall struct {
+	File  string  `json:"file"`
+	Line  int     `json:"line"`           // 1-based, the cursor's
+	Text  *string `json:"text,omitempty"` // the buffer, when it differs from the file
+	Env   string  `json:"env,omitempty"`  // environment, `lazyhttp serve` only
+	Width int     `json:"width,omitempty"`
+}
+
+// editorResult is the answer to POST /api/send, also given as bare text
+// with ?format=text
+type editorResult struct {
+	Name      string      `json:"name"`
+	Method    string      `json:"method"`
+	URL       string      `json:"url"`
+	Status    int         `json:"status,omitempty"`
+	Proto     string      `json:"proto,omitempty"`
+	Headers   http.Header `json:"headers,omitempty"`
+	LatencyMs int64       `json:"latency_ms"`
+	Error     string      `json:"error,omitempty"`
+
+	// Text is the response as the TUI shows it, without colors
+	Text string `json:"text"`
+}
+
+// request finds the request under the cursor: the one whose block, from
+// its ### separator to the next, holds the line
+func (c editorCall) request() (savedRequest, error) {
+	if c.File == "" {
+		return savedRequest{}, errors.New("no file given")
+	}
+	var data []byte
+	if c.Text != nil {
+		data = []byte(*c.Text)
+	} else {
+		var err error
+		if data, err = os.ReadFile(c.File); err != nil {
+			return savedRequest{}, err
+		}
+	}
+	result, err := parseHTTPText(c.File, data)
+	if err != nil {
+		return savedRequest{}, fmt.Errorf("%s: %w", c.File, err)
+	}
+	col := result.collection
+	found := -1
+	for i, r := range col.Requests {
+		if r.line <= c.Line {
+			found = i
+		}
+	}
+	if found < 0 {
+		return savedRequest{}, fmt.Errorf("no request at line %d of %s", c.Line, c.File)
+	}
+	r := col.Requests[found]
+	r.inherited = variableLayer{source: "file " + col.Name, vars: col.Variables}
+	return r, nil
+}
+
+func (c editorCall) width() int {
+	if c.Width > 0 {
+		return c.Width
+	}
+	return defaultEditorWidth
+}
+
+// newEditorResult describes a response for an editor; text is its
+// rendering, which still has colors
+func newEditorResult(r resolvedRequest, name string, msg fetchMsg, text string) editorResult {
+	result := editorResult{Name: name, Method: r.method, URL: r.display, Text: ansi.Strip(text)}
+	if msg.timing != nil && !msg.timing.end.IsZero() {
+		result.LatencyMs = msg.timing.end.Sub(msg.timing.start).Milliseconds()
+	}
+	if msg.err != nil {
+		result.Error = msg.err.Error()
+		result.Text = "Error: " + result.Error
+		return result
+	}
+	result.Status, result.Proto, result.Headers = msg.statusCode, msg.proto, msg.header
+	return result
+}
+
+// handleEditorCall serves POST /api/send with send, which answers with the
+// response or an error status
+func handleEditorCall(w http.ResponseWriter, r *http.Request, send func(context.Context, editorCall, savedRequest) (editorResult, int, error)) {
+	var call editorCall
+	if err := json.NewDecoder(r.Body).Decode(&call); err != nil {
+		writeAPIError(w, http.StatusBadRequest, fmt.Errorf("reading the body: %w", err))
+		return
+	}
+	req, err := call.request()
+	if err != nil {
+		writeAPIError(w, http.StatusNotFound, err)
+		return
+	}
+	result, status, err := send(r.Context(), call, req)
+	if err != nil {
+		writeAPIError(w, status, err)
+		return
+	}
+	if r.URL.Query().Get("format") == "text" {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		io.WriteString(w, result.Text)
+		return
+	}
+	writeAPIResult(w, http.StatusOK, result)
+}
+
+// fetchNow sends a request outside the TUI and waits for the whole
+// response
+func fetchNow(ctx context.Context, r resolvedRequest) fetchMsg {
+	stream := make(chan tea.Msg)
+	go streamFetch(ctx, r, stream)
+	for msg := range stream {
+		if done, ok := msg.(fetchMsg); ok {
+			return done
+		}
+	}
+	return fetchMsg{}
+}
+
+// handleSend sends the request under an editor's cursor for `lazyhttp
+// serve`, keeping what it extracts for the next ones as the TUI does
+func (d *daemon) handleSend(w http.ResponseWriter, r *http.Request) {
+	handleEditorCall(w, r, func(ctx context.Context, call editorCall, req savedRequest) (editorResult, int, error) {
+		d.runMu.Lock()
+		defer d.runMu.Unlock()
+		if err := loadEnvironments(); err != nil {
+			return editorResult{}, http.StatusInternalServerError, err
+		}
+		activeEnvironment = d.env
+		if call.Env != "" {
+			if findEnvironment(call.Env) == nil {
+				return editorResult{}, http.StatusBadRequest, fmt.Errorf("no environment %q", call.Env)
+			}
+			activeEnvironment = call.Env
+		}
+
+		resolved := resolveSavedRequest(req, variableContext())
+		if len(resolved.missing) > 0 {
+			return editorResult{}, http.StatusUnprocessableEntity, fmt.Errorf("unresolved {{%s}}: %v", resolved.missing[0].name, resolved.missing[0].err)
+		}
+		started := time.Now()
+		msg := fetchNow(ctx, resolved)
+		msg.err = maskSecrets(msg.err, resolved.url, resolved.display)
+		entry := historyEntry{Method: resolved.method, URL: resolved.display, Line: req.requestLine(), Status: msg.statusCode, Time: started}
+		if msg.err != nil {
+			entry.Error, entry.Status = msg.err.Error(), 0
+		} else if len(req.Extract) > 0 && !msg.partial {
+			extractVariables(req.Extract, &msg)
+		}
+		if err := appendHistory(entry); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: saving history: %v\n", err)
+		}
+
+		text := ""
+		if msg.err == nil {
+			rules, _ := loadDisplayRules()
+			effects := applyDisplayRules(rules, msg, msg.url)
+			text = renderDisplayLabels(effects) + renderResponse(msg, call.width(), effects)
+		}
+		return newEditorResult(resolved, req.Name, msg, text), 0, nil
+	})
+}
+
+// editorSendMsg carries a request from an editor into the TUI, which
+// answers on reply once the response is in
+type editorSendMsg struct {
+	call    editorCall
+	request savedRequest
+	reply   chan editorReply
+}
+
+// editorReply is the response for an editor, or why the TUI didn't send
+// the request
+type editorReply struct {
+	result editorResult
+	err    error
+}
+
+// listenForEditors serves POST /api/send for the TUI on a loopback
+// address, handing the requests to the program
+func listenForEditors(addr string, p *tea.Program) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return errors.New("-listen only accepts loopback addresses, use `lazyhttp serve -token` beyond")
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/send", func(w http.ResponseWriter, r *http.Request) {
+		handleEditorCall(w, r, func(ctx context.Context, call editorCall, req savedRequest) (editorResult, int, error) {
+			reply := make(chan editorReply, 1)
+			p.Send(editorSendMsg{call: call, request: req, reply: reply})
+			select {
+			case r := <-reply:
+				return r.result, http.StatusConflict, r.err
+			case <-ctx.Done():
+				return editorResult{}, 0, ctx.Err()
+			}
+		})
+	})
+	go http.Serve(ln, authorizeAPI("", host, mux))
+	return nil
+}
+
+// sendFromEditor sends an editor's request as if run from the sidebar and
+// keeps the reply for when the response is in
+func (m model) sendFromEditor(msg editorSendMsg) (tea.Model, tea.Cmd) {
+	if m.fetching {
+		msg.reply <- editorReply{err: errors.New("lazyhttp is busy with another request")}
+		return m, nil
+	}
+	if m.editorReply != nil {
+		m.editorReply <- editorReply{err: errors.New("replaced by a newer request from the editor")}
+	}
+	m.editorReply, m.editorWidth = msg.reply, msg.call.width()
+	return m.runSaved(msg.request)
+}
+
+// replyToEditor answers the editor waiting for the response just shown,
+// to the request sent recorded
+func (m model) replyToEditor(msg fetchMsg, sent *historyEntry) model {
+	if m.editorReply == nil || sent == nil {
+		return m
+	}
+	r := resolvedRequest{method: sent.Method, display: sent.URL}
+	name := ""
+	if m.draft != nil {
+		name = m.draft.Name
+	}
+	text := ""
+	if msg.err == nil {
+		text = renderDisplayLabels(m.display) + renderResponse(msg, m.editorWidth, m.display)
+	}
+	m.editorReply <- editorReply{result: newEditorResult(r, name, msg, text)}
+	m.editorReply = nil
+	return m
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"mime"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"golang.org/x/net/html/charset"
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+// acceptEncoding is advertised on every request. Setting it ourselves stops
+// net/http from transparently gunzipping, so the wire size stays known.
+const acceptEncoding = "gzip, deflate, br"
+
+// countingReader counts the bytes read from the wire and remembers the
+// transport error, so it can be told apart from decompression errors
+type countingReader struct {
+	r   io.Reader
+	n   int64
+	err error
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	if err != nil && err != io.EOF {
+		c.err = err
+	}
+	return n, err
+}
+
+// newDecodingReader undoes the codings listed in a Content-Encoding header
+// (applied in order, so removed in reverse) while the body streams in
+func newDecodingReader(r io.Reader, header string) (io.Reader, error) {
+	var codings []string
+	for _, c := range strings.Split(header, ",") {
+		if c = strings.ToLower(strings.TrimSpace(c)); c != "" && c != "identity" {
+			codings = append(codings, c)
+		}
+	}
+
+	for i := len(codings) - 1; i >= 0; i-- {
+		switch codings[i] {
+		case "gzip", "x-gzip":
+			gz, err := gzip.NewReader(r)
+			if err != nil {
+				return nil, fmt.Errorf("gzip: %w", err)
+			}
+			r = gz
+		case "deflate":
+			// "deflate" is meant to be zlib-wrapped, but plenty of servers
+			// send a raw deflate stream instead
+			br := bufio.NewReader(r)
+			if head, err := br.Peek(2); err == nil && head[0]&0x0f == 8 && (uint16(head[0])<<8|uint16(head[1]))%31 == 0 {
+				zr, err := zlib.NewReader(br)
+				if err != nil {
+					return nil, fmt.Errorf("deflate: %w", err)
+				}
+				r = zr
+			} else {
+				r = flate.NewReader(br)
+			}
+		case "br":
+			r = brotli.NewReader(r)
+		default:
+			return nil, fmt.Errorf("unsupported content encoding %q", codings[i])
+		}
+	}
+	return r, nil
+}
+
+// transcodeToUTF8 converts a text body to UTF-8 according to the charset
+// parameter of its Content-Type, or for HTML its BOM or <meta> declaration.
+// It returns the source charset name when a conversion happened.
+func transcodeToUTF8(body []byte, contentType string) ([]byte, string, error) {
+	mediaType, params, _ := mime.ParseMediaType(contentType)
+	label := strings.TrimSpace(params["charset"])
+
+	if label == "" {
+		if mediaType != "text/html" {
+			return body, "", nil
+		}
+		// Without a BOM the guess is only meaningful when the document
+		// actually declares a charset in a <meta> tag
+		_, name, certain := charset.DetermineEncoding(body, contentType)
+		head := body
+		if len(head) > 1024 {
+			head = head[:1024]
+		}
+		if !certain && !bytes.Contains(bytes.ToLower(head), []byte("charset")) {
+			return body, "", nil
+		}
+		label = name
+	}
+
+	enc, err := htmlindex.Get(label)
+	if err != nil {
+		return body, "", fmt.Errorf("unknown charset %q", label)
+	}
+	name, _ := htmlindex.Name(enc)
+	if name == "utf-8" {
+		return body, "", nil
+	}
+
+	decoded, err := enc.NewDecoder().Bytes(body)
+	if err != nil {
+		return body, "", fmt.Errorf("%s: %w", name, err)
+	}
+	return decoded, name, nil
+}
@@ -0,0 +1,352 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// environmentHistoryFile records every change seen to the variables of
+	// the workspace's environments, one JSON object per line, kept in the
+	// state directory so it never travels with the workspace
+	environmentHistoryFile = "environment-history.jsonl"
+
+	// environmentSnapshotFile holds the environments as last seen, by file,
+	// to tell what changed since
+	environmentSnapshotFile = "environment-snapshot.json"
+)
+
+// environmentHistoryLimit is the number of changes kept
+const environmentHistoryLimit = 1000
+
+// envChange is a variable of an environment being added, changed or
+// removed, in environmentsFile or localEnvironmentsFile
+type envChange struct {
+	Time        time.Time `json:"time"`
+	User        string    `json:"user"`
+	File        string    `json:"file"`
+	Environment string    `json:"environment"`
+	Variable    string    `json:"variable"`
+	Secret      bool      `json:"secret,omitempty"` // a secret reference rather than a value
+	Old         *string   `json:"old,omitempty"`    // nil when added
+	New         *string   `json:"new,omitempty"`    // nil when removed
+
+	// Via is how the change came about: "edit" when the file was found
+	// changed on load, "import" or "revert"
+	Via string `json:"via"`
+}
+
+// localUser names who made the changes seen by this process
+func localUser() string {
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
+
+// environmentFilePath is where an environments file of the workspace is
+func environmentFilePath(file string) string {
+	if file == localEnvironmentsFile {
+		return filepath.Join(workspaceStateDir(), file)
+	}
+	return filepath.Join(workspaceDir(), file)
+}
+
+// trackEnvironmentFile records how the environments in file differ from
+// when it was last seen. The first time a workspace is seen only its
+// environments are noted. Nothing is recorded in incognito sessions.
+func trackEnvironmentFile(file string, envs []environment, via string) error {
+	if incognito {
+		return nil
+	}
+	path, err := workspaceFile(environmentSnapshotFile)
+	if err != nil {
+		return err
+	}
+	snapshot := map[string][]environment{}
+	data, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return err
+	default:
+		if err := json.Unmarshal(data, &snapshot); err != nil {
+			return fmt.Errorf("%s: %w", environmentSnapshotFile, err)
+		}
+	}
+
+	old, known := snapshot[file]
+	if known {
+		changes := diffEnvironments(old, envs)
+		now, who := time.Now(), localUser()
+		for i := range changes {
+			changes[i].Time, changes[i].User, changes[i].File, changes[i].Via = now, who, file, via
+		}
+		if err := appendEnvironmentHistory(changes); err != nil {
+			return err
+		}
+		if len(changes) == 0 {
+			return nil
+		}
+	}
+	snapshot[file] = envs
+	out, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, out, 0o600)
+}
+
+// diffEnvironments lists the variables and secret references added,
+// changed or removed between old and new
+func diffEnvironments(old, new []environment) []envChange {
+	byName := func(envs []environment) map[string]environment {
+		m := make(map[string]environment, len(envs))
+		for _, env := range envs {
+			m[env.Name] = env
+		}
+		return m
+	}
+	before, after := byName(old), byName(new)
+	var names []string
+	for _, env := range new {
+		names = append(names, env.Name)
+	}
+	for _, env := range old {
+		if _, ok := after[env.Name]; !ok {
+			names = append(names, env.Name)
+		}
+	}
+
+	var changes []envChange
+	diff := func(env string, a, b map[string]string, secret bool) {
+		seen := map[string]bool{}
+		for _, name := range append(sortedKeys(b), sortedKeys(a)...) {
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+			oldValue, hadOld := a[name]
+			newValue, hasNew := b[name]
+			if hadOld == hasNew && oldValue == newValue {
+				continue
+			}
+			c := envChange{Environment: env, Variable: name, Secret: secret}
+			if hadOld {
+				c.Old = &oldValue
+			}
+			if hasNew {
+				c.New = &newValue
+			}
+			changes = append(changes, c)
+		}
+	}
+	for _, name := range names {
+		diff(name, before[name].Variables, after[name].Variables, false)
+		diff(name, before[name].Secrets, after[name].Secrets, true)
+	}
+	return changes
+}
+
+// appendEnvironmentHistory adds changes to the history file, dropping the
+// oldest beyond environmentHistoryLimit
+func appendEnvironmentHistory(changes []envChange) error {
+	if len(changes) == 0 {
+		return nil
+	}
+	history, err := loadEnvironmentHistory()
+	if err != nil {
+		return err
+	}
+	path, err := workspaceFile(environmentHistoryFile)
+	if err != nil {
+		return err
+	}
+	flags := os.O_APPEND | os.O_CREATE | os.O_WRONLY
+	if len(history)+len(changes) > environmentHistoryLimit {
+		changes = append(history, changes...)
+		changes = changes[len(changes)-environmentHistoryLimit:]
+		flags = os.O_TRUNC | os.O_CREATE | os.O_WRONLY
+	}
+	var buf []byte
+	for _, c := range changes {
+		data, err := json.Marshal(c)
+		if err != nil {
+			return err
+		}
+		buf = append(append(buf, data...), '\n')
+	}
+	file, err := os.OpenFile(path, flags, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(buf); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// loadEnvironmentHistory reads the changes recorded in the workspace,
+// oldest first
+func loadEnvironmentHistory() ([]envChange, error) {
+	path, err := workspaceFile(environmentHistoryFile)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var history []envChange
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+	for scanner.Scan() {
+		var c envChange
+		// Skip lines that don't parse, e.g. one cut short by a crash
+		if json.Unmarshal(scanner.Bytes(), &c) == nil {
+			history = append(history, c)
+		}
+	}
+	return history, scanner.Err()
+}
+
+// environmentChanges are the recorded changes of the named environment,
+// newest first
+func environmentChanges(name string) ([]envChange, error) {
+	history, err := loadEnvironmentHistory()
+	if err != nil {
+		return nil, err
+	}
+	var changes []envChange
+	for i := len(history) - 1; i >= 0; i-- {
+		if history[i].Environment == name {
+			changes = append(changes, history[i])
+		}
+	}
+	return changes, nil
+}
+
+// revertEnvironmentChange sets the variable of a change back to the value
+// it had before, removing it if the change added it, in the file the
+// change was made in. The revert is recorded like any other change and
+// the environments are reloaded.
+func revertEnvironmentChange(c envChange) error {
+	if c.File == environmentsFile && isRemoteWorkspace(currentWorkspace) {
+		return errors.New("the environments of a remote workspace are read-only, override the variable in " + localEnvironmentsFile)
+	}
+	path := environmentFilePath(c.File)
+	var envs []environment
+	data, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return err
+	default:
+		if err := json.Unmarshal(data, &envs); err != nil {
+			return fmt.Errorf("%s: %w", c.File, err)
+		}
+	}
+
+	i := 0
+	for i < len(envs) && envs[i].Name != c.Environment {
+		i++
+	}
+	if i == len(envs) {
+		if c.Old == nil {
+			return loadEnvironments()
+		}
+		envs = append(envs, environment{Name: c.Environment})
+	}
+	vars := &envs[i].Variables
+	if c.Secret {
+		vars = &envs[i].Secrets
+	}
+	if c.Old == nil {
+		delete(*vars, c.Variable)
+	} else {
+		if *vars == nil {
+			*vars = map[string]string{}
+		}
+		(*vars)[c.Variable] = *c.Old
+	}
+
+	out, err := json.MarshalIndent(envs, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, append(out, '\n'), 0o600); err != nil {
+		return err
+	}
+	// The revert is already written, a history that can't be isn't
+	// reported as its failure
+	trackEnvironmentFile(c.File, envs, "revert")
+	return loadEnvironments()
+}
+
+// describeEnvValue shows a value of a change, masked for variables whose
+// name suggests a secret
+func describeEnvValue(c envChange, v *string) string {
+	switch {
+	case v == nil:
+		return historyDimStyle.Render("(unset)")
+	case c.Secret:
+		return "secret from " + *v
+	case secretNamePattern.MatchString(c.Variable):
+		return maskedValue
+	case *v == "":
+		return `""`
+	}
+	return *v
+}
+
+// renderEnvironmentHistory lists the recorded changes of an environment,
+// newest first, with the selected one highlighted
+func renderEnvironmentHistory(p *environmentPicker, height int) string {
+	env := p.historyEnv
+	var sb strings.Builder
+	sb.WriteString(headerStyle.Render("History of " + env))
+	sb.WriteString("\n\n")
+	if p.historyErr != nil {
+		sb.WriteString(errorStyle.Render("Error: " + p.historyErr.Error()))
+		sb.WriteString("\n\n")
+	}
+	if len(p.history) == 0 {
+		sb.WriteString(historyDimStyle.Render("No changes recorded yet. Changes to " + environmentsFile + " and " +
+			localEnvironmentsFile + " are recorded when lazyhttp loads them, and by imports."))
+		sb.WriteString("\n")
+	}
+
+	// The title, the blank lines and the hint take 5 lines
+	rows := max(height-5, 1)
+	first := min(max(p.historyIdx-rows/2, 0), max(len(p.history)-rows, 0))
+	for i := first; i < min(first+rows, len(p.history)); i++ {
+		c := p.history[i]
+		via := map[string]string{"edit": "edited " + c.File, "import": "imported into " + c.File, "revert": "reverted in " + c.File}[c.Via]
+		line := fmt.Sprintf("%s %s %s → %s %s", c.Time.Local().Format("Jan 2 15:04"), headerStyle.Render(c.Variable),
+			describeEnvValue(c, c.Old), describeEnvValue(c, c.New), historyDimStyle.Render("("+c.User+", "+via+")"))
+		if i == p.historyIdx {
+			sb.WriteString(selectedSuggestionStyle.Render("› ") + line)
+		} else {
+			sb.WriteString("  " + line)
+		}
+		sb.WriteString("\n")
+	}
+	sb.WriteString(historyDimStyle.Render("\n↑/↓: Select • Enter: Revert to the value before • h/Esc: Back"))
+	return sb.String()
+}
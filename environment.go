@@ -0,0 +1,375 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+const (
+	// environmentsFile holds the environments of a workspace, e.g.
+	//
+	//	[{"name": "dev", "variables": {"base_url": "http://localhost:8080"}},
+	//	 {"name": "prod", "variables": {"base_url": "https://api.example.com"}}]
+	environmentsFile = "environments.json"
+
+	// localEnvironmentsFile has the same format and adds to or overrides
+	// the variables of environmentsFile. It is meant for secrets and kept
+	// out of version control in project workspaces, and in the state
+	// directory of remote ones.
+	localEnvironmentsFile = "environments.local.json"
+
+	// currentEnvironmentFile records the environment used last in a
+	// workspace
+	currentEnvironmentFile = "current-environment"
+)
+
+// environment is a named set of variables, typically one per deployment
+type environment struct {
+	Name      string            `json:"name"`
+	Variables map[string]string `json:"variables"`
+
+	// Secrets are variables read from a secret store when used instead of
+	// being kept in the file, e.g. "api_token": "env:API_TOKEN"; see
+	// readSecret. A secret takes precedence over a plain variable of the
+	// same name.
+	Secrets map[string]string `json:"secrets,omitempty"`
+
+	// Proxy sends the requests made in the environment through a proxy
+	// URL, or direct, instead of the one of -proxy; see proxy.go
+	Proxy string `json:"proxy,omitempty"`
+}
+
+// environments are those of the current workspace, in file order, and
+// activeEnvironment names the one templates resolve against, if any
+var (
+	environments      []environment
+	activeEnvironment string
+)
+
+// loadEnvironments reads the environments of the current workspace and
+// restores the one used last there
+func loadEnvironments() error {
+	environments, activeEnvironment = nil, ""
+	files := []string{
+		filepath.Join(workspaceDir(), environmentsFile),
+		filepath.Join(workspaceStateDir(), localEnvironmentsFile),
+	}
+	for _, file := range files {
+		name := filepath.Base(file)
+		data, err := os.ReadFile(file)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		var envs []environment
+		if err == nil {
+			if err := json.Unmarshal(data, &envs); err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+		}
+		// Like the request history, a change history that can't be written
+		// isn't worth failing the load for
+		trackEnvironmentFile(name, envs, "edit")
+		mergeEnvironments(envs)
+	}
+
+	if data, err := os.ReadFile(filepath.Join(workspaceStateDir(), currentEnvironmentFile)); err == nil {
+		if name := strings.TrimSpace(string(data)); findEnvironment(name) != nil {
+			activeEnvironment = name
+		}
+	}
+	return nil
+}
+
+// mergeEnvironments adds environments, merging the variables of those that
+// already exist
+func mergeEnvironments(envs []environment) {
+	for _, env := range envs {
+		existing := findEnvironment(env.Name)
+		if existing == nil {
+			environments = append(environments, env)
+			continue
+		}
+		if existing.Variables == nil {
+			existing.Variables = map[string]string{}
+		}
+		for k, v := range env.Variables {
+			existing.Variables[k] = v
+		}
+		if existing.Secrets == nil {
+			existing.Secrets = map[string]string{}
+		}
+		for k, v := range env.Secrets {
+			existing.Secrets[k] = v
+		}
+		if env.Proxy != "" {
+			existing.Proxy = env.Proxy
+		}
+	}
+}
+
+// addEnvironments writes environments into the environments file of the
+// workspace, replacing those of the same name when replace is set. It
+// returns the names of the environments left out because they exist.
+func addEnvironments(envs []environment, replace bool) ([]string, error) {
+	path := filepath.Join(workspaceDir(), environmentsFile)
+	var existing []environment
+	data, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return nil, err
+	default:
+		if err := json.Unmarshal(data, &existing); err != nil {
+			return nil, fmt.Errorf("%s: %w", environmentsFile, err)
+		}
+	}
+
+	var skipped []string
+	for _, env := range envs {
+		i := 0
+		for i < len(existing) && existing[i].Name != env.Name {
+			i++
+		}
+		switch {
+		case i == len(existing):
+			existing = append(existing, env)
+		case replace:
+			existing[i] = env
+		default:
+			skipped = append(skipped, env.Name)
+		}
+	}
+	if len(skipped) == len(envs) {
+		return skipped, nil
+	}
+	out, err := json.MarshalIndent(existing, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(workspaceDir(), 0o700); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path, append(out, '\n'), 0o600); err != nil {
+		return nil, err
+	}
+	trackEnvironmentFile(environmentsFile, existing, "import")
+	return skipped, nil
+}
+
+func findEnvironment(name string) *environment {
+	for i := range environments {
+		if environments[i].Name == name {
+			return &environments[i]
+		}
+	}
+	return nil
+}
+
+// useEnvironment activates the named environment, or none for "", and
+// remembers it for the workspace
+func useEnvironment(name string) error {
+	if name != "" && findEnvironment(name) == nil {
+		return fmt.Errorf("no environment %q in %s", name, filepath.Join(workspaceDir(), environmentsFile))
+	}
+	activeEnvironment = name
+	if incognito {
+		return nil
+	}
+	file, err := workspaceFile(currentEnvironmentFile)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(file, []byte(name+"\n"), 0o600)
+}
+
+// variableContext returns a template context with the variables of the
+// active environment, overridden by -var flags and values entered in the
+// variable prompt, in turn overridden by values extracted from responses.
+// Saved requests add their own on top.
+func variableContext() templateContext {
+	var ctx templateContext
+	if env := findEnvironment(activeEnvironment); env != nil {
+		ctx = ctx.withLayer(variableLayer{source: "environment " + env.Name, vars: env.Variables, secrets: env.Secrets})
+	}
+	return ctx.withVariables("session", templateVars).withVariables("extracted", extractedVars)
+}
+
+// environmentPicker lists the environments of the workspace, with "no
+// environment" first, or the change history of one of them
+type environmentPicker struct {
+	idx int
+
+	showHistory bool
+	historyEnv  string
+	history     []envChange // newest first
+	historyIdx  int
+	historyErr  error
+}
+
+func (m model) openEnvironmentPicker() model {
+	p := &environmentPicker{}
+	for i, env := range environments {
+		if env.Name == activeEnvironment {
+			p.idx = i + 1
+		}
+	}
+	m.environmentPicker = p
+	m.textInput.Blur()
+	return m
+}
+
+// updateEnvironmentPicker handles keys while the picker is open
+func (m model) updateEnvironmentPicker(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	p := m.environmentPicker
+	if p.showHistory {
+		return m.updateEnvironmentHistory(msg)
+	}
+	switch msg.Type {
+	case tea.KeyCtrlC:
+		return m, tea.Quit
+	case tea.KeyRunes:
+		if string(msg.Runes) == "h" && p.idx > 0 {
+			p.showHistory, p.historyEnv, p.historyIdx = true, environments[p.idx-1].Name, 0
+			p.history, p.historyErr = environmentChanges(p.historyEnv)
+		}
+	case tea.KeyEsc, tea.KeyCtrlE:
+		m.environmentPicker = nil
+		m.textInput.Focus()
+	case tea.KeyUp:
+		if p.idx > 0 {
+			p.idx--
+		}
+	case tea.KeyDown:
+		if p.idx < len(environments) {
+			p.idx++
+		}
+	case tea.KeyEnter:
+		name := ""
+		if p.idx > 0 {
+			name = environments[p.idx-1].Name
+		}
+		m.environmentPicker = nil
+		m.textInput.Focus()
+		if err := useEnvironment(name); err != nil {
+			m.notice = errorStyle.Render(fmt.Sprintf("Switching environment failed: %v", err))
+		} else if name == "" {
+			m.notice = "No environment"
+		} else {
+			m.notice = fmt.Sprintf("Using environment %q", name)
+		}
+	}
+	return m, nil
+}
+
+// renderEnvironmentPicker draws the environment picker with the variables
+// of the highlighted environment, secrets masked
+func renderEnvironmentPicker(p *environmentPicker) string {
+	var sb strings.Builder
+	sb.WriteString(headerStyle.Render("Environments"))
+	sb.WriteString("\n\n")
+
+	labels := []string{"(none)"}
+	for _, env := range environments {
+		labels = append(labels, env.Name)
+	}
+	for i, label := range labels {
+		if (i == 0 && activeEnvironment == "") || (i > 0 && environments[i-1].Name == activeEnvironment) {
+			label += historyDimStyle.Render(" (active)")
+		}
+		if i == p.idx {
+			sb.WriteString(selectedSuggestionStyle.Render("› ") + label)
+		} else {
+			sb.WriteString("  " + label)
+		}
+		sb.WriteString("\n")
+	}
+
+	if p.idx > 0 {
+		env := environments[p.idx-1]
+		sb.WriteString("\n")
+		for _, name := range sortedKeys(env.Variables) {
+			if _, ok := env.Secrets[name]; ok {
+				continue
+			}
+			value := env.Variables[name]
+			if secretNamePattern.MatchString(name) {
+				value = maskedValue
+			}
+			fmt.Fprintf(&sb, "%s %s\n", headerStyle.Render(name+":"), value)
+		}
+		for _, name := range sortedKeys(env.Secrets) {
+			fmt.Fprintf(&sb, "%s %s %s\n", headerStyle.Render(name+":"), maskedValue,
+				historyDimStyle.Render("(secret from "+env.Secrets[name]+")"))
+		}
+	}
+	if len(environments) == 0 {
+		sb.WriteString("\n")
+		sb.WriteString(historyDimStyle.Render("No environments yet. Define them in " +
+			filepath.Join(workspaceDir(), environmentsFile)))
+		sb.WriteString("\n")
+	}
+	sb.WriteString(historyDimStyle.Render("\n↑/↓: Select • Enter: Use • h: History • Esc: Close"))
+	return sb.String()
+}
+
+// updateEnvironmentHistory handles keys while the picker shows the history
+// of an environment
+func (m model) updateEnvironmentHistory(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	p := m.environmentPicker
+	switch msg.Type {
+	case tea.KeyCtrlC:
+		return m, tea.Quit
+	case tea.KeyEsc:
+		p.showHistory = false
+	case tea.KeyRunes:
+		if string(msg.Runes) == "h" {
+			p.showHistory = false
+		}
+	case tea.KeyUp:
+		if p.historyIdx > 0 {
+			p.historyIdx--
+		}
+	case tea.KeyDown:
+		if p.historyIdx < len(p.history)-1 {
+			p.historyIdx++
+		}
+	case tea.KeyEnter:
+		if len(p.history) == 0 {
+			return m, nil
+		}
+		c := p.history[p.historyIdx]
+		name := p.historyEnv
+		if err := revertEnvironmentChange(c); err != nil {
+			p.historyErr = fmt.Errorf("reverting %s failed: %w", c.Variable, err)
+			return m, nil
+		}
+		// Reloading may have reordered the environments
+		for i, env := range environments {
+			if env.Name == name {
+				p.idx = i + 1
+			}
+		}
+		p.history, p.historyErr = environmentChanges(name)
+		p.historyIdx = 0
+		m.notice = fmt.Sprintf("Reverted %s of environment %q", c.Variable, name)
+	}
+	return m, nil
+}
+
+// environmentHint tells where a missing variable could be defined for good
+func environmentHint() string {
+	file := filepath.Join(workspaceDir(), environmentsFile)
+	switch {
+	case activeEnvironment != "":
+		return fmt.Sprintf("To keep it, add it to environment %q in %s", activeEnvironment, file)
+	case len(environments) > 0:
+		return "No environment is active, Ctrl+E picks one"
+	}
+	return "To keep it, define environments in " + file
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// exporter converts a collection into another tool's format, returning
+// what couldn't be carried over as warnings
+type exporter func(c *collection) ([]byte, []string, error)
+
+// exporters by the name given to -format
+var exporters = map[string]exporter{
+	"postman": exportPostman,
+}
+
+// exportCommand implements `lazyhttp export`: write a collection in the
+// format of another API client, to stdout unless -o is given
+func exportCommand(args []string) int {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	format := fs.String("format", "postman", "format to write: postman")
+	output := fs.String("o", "", "`file` to write (default: stdout)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: lazyhttp export [flags] <collection.json | collection name>\n\n")
+		fmt.Fprintf(fs.Output(), "Exports a collection as a Postman v2.1 collection\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+	convert, ok := exporters[*format]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Error: unknown format %q\n", *format)
+		return 2
+	}
+
+	path := fs.Arg(0)
+	if _, statErr := os.Stat(path); errors.Is(statErr, os.ErrNotExist) {
+		if _, nameErr := os.Stat(collectionPath(path)); nameErr == nil {
+			path = collectionPath(path)
+		}
+	}
+	c, err := loadCollection(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	data, warnings, err := convert(c)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	for _, w := range warnings {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", w)
+	}
+
+	if *output == "" {
+		os.Stdout.Write(data)
+		return 0
+	}
+	if err := os.WriteFile(*output, data, 0o600); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	fmt.Fprintf(os.Stderr, "Exported %d requests of collection %q to %s\n", len(c.Requests), c.Name, *output)
+	return 0
+}
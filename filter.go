@@ -0,0 +1,1625 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Filters pick values out of a JSON response, written either in a subset
+// of jq (.items[] | select(.price < 10) | .name) or, starting with $, as
+// a JSONPath ($.items[?(@.price < 10)].name). Both are compiled into the
+// same functions from an input value to the values it yields. Objects are
+// walked in key order, as the response view shows them.
+
+// filterFunc yields the outputs of a filter for one input
+type filterFunc func(v interface{}) ([]interface{}, error)
+
+// compileFilter parses a jq or JSONPath expression
+func compileFilter(expr string) (filterFunc, error) {
+	tokens, err := filterTokens(expr)
+	if err != nil {
+		return nil, err
+	}
+	p := &filterParser{tokens: tokens}
+	var f filterFunc
+	if len(tokens) > 0 && tokens[0].text == "$" {
+		f, err = p.jsonPath()
+	} else {
+		f, err = p.pipe()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !p.atEnd() {
+		return nil, p.unexpected()
+	}
+	return f, nil
+}
+
+// applyFilter runs a filter over a JSON document
+func applyFilter(expr string, body []byte) ([]interface{}, error) {
+	f, err := compileFilter(expr)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var doc interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return nil, errors.New("the response isn't JSON")
+	}
+	return f(doc)
+}
+
+// marshalFilterResult encodes an output of a filter, keeping <, > and &
+// as they are
+func marshalFilterResult(v interface{}) []byte {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return []byte(fmt.Sprintf("%q", err.Error()))
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n"))
+}
+
+// filterToken is a token of a filter expression. Strings and numbers
+// carry their value, space tells whether whitespace came before it.
+type filterToken struct {
+	kind  byte // 'i' identifier, 'n' number, 's' string, 'p' punctuation
+	text  string
+	str   string
+	num   float64
+	col   int
+	space bool
+}
+
+// filterTokens splits a filter expression into tokens
+func filterTokens(expr string) ([]filterToken, error) {
+	var tokens []filterToken
+	space := false
+	for i := 0; i < len(expr); {
+		c := expr[i]
+		start := i
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			space = true
+			i++
+			continue
+		case c == '"' || c == '\'':
+			i++
+			for i < len(expr) && expr[i] != c {
+				if expr[i] == '\\' {
+					i++
+				}
+				i++
+			}
+			if i >= len(expr) {
+				return nil, fmt.Errorf("unterminated string at column %d", start+1)
+			}
+			i++
+			raw := expr[start:i]
+			if c == '\'' {
+				raw = `"` + strings.ReplaceAll(strings.ReplaceAll(raw[1:len(raw)-1], `\'`, `'`), `"`, `\"`) + `"`
+			}
+			var s string
+			if err := json.Unmarshal([]byte(raw), &s); err != nil {
+				return nil, fmt.Errorf("invalid string at column %d", start+1)
+			}
+			tokens = append(tokens, filterToken{kind: 's', text: expr[start:i], str: s, col: start + 1, space: space})
+		case c >= '0' && c <= '9':
+			for i < len(expr) && (expr[i] >= '0' && expr[i] <= '9' || expr[i] == '.' ||
+				expr[i] == 'e' || expr[i] == 'E' || (expr[i] == '-' || expr[i] == '+') && (expr[i-1] == 'e' || expr[i-1] == 'E')) {
+				i++
+			}
+			n, err := strconv.ParseFloat(expr[start:i], 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid number %q at column %d", expr[start:i], start+1)
+			}
+			tokens = append(tokens, filterToken{kind: 'n', text: expr[start:i], num: n, col: start + 1, space: space})
+		case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+			for i < len(expr) && (expr[i] == '_' || expr[i] >= 'a' && expr[i] <= 'z' || expr[i] >= 'A' && expr[i] <= 'Z' || expr[i] >= '0' && expr[i] <= '9') {
+				i++
+			}
+			tokens = append(tokens, filterToken{kind: 'i', text: expr[start:i], col: start + 1, space: space})
+		default:
+			text := string(c)
+			if i+1 < len(expr) {
+				switch two := expr[i : i+2]; two {
+				case "..", "==", "!=", "<=", ">=", "//", "&&", "||":
+					text = two
+				}
+			}
+			if len(text) == 1 && (!strings.Contains(".[](){}|,:;?<>!+-*/%@$", text)) {
+				return nil, fmt.Errorf("unexpected %q at column %d", text, start+1)
+			}
+			i += len(text)
+			tokens = append(tokens, filterToken{kind: 'p', text: text, col: start + 1, space: space})
+		}
+		space = false
+	}
+	return tokens, nil
+}
+
+// filterParser compiles tokens into filter functions, by recursive
+// descent from the loosest binding operator to the tightest
+type filterParser struct {
+	tokens []filterToken
+	pos    int
+}
+
+func (p *filterParser) atEnd() bool { return p.pos >= len(p.tokens) }
+
+// peek is the next token, or a zero token at the end
+func (p *filterParser) peek() filterToken {
+	if p.atEnd() {
+		return filterToken{}
+	}
+	return p.tokens[p.pos]
+}
+
+// is reports whether the next token is punctuation or a keyword text
+func (p *filterParser) is(text string) bool {
+	t := p.peek()
+	return (t.kind == 'p' || t.kind == 'i') && t.text == text
+}
+
+// accept consumes the next token if it is text
+func (p *filterParser) accept(text string) bool {
+	if p.is(text) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *filterParser) expect(text string) error {
+	if !p.accept(text) {
+		if p.atEnd() {
+			return fmt.Errorf("expected %q at the end", text)
+		}
+		return fmt.Errorf("expected %q at column %d", text, p.peek().col)
+	}
+	return nil
+}
+
+func (p *filterParser) unexpected() error {
+	if p.atEnd() {
+		return errors.New("the filter ends early")
+	}
+	t := p.peek()
+	return fmt.Errorf("unexpected %q at column %d", t.text, t.col)
+}
+
+// pipe parses a | b, feeding every output of a to b
+func (p *filterParser) pipe() (filterFunc, error) {
+	left, err := p.comma()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("|") {
+		right, err := p.comma()
+		if err != nil {
+			return nil, err
+		}
+		left = pipeFilters(left, right)
+	}
+	return left, nil
+}
+
+func pipeFilters(a, b filterFunc) filterFunc {
+	return func(v interface{}) ([]interface{}, error) {
+		in, err := a(v)
+		if err != nil {
+			return nil, err
+		}
+		var out []interface{}
+		for _, x := range in {
+			res, err := b(x)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, res...)
+		}
+		return out, nil
+	}
+}
+
+// comma parses a, b, yielding the outputs of both
+func (p *filterParser) comma() (filterFunc, error) {
+	left, err := p.alternative()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept(",") {
+		right, err := p.alternative()
+		if err != nil {
+			return nil, err
+		}
+		a, b := left, right
+		left = func(v interface{}) ([]interface{}, error) {
+			x, err := a(v)
+			if err != nil {
+				return nil, err
+			}
+			y, err := b(v)
+			return append(x, y...), err
+		}
+	}
+	return left, nil
+}
+
+// alternative parses a // b, the outputs of a that are neither false nor
+// null, or else those of b
+func (p *filterParser) alternative() (filterFunc, error) {
+	left, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("//") {
+		right, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		a, b := left, right
+		left = func(v interface{}) ([]interface{}, error) {
+			x, _ := a(v)
+			var out []interface{}
+			for _, r := range x {
+				if truthy(r) {
+					out = append(out, r)
+				}
+			}
+			if len(out) > 0 {
+				return out, nil
+			}
+			return b(v)
+		}
+	}
+	return left, nil
+}
+
+// combineFilters combines every output of a with every output of b
+func combineFilters(a, b filterFunc, op func(x, y interface{}) (interface{}, error)) filterFunc {
+	return func(v interface{}) ([]interface{}, error) {
+		x, err := a(v)
+		if err != nil {
+			return nil, err
+		}
+		y, err := b(v)
+		if err != nil {
+			return nil, err
+		}
+		var out []interface{}
+		for _, r := range y {
+			for _, l := range x {
+				res, err := op(l, r)
+				if err != nil {
+					return nil, err
+				}
+				out = append(out, res)
+			}
+		}
+		return out, nil
+	}
+}
+
+func (p *filterParser) or() (filterFunc, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("or") || p.accept("||") {
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		left = combineFilters(left, right, func(x, y interface{}) (interface{}, error) { return truthy(x) || truthy(y), nil })
+	}
+	return left, nil
+}
+
+func (p *filterParser) and() (filterFunc, error) {
+	left, err := p.comparison()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("and") || p.accept("&&") {
+		right, err := p.comparison()
+		if err != nil {
+			return nil, err
+		}
+		left = combineFilters(left, right, func(x, y interface{}) (interface{}, error) { return truthy(x) && truthy(y), nil })
+	}
+	return left, nil
+}
+
+func (p *filterParser) comparison() (filterFunc, error) {
+	left, err := p.additive()
+	if err != nil {
+		return nil, err
+	}
+	for _, op := range []string{"==", "!=", "<=", ">=", "<", ">"} {
+		if !p.accept(op) {
+			continue
+		}
+		right, err := p.additive()
+		if err != nil {
+			return nil, err
+		}
+		return combineFilters(left, right, func(x, y interface{}) (interface{}, error) {
+			c := compareJSON(x, y)
+			switch op {
+			case "==":
+				return c == 0, nil
+			case "!=":
+				return c != 0, nil
+			case "<=":
+				return c <= 0, nil
+			case ">=":
+				return c >= 0, nil
+			case "<":
+				return c < 0, nil
+			}
+			return c > 0, nil
+		}), nil
+	}
+	return left, nil
+}
+
+func (p *filterParser) additive() (filterFunc, error) {
+	left, err := p.multiplicative()
+	if err != nil {
+		return nil, err
+	}
+	for p.is("+") || p.is("-") {
+		op := p.peek().text
+		p.pos++
+		right, err := p.multiplicative()
+		if err != nil {
+			return nil, err
+		}
+		left = combineFilters(left, right, func(x, y interface{}) (interface{}, error) { return arithmetic(op, x, y) })
+	}
+	return left, nil
+}
+
+func (p *filterParser) multiplicative() (filterFunc, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for p.is("*") || p.is("/") || p.is("%") {
+		op := p.peek().text
+		p.pos++
+		right, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		left = combineFilters(left, right, func(x, y interface{}) (interface{}, error) { return arithmetic(op, x, y) })
+	}
+	return left, nil
+}
+
+// unary parses -a, and !a of JSONPath filters
+func (p *filterParser) unary() (filterFunc, error) {
+	switch {
+	case p.accept("-"):
+		f, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return pipeFilters(f, func(v interface{}) ([]interface{}, error) {
+			n, ok := jsonNumber(v)
+			if !ok {
+				return nil, fmt.Errorf("%s cannot be negated", jsonTypeName(v))
+			}
+			return []interface{}{-n}, nil
+		}), nil
+	case p.accept("!"):
+		f, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return pipeFilters(f, func(v interface{}) ([]interface{}, error) { return []interface{}{!truthy(v)}, nil }), nil
+	}
+	return p.postfix()
+}
+
+// postfix parses a term followed by field accesses, indexes, slices,
+// iterations and ? suppressing errors
+func (p *filterParser) postfix() (filterFunc, error) {
+	f, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		switch {
+		case p.is(".") && p.pos+1 < len(p.tokens) && !p.tokens[p.pos+1].space &&
+			(p.tokens[p.pos+1].kind == 'i' || p.tokens[p.pos+1].kind == 's'):
+			p.pos++
+			name := p.peek()
+			p.pos++
+			f = pipeFilters(f, fieldFilter(tokenName(name)))
+		case p.is(".") && p.pos+1 < len(p.tokens) && !p.tokens[p.pos+1].space && p.tokens[p.pos+1].text == "[":
+			p.pos++
+		case p.is("["):
+			p.pos++
+			if f, err = p.bracket(f); err != nil {
+				return nil, err
+			}
+		case p.accept("?"):
+			inner := f
+			f = func(v interface{}) ([]interface{}, error) {
+				out, _ := inner(v)
+				return out, nil
+			}
+		default:
+			return f, nil
+		}
+	}
+}
+
+// tokenName is the name an identifier or a string token gives
+func tokenName(t filterToken) string {
+	if t.kind == 's' {
+		return t.str
+	}
+	return t.text
+}
+
+// fieldFilter looks up a field of an object
+func fieldFilter(name string) filterFunc {
+	return func(v interface{}) ([]interface{}, error) {
+		out, err := indexJSON(v, name)
+		return []interface{}{out}, err
+	}
+}
+
+// bracket parses what follows [ after target: ] iterating, an index or
+// a slice. Indexes are computed from the input of the whole term, as in
+// .[.i].
+func (p *filterParser) bracket(target filterFunc) (filterFunc, error) {
+	if p.accept("]") {
+		return pipeFilters(target, iterateJSON), nil
+	}
+	var from, to filterFunc
+	var err error
+	if !p.is(":") {
+		if from, err = p.pipe(); err != nil {
+			return nil, err
+		}
+	}
+	if !p.accept(":") {
+		if err := p.expect("]"); err != nil {
+			return nil, err
+		}
+		return func(v interface{}) ([]interface{}, error) {
+			targets, err := target(v)
+			if err != nil {
+				return nil, err
+			}
+			keys, err := from(v)
+			if err != nil {
+				return nil, err
+			}
+			var out []interface{}
+			for _, t := range targets {
+				for _, k := range keys {
+					x, err := indexJSON(t, k)
+					if err != nil {
+						return nil, err
+					}
+					out = append(out, x)
+				}
+			}
+			return out, nil
+		}, nil
+	}
+	if !p.is("]") {
+		if to, err = p.pipe(); err != nil {
+			return nil, err
+		}
+	}
+	if err := p.expect("]"); err != nil {
+		return nil, err
+	}
+	bound := func(f filterFunc, v interface{}) (interface{}, error) {
+		if f == nil {
+			return nil, nil
+		}
+		out, err := f(v)
+		if err != nil || len(out) == 0 {
+			return nil, err
+		}
+		return out[0], nil
+	}
+	return func(v interface{}) ([]interface{}, error) {
+		targets, err := target(v)
+		if err != nil {
+			return nil, err
+		}
+		start, err := bound(from, v)
+		if err != nil {
+			return nil, err
+		}
+		end, err := bound(to, v)
+		if err != nil {
+			return nil, err
+		}
+		var out []interface{}
+		for _, t := range targets {
+			x, err := sliceJSON(t, start, end)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, x)
+		}
+		return out, nil
+	}, nil
+}
+
+// primary parses a term: ., .name, .., a literal, a parenthesized
+// filter, an array or object construction, or a function call
+func (p *filterParser) primary() (filterFunc, error) {
+	if p.atEnd() {
+		return nil, p.unexpected()
+	}
+	t := p.peek()
+	identity := func(v interface{}) ([]interface{}, error) { return []interface{}{v}, nil }
+	constant := func(c interface{}) filterFunc {
+		return func(interface{}) ([]interface{}, error) { return []interface{}{c}, nil }
+	}
+	switch {
+	case t.text == "." && t.kind == 'p':
+		p.pos++
+		if next := p.peek(); !p.atEnd() && !next.space && (next.kind == 'i' || next.kind == 's') {
+			p.pos++
+			return fieldFilter(tokenName(next)), nil
+		}
+		return identity, nil
+	case t.text == "@" && t.kind == 'p':
+		// The current item of a JSONPath filter
+		p.pos++
+		return identity, nil
+	case t.text == ".." && t.kind == 'p':
+		p.pos++
+		return func(v interface{}) ([]interface{}, error) { return descendants(v, true), nil }, nil
+	case t.kind == 'n':
+		p.pos++
+		return constant(t.num), nil
+	case t.kind == 's':
+		p.pos++
+		return constant(t.str), nil
+	case t.text == "(" && t.kind == 'p':
+		p.pos++
+		f, err := p.pipe()
+		if err != nil {
+			return nil, err
+		}
+		return f, p.expect(")")
+	case t.text == "[" && t.kind == 'p':
+		p.pos++
+		if p.accept("]") {
+			return constant([]interface{}{}), nil
+		}
+		f, err := p.pipe()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect("]"); err != nil {
+			return nil, err
+		}
+		return func(v interface{}) ([]interface{}, error) {
+			out, err := f(v)
+			if out == nil {
+				out = []interface{}{}
+			}
+			return []interface{}{out}, err
+		}, nil
+	case t.text == "{" && t.kind == 'p':
+		p.pos++
+		return p.object()
+	case t.kind == 'i':
+		p.pos++
+		switch t.text {
+		case "true":
+			return constant(true), nil
+		case "false":
+			return constant(false), nil
+		case "null":
+			return constant(nil), nil
+		}
+		var args []filterFunc
+		if p.accept("(") {
+			for {
+				arg, err := p.pipe()
+				if err != nil {
+					return nil, err
+				}
+				args = append(args, arg)
+				if !p.accept(";") {
+					break
+				}
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+		}
+		return builtinFilter(t.text, args)
+	}
+	return nil, p.unexpected()
+}
+
+// object parses the entries of {key: value, name, "key": value,
+// (expr): value} up to the closing brace, yielding an object for every
+// combination of the outputs of the keys and values
+func (p *filterParser) object() (filterFunc, error) {
+	type entry struct{ key, value filterFunc }
+	var entries []entry
+	for !p.accept("}") {
+		if len(entries) > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		t := p.peek()
+		var e entry
+		switch {
+		case t.kind == 'i' || t.kind == 's':
+			p.pos++
+			name := tokenName(t)
+			e.key = func(interface{}) ([]interface{}, error) { return []interface{}{name}, nil }
+			e.value = fieldFilter(name)
+		case t.text == "(":
+			p.pos++
+			key, err := p.pipe()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+			e.key = key
+		default:
+			return nil, p.unexpected()
+		}
+		if p.accept(":") {
+			value, err := p.alternative()
+			if err != nil {
+				return nil, err
+			}
+			e.value = value
+		} else if e.value == nil {
+			return nil, p.expect(":")
+		}
+		entries = append(entries, e)
+	}
+	return func(v interface{}) ([]interface{}, error) {
+		objects := []map[string]interface{}{{}}
+		for _, e := range entries {
+			keys, err := e.key(v)
+			if err != nil {
+				return nil, err
+			}
+			values, err := e.value(v)
+			if err != nil {
+				return nil, err
+			}
+			var next []map[string]interface{}
+			for _, o := range objects {
+				for _, k := range keys {
+					name, ok := k.(string)
+					if !ok {
+						return nil, fmt.Errorf("object keys must be strings, not %s", jsonTypeName(k))
+					}
+					for _, value := range values {
+						c := make(map[string]interface{}, len(o)+1)
+						for ok, ov := range o {
+							c[ok] = ov
+						}
+						c[name] = value
+						next = append(next, c)
+					}
+				}
+			}
+			objects = next
+		}
+		out := make([]interface{}, len(objects))
+		for i, o := range objects {
+			out[i] = o
+		}
+		return out, nil
+	}, nil
+}
+
+// jsonPath parses a JSONPath from its leading $: .name, ['name'], [0],
+// [*], .*, [0,2], [1:3], ..name and [?(filter)], where the filter is an
+// expression over @
+func (p *filterParser) jsonPath() (filterFunc, error) {
+	p.pos++ // $
+	f := func(v interface{}) ([]interface{}, error) { return []interface{}{v}, nil }
+	for !p.atEnd() {
+		var step filterFunc
+		switch {
+		case p.accept("."):
+			t := p.peek()
+			switch {
+			case t.kind == 'i' || t.kind == 's':
+				p.pos++
+				step = pathChild(tokenName(t))
+			case p.accept("*"):
+				step = iterateJSON
+			default:
+				return nil, p.unexpected()
+			}
+		case p.accept(".."):
+			t := p.peek()
+			var then filterFunc
+			switch {
+			case t.kind == 'i' || t.kind == 's':
+				p.pos++
+				then = pathChild(tokenName(t))
+			case p.accept("*"):
+				then = iterateJSON
+			case p.accept("["):
+				var err error
+				if then, err = p.pathBracket(); err != nil {
+					return nil, err
+				}
+			default:
+				return nil, p.unexpected()
+			}
+			step = func(v interface{}) ([]interface{}, error) {
+				var out []interface{}
+				for _, d := range descendants(v, true) {
+					res, _ := then(d)
+					out = append(out, res...)
+				}
+				return out, nil
+			}
+		case p.accept("["):
+			var err error
+			if step, err = p.pathBracket(); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, p.unexpected()
+		}
+		f = pipeFilters(f, step)
+	}
+	return f, nil
+}
+
+// pathChild is the field of an object a JSONPath step names, nothing
+// when it's missing, where jq yields null
+func pathChild(name string) filterFunc {
+	return func(v interface{}) ([]interface{}, error) {
+		obj, ok := v.(map[string]interface{})
+		if x, found := obj[name]; ok && found {
+			return []interface{}{x}, nil
+		}
+		return nil, nil
+	}
+}
+
+// pathBracket parses a JSONPath bracket after [: *, ?(filter), or a union
+// of names, indexes and slices
+func (p *filterParser) pathBracket() (filterFunc, error) {
+	if p.accept("*") {
+		return iterateJSON, p.expect("]")
+	}
+	if p.accept("?") {
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		cond, err := p.pipe()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		if err := p.expect("]"); err != nil {
+			return nil, err
+		}
+		return func(v interface{}) ([]interface{}, error) {
+			items, _ := iterateJSON(v)
+			var out []interface{}
+			for _, item := range items {
+				// Items a condition can't be evaluated on don't match
+				res, err := cond(item)
+				if err == nil && len(res) > 0 && truthy(res[0]) {
+					out = append(out, item)
+				}
+			}
+			return out, nil
+		}, nil
+	}
+
+	var parts []filterFunc
+	for {
+		t := p.peek()
+		var part filterFunc
+		number := func() (interface{}, bool) {
+			neg := p.accept("-")
+			if p.peek().kind != 'n' {
+				if neg {
+					p.pos--
+				}
+				return nil, false
+			}
+			n := p.peek().num
+			p.pos++
+			if neg {
+				n = -n
+			}
+			return n, true
+		}
+		switch {
+		case t.kind == 's':
+			p.pos++
+			part = pathChild(t.str)
+		default:
+			start, hasStart := number()
+			if !p.accept(":") {
+				if !hasStart {
+					return nil, p.unexpected()
+				}
+				part = func(v interface{}) ([]interface{}, error) {
+					arr, ok := v.([]interface{})
+					i := int(start.(float64))
+					if i < 0 {
+						i += len(arr)
+					}
+					if !ok || i < 0 || i >= len(arr) {
+						return nil, nil
+					}
+					return []interface{}{arr[i]}, nil
+				}
+				break
+			}
+			end, _ := number()
+			part = func(v interface{}) ([]interface{}, error) {
+				if _, ok := v.([]interface{}); !ok {
+					return nil, nil
+				}
+				s, err := sliceJSON(v, start, end)
+				if err != nil {
+					return nil, nil
+				}
+				return s.([]interface{}), nil
+			}
+		}
+		parts = append(parts, part)
+		if !p.accept(",") {
+			break
+		}
+	}
+	if err := p.expect("]"); err != nil {
+		return nil, err
+	}
+	return func(v interface{}) ([]interface{}, error) {
+		var out []interface{}
+		for _, part := range parts {
+			res, _ := part(v)
+			out = append(out, res...)
+		}
+		return out, nil
+	}, nil
+}
+
+// builtinFilter is a call of a function, with its arguments
+func builtinFilter(name string, args []filterFunc) (filterFunc, error) {
+	arity := map[string]int{
+		"length": 0, "keys": 0, "values": 0, "type": 0, "not": 0, "first": 0, "last": 0, "sort": 0, "unique": 0,
+		"reverse": 0, "add": 0, "min": 0, "max": 0, "to_entries": 0, "from_entries": 0, "tostring": 0,
+		"tonumber": 0, "ascii_downcase": 0, "ascii_upcase": 0, "flatten": 0, "any": 0, "all": 0, "empty": 0,
+		"select": 1, "map": 1, "sort_by": 1, "group_by": 1, "unique_by": 1, "min_by": 1, "max_by": 1, "has": 1,
+		"contains": 1, "startswith": 1, "endswith": 1, "test": 1, "split": 1, "join": 1,
+	}
+	want, known := arity[name]
+	if !known {
+		return nil, fmt.Errorf("unknown function %s", name)
+	}
+	if len(args) != want {
+		return nil, fmt.Errorf("%s takes %d arguments, not %d", name, want, len(args))
+	}
+	one := func(f func(v interface{}) (interface{}, error)) filterFunc {
+		return func(v interface{}) ([]interface{}, error) {
+			out, err := f(v)
+			if err != nil {
+				return nil, err
+			}
+			return []interface{}{out}, nil
+		}
+	}
+	// withArg calls f with every output of the argument
+	withArg := func(f func(v, arg interface{}) (interface{}, error)) filterFunc {
+		return func(v interface{}) ([]interface{}, error) {
+			argv, err := args[0](v)
+			if err != nil {
+				return nil, err
+			}
+			var out []interface{}
+			for _, a := range argv {
+				res, err := f(v, a)
+				if err != nil {
+					return nil, err
+				}
+				out = append(out, res)
+			}
+			return out, nil
+		}
+	}
+	// byKey computes the first output of the argument for every item of
+	// an array
+	byKey := func(v interface{}) ([]interface{}, []interface{}, error) {
+		arr, ok := v.([]interface{})
+		if !ok {
+			return nil, nil, fmt.Errorf("%s of %s, not an array", name, jsonTypeName(v))
+		}
+		keys := make([]interface{}, len(arr))
+		for i, item := range arr {
+			out, err := args[0](item)
+			if err != nil {
+				return nil, nil, err
+			}
+			if len(out) > 0 {
+				keys[i] = out[0]
+			}
+		}
+		return arr, keys, nil
+	}
+	array := func(v interface{}) ([]interface{}, error) {
+		arr, ok := v.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s of %s, not an array", name, jsonTypeName(v))
+		}
+		return arr, nil
+	}
+	str := func(v interface{}) (string, error) {
+		s, ok := v.(string)
+		if !ok {
+			return "", fmt.Errorf("%s of %s, not a string", name, jsonTypeName(v))
+		}
+		return s, nil
+	}
+
+	switch name {
+	case "empty":
+		return func(interface{}) ([]interface{}, error) { return nil, nil }, nil
+	case "length":
+		return one(func(v interface{}) (interface{}, error) {
+			switch v := v.(type) {
+			case nil:
+				return 0.0, nil
+			case string:
+				return float64(len([]rune(v))), nil
+			case []interface{}:
+				return float64(len(v)), nil
+			case map[string]interface{}:
+				return float64(len(v)), nil
+			}
+			if n, ok := jsonNumber(v); ok {
+				return math.Abs(n), nil
+			}
+			return nil, fmt.Errorf("%s has no length", jsonTypeName(v))
+		}), nil
+	case "keys", "values", "to_entries":
+		return one(func(v interface{}) (interface{}, error) {
+			switch v := v.(type) {
+			case map[string]interface{}:
+				out := []interface{}{}
+				for _, k := range sortedKeys(v) {
+					switch name {
+					case "keys":
+						out = append(out, k)
+					case "values":
+						out = append(out, v[k])
+					default:
+						out = append(out, map[string]interface{}{"key": k, "value": v[k]})
+					}
+				}
+				return out, nil
+			case []interface{}:
+				out := []interface{}{}
+				for i, x := range v {
+					switch name {
+					case "keys":
+						out = append(out, float64(i))
+					case "values":
+						out = append(out, x)
+					default:
+						out = append(out, map[string]interface{}{"key": float64(i), "value": x})
+					}
+				}
+				return out, nil
+			}
+			return nil, fmt.Errorf("%s of %s", name, jsonTypeName(v))
+		}), nil
+	case "from_entries":
+		return one(func(v interface{}) (interface{}, error) {
+			arr, err := array(v)
+			if err != nil {
+				return nil, err
+			}
+			out := map[string]interface{}{}
+			for _, e := range arr {
+				obj, _ := e.(map[string]interface{})
+				key := obj["key"]
+				if key == nil {
+					key = obj["name"]
+				}
+				out[strings.Trim(string(marshalFilterResult(key)), `"`)] = obj["value"]
+			}
+			return out, nil
+		}), nil
+	case "type":
+		return one(func(v interface{}) (interface{}, error) { return jsonTypeName(v), nil }), nil
+	case "not":
+		return one(func(v interface{}) (interface{}, error) { return !truthy(v), nil }), nil
+	case "first", "last":
+		return one(func(v interface{}) (interface{}, error) {
+			arr, err := array(v)
+			if err != nil || len(arr) == 0 {
+				return nil, err
+			}
+			if name == "first" {
+				return arr[0], nil
+			}
+			return arr[len(arr)-1], nil
+		}), nil
+	case "sort", "unique", "reverse", "min", "max", "flatten", "any", "all", "add":
+		return one(func(v interface{}) (interface{}, error) {
+			if name == "reverse" {
+				if s, ok := v.(string); ok {
+					r := []rune(s)
+					for i, j := 0, len(r)-1; i < j; i, j = i+1, j-1 {
+						r[i], r[j] = r[j], r[i]
+					}
+					return string(r), nil
+				}
+			}
+			arr, err := array(v)
+			if err != nil {
+				return nil, err
+			}
+			sorted := append([]interface{}{}, arr...)
+			sort.SliceStable(sorted, func(i, j int) bool { return compareJSON(sorted[i], sorted[j]) < 0 })
+			switch name {
+			case "sort":
+				return sorted, nil
+			case "unique":
+				out := []interface{}{}
+				for i, x := range sorted {
+					if i == 0 || compareJSON(x, sorted[i-1]) != 0 {
+						out = append(out, x)
+					}
+				}
+				return out, nil
+			case "reverse":
+				out := make([]interface{}, len(arr))
+				for i, x := range arr {
+					out[len(arr)-1-i] = x
+				}
+				return out, nil
+			case "min", "max":
+				if len(sorted) == 0 {
+					return nil, nil
+				}
+				if name == "min" {
+					return sorted[0], nil
+				}
+				return sorted[len(sorted)-1], nil
+			case "flatten":
+				return flattenArray(arr), nil
+			case "any", "all":
+				for _, x := range arr {
+					if truthy(x) == (name == "any") {
+						return name == "any", nil
+					}
+				}
+				return name == "all", nil
+			}
+			var sum interface{}
+			for _, x := range arr {
+				if sum, err = arithmetic("+", sum, x); err != nil {
+					return nil, err
+				}
+			}
+			return sum, nil
+		}), nil
+	case "tostring":
+		return one(func(v interface{}) (interface{}, error) {
+			if s, ok := v.(string); ok {
+				return s, nil
+			}
+			return string(marshalFilterResult(v)), nil
+		}), nil
+	case "tonumber":
+		return one(func(v interface{}) (interface{}, error) {
+			if n, ok := jsonNumber(v); ok {
+				return n, nil
+			}
+			s, err := str(v)
+			if err != nil {
+				return nil, err
+			}
+			n, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+			if err != nil {
+				return nil, fmt.Errorf("%q isn't a number", s)
+			}
+			return n, nil
+		}), nil
+	case "ascii_downcase", "ascii_upcase":
+		return one(func(v interface{}) (interface{}, error) {
+			s, err := str(v)
+			if name == "ascii_downcase" {
+				return strings.ToLower(s), err
+			}
+			return strings.ToUpper(s), err
+		}), nil
+	case "select":
+		return func(v interface{}) ([]interface{}, error) {
+			conds, err := args[0](v)
+			if err != nil {
+				return nil, err
+			}
+			var out []interface{}
+			for _, c := range conds {
+				if truthy(c) {
+					out = append(out, v)
+				}
+			}
+			return out, nil
+		}, nil
+	case "map":
+		return one(func(v interface{}) (interface{}, error) {
+			items, err := iterateJSON(v)
+			if err != nil {
+				return nil, err
+			}
+			out := []interface{}{}
+			for _, item := range items {
+				res, err := args[0](item)
+				if err != nil {
+					return nil, err
+				}
+				out = append(out, res...)
+			}
+			return out, nil
+		}), nil
+	case "sort_by", "min_by", "max_by", "group_by", "unique_by":
+		return one(func(v interface{}) (interface{}, error) {
+			arr, keys, err := byKey(v)
+			if err != nil {
+				return nil, err
+			}
+			order := make([]int, len(arr))
+			for i := range order {
+				order[i] = i
+			}
+			sort.SliceStable(order, func(i, j int) bool { return compareJSON(keys[order[i]], keys[order[j]]) < 0 })
+			switch name {
+			case "sort_by":
+				out := make([]interface{}, len(arr))
+				for i, k := range order {
+					out[i] = arr[k]
+				}
+				return out, nil
+			case "min_by", "max_by":
+				if len(arr) == 0 {
+					return nil, nil
+				}
+				if name == "min_by" {
+					return arr[order[0]], nil
+				}
+				return arr[order[len(order)-1]], nil
+			}
+			out := []interface{}{}
+			for i, k := range order {
+				switch {
+				case i > 0 && compareJSON(keys[k], keys[order[i-1]]) == 0:
+					if name == "group_by" {
+						last := out[len(out)-1].([]interface{})
+						out[len(out)-1] = append(last, arr[k])
+					}
+				case name == "group_by":
+					out = append(out, []interface{}{arr[k]})
+				default:
+					out = append(out, arr[k])
+				}
+			}
+			return out, nil
+		}), nil
+	case "has":
+		return withArg(func(v, key interface{}) (interface{}, error) {
+			switch v := v.(type) {
+			case map[string]interface{}:
+				k, ok := key.(string)
+				if !ok {
+					return nil, fmt.Errorf("has of an object takes a string, not %s", jsonTypeName(key))
+				}
+				_, found := v[k]
+				return found, nil
+			case []interface{}:
+				n, ok := jsonNumber(key)
+				if !ok {
+					return nil, fmt.Errorf("has of an array takes a number, not %s", jsonTypeName(key))
+				}
+				return n >= 0 && int(n) < len(v), nil
+			}
+			return nil, fmt.Errorf("has of %s", jsonTypeName(v))
+		}), nil
+	case "contains":
+		return withArg(func(v, arg interface{}) (interface{}, error) { return containsJSON(v, arg), nil }), nil
+	case "startswith", "endswith", "test", "split", "join":
+		return withArg(func(v, arg interface{}) (interface{}, error) {
+			if name == "join" {
+				sep, err := str(arg)
+				if err != nil {
+					return nil, err
+				}
+				arr, err := array(v)
+				if err != nil {
+					return nil, err
+				}
+				parts := make([]string, len(arr))
+				for i, x := range arr {
+					if s, ok := x.(string); ok {
+						parts[i] = s
+					} else if x != nil {
+						parts[i] = string(marshalFilterResult(x))
+					}
+				}
+				return strings.Join(parts, sep), nil
+			}
+			s, err := str(v)
+			if err != nil {
+				return nil, err
+			}
+			a, err := str(arg)
+			if err != nil {
+				return nil, err
+			}
+			switch name {
+			case "startswith":
+				return strings.HasPrefix(s, a), nil
+			case "endswith":
+				return strings.HasSuffix(s, a), nil
+			case "test":
+				re, err := regexp.Compile(a)
+				if err != nil {
+					return nil, err
+				}
+				return re.MatchString(s), nil
+			}
+			out := []interface{}{}
+			for _, part := range strings.Split(s, a) {
+				out = append(out, part)
+			}
+			return out, nil
+		}), nil
+	}
+	return nil, fmt.Errorf("unknown function %s", name)
+}
+
+// indexJSON looks up a field of an object or an element of an array,
+// null for what's missing
+func indexJSON(v, key interface{}) (interface{}, error) {
+	switch x := v.(type) {
+	case nil:
+		return nil, nil
+	case map[string]interface{}:
+		if k, ok := key.(string); ok {
+			return x[k], nil
+		}
+	case []interface{}:
+		if n, ok := jsonNumber(key); ok {
+			i := int(math.Floor(n))
+			if i < 0 {
+				i += len(x)
+			}
+			if i < 0 || i >= len(x) {
+				return nil, nil
+			}
+			return x[i], nil
+		}
+	}
+	return nil, fmt.Errorf("cannot index %s with %s", jsonTypeName(v), jsonTypeName(key))
+}
+
+// sliceJSON is part of an array or string, from and to being numbers or
+// null for its start and end
+func sliceJSON(v, from, to interface{}) (interface{}, error) {
+	length := 0
+	switch x := v.(type) {
+	case nil:
+		return nil, nil
+	case []interface{}:
+		length = len(x)
+	case string:
+		length = len([]rune(x))
+	default:
+		return nil, fmt.Errorf("cannot slice %s", jsonTypeName(v))
+	}
+	bound := func(b interface{}, def int) (int, error) {
+		if b == nil {
+			return def, nil
+		}
+		n, ok := jsonNumber(b)
+		if !ok {
+			return 0, fmt.Errorf("cannot slice with %s", jsonTypeName(b))
+		}
+		i := int(math.Floor(n))
+		if i < 0 {
+			i += length
+		}
+		return min(max(i, 0), length), nil
+	}
+	start, err := bound(from, 0)
+	if err != nil {
+		return nil, err
+	}
+	end, err := bound(to, length)
+	if err != nil {
+		return nil, err
+	}
+	end = max(end, start)
+	if s, ok := v.(string); ok {
+		return string([]rune(s)[start:end]), nil
+	}
+	return append([]interface{}{}, v.([]interface{})[start:end]...), nil
+}
+
+// iterateJSON yields the elements of an array or the values of an object
+func iterateJSON(v interface{}) ([]interface{}, error) {
+	switch x := v.(type) {
+	case []interface{}:
+		return x, nil
+	case map[string]interface{}:
+		out := make([]interface{}, 0, len(x))
+		for _, k := range sortedKeys(x) {
+			out = append(out, x[k])
+		}
+		return out, nil
+	}
+	return nil, fmt.Errorf("cannot iterate over %s", jsonTypeName(v))
+}
+
+// descendants lists v, when self is set, and every value nested in it,
+// parents before their children
+func descendants(v interface{}, self bool) []interface{} {
+	var out []interface{}
+	if self {
+		out = append(out, v)
+	}
+	children, _ := iterateJSON(v)
+	for _, c := range children {
+		out = append(out, descendants(c, true)...)
+	}
+	return out
+}
+
+func flattenArray(arr []interface{}) []interface{} {
+	out := []interface{}{}
+	for _, x := range arr {
+		if inner, ok := x.([]interface{}); ok {
+			out = append(out, flattenArray(inner)...)
+		} else {
+			out = append(out, x)
+		}
+	}
+	return out
+}
+
+// containsJSON reports whether b is contained in a: substrings, elements
+// contained in some element, fields contained in the same field
+func containsJSON(a, b interface{}) bool {
+	switch b := b.(type) {
+	case string:
+		s, ok := a.(string)
+		return ok && strings.Contains(s, b)
+	case []interface{}:
+		arr, ok := a.([]interface{})
+		if !ok {
+			return false
+		}
+		for _, want := range b {
+			found := false
+			for _, have := range arr {
+				if containsJSON(have, want) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return false
+			}
+		}
+		return true
+	case map[string]interface{}:
+		obj, ok := a.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		for k, want := range b {
+			if have, found := obj[k]; !found || !containsJSON(have, want) {
+				return false
+			}
+		}
+		return true
+	}
+	return compareJSON(a, b) == 0
+}
+
+// jsonNumber is the value of a number, decoded as float64 or json.Number
+func jsonNumber(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// truthy is false for false and null only, as in jq
+func truthy(v interface{}) bool {
+	b, isBool := v.(bool)
+	return v != nil && (!isBool || b)
+}
+
+// compareJSON orders values as jq does: null, false, true, numbers,
+// strings, arrays, then objects
+func compareJSON(a, b interface{}) int {
+	rank := func(v interface{}) int {
+		switch v := v.(type) {
+		case nil:
+			return 0
+		case bool:
+			if v {
+				return 2
+			}
+			return 1
+		case string:
+			return 4
+		case []interface{}:
+			return 5
+		case map[string]interface{}:
+			return 6
+		}
+		return 3
+	}
+	ra, rb := rank(a), rank(b)
+	if ra != rb {
+		return ra - rb
+	}
+	switch a := a.(type) {
+	case string:
+		return strings.Compare(a, b.(string))
+	case []interface{}:
+		bb := b.([]interface{})
+		for i := 0; i < len(a) && i < len(bb); i++ {
+			if c := compareJSON(a[i], bb[i]); c != 0 {
+				return c
+			}
+		}
+		return len(a) - len(bb)
+	case map[string]interface{}:
+		bb := b.(map[string]interface{})
+		ka, kb := sortedKeys(a), sortedKeys(bb)
+		if c := compareJSON(toInterfaces(ka), toInterfaces(kb)); c != 0 {
+			return c
+		}
+		for _, k := range ka {
+			if c := compareJSON(a[k], bb[k]); c != 0 {
+				return c
+			}
+		}
+		return 0
+	}
+	if ra == 3 {
+		x, _ := jsonNumber(a)
+		y, _ := jsonNumber(b)
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+	}
+	return 0
+}
+
+func toInterfaces(s []string) []interface{} {
+	out := make([]interface{}, len(s))
+	for i, x := range s {
+		out[i] = x
+	}
+	return out
+}
+
+// arithmetic applies +, -, *, / or % as jq does: adding to null yields
+// the other value, + joins strings and arrays and merges objects, -
+// removes elements from arrays
+func arithmetic(op string, a, b interface{}) (interface{}, error) {
+	x, aNum := jsonNumber(a)
+	y, bNum := jsonNumber(b)
+	if aNum && bNum {
+		switch op {
+		case "+":
+			return x + y, nil
+		case "-":
+			return x - y, nil
+		case "*":
+			return x * y, nil
+		case "/":
+			if y == 0 {
+				return nil, errors.New("division by zero")
+			}
+			return x / y, nil
+		case "%":
+			if int(y) == 0 {
+				return nil, errors.New("division by zero")
+			}
+			return float64(int(x) % int(y)), nil
+		}
+	}
+	if op == "+" {
+		switch {
+		case a == nil:
+			return b, nil
+		case b == nil:
+			return a, nil
+		}
+		switch x := a.(type) {
+		case string:
+			if y, ok := b.(string); ok {
+				return x + y, nil
+			}
+		case []interface{}:
+			if y, ok := b.([]interface{}); ok {
+				return append(append([]interface{}{}, x...), y...), nil
+			}
+		case map[string]interface{}:
+			if y, ok := b.(map[string]interface{}); ok {
+				out := make(map[string]interface{}, len(x)+len(y))
+				for k, v := range x {
+					out[k] = v
+				}
+				for k, v := range y {
+					out[k] = v
+				}
+				return out, nil
+			}
+		}
+	}
+	if op == "-" {
+		if x, ok := a.([]interface{}); ok {
+			if y, ok := b.([]interface{}); ok {
+				out := []interface{}{}
+				for _, v := range x {
+					removed := false
+					for _, r := range y {
+						removed = removed || compareJSON(v, r) == 0
+					}
+					if !removed {
+						out = append(out, v)
+					}
+				}
+				return out, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("%s and %s cannot be combined with %s", jsonTypeName(a), jsonTypeName(b), op)
+}
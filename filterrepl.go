@@ -0,0 +1,327 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// filterHistoryFile keeps the filter expressions entered, one JSON string
+// per line, in the workspace directory
+const filterHistoryFile = "filter-history.jsonl"
+
+// filterHistoryLimit is the number of expressions kept
+const filterHistoryLimit = 200
+
+// filterREPL is the pane trying jq and JSONPath expressions on the last
+// response, previewing their results as they are typed
+type filterREPL struct {
+	input      textinput.Model
+	history    []string // oldest first
+	historyIdx int      // len(history) while not browsing it
+	typed      string   // what was typed before browsing the history
+	results    int
+	err        error
+}
+
+// openFilterREPL opens the filter pane on the last response, starting
+// from the display filter it's shown through
+func (m model) openFilterREPL() model {
+	if m.lastResponse == nil {
+		m.notice = "No response to filter yet"
+		return m
+	}
+	history, err := loadFilterHistory()
+	if err != nil {
+		m.notice = errorStyle.Render("Loading the filter history failed: " + err.Error())
+	}
+	input := textinput.New()
+	input.Prompt = "Filter: "
+	input.Placeholder = ".items[] | .name  or  $.items[*].name"
+	input.SetValue(m.filter)
+	if m.filter == "" {
+		input.SetValue(".")
+	}
+	input.CursorEnd()
+	input.Focus()
+	m.filterREPL = &filterREPL{input: input, history: history, historyIdx: len(history)}
+	m.textInput.Blur()
+	m = m.layout()
+	return m.evaluateFilter()
+}
+
+// closeFilterREPL goes back to the response
+func (m model) closeFilterREPL() model {
+	m.filterREPL = nil
+	m.textInput.Focus()
+	m = m.layout()
+	m.viewport.SetContent(m.response)
+	return m
+}
+
+// evaluateFilter previews the results of the expression typed, keeping
+// the last preview while it doesn't parse or run
+func (m model) evaluateFilter() model {
+	f := m.filterREPL
+	expr := strings.TrimSpace(f.input.Value())
+	if expr == "" {
+		expr = "."
+	}
+	resp, _ := m.maskedResponse()
+	results, err := applyFilter(expr, resp.body)
+	f.err = err
+	if err != nil {
+		return m
+	}
+	f.results = len(results)
+	m.viewport.SetContent(renderFilterResults(results))
+	m.viewport.GotoTop()
+	return m
+}
+
+// renderFilterResults shows the outputs of a filter one after the other
+func renderFilterResults(results []interface{}) string {
+	if len(results) == 0 {
+		return historyDimStyle.Render("No results")
+	}
+	parts := make([]string, len(results))
+	for i, r := range results {
+		data := marshalFilterResult(r)
+		if out, err := renderTypedJSON(data, jsonTypeAnnotations); err == nil {
+			parts[i] = out
+		} else {
+			parts[i] = string(data)
+		}
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// updateFilterREPL handles keys while the filter pane is open
+func (m model) updateFilterREPL(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	f := m.filterREPL
+	switch msg.Type {
+	case tea.KeyCtrlC:
+		return m, tea.Quit
+	case tea.KeyEsc, tea.KeyCtrlCloseBracket:
+		return m.closeFilterREPL(), nil
+	case tea.KeyEnter:
+		f.remember(strings.TrimSpace(f.input.Value()))
+		return m, nil
+	case tea.KeyCtrlS:
+		return m.promoteFilter(), nil
+	case tea.KeyUp, tea.KeyDown:
+		if msg.Type == tea.KeyUp && f.historyIdx > 0 {
+			if f.historyIdx == len(f.history) {
+				f.typed = f.input.Value()
+			}
+			f.historyIdx--
+			f.input.SetValue(f.history[f.historyIdx])
+		} else if msg.Type == tea.KeyDown && f.historyIdx < len(f.history) {
+			f.historyIdx++
+			if f.historyIdx == len(f.history) {
+				f.input.SetValue(f.typed)
+			} else {
+				f.input.SetValue(f.history[f.historyIdx])
+			}
+		} else {
+			return m, nil
+		}
+		f.input.CursorEnd()
+		return m.evaluateFilter(), nil
+	case tea.KeyPgUp, tea.KeyPgDown:
+		var cmd tea.Cmd
+		m.viewport, cmd = m.viewport.Update(msg)
+		return m, cmd
+	}
+	before := f.input.Value()
+	var cmd tea.Cmd
+	f.input, cmd = f.input.Update(msg)
+	if f.input.Value() != before {
+		f.historyIdx = len(f.history)
+		m = m.evaluateFilter()
+	}
+	return m, cmd
+}
+
+// remember adds an expression to the history, moving it to the end when
+// it's there already
+func (f *filterREPL) remember(expr string) {
+	if expr == "" || expr == "." {
+		return
+	}
+	history := make([]string, 0, len(f.history)+1)
+	for _, h := range f.history {
+		if h != expr {
+			history = append(history, h)
+		}
+	}
+	history = append(history, expr)
+	if len(history) > filterHistoryLimit {
+		history = history[len(history)-filterHistoryLimit:]
+	}
+	f.history, f.historyIdx = history, len(history)
+	// A history that can't be written just won't survive the session
+	saveFilterHistory(history)
+}
+
+// promoteFilter makes the expression typed the display filter of the
+// request, written back to its collection when it was run from one, and
+// closes the pane. An empty expression, or ., removes the filter.
+func (m model) promoteFilter() model {
+	f := m.filterREPL
+	expr := strings.TrimSpace(f.input.Value())
+	if expr == "." {
+		expr = ""
+	}
+	if expr != "" {
+		if _, err := compileFilter(expr); err != nil {
+			f.err = err
+			return m
+		}
+		f.remember(expr)
+	}
+	if m.draft == nil {
+		r := savedRequest{}.withLine(m.textInput.Value())
+		m.draft = &r
+	}
+	m.draft.Filter = expr
+	m.filter = expr
+
+	saved, err := saveDisplayFilter(*m.draft)
+	switch {
+	case err != nil:
+		m.notice = errorStyle.Render("Saving the display filter failed: " + err.Error())
+	case saved && expr == "":
+		m.notice = fmt.Sprintf("Display filter removed from %q", m.draft.Name)
+	case saved:
+		m.notice = fmt.Sprintf("Display filter saved to %q", m.draft.Name)
+	case expr == "":
+		m.notice = "Display filter removed"
+	default:
+		m.notice = "Display filter set, Ctrl+S saves it with the request"
+	}
+	m.response = m.renderLastResponse()
+	return m.closeFilterREPL()
+}
+
+// saveDisplayFilter writes the display filter of a request run from a
+// collection file back to it, reporting whether it did
+func saveDisplayFilter(r savedRequest) (bool, error) {
+	if r.file == "" {
+		return false, nil
+	}
+	if isRemoteWorkspace(currentWorkspace) {
+		return false, errReadOnlyWorkspace
+	}
+	c, err := loadCollection(r.file)
+	if err != nil {
+		return false, err
+	}
+	for i := range c.Requests {
+		if c.Requests[i].Name == r.Name && c.Requests[i].Folder == r.Folder {
+			c.Requests[i].Filter = r.Filter
+			return true, writeCollection(r.file, c)
+		}
+	}
+	return false, fmt.Errorf("%q is no longer in %s", r.Name, c.Name)
+}
+
+// displayedResponse is the last response as shown, through the display
+// filter of its request when it has one, with a line telling so
+func (m model) displayedResponse() (fetchMsg, string) {
+	resp, masked := m.maskedResponse()
+	if m.filter == "" {
+		return resp, masked
+	}
+	results, err := applyFilter(m.filter, resp.body)
+	if err != nil {
+		return resp, masked + errorStyle.Render(fmt.Sprintf("Display filter %s: %v", m.filter, err)) + "\n\n"
+	}
+	note := "Filtered by " + m.filter + " • " + describeResults(len(results))
+	if len(results) == 1 {
+		resp.body = marshalFilterResult(results[0])
+	} else {
+		if results == nil {
+			results = []interface{}{}
+		}
+		resp.body = marshalFilterResult(results)
+		note += " shown as an array"
+	}
+	return resp, masked + historyDimStyle.Render(note+" • Ctrl+]: Edit") + "\n\n"
+}
+
+func describeResults(n int) string {
+	if n == 1 {
+		return "1 result"
+	}
+	return fmt.Sprintf("%d results", n)
+}
+
+// filterREPLView draws the filter pane: the expression, how it fared and
+// the preview
+func (m model) filterREPLView() string {
+	f := m.filterREPL
+	status := historyDimStyle.Render(describeResults(f.results))
+	if f.err != nil {
+		status = errorStyle.Render(f.err.Error())
+	}
+	status += historyDimStyle.Render(" • Enter: Remember • ↑/↓: History • Ctrl+S: Save as display filter • Esc: Close")
+	return inputStyle.Render(f.input.View()) + "\n" + status + "\n\n" + m.viewport.View()
+}
+
+// loadFilterHistory reads the expressions entered in earlier sessions,
+// oldest first
+func loadFilterHistory() ([]string, error) {
+	if incognito {
+		return nil, nil
+	}
+	path, err := workspaceFile(filterHistoryFile)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var history []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var expr string
+		if json.Unmarshal(scanner.Bytes(), &expr) == nil {
+			history = append(history, expr)
+		}
+	}
+	return history, scanner.Err()
+}
+
+// saveFilterHistory rewrites the filter history; a no-op in incognito
+// sessions
+func saveFilterHistory(history []string) error {
+	if incognito {
+		return nil
+	}
+	path, err := workspaceFile(filterHistoryFile)
+	if err != nil {
+		return err
+	}
+	var buf []byte
+	for _, expr := range history {
+		data, err := json.Marshal(expr)
+		if err != nil {
+			return err
+		}
+		buf = append(append(buf, data...), '\n')
+	}
+	return os.WriteFile(path, buf, 0o600)
+}
@@ -0,0 +1,1253 @@
+package main
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/charmbracelet/bubbles/textarea"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// graphqlDir is where introspected schemas are cached inside the workspace
+// state directory
+const graphqlDir = "graphql"
+
+// introspectionTimeout bounds an introspection query
+const introspectionTimeout = 30 * time.Second
+
+// Rows given to the parts of the GraphQL editor
+const (
+	graphqlQueryHeight     = 10
+	graphqlVariablesHeight = 3
+	graphqlPanelHeight     = 6
+)
+
+// introspectionQuery asks the endpoint for its whole schema, deep enough
+// for types like [[Int!]!]!
+const introspectionQuery = `query IntrospectionQuery {
+  __schema {
+    queryType { name }
+    mutationType { name }
+    subscriptionType { name }
+    types {
+      kind
+      name
+      description
+      fields(includeDeprecated: true) {
+        name
+        description
+        args { name description type { ...TypeRef } defaultValue }
+        type { ...TypeRef }
+        isDeprecated
+      }
+      inputFields { name description type { ...TypeRef } defaultValue }
+      enumValues(includeDeprecated: true) { name }
+      possibleTypes { name }
+    }
+  }
+}
+
+fragment TypeRef on __Type {
+  kind
+  name
+  ofType { kind name ofType { kind name ofType { kind name ofType { kind name ofType { kind name ofType { kind name } } } } } }
+}`
+
+// gqlSchema is the schema of a GraphQL endpoint as introspection reports
+// it
+type gqlSchema struct {
+	QueryType        *gqlNamed  `json:"queryType"`
+	MutationType     *gqlNamed  `json:"mutationType"`
+	SubscriptionType *gqlNamed  `json:"subscriptionType"`
+	Types            []*gqlType `json:"types"`
+
+	byName map[string]*gqlType
+}
+
+type gqlNamed struct {
+	Name string `json:"name"`
+}
+
+type gqlType struct {
+	Kind          string          `json:"kind"`
+	Name          string          `json:"name"`
+	Description   string          `json:"description"`
+	Fields        []gqlField      `json:"fields"`
+	InputFields   []gqlInputValue `json:"inputFields"`
+	EnumValues    []gqlNamed      `json:"enumValues"`
+	PossibleTypes []gqlNamed      `json:"possibleTypes"`
+}
+
+type gqlField struct {
+	Name         string          `json:"name"`
+	Description  string          `json:"description"`
+	Args         []gqlInputValue `json:"args"`
+	Type         gqlTypeRef      `json:"type"`
+	IsDeprecated bool            `json:"isDeprecated"`
+}
+
+type gqlInputValue struct {
+	Name         string     `json:"name"`
+	Description  string     `json:"description"`
+	Type         gqlTypeRef `json:"type"`
+	DefaultValue *string    `json:"defaultValue"`
+}
+
+// gqlTypeRef is a possibly wrapped type, like [User!]!
+type gqlTypeRef struct {
+	Kind   string      `json:"kind"`
+	Name   string      `json:"name"`
+	OfType *gqlTypeRef `json:"ofType"`
+}
+
+func (t gqlTypeRef) String() string {
+	switch {
+	case t.OfType == nil:
+		return t.Name
+	case t.Kind == "NON_NULL":
+		return t.OfType.String() + "!"
+	case t.Kind == "LIST":
+		return "[" + t.OfType.String() + "]"
+	}
+	return t.OfType.String()
+}
+
+// named is the name of the type under the list and non-null wrappers
+func (t gqlTypeRef) named() string {
+	for t.OfType != nil {
+		t = *t.OfType
+	}
+	return t.Name
+}
+
+// parseSchema reads the data of an introspection response
+func parseSchema(data []byte) (*gqlSchema, error) {
+	var s gqlSchema
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, err
+	}
+	if len(s.Types) == 0 {
+		return nil, errors.New("the schema has no types")
+	}
+	s.byName = make(map[string]*gqlType, len(s.Types))
+	for _, t := range s.Types {
+		s.byName[t.Name] = t
+	}
+	return &s, nil
+}
+
+// root is the root type of an operation, nil when the schema has none
+func (s *gqlSchema) root(operation string) *gqlType {
+	var named *gqlNamed
+	switch operation {
+	case "query":
+		named = s.QueryType
+	case "mutation":
+		named = s.MutationType
+	case "subscription":
+		named = s.SubscriptionType
+	}
+	if named == nil {
+		return nil
+	}
+	return s.byName[named.Name]
+}
+
+func (t *gqlType) field(name string) *gqlField {
+	for i := range t.Fields {
+		if t.Fields[i].Name == name {
+			return &t.Fields[i]
+		}
+	}
+	return nil
+}
+
+// leaf reports whether values of the type are scalars, without fields to
+// select
+func (t *gqlType) leaf() bool {
+	return t.Kind == "SCALAR" || t.Kind == "ENUM"
+}
+
+func (f *gqlField) arg(name string) *gqlInputValue {
+	for i := range f.Args {
+		if f.Args[i].Name == name {
+			return &f.Args[i]
+		}
+	}
+	return nil
+}
+
+// signature shows a field as it's queried, e.g. user(id: ID!): User
+func (f *gqlField) signature() string {
+	var args []string
+	for _, a := range f.Args {
+		args = append(args, a.Name+": "+a.Type.String())
+	}
+	s := f.Name
+	if len(args) > 0 {
+		s += "(" + strings.Join(args, ", ") + ")"
+	}
+	return s + ": " + f.Type.String()
+}
+
+// cachedGraphQLSchema is a schema cached for an endpoint
+type cachedGraphQLSchema struct {
+	Endpoint string          `json:"endpoint"`
+	Fetched  time.Time       `json:"fetched"`
+	Schema   json.RawMessage `json:"schema"`
+}
+
+func graphqlSchemaFile(endpoint string) (string, error) {
+	dir := filepath.Join(workspaceStateDir(), graphqlDir)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", err
+	}
+	sum := sha1.Sum([]byte(endpoint))
+	return filepath.Join(dir, hex.EncodeToString(sum[:8])+".json"), nil
+}
+
+// loadGraphQLSchema reads the schema cached for endpoint, nil when there's
+// none
+func loadGraphQLSchema(endpoint string) (*gqlSchema, time.Time, error) {
+	path, err := graphqlSchemaFile(endpoint)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, time.Time{}, nil
+	}
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	var cached cachedGraphQLSchema
+	if err := json.Unmarshal(data, &cached); err != nil {
+		return nil, time.Time{}, fmt.Errorf("%s: %w", path, err)
+	}
+	s, err := parseSchema(cached.Schema)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return s, cached.Fetched, nil
+}
+
+// storeGraphQLSchema caches the schema of endpoint, unless the session is
+// incognito
+func storeGraphQLSchema(endpoint string, schema json.RawMessage, fetched time.Time) error {
+	if incognito {
+		return nil
+	}
+	path, err := graphqlSchemaFile(endpoint)
+	if err != nil {
+		return err
+	}
+	out, err := json.MarshalIndent(cachedGraphQLSchema{Endpoint: endpoint, Fetched: fetched, Schema: schema}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, out, 0o600)
+}
+
+// graphqlSchemaMsg delivers the result of an introspection query
+type graphqlSchemaMsg struct {
+	endpoint string
+	schema   *gqlSchema
+	fetched  time.Time
+	err      error
+}
+
+// readIntrospection reads the response to an introspection query and
+// caches the schema it holds
+func readIntrospection(endpoint string, resp fetchMsg) graphqlSchemaMsg {
+	msg := graphqlSchemaMsg{endpoint: endpoint, fetched: time.Now()}
+	if resp.err != nil {
+		msg.err = resp.err
+		return msg
+	}
+	var result struct {
+		Data struct {
+			Schema json.RawMessage `json:"__schema"`
+		} `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.Unmarshal(resp.body, &result); err != nil {
+		msg.err = fmt.Errorf("%s: the response isn't GraphQL: %w", resp.status, err)
+		return msg
+	}
+	if len(result.Data.Schema) == 0 || string(result.Data.Schema) == "null" {
+		if len(result.Errors) > 0 {
+			// Often introspection being disabled in production
+			msg.err = fmt.Errorf("introspection failed: %s", result.Errors[0].Message)
+		} else {
+			msg.err = fmt.Errorf("%s: no schema in the response", resp.status)
+		}
+		return msg
+	}
+	if msg.schema, msg.err = parseSchema(result.Data.Schema); msg.err != nil {
+		return msg
+	}
+	msg.err = storeGraphQLSchema(endpoint, result.Data.Schema, msg.fetched)
+	return msg
+}
+
+// gqlToken is a token of a GraphQL document. Commas, white space and
+// comments are left out, as GraphQL ignores them.
+type gqlToken struct {
+	kind      byte // 'n' name, 'p' punctuator, 'v' string or number
+	text      string
+	line, col int
+}
+
+// gqlTokens splits a GraphQL document into tokens. open is true when it
+// ends inside a string or comment.
+func gqlTokens(src string) (tokens []gqlToken, open bool) {
+	line, col := 1, 1
+	advance := func(s string) {
+		for _, r := range s {
+			if r == '\n' {
+				line, col = line+1, 1
+			} else {
+				col++
+			}
+		}
+	}
+	for i := 0; i < len(src); {
+		c := src[i]
+		start := i
+		startLine, startCol := line, col
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n' || c == ',':
+			i++
+		case c == '#':
+			end := strings.IndexByte(src[i:], '\n')
+			if end < 0 {
+				return tokens, true
+			}
+			i += end
+		case strings.HasPrefix(src[i:], `"""`):
+			end := strings.Index(src[i+3:], `"""`)
+			if end < 0 {
+				return tokens, true
+			}
+			i += end + 6
+			tokens = append(tokens, gqlToken{'v', src[start:i], startLine, startCol})
+		case c == '"':
+			i++
+			for i < len(src) && src[i] != '"' && src[i] != '\n' {
+				if src[i] == '\\' {
+					i++
+				}
+				i++
+			}
+			if i >= len(src) || src[i] != '"' {
+				return tokens, true
+			}
+			i++
+			tokens = append(tokens, gqlToken{'v', src[start:i], startLine, startCol})
+		case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+			for i < len(src) && isNameByte(src[i]) {
+				i++
+			}
+			tokens = append(tokens, gqlToken{'n', src[start:i], startLine, startCol})
+		case c == '-' || c >= '0' && c <= '9':
+			i++
+			for i < len(src) && (isNameByte(src[i]) || src[i] == '.' || src[i] == '+' || src[i] == '-') {
+				i++
+			}
+			tokens = append(tokens, gqlToken{'v', src[start:i], startLine, startCol})
+		case strings.HasPrefix(src[i:], "..."):
+			i += 3
+			tokens = append(tokens, gqlToken{'p', "...", startLine, startCol})
+		default:
+			_, size := utf8.DecodeRuneInString(src[i:])
+			i += size
+			tokens = append(tokens, gqlToken{'p', src[start:i], startLine, startCol})
+		}
+		advance(src[start:i])
+	}
+	return tokens, false
+}
+
+func isNameByte(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// gqlProblem is a mismatch between a query and the schema, at a line and
+// column of the query
+type gqlProblem struct {
+	line, col int
+	msg       string
+}
+
+// What can be typed where a document ends, for completion
+const (
+	gqlWantNothing = iota
+	gqlWantField
+	gqlWantArgument
+	gqlWantType
+	gqlWantValue
+)
+
+type gqlWant struct {
+	kind  int
+	typ   *gqlType       // whose fields can be selected
+	field *gqlField      // whose arguments can be given
+	arg   *gqlInputValue // whose value is given
+}
+
+// gqlParser walks a GraphQL document along the schema. It doesn't check
+// everything a server would, just what the schema tells: fields, arguments,
+// type conditions and selections of subfields. Types it doesn't know, like
+// those of fragment spreads, aren't checked further.
+type gqlParser struct {
+	schema   *gqlSchema
+	tokens   []gqlToken
+	pos      int
+	problems []gqlProblem
+	unclosed *gqlToken
+	want     gqlWant // at the end of the tokens
+
+	// stop is set where the tokens end inside a construct, so that what
+	// can be typed there is kept as the want
+	stop bool
+}
+
+func (p *gqlParser) peek() *gqlToken {
+	if p.pos >= len(p.tokens) {
+		return nil
+	}
+	return &p.tokens[p.pos]
+}
+
+func (p *gqlParser) next() *gqlToken {
+	t := p.peek()
+	if t != nil {
+		p.pos++
+	}
+	return t
+}
+
+func (p *gqlParser) is(text string) bool {
+	t := p.peek()
+	return t != nil && t.text == text
+}
+
+func (p *gqlParser) isName() bool {
+	t := p.peek()
+	return t != nil && t.kind == 'n'
+}
+
+func (p *gqlParser) problem(t *gqlToken, format string, args ...interface{}) {
+	p.problems = append(p.problems, gqlProblem{line: t.line, col: t.col, msg: fmt.Sprintf(format, args...)})
+}
+
+// atEnd reports whether the tokens ended, stopping the parser
+func (p *gqlParser) atEnd() bool {
+	if p.peek() == nil {
+		p.stop = true
+	}
+	return p.stop
+}
+
+func (p *gqlParser) document() {
+	for p.peek() != nil && !p.stop {
+		p.want = gqlWant{}
+		t := p.peek()
+		switch {
+		case t.text == "{":
+			p.selectionSet(p.schema.root("query"))
+		case t.text == "query" || t.text == "mutation" || t.text == "subscription":
+			p.next()
+			root := p.schema.root(t.text)
+			if root == nil {
+				p.problem(t, "The schema has no %s type", t.text)
+			}
+			if p.isName() {
+				p.next()
+			}
+			if p.is("(") {
+				p.skipBalanced("(", ")")
+			}
+			p.directives()
+			if p.is("{") {
+				p.selectionSet(root)
+			}
+		case t.text == "fragment":
+			p.next()
+			if p.isName() {
+				p.next()
+			}
+			if !p.is("on") {
+				continue
+			}
+			p.next()
+			typ := p.typeCondition()
+			p.directives()
+			if p.is("{") {
+				p.selectionSet(typ)
+			}
+		default:
+			p.problem(t, "Unexpected %q", t.text)
+			p.next()
+		}
+	}
+	switch {
+	case p.unclosed != nil:
+		p.problem(p.unclosed, "Unclosed {")
+	case p.stop && len(p.tokens) > 0:
+		p.problem(&p.tokens[len(p.tokens)-1], "The query ends early")
+	}
+}
+
+// typeCondition reads the type after "on", nil when unknown
+func (p *gqlParser) typeCondition() *gqlType {
+	p.want = gqlWant{kind: gqlWantType}
+	if p.atEnd() || !p.isName() {
+		return nil
+	}
+	t := p.next()
+	p.want = gqlWant{}
+	typ := p.schema.byName[t.text]
+	if typ == nil {
+		p.problem(t, "Unknown type %q%s", t.text, didYouMean(t.text, p.schema.compositeTypes()))
+	}
+	return typ
+}
+
+// selectionSet reads { ... } selecting fields of typ, which is nil when
+// unknown
+func (p *gqlParser) selectionSet(typ *gqlType) {
+	open := p.next()
+	for !p.stop {
+		p.want = gqlWant{kind: gqlWantField, typ: typ}
+		t := p.peek()
+		switch {
+		case p.atEnd():
+			if p.unclosed == nil {
+				p.unclosed = open
+			}
+			return
+		case t.text == "}":
+			p.next()
+			p.want = gqlWant{}
+			return
+		case t.text == "...":
+			p.next()
+			p.want = gqlWant{}
+			switch {
+			case p.atEnd():
+			case p.is("on"):
+				p.next()
+				cond := p.typeCondition()
+				p.directives()
+				if p.is("{") {
+					p.selectionSet(cond)
+				}
+			case p.is("{") || p.is("@"):
+				p.directives()
+				if p.is("{") {
+					p.selectionSet(typ)
+				}
+			case p.isName():
+				p.next()
+				p.directives()
+			}
+		case t.kind == 'n':
+			p.field(typ)
+		default:
+			p.problem(t, "Unexpected %q", t.text)
+			p.next()
+		}
+	}
+}
+
+// field reads a field of typ with its alias, arguments, directives and
+// subfields
+func (p *gqlParser) field(typ *gqlType) {
+	name := p.next()
+	if p.is(":") {
+		p.next()
+		if p.atEnd() || !p.isName() {
+			return
+		}
+		name = p.next()
+	}
+	p.want = gqlWant{}
+
+	var f *gqlField
+	meta := name.text == "__typename" || typ != nil && typ == p.schema.root("query") && (name.text == "__schema" || name.text == "__type")
+	if typ != nil && !meta {
+		if f = typ.field(name.text); f == nil {
+			var names []string
+			for _, field := range typ.Fields {
+				names = append(names, field.Name)
+			}
+			p.problem(name, "Cannot query field %q on type %q%s", name.text, typ.Name, didYouMean(name.text, names))
+		}
+	}
+	given := map[string]bool{}
+	if p.is("(") {
+		if given = p.arguments(f); p.stop {
+			return
+		}
+	}
+	if f != nil && p.peek() != nil {
+		for _, a := range f.Args {
+			if a.Type.Kind == "NON_NULL" && a.DefaultValue == nil && !given[a.Name] {
+				p.problem(name, "Field %q argument %q of type %q is required", f.Name, a.Name, a.Type)
+			}
+		}
+	}
+	p.directives()
+
+	var sub *gqlType
+	if f != nil {
+		sub = p.schema.byName[f.Type.named()]
+	}
+	switch {
+	case p.is("{"):
+		if sub != nil && sub.leaf() {
+			p.problem(name, "Field %q of type %q can't have a selection of subfields", name.text, f.Type)
+			sub = nil
+		}
+		p.selectionSet(sub)
+	case sub != nil && !sub.leaf() && p.peek() != nil:
+		p.problem(name, "Field %q of type %q needs a selection of subfields", name.text, f.Type)
+	}
+}
+
+// arguments reads (name: value, ...) of field f, nil when unknown, and
+// returns the names given
+func (p *gqlParser) arguments(f *gqlField) map[string]bool {
+	given := map[string]bool{}
+	p.next()
+	for {
+		p.want = gqlWant{kind: gqlWantArgument, field: f}
+		t := p.peek()
+		switch {
+		case p.atEnd():
+			return given
+		case t.text == ")":
+			p.next()
+			p.want = gqlWant{}
+			return given
+		case t.kind != 'n':
+			p.problem(t, "Unexpected %q", t.text)
+			p.next()
+			continue
+		}
+		p.next()
+		given[t.text] = true
+		var arg *gqlInputValue
+		if f != nil {
+			if arg = f.arg(t.text); arg == nil {
+				var names []string
+				for _, a := range f.Args {
+					names = append(names, a.Name)
+				}
+				p.problem(t, "Unknown argument %q on field %q%s", t.text, f.Name, didYouMean(t.text, names))
+			}
+		}
+		if !p.is(":") {
+			p.want = gqlWant{}
+			if p.atEnd() {
+				return given
+			}
+			p.problem(p.peek(), "Expected \":\" after argument %q", t.text)
+			continue
+		}
+		p.next()
+		p.want = gqlWant{kind: gqlWantValue, arg: arg}
+		if p.value(); p.stop {
+			return given
+		}
+	}
+}
+
+// value skips over an argument value
+func (p *gqlParser) value() {
+	switch {
+	case p.atEnd():
+	case p.is("$"):
+		p.next()
+		p.want = gqlWant{}
+		if !p.atEnd() && p.isName() {
+			p.next()
+		}
+	case p.is("["):
+		p.skipBalanced("[", "]")
+	case p.is("{"):
+		p.skipBalanced("{", "}")
+	default:
+		p.next()
+	}
+}
+
+// skipBalanced skips from open to its matching close
+func (p *gqlParser) skipBalanced(open, close string) {
+	p.want = gqlWant{}
+	depth := 0
+	for t := p.next(); t != nil; t = p.next() {
+		switch t.text {
+		case open:
+			depth++
+		case close:
+			depth--
+		}
+		if depth == 0 {
+			return
+		}
+	}
+	p.stop = true
+}
+
+func (p *gqlParser) directives() {
+	for p.is("@") {
+		p.next()
+		p.want = gqlWant{}
+		if p.atEnd() {
+			return
+		}
+		if p.isName() {
+			p.next()
+		}
+		if p.is("(") {
+			p.skipBalanced("(", ")")
+		}
+	}
+}
+
+// compositeTypes are the names of the types fields can be selected from
+func (s *gqlSchema) compositeTypes() []string {
+	var names []string
+	for _, t := range s.Types {
+		if (t.Kind == "OBJECT" || t.Kind == "INTERFACE" || t.Kind == "UNION") && !strings.HasPrefix(t.Name, "__") {
+			names = append(names, t.Name)
+		}
+	}
+	return names
+}
+
+// validate checks a query against the schema
+func (s *gqlSchema) validate(query string) []gqlProblem {
+	tokens, _ := gqlTokens(query)
+	p := &gqlParser{schema: s, tokens: tokens}
+	p.document()
+	return p.problems
+}
+
+// didYouMean suggests the name closest to a misspelt one, if any is close
+func didYouMean(name string, names []string) string {
+	best, bestDist := "", len(name)/3+2
+	for _, n := range names {
+		if d := editDistance(strings.ToLower(name), strings.ToLower(n)); d < bestDist {
+			best, bestDist = n, d
+		}
+	}
+	if best == "" {
+		return ""
+	}
+	return fmt.Sprintf(". Did you mean %q?", best)
+}
+
+// editDistance is the Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+// gqlCompletion is something that can be typed at the cursor
+type gqlCompletion struct {
+	name   string
+	insert string // typed after the name
+	detail string
+	doc    string
+}
+
+// complete lists what can be typed where before ends: the fields of the
+// selection set the cursor is in, the arguments of a field, types after
+// "on" and the values of enum arguments. prefix is the part of a name
+// typed so far, which the completions start with.
+func (s *gqlSchema) complete(before string) (prefix string, completions []gqlCompletion) {
+	i := len(before)
+	for i > 0 && isNameByte(before[i-1]) {
+		i--
+	}
+	prefix = before[i:]
+	if prefix != "" && prefix[0] >= '0' && prefix[0] <= '9' {
+		return "", nil
+	}
+	tokens, open := gqlTokens(before[:i])
+	if open {
+		return prefix, nil
+	}
+	p := &gqlParser{schema: s, tokens: tokens}
+	p.document()
+
+	add := func(c gqlCompletion) {
+		if strings.HasPrefix(strings.ToLower(c.name), strings.ToLower(prefix)) {
+			completions = append(completions, c)
+		}
+	}
+	switch w := p.want; w.kind {
+	case gqlWantField:
+		if w.typ == nil {
+			break
+		}
+		for i := range w.typ.Fields {
+			f := &w.typ.Fields[i]
+			c := gqlCompletion{name: f.Name, detail: f.signature(), doc: f.Description}
+			if f.IsDeprecated {
+				c.doc = "deprecated " + c.doc
+			}
+			add(c)
+		}
+		add(gqlCompletion{name: "__typename", detail: "__typename: String!"})
+	case gqlWantArgument:
+		if w.field == nil {
+			break
+		}
+		for _, a := range w.field.Args {
+			add(gqlCompletion{name: a.Name, insert: ": ", detail: a.Name + ": " + a.Type.String(), doc: a.Description})
+		}
+	case gqlWantType:
+		for _, name := range s.compositeTypes() {
+			add(gqlCompletion{name: name, detail: name, doc: s.byName[name].Description})
+		}
+	case gqlWantValue:
+		if w.arg == nil {
+			break
+		}
+		switch t := s.byName[w.arg.Type.named()]; {
+		case t != nil && t.Kind == "ENUM":
+			for _, v := range t.EnumValues {
+				add(gqlCompletion{name: v.Name, detail: v.Name})
+			}
+		case w.arg.Type.named() == "Boolean":
+			add(gqlCompletion{name: "true", detail: "true"})
+			add(gqlCompletion{name: "false", detail: "false"})
+		}
+	}
+	sort.SliceStable(completions, func(i, j int) bool {
+		// Meta fields last
+		if a, b := strings.HasPrefix(completions[i].name, "__"), strings.HasPrefix(completions[j].name, "__"); a != b {
+			return b
+		}
+		return completions[i].name < completions[j].name
+	})
+	return prefix, completions
+}
+
+// graphqlModel is the GraphQL editor: a query and its variables sent to the
+// endpoint on the input line, with the headers and auth of the draft, and
+// completed and checked against the schema the endpoint gives by
+// introspection
+type graphqlModel struct {
+	endpoint  string // with secrets masked, the key of the cached schema
+	query     textarea.Model
+	variables textarea.Model
+	schema    *gqlSchema
+	fetched   time.Time
+	loading   bool
+	err       error // of the last introspection
+
+	problems    []gqlProblem
+	prefix      string
+	completions []gqlCompletion
+	selected    int
+
+	sub *gqlSubscription // the last subscription run
+}
+
+func newGraphQLModel() graphqlModel {
+	query := textarea.New()
+	query.Placeholder = "{ viewer { id } }"
+	query.ShowLineNumbers = true
+	query.SetHeight(graphqlQueryHeight)
+	query.CharLimit = 0
+
+	variables := textarea.New()
+	variables.Placeholder = `{"id": "42"}`
+	variables.ShowLineNumbers = false
+	variables.SetHeight(graphqlVariablesHeight)
+	variables.CharLimit = 0
+
+	return graphqlModel{query: query, variables: variables}
+}
+
+// graphqlDraftQuery is the query and variables of a draft whose body is a
+// GraphQL request, like a saved one
+func graphqlDraftQuery(draft *savedRequest) (query, variables string, ok bool) {
+	if draft == nil {
+		return "", "", false
+	}
+	var body struct {
+		Query     *string         `json:"query"`
+		Variables json.RawMessage `json:"variables"`
+	}
+	if err := json.Unmarshal([]byte(draft.Body), &body); err != nil || body.Query == nil {
+		return "", "", false
+	}
+	if len(body.Variables) > 0 && string(body.Variables) != "null" {
+		variables = prettyJSON(string(body.Variables))
+	}
+	return *body.Query, variables, true
+}
+
+// prettyJSON indents JSON, leaving anything else as it is
+func prettyJSON(s string) string {
+	var v interface{}
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		return s
+	}
+	out, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return s
+	}
+	return string(out)
+}
+
+// graphqlBody is the JSON body of a GraphQL request. The variables are
+// spliced in as typed, so they can hold {{placeholders}} for numbers.
+func graphqlBody(query, variables string) string {
+	q, _ := json.Marshal(query)
+	body := `{"query": ` + string(q)
+	if v := strings.TrimSpace(variables); v != "" {
+		body += `, "variables": ` + v
+	}
+	return body + "}"
+}
+
+// graphqlRequest is the request line and draft turned into a GraphQL
+// request: a POST of the query and variables as JSON
+func (m model) graphqlRequest(query, variables string) savedRequest {
+	var r savedRequest
+	if m.draft != nil {
+		r = *m.draft
+	}
+	r = r.withLine(m.textInput.Value())
+	headers := make(map[string]string, len(r.Headers)+1)
+	for k, v := range r.Headers {
+		headers[k] = v
+	}
+	setHeaderFold(headers, "Content-Type", "application/json")
+	r.Method, r.Headers, r.Body, r.BodyFile = "POST", headers, graphqlBody(query, variables), ""
+	return r
+}
+
+// enterGraphQL opens the GraphQL editor for the endpoint on the input
+// line, with the schema cached for it or introspecting it otherwise
+func (m model) enterGraphQL() (model, tea.Cmd) {
+	line := m.textInput.Value()
+	if strings.TrimSpace(line) == "" {
+		m.notice = errorStyle.Render("Type the URL of the GraphQL endpoint first")
+		return m, nil
+	}
+	endpoint, _, _ := strings.Cut(m.resolveInput(line).display, "?")
+	g := &m.graphql
+	if g.endpoint != endpoint {
+		g.endpoint, g.schema, g.fetched, g.err, g.loading = endpoint, nil, time.Time{}, nil, false
+		if query, variables, ok := graphqlDraftQuery(m.draft); ok {
+			g.query.SetValue(query)
+			g.variables.SetValue(variables)
+		}
+		g.schema, g.fetched, g.err = loadGraphQLSchema(endpoint)
+	}
+
+	m.mode = modeGraphQL
+	m.textInput.Blur()
+	g.variables.Blur()
+	cmd := g.query.Focus()
+	m.response = "Send the query with Ctrl+S"
+	m.err = nil
+	m.suggestions = nil
+	m.viewport.SetContent(m.response)
+	m = m.layout()
+	m.graphql.analyze()
+	if m.graphql.schema == nil && m.graphql.err == nil && !m.graphql.loading {
+		var introspect tea.Cmd
+		m, introspect = m.introspect()
+		cmd = tea.Batch(cmd, introspect)
+	}
+	return m, cmd
+}
+
+// introspect asks the endpoint for its schema, with the headers and auth
+// of the draft
+func (m model) introspect() (model, tea.Cmd) {
+	r := resolveSavedRequest(m.graphqlRequest(introspectionQuery, ""), m.templateContext())
+	if len(r.missing) > 0 {
+		var names []string
+		for _, u := range r.missing {
+			names = append(names, "{{"+u.name+"}}")
+		}
+		m.graphql.err = fmt.Errorf("introspection not sent, unresolved placeholders: %s", strings.Join(names, ", "))
+		return m, nil
+	}
+	m.graphql.loading, m.graphql.err = true, nil
+	endpoint := m.graphql.endpoint
+	return m, func() tea.Msg {
+		ctx, cancel := context.WithTimeout(context.Background(), introspectionTimeout)
+		defer cancel()
+		stream := make(chan tea.Msg)
+		go streamFetch(ctx, r, stream)
+		// Progress is of no interest, only the complete response
+		for msg := range stream {
+			if resp, ok := msg.(fetchMsg); ok {
+				return readIntrospection(endpoint, resp)
+			}
+		}
+		return nil
+	}
+}
+
+// setSchema takes the result of an introspection query
+func (m model) setSchema(msg graphqlSchemaMsg) model {
+	g := &m.graphql
+	if msg.endpoint != g.endpoint {
+		return m
+	}
+	g.loading = false
+	if msg.schema == nil {
+		g.err = msg.err
+		return m
+	}
+	// A schema that couldn't be cached is still used
+	g.schema, g.fetched, g.err = msg.schema, msg.fetched, msg.err
+	g.analyze()
+	return m
+}
+
+// sendGraphQL sends the query like any other request, keeping it as the
+// draft so it can be saved
+func (m model) sendGraphQL() (model, tea.Cmd) {
+	variables := strings.TrimSpace(m.graphql.variables.Value())
+	if variables != "" && !strings.Contains(variables, "{{") && !json.Valid([]byte(variables)) {
+		m.err = errors.New("the variables aren't valid JSON")
+		return m, nil
+	}
+	if isSubscription(m.graphql.query.Value()) {
+		return m.subscribe()
+	}
+	r := m.graphqlRequest(m.graphql.query.Value(), variables)
+	line := r.requestLine()
+	m.draft = &r
+	m.textInput.SetValue(line)
+	m.textInput.CursorEnd()
+	retry := func(m model) (model, tea.Cmd) { return m.sendGraphQL() }
+	return m.send(resolveSavedRequest(r, m.templateContext()), line, retry)
+}
+
+// textBeforeCursor is the text of an editor up to its cursor
+func textBeforeCursor(t textarea.Model) string {
+	lines := strings.Split(t.Value(), "\n")
+	row := t.Line()
+	if row >= len(lines) {
+		return t.Value()
+	}
+	info := t.LineInfo()
+	line := []rune(lines[row])
+	col := min(info.StartColumn+info.ColumnOffset, len(line))
+	return strings.Join(append(lines[:row:row], string(line[:col])), "\n")
+}
+
+// analyze checks the query against the schema and lists the completions
+// at the cursor
+func (g *graphqlModel) analyze() {
+	g.problems, g.completions, g.prefix = nil, nil, ""
+	if g.schema == nil {
+		return
+	}
+	g.problems = g.schema.validate(g.query.Value())
+	if g.query.Focused() {
+		prefix := g.prefix
+		g.prefix, g.completions = g.schema.complete(textBeforeCursor(g.query))
+		if g.prefix != prefix || g.selected >= len(g.completions) {
+			g.selected = 0
+		}
+	}
+}
+
+// updateGraphQL handles input while the GraphQL editor is open
+func (m model) updateGraphQL(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	var cmd tea.Cmd
+	g := &m.graphql
+
+	if msg.String() == "alt+e" {
+		return m.jumpToGraphQLError(), nil
+	}
+	switch msg.Type {
+	case tea.KeyCtrlC:
+		if m.cancel != nil {
+			m.cancel()
+		}
+		return m, tea.Quit
+	case tea.KeyEsc, tea.KeyCtrlBackslash:
+		m.mode = modeHTTP
+		g.query.Blur()
+		g.variables.Blur()
+		m.textInput.Focus()
+		m.viewport.SetContent(m.response)
+		return m.layout(), nil
+	case tea.KeyCtrlS:
+		if m.fetching {
+			return m, nil
+		}
+		return m.sendGraphQL()
+	case tea.KeyCtrlR:
+		if g.loading {
+			return m, nil
+		}
+		return m.introspect()
+	case tea.KeyCtrlX:
+		if m.fetching && m.cancel != nil {
+			m.cancel()
+		}
+		return m, nil
+	case tea.KeyCtrlN, tea.KeyCtrlP:
+		if n := len(g.completions); n > 0 {
+			if msg.Type == tea.KeyCtrlN {
+				g.selected = (g.selected + 1) % n
+			} else {
+				g.selected = (g.selected + n - 1) % n
+			}
+		}
+		return m, nil
+	case tea.KeyTab:
+		if g.query.Focused() && len(g.completions) > 0 {
+			c := g.completions[g.selected]
+			g.query.InsertString(c.name[len(g.prefix):] + c.insert)
+			g.analyze()
+			return m, nil
+		}
+		fallthrough
+	case tea.KeyShiftTab:
+		if g.query.Focused() {
+			g.query.Blur()
+			cmd = g.variables.Focus()
+		} else {
+			g.variables.Blur()
+			cmd = g.query.Focus()
+		}
+		g.analyze()
+		return m, cmd
+	case tea.KeyPgUp, tea.KeyPgDown:
+		m.viewport, cmd = m.viewport.Update(msg)
+		return m, cmd
+	}
+
+	if g.query.Focused() {
+		g.query, cmd = g.query.Update(msg)
+		g.analyze()
+	} else {
+		g.variables, cmd = g.variables.Update(msg)
+	}
+	return m, cmd
+}
+
+var completionSelectedStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("#FFFFFF")).Background(lipgloss.Color("#336699"))
+
+// graphqlPanel lists the completions at the cursor while the query is
+// edited, and otherwise how the query doesn't match the schema
+func (g graphqlModel) graphqlPanel(width int) []string {
+	var lines []string
+	switch {
+	case g.schema == nil:
+	case g.query.Focused() && len(g.completions) > 0:
+		lines = append(lines, historyDimStyle.Render(truncate(fmt.Sprintf("%d completions • Tab: Insert • Ctrl+N/Ctrl+P: Choose", len(g.completions)), width)))
+		rows := graphqlPanelHeight - 1
+		first := min(max(g.selected-rows/2, 0), max(len(g.completions)-rows, 0))
+		for i := first; i < min(first+rows, len(g.completions)); i++ {
+			c := g.completions[i]
+			text := c.detail
+			if c.doc != "" {
+				text += " — " + strings.Join(strings.Fields(c.doc), " ")
+			}
+			text = truncate(text, width-2)
+			if i == g.selected {
+				lines = append(lines, completionSelectedStyle.Render("› "+text))
+			} else {
+				lines = append(lines, "  "+text)
+			}
+		}
+	case len(g.problems) > 0:
+		lines = append(lines, errorStyle.Render(fmt.Sprintf("%d problem(s) against the schema", len(g.problems))))
+		for i, p := range g.problems {
+			if i == graphqlPanelHeight-2 && len(g.problems) > graphqlPanelHeight-1 {
+				lines = append(lines, historyDimStyle.Render(fmt.Sprintf("  and %d more", len(g.problems)-i)))
+				break
+			}
+			lines = append(lines, truncate(fmt.Sprintf("  %d:%d %s", p.line, p.col, p.msg), width))
+		}
+	case strings.TrimSpace(g.query.Value()) != "":
+		lines = append(lines, lipgloss.NewStyle().Foreground(lipgloss.Color("#98C379")).Render("✓ The query matches the schema"))
+	}
+	for len(lines) < graphqlPanelHeight {
+		lines = append(lines, "")
+	}
+	return lines
+}
+
+func (m model) graphqlView() string {
+	g := m.graphql
+	width := m.width - padding*4
+
+	var status string
+	switch {
+	case g.loading:
+		status = lipgloss.NewStyle().Foreground(lipgloss.Color("#FFCC00")).Render("Introspecting the schema...")
+	case g.schema != nil:
+		status = fmt.Sprintf("%s %d types, fetched %s • Ctrl+R: Refresh", headerStyle.Render("Schema:"),
+			len(g.schema.Types), g.fetched.Local().Format("Jan 2 15:04"))
+		if g.err != nil {
+			status += " " + errorStyle.Render(g.err.Error())
+		}
+	case g.err != nil:
+		status = errorStyle.Render("Schema: "+g.err.Error()) + historyDimStyle.Render(" • Ctrl+R: Retry")
+	default:
+		status = headerStyle.Render("Schema:") + " none, Ctrl+R introspects the endpoint"
+	}
+
+	var responseView string
+	switch {
+	case m.varPrompt != nil:
+		responseView = renderVarPrompt(m.varPrompt)
+	case m.err != nil:
+		responseView = errorStyle.Render(fmt.Sprintf("Error: %v", m.err))
+	default:
+		responseView = m.viewport.View()
+	}
+
+	return fmt.Sprintf("%s\n%s\n\n%s\n%s\n%s\n\n%s\n\n%s",
+		inputStyle.Render(headerStyle.Render("Endpoint: ")+truncate(g.endpoint, width-len("Endpoint: "))), status,
+		g.query.View(), headerStyle.Render("Variables"), g.variables.View(),
+		strings.Join(g.graphqlPanel(width), "\n"), responseView)
+}
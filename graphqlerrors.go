@@ -0,0 +1,272 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+)
+
+// graphqlJumpContext is how many lines are kept above the line an error
+// jump lands on
+const graphqlJumpContext = 3
+
+var graphqlTargetStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("#FFFFFF")).Background(lipgloss.Color("#8B2E2E"))
+
+// graphqlError is an entry of the errors array of a GraphQL response
+type graphqlError struct {
+	message   string
+	path      []interface{} // field names and list indexes into data
+	locations []string      // line:column in the query
+	code      string        // extensions.code, as Apollo and others set it
+}
+
+// parseGraphQLErrors reads the errors of a GraphQL response along with
+// its data; ok is false for bodies that aren't one, or have no errors
+func parseGraphQLErrors(body []byte) (errs []graphqlError, data interface{}, ok bool) {
+	var resp struct {
+		Data   interface{} `json:"data"`
+		Errors []struct {
+			Message   string        `json:"message"`
+			Path      []interface{} `json:"path"`
+			Locations []struct {
+				Line   int `json:"line"`
+				Column int `json:"column"`
+			} `json:"locations"`
+			Extensions struct {
+				Code interface{} `json:"code"`
+			} `json:"extensions"`
+		} `json:"errors"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil || len(resp.Errors) == 0 {
+		return nil, nil, false
+	}
+	for _, e := range resp.Errors {
+		if e.Message == "" {
+			// Not GraphQL errors, which always have a message
+			return nil, nil, false
+		}
+		ge := graphqlError{message: e.Message}
+		for _, seg := range e.Path {
+			// Indexes come in as float64
+			if n, isNum := seg.(float64); isNum {
+				seg = int(n)
+			}
+			ge.path = append(ge.path, seg)
+		}
+		for _, l := range e.Locations {
+			ge.locations = append(ge.locations, fmt.Sprintf("%d:%d", l.Line, l.Column))
+		}
+		if e.Extensions.Code != nil {
+			ge.code = fmt.Sprint(e.Extensions.Code)
+		}
+		errs = append(errs, ge)
+	}
+	return errs, resp.Data, true
+}
+
+// formatGraphQLPath writes a path the way it reads in code:
+// user.posts[2].title
+func formatGraphQLPath(path []interface{}) string {
+	var sb strings.Builder
+	for _, seg := range path {
+		switch s := seg.(type) {
+		case int:
+			fmt.Fprintf(&sb, "[%d]", s)
+		default:
+			if sb.Len() > 0 {
+				sb.WriteString(".")
+			}
+			fmt.Fprint(&sb, s)
+		}
+	}
+	return sb.String()
+}
+
+// resolveGraphQLPath follows a path into data, returning how many of its
+// steps exist and the value at the last of them
+func resolveGraphQLPath(data interface{}, path []interface{}) (int, interface{}) {
+	v := data
+	for i, seg := range path {
+		switch s := seg.(type) {
+		case string:
+			obj, ok := v.(map[string]interface{})
+			if !ok {
+				return i, v
+			}
+			next, ok := obj[s]
+			if !ok {
+				return i, v
+			}
+			v = next
+		case int:
+			arr, ok := v.([]interface{})
+			if !ok || s < 0 || s >= len(arr) {
+				return i, v
+			}
+			v = arr[s]
+		default:
+			return i, v
+		}
+	}
+	return len(path), v
+}
+
+// describeGraphQLPath says what the data holds where an error points.
+// Errors null their field, and a non-null field passes the null up to its
+// parent, so the path often ends above the field.
+func describeGraphQLPath(data interface{}, path []interface{}) string {
+	if len(path) == 0 {
+		return "no path, the error concerns the whole request"
+	}
+	if data == nil {
+		return "the data is null, nothing was resolved"
+	}
+	found, v := resolveGraphQLPath(data, path)
+	if found == len(path) {
+		return "→ " + truncate(string(marshalFilterResult(v)), 60)
+	}
+	if found == 0 {
+		return "not in the data"
+	}
+	at := formatGraphQLPath(path[:found])
+	if v == nil {
+		return "not in the data, the null went up to " + at
+	}
+	return "not in the data, which stops at " + at
+}
+
+// renderGraphQLErrors lists the errors of a GraphQL response above it,
+// each with what the data holds at its path
+func renderGraphQLErrors(body []byte) string {
+	errs, data, ok := parseGraphQLErrors(body)
+	if !ok {
+		return ""
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s %s%s\n", headerStyle.Render("GraphQL errors:"),
+		errorStyle.Render(strconv.Itoa(len(errs))),
+		historyDimStyle.Render(" • Alt+E: Jump to each in the data"))
+	for i, e := range errs {
+		fmt.Fprintf(&sb, "  %d. %s\n", i+1, errorStyle.Render(e.message))
+		if len(e.path) > 0 {
+			fmt.Fprintf(&sb, "     %s %s\n", formatGraphQLPath(e.path), historyDimStyle.Render(describeGraphQLPath(data, e.path)))
+		} else {
+			fmt.Fprintf(&sb, "     %s\n", historyDimStyle.Render(describeGraphQLPath(data, e.path)))
+		}
+		var details []string
+		if len(e.locations) > 0 {
+			details = append(details, "query "+strings.Join(e.locations, ", "))
+		}
+		if e.code != "" {
+			details = append(details, "code "+e.code)
+		}
+		if len(details) > 0 {
+			fmt.Fprintf(&sb, "     %s\n", historyDimStyle.Render(strings.Join(details, " • ")))
+		}
+	}
+	sb.WriteString("\n")
+	return sb.String()
+}
+
+// locateJSONPath finds the line of the value at path in a JSON body as
+// the response view prints it, two spaces per level. It returns the line
+// of the deepest step found and how many steps that is, -1 when the view
+// holds no JSON object.
+func locateJSONPath(lines []string, path []interface{}) (int, int) {
+	cur := -1
+	for i, l := range lines {
+		if strings.TrimSpace(l) == "{" {
+			cur = i
+			break
+		}
+	}
+	if cur < 0 {
+		return -1, 0
+	}
+	for depth, seg := range path {
+		indent := strings.Repeat("  ", depth+1)
+		next, index := -1, 0
+		for i := cur + 1; i < len(lines) && next < 0; i++ {
+			l := lines[i]
+			if strings.TrimSpace(l) == "" {
+				continue
+			}
+			if !strings.HasPrefix(l, indent) {
+				// Back at the closing bracket
+				break
+			}
+			rest := l[len(indent):]
+			if strings.HasPrefix(rest, " ") || strings.HasPrefix(rest, "//") {
+				continue
+			}
+			switch s := seg.(type) {
+			case string:
+				if strings.HasPrefix(rest, strconv.Quote(s)+": ") {
+					next = i
+				}
+			case int:
+				var skipped int
+				switch {
+				case strings.HasPrefix(rest, "}"), strings.HasPrefix(rest, "]"):
+				case strings.HasPrefix(rest, "…"):
+					// Elements left out of a sampled array
+					if _, err := fmt.Sscanf(rest, "… %d more …", &skipped); err == nil {
+						index += skipped
+					}
+				case index == s:
+					next = i
+				default:
+					index++
+				}
+			}
+		}
+		if next < 0 {
+			return cur, depth
+		}
+		cur = next
+	}
+	return cur, len(path)
+}
+
+// jumpToGraphQLError scrolls the response to where the next GraphQL error
+// points in the data, or as close as the data goes
+func (m model) jumpToGraphQLError() model {
+	if m.lastResponse == nil || m.err != nil || m.fetching || m.showTiming || m.dns.open {
+		return m
+	}
+	resp, _ := m.maskedResponse()
+	errs, _, ok := parseGraphQLErrors(resp.body)
+	if !ok {
+		m.notice = "No GraphQL errors in the response"
+		return m
+	}
+	i := m.graphqlJump % len(errs)
+	m.graphqlJump++
+	e := errs[i]
+	notice := fmt.Sprintf("GraphQL error %d/%d: %s", i+1, len(errs), e.message)
+	path := append([]interface{}{"data"}, e.path...)
+	lines := strings.Split(m.response, "\n")
+	line, found := locateJSONPath(strings.Split(ansi.Strip(m.response), "\n"), path)
+	switch {
+	case len(e.path) == 0:
+		notice += " • no path to jump to"
+	case line < 0:
+		notice += " • the response view shows no JSON to jump in"
+	default:
+		if found == len(path) {
+			notice += " • at " + formatGraphQLPath(e.path)
+		} else {
+			notice += " • " + formatGraphQLPath(e.path) + " isn't in the data, shown where it stops"
+		}
+		// The line is marked until the response is drawn again
+		lines[line] = graphqlTargetStyle.Render(ansi.Strip(lines[line]))
+		m.viewport.SetContent(strings.Join(lines, "\n"))
+		m.viewport.SetYOffset(max(line-graphqlJumpContext, 0))
+	}
+	m.notice = notice
+	return m
+}
@@ -0,0 +1,548 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/http2"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// gRPC is spoken directly over HTTP/2: a POST to /package.Service/Method
+// whose body is a sequence of messages, each prefixed with a compression
+// flag and its length, and whose status comes back in the trailers.
+
+// maxGRPCMessage bounds the size of a message received
+const maxGRPCMessage = 64 << 20
+
+// reflectionTimeout bounds the calls listing the services of a server
+const reflectionTimeout = 30 * time.Second
+
+// grpcCodes names the gRPC status codes
+var grpcCodes = []string{
+	"OK", "CANCELLED", "UNKNOWN", "INVALID_ARGUMENT", "DEADLINE_EXCEEDED",
+	"NOT_FOUND", "ALREADY_EXISTS", "PERMISSION_DENIED", "RESOURCE_EXHAUSTED",
+	"FAILED_PRECONDITION", "ABORTED", "OUT_OF_RANGE", "UNIMPLEMENTED",
+	"INTERNAL", "UNAVAILABLE", "DATA_LOSS", "UNAUTHENTICATED",
+}
+
+const grpcUnimplemented = 12
+
+// grpcStatus is how a call ended
+type grpcStatus struct {
+	code    int
+	message string
+}
+
+func (s grpcStatus) name() string {
+	if s.code >= 0 && s.code < len(grpcCodes) {
+		return grpcCodes[s.code]
+	}
+	return "CODE " + strconv.Itoa(s.code)
+}
+
+func (s grpcStatus) Error() string {
+	if s.message == "" {
+		return s.name()
+	}
+	return s.name() + ": " + s.message
+}
+
+// grpcTarget is the base URL of a gRPC server given as host:port,
+// grpc://host:port for plaintext or grpcs://host:port for TLS. Servers
+// given without a scheme are reached over TLS unless they're local, see
+// resolveGRPCTarget.
+func grpcTarget(line string) string {
+	line = strings.TrimSpace(line)
+	if rest, ok := strings.CutPrefix(line, "grpc://"); ok {
+		return "http://" + strings.TrimSuffix(rest, "/")
+	}
+	if rest, ok := strings.CutPrefix(line, "grpcs://"); ok {
+		return "https://" + strings.TrimSuffix(rest, "/")
+	}
+	return strings.TrimSuffix(line, "/")
+}
+
+// isGRPCLine reports whether an input line names a gRPC server
+func isGRPCLine(line string) bool {
+	line = strings.TrimSpace(line)
+	return strings.HasPrefix(line, "grpc://") || strings.HasPrefix(line, "grpcs://")
+}
+
+// resolveGRPCTarget picks plaintext for a server given without a scheme
+// that runs locally, as development servers rarely have certificates.
+// withScheme has defaulted the URL of the others to TLS.
+func resolveGRPCTarget(raw, resolved string) string {
+	if strings.Contains(raw, "://") {
+		return resolved
+	}
+	u, err := url.Parse(resolved)
+	if err != nil {
+		return resolved
+	}
+	host := u.Hostname()
+	if ip := net.ParseIP(host); host == "localhost" || (ip != nil && ip.IsLoopback()) {
+		u.Scheme = "http"
+	}
+	return u.String()
+}
+
+// grpcTransports reach servers over TLS, and in plaintext with prior
+// knowledge of HTTP/2 (h2c)
+var (
+	grpcTLSTransport = &http2.Transport{
+		DialTLSContext: func(ctx context.Context, network, addr string, cfg *tls.Config) (net.Conn, error) {
+			d := tls.Dialer{NetDialer: &net.Dialer{Resolver: customResolver}, Config: withTLSSettings(cfg)}
+			return d.DialContext(ctx, network, addr)
+		},
+	}
+	grpcPlainTransport = &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			d := net.Dialer{Resolver: customResolver}
+			return d.DialContext(ctx, network, addr)
+		},
+	}
+)
+
+// grpcProtocol is the protocol calls are made with: gRPC itself, or
+// gRPC-Web and Connect, which browser-facing backends serve over plain
+// HTTP(S), see grpcweb.go
+type grpcProtocol int
+
+const (
+	protocolGRPC grpcProtocol = iota
+	protocolGRPCWeb
+	protocolConnect
+)
+
+var grpcProtocolNames = []string{"gRPC", "gRPC-Web", "Connect"}
+
+func (p grpcProtocol) String() string {
+	return grpcProtocolNames[p]
+}
+
+// grpcResult is what a call got besides its messages
+type grpcResult struct {
+	header  http.Header
+	trailer http.Header
+	status  grpcStatus
+}
+
+// grpcFrame prefixes an encoded message for the wire
+func grpcFrame(msg []byte) []byte {
+	frame := make([]byte, 5, 5+len(msg))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(msg)))
+	return append(frame, msg...)
+}
+
+// grpcCall calls the method at path, like /shop.Orders/Get, of the server
+// at base with protocol p, sending the metadata and the encoded requests
+// and handing the response messages to receive as they arrive. streaming
+// tells whether the method streams either way. A call the server ended
+// with an error status still returns a result; the error is for calls
+// that didn't get that far.
+func grpcCall(ctx context.Context, p grpcProtocol, base, path string, metadata map[string]string, requests [][]byte, streaming bool, receive func([]byte)) (grpcResult, error) {
+	switch p {
+	case protocolGRPCWeb:
+		return grpcWebCall(ctx, base, path, metadata, requests, receive)
+	case protocolConnect:
+		return connectCall(ctx, base, path, metadata, requests, streaming, receive)
+	}
+	var body bytes.Buffer
+	for _, r := range requests {
+		body.Write(grpcFrame(r))
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, base+path, &body)
+	if err != nil {
+		return grpcResult{}, err
+	}
+	req.Header.Set("Content-Type", "application/grpc+proto")
+	req.Header.Set("TE", "trailers")
+	req.Header.Set("User-Agent", "lazyhttp-grpc")
+	req.Header.Set("Grpc-Accept-Encoding", "gzip")
+	for k, v := range metadata {
+		req.Header.Set(k, v)
+	}
+
+	transport := grpcTLSTransport
+	if req.URL.Scheme == "http" {
+		transport = grpcPlainTransport
+	}
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		return grpcResult{}, err
+	}
+	defer resp.Body.Close()
+	result := grpcResult{header: resp.Header, trailer: resp.Trailer}
+
+	// A call failing straight away has its status in the headers
+	if code := resp.Header.Get("Grpc-Status"); code != "" {
+		result.status = parseGRPCStatus(resp.Header)
+		return result, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return result, fmt.Errorf("the server answered %s, not a gRPC response", resp.Status)
+	}
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "application/grpc") {
+		return result, fmt.Errorf("the server answered with %q, not a gRPC response", ct)
+	}
+
+	for {
+		flags, msg, err := readGRPCFrame(resp.Body)
+		if err == io.EOF {
+			break
+		}
+		if err == nil && flags&1 != 0 {
+			msg, err = decompressGRPC(msg, resp.Header.Get("Grpc-Encoding"))
+		}
+		if err != nil {
+			return result, err
+		}
+		receive(msg)
+	}
+	if resp.Trailer.Get("Grpc-Status") == "" {
+		return result, errors.New("the server ended the call without a status")
+	}
+	result.status = parseGRPCStatus(resp.Trailer)
+	return result, nil
+}
+
+// readGRPCFrame reads the next frame of a response body, its flags and
+// message, io.EOF meaning there are no more
+func readGRPCFrame(r io.Reader) (byte, []byte, error) {
+	var prefix [5]byte
+	if _, err := io.ReadFull(r, prefix[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return 0, nil, errors.New("the response ended inside a message")
+		}
+		return 0, nil, err
+	}
+	size := binary.BigEndian.Uint32(prefix[1:])
+	if size > maxGRPCMessage {
+		return 0, nil, fmt.Errorf("a message of %s is over the limit of %s", formatBytes(int64(size)), formatBytes(maxGRPCMessage))
+	}
+	msg := make([]byte, size)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return 0, nil, fmt.Errorf("the response ended inside a message: %w", err)
+	}
+	return prefix[0], msg, nil
+}
+
+// decompressGRPC inflates a message the server compressed
+func decompressGRPC(msg []byte, encoding string) ([]byte, error) {
+	if encoding != "gzip" {
+		return nil, fmt.Errorf("a message is compressed with %q, which isn't supported", encoding)
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(msg))
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(io.LimitReader(zr, maxGRPCMessage))
+}
+
+// parseGRPCStatus reads the status of a call from its trailers
+func parseGRPCStatus(h http.Header) grpcStatus {
+	code, err := strconv.Atoi(h.Get("Grpc-Status"))
+	if err != nil {
+		return grpcStatus{code: 2, message: "invalid grpc-status " + strconv.Quote(h.Get("Grpc-Status"))}
+	}
+	message := h.Get("Grpc-Message")
+	if unescaped, err := url.PathUnescape(message); err == nil {
+		message = unescaped
+	}
+	return grpcStatus{code: code, message: message}
+}
+
+// The server reflection services, the current one first; servers built
+// with older libraries only have the alpha one
+var reflectionMethods = []string{
+	"/grpc.reflection.v1.ServerReflection/ServerReflectionInfo",
+	"/grpc.reflection.v1alpha.ServerReflection/ServerReflectionInfo",
+}
+
+// Fields of ServerReflectionRequest and ServerReflectionResponse used
+const (
+	reflectFileByFilename       protowire.Number = 3
+	reflectFileContainingSymbol protowire.Number = 4
+	reflectListServices         protowire.Number = 7
+
+	reflectFileDescriptorResponse protowire.Number = 4
+	reflectListServicesResponse   protowire.Number = 6
+	reflectErrorResponse          protowire.Number = 7
+)
+
+// wireField is a field of an encoded message, its value kept for the
+// length-delimited and varint types
+type wireField struct {
+	num    protowire.Number
+	bytes  []byte
+	varint uint64
+}
+
+// wireFields decodes the fields of a message without its descriptor, as
+// the reflection messages aren't among the types linked in
+func wireFields(b []byte) ([]wireField, error) {
+	var fields []wireField
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		b = b[n:]
+		f := wireField{num: num}
+		switch typ {
+		case protowire.BytesType:
+			f.bytes, n = protowire.ConsumeBytes(b)
+		case protowire.VarintType:
+			f.varint, n = protowire.ConsumeVarint(b)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		b = b[n:]
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+// reflectionRequest encodes a ServerReflectionRequest asking one thing
+func reflectionRequest(field protowire.Number, value string) []byte {
+	b := protowire.AppendTag(nil, field, protowire.BytesType)
+	return protowire.AppendString(b, value)
+}
+
+// reflectionResponse is what a ServerReflectionResponse holds of interest
+type reflectionResponse struct {
+	services []string
+	files    [][]byte
+	err      error
+}
+
+func parseReflectionResponse(b []byte) (reflectionResponse, error) {
+	var r reflectionResponse
+	fields, err := wireFields(b)
+	if err != nil {
+		return r, err
+	}
+	for _, f := range fields {
+		inner, err := wireFields(f.bytes)
+		if err != nil {
+			return r, err
+		}
+		switch f.num {
+		case reflectFileDescriptorResponse:
+			for _, g := range inner {
+				if g.num == 1 {
+					r.files = append(r.files, g.bytes)
+				}
+			}
+		case reflectListServicesResponse:
+			for _, g := range inner {
+				service, err := wireFields(g.bytes)
+				if err != nil {
+					return r, err
+				}
+				for _, s := range service {
+					if s.num == 1 {
+						r.services = append(r.services, string(s.bytes))
+					}
+				}
+			}
+		case reflectErrorResponse:
+			status := grpcStatus{code: 2}
+			for _, g := range inner {
+				switch g.num {
+				case 1:
+					status.code = int(int32(g.varint))
+				case 2:
+					status.message = string(g.bytes)
+				}
+			}
+			r.err = status
+		}
+	}
+	return r, nil
+}
+
+// reflectServices lists the services of the server at base and loads the
+// files describing them, through whichever reflection service it has.
+// gRPC-Web has no client streaming, so over it, and Connect, each request
+// goes in a call of its own.
+func reflectServices(ctx context.Context, p grpcProtocol, base string, metadata map[string]string) (*protoregistry.Files, []string, error) {
+	var status grpcStatus
+	for _, method := range reflectionMethods {
+		call := func(requests [][]byte) ([]reflectionResponse, error) {
+			var responses []reflectionResponse
+			var parseErr error
+			result, err := grpcCall(ctx, p, base, method, metadata, requests, true, func(msg []byte) {
+				r, err := parseReflectionResponse(msg)
+				if err != nil && parseErr == nil {
+					parseErr = err
+				}
+				responses = append(responses, r)
+			})
+			switch {
+			case err != nil:
+				return nil, err
+			case result.status.code != 0:
+				return nil, result.status
+			}
+			return responses, parseErr
+		}
+		ask := call
+		if p != protocolGRPC {
+			ask = func(requests [][]byte) ([]reflectionResponse, error) {
+				var responses []reflectionResponse
+				for _, r := range requests {
+					got, err := call([][]byte{r})
+					if err != nil {
+						return nil, err
+					}
+					responses = append(responses, got...)
+				}
+				return responses, nil
+			}
+		}
+
+		responses, err := ask([][]byte{reflectionRequest(reflectListServices, "*")})
+		if errors.As(err, &status) && status.code == grpcUnimplemented {
+			continue
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("listing the services: %w", err)
+		}
+		var services []string
+		for _, r := range responses {
+			if r.err != nil {
+				return nil, nil, fmt.Errorf("listing the services: %w", r.err)
+			}
+			for _, s := range r.services {
+				// Reflection itself is of no interest to call
+				if !strings.HasPrefix(s, "grpc.reflection.") {
+					services = append(services, s)
+				}
+			}
+		}
+		sort.Strings(services)
+
+		files, err := reflectFiles(ask, services)
+		return files, services, err
+	}
+	return nil, nil, fmt.Errorf("the server has no reflection service (%v); start with -proto to describe its services", status)
+}
+
+// reflectFiles asks for the files defining the services, then for the
+// files they import until none is missing
+func reflectFiles(ask func([][]byte) ([]reflectionResponse, error), services []string) (*protoregistry.Files, error) {
+	files := map[string]*descriptorpb.FileDescriptorProto{}
+	add := func(responses []reflectionResponse) error {
+		for _, r := range responses {
+			if r.err != nil {
+				return r.err
+			}
+			for _, data := range r.files {
+				fd := &descriptorpb.FileDescriptorProto{}
+				if err := proto.Unmarshal(data, fd); err != nil {
+					return fmt.Errorf("decoding a file descriptor: %w", err)
+				}
+				files[fd.GetName()] = fd
+			}
+		}
+		return nil
+	}
+
+	var requests [][]byte
+	for _, s := range services {
+		requests = append(requests, reflectionRequest(reflectFileContainingSymbol, s))
+	}
+	for len(requests) > 0 {
+		responses, err := ask(requests)
+		if err != nil {
+			return nil, fmt.Errorf("loading the service descriptors: %w", err)
+		}
+		if err := add(responses); err != nil {
+			return nil, fmt.Errorf("loading the service descriptors: %w", err)
+		}
+		requests = nil
+		for _, name := range sortedKeys(files) {
+			for _, dep := range files[name].GetDependency() {
+				if _, ok := files[dep]; ok {
+					continue
+				}
+				// The well-known types linked in stand in for those the
+				// server doesn't send
+				if known, err := protoregistry.GlobalFiles.FindFileByPath(dep); err == nil {
+					files[dep] = protodesc.ToFileDescriptorProto(known)
+					continue
+				}
+				requests = append(requests, reflectionRequest(reflectFileByFilename, dep))
+				// Marks it asked for, so it's asked for once
+				files[dep] = nil
+			}
+		}
+	}
+
+	set := &descriptorpb.FileDescriptorSet{}
+	for _, name := range sortedKeys(files) {
+		if files[name] == nil {
+			return nil, fmt.Errorf("the server didn't send %s", name)
+		}
+		set.File = append(set.File, files[name])
+	}
+	return protodesc.NewFiles(set)
+}
+
+// grpcMethods lists the methods of the services, or of every service of
+// the files when services is nil
+func grpcMethods(files *protoregistry.Files, services []string) []protoreflect.MethodDescriptor {
+	var methods []protoreflect.MethodDescriptor
+	add := func(sd protoreflect.ServiceDescriptor) {
+		for i := 0; i < sd.Methods().Len(); i++ {
+			methods = append(methods, sd.Methods().Get(i))
+		}
+	}
+	if services == nil {
+		files.RangeFiles(func(fd protoreflect.FileDescriptor) bool {
+			for i := 0; i < fd.Services().Len(); i++ {
+				add(fd.Services().Get(i))
+			}
+			return true
+		})
+	} else {
+		for _, name := range services {
+			if d, err := files.FindDescriptorByName(protoreflect.FullName(name)); err == nil {
+				if sd, ok := d.(protoreflect.ServiceDescriptor); ok {
+					add(sd)
+				}
+			}
+		}
+	}
+	sort.Slice(methods, func(i, j int) bool { return methods[i].FullName() < methods[j].FullName() })
+	return methods
+}
+
+// grpcPath is the HTTP/2 path calling a method
+func grpcPath(md protoreflect.MethodDescriptor) string {
+	return "/" + string(md.Parent().FullName()) + "/" + string(md.Name())
+}
@@ -0,0 +1,788 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/textarea"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// Rows given to the parts of the gRPC mode
+const (
+	grpcMethodsHeight  = 6
+	grpcRequestHeight  = 8
+	grpcMetadataHeight = 2
+)
+
+// Parts of the gRPC mode taking the keys
+const (
+	grpcFocusMethods = iota
+	grpcFocusRequest
+	grpcFocusMetadata
+)
+
+// grpcModel is the gRPC mode: the methods of the server on the input line,
+// described by server reflection or the -proto file, a request message
+// typed as JSON with metadata, and the call sent last
+type grpcModel struct {
+	target   string // as typed, telling whether the methods are still those of the server
+	files    *protoregistry.Files
+	methods  []protoreflect.MethodDescriptor
+	source   string // where the methods were described
+	loading  bool
+	err      error // of the last reflection
+	selected int
+	focus    int
+	protocol grpcProtocol // calls are made with, Ctrl+P cycling it
+
+	request  textarea.Model
+	metadata textarea.Model
+	// requests typed for each method, kept while switching between them
+	requests map[protoreflect.FullName]string
+
+	call *grpcCallState // the last call made
+}
+
+func newGRPCModel() grpcModel {
+	request := textarea.New()
+	request.Placeholder = `{"id": "42"}`
+	request.ShowLineNumbers = true
+	request.SetHeight(grpcRequestHeight)
+	request.CharLimit = 0
+
+	metadata := textarea.New()
+	metadata.Placeholder = "authorization: Bearer {{token}}"
+	metadata.ShowLineNumbers = false
+	metadata.SetHeight(grpcMetadataHeight)
+	metadata.CharLimit = 0
+
+	return grpcModel{request: request, metadata: metadata, requests: map[protoreflect.FullName]string{}}
+}
+
+// method is the method selected, nil while there are none
+func (g grpcModel) method() protoreflect.MethodDescriptor {
+	if g.selected < len(g.methods) {
+		return g.methods[g.selected]
+	}
+	return nil
+}
+
+// grpcServicesMsg delivers the methods reflection found on a server
+type grpcServicesMsg struct {
+	target   string
+	protocol grpcProtocol
+	files    *protoregistry.Files
+	services []string
+	err      error
+}
+
+// grpcCallState is a call in flight or done
+type grpcCallState struct {
+	seq      int
+	method   string
+	target   string
+	protocol grpcProtocol
+	started  time.Time
+	messages []grpcReceived
+	dropped  int // messages no longer kept
+	running  bool
+	took     time.Duration
+	result   grpcResult
+	ended    string // how a call that got no status ended
+	err      error
+}
+
+// grpcReceived is a response message, decoded to JSON when it could be
+type grpcReceived struct {
+	at   time.Duration // since the call started
+	json []byte
+	err  error
+	size int
+}
+
+// grpcCallSeq numbers calls, so messages of one cancelled can be told
+// apart
+var grpcCallSeq int
+
+// grpcMessageMsg delivers a response message of a call
+type grpcMessageMsg struct {
+	stream  <-chan tea.Msg
+	seq     int
+	message grpcReceived
+}
+
+// grpcEndMsg ends a call
+type grpcEndMsg struct {
+	seq    int
+	took   time.Duration
+	result grpcResult
+	ended  string
+	err    error
+}
+
+// parseMetadata reads metadata typed as name: value lines, skipping blank
+// and # comment lines
+func parseMetadata(text string) (map[string]string, error) {
+	metadata := map[string]string{}
+	for i, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, value, ok := strings.Cut(line, ":")
+		if !ok || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("metadata line %d isn't name: value", i+1)
+		}
+		metadata[strings.ToLower(strings.TrimSpace(name))] = strings.TrimSpace(value)
+	}
+	return metadata, nil
+}
+
+// grpcSavedRequest is a call as a request, for its templates to be
+// expanded like those of any other: the metadata as headers, the messages
+// as the body
+func (m model) grpcSavedRequest(path string) (savedRequest, error) {
+	metadata, err := parseMetadata(m.grpc.metadata.Value())
+	if err != nil {
+		return savedRequest{}, err
+	}
+	return savedRequest{
+		Method:  http.MethodPost,
+		URL:     grpcTarget(m.grpc.target) + path,
+		Headers: metadata,
+		Body:    m.grpc.request.Value(),
+	}, nil
+}
+
+// enterGRPC opens the gRPC mode for the server on the input line, with
+// the services of the -proto file or else those reflection lists
+func (m model) enterGRPC() (model, tea.Cmd) {
+	target := strings.TrimSpace(m.textInput.Value())
+	if target == "" {
+		m.notice = errorStyle.Render("Type the address of the gRPC server first, like grpc://localhost:50051")
+		return m, nil
+	}
+	g := &m.grpc
+	var cmd tea.Cmd
+	if g.target != target {
+		g.target, g.files, g.methods, g.source, g.err, g.loading, g.selected = target, nil, nil, "", nil, false, 0
+		g.requests = map[protoreflect.FullName]string{}
+		if protoFiles != nil {
+			g.files, g.methods, g.source = protoFiles, grpcMethods(protoFiles, nil), protoFile
+			m.grpc.loadRequest()
+		}
+	}
+
+	m.mode = modeGRPC
+	m.textInput.Blur()
+	m.response = "Choose a method, type its request and send it with Ctrl+S"
+	m.err = nil
+	m.suggestions = nil
+	m.viewport.SetContent(m.response)
+	if g.call != nil {
+		m.viewport.SetContent(renderGRPCCall(g.call))
+	}
+	m = m.grpcFocus(m.grpc.focus)
+	m = m.layout()
+	if m.grpc.files == nil && !m.grpc.loading {
+		var ask tea.Cmd
+		m, ask = m.reflectGRPC()
+		cmd = tea.Batch(cmd, ask)
+	}
+	return m, cmd
+}
+
+// reflectGRPC asks the server for its services through server
+// reflection, with the metadata typed
+func (m model) reflectGRPC() (model, tea.Cmd) {
+	g := &m.grpc
+	r, err := m.grpcSavedRequest("")
+	if err != nil {
+		g.err = err
+		return m, nil
+	}
+	r.Body = ""
+	resolved := resolveSavedRequest(r, m.templateContext())
+	if len(resolved.missing) > 0 {
+		var names []string
+		for _, u := range resolved.missing {
+			names = append(names, "{{"+u.name+"}}")
+		}
+		g.err = fmt.Errorf("reflection not asked, unresolved placeholders: %s", strings.Join(names, ", "))
+		return m, nil
+	}
+	g.loading, g.err = true, nil
+	target, protocol := g.target, g.protocol
+	base := resolveGRPCTarget(target, resolved.url)
+	metadata := grpcMetadata(resolved.headers)
+	return m, func() tea.Msg {
+		ctx, cancel := context.WithTimeout(context.Background(), reflectionTimeout)
+		defer cancel()
+		files, services, err := reflectServices(ctx, protocol, base, metadata)
+		return grpcServicesMsg{target: target, protocol: protocol, files: files, services: services, err: err}
+	}
+}
+
+// setGRPCServices takes the methods reflection found
+func (m model) setGRPCServices(msg grpcServicesMsg) model {
+	g := &m.grpc
+	if msg.target != g.target || msg.protocol != g.protocol {
+		return m
+	}
+	g.loading = false
+	if msg.err != nil {
+		g.err = msg.err
+		return m
+	}
+	var selected protoreflect.FullName
+	if md := g.method(); md != nil {
+		selected = md.FullName()
+	}
+	g.files, g.methods, g.source, g.err = msg.files, grpcMethods(msg.files, msg.services), "reflection", nil
+	g.selected = 0
+	for i, md := range g.methods {
+		if md.FullName() == selected {
+			g.selected = i
+		}
+	}
+	if selected == "" || g.method() == nil || g.method().FullName() != selected {
+		g.loadRequest()
+	}
+	return m
+}
+
+// grpcMetadata is the metadata of a call from the headers of its request,
+// less what gRPC sets itself
+func grpcMetadata(headers map[string]string) map[string]string {
+	metadata := make(map[string]string, len(headers))
+	for k, v := range headers {
+		switch k = strings.ToLower(k); k {
+		case "content-type", "content-length", "te":
+		default:
+			metadata[k] = v
+		}
+	}
+	return metadata
+}
+
+// selectMethod moves to another method, keeping the request typed for the
+// one left
+func (g *grpcModel) selectMethod(i int) {
+	if len(g.methods) == 0 || i == g.selected {
+		return
+	}
+	if md := g.method(); md != nil {
+		g.requests[md.FullName()] = g.request.Value()
+	}
+	g.selected = i
+	g.loadRequest()
+}
+
+// loadRequest puts the request typed for the method selected in the
+// editor, or a template of its message when none was
+func (g *grpcModel) loadRequest() {
+	md := g.method()
+	if md == nil {
+		return
+	}
+	if r, ok := g.requests[md.FullName()]; ok {
+		g.request.SetValue(r)
+	} else {
+		g.request.SetValue(messageTemplate(md.Input()))
+	}
+}
+
+// messageTemplate is a message in JSON with every field at its zero
+// value, for a request to start from
+func messageTemplate(md protoreflect.MessageDescriptor) string {
+	var sb strings.Builder
+	writeMessageTemplate(&sb, md, "", map[protoreflect.FullName]bool{})
+	return sb.String()
+}
+
+// writeMessageTemplate writes the template of a message indented by
+// indent. Messages within themselves are left empty, and of each oneof
+// only the first field is given.
+func writeMessageTemplate(sb *strings.Builder, md protoreflect.MessageDescriptor, indent string, seen map[protoreflect.FullName]bool) {
+	if wkt, ok := wellKnownTemplates[md.FullName()]; ok {
+		sb.WriteString(wkt)
+		return
+	}
+	if seen[md.FullName()] || md.Fields().Len() == 0 {
+		sb.WriteString("{}")
+		return
+	}
+	seen[md.FullName()] = true
+	defer delete(seen, md.FullName())
+
+	sb.WriteString("{")
+	first := true
+	for i := 0; i < md.Fields().Len(); i++ {
+		fd := md.Fields().Get(i)
+		if oneof := fd.ContainingOneof(); oneof != nil && !oneof.IsSynthetic() && oneof.Fields().Get(0) != fd {
+			continue
+		}
+		if !first {
+			sb.WriteString(",")
+		}
+		first = false
+		fmt.Fprintf(sb, "\n%s  %q: ", indent, fd.JSONName())
+		switch {
+		case fd.IsMap():
+			sb.WriteString("{}")
+		case fd.IsList():
+			sb.WriteString("[")
+			writeFieldTemplate(sb, fd, indent+"  ", seen)
+			sb.WriteString("]")
+		default:
+			writeFieldTemplate(sb, fd, indent+"  ", seen)
+		}
+	}
+	sb.WriteString("\n" + indent + "}")
+}
+
+func writeFieldTemplate(sb *strings.Builder, fd protoreflect.FieldDescriptor, indent string, seen map[protoreflect.FullName]bool) {
+	switch fd.Kind() {
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		writeMessageTemplate(sb, fd.Message(), indent, seen)
+	case protoreflect.EnumKind:
+		fmt.Fprintf(sb, "%q", fd.Enum().Values().Get(0).Name())
+	case protoreflect.BoolKind:
+		sb.WriteString("false")
+	case protoreflect.StringKind, protoreflect.BytesKind:
+		sb.WriteString(`""`)
+	default:
+		sb.WriteString("0")
+	}
+}
+
+// wellKnownTemplates are the templates of the well-known types protojson
+// writes as something else than objects
+var wellKnownTemplates = map[protoreflect.FullName]string{
+	"google.protobuf.Timestamp":   `"1970-01-01T00:00:00Z"`,
+	"google.protobuf.Duration":    `"0s"`,
+	"google.protobuf.FieldMask":   `""`,
+	"google.protobuf.Struct":      "{}",
+	"google.protobuf.Value":       "null",
+	"google.protobuf.ListValue":   "[]",
+	"google.protobuf.Any":         `{"@type": ""}`,
+	"google.protobuf.StringValue": `""`,
+	"google.protobuf.BytesValue":  `""`,
+	"google.protobuf.BoolValue":   "false",
+	"google.protobuf.DoubleValue": "0",
+	"google.protobuf.FloatValue":  "0",
+	"google.protobuf.Int32Value":  "0",
+	"google.protobuf.Int64Value":  "0",
+	"google.protobuf.UInt32Value": "0",
+	"google.protobuf.UInt64Value": "0",
+}
+
+// encodeGRPCRequests turns the JSON typed into the messages of a call:
+// one or more JSON objects one after the other, as many as the method
+// takes
+func encodeGRPCRequests(md protoreflect.MethodDescriptor, files *protoregistry.Files, body string) ([][]byte, error) {
+	if strings.TrimSpace(body) == "" {
+		body = "{}"
+	}
+	types := dynamicpb.NewTypes(files)
+	var requests [][]byte
+	dec := json.NewDecoder(strings.NewReader(body))
+	for {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("message %d isn't valid JSON: %w", len(requests)+1, err)
+		}
+		msg := dynamicpb.NewMessage(md.Input())
+		if err := (protojson.UnmarshalOptions{Resolver: types}).Unmarshal(raw, msg); err != nil {
+			return nil, fmt.Errorf("message %d: %w", len(requests)+1, err)
+		}
+		data, err := proto.Marshal(msg)
+		if err != nil {
+			return nil, fmt.Errorf("message %d: %w", len(requests)+1, err)
+		}
+		requests = append(requests, data)
+	}
+	if len(requests) > 1 && !md.IsStreamingClient() {
+		return nil, fmt.Errorf("%s takes a single message, not %d", md.Name(), len(requests))
+	}
+	return requests, nil
+}
+
+// decodeGRPCResponse turns a response message into indented JSON
+func decodeGRPCResponse(md protoreflect.MethodDescriptor, files *protoregistry.Files, data []byte) ([]byte, error) {
+	msg := dynamicpb.NewMessage(md.Output())
+	if err := proto.Unmarshal(data, msg); err != nil {
+		return nil, err
+	}
+	return protojson.MarshalOptions{Multiline: true, Indent: "  ", Resolver: dynamicpb.NewTypes(files)}.Marshal(msg)
+}
+
+// invokeGRPC calls the method selected with the messages and metadata
+// typed, their templates expanded, streaming the response messages into
+// the response view
+func (m model) invokeGRPC() (model, tea.Cmd) {
+	g := &m.grpc
+	md := g.method()
+	if md == nil {
+		m.err = errors.New("no method to call")
+		return m, nil
+	}
+	path := grpcPath(md)
+	r, err := m.grpcSavedRequest(path)
+	if err != nil {
+		m.err = err
+		return m, nil
+	}
+	resolved := resolveSavedRequest(r, m.templateContext())
+	var blocked bool
+	retry := func(m model) (model, tea.Cmd) { return m.invokeGRPC() }
+	if m, blocked = m.checkUnresolved(resolved.missing, retry); blocked {
+		m.viewport.SetContent(m.response)
+		return m, nil
+	}
+	requests, err := encodeGRPCRequests(md, g.files, resolved.body)
+	if err != nil {
+		m.err = err
+		return m, nil
+	}
+	base := resolveGRPCTarget(g.target, strings.TrimSuffix(resolved.url, path))
+	metadata := grpcMetadata(resolved.headers)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	grpcCallSeq++
+	seq, files, protocol := grpcCallSeq, g.files, g.protocol
+	m.fetching = true
+	m.cancel = cancel
+	m.err = nil
+	m.notice = ""
+	g.call = &grpcCallState{seq: seq, method: strings.TrimPrefix(path, "/"), target: base, protocol: protocol, started: time.Now(), running: true}
+	m.response = renderGRPCCall(g.call)
+	m.viewport.SetContent(m.response)
+	m.viewport.GotoTop()
+
+	stream := make(chan tea.Msg)
+	go func() {
+		started := time.Now()
+		result, err := grpcCall(ctx, protocol, base, path, metadata, requests, md.IsStreamingClient() || md.IsStreamingServer(), func(data []byte) {
+			received := grpcReceived{at: time.Since(started), size: len(data)}
+			received.json, received.err = decodeGRPCResponse(md, files, data)
+			stream <- grpcMessageMsg{stream: stream, seq: seq, message: received}
+		})
+		end := grpcEndMsg{seq: seq, took: time.Since(started), result: result, err: err}
+		if err != nil && ctx.Err() != nil {
+			end.ended, end.err = "Cancelled", nil
+		}
+		stream <- end
+	}()
+	return m, waitForFetch(stream)
+}
+
+// addGRPCMessage shows a response message of the call in flight,
+// following the newest unless the view was scrolled up
+func (m model) addGRPCMessage(msg grpcMessageMsg) (model, tea.Cmd) {
+	c := m.grpc.call
+	if c == nil || c.seq != msg.seq {
+		return m, waitForFetch(msg.stream)
+	}
+	c.messages = append(c.messages, msg.message)
+	if len(c.messages) > maxShownResults {
+		c.dropped += len(c.messages) - maxShownResults
+		c.messages = c.messages[len(c.messages)-maxShownResults:]
+	}
+	m.response = renderGRPCCall(c)
+	atBottom := m.viewport.AtBottom()
+	m.viewport.SetContent(m.response)
+	if atBottom {
+		m.viewport.GotoBottom()
+	}
+	return m, waitForFetch(msg.stream)
+}
+
+// endGRPCCall records how the call ended
+func (m model) endGRPCCall(msg grpcEndMsg) model {
+	c := m.grpc.call
+	if c == nil || c.seq != msg.seq {
+		return m
+	}
+	c.running, c.took, c.result, c.ended, c.err = false, msg.took, msg.result, msg.ended, msg.err
+	m.fetching = false
+	if m.cancel != nil {
+		m.cancel()
+		m.cancel = nil
+	}
+	m.response = renderGRPCCall(c)
+	atBottom := m.viewport.AtBottom()
+	m.viewport.SetContent(m.response)
+	if atBottom {
+		m.viewport.GotoBottom()
+	}
+	return m
+}
+
+var grpcOKStyle = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("#98C379"))
+
+// renderGRPCCall shows a call: the response metadata and messages, then
+// how it ended and its trailers
+func renderGRPCCall(c *grpcCallState) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s %s %s", headerStyle.Render("Call:"), c.method, historyDimStyle.Render("on "+c.target+" over "+c.protocol.String()))
+	fmt.Fprintf(&sb, historyDimStyle.Render(" • %d messages"), len(c.messages)+c.dropped)
+	if c.running {
+		sb.WriteString(historyDimStyle.Render(" • ") + liveStyle.Render("● running") + historyDimStyle.Render(" • Ctrl+X: Cancel"))
+	}
+	sb.WriteString("\n\n")
+	if md := renderGRPCMetadata(c.result.header); md != "" {
+		sb.WriteString(headerStyle.Render("Response metadata") + "\n" + md + "\n")
+	}
+	if c.dropped > 0 {
+		sb.WriteString(historyDimStyle.Render(fmt.Sprintf("… %d earlier messages not shown", c.dropped)))
+		sb.WriteString("\n\n")
+	}
+	for i, r := range c.messages {
+		sb.WriteString(historyDimStyle.Render(fmt.Sprintf("#%d  +%s • %s", c.dropped+i+1, formatDuration(r.at), formatBytes(int64(r.size)))))
+		sb.WriteString("\n")
+		var body string
+		if r.err != nil {
+			body = errorStyle.Render("Not decoded: " + r.err.Error())
+		} else if pretty, err := renderTypedJSON(r.json, jsonTypeAnnotations); err == nil {
+			body = pretty
+		} else {
+			body = string(r.json)
+		}
+		for _, line := range strings.Split(strings.TrimRight(body, "\n"), "\n") {
+			sb.WriteString("  " + line + "\n")
+		}
+		sb.WriteString("\n")
+	}
+
+	switch {
+	case c.running && len(c.messages) == 0:
+		sb.WriteString(historyDimStyle.Render("Waiting for the response...") + "\n")
+	case c.running:
+	case c.err != nil:
+		sb.WriteString(errorStyle.Render("Error: "+c.err.Error()) + "\n")
+	case c.ended != "":
+		sb.WriteString(historyDimStyle.Render(c.ended) + "\n")
+	case c.result.status.code == 0:
+		fmt.Fprintf(&sb, "%s %s %s\n", headerStyle.Render("Status:"), grpcOKStyle.Render("OK"), historyDimStyle.Render("in "+formatDuration(c.took)))
+	default:
+		fmt.Fprintf(&sb, "%s %s %s\n", headerStyle.Render("Status:"), errorStyle.Render(c.result.status.Error()), historyDimStyle.Render("in "+formatDuration(c.took)))
+	}
+	if md := renderGRPCMetadata(c.result.trailer); md != "" {
+		sb.WriteString("\n" + headerStyle.Render("Trailers") + "\n" + md)
+	}
+	return sb.String()
+}
+
+// renderGRPCMetadata lists metadata, less the headers of the protocol
+func renderGRPCMetadata(h http.Header) string {
+	var lines []string
+	for name, values := range h {
+		switch name {
+		case "Content-Type", "Content-Length", "Grpc-Status", "Grpc-Message", "Grpc-Encoding", "Grpc-Accept-Encoding",
+			"Connect-Content-Encoding", "Connect-Accept-Encoding":
+			continue
+		}
+		for _, v := range values {
+			lines = append(lines, "  "+historyDimStyle.Render(strings.ToLower(name)+":")+" "+v)
+		}
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+	sort.Strings(lines)
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// grpcFocus moves the keys to a part of the gRPC mode
+func (m model) grpcFocus(focus int) model {
+	g := &m.grpc
+	g.focus = focus
+	g.request.Blur()
+	g.metadata.Blur()
+	switch focus {
+	case grpcFocusRequest:
+		g.request.Focus()
+	case grpcFocusMetadata:
+		g.metadata.Focus()
+	}
+	return m
+}
+
+// updateGRPC handles input while the gRPC mode is open
+func (m model) updateGRPC(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	var cmd tea.Cmd
+	g := &m.grpc
+
+	switch msg.Type {
+	case tea.KeyCtrlC:
+		if m.cancel != nil {
+			m.cancel()
+		}
+		return m, tea.Quit
+	case tea.KeyEsc, tea.KeyCtrlCaret:
+		m.mode = modeHTTP
+		g.request.Blur()
+		g.metadata.Blur()
+		m.textInput.Focus()
+		m.viewport.SetContent(m.response)
+		return m.layout(), nil
+	case tea.KeyCtrlS:
+		if m.fetching {
+			return m, nil
+		}
+		return m.invokeGRPC()
+	case tea.KeyCtrlR:
+		if g.loading || m.fetching {
+			return m, nil
+		}
+		return m.reflectGRPC()
+	case tea.KeyCtrlP:
+		if m.fetching {
+			return m, nil
+		}
+		g.protocol = (g.protocol + 1) % grpcProtocol(len(grpcProtocolNames))
+		if g.files == nil {
+			return m.reflectGRPC()
+		}
+		return m, nil
+	case tea.KeyCtrlT:
+		if md := g.method(); md != nil {
+			g.request.SetValue(messageTemplate(md.Input()))
+		}
+		return m, nil
+	case tea.KeyCtrlX:
+		if m.fetching && m.cancel != nil {
+			m.cancel()
+		}
+		return m, nil
+	case tea.KeyTab:
+		return m.grpcFocus((g.focus + 1) % 3), nil
+	case tea.KeyShiftTab:
+		return m.grpcFocus((g.focus + 2) % 3), nil
+	case tea.KeyPgUp, tea.KeyPgDown:
+		m.viewport, cmd = m.viewport.Update(msg)
+		return m, cmd
+	}
+
+	switch g.focus {
+	case grpcFocusMethods:
+		switch msg.String() {
+		case "up", "k":
+			g.selectMethod(max(g.selected-1, 0))
+		case "down", "j":
+			g.selectMethod(min(g.selected+1, len(g.methods)-1))
+		case "enter":
+			return m.grpcFocus(grpcFocusRequest), nil
+		}
+	case grpcFocusRequest:
+		g.request, cmd = g.request.Update(msg)
+	case grpcFocusMetadata:
+		g.metadata, cmd = g.metadata.Update(msg)
+	}
+	return m, cmd
+}
+
+// describeMethod is a method with its message types, like
+// shop.Orders/Watch(WatchRequest) → stream Order
+func describeMethod(md protoreflect.MethodDescriptor) string {
+	in, out := string(md.Input().Name()), string(md.Output().Name())
+	if md.IsStreamingClient() {
+		in = "stream " + in
+	}
+	if md.IsStreamingServer() {
+		out = "stream " + out
+	}
+	return fmt.Sprintf("%s/%s(%s) → %s", md.Parent().FullName(), md.Name(), in, out)
+}
+
+// grpcMethodList shows the methods around the one selected
+func (g grpcModel) grpcMethodList(width int) []string {
+	var lines []string
+	switch {
+	case len(g.methods) == 0 && g.loading:
+	case len(g.methods) == 0 && g.files != nil:
+		lines = append(lines, historyDimStyle.Render("The server has no methods to call"))
+	default:
+		rows := grpcMethodsHeight
+		first := min(max(g.selected-rows/2, 0), max(len(g.methods)-rows, 0))
+		for i := first; i < min(first+rows, len(g.methods)); i++ {
+			text := truncate(describeMethod(g.methods[i]), width-2)
+			switch {
+			case i == g.selected && g.focus == grpcFocusMethods:
+				lines = append(lines, completionSelectedStyle.Render("› "+text))
+			case i == g.selected:
+				lines = append(lines, "› "+text)
+			default:
+				lines = append(lines, "  "+historyDimStyle.Render(text))
+			}
+		}
+	}
+	for len(lines) < grpcMethodsHeight {
+		lines = append(lines, "")
+	}
+	return lines
+}
+
+func (m model) grpcView() string {
+	g := m.grpc
+	width := m.width - padding*4
+
+	protocol := " • " + g.protocol.String() + " • Ctrl+P: Protocol"
+
+	var status string
+	switch {
+	case g.loading:
+		status = lipgloss.NewStyle().Foreground(lipgloss.Color("#FFCC00")).Render("Asking the server for its services...")
+	case g.files != nil:
+		status = fmt.Sprintf("%s %d methods from %s • Ctrl+R: Reflect", headerStyle.Render("Methods:"), len(g.methods), g.source)
+		if g.err != nil {
+			status += " " + errorStyle.Render(g.err.Error())
+		}
+	case g.err != nil:
+		status = errorStyle.Render("Methods: "+g.err.Error()) + historyDimStyle.Render(" • Ctrl+R: Retry")
+	default:
+		status = headerStyle.Render("Methods:") + " none, Ctrl+R asks the server through reflection"
+	}
+
+	request := headerStyle.Render("Request")
+	if md := g.method(); md != nil {
+		request += historyDimStyle.Render(" " + string(md.Input().FullName()))
+		if md.IsStreamingClient() {
+			request += historyDimStyle.Render(" • several messages, one after the other")
+		}
+		request += historyDimStyle.Render(" • Ctrl+T: Template")
+	}
+
+	var responseView string
+	switch {
+	case m.varPrompt != nil:
+		responseView = renderVarPrompt(m.varPrompt)
+	case m.err != nil:
+		responseView = errorStyle.Render(fmt.Sprintf("Error: %v", m.err))
+	default:
+		responseView = m.viewport.View()
+	}
+
+	return fmt.Sprintf("%s\n%s\n\n%s\n\n%s\n%s\n%s\n%s\n\n%s",
+		inputStyle.Render(headerStyle.Render("Server: ")+truncate(g.target, width-len("Server: ")-len(protocol))+historyDimStyle.Render(protocol)), status,
+		strings.Join(g.grpcMethodList(width), "\n"),
+		request, g.request.View(), headerStyle.Render("Metadata"), g.metadata.View(),
+		responseView)
+}
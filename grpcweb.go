@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/textproto"
+	"strings"
+)
+
+// gRPC-Web and Connect carry the same calls over HTTP/1.1 or HTTP/2
+// without trailers, so browsers can make them. gRPC-Web frames messages
+// as gRPC does and sends the trailers as a last frame, flagged 0x80,
+// holding "name: value" lines. Connect posts a unary request as the bare
+// message and answers with the bare message, or with a JSON error and a
+// non-200 status; its streams are framed, ending with a frame flagged 0x02
+// holding the error and trailers as JSON.
+
+// grpcWebCall makes a call with gRPC-Web, which has no client streaming
+func grpcWebCall(ctx context.Context, base, path string, metadata map[string]string, requests [][]byte, receive func([]byte)) (grpcResult, error) {
+	if len(requests) > 1 {
+		return grpcResult{}, errors.New("gRPC-Web can't stream requests, send a single message")
+	}
+	var body bytes.Buffer
+	for _, r := range requests {
+		body.Write(grpcFrame(r))
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, base+path, &body)
+	if err != nil {
+		return grpcResult{}, err
+	}
+	req.Header.Set("Content-Type", "application/grpc-web+proto")
+	req.Header.Set("Accept", "application/grpc-web+proto")
+	req.Header.Set("X-Grpc-Web", "1")
+	req.Header.Set("X-User-Agent", "lazyhttp-grpc-web")
+	req.Header.Set("Grpc-Accept-Encoding", "gzip")
+	for k, v := range metadata {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := newHTTPClient(defaultTimeouts, defaultHTTPVersion, defaultResolve, environmentProxy()).Do(req)
+	if err != nil {
+		return grpcResult{}, describeTimeout(err, defaultTimeouts)
+	}
+	defer resp.Body.Close()
+	result := grpcResult{header: resp.Header}
+
+	if resp.Header.Get("Grpc-Status") != "" {
+		result.status = parseGRPCStatus(resp.Header)
+		return result, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return result, fmt.Errorf("the server answered %s, not a gRPC-Web response", resp.Status)
+	}
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "application/grpc-web") {
+		return result, fmt.Errorf("the server answered with %q, not a gRPC-Web response", ct)
+	}
+
+	for {
+		flags, msg, err := readGRPCFrame(resp.Body)
+		if err == io.EOF {
+			break
+		}
+		if err == nil && flags&1 != 0 {
+			msg, err = decompressGRPC(msg, resp.Header.Get("Grpc-Encoding"))
+		}
+		if err != nil {
+			return result, err
+		}
+		if flags&0x80 != 0 {
+			result.trailer, err = parseGRPCWebTrailers(msg)
+			if err != nil {
+				return result, err
+			}
+			break
+		}
+		receive(msg)
+	}
+	if result.trailer.Get("Grpc-Status") == "" {
+		return result, errors.New("the server ended the call without a status")
+	}
+	result.status = parseGRPCStatus(result.trailer)
+	return result, nil
+}
+
+// parseGRPCWebTrailers reads the trailers frame of a gRPC-Web response
+func parseGRPCWebTrailers(frame []byte) (http.Header, error) {
+	r := textproto.NewReader(bufio.NewReader(io.MultiReader(bytes.NewReader(frame), strings.NewReader("\r\n"))))
+	trailer, err := r.ReadMIMEHeader()
+	if err != nil {
+		return nil, fmt.Errorf("reading the trailers: %w", err)
+	}
+	return http.Header(trailer), nil
+}
+
+// connectCall makes a call with the Connect protocol, unary methods as a
+// plain POST and the others as a stream
+func connectCall(ctx context.Context, base, path string, metadata map[string]string, requests [][]byte, streaming bool, receive func([]byte)) (grpcResult, error) {
+	var body bytes.Buffer
+	contentType := "application/proto"
+	if streaming {
+		contentType = "application/connect+proto"
+		for _, r := range requests {
+			body.Write(grpcFrame(r))
+		}
+	} else if len(requests) > 0 {
+		body.Write(requests[0])
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, base+path, &body)
+	if err != nil {
+		return grpcResult{}, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Connect-Protocol-Version", "1")
+	req.Header.Set("User-Agent", "lazyhttp-connect")
+	if streaming {
+		req.Header.Set("Connect-Accept-Encoding", "gzip")
+	}
+	for k, v := range metadata {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := newHTTPClient(defaultTimeouts, defaultHTTPVersion, defaultResolve, environmentProxy()).Do(req)
+	if err != nil {
+		return grpcResult{}, describeTimeout(err, defaultTimeouts)
+	}
+	defer resp.Body.Close()
+	result := grpcResult{header: http.Header{}, trailer: http.Header{}}
+	for k, v := range resp.Header {
+		if name, ok := strings.CutPrefix(k, "Trailer-"); ok && !streaming {
+			result.trailer[http.CanonicalHeaderKey(name)] = v
+		} else {
+			result.header[k] = v
+		}
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		result.status, err = readConnectError(resp)
+		return result, err
+	}
+	ct := resp.Header.Get("Content-Type")
+	if !streaming {
+		if !strings.HasPrefix(ct, "application/proto") {
+			return result, fmt.Errorf("the server answered with %q, not a Connect response", ct)
+		}
+		msg, err := io.ReadAll(io.LimitReader(resp.Body, maxGRPCMessage+1))
+		if err != nil {
+			return result, err
+		}
+		if len(msg) > maxGRPCMessage {
+			return result, fmt.Errorf("the message is over the limit of %s", formatBytes(maxGRPCMessage))
+		}
+		receive(msg)
+		return result, nil
+	}
+	if !strings.HasPrefix(ct, "application/connect") {
+		return result, fmt.Errorf("the server answered with %q, not a Connect response", ct)
+	}
+
+	for {
+		flags, msg, err := readGRPCFrame(resp.Body)
+		if err == io.EOF {
+			return result, errors.New("the server ended the stream without an end message")
+		}
+		if err == nil && flags&1 != 0 {
+			msg, err = decompressGRPC(msg, resp.Header.Get("Connect-Content-Encoding"))
+		}
+		if err != nil {
+			return result, err
+		}
+		if flags&0x02 == 0 {
+			receive(msg)
+			continue
+		}
+		var end struct {
+			Error    *connectError       `json:"error"`
+			Metadata map[string][]string `json:"metadata"`
+		}
+		if err := json.Unmarshal(msg, &end); err != nil {
+			return result, fmt.Errorf("reading the end of the stream: %w", err)
+		}
+		for k, v := range end.Metadata {
+			result.trailer[http.CanonicalHeaderKey(k)] = v
+		}
+		if end.Error != nil {
+			result.status = end.Error.status()
+		}
+		return result, nil
+	}
+}
+
+// connectError is how Connect describes a failed call
+type connectError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e connectError) status() grpcStatus {
+	for code, name := range grpcCodes {
+		if strings.EqualFold(name, e.Code) {
+			return grpcStatus{code: code, message: e.Message}
+		}
+	}
+	return grpcStatus{code: 2, message: strings.TrimSpace(e.Code + " " + e.Message)}
+}
+
+// connectHTTPCodes are the status codes of failed calls whose body isn't a
+// Connect error, by HTTP status, as the protocol specifies them
+var connectHTTPCodes = map[int]int{
+	http.StatusBadRequest:         13, // INTERNAL
+	http.StatusUnauthorized:       16, // UNAUTHENTICATED
+	http.StatusForbidden:          7,  // PERMISSION_DENIED
+	http.StatusNotFound:           grpcUnimplemented,
+	http.StatusTooManyRequests:    14, // UNAVAILABLE
+	http.StatusBadGateway:         14,
+	http.StatusServiceUnavailable: 14,
+	http.StatusGatewayTimeout:     14,
+}
+
+// readConnectError reads the status of a call the server failed with a
+// non-200 response
+func readConnectError(resp *http.Response) (grpcStatus, error) {
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxGRPCMessage))
+	if err != nil {
+		return grpcStatus{}, err
+	}
+	var e connectError
+	if json.Unmarshal(data, &e) == nil && e.Code != "" {
+		return e.status(), nil
+	}
+	code, ok := connectHTTPCodes[resp.StatusCode]
+	if !ok {
+		code = 2 // UNKNOWN
+	}
+	return grpcStatus{code: code, message: "HTTP " + resp.Status}, nil
+}
@@ -0,0 +1,417 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/textarea"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// harFile is an HTTP Archive, as saved from the network tab of browser
+// devtools. The fields are those of HAR 1.2 that lazyhttp reads or
+// writes.
+type harFile struct {
+	Log harLog `json:"log"`
+}
+
+type harLog struct {
+	Version string     `json:"version"`
+	Creator harCreator `json:"creator"`
+	Entries []harEntry `json:"entries"`
+}
+
+type harCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// harEntry is a request of a HAR file and the response it got
+type harEntry struct {
+	StartedDateTime string      `json:"startedDateTime"`
+	Time            float64     `json:"time"` // total, in milliseconds
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         harTimings  `json:"timings"`
+	ServerIPAddress string      `json:"serverIPAddress,omitempty"`
+
+	// Error is why no response was received, a custom field as HAR has
+	// none for it
+	Error string `json:"_error,omitempty"`
+}
+
+type harRequest struct {
+	Method      string       `json:"method"`
+	URL         string       `json:"url"`
+	HTTPVersion string       `json:"httpVersion"`
+	Cookies     []harPair    `json:"cookies"`
+	Headers     []harPair    `json:"headers"`
+	QueryString []harPair    `json:"queryString"`
+	PostData    *harPostData `json:"postData,omitempty"`
+	HeadersSize int64        `json:"headersSize"`
+	BodySize    int64        `json:"bodySize"`
+}
+
+type harResponse struct {
+	Status      int        `json:"status"`
+	StatusText  string     `json:"statusText"`
+	HTTPVersion string     `json:"httpVersion"`
+	Cookies     []harPair  `json:"cookies"`
+	Headers     []harPair  `json:"headers"`
+	Content     harContent `json:"content"`
+	RedirectURL string     `json:"redirectURL"`
+	HeadersSize int64      `json:"headersSize"`
+	BodySize    int64      `json:"bodySize"`
+}
+
+type harContent struct {
+	Size     int64  `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+	Comment  string `json:"comment,omitempty"`
+}
+
+// harTimings are the phases of a request in milliseconds, -1 for those
+// that didn't happen
+type harTimings struct {
+	Blocked float64 `json:"blocked"`
+	DNS     float64 `json:"dns"`
+	Connect float64 `json:"connect"` // TLS included, as HAR defines it
+	SSL     float64 `json:"ssl"`
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+type harPair struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type harPostData struct {
+	MimeType string    `json:"mimeType"`
+	Text     string    `json:"text"`
+	Params   []harPair `json:"params,omitempty"`
+	Comment  string    `json:"comment,omitempty"`
+}
+
+// harSkippedHeaders are request headers not replayed: the transport sets
+// them for the request actually sent
+var harSkippedHeaders = []string{"Host", "Content-Length", "Connection"}
+
+// loadHAR reads the entries of a HAR file, leaving out those lazyhttp
+// can't replay, like data: URLs and WebSockets
+func loadHAR(path string) ([]harEntry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var har harFile
+	if err := json.Unmarshal(data, &har); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	var entries []harEntry
+	for _, e := range har.Log.Entries {
+		url := strings.ToLower(e.Request.URL)
+		if strings.HasPrefix(url, "http://") || strings.HasPrefix(url, "https://") {
+			entries = append(entries, e)
+		}
+	}
+	if len(entries) == 0 {
+		return nil, errors.New("the HAR file holds no HTTP requests")
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].StartedDateTime < entries[j].StartedDateTime })
+	return entries, nil
+}
+
+func (e harEntry) label() string {
+	return e.Request.Method + " " + e.Request.URL
+}
+
+// headerText lists the replayed request headers one per line, as edited
+func (e harEntry) headerText() string {
+	var lines []string
+	for _, h := range e.Request.Headers {
+		if strings.HasPrefix(h.Name, ":") || containsFold(harSkippedHeaders, h.Name) {
+			continue
+		}
+		lines = append(lines, h.Name+": "+h.Value)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// request turns the entry into a request to replay, with headers given
+// as "Name: value" lines. A header given more than once is joined into
+// one, as HTTP/2 captures split cookies.
+func (e harEntry) request(headerText string) (savedRequest, error) {
+	r := savedRequest{Method: strings.ToUpper(e.Request.Method), URL: e.Request.URL}
+	for i, line := range strings.Split(headerText, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(line, ":")
+		name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+		if !ok || name == "" {
+			return r, fmt.Errorf("line %d: expected Name: value", i+1)
+		}
+		if r.Headers == nil {
+			r.Headers = map[string]string{}
+		}
+		if prev := headerValue(r.Headers, name); prev != "" {
+			sep := ", "
+			if strings.EqualFold(name, "Cookie") {
+				sep = "; "
+			}
+			value = prev + sep + value
+		}
+		setHeaderFold(r.Headers, name, value)
+	}
+	r.Body = e.body()
+	return r, nil
+}
+
+// body is the request body, form-encoded from its parameters when the
+// capture only kept those
+func (e harEntry) body() string {
+	p := e.Request.PostData
+	if p == nil {
+		return ""
+	}
+	if p.Text != "" || len(p.Params) == 0 {
+		return p.Text
+	}
+	var fields []string
+	for _, param := range p.Params {
+		fields = append(fields, formEncode(param.Name)+"="+formEncode(param.Value))
+	}
+	return strings.Join(fields, "&")
+}
+
+// harBrowser lists the entries of a HAR file for replaying. Choosing one
+// opens its headers in an editor; the request is replayed with them as
+// edited. It asks for the file first when none was given with -har.
+type harBrowser struct {
+	open    bool
+	path    string
+	entries []harEntry
+	file    textinput.Model
+	filter  textinput.Model
+	idx     int
+	editing *harEntry
+	editor  textarea.Model
+	err     error
+}
+
+// load opens path in the browser, keeping the file prompt on
+// failure
+func (b harBrowser) load(path string) harBrowser {
+	entries, err := loadHAR(path)
+	if err != nil {
+		b.err = err
+		return b
+	}
+	filter := textinput.New()
+	filter.Prompt = "Filter: "
+	filter.Placeholder = "type to fuzzy search"
+	filter.Focus()
+	b.path, b.entries, b.filter, b.idx, b.err = path, entries, filter, 0, nil
+	return b
+}
+
+// matches returns the indexes of the entries matching the filter, in the
+// order they were captured
+func (b harBrowser) matches() []int {
+	var out []int
+	for i, e := range b.entries {
+		if _, _, ok := fuzzyMatch(b.filter.Value(), e.label()); ok {
+			out = append(out, i)
+		}
+	}
+	return out
+}
+
+// openHAR shows the HAR browser, asking for a file when none is loaded
+func (m model) openHAR() model {
+	if m.har.entries == nil {
+		file := textinput.New()
+		file.Prompt = "HAR file: "
+		file.Placeholder = "path of a .har saved from the browser's network tab"
+		file.Focus()
+		m.har.file = file
+	}
+	m.har.open = true
+	m.textInput.Blur()
+	return m
+}
+
+func (m model) closeHAR() model {
+	m.har.open = false
+	m.har.editing = nil
+	m.har.filter.Focus()
+	m.textInput.Focus()
+	return m
+}
+
+// updateHAR handles keys while the HAR browser is open
+func (m model) updateHAR(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	b := &m.har
+	if msg.Type == tea.KeyCtrlC {
+		return m, tea.Quit
+	}
+	var cmd tea.Cmd
+	switch {
+	case b.entries == nil:
+		switch msg.Type {
+		case tea.KeyEsc, tea.KeyCtrlN:
+			return m.closeHAR(), nil
+		case tea.KeyEnter:
+			m.har = b.load(strings.TrimSpace(b.file.Value()))
+			return m, nil
+		}
+		b.file, cmd = b.file.Update(msg)
+		return m, cmd
+
+	case b.editing != nil:
+		switch msg.Type {
+		case tea.KeyEsc:
+			b.editing = nil
+			b.filter.Focus()
+			return m, nil
+		case tea.KeyCtrlS:
+			if m.fetching {
+				return m, nil
+			}
+			r, err := b.editing.request(b.editor.Value())
+			if err != nil {
+				b.err = err
+				return m, nil
+			}
+			m = m.closeHAR()
+			return m.runSaved(r)
+		}
+		b.editor, cmd = b.editor.Update(msg)
+		return m, cmd
+	}
+
+	matches := b.matches()
+	switch msg.Type {
+	case tea.KeyEsc, tea.KeyCtrlN:
+		return m.closeHAR(), nil
+	case tea.KeyUp:
+		if b.idx > 0 {
+			b.idx--
+		}
+		return m, nil
+	case tea.KeyDown:
+		if b.idx < len(matches)-1 {
+			b.idx++
+		}
+		return m, nil
+	case tea.KeyEnter:
+		if b.idx < len(matches) {
+			e := b.entries[matches[b.idx]]
+			editor := textarea.New()
+			editor.CharLimit = 0
+			editor.SetWidth(m.viewport.Width - 4)
+			editor.SetHeight(max(3, m.viewport.Height-10))
+			editor.SetValue(e.headerText())
+			b.editing, b.editor, b.err = &e, editor, nil
+			b.filter.Blur()
+			return m, b.editor.Focus()
+		}
+		return m, nil
+	}
+	b.filter, cmd = b.filter.Update(msg)
+	b.idx = 0
+	return m, cmd
+}
+
+// renderHAR draws the HAR browser, limited to height rows
+func renderHAR(b harBrowser, height int) string {
+	var sb strings.Builder
+	sb.WriteString(headerStyle.Render("HAR"))
+	if b.path != "" {
+		sb.WriteString(historyDimStyle.Render(" " + b.path))
+	}
+	sb.WriteString("\n\n")
+	writeErr := func() {
+		if b.err != nil {
+			sb.WriteString(errorStyle.Render(b.err.Error()))
+			sb.WriteString("\n\n")
+		}
+	}
+
+	switch {
+	case b.entries == nil:
+		sb.WriteString(b.file.View())
+		sb.WriteString("\n\n")
+		writeErr()
+		sb.WriteString(historyDimStyle.Render("Enter: Open • Esc: Close"))
+		return sb.String()
+
+	case b.editing != nil:
+		e := b.editing
+		fmt.Fprintf(&sb, "%s %s\n", methodStyle.Render(e.Request.Method), e.Request.URL)
+		fmt.Fprintf(&sb, "%s\n", historyDimStyle.Render(fmt.Sprintf("Recorded: %d %s in %.0fms, %s",
+			e.Response.Status, e.Response.StatusText, e.Time, formatBytes(max(e.Response.Content.Size, 0)))))
+		if p := e.Request.PostData; p != nil {
+			fmt.Fprintf(&sb, "%s\n", historyDimStyle.Render(fmt.Sprintf("Body: %s %s", p.MimeType, formatBytes(int64(len(e.body()))))))
+		}
+		sb.WriteString("\n")
+		writeErr()
+		sb.WriteString(b.editor.View())
+		sb.WriteString(historyDimStyle.Render("\n\nOne header per line • Ctrl+S: Replay • Esc: Back to the list"))
+		return sb.String()
+	}
+
+	matches := b.matches()
+	sb.WriteString(b.filter.View())
+	sb.WriteString(historyDimStyle.Render(fmt.Sprintf("  (%d of %d)", len(matches), len(b.entries))))
+	sb.WriteString("\n\n")
+	writeErr()
+	if len(matches) == 0 {
+		sb.WriteString(historyDimStyle.Render("No matching requests"))
+		sb.WriteString("\n")
+	}
+
+	// Keep the selection in view
+	rows := max(height-6, 1)
+	start := 0
+	if b.idx >= rows {
+		start = b.idx - rows + 1
+	}
+	for i := start; i < len(matches) && i < start+rows; i++ {
+		e := b.entries[matches[i]]
+		status := historyStatus(historyEntry{Status: e.Response.Status})
+		if e.Response.Status == 0 {
+			status = errorStyle.Render("ERR")
+		}
+		line := fmt.Sprintf("%s  %s  %s %s", status,
+			historyDimStyle.Render(fmt.Sprintf("%6.0fms", e.Time)),
+			methodStyle.Render(e.Request.Method), e.Request.URL)
+		if i == b.idx {
+			sb.WriteString(selectedSuggestionStyle.Render("› ") + line)
+		} else {
+			sb.WriteString("  " + line)
+		}
+		sb.WriteString("\n")
+	}
+	sb.WriteString(historyDimStyle.Render("\n↑/↓: Select • Enter: Edit and replay • Esc: Close"))
+	return sb.String()
+}
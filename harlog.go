@@ -0,0 +1,200 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"runtime/debug"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// harBodyLimit bounds the response bodies kept in a recorded HAR file
+const harBodyLimit = 1 << 20
+
+// harRecorder records the requests of the session, started with
+// -record-har, as a HAR file. The file is rewritten after every response
+// so it is complete whenever lazyhttp exits.
+type harRecorder struct {
+	path    string
+	entries []harEntry
+	pending *resolvedRequest
+}
+
+// begin notes the request being sent, nil-safe like the other methods
+func (h *harRecorder) begin(r resolvedRequest) {
+	if h != nil {
+		h.pending = &r
+	}
+}
+
+// record adds the outcome of the request begun last and writes the file
+func (h *harRecorder) record(msg fetchMsg) error {
+	if h == nil || h.pending == nil {
+		return nil
+	}
+	h.entries = append(h.entries, newHAREntry(*h.pending, msg))
+	h.pending = nil
+
+	version := "(devel)"
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" {
+		version = info.Main.Version
+	}
+	har := harFile{Log: harLog{Version: "1.2", Creator: harCreator{Name: "lazyhttp", Version: version}, Entries: h.entries}}
+	data, err := json.MarshalIndent(har, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := h.path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, h.path)
+}
+
+// newHAREntry describes a request and its response. Headers, URL and body
+// show secrets from templates masked as in the preview; cookies and
+// other credentials the server handed out are kept as sent.
+func newHAREntry(r resolvedRequest, msg fetchMsg) harEntry {
+	e := harEntry{Timings: harTimings{Blocked: -1, DNS: -1, Connect: -1, SSL: -1}}
+	started := time.Now()
+	if t := msg.timing; t != nil {
+		t.mu.Lock()
+		started = t.start
+		e.Time, e.Timings = harTimingsOf(t)
+		if host, _, err := net.SplitHostPort(t.remote); err == nil {
+			e.ServerIPAddress = host
+		}
+		t.mu.Unlock()
+	}
+	e.StartedDateTime = started.Format(time.RFC3339Nano)
+	if msg.err != nil {
+		e.Error = msg.err.Error()
+	}
+
+	// Followed redirects leave the final URL, which has no masked version
+	target := r.display
+	if msg.url != "" && msg.url != r.url {
+		target = msg.url
+	}
+	proto := msg.proto
+	if proto == "" {
+		proto = "HTTP/1.1"
+	}
+	sent := msg.sent
+	if sent == nil {
+		sent = http.Header{}
+	}
+	sent = sent.Clone()
+	for name, value := range r.headers {
+		if masked := r.displayHeaders[name]; masked != value {
+			sent.Set(name, masked)
+		}
+	}
+	e.Request = harRequest{
+		Method:      r.method,
+		URL:         target,
+		HTTPVersion: proto,
+		Cookies:     harCookies((&http.Request{Header: sent}).Cookies()),
+		Headers:     harPairs(sent),
+		QueryString: []harPair{},
+		HeadersSize: -1,
+		BodySize:    int64(len(r.displayBody)),
+	}
+	if u, err := url.Parse(target); err == nil {
+		e.Request.QueryString = harPairs(u.Query())
+	}
+	switch {
+	case r.bodyFile != "":
+		e.Request.PostData = &harPostData{MimeType: sent.Get("Content-Type"), Comment: "sent from the file " + r.bodyFile}
+		e.Request.BodySize = -1
+	case r.body != "":
+		e.Request.PostData = &harPostData{MimeType: sent.Get("Content-Type"), Text: r.displayBody}
+	}
+
+	e.Response = harResponse{
+		Status:      msg.statusCode,
+		StatusText:  strings.TrimSpace(strings.TrimPrefix(msg.status, strconv.Itoa(msg.statusCode))),
+		HTTPVersion: proto,
+		Cookies:     harCookies((&http.Response{Header: msg.header}).Cookies()),
+		Headers:     harPairs(msg.header),
+		RedirectURL: msg.header.Get("Location"),
+		HeadersSize: -1,
+		BodySize:    msg.wireSize,
+	}
+	if msg.err != nil {
+		e.Response.HTTPVersion, e.Response.BodySize = "", -1
+	}
+	content := &e.Response.Content
+	content.Size = int64(len(msg.body))
+	content.MimeType = msg.header.Get("Content-Type")
+	body := msg.body
+	if len(body) > harBodyLimit {
+		body = body[:harBodyLimit]
+		content.Comment = "truncated to " + formatBytes(harBodyLimit)
+	}
+	if utf8.Valid(body) {
+		content.Text = string(body)
+	} else {
+		content.Text, content.Encoding = base64.StdEncoding.EncodeToString(body), "base64"
+	}
+	return e
+}
+
+// harTimingsOf splits a request's time into HAR phases; t is locked
+func harTimingsOf(t *requestTiming) (float64, harTimings) {
+	ms := func(from, to time.Time) float64 {
+		if from.IsZero() || to.IsZero() {
+			return -1
+		}
+		return float64(to.Sub(from).Microseconds()) / 1000
+	}
+	timings := harTimings{Blocked: -1, DNS: ms(t.dnsStart, t.dnsDone), Connect: -1, SSL: ms(t.tlsStart, t.tlsDone)}
+	if !t.reused && len(t.dials) > 0 {
+		connected := t.tlsDone
+		if connected.IsZero() {
+			for _, d := range t.dials {
+				if d.err == nil && !d.done.IsZero() {
+					connected = d.done
+				}
+			}
+		}
+		timings.Connect = ms(t.dials[0].start, connected)
+	}
+	// When writing the request began isn't traced, so it can't be told
+	// apart and sending is left at 0
+	timings.Send = 0
+	timings.Wait = max(ms(t.wrote, t.firstByte), 0)
+	timings.Receive = max(ms(t.firstByte, t.end), 0)
+	return max(ms(t.start, t.end), 0), timings
+}
+
+// harPairs lists headers or query parameters sorted by name
+func harPairs(values map[string][]string) []harPair {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	pairs := []harPair{}
+	for _, name := range names {
+		for _, value := range values[name] {
+			pairs = append(pairs, harPair{name, value})
+		}
+	}
+	return pairs
+}
+
+func harCookies(cookies []*http.Cookie) []harPair {
+	pairs := []harPair{}
+	for _, c := range cookies {
+		pairs = append(pairs, harPair{c.Name, c.Value})
+	}
+	return pairs
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+const (
+	// binarySniffLen is how much of the body is inspected to decide whether
+	// it is text, mirroring what git does for diffs
+	binarySniffLen = 8000
+
+	// maxHexDumpBytes keeps the dump of huge bodies to a browsable size
+	maxHexDumpBytes = 256 * 1024
+)
+
+var (
+	hexOffsetStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("#888888"))
+	hexZeroStyle   = lipgloss.NewStyle().Foreground(lipgloss.Color("#5C6370"))
+	hexASCIIStyle  = lipgloss.NewStyle().Foreground(lipgloss.Color("#98C379"))
+)
+
+// isBinary reports whether body looks like non-text content: it contains
+// NUL bytes or a significant share of control characters
+func isBinary(body []byte) bool {
+	sample := body
+	if len(sample) > binarySniffLen {
+		sample = sample[:binarySniffLen]
+	}
+	if len(sample) == 0 {
+		return false
+	}
+	if bytes.IndexByte(sample, 0) >= 0 {
+		return true
+	}
+
+	control := 0
+	for _, b := range sample {
+		if (b < 0x20 && b != '\t' && b != '\n' && b != '\r' && b != '\f') || b == 0x7f {
+			control++
+		}
+	}
+	return control*10 > len(sample)
+}
+
+// hexDump renders body as a classic offset / hex / ASCII dump, 16 bytes per
+// line
+func hexDump(body []byte) string {
+	data := body
+	truncated := len(data) > maxHexDumpBytes
+	if truncated {
+		data = data[:maxHexDumpBytes]
+	}
+
+	var sb strings.Builder
+	for offset := 0; offset < len(data); offset += 16 {
+		end := offset + 16
+		if end > len(data) {
+			end = len(data)
+		}
+		line := data[offset:end]
+
+		sb.WriteString(hexOffsetStyle.Render(fmt.Sprintf("%08x", offset)))
+		sb.WriteString("  ")
+
+		for i := 0; i < 16; i++ {
+			if i == 8 {
+				sb.WriteByte(' ')
+			}
+			if i >= len(line) {
+				sb.WriteString("   ")
+				continue
+			}
+			h := fmt.Sprintf("%02x", line[i])
+			if line[i] == 0 {
+				h = hexZeroStyle.Render(h)
+			}
+			sb.WriteString(h)
+			sb.WriteByte(' ')
+		}
+
+		ascii := make([]byte, len(line))
+		for i, b := range line {
+			if b >= 0x20 && b < 0x7f {
+				ascii[i] = b
+			} else {
+				ascii[i] = '.'
+			}
+		}
+		sb.WriteString(" |")
+		sb.WriteString(hexASCIIStyle.Render(string(ascii)))
+		sb.WriteString("|\n")
+	}
+
+	if truncated {
+		sb.WriteString(hexOffsetStyle.Render(fmt.Sprintf("\n… %s more not shown",
+			formatBytes(int64(len(body)-maxHexDumpBytes)))))
+	}
+	return sb.String()
+}
@@ -0,0 +1,341 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// historyEntry records one request sent from the TUI
+type historyEntry struct {
+	Method string    `json:"method"`
+	URL    string    `json:"url"`
+	Line   string    `json:"line"` // the input line as typed, restored on selection
+	Status int       `json:"status,omitempty"`
+	Error  string    `json:"error,omitempty"`
+	Time   time.Time `json:"time"`
+}
+
+// historyFile is the history's file name inside the workspace directory
+const historyFile = "history.jsonl"
+
+// historyLimit is the number of entries kept, set with -history-size
+var historyLimit = 1000
+
+var (
+	historyMatchStyle = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("#FFCC00"))
+	historyDimStyle   = lipgloss.NewStyle().Foreground(lipgloss.Color("#888888"))
+)
+
+// recordHistory completes the pending entry of the request that just
+// finished and appends it to the history
+func (m model) recordHistory(msg fetchMsg) model {
+	if m.pending == nil {
+		return m
+	}
+	entry := *m.pending
+	m.pending = nil
+	if msg.err != nil {
+		entry.Error = msg.err.Error()
+	} else {
+		entry.Status = msg.statusCode
+	}
+	m.history = append(m.history, entry)
+
+	// A history that can't be written isn't worth interrupting the
+	// session for; it just won't survive it
+	if len(m.history) > historyLimit {
+		m.history = m.history[len(m.history)-historyLimit:]
+		saveHistory(m.history)
+	} else {
+		appendHistory(entry)
+	}
+	return m
+}
+
+// loadHistory reads the history saved by previous sessions, keeping the
+// newest historyLimit entries. Incognito sessions start empty.
+func loadHistory() ([]historyEntry, error) {
+	if incognito {
+		return nil, nil
+	}
+	path, err := workspaceFile(historyFile)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var history []historyEntry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+	for scanner.Scan() {
+		var e historyEntry
+		// Skip lines that don't parse, e.g. one cut short by a crash
+		if json.Unmarshal(scanner.Bytes(), &e) == nil {
+			history = append(history, e)
+		}
+	}
+	if len(history) > historyLimit {
+		history = history[len(history)-historyLimit:]
+	}
+	return history, scanner.Err()
+}
+
+// appendHistory adds one entry to the history file; a no-op in incognito
+// sessions
+func appendHistory(e historyEntry) error {
+	if incognito {
+		return nil
+	}
+	path, err := workspaceFile(historyFile)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// saveHistory rewrites the history file, used to drop entries beyond the
+// size limit
+func saveHistory(history []historyEntry) error {
+	if incognito {
+		return nil
+	}
+	path, err := workspaceFile(historyFile)
+	if err != nil {
+		return err
+	}
+	var buf []byte
+	for _, e := range history {
+		data, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		buf = append(append(buf, data...), '\n')
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, buf, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// historyMatch is an entry that matches the filter, with the positions of
+// the matched runes in its label
+type historyMatch struct {
+	index     int
+	score     int
+	positions []int
+}
+
+func (e historyEntry) label() string {
+	return e.Method + " " + e.URL
+}
+
+// fuzzyMatch reports whether all runes of pattern appear in order in s,
+// ignoring case. Runes matched consecutively or at the start of a word
+// (after /, ., ?, & and the like) score higher.
+func fuzzyMatch(pattern, s string) (int, []int, bool) {
+	if pattern == "" {
+		return 0, nil, true
+	}
+	p := []rune(strings.ToLower(pattern))
+	text := []rune(s)
+
+	var positions []int
+	score, pi, prev := 0, 0, -2
+	for i, r := range text {
+		if pi == len(p) {
+			break
+		}
+		if unicode.ToLower(r) != p[pi] {
+			continue
+		}
+		score++
+		if i == prev+1 {
+			score += 3
+		}
+		if i == 0 || !unicode.IsLetter(text[i-1]) && !unicode.IsDigit(text[i-1]) {
+			score += 2
+		}
+		positions = append(positions, i)
+		prev = i
+		pi++
+	}
+	if pi < len(p) {
+		return 0, nil, false
+	}
+	// Prefer tighter matches
+	score -= (positions[len(positions)-1] - positions[0]) / 4
+	return score, positions, true
+}
+
+// filterHistory returns the entries matching the filter, best first; with
+// no filter the newest entries come first
+func filterHistory(history []historyEntry, filter string) []historyMatch {
+	var matches []historyMatch
+	for i := len(history) - 1; i >= 0; i-- {
+		if score, positions, ok := fuzzyMatch(filter, history[i].label()); ok {
+			matches = append(matches, historyMatch{index: i, score: score, positions: positions})
+		}
+	}
+	sort.SliceStable(matches, func(a, b int) bool {
+		return matches[a].score > matches[b].score
+	})
+	return matches
+}
+
+// openHistory shows the history overlay with an empty filter
+func (m model) openHistory() model {
+	filter := textinput.New()
+	filter.Prompt = "Filter: "
+	filter.Placeholder = "type to fuzzy search"
+	filter.Focus()
+	m.historyFilter = filter
+	m.historyIdx = 0
+	m.showHistory = true
+	m.textInput.Blur()
+	return m
+}
+
+func (m model) closeHistory() model {
+	m.showHistory = false
+	m.textInput.Focus()
+	return m
+}
+
+// updateHistory handles keys while the history overlay is open
+func (m model) updateHistory(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	matches := filterHistory(m.history, m.historyFilter.Value())
+	switch msg.Type {
+	case tea.KeyCtrlC:
+		return m, tea.Quit
+	case tea.KeyEsc, tea.KeyCtrlR:
+		return m.closeHistory(), nil
+	case tea.KeyUp:
+		if m.historyIdx > 0 {
+			m.historyIdx--
+		}
+		return m, nil
+	case tea.KeyDown:
+		if m.historyIdx < len(matches)-1 {
+			m.historyIdx++
+		}
+		return m, nil
+	case tea.KeyEnter:
+		if m.historyIdx < len(matches) {
+			entry := m.history[matches[m.historyIdx].index]
+			m.textInput.SetValue(entry.Line)
+			m.textInput.CursorEnd()
+			m.draft = nil
+		}
+		return m.closeHistory(), nil
+	}
+
+	var cmd tea.Cmd
+	m.historyFilter, cmd = m.historyFilter.Update(msg)
+	m.historyIdx = 0
+	return m, cmd
+}
+
+// renderHistory draws the history overlay, limited to height rows
+func renderHistory(history []historyEntry, filter textinput.Model, selected, height int) string {
+	matches := filterHistory(history, filter.Value())
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s %s\n\n", headerStyle.Render("History"),
+		historyDimStyle.Render(fmt.Sprintf("(%d of %d)", len(matches), len(history))))
+	sb.WriteString(filter.View())
+	sb.WriteString("\n\n")
+
+	if len(matches) == 0 {
+		sb.WriteString(historyDimStyle.Render("No matching requests"))
+		sb.WriteString("\n")
+	}
+
+	// Keep the selection in view
+	rows := height - 6
+	if rows < 1 {
+		rows = 1
+	}
+	start := 0
+	if selected >= rows {
+		start = selected - rows + 1
+	}
+	for i := start; i < len(matches) && i < start+rows; i++ {
+		e := history[matches[i].index]
+		line := fmt.Sprintf("%s  %s  %s",
+			historyDimStyle.Render(e.Time.Format("Jan 02 15:04")),
+			historyStatus(e),
+			highlightMatches(e.label(), matches[i].positions))
+		if i == selected {
+			sb.WriteString(selectedSuggestionStyle.Render("› ") + line)
+		} else {
+			sb.WriteString("  " + line)
+		}
+		sb.WriteString("\n")
+	}
+
+	sb.WriteString(historyDimStyle.Render("\n↑/↓: Select • Enter: Load into input • Esc: Close"))
+	return sb.String()
+}
+
+// historyStatus colors a status code by class
+func historyStatus(e historyEntry) string {
+	switch {
+	case e.Error != "":
+		return errorStyle.Render("ERR")
+	case e.Status >= 500:
+		return errorStyle.Render(fmt.Sprint(e.Status))
+	case e.Status >= 400:
+		return lipgloss.NewStyle().Foreground(lipgloss.Color("#FFCC00")).Render(fmt.Sprint(e.Status))
+	default:
+		return lipgloss.NewStyle().Foreground(lipgloss.Color("#98C379")).Render(fmt.Sprint(e.Status))
+	}
+}
+
+// highlightMatches emphasizes the runes at positions
+func highlightMatches(s string, positions []int) string {
+	if len(positions) == 0 {
+		return s
+	}
+	var sb strings.Builder
+	next := 0
+	for i, r := range []rune(s) {
+		if next < len(positions) && positions[next] == i {
+			sb.WriteString(historyMatchStyle.Render(string(r)))
+			next++
+		} else {
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"strings"
+	"time"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+)
+
+// http3Transport speaks HTTP/3 only, over QUIC to the UDP port of the URL,
+// which servers advertising h3 in Alt-Svc mostly share with TCP. Proxies
+// aren't used, as they only tunnel TCP.
+type http3Transport struct {
+	h3     *http3.Transport
+	header time.Duration // response header timeout, 0 for none
+}
+
+func newHTTP3Transport(t requestTimeouts, resolve connectOverrides) http3Transport {
+	d := &quicDialer{timeouts: t, resolve: resolve}
+	return http3Transport{
+		h3: &http3.Transport{
+			TLSClientConfig: tlsConfig(),
+			// QUIC has no connection before its handshake, so the TLS
+			// timeout bounds both
+			QUICConfig: &quic.Config{HandshakeIdleTimeout: t.tls()},
+			Dial:       d.dial,
+		},
+		header: t.responseHeader(),
+	}
+}
+
+func (t http3Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Scheme != "https" {
+		return nil, errors.New("HTTP/3 only runs over TLS, use an https:// URL or another HTTP version")
+	}
+	if max := tlsConfig().MaxVersion; max != 0 && max < tls.VersionTLS13 {
+		return nil, errors.New("HTTP/3 needs TLS 1.3, which -tls-max or -ciphers rule out")
+	}
+	resp, err := roundTripWithHeaderTimeout(t.h3, req, t.header)
+	return resp, describeHTTP3Error(err)
+}
+
+// quicFallbackDelay is the head start of the addresses of the first family
+// over those of the other, net.Dialer's default over TCP
+const quicFallbackDelay = 300 * time.Millisecond
+
+// quicDialer opens the QUIC connections of an HTTP/3 transport to the
+// addresses resolve overrides. Each connection has a UDP socket of its own,
+// closed with it, so idle connections timing out leave nothing open.
+type quicDialer struct {
+	timeouts requestTimeouts
+	resolve  connectOverrides
+}
+
+// dial connects to addr, trying its addresses as net.Dialer does over TCP:
+// those of the family of the first one in turn, and those of the other
+// family alongside once the first have had a head start. The lookup, the
+// attempts and the handshake are traced as they are over TCP, so the
+// timing view shows them.
+func (d *quicDialer) dial(ctx context.Context, addr string, cfg *tls.Config, conf *quic.Config) (*quic.Conn, error) {
+	to := d.resolve.target(addr)
+	if strings.HasPrefix(to, unixSocketTarget) {
+		return nil, errors.New("HTTP/3 runs over UDP and can't reach a Unix socket, send it with HTTP/1.1 or 2")
+	}
+	if to != "" {
+		addr = to
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	dialer := d.timeouts.dialer()
+	resolver := dialer.Resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	lookup, cancel := context.WithTimeout(ctx, d.timeouts.connect())
+	ips, err := resolver.LookupIP(lookup, "ip", host)
+	cancel()
+	if err != nil {
+		return nil, err
+	}
+	portNum, err := net.LookupPort("udp", port)
+	if err != nil {
+		return nil, err
+	}
+	var primaries, fallbacks []*net.UDPAddr
+	for _, ip := range ips {
+		udpAddr := &net.UDPAddr{IP: ip, Port: portNum}
+		if (ip.To4() != nil) == (ips[0].To4() != nil) {
+			primaries = append(primaries, udpAddr)
+		} else {
+			fallbacks = append(fallbacks, udpAddr)
+		}
+	}
+
+	trace := httptrace.ContextClientTrace(ctx)
+	if trace != nil && trace.TLSHandshakeStart != nil {
+		trace.TLSHandshakeStart()
+	}
+	conn, err := d.dialParallel(ctx, primaries, fallbacks, dialer, cfg, conf)
+	var state tls.ConnectionState
+	if conn != nil {
+		state = conn.ConnectionState().TLS
+	}
+	if trace != nil && trace.TLSHandshakeDone != nil {
+		trace.TLSHandshakeDone(state, err)
+	}
+	return conn, err
+}
+
+// dialParallel races the primary addresses against the fallbacks, started
+// quicFallbackDelay later or as soon as the primaries fail, and returns
+// the first connection or else the error of the primaries
+func (d *quicDialer) dialParallel(ctx context.Context, primaries, fallbacks []*net.UDPAddr, dialer *net.Dialer, cfg *tls.Config, conf *quic.Config) (*quic.Conn, error) {
+	if len(fallbacks) == 0 {
+		return d.dialSerial(ctx, primaries, dialer, cfg, conf)
+	}
+	type result struct {
+		conn    *quic.Conn
+		err     error
+		primary bool
+	}
+	results := make(chan result)
+	returned := make(chan struct{})
+	defer close(returned)
+	race := func(ctx context.Context, addrs []*net.UDPAddr, primary bool) {
+		conn, err := d.dialSerial(ctx, addrs, dialer, cfg, conf)
+		select {
+		case results <- result{conn, err, primary}:
+		case <-returned:
+			// Another address connected first
+			if conn != nil {
+				conn.CloseWithError(0, "")
+			}
+		}
+	}
+
+	primaryCtx, cancelPrimary := context.WithCancel(ctx)
+	defer cancelPrimary()
+	go race(primaryCtx, primaries, true)
+	fallbackTimer := time.NewTimer(quicFallbackDelay)
+	defer fallbackTimer.Stop()
+	var primaryErr error
+	for pending := 2; ; {
+		select {
+		case <-fallbackTimer.C:
+			fallbackCtx, cancelFallback := context.WithCancel(ctx)
+			defer cancelFallback()
+			go race(fallbackCtx, fallbacks, false)
+		case res := <-results:
+			if res.err == nil {
+				return res.conn, nil
+			}
+			if pending--; pending == 0 {
+				if primaryErr == nil {
+					primaryErr = res.err
+				}
+				return nil, primaryErr
+			}
+			if res.primary {
+				primaryErr = res.err
+				if fallbackTimer.Stop() {
+					fallbackTimer.Reset(0)
+				}
+			}
+		}
+	}
+}
+
+// dialSerial tries addrs in turn and returns the first connection or the
+// error of the first address
+func (d *quicDialer) dialSerial(ctx context.Context, addrs []*net.UDPAddr, dialer *net.Dialer, cfg *tls.Config, conf *quic.Config) (*quic.Conn, error) {
+	var firstErr error
+	for _, addr := range addrs {
+		conn, err := d.dialAddr(ctx, addr, dialer, cfg, conf)
+		if err == nil {
+			return conn, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, firstErr
+}
+
+// dialAddr opens a connection to one address from a UDP socket of its own,
+// closed when the connection ends
+func (d *quicDialer) dialAddr(ctx context.Context, addr *net.UDPAddr, dialer *net.Dialer, cfg *tls.Config, conf *quic.Config) (*quic.Conn, error) {
+	if dialer.Control != nil {
+		if err := dialer.Control("udp", addr.String(), nil); err != nil {
+			return nil, err
+		}
+	}
+	trace := httptrace.ContextClientTrace(ctx)
+	if trace != nil && trace.ConnectStart != nil {
+		trace.ConnectStart("udp", addr.String())
+	}
+	conn, err := d.dialUDP(ctx, addr, cfg, conf)
+	// A handshake that never hears back ends on its idle timeout
+	var timeout *quic.HandshakeTimeoutError
+	var idle *quic.IdleTimeoutError
+	if errors.As(err, &timeout) || errors.As(err, &idle) {
+		err = fmt.Errorf("QUIC handshake timeout: no answer from %s over UDP within %s, the server may not speak HTTP/3 on that port or a firewall drops UDP (%v)", addr, d.timeouts.tls(), err)
+	}
+	if trace != nil && trace.ConnectDone != nil {
+		trace.ConnectDone("udp", addr.String(), err)
+	}
+	return conn, err
+}
+
+func (d *quicDialer) dialUDP(ctx context.Context, addr *net.UDPAddr, cfg *tls.Config, conf *quic.Config) (*quic.Conn, error) {
+	udp, err := net.ListenUDP("udp", nil)
+	if err != nil {
+		return nil, err
+	}
+	tr := &quic.Transport{Conn: udp}
+	closeSocket := func() {
+		tr.Close()
+		udp.Close()
+	}
+	conn, err := tr.Dial(ctx, addr, cfg, conf)
+	if err != nil {
+		closeSocket()
+		return nil, err
+	}
+	go func() {
+		<-conn.Context().Done()
+		closeSocket()
+	}()
+	return conn, nil
+}
+
+// describeHTTP3Error explains the QUIC errors that end a request, which
+// quic-go reports with their bare codes
+func describeHTTP3Error(err error) error {
+	var transportErr *quic.TransportError
+	var appErr *quic.ApplicationError
+	var idle *quic.IdleTimeoutError
+	switch {
+	case err == nil:
+		return nil
+	case errors.As(err, &idle):
+		return fmt.Errorf("the QUIC connection went quiet and timed out, the server or the path to it stopped answering: %w", err)
+	case errors.As(err, &transportErr) && !transportErr.Remote:
+		// Certificates and pins failing here explain themselves
+		return err
+	case errors.As(err, &transportErr) && transportErr.ErrorCode.IsCryptoError():
+		return fmt.Errorf("the server ended the QUIC handshake with a TLS alert, it may not offer h3 or rejected the TLS settings: %w", err)
+	case errors.As(err, &transportErr):
+		return fmt.Errorf("QUIC connection closed by the server (%s): %w", transportErr.ErrorCode, err)
+	case errors.As(err, &appErr) && appErr.Remote:
+		return fmt.Errorf("HTTP/3 connection closed by the server (error %#x): %w", uint64(appErr.ErrorCode), err)
+	}
+	return err
+}
@@ -0,0 +1,393 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// httpFiles are .http and .rest files opened with -http, shown in the
+// sidebar next to the collections of the workspace
+var httpFiles []string
+
+// httpEnvFile and httpPrivateEnvFile are the environments of the
+// JetBrains HTTP client, next to its request files
+const (
+	httpEnvFile        = "http-client.env.json"
+	httpPrivateEnvFile = "http-client.private.env.json"
+)
+
+// isHTTPFile tells whether path is a request file of the VS Code REST
+// Client or the JetBrains HTTP client
+func isHTTPFile(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".http" || ext == ".rest"
+}
+
+// parseHTTPFlag handles -http, adding a request file to the sidebar
+func parseHTTPFlag(path string) error {
+	if !isHTTPFile(path) {
+		return fmt.Errorf("%s: expected a .http or .rest file", path)
+	}
+	if _, err := os.Stat(path); err != nil {
+		return err
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	httpFiles = append(httpFiles, abs)
+	return nil
+}
+
+// httpRequestReference matches the request variables of the REST Client,
+// {{login.response.body.$.token}} or {{login.response.headers.Location}}
+var httpRequestReference = regexp.MustCompile(`^([\w-]+)\.(request|response)\.(body|headers)\.(.+)$`)
+
+// httpJSONIndex matches the array indexes of JSONPath expressions
+var httpJSONIndex = regexp.MustCompile(`\[(\d+)\]`)
+
+// httpVariableName matches what can't be part of the name of a variable
+// made from a request variable
+var httpVariableName = regexp.MustCompile(`[^a-z0-9]+`)
+
+// httpDynamicVariables maps the system variables of the REST Client and
+// the JetBrains HTTP client to lazyhttp's, by their first word
+var httpDynamicVariables = map[string]string{
+	"$guid":           "$uuid",
+	"$uuid":           "$uuid",
+	"$random.uuid":    "$uuid",
+	"$timestamp":      "$timestamp",
+	"$isoTimestamp":   "$isoTimestamp",
+	"$randomInt":      "$randomInt",
+	"$random.integer": "$randomInt",
+}
+
+// parseHTTPFile reads a .http or .rest file: requests separated by ###
+// lines, named by the separator or a "# @name" comment, and file
+// variables defined as "@name = value", which become collection
+// variables. Request variables reading an earlier response become
+// extractions; response handler scripts are left out.
+func parseHTTPFile(path string) (importResult, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return importResult{}, err
+	}
+	return parseHTTPText(path, data)
+}
+
+// parseHTTPText parses the contents of a .http file, such as the unsaved
+// buffer of an editor, as if read from path
+func parseHTTPText(path string, data []byte) (importResult, error) {
+	c := &collection{Name: filepath.Base(path)}
+	result := importResult{collection: c}
+	warned := map[string]bool{}
+	warn := func(format string, a ...interface{}) {
+		if w := fmt.Sprintf(format, a...); !warned[w] {
+			warned[w] = true
+			result.warnings = append(result.warnings, w)
+		}
+	}
+
+	type pending struct {
+		r                    savedRequest
+		separator, named     string
+		started, inBody      bool
+		body                 []string
+		inScript, inResponse bool
+		block                int // line of the separator, 0 for the first request
+	}
+	var p pending
+	var requests []savedRequest
+	finish := func() {
+		if p.started {
+			r := p.r
+			switch {
+			case p.named != "":
+				r.Name = p.named
+			case p.separator != "":
+				r.Name = p.separator
+			case strings.Contains(r.URL, "://"):
+				// Unnamed requests go by their path
+				_, r.Name, _ = strings.Cut(strings.SplitN(r.URL, "://", 2)[1], "/")
+				r.Name = "/" + r.Name
+			default:
+				r.Name = r.URL
+			}
+			body := strings.TrimRight(strings.Join(p.body, "\n"), "\n ")
+			if file, ok := strings.CutPrefix(body, "<"); ok && !strings.Contains(body, "\n") {
+				if strings.HasPrefix(file, "@") {
+					warn("%s: variables in the body file aren't expanded", r.Name)
+					file = file[1:]
+				}
+				file = strings.TrimSpace(file)
+				if !filepath.IsAbs(file) {
+					if dir, err := filepath.Abs(filepath.Dir(path)); err == nil {
+						file = filepath.Join(dir, file)
+					}
+				}
+				r.BodyFile = file
+			} else {
+				r.Body = body
+			}
+			r.line = p.block
+			requests = append(requests, r)
+		} else if p.named != "" {
+			warn("%s: @name without a request", p.named)
+		}
+		p = pending{}
+	}
+
+	for n, line := range strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "###") {
+			finish()
+			p.separator = strings.TrimSpace(strings.TrimLeft(trimmed, "#"))
+			p.block = n + 1
+			continue
+		}
+
+		// Response handlers and redirections follow the body
+		if p.inScript {
+			if strings.Contains(trimmed, "%}") {
+				p.inScript = false
+			}
+			continue
+		}
+		if p.started && (strings.HasPrefix(trimmed, "> ") || strings.HasPrefix(trimmed, ">>") || strings.HasPrefix(trimmed, "<> ")) {
+			if strings.HasPrefix(trimmed, "> {%") && !strings.Contains(trimmed, "%}") {
+				p.inScript = true
+			}
+			if strings.HasPrefix(trimmed, "> ") {
+				warn("response handler scripts aren't supported and were left out")
+			}
+			p.inResponse = true
+			continue
+		}
+		if p.inResponse {
+			continue
+		}
+
+		if p.inBody {
+			p.body = append(p.body, line)
+			continue
+		}
+		if comment, ok := httpComment(trimmed); ok {
+			if meta, ok := strings.CutPrefix(comment, "@"); ok {
+				key, value, _ := strings.Cut(meta, " ")
+				switch key {
+				case "name":
+					p.named = strings.TrimSpace(value)
+				case "prompt":
+					// lazyhttp prompts for undefined variables anyway
+				default:
+					warn("the @%s setting isn't supported and was ignored", key)
+				}
+			}
+			continue
+		}
+		if !p.started {
+			if trimmed == "" {
+				continue
+			}
+			if name, value, ok := strings.Cut(trimmed, "="); ok && strings.HasPrefix(trimmed, "@") {
+				if c.Variables == nil {
+					c.Variables = map[string]string{}
+				}
+				c.Variables[strings.TrimSpace(name[1:])] = strings.TrimSpace(value)
+				continue
+			}
+			p.started = true
+			p.r.Method, p.r.URL, p.r.HTTPVersion = httpRequestLine(trimmed)
+			continue
+		}
+		switch {
+		case trimmed == "":
+			p.inBody = true
+		case len(p.r.Headers) == 0 && (strings.HasPrefix(trimmed, "?") || strings.HasPrefix(trimmed, "&")):
+			// Query parameters continued on their own lines
+			p.r.URL += trimmed
+		default:
+			name, value, ok := strings.Cut(trimmed, ":")
+			if !ok {
+				warn("%s: ignored the line %q, expected a header", p.r.URL, trimmed)
+				continue
+			}
+			if p.r.Headers == nil {
+				p.r.Headers = map[string]string{}
+			}
+			p.r.Headers[strings.TrimSpace(name)] = strings.TrimSpace(value)
+		}
+	}
+	finish()
+	if len(requests) == 0 {
+		return importResult{}, errors.New("no requests found")
+	}
+
+	// Request variables become extractions on the request they read from,
+	// which the request reading them depends on
+	index := map[string]int{}
+	for i, r := range requests {
+		index[r.Name] = i
+	}
+	convert := func(s string, reader *savedRequest) string {
+		return templatePattern.ReplaceAllStringFunc(s, func(placeholder string) string {
+			name := templatePattern.FindStringSubmatch(placeholder)[1]
+			if strings.HasPrefix(name, "$") {
+				fields := strings.Fields(name)
+				switch {
+				case fields[0] == "$processEnv" && len(fields) == 2:
+					return "{{$env." + fields[1] + "}}"
+				case fields[0] == "$datetime" || fields[0] == "$localDatetime":
+					return "{{$isoTimestamp}}"
+				}
+				if mapped, ok := httpDynamicVariables[fields[0]]; ok {
+					if len(fields) > 1 {
+						warn("{{%s}}: arguments of %s aren't supported and were dropped", name, fields[0])
+					}
+					return "{{" + mapped + "}}"
+				}
+				warn("{{%s}} has no lazyhttp equivalent and was left as is", name)
+				return placeholder
+			}
+			ref := httpRequestReference.FindStringSubmatch(name)
+			if ref == nil {
+				return placeholder
+			}
+			source, ok := index[ref[1]]
+			if !ok || ref[2] != "response" || ref[4] == "*" {
+				warn("{{%s}} can't be converted and was left as is", name)
+				return placeholder
+			}
+			path := "header." + ref[4]
+			if ref[3] == "body" {
+				path = httpJSONIndex.ReplaceAllString(strings.TrimPrefix(strings.TrimPrefix(ref[4], "$"), "."), ".$1")
+				path = "body." + strings.TrimPrefix(path, ".")
+			}
+			variable := strings.Trim(httpVariableName.ReplaceAllString(strings.ToLower(ref[1]+"_"+ref[4]), "_"), "_")
+			r := &requests[source]
+			if r.Extract == nil {
+				r.Extract = map[string]string{}
+			}
+			r.Extract[variable] = path
+			if reader != nil && reader != r && !containsString(reader.DependsOn, r.Name) {
+				reader.DependsOn = append(reader.DependsOn, r.Name)
+			}
+			return "{{" + variable + "}}"
+		})
+	}
+	for i := range requests {
+		r := &requests[i]
+		r.URL = convert(r.URL, r)
+		r.Body = convert(r.Body, r)
+		for name, value := range r.Headers {
+			r.Headers[name] = convert(value, r)
+		}
+		httpBasicAuth(r)
+	}
+	for name, value := range c.Variables {
+		c.Variables[name] = convert(value, nil)
+	}
+	c.Requests = requests
+	sort.Strings(result.warnings)
+	return result, nil
+}
+
+// httpComment returns the text of a # or // comment line
+func httpComment(line string) (string, bool) {
+	for _, prefix := range []string{"#", "//"} {
+		if text, ok := strings.CutPrefix(line, prefix); ok {
+			return strings.TrimSpace(text), true
+		}
+	}
+	return "", false
+}
+
+// httpRequestLine splits "METHOD URL HTTP/1.1" into method, URL and
+// version; the method defaults to GET. Only HTTP/2 and HTTP/3 are kept as
+// versions: HTTP/1.1 is written out of habit, and forcing it would stop
+// HTTP/2 from being negotiated.
+func httpRequestLine(line string) (method, url, version string) {
+	fields := strings.Fields(line)
+	if len(fields) > 1 && strings.HasPrefix(fields[len(fields)-1], "HTTP/") {
+		if v, _ := parseHTTPVersion(fields[len(fields)-1]); v == httpVersion2 || v == httpVersion3 {
+			version = v
+		}
+		fields = fields[:len(fields)-1]
+	}
+	if len(fields) > 1 && strings.ToUpper(fields[0]) == fields[0] && !strings.Contains(fields[0], "/") {
+		method, fields = fields[0], fields[1:]
+	}
+	if method == "GET" {
+		method = ""
+	}
+	return method, strings.Join(fields, " "), version
+}
+
+// httpBasicAuth turns the "Basic user password" and "Basic user:password"
+// shorthands of the REST Client, which it encodes when sending, into
+// basic auth
+func httpBasicAuth(r *savedRequest) {
+	for name, value := range r.Headers {
+		if !strings.EqualFold(name, "Authorization") {
+			continue
+		}
+		credentials, ok := strings.CutPrefix(value, "Basic ")
+		if !ok {
+			return
+		}
+		credentials = strings.TrimSpace(credentials)
+		user, password, spaced := strings.Cut(credentials, " ")
+		if !spaced {
+			if _, err := base64.StdEncoding.DecodeString(credentials); err == nil && !strings.Contains(credentials, ":") {
+				return // already encoded
+			}
+			user, password, _ = strings.Cut(credentials, ":")
+		}
+		r.Auth = &requestAuth{Type: "basic", Username: user, Password: strings.TrimSpace(password)}
+		delete(r.Headers, name)
+		return
+	}
+}
+
+// importHTTPFile imports a .http or .rest file, along with the
+// environments of the JetBrains HTTP client next to it
+func importHTTPFile(path string) (importResult, error) {
+	result, err := parseHTTPFile(path)
+	if err != nil {
+		return result, err
+	}
+	result.collection.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	data, err := os.ReadFile(filepath.Join(filepath.Dir(path), httpEnvFile))
+	if err == nil {
+		var envs map[string]map[string]interface{}
+		if err := json.Unmarshal(data, &envs); err != nil {
+			return result, fmt.Errorf("%s: %w", httpEnvFile, err)
+		}
+		// $shared holds the variables every environment has
+		shared := envs["$shared"]
+		for _, name := range sortedKeys(envs) {
+			if strings.HasPrefix(name, "$") {
+				continue
+			}
+			env := environment{Name: name, Variables: map[string]string{}}
+			for k, v := range shared {
+				env.Variables[k] = openAPIScalar(v)
+			}
+			for k, v := range envs[name] {
+				env.Variables[k] = openAPIScalar(v)
+			}
+			result.environments = append(result.environments, env)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(path), httpPrivateEnvFile)); err == nil {
+		result.warnings = append(result.warnings, fmt.Sprintf("%s holds secrets and wasn't imported, add them to %s", httpPrivateEnvFile, localEnvironmentsFile))
+	}
+	return result, nil
+}
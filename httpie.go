@@ -0,0 +1,264 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// HTTPie's request items, by separator. Where separators overlap, the
+// one found first in an item wins, then the longest.
+const (
+	httpieHeader      = ":"
+	httpieEmptyHeader = ";"
+	httpieQuery       = "=="
+	httpieData        = "="
+	httpieJSON        = ":="
+	httpieDataFile    = "=@"
+	httpieJSONFile    = ":=@"
+	httpieFormFile    = "@"
+)
+
+var httpieSeparators = []string{httpieJSONFile, httpieDataFile, httpieJSON, httpieQuery, httpieData, httpieHeader, httpieEmptyHeader, httpieFormFile}
+
+// httpieItem is one request item: a header, query parameter or field
+type httpieItem struct {
+	key, sep, value string
+}
+
+// parseHTTPieItem splits a request item at its separator, false when the
+// word isn't one
+func parseHTTPieItem(word string) (httpieItem, bool) {
+	best, at := "", -1
+	for _, sep := range httpieSeparators {
+		i := strings.Index(word, sep)
+		if i <= 0 {
+			continue
+		}
+		if at < 0 || i < at || i == at && len(sep) > len(best) {
+			best, at = sep, i
+		}
+	}
+	if at < 0 {
+		return httpieItem{}, false
+	}
+	item := httpieItem{key: word[:at], sep: best, value: word[at+len(best):]}
+	// A header name can't hold spaces or slashes, which tells a URL with
+	// a port or a path like "example.com/a:b" from a header
+	if (best == httpieHeader || best == httpieEmptyHeader) && strings.ContainsAny(item.key, " /") {
+		return httpieItem{}, false
+	}
+	if best == httpieEmptyHeader && item.value != "" {
+		return httpieItem{}, false
+	}
+	return item, true
+}
+
+// httpieCommand is an input line in HTTPie's syntax, e.g.
+// "POST api.example.com/users name=joe X-Api-Key:abc"
+type httpieCommand struct {
+	method, url string
+	form        bool
+	items       []httpieItem
+	bodyFile    string
+}
+
+// parseHTTPie reads an input line in HTTPie's syntax: an optional "http"
+// or "https" command with --form or --json, an optional method, the URL
+// (":3000/path" standing for localhost) and request items. ok is false for
+// lines without request items, which are plain request lines.
+func parseHTTPie(line string) (c httpieCommand, ok bool, err error) {
+	words, err := shellWords(line)
+	if err != nil || len(words) == 0 {
+		return c, false, nil
+	}
+	command := words[0] == "http" || words[0] == "https"
+	scheme := "http"
+	if command {
+		scheme, words = words[0], words[1:]
+	}
+	for len(words) > 0 && strings.HasPrefix(words[0], "-") {
+		switch words[0] {
+		case "--form", "-f":
+			c.form = true
+		case "--json", "-j":
+		default:
+			return c, command, fmt.Errorf("HTTPie option %s isn't supported", words[0])
+		}
+		words = words[1:]
+	}
+	if len(words) > 1 && isMethodToken(words[0]) {
+		c.method, words = words[0], words[1:]
+	}
+	if len(words) == 0 {
+		return c, command, errors.New("no URL")
+	}
+	c.url, words = words[0], words[1:]
+	if command && !strings.Contains(c.url, "://") && !strings.HasPrefix(c.url, "{{") && !strings.HasPrefix(c.url, ":") {
+		// Like HTTPie, the http and https commands default to their scheme
+		c.url = scheme + "://" + c.url
+	}
+	if rest, ok := strings.CutPrefix(c.url, ":"); ok {
+		if rest == "" || strings.HasPrefix(rest, "/") {
+			c.url = "http://localhost" + rest
+		} else {
+			c.url = "http://localhost:" + rest
+		}
+	}
+	if n := len(words); n > 0 && strings.HasPrefix(words[n-1], "@") {
+		c.bodyFile, words = words[n-1][1:], words[:n-1]
+	}
+	if len(words) == 0 {
+		return c, command, nil
+	}
+	for _, word := range words {
+		item, isItem := parseHTTPieItem(word)
+		if !isItem {
+			if !command {
+				return c, false, nil
+			}
+			return c, true, fmt.Errorf("%q isn't a request item (Header:value, name=value, name:=json or name==value)", word)
+		}
+		c.items = append(c.items, item)
+	}
+	return c, true, nil
+}
+
+// expandHTTPie turns an input line in HTTPie's syntax into the request
+// line and the draft holding its headers and body, replacing any draft.
+// false means the line couldn't be read, the error being shown.
+func (m model) expandHTTPie() (model, bool) {
+	c, ok, err := parseHTTPie(m.textInput.Value())
+	if !ok {
+		return m, true
+	}
+	r, convErr := c.request()
+	if err == nil {
+		err = convErr
+	}
+	if err != nil {
+		m.err = fmt.Errorf("HTTPie syntax: %w", err)
+		m.response = ""
+		m.viewport.SetContent(m.response)
+		return m, false
+	}
+	m.draft = &r
+	m.textInput.SetValue(r.requestLine())
+	m.textInput.CursorEnd()
+	return m, true
+}
+
+// request turns the command into a request: headers as given, query
+// parameters added to the URL, and fields sent as a JSON object, or a
+// URL-encoded form with --form, by POST unless a method is given. Like
+// HTTPie, a JSON body is sent with an Accept header preferring JSON.
+func (c httpieCommand) request() (savedRequest, error) {
+	r := savedRequest{Method: c.method, URL: c.url, BodyFile: c.bodyFile}
+	var query []string
+	var fields []string
+	form := url.Values{}
+	var formKeys []string
+	for _, item := range c.items {
+		value := item.value
+		if item.sep == httpieDataFile || item.sep == httpieJSONFile {
+			data, err := os.ReadFile(value)
+			if err != nil {
+				return r, err
+			}
+			value = strings.TrimSuffix(string(data), "\n")
+		}
+		switch item.sep {
+		case httpieHeader, httpieEmptyHeader:
+			if r.Headers == nil {
+				r.Headers = map[string]string{}
+			}
+			r.Headers[item.key] = value
+		case httpieQuery:
+			query = append(query, httpieEscape(item.key)+"="+httpieEscape(value))
+		case httpieData, httpieDataFile:
+			if c.form {
+				if _, seen := form[item.key]; !seen {
+					formKeys = append(formKeys, item.key)
+				}
+				form.Add(item.key, value)
+				continue
+			}
+			key, _ := json.Marshal(item.key)
+			encoded, _ := json.Marshal(value)
+			fields = append(fields, string(key)+": "+string(encoded))
+		case httpieJSON, httpieJSONFile:
+			if c.form {
+				return r, fmt.Errorf("%s%s%s: JSON fields can't be sent in a form", item.key, item.sep, item.value)
+			}
+			// Templates are expanded later, so only plain values are checked
+			if !strings.Contains(value, "{{") && !json.Valid([]byte(value)) {
+				return r, fmt.Errorf("%s%s%s: not valid JSON", item.key, item.sep, item.value)
+			}
+			key, _ := json.Marshal(item.key)
+			fields = append(fields, string(key)+": "+value)
+		case httpieFormFile:
+			return r, fmt.Errorf("%s@%s: file fields need a multipart form, which lazyhttp doesn't send, send the file as the body with @%s", item.key, item.value, item.value)
+		}
+	}
+	if len(query) > 0 {
+		sep := "?"
+		if strings.Contains(r.URL, "?") {
+			sep = "&"
+		}
+		r.URL += sep + strings.Join(query, "&")
+	}
+
+	hasFields := len(fields) > 0 || len(formKeys) > 0
+	if hasFields && c.bodyFile != "" {
+		return r, errors.New("fields and a body file can't be sent together")
+	}
+	switch {
+	case len(formKeys) > 0:
+		var pairs []string
+		for _, key := range formKeys {
+			for _, value := range form[key] {
+				pairs = append(pairs, url.QueryEscape(key)+"="+url.QueryEscape(value))
+			}
+		}
+		r.Body = strings.Join(pairs, "&")
+		setHTTPieDefault(&r, "Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	case len(fields) > 0:
+		r.Body = "{" + strings.Join(fields, ", ") + "}"
+		setHTTPieDefault(&r, "Content-Type", "application/json")
+		setHTTPieDefault(&r, "Accept", "application/json, */*;q=0.5")
+	}
+	if r.Method == "" && (hasFields || c.bodyFile != "") {
+		r.Method = "POST"
+	}
+	if r.Method == "GET" {
+		r.Method = ""
+	}
+	return r, nil
+}
+
+// httpieEscape URL-encodes s, leaving its {{placeholders}} to be expanded
+func httpieEscape(s string) string {
+	var sb strings.Builder
+	last := 0
+	for _, loc := range templatePattern.FindAllStringIndex(s, -1) {
+		sb.WriteString(url.QueryEscape(s[last:loc[0]]))
+		sb.WriteString(s[loc[0]:loc[1]])
+		last = loc[1]
+	}
+	sb.WriteString(url.QueryEscape(s[last:]))
+	return sb.String()
+}
+
+// setHTTPieDefault sets a header unless the items set it already
+func setHTTPieDefault(r *savedRequest, name, value string) {
+	if headerValue(r.Headers, name) != "" {
+		return
+	}
+	if r.Headers == nil {
+		r.Headers = map[string]string{}
+	}
+	r.Headers[name] = value
+}
@@ -0,0 +1,332 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+// HTTP versions a request can be forced to; by default the version is
+// negotiated, HTTP/2 over TLS when the server offers it and HTTP/1.1
+// otherwise
+const (
+	httpVersion11 = "1.1"
+	httpVersion2  = "2"
+	httpVersion3  = "3"
+)
+
+// defaultHTTPVersion is set with -http-version and applies to every
+// request; saved requests can override it
+var defaultHTTPVersion string
+
+// parseHTTPVersion reads an HTTP version as typed, like 1.1, HTTP/2 or h3
+func parseHTTPVersion(s string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "":
+		return "", nil
+	case "1.1", "http/1.1", "http1.1", "h1":
+		return httpVersion11, nil
+	case "2", "2.0", "http/2", "http/2.0", "http2", "h2", "h2c":
+		return httpVersion2, nil
+	case "3", "3.0", "http/3", "http/3.0", "http3", "h3", "quic":
+		return httpVersion3, nil
+	}
+	return "", fmt.Errorf("unknown HTTP version %q, use 1.1, 2 or 3", s)
+}
+
+// parseHTTPVersionFlag sets defaultHTTPVersion from -http-version
+func parseHTTPVersionFlag(s string) error {
+	v, err := parseHTTPVersion(s)
+	defaultHTTPVersion = v
+	return err
+}
+
+// describeHTTPVersion is how previews show the version a request is sent
+// with
+func describeHTTPVersion(version string) string {
+	switch version {
+	case httpVersion11:
+		return "HTTP/1.1, forced"
+	case httpVersion2:
+		return "HTTP/2, forced (prior knowledge for http://)"
+	case httpVersion3:
+		return "HTTP/3, forced (QUIC over UDP, https:// only)"
+	}
+	return "negotiated"
+}
+
+// altService is an alternative endpoint a server advertises in Alt-Svc
+// (RFC 7838), such as HTTP/3 on a UDP port
+type altService struct {
+	protocol  string // ALPN ID, like h3
+	authority string // [host]:port, the host empty for the same one
+	maxAge    time.Duration
+}
+
+// parseAltSvc reads Alt-Svc header values; "clear" advertises nothing
+func parseAltSvc(values []string) []altService {
+	var services []altService
+	for _, v := range values {
+		for _, entry := range strings.Split(v, ",") {
+			params := strings.Split(entry, ";")
+			protocol, authority, ok := strings.Cut(strings.TrimSpace(params[0]), "=")
+			if !ok {
+				continue
+			}
+			s := altService{protocol: protocol, authority: strings.Trim(authority, `"`), maxAge: 24 * time.Hour}
+			for _, p := range params[1:] {
+				if age, ok := strings.CutPrefix(strings.TrimSpace(p), "ma="); ok {
+					if secs, err := strconv.Atoi(strings.Trim(age, `"`)); err == nil {
+						s.maxAge = time.Duration(secs) * time.Second
+					}
+				}
+			}
+			services = append(services, s)
+		}
+	}
+	return services
+}
+
+// http3Offer describes the HTTP/3 endpoints a response advertises, "" for
+// none. Draft versions such as h3-29 are listed too, as CDNs still send
+// them.
+func http3Offer(header http.Header) string {
+	var offers []string
+	for _, s := range parseAltSvc(header.Values("Alt-Svc")) {
+		if s.protocol == "h3" || strings.HasPrefix(s.protocol, "h3-") {
+			offers = append(offers, fmt.Sprintf("%s on %s for %s", s.protocol, s.authority, formatAge(s.maxAge)))
+		}
+	}
+	return strings.Join(offers, ", ")
+}
+
+// formatAge is a max-age in the largest whole unit
+func formatAge(d time.Duration) string {
+	switch {
+	case d >= 24*time.Hour && d%(24*time.Hour) == 0:
+		return fmt.Sprintf("%dd", d/(24*time.Hour))
+	case d >= time.Hour && d%time.Hour == 0:
+		return fmt.Sprintf("%dh", d/time.Hour)
+	}
+	return d.String()
+}
+
+// versionTransports are the transports of forced versions and connect
+// overrides, shared between requests with the same timeouts like
+// transports. Overridden connections get transports of their own so they
+// never share a pool with those to the resolved addresses.
+var versionTransports sync.Map // versionKey -> http.RoundTripper
+
+type versionKey struct {
+	timeouts requestTimeouts
+	version  string
+	resolve  string
+	proxy    string
+	insecure bool
+}
+
+// roundTripperFor is the transport sending requests with timeouts t in
+// the HTTP version given, "" negotiating it, to the addresses resolve
+// overrides, through the proxy a request sets, see proxyFunc
+func roundTripperFor(t requestTimeouts, version string, resolve connectOverrides, proxy string) http.RoundTripper {
+	// The total timeout bounds the request's context, not the connections
+	t.TotalMs = 0
+	if version == "" && len(resolve) == 0 && proxy == "" {
+		return transportFor(t)
+	}
+	key := versionKey{t, version, resolve.String(), proxy, insecureTLS.Load()}
+	if rt, ok := versionTransports.Load(key); ok {
+		return rt.(http.RoundTripper)
+	}
+	var rt http.RoundTripper
+	switch version {
+	case httpVersion2:
+		rt = newHTTP2Transport(t, resolve)
+	case httpVersion3:
+		rt = newHTTP3Transport(t, resolve)
+	default:
+		tr := transportFor(t).Clone()
+		tr.DialContext = resolve.dialContext(t.dialer())
+		if proxy != "" {
+			pf, err := proxyFunc(proxy)
+			if err != nil {
+				// Requests fail with the reason rather than go direct
+				pf = func(*http.Request) (*url.URL, error) { return nil, err }
+			}
+			tr.Proxy = pf
+		}
+		if version == httpVersion11 {
+			tr.ForceAttemptHTTP2 = false
+			tr.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+		}
+		rt = tr
+	}
+	actual, _ := versionTransports.LoadOrStore(key, rt)
+	return actual.(http.RoundTripper)
+}
+
+// http2Transport speaks HTTP/2 only: over TLS when the server agrees to
+// it through ALPN, and in cleartext with prior knowledge (h2c) for
+// http:// URLs. Proxies aren't used.
+type http2Transport struct {
+	tls, plain *http2.Transport
+	header     time.Duration // response header timeout, 0 for none
+}
+
+func newHTTP2Transport(t requestTimeouts, resolve connectOverrides) http2Transport {
+	dial := resolve.dialContext(t.dialer())
+	return http2Transport{
+		tls: &http2.Transport{
+			DialTLSContext: func(ctx context.Context, network, addr string, cfg *tls.Config) (net.Conn, error) {
+				conn, err := dial(ctx, network, addr)
+				if err != nil {
+					return nil, err
+				}
+				tlsConn := tls.Client(conn, withTLSSettings(cfg))
+				hctx, cancel := context.WithTimeout(ctx, t.tls())
+				defer cancel()
+				if err := tlsConn.HandshakeContext(hctx); err != nil {
+					conn.Close()
+					if hctx.Err() == context.DeadlineExceeded && ctx.Err() == nil {
+						return nil, errors.New("net/http: TLS handshake timeout")
+					}
+					return nil, err
+				}
+				if p := tlsConn.ConnectionState().NegotiatedProtocol; p != http2.NextProtoTLS {
+					conn.Close()
+					if p == "" {
+						p = "none, so HTTP/1.1"
+					}
+					return nil, fmt.Errorf("the server doesn't offer HTTP/2 (ALPN protocol %s), send it with HTTP/1.1 or let the version be negotiated", p)
+				}
+				return tlsConn, nil
+			},
+		},
+		plain: &http2.Transport{
+			AllowHTTP: true,
+			DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+				return dial(ctx, network, addr)
+			},
+		},
+		header: t.responseHeader(),
+	}
+}
+
+func (t http2Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	tr := t.tls
+	if req.URL.Scheme == "http" {
+		tr = t.plain
+	}
+	return roundTripWithHeaderTimeout(tr, req, t.header)
+}
+
+// roundTripWithHeaderTimeout sends req through rt, failing it when its
+// response headers take longer than timeout, 0 for no limit
+func roundTripWithHeaderTimeout(rt http.RoundTripper, req *http.Request, timeout time.Duration) (*http.Response, error) {
+	if timeout <= 0 {
+		return rt.RoundTrip(req)
+	}
+
+	// The HTTP/2 and HTTP/3 transports have no response header timeout,
+	// so the request is cancelled from a timer that is stopped once the
+	// headers are in
+	ctx, cancel := context.WithCancel(req.Context())
+	timer := time.AfterFunc(timeout, cancel)
+	resp, err := rt.RoundTrip(req.WithContext(ctx))
+	if !timer.Stop() && req.Context().Err() == nil {
+		cancel()
+		if resp != nil {
+			resp.Body.Close()
+		}
+		return nil, errors.New("net/http: timeout awaiting response headers")
+	}
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp.Body = cancelOnClose{resp.Body, cancel}
+	return resp, nil
+}
+
+// cancelOnClose releases the context of a request once its body is closed
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c cancelOnClose) Close() error {
+	defer c.cancel()
+	return c.ReadCloser.Close()
+}
+
+// http2Codes explain the error codes of RST_STREAM and GOAWAY frames
+var http2Codes = map[string]string{
+	"NO_ERROR":            "a graceful shutdown, the server is going away",
+	"PROTOCOL_ERROR":      "the peer saw a protocol violation, often a header HTTP/2 forbids such as Connection or Transfer-Encoding",
+	"INTERNAL_ERROR":      "the peer hit an internal error",
+	"FLOW_CONTROL_ERROR":  "the flow-control window was exceeded",
+	"SETTINGS_TIMEOUT":    "SETTINGS weren't acknowledged in time",
+	"STREAM_CLOSED":       "a frame arrived for a stream already closed",
+	"FRAME_SIZE_ERROR":    "a frame had an invalid size",
+	"REFUSED_STREAM":      "the stream was refused before any processing, so the request is safe to retry",
+	"CANCEL":              "the stream is no longer needed",
+	"COMPRESSION_ERROR":   "the HPACK header compression state broke",
+	"CONNECT_ERROR":       "the CONNECT tunnel failed",
+	"ENHANCE_YOUR_CALM":   "the server thinks the client is abusive, e.g. too many streams or resets",
+	"INADEQUATE_SECURITY": "the TLS version or cipher isn't good enough for HTTP/2",
+	"HTTP_1_1_REQUIRED":   "the server wants this request over HTTP/1.1, force it with the version 1.1",
+}
+
+// describeHTTP2Error explains stream resets and GOAWAY frames, which Go
+// reports with the bare frame fields
+func describeHTTP2Error(err error) error {
+	var streamErr http2.StreamError
+	var goAway http2.GoAwayError
+	switch {
+	case err == nil:
+		return nil
+	case errors.As(err, &streamErr):
+		return fmt.Errorf("HTTP/2 stream %d reset (RST_STREAM %s): %s: %w", streamErr.StreamID, streamErr.Code, http2Hint(streamErr.Code.String()), err)
+	case errors.As(err, &goAway):
+		debug := ""
+		if goAway.DebugData != "" {
+			debug = fmt.Sprintf(", debug data %q", goAway.DebugData)
+		}
+		return fmt.Errorf("HTTP/2 connection closed by the server (GOAWAY %s, last stream %d%s): %s: %w",
+			goAway.ErrCode, goAway.LastStreamID, debug, http2Hint(goAway.ErrCode.String()), err)
+	}
+
+	// The HTTP/2 built into net/http has the same errors, unexported, and
+	// a GOAWAY before the response headers only comes with its code
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, "stream error: stream ID"):
+		return fmt.Errorf("HTTP/2 stream reset (RST_STREAM): %s: %w", http2Hint(msg), err)
+	case strings.Contains(msg, "server sent GOAWAY"), strings.Contains(msg, "received GOAWAY"):
+		return fmt.Errorf("HTTP/2 connection closed by the server (GOAWAY): %s: %w", http2Hint(msg), err)
+	case strings.Contains(msg, "http2: unsupported scheme"), strings.Contains(msg, "frame too large"):
+		return fmt.Errorf("the server didn't answer in HTTP/2, it may only speak HTTP/1.1: %w", err)
+	}
+	return err
+}
+
+// http2Hint is the explanation of the first error code named in text
+func http2Hint(text string) string {
+	for _, code := range sortedKeys(http2Codes) {
+		if strings.Contains(text, code) {
+			return http2Codes[code]
+		}
+	}
+	return "the peer gave an unknown error code"
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	"image/png"
+	"os"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+const (
+	// maxImageRows caps how many terminal rows an inline preview may take
+	maxImageRows = 30
+
+	// Approximate pixel size of a terminal cell, used when the image has to
+	// be scaled by us (sixel) rather than by the terminal
+	cellPixelWidth  = 10
+	cellPixelHeight = 20
+
+	kittyChunkSize = 4096
+
+	// maxImagePixels caps the images decoded for a preview: a few bytes
+	// of header can claim dimensions that take gigabytes to decode
+	maxImagePixels = 50_000_000
+)
+
+// imageProtocol picks the inline image protocol supported by the running
+// terminal. LAZYHTTP_IMAGE_PROTOCOL (kitty, iterm, sixel or none) overrides
+// the detection, which otherwise relies on well-known environment variables.
+func imageProtocol() string {
+	if p := strings.ToLower(os.Getenv("LAZYHTTP_IMAGE_PROTOCOL")); p != "" {
+		return p
+	}
+
+	// tmux swallows graphics escapes unless passthrough is configured
+	if os.Getenv("TMUX") != "" {
+		return "none"
+	}
+
+	term := os.Getenv("TERM")
+	switch {
+	case os.Getenv("KITTY_WINDOW_ID") != "" || term == "xterm-kitty" || term == "xterm-ghostty":
+		return "kitty"
+	case os.Getenv("TERM_PROGRAM") == "iTerm.app" || os.Getenv("TERM_PROGRAM") == "WezTerm":
+		return "iterm"
+	case strings.HasPrefix(term, "foot") || strings.HasPrefix(term, "mlterm") || strings.Contains(term, "sixel"):
+		return "sixel"
+	}
+	return "none"
+}
+
+// renderImage describes an image body and, when the terminal supports it,
+// draws an inline preview that fits within width cells
+func renderImage(body []byte, width int) string {
+	var sb strings.Builder
+
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(body))
+	if err != nil {
+		fmt.Fprintf(&sb, "%s %s\n", headerStyle.Render("Image:"),
+			errorStyle.Render(fmt.Sprintf("unable to decode (%v)", err)))
+		fmt.Fprintf(&sb, "%s %s\n", headerStyle.Render("Size:"), formatBytes(int64(len(body))))
+		return sb.String()
+	}
+
+	fmt.Fprintf(&sb, "%s %s %d×%d\n", headerStyle.Render("Image:"),
+		strings.ToUpper(format), cfg.Width, cfg.Height)
+	fmt.Fprintf(&sb, "%s %s\n\n", headerStyle.Render("Size:"), formatBytes(int64(len(body))))
+
+	protocol := imageProtocol()
+	if protocol == "none" {
+		sb.WriteString(lipgloss.NewStyle().Foreground(lipgloss.Color("#888888")).
+			Render("Inline preview is not supported by this terminal (set LAZYHTTP_IMAGE_PROTOCOL to kitty, iterm or sixel to force it)"))
+		return sb.String()
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 {
+		sb.WriteString(historyDimStyle.Render("No preview for an image without pixels."))
+		return sb.String()
+	}
+	if int64(cfg.Width)*int64(cfg.Height) > maxImagePixels {
+		sb.WriteString(historyDimStyle.Render(fmt.Sprintf("No preview for images over %d megapixels.", maxImagePixels/1_000_000)))
+		return sb.String()
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(body))
+	if err != nil {
+		sb.WriteString(errorStyle.Render(fmt.Sprintf("Unable to decode image: %v", err)))
+		return sb.String()
+	}
+
+	cols, rows := imageCells(cfg.Width, cfg.Height, width)
+
+	var preview string
+	switch protocol {
+	case "kitty":
+		preview, err = kittyImage(img, format, body, cols, rows)
+	case "iterm":
+		preview = itermImage(body, cols, rows)
+	case "sixel":
+		preview = sixelImage(img, cols, rows)
+	default:
+		err = fmt.Errorf("unknown image protocol %q", protocol)
+	}
+	if err != nil {
+		sb.WriteString(errorStyle.Render(fmt.Sprintf("Unable to render image: %v", err)))
+		return sb.String()
+	}
+
+	// The terminal draws the image over the following rows, so reserve
+	// them in the viewport to keep the layout from overlapping it
+	sb.WriteString(preview)
+	sb.WriteString(strings.Repeat("\n", rows))
+	return sb.String()
+}
+
+// imageCells fits an image into at most maxCols columns and maxImageRows
+// rows while keeping its aspect ratio (a cell is about twice as tall as wide)
+func imageCells(w, h, maxCols int) (int, int) {
+	if maxCols < 1 {
+		maxCols = 1
+	}
+	cols := (w + cellPixelWidth - 1) / cellPixelWidth
+	if cols > maxCols {
+		cols = maxCols
+	}
+	if cols < 1 {
+		cols = 1
+	}
+	rows := cols * h * cellPixelWidth / (w * cellPixelHeight)
+	if rows > maxImageRows {
+		rows = maxImageRows
+		cols = rows * w * cellPixelHeight / (h * cellPixelWidth)
+	}
+	if rows < 1 {
+		rows = 1
+	}
+	if cols < 1 {
+		cols = 1
+	}
+	return cols, rows
+}
+
+// kittyImage emits the kitty graphics protocol escape for img, scaled by the
+// terminal to a cols×rows cell box
+func kittyImage(img image.Image, format string, body []byte, cols, rows int) (string, error) {
+	// kitty only accepts PNG directly; everything else is re-encoded
+	data := body
+	if format != "png" {
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, img); err != nil {
+			return "", err
+		}
+		data = buf.Bytes()
+	}
+
+	encoded := base64.StdEncoding.EncodeToString(data)
+
+	var sb strings.Builder
+	for i := 0; i < len(encoded); i += kittyChunkSize {
+		end := i + kittyChunkSize
+		more := 1
+		if end >= len(encoded) {
+			end = len(encoded)
+			more = 0
+		}
+		if i == 0 {
+			fmt.Fprintf(&sb, "\x1b_Ga=T,f=100,C=1,c=%d,r=%d,m=%d;%s\x1b\\", cols, rows, more, encoded[i:end])
+		} else {
+			fmt.Fprintf(&sb, "\x1b_Gm=%d;%s\x1b\\", more, encoded[i:end])
+		}
+	}
+	return sb.String(), nil
+}
+
+// itermImage emits the iTerm2 inline image escape, which WezTerm also speaks
+func itermImage(body []byte, cols, rows int) string {
+	return fmt.Sprintf("\x1b]1337;File=inline=1;size=%d;width=%d;height=%d;preserveAspectRatio=1:%s\a",
+		len(body), cols, rows, base64.StdEncoding.EncodeToString(body))
+}
+
+// sixelImage scales img to the cell box and encodes it as sixel graphics
+// using a fixed 6×6×6 color cube
+func sixelImage(img image.Image, cols, rows int) string {
+	w, h := cols*cellPixelWidth, rows*cellPixelHeight
+	bounds := img.Bounds()
+
+	// Nearest-neighbour scale into palette indexes
+	pixels := make([]int, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			sx := bounds.Min.X + x*bounds.Dx()/w
+			sy := bounds.Min.Y + y*bounds.Dy()/h
+			r, g, b, a := img.At(sx, sy).RGBA()
+			if a == 0 {
+				pixels[y*w+x] = -1
+				continue
+			}
+			pixels[y*w+x] = int(r>>8)*6/256*36 + int(g>>8)*6/256*6 + int(b>>8)*6/256
+		}
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "\x1bPq\"1;1;%d;%d", w, h)
+	for i := 0; i < 216; i++ {
+		fmt.Fprintf(&sb, "#%d;2;%d;%d;%d", i, i/36*20, i/6%6*20, i%6*20)
+	}
+
+	for band := 0; band < h; band += 6 {
+		used := map[int]bool{}
+		for y := band; y < band+6 && y < h; y++ {
+			for x := 0; x < w; x++ {
+				if c := pixels[y*w+x]; c >= 0 {
+					used[c] = true
+				}
+			}
+		}
+		for c := 0; c < 216; c++ {
+			if !used[c] {
+				continue
+			}
+			fmt.Fprintf(&sb, "#%d", c)
+			run, last := 0, byte(0)
+			for x := 0; x < w; x++ {
+				bits := 0
+				for dy := 0; dy < 6 && band+dy < h; dy++ {
+					if pixels[(band+dy)*w+x] == c {
+						bits |= 1 << dy
+					}
+				}
+				ch := byte(63 + bits)
+				if run > 0 && ch != last {
+					writeSixelRun(&sb, last, run)
+					run = 0
+				}
+				last = ch
+				run++
+			}
+			writeSixelRun(&sb, last, run)
+			sb.WriteByte('$')
+		}
+		sb.WriteByte('-')
+	}
+	sb.WriteString("\x1b\\")
+	return sb.String()
+}
+
+func writeSixelRun(sb *strings.Builder, ch byte, run int) {
+	if run > 3 {
+		fmt.Fprintf(sb, "!%d%c", run, ch)
+		return
+	}
+	for i := 0; i < run; i++ {
+		sb.WriteByte(ch)
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// importResult is what an importer made of another tool's export
+type importResult struct {
+	collection   *collection
+	environments []environment
+	warnings     []string // what couldn't be carried over
+
+	// spec is the OpenAPI document the collection was generated from,
+	// kept to check responses against
+	spec map[string]interface{}
+}
+
+// importer converts another tool's export, a file or a directory, into a
+// collection and environments
+type importer func(path string) (importResult, error)
+
+// importers by the name given to -format
+var importers = map[string]importer{
+	"postman":  importPostman,
+	"insomnia": importInsomnia,
+	"bruno":    importBruno,
+	"openapi":  importOpenAPI,
+	"http":     importHTTPFile,
+}
+
+// detectImportFormat guesses the format of an export from its content
+func detectImportFormat(path string) (string, error) {
+	if isURL(path) {
+		return "openapi", nil
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if info.IsDir() || strings.HasSuffix(path, ".bru") {
+		return "bruno", nil
+	}
+	if isHTTPFile(path) {
+		return "http", nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	var probe struct {
+		Info struct {
+			Schema string `json:"schema"`
+		} `json:"info"`
+		Type string `json:"_type"`
+	}
+	if json.Unmarshal(data, &probe) == nil {
+		switch {
+		case strings.Contains(probe.Info.Schema, "getpostman.com"):
+			return "postman", nil
+		case probe.Type == "export":
+			return "insomnia", nil
+		}
+	}
+	if isOpenAPI(data) {
+		return "openapi", nil
+	}
+	if strings.HasPrefix(strings.TrimSpace(string(data)), "type: collection.insomnia.rest/5") {
+		return "", errors.New("Insomnia v5 YAML exports are not supported, export the collection as Insomnia v4 (JSON)")
+	}
+	return "", errors.New("unrecognized format, pass -format")
+}
+
+// importCommand implements `lazyhttp import`: convert an export of another
+// API client into a collection of the current workspace
+func importCommand(args []string) int {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	format := fs.String("format", "", "format of the export: postman, insomnia, bruno, openapi or http (detected when not given)")
+	name := fs.String("name", "", "`name` of the collection to create (default: the name in the export)")
+	force := fs.Bool("force", false, "replace an existing collection and environments of the same names")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: lazyhttp import [flags] <file | directory | URL>\n\n")
+		fmt.Fprintf(fs.Output(), "Imports a Postman v2.0/v2.1 collection, an Insomnia v4 export, a Bruno\n")
+		fmt.Fprintf(fs.Output(), "collection directory, an OpenAPI 3/Swagger 2.0 spec (file or URL) or a .http\n")
+		fmt.Fprintf(fs.Output(), "or .rest file of the VS Code REST Client or JetBrains HTTP client into the\n")
+		fmt.Fprintf(fs.Output(), "current workspace\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	if isRemoteWorkspace(currentWorkspace) {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", errReadOnlyWorkspace)
+		return 1
+	}
+	var err error
+	if *format == "" {
+		if *format, err = detectImportFormat(fs.Arg(0)); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s: %v\n", fs.Arg(0), err)
+			return 1
+		}
+	}
+	convert, ok := importers[*format]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Error: unknown format %q\n", *format)
+		return 2
+	}
+
+	result, err := convert(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s: %v\n", fs.Arg(0), err)
+		return 1
+	}
+	c, warnings := result.collection, result.warnings
+	if *name != "" {
+		c.Name = *name
+	}
+	if err := c.validateDependencies(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	path := collectionPath(c.Name)
+	if _, err := os.Stat(path); err == nil && !*force {
+		fmt.Fprintf(os.Stderr, "Error: collection %q already exists at %s, pass -force to replace it or -name to pick another name\n", c.Name, path)
+		return 1
+	}
+	if result.spec != nil {
+		file, err := saveOpenAPISpec(c.Name, result.spec)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		for i := range c.Requests {
+			if c.Requests[i].OpenAPI != nil {
+				c.Requests[i].OpenAPI.Spec = file
+			}
+		}
+	}
+	if err := writeCollectionVia(path, c, "import"); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	var envs []string
+	if len(result.environments) > 0 {
+		skipped, err := addEnvironments(result.environments, *force)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		for _, env := range result.environments {
+			if !containsString(skipped, env.Name) {
+				envs = append(envs, env.Name)
+			}
+		}
+		if len(skipped) > 0 {
+			warnings = append(warnings, fmt.Sprintf("environments %s already exist and were left alone, pass -force to replace them", strings.Join(skipped, ", ")))
+		}
+	}
+
+	for _, w := range warnings {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", w)
+	}
+	folders := map[string]bool{}
+	for _, r := range c.Requests {
+		if r.Folder != "" {
+			folders[r.Folder] = true
+		}
+	}
+	fmt.Printf("Imported %d requests in %d folders into collection %q (%s)\n", len(c.Requests), len(folders), c.Name, path)
+	if len(envs) > 0 {
+		fmt.Printf("Imported environments %s into %s\n", strings.Join(envs, ", "), filepath.Join(workspaceDir(), environmentsFile))
+	}
+	return 0
+}
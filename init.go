@@ -0,0 +1,139 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// scaffoldFile is a file `lazyhttp init` writes into the project workspace
+type scaffoldFile struct {
+	path    string // relative to the .lazyhttp directory
+	content string
+	mode    os.FileMode
+}
+
+var scaffoldFiles = []scaffoldFile{
+	{".gitignore", `# Secrets and per-user state stay out of version control
+environments.local.json
+history.jsonl
+current-environment
+environment-history.jsonl
+environment-snapshot.json
+request-history.jsonl
+request-snapshot.json
+filter-history.jsonl
+layout.json
+schemas/
+graphql/
+`, 0o644},
+	{environmentsFile, `[
+  { "name": "dev", "variables": { "base_url": "http://localhost:8080" } },
+  {
+    "name": "staging",
+    "variables": { "base_url": "https://staging.example.com" },
+    "secrets": { "api_token": "env:API_TOKEN" }
+  },
+  {
+    "name": "prod",
+    "variables": { "base_url": "https://api.example.com" },
+    "secrets": { "api_token": "keychain:example-api/prod" }
+  }
+]
+`, 0o644},
+	{localEnvironmentsFile, `[
+  { "name": "dev", "variables": { "api_token": "" } }
+]
+`, 0o600},
+	{filepath.Join(collectionsDir, "example.json"), `{
+  "name": "example",
+  "requests": [
+    {
+      "name": "health",
+      "url": "{{base_url}}/health",
+      "expect": { "status": 200, "max_latency_ms": 1000 }
+    },
+    {
+      "name": "list users",
+      "folder": "users",
+      "url": "{{base_url}}/users",
+      "headers": { "Authorization": "Bearer {{api_token}}" },
+      "expect": { "status": 200 },
+      "depends_on": ["health"]
+    }
+  ]
+}
+`, 0o644},
+	{"ci.example.yml", `# Example GitHub Actions job running the example collection headlessly.
+# Copy it to .github/workflows/ and adjust the environment and secrets.
+name: api-smoke
+on: [push]
+jobs:
+  smoke:
+    runs-on: ubuntu-latest
+    steps:
+      - uses: actions/checkout@v4
+      - uses: actions/setup-go@v5
+        with:
+          go-version: "1.23"
+      - run: go install github.com/lafarr/lazyhttp@latest
+      # The staging environment reads api_token from $API_TOKEN
+      - run: lazyhttp run -env staging -report-junit junit.xml example
+        env:
+          API_TOKEN: ${{ secrets.API_TOKEN }}
+`, 0o644},
+}
+
+// initCommand implements `lazyhttp init`: scaffold a project workspace
+// that can be committed along with the project
+func initCommand(args []string) int {
+	fs := flag.NewFlagSet("init", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: lazyhttp init [directory]\n\n")
+		fmt.Fprintf(fs.Output(), "Creates a %s workspace in the directory (default: the current one)\n", projectDirName)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	root := "."
+	switch fs.NArg() {
+	case 0:
+	case 1:
+		root = fs.Arg(0)
+	default:
+		fs.Usage()
+		return 2
+	}
+
+	dir := filepath.Join(root, projectDirName)
+	if _, err := os.Stat(dir); err == nil {
+		fmt.Fprintf(os.Stderr, "Error: %s already exists\n", dir)
+		return 1
+	} else if !errors.Is(err, os.ErrNotExist) {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	for _, f := range scaffoldFiles {
+		path := filepath.Join(dir, f.path)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		if err := os.WriteFile(path, []byte(f.content), f.mode); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		fmt.Printf("created %s\n", path)
+	}
+
+	fmt.Printf(`
+lazyhttp started in %s or below now uses this workspace. Commit it, except
+for what its .gitignore lists. Secrets like api_token go into
+%s or are read from environment variables or the
+keychain, see the "secrets" in %s.
+`, root, localEnvironmentsFile, environmentsFile)
+	return 0
+}
@@ -0,0 +1,336 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// insomniaExport is an Insomnia v4 export, a flat list of resources
+// linked by parent IDs
+type insomniaExport struct {
+	Type      string             `json:"_type"`
+	Format    int                `json:"__export_format"`
+	Resources []insomniaResource `json:"resources"`
+}
+
+// insomniaResource holds the fields lazyhttp uses of the resource types
+// it imports: workspace, request_group (folders), request and environment
+type insomniaResource struct {
+	ID          string  `json:"_id"`
+	Type        string  `json:"_type"`
+	ParentID    string  `json:"parentId"`
+	Name        string  `json:"name"`
+	MetaSortKey float64 `json:"metaSortKey"`
+
+	Method         string         `json:"method"`
+	URL            string         `json:"url"`
+	Headers        []insomniaPair `json:"headers"`
+	Parameters     []insomniaPair `json:"parameters"`
+	Body           insomniaBody   `json:"body"`
+	Authentication insomniaAuth   `json:"authentication"`
+
+	// Data are the variables of an environment, Environment those of a
+	// folder; both may nest objects
+	Data        map[string]interface{} `json:"data"`
+	Environment map[string]interface{} `json:"environment"`
+}
+
+type insomniaPair struct {
+	Name     string `json:"name"`
+	Value    string `json:"value"`
+	Disabled bool   `json:"disabled"`
+}
+
+type insomniaBody struct {
+	MimeType string         `json:"mimeType"`
+	Text     string         `json:"text"`
+	FileName string         `json:"fileName"`
+	Params   []insomniaPair `json:"params"`
+}
+
+// insomniaAuth is empty when a request inherits the auth of its folder
+type insomniaAuth struct {
+	Type     string `json:"type"`
+	Disabled bool   `json:"disabled"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Token    string `json:"token"`
+	Prefix   string `json:"prefix"`
+	Key      string `json:"key"`
+	Value    string `json:"value"`
+	AddTo    string `json:"addTo"`
+}
+
+// insomniaUnsupported names the request types lazyhttp can't import
+var insomniaUnsupported = map[string]string{
+	"grpc_request":      "gRPC",
+	"websocket_request": "WebSocket",
+}
+
+// insomniaTagPattern matches Nunjucks tags such as {% uuid 'v4' %}
+var insomniaTagPattern = regexp.MustCompile(`\{%\s*(\w+)\s*([^%]*?)\s*%\}`)
+
+// importInsomnia converts an Insomnia v4 export. The first workspace
+// becomes the collection, with its folders, requests and auth; its base
+// environment becomes the collection's variables, its sub environments
+// lazyhttp environments, and the environments of folders the variables
+// of their requests. Template tags other than uuid and now are left as
+// they are.
+func importInsomnia(path string) (importResult, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return importResult{}, err
+	}
+	var export insomniaExport
+	if err := json.Unmarshal(data, &export); err != nil {
+		return importResult{}, err
+	}
+	if export.Type != "export" || export.Format != 4 {
+		return importResult{}, errors.New("not an Insomnia v4 export, export the collection as Insomnia v4 (JSON)")
+	}
+
+	var workspaces []insomniaResource
+	children := map[string][]insomniaResource{}
+	skipped := map[string]int{}
+	for _, r := range export.Resources {
+		switch r.Type {
+		case "workspace":
+			workspaces = append(workspaces, r)
+		case "request", "request_group", "environment":
+			children[r.ParentID] = append(children[r.ParentID], r)
+		default:
+			skipped[r.Type]++
+		}
+	}
+	if len(workspaces) == 0 {
+		return importResult{}, errors.New("the export holds no workspace")
+	}
+	for _, list := range children {
+		sort.SliceStable(list, func(i, j int) bool { return list[i].MetaSortKey < list[j].MetaSortKey })
+	}
+
+	workspace := workspaces[0]
+	result := importResult{collection: &collection{Name: workspace.Name}}
+	c := result.collection
+	warn := func(format string, a ...interface{}) {
+		result.warnings = append(result.warnings, fmt.Sprintf(format, a...))
+	}
+	if len(workspaces) > 1 {
+		warn("the export holds %d workspaces, only %q was imported", len(workspaces), workspace.Name)
+	}
+	unknownTags := map[string]bool{}
+	templates := func(s string) string {
+		s = templatePattern.ReplaceAllStringFunc(s, func(placeholder string) string {
+			name := templatePattern.FindStringSubmatch(placeholder)[1]
+			return "{{" + strings.TrimPrefix(name, "_.") + "}}"
+		})
+		return insomniaTagPattern.ReplaceAllStringFunc(s, func(tag string) string {
+			m := insomniaTagPattern.FindStringSubmatch(tag)
+			switch {
+			case m[1] == "uuid":
+				return "{{$uuid}}"
+			case m[1] == "now" && strings.Contains(m[2], "iso-8601"):
+				return "{{$isoTimestamp}}"
+			case m[1] == "now" && strings.Contains(m[2], "unix"):
+				return "{{$timestamp}}"
+			}
+			unknownTags[m[1]] = true
+			return tag
+		})
+	}
+	variables := func(data map[string]interface{}) map[string]string {
+		vars := map[string]string{}
+		flattenInsomniaData(data, "", vars)
+		for k, v := range vars {
+			vars[k] = templates(v)
+		}
+		return vars
+	}
+
+	for _, env := range children[workspace.ID] {
+		if env.Type != "environment" {
+			continue
+		}
+		if len(env.Data) > 0 {
+			c.Variables = variables(env.Data)
+		}
+		for _, sub := range children[env.ID] {
+			if sub.Type == "environment" {
+				result.environments = append(result.environments, environment{Name: sub.Name, Variables: variables(sub.Data)})
+			}
+		}
+		break
+	}
+
+	var walk func(parent, folder string, vars map[string]string, headers []insomniaPair, auth *insomniaAuth)
+	walk = func(parent, folder string, vars map[string]string, headers []insomniaPair, auth *insomniaAuth) {
+		for _, res := range children[parent] {
+			switch res.Type {
+			case "request_group":
+				path := res.Name
+				if folder != "" {
+					path = folder + "/" + res.Name
+				}
+				folderVars := map[string]string{}
+				for k, v := range vars {
+					folderVars[k] = v
+				}
+				for k, v := range variables(res.Environment) {
+					folderVars[k] = v
+				}
+				folderAuth := auth
+				if res.Authentication.Type != "" {
+					folderAuth = &res.Authentication
+				}
+				walk(res.ID, path, folderVars, append(append([]insomniaPair(nil), headers...), res.Headers...), folderAuth)
+
+			case "request":
+				r := savedRequest{Name: res.Name, Folder: folder, URL: templates(res.URL)}
+				if method := strings.ToUpper(res.Method); method != "" && method != "GET" {
+					r.Method = method
+				}
+				if len(vars) > 0 {
+					r.Variables = vars
+				}
+				var query []string
+				for _, p := range res.Parameters {
+					if !p.Disabled && p.Name != "" {
+						query = append(query, formEncode(templates(p.Name))+"="+formEncode(templates(p.Value)))
+					}
+				}
+				if len(query) > 0 {
+					sep := "?"
+					if strings.Contains(r.URL, "?") {
+						sep = "&"
+					}
+					r.URL += sep + strings.Join(query, "&")
+				}
+				for _, h := range append(append([]insomniaPair(nil), headers...), res.Headers...) {
+					if h.Disabled || h.Name == "" {
+						continue
+					}
+					if r.Headers == nil {
+						r.Headers = map[string]string{}
+					}
+					setHeaderFold(r.Headers, h.Name, templates(h.Value))
+				}
+				reqWarn := func(format string, a ...interface{}) {
+					warn("%s: "+format, append([]interface{}{itemPath(r)}, a...)...)
+				}
+				convertInsomniaBody(&r, res.Body, templates, reqWarn)
+				a := auth
+				if res.Authentication.Type != "" {
+					a = &res.Authentication
+				}
+				if a != nil {
+					r.Auth = convertInsomniaAuth(a, templates, reqWarn)
+				}
+				c.Requests = append(c.Requests, r)
+			}
+		}
+	}
+	walk(workspace.ID, "", nil, nil, nil)
+
+	for _, kind := range sortedKeys(insomniaUnsupported) {
+		if skipped[kind] > 0 {
+			warn("%d %s requests are not supported and were left out", skipped[kind], insomniaUnsupported[kind])
+		}
+	}
+	if len(unknownTags) > 0 {
+		var names []string
+		for name := range unknownTags {
+			names = append(names, "{% "+name+" %}")
+		}
+		sort.Strings(names)
+		warn("template tags without a lazyhttp equivalent were kept as they are: %s", strings.Join(names, ", "))
+	}
+	return result, nil
+}
+
+// flattenInsomniaData turns nested environment data into variables named
+// by their path, e.g. {"api": {"url": …}} into "api.url", which is how
+// Insomnia templates refer to them
+func flattenInsomniaData(data map[string]interface{}, prefix string, out map[string]string) {
+	for k, v := range data {
+		name := prefix + k
+		switch v := v.(type) {
+		case map[string]interface{}:
+			flattenInsomniaData(v, name+".", out)
+		case string:
+			out[name] = v
+		case nil:
+			out[name] = ""
+		default:
+			text, _ := json.Marshal(v)
+			out[name] = string(text)
+		}
+	}
+}
+
+func convertInsomniaBody(r *savedRequest, b insomniaBody, templates func(string) string, warn func(string, ...interface{})) {
+	setDefault := func(name, value string) {
+		if r.Headers == nil {
+			r.Headers = map[string]string{}
+		}
+		if headerValue(r.Headers, name) == "" {
+			r.Headers[name] = value
+		}
+	}
+	switch {
+	case b.FileName != "":
+		r.BodyFile = b.FileName
+	case b.MimeType == "application/x-www-form-urlencoded":
+		var fields []string
+		for _, p := range b.Params {
+			if !p.Disabled {
+				fields = append(fields, formEncode(templates(p.Name))+"="+formEncode(templates(p.Value)))
+			}
+		}
+		r.Body = strings.Join(fields, "&")
+		setDefault("Content-Type", b.MimeType)
+	case b.MimeType == "multipart/form-data":
+		warn("multipart form bodies are not supported and were left out")
+	case b.MimeType == "application/graphql":
+		// The text is already the JSON of the query and its variables
+		r.Body = templates(b.Text)
+		setDefault("Content-Type", "application/json")
+	case b.Text != "":
+		r.Body = templates(b.Text)
+		if b.MimeType != "" {
+			setDefault("Content-Type", b.MimeType)
+		}
+	}
+}
+
+func convertInsomniaAuth(a *insomniaAuth, templates func(string) string, warn func(string, ...interface{})) *requestAuth {
+	if a.Disabled {
+		return nil
+	}
+	switch a.Type {
+	case "none":
+		return nil
+	case "basic":
+		return &requestAuth{Type: "basic", Username: templates(a.Username), Password: templates(a.Password)}
+	case "bearer":
+		if a.Prefix != "" && !strings.EqualFold(a.Prefix, "Bearer") {
+			warn("bearer token prefix %q replaced by Bearer", a.Prefix)
+		}
+		return &requestAuth{Type: "bearer", Token: templates(a.Token)}
+	case "apikey":
+		in := "header"
+		switch a.AddTo {
+		case "queryParams":
+			in = "query"
+		case "cookie":
+			warn("API key sent as a cookie is sent as a header instead")
+		}
+		return &requestAuth{Type: "apikey", Key: templates(a.Key), Value: templates(a.Value), In: in}
+	}
+	warn("%s auth is not supported and was left out", a.Type)
+	return nil
+}
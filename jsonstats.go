@@ -0,0 +1,287 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	// largeArrayThreshold is the element count above which JSON arrays are
+	// sampled instead of rendered in full
+	largeArrayThreshold = 1000
+
+	// arraySampleSize is how many elements of a large array are shown
+	arraySampleSize = 10
+
+	// maxDistinctTracked bounds the memory used counting distinct values
+	maxDistinctTracked = 10000
+
+	// elementField names the elements themselves in arrays of scalars
+	elementField = "(element)"
+)
+
+// statsField is the field whose distinct values are listed under sampled
+// arrays, cycled with Ctrl+F through the fields of the last rendered ones
+var (
+	statsField      string
+	lastStatsFields []string
+)
+
+// sampleIndices picks k evenly spaced indices out of n, always including
+// the first and the last
+func sampleIndices(n, k int) []int {
+	if n <= k {
+		k = n
+	}
+	if k < 2 {
+		return []int{0}
+	}
+	indices := make([]int, 0, k)
+	for i := 0; i < k; i++ {
+		idx := i * (n - 1) / (k - 1)
+		if len(indices) == 0 || idx != indices[len(indices)-1] {
+			indices = append(indices, idx)
+		}
+	}
+	return indices
+}
+
+// fieldStats summarizes one field across the elements of an array
+type fieldStats struct {
+	name     string
+	types    map[string]int
+	present  int
+	min, max float64
+	numbers  int
+	distinct map[string]int
+	overflow bool // more distinct values than maxDistinctTracked
+}
+
+func (f *fieldStats) add(v interface{}) {
+	f.present++
+	t, key := jsonTypeName(v), ""
+	f.types[t]++
+	switch v := v.(type) {
+	case json.Number:
+		key = v.String()
+		if n, err := v.Float64(); err == nil {
+			if f.numbers == 0 || n < f.min {
+				f.min = n
+			}
+			if f.numbers == 0 || n > f.max {
+				f.max = n
+			}
+			f.numbers++
+		}
+	case string:
+		key = v
+	case bool:
+		key = fmt.Sprint(v)
+	case nil:
+		key = "null"
+	default:
+		// Objects and arrays aren't counted as values
+		return
+	}
+	if _, seen := f.distinct[key]; !seen && len(f.distinct) >= maxDistinctTracked {
+		f.overflow = true
+		return
+	}
+	f.distinct[key]++
+}
+
+// arrayStats summarizes the elements of a large array: the fields of
+// object elements, or the elements themselves for arrays of scalars
+type arrayStats struct {
+	count  int
+	fields []*fieldStats
+}
+
+func arrayStatistics(elems []json.RawMessage) arrayStats {
+	stats := arrayStats{count: len(elems)}
+	index := map[string]*fieldStats{}
+	field := func(name string) *fieldStats {
+		f, ok := index[name]
+		if !ok {
+			f = &fieldStats{name: name, types: map[string]int{}, distinct: map[string]int{}}
+			index[name] = f
+			stats.fields = append(stats.fields, f)
+		}
+		return f
+	}
+
+	for _, raw := range elems {
+		dec := json.NewDecoder(bytes.NewReader(raw))
+		dec.UseNumber()
+		var v interface{}
+		if dec.Decode(&v) != nil {
+			continue
+		}
+		if obj, ok := v.(map[string]interface{}); ok {
+			// Map order is random, keep fields in order of first appearance
+			// as they are in the document
+			for _, key := range objectKeys(raw) {
+				field(key).add(obj[key])
+			}
+		} else {
+			field(elementField).add(v)
+		}
+	}
+	return stats
+}
+
+// objectKeys returns the keys of a JSON object in document order
+func objectKeys(raw json.RawMessage) []string {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	if _, err := dec.Token(); err != nil {
+		return nil
+	}
+	var keys []string
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return keys
+		}
+		keys = append(keys, tok.(string))
+		var skip json.RawMessage
+		if dec.Decode(&skip) != nil {
+			return keys
+		}
+	}
+	return keys
+}
+
+func jsonTypeName(v interface{}) string {
+	switch v.(type) {
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	case json.Number, float64:
+		return "number"
+	case bool:
+		return "boolean"
+	}
+	return "null"
+}
+
+// renderArrayStats draws the statistics block of a sampled array
+func renderArrayStats(stats arrayStats, shown, depth int) string {
+	indent := strings.Repeat("  ", depth)
+	var sb strings.Builder
+	line := func(format string, args ...interface{}) {
+		sb.WriteString(indent)
+		sb.WriteString(jsonAnnotationStyle.Render("// " + fmt.Sprintf(format, args...)))
+		sb.WriteString("\n")
+	}
+
+	line("%d elements, showing a sample of %d", stats.count, shown)
+	line("%-20s %-16s %9s %9s %12s %12s", "field", "type", "present", "distinct", "min", "max")
+	for _, f := range stats.fields {
+		if !containsString(lastStatsFields, f.name) {
+			lastStatsFields = append(lastStatsFields, f.name)
+		}
+		distinct := fmt.Sprint(len(f.distinct))
+		if f.overflow {
+			distinct += "+"
+		} else if len(f.distinct) == 0 {
+			distinct = "-"
+		}
+		min, max := "", ""
+		if f.numbers > 0 {
+			min, max = formatStat(f.min), formatStat(f.max)
+		}
+		line("%-20s %-16s %9d %9s %12s %12s", truncate(f.name, 20), truncate(typeSummary(f.types), 16), f.present, distinct, min, max)
+	}
+
+	for _, f := range stats.fields {
+		if f.name != statsField {
+			continue
+		}
+		line("")
+		line("distinct values of %s:", f.name)
+		for _, v := range topValues(f.distinct, 10) {
+			line("  %-40s %d", truncate(v.value, 40), v.count)
+		}
+		if len(f.distinct) > 10 {
+			line("  … %d more", len(f.distinct)-10)
+		}
+	}
+	if statsField == "" {
+		line("Ctrl+F: list the distinct values of a field")
+	}
+	return strings.TrimSuffix(sb.String(), "\n")
+}
+
+func typeSummary(types map[string]int) string {
+	var names []string
+	for t := range types {
+		names = append(names, t)
+	}
+	sort.Strings(names)
+	return strings.Join(names, "|")
+}
+
+func formatStat(f float64) string {
+	if f == float64(int64(f)) {
+		return fmt.Sprint(int64(f))
+	}
+	return fmt.Sprintf("%.4g", f)
+}
+
+type valueCount struct {
+	value string
+	count int
+}
+
+// topValues returns the n most frequent values
+func topValues(counts map[string]int, n int) []valueCount {
+	values := make([]valueCount, 0, len(counts))
+	for v, c := range counts {
+		values = append(values, valueCount{v, c})
+	}
+	sort.Slice(values, func(i, j int) bool {
+		if values[i].count != values[j].count {
+			return values[i].count > values[j].count
+		}
+		return values[i].value < values[j].value
+	})
+	if len(values) > n {
+		values = values[:n]
+	}
+	return values
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// nextStatsField moves statsField to the next field of the sampled arrays,
+// wrapping around to none
+func nextStatsField() {
+	if len(lastStatsFields) == 0 {
+		statsField = ""
+		return
+	}
+	for i, f := range lastStatsFields {
+		if f == statsField {
+			if i+1 < len(lastStatsFields) {
+				statsField = lastStatsFields[i+1]
+			} else {
+				statsField = ""
+			}
+			return
+		}
+	}
+	statsField = lastStatsFields[0]
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// jsonTypeAnnotations shows the type of every scalar in JSON views,
+// toggled with Ctrl+T
+var jsonTypeAnnotations bool
+
+var (
+	jsonKeyStyle        = lipgloss.NewStyle().Foreground(lipgloss.Color("#61AFEF"))
+	jsonStringStyle     = lipgloss.NewStyle().Foreground(lipgloss.Color("#98C379"))
+	jsonNumberStyle     = lipgloss.NewStyle().Foreground(lipgloss.Color("#D19A66"))
+	jsonBoolStyle       = lipgloss.NewStyle().Foreground(lipgloss.Color("#C678DD"))
+	jsonNullStyle       = lipgloss.NewStyle().Italic(true).Foreground(lipgloss.Color("#E06C75"))
+	jsonPunctStyle      = lipgloss.NewStyle().Foreground(lipgloss.Color("#ABB2BF"))
+	jsonAnnotationStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("#5C6370"))
+)
+
+// renderTypedJSON pretty-prints a JSON document keeping the key order and
+// giving strings, numbers, booleans and nulls distinct colors. With
+// annotate every scalar is followed by its type, and strings holding a
+// number or boolean are called out since they're easily mistaken for one.
+func renderTypedJSON(body []byte, annotate bool) (string, error) {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	p := &jsonPrinter{dec: dec, annotate: annotate}
+	lastStatsFields = nil
+
+	tok, err := dec.Token()
+	if err != nil {
+		return "", err
+	}
+	if err := p.value(tok, 0); err != nil {
+		return "", err
+	}
+	p.sb.WriteString(p.pending)
+	// Trailing garbage means this isn't a single JSON document
+	if _, err := dec.Token(); err != io.EOF {
+		return "", errInvalidJSON
+	}
+	return p.sb.String(), nil
+}
+
+var errInvalidJSON = errors.New("unexpected data after the JSON document")
+
+type jsonPrinter struct {
+	dec      *json.Decoder
+	sb       strings.Builder
+	annotate bool
+	pending  string // annotation of the last scalar, written after its comma
+}
+
+func (p *jsonPrinter) indent(depth int) {
+	p.sb.WriteString(strings.Repeat("  ", depth))
+}
+
+// separator ends the current line, with the comma before the annotation
+func (p *jsonPrinter) separator(comma bool) {
+	if comma {
+		p.sb.WriteString(jsonPunctStyle.Render(","))
+	}
+	p.sb.WriteString(p.pending)
+	p.pending = ""
+	p.sb.WriteString("\n")
+}
+
+func (p *jsonPrinter) value(tok json.Token, depth int) error {
+	switch t := tok.(type) {
+	case json.Delim:
+		if t == '[' {
+			return p.array(depth)
+		}
+		if !p.dec.More() {
+			if _, err := p.dec.Token(); err != nil {
+				return err
+			}
+			p.sb.WriteString(jsonPunctStyle.Render("{}"))
+			p.annotation("empty object")
+			return nil
+		}
+
+		p.sb.WriteString(jsonPunctStyle.Render("{"))
+		p.pending = ""
+		p.sb.WriteString("\n")
+		for first := true; p.dec.More(); first = false {
+			if !first {
+				p.separator(true)
+			}
+			p.indent(depth + 1)
+			key, err := p.dec.Token()
+			if err != nil {
+				return err
+			}
+			p.sb.WriteString(jsonKeyStyle.Render(strconv.Quote(key.(string))))
+			p.sb.WriteString(jsonPunctStyle.Render(": "))
+			next, err := p.dec.Token()
+			if err != nil {
+				return err
+			}
+			if err := p.value(next, depth+1); err != nil {
+				return err
+			}
+		}
+		if _, err := p.dec.Token(); err != nil {
+			return err
+		}
+		p.separator(false)
+		p.indent(depth)
+		p.sb.WriteString(jsonPunctStyle.Render("}"))
+	case string:
+		p.sb.WriteString(jsonStringStyle.Render(strconv.Quote(t)))
+		switch {
+		case looksNumeric(t):
+			p.annotation("string, looks like a number")
+		case t == "true" || t == "false":
+			p.annotation("string, looks like a boolean")
+		case t == "null":
+			p.annotation("string, looks like null")
+		default:
+			p.annotation("string")
+		}
+	case json.Number:
+		p.sb.WriteString(jsonNumberStyle.Render(t.String()))
+		if _, err := t.Int64(); err == nil {
+			p.annotation("integer")
+		} else {
+			p.annotation("number")
+		}
+	case bool:
+		p.sb.WriteString(jsonBoolStyle.Render(strconv.FormatBool(t)))
+		p.annotation("boolean")
+	case nil:
+		p.sb.WriteString(jsonNullStyle.Render("null"))
+		p.annotation("null")
+	}
+	return nil
+}
+
+// array prints the array whose opening bracket was just read. Elements
+// are collected first so that huge arrays can be sampled instead.
+func (p *jsonPrinter) array(depth int) error {
+	var elems []json.RawMessage
+	for p.dec.More() {
+		var raw json.RawMessage
+		if err := p.dec.Decode(&raw); err != nil {
+			return err
+		}
+		elems = append(elems, raw)
+	}
+	if _, err := p.dec.Token(); err != nil {
+		return err
+	}
+
+	if len(elems) == 0 {
+		p.sb.WriteString(jsonPunctStyle.Render("[]"))
+		p.annotation("empty array")
+		return nil
+	}
+
+	shown := make([]int, len(elems))
+	for i := range shown {
+		shown[i] = i
+	}
+	large := len(elems) > largeArrayThreshold
+	if large {
+		shown = sampleIndices(len(elems), arraySampleSize)
+	}
+
+	p.sb.WriteString(jsonPunctStyle.Render("["))
+	p.pending = ""
+	p.sb.WriteString("\n")
+	if large {
+		// The statistics go first, a comment can't follow the last element
+		p.sb.WriteString(renderArrayStats(arrayStatistics(elems), len(shown), depth+1))
+		p.sb.WriteString("\n")
+	}
+	prev := -1
+	for n, i := range shown {
+		if n > 0 {
+			p.separator(true)
+		}
+		if i > prev+1 {
+			p.indent(depth + 1)
+			p.sb.WriteString(jsonAnnotationStyle.Render(fmt.Sprintf("… %d more …", i-prev-1)))
+			p.sb.WriteString("\n")
+		}
+		p.indent(depth + 1)
+		if err := p.element(elems[i], depth+1); err != nil {
+			return err
+		}
+		prev = i
+	}
+	p.separator(false)
+	p.indent(depth)
+	p.sb.WriteString(jsonPunctStyle.Render("]"))
+	return nil
+}
+
+// element prints one collected array element
+func (p *jsonPrinter) element(raw json.RawMessage, depth int) error {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	sub := &jsonPrinter{dec: dec, annotate: p.annotate}
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if err := sub.value(tok, depth); err != nil {
+		return err
+	}
+	p.sb.WriteString(sub.sb.String())
+	p.pending = sub.pending
+	return nil
+}
+
+func (p *jsonPrinter) annotation(text string) {
+	if p.annotate {
+		p.pending = jsonAnnotationStyle.Render("  ‹" + text + "›")
+	}
+}
+
+// looksNumeric reports whether a string holds a JSON number
+func looksNumeric(s string) bool {
+	if s == "" {
+		return false
+	}
+	var n json.Number
+	return json.Unmarshal([]byte(s), &n) == nil
+}
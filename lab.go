@@ -0,0 +1,345 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/textarea"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// labEditorHeight is the number of rows given to the raw request editor
+const labEditorHeight = 10
+
+// lineEndings are the terminators the lab can join editor lines with.
+// "as typed" adds nothing, leaving line breaks entirely to escapes.
+var lineEndings = []struct {
+	name string
+	sep  string
+}{
+	{"CRLF", "\r\n"},
+	{"LF", "\n"},
+	{"CR", "\r"},
+	{"as typed", ""},
+}
+
+// labPreset is a canned edge-case request. {{host}} is replaced with the
+// target host when the preset is loaded.
+type labPreset struct {
+	name       string
+	lineEnding int
+	payload    string
+}
+
+var labPresets = []labPreset{
+	{"CL.TE desync", 0, "POST / HTTP/1.1\nHost: {{host}}\nContent-Length: 6\nTransfer-Encoding: chunked\n\n0\n\nG"},
+	{"TE.CL desync", 0, "POST / HTTP/1.1\nHost: {{host}}\nContent-Length: 4\nTransfer-Encoding: chunked\n\n5c\nGPOST / HTTP/1.1\nContent-Type: application/x-www-form-urlencoded\nContent-Length: 15\n\nx=1\n0\n\n"},
+	{"TE.TE obfuscation", 0, "POST / HTTP/1.1\nHost: {{host}}\nContent-Length: 4\nTransfer-Encoding: chunked\nTransfer-encoding : x\n\n5c\nGPOST / HTTP/1.1\nContent-Type: application/x-www-form-urlencoded\nContent-Length: 15\n\nx=1\n0\n\n"},
+	{"Duplicate Content-Length", 0, "POST / HTTP/1.1\nHost: {{host}}\nContent-Length: 3\nContent-Length: 5\n\nabcde"},
+	{"obs-fold header", 0, "GET / HTTP/1.1\nHost: {{host}}\nX-Folded: first\n\tcontinued\nConnection: close\n\n"},
+	{"Bare LF line endings", 1, "GET / HTTP/1.1\nHost: {{host}}\nConnection: close\n\n"},
+	{"Banner grab (send nothing)", 3, ""},
+	{"Mixed line endings", 3, "GET / HTTP/1.1\\r\\nHost: {{host}}\\nX-Test: a\\rConnection: close\\r\\n\\r\\n"},
+}
+
+// labModel is the request smuggling and header edge-case lab: a raw
+// request editor sent byte for byte over TCP or TLS. With an empty editor
+// it doubles as a banner grabber for non-HTTP services.
+type labModel struct {
+	target     textinput.Model
+	editor     textarea.Model
+	useTLS     bool
+	lineEnding int
+	preset     int
+	sending    bool
+	hexView    bool
+	last       *rawResponseMsg
+}
+
+func newLabModel() labModel {
+	target := textinput.New()
+	target.Prompt = "Target: "
+	target.Placeholder = "host:port"
+
+	editor := textarea.New()
+	editor.Placeholder = "Raw bytes to send (leave empty to grab the banner). Escapes: \\r \\n \\t \\xHH \\\\"
+	editor.ShowLineNumbers = true
+	editor.SetHeight(labEditorHeight)
+	editor.CharLimit = 0
+
+	return labModel{target: target, editor: editor, preset: -1}
+}
+
+// buildRawPayload joins the editor lines with the chosen line ending and
+// expands escape sequences, so every byte on the wire is under the user's
+// control
+func buildRawPayload(text, sep string) []byte {
+	lines := strings.Split(text, "\n")
+	var out []byte
+	for i, line := range lines {
+		out = append(out, unescapeRaw(line)...)
+		if i < len(lines)-1 {
+			out = append(out, sep...)
+		}
+	}
+	return out
+}
+
+// unescapeRaw expands \r, \n, \t, \\ and \xHH; anything else is kept as is
+func unescapeRaw(s string) []byte {
+	out := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 >= len(s) {
+			out = append(out, s[i])
+			continue
+		}
+		switch s[i+1] {
+		case 'r':
+			out = append(out, '\r')
+			i++
+		case 'n':
+			out = append(out, '\n')
+			i++
+		case 't':
+			out = append(out, '\t')
+			i++
+		case '\\':
+			out = append(out, '\\')
+			i++
+		case 'x':
+			if i+3 < len(s) {
+				if b, err := strconv.ParseUint(s[i+2:i+4], 16, 8); err == nil {
+					out = append(out, byte(b))
+					i += 3
+					continue
+				}
+			}
+			out = append(out, s[i])
+		default:
+			out = append(out, s[i])
+		}
+	}
+	return out
+}
+
+// visualizeRaw makes CR, LF and other control bytes visible so line ending
+// games in the response can be seen
+func visualizeRaw(data []byte) string {
+	marker := lipgloss.NewStyle().Foreground(lipgloss.Color("#5C6370"))
+	var sb strings.Builder
+	for _, b := range data {
+		switch {
+		case b == '\r':
+			sb.WriteString(marker.Render(`\r`))
+		case b == '\n':
+			sb.WriteString(marker.Render(`\n`))
+			sb.WriteByte('\n')
+		case b == '\t':
+			sb.WriteByte('\t')
+		case b < 0x20 || b >= 0x7f:
+			sb.WriteString(marker.Render(fmt.Sprintf(`\x%02x`, b)))
+		default:
+			sb.WriteByte(b)
+		}
+	}
+	return sb.String()
+}
+
+func sendLabRequest(ctx context.Context, addr string, useTLS bool, payload []byte) tea.Cmd {
+	return func() tea.Msg {
+		return sendRaw(ctx, addr, useTLS, payload)
+	}
+}
+
+// labAddr fills in the default port for the selected transport
+func (l labModel) labAddr() string {
+	addr := strings.TrimSpace(l.target.Value())
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		if l.useTLS {
+			return net.JoinHostPort(addr, "443")
+		}
+		return net.JoinHostPort(addr, "80")
+	}
+	return addr
+}
+
+func (l labModel) targetHost() string {
+	addr := strings.TrimSpace(l.target.Value())
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	if addr == "" {
+		return "example.com"
+	}
+	return addr
+}
+
+func (m model) enterLab() model {
+	m.mode = modeLab
+	m.textInput.Blur()
+	m.lab.target.Focus()
+	m.lab.editor.Blur()
+	m.response = "Send a raw request with Ctrl+S"
+	m.err = nil
+	m.suggestions = nil
+	m.viewport.SetContent(m.response)
+	return m.layout()
+}
+
+// updateLab handles input while the lab is open
+func (m model) updateLab(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	var cmd tea.Cmd
+
+	switch msg.Type {
+	case tea.KeyCtrlC:
+		if m.cancel != nil {
+			m.cancel()
+		}
+		return m, tea.Quit
+	case tea.KeyEsc, tea.KeyCtrlL:
+		m.mode = modeHTTP
+		m.textInput.Focus()
+		m.response = "Response will appear here"
+		m.viewport.SetContent(m.response)
+		return m.layout(), nil
+	case tea.KeyTab:
+		if m.lab.target.Focused() {
+			m.lab.target.Blur()
+			return m, m.lab.editor.Focus()
+		}
+		m.lab.editor.Blur()
+		return m, m.lab.target.Focus()
+	case tea.KeyCtrlT:
+		m.lab.useTLS = !m.lab.useTLS
+		return m, nil
+	case tea.KeyCtrlE:
+		m.lab.lineEnding = (m.lab.lineEnding + 1) % len(lineEndings)
+		return m, nil
+	case tea.KeyCtrlP:
+		m.lab.preset = (m.lab.preset + 1) % len(labPresets)
+		p := labPresets[m.lab.preset]
+		m.lab.lineEnding = p.lineEnding
+		m.lab.editor.SetValue(strings.ReplaceAll(p.payload, "{{host}}", m.lab.targetHost()))
+		return m, nil
+	case tea.KeyCtrlO:
+		m.lab.hexView = !m.lab.hexView
+		if m.lab.last != nil {
+			m.response = renderRawResponse(*m.lab.last, m.lab.hexView)
+			m.viewport.SetContent(m.response)
+		}
+		return m, nil
+	case tea.KeyCtrlX:
+		if m.lab.sending && m.cancel != nil {
+			m.cancel()
+		}
+		return m, nil
+	case tea.KeyCtrlN:
+		// Keep the connection open and talk over it line by line
+		if m.lab.sending || strings.TrimSpace(m.lab.target.Value()) == "" {
+			return m, nil
+		}
+		m.netcat.lineEnding = m.lab.lineEnding
+		return m.openNetcat(m.lab.labAddr(), m.lab.useTLS)
+	case tea.KeyCtrlS:
+		if m.lab.sending || strings.TrimSpace(m.lab.target.Value()) == "" {
+			return m, nil
+		}
+		var payload []byte
+		if m.lab.editor.Value() != "" {
+			payload = buildRawPayload(m.lab.editor.Value(), lineEndings[m.lab.lineEnding].sep)
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		m.cancel = cancel
+		m.lab.sending = true
+		m.err = nil
+		if len(payload) == 0 {
+			m.response = fmt.Sprintf("Connecting to %s...", m.lab.labAddr())
+		} else {
+			m.response = fmt.Sprintf("Sending %s to %s...", formatBytes(int64(len(payload))), m.lab.labAddr())
+		}
+		m.viewport.SetContent(m.response)
+		return m, sendLabRequest(ctx, m.lab.labAddr(), m.lab.useTLS, payload)
+	case tea.KeyPgUp, tea.KeyPgDown:
+		m.viewport, cmd = m.viewport.Update(msg)
+		return m, cmd
+	}
+
+	if m.lab.target.Focused() {
+		m.lab.target, cmd = m.lab.target.Update(msg)
+	} else {
+		m.lab.editor, cmd = m.lab.editor.Update(msg)
+	}
+	return m, cmd
+}
+
+// renderRawResponse shows a raw exchange, either as text with visible
+// control characters or as a hex dump
+func renderRawResponse(r rawResponseMsg, hex bool) string {
+	var sb strings.Builder
+	if r.remote != "" {
+		fmt.Fprintf(&sb, "%s %s\n", headerStyle.Render("Connected:"), r.remote)
+	}
+	if r.tls != nil {
+		fmt.Fprintf(&sb, "%s %s, %s", headerStyle.Render("TLS:"),
+			tls.VersionName(r.tls.Version), tls.CipherSuiteName(r.tls.CipherSuite))
+		if r.tls.NegotiatedProtocol != "" {
+			fmt.Fprintf(&sb, ", ALPN %s", r.tls.NegotiatedProtocol)
+		}
+		if len(r.tls.PeerCertificates) > 0 {
+			fmt.Fprintf(&sb, ", %s", r.tls.PeerCertificates[0].Subject)
+		}
+		sb.WriteString("\n")
+	}
+	fmt.Fprintf(&sb, "%s %s • %s %s • %s %s\n",
+		headerStyle.Render("Sent:"), formatBytes(int64(r.sent)),
+		headerStyle.Render("Received:"), formatBytes(int64(len(r.data))),
+		headerStyle.Render("Time:"), r.elapsed.Round(1e6))
+	if r.err != nil {
+		sb.WriteString(errorStyle.Render(fmt.Sprintf("Error: %v", r.err)))
+		sb.WriteString("\n")
+	}
+	sb.WriteString("\n")
+	if hex {
+		sb.WriteString(hexDump(r.data))
+	} else {
+		sb.WriteString(visualizeRaw(r.data))
+	}
+	return sb.String()
+}
+
+func (m model) labView() string {
+	transport := "TCP"
+	if m.lab.useTLS {
+		transport = "TLS"
+	}
+	preset := "none"
+	if m.lab.preset >= 0 {
+		preset = labPresets[m.lab.preset].name
+	}
+	view := "text"
+	if m.lab.hexView {
+		view = "hex"
+	}
+	status := fmt.Sprintf("%s %s • %s %s • %s %s • %s %s",
+		headerStyle.Render("Transport:"), transport,
+		headerStyle.Render("Line endings:"), lineEndings[m.lab.lineEnding].name,
+		headerStyle.Render("Preset:"), preset,
+		headerStyle.Render("View:"), view)
+	if m.lab.sending {
+		status += " " + lipgloss.NewStyle().Foreground(lipgloss.Color("#FFCC00")).Render("Sending...")
+	}
+
+	responseView := m.viewport.View()
+	if m.err != nil {
+		responseView = errorStyle.Render(fmt.Sprintf("Error: %v", m.err))
+	}
+
+	return fmt.Sprintf("%s\n%s\n\n%s\n\n%s",
+		inputStyle.Render(m.lab.target.View()), status, m.lab.editor.View(), responseView)
+}
@@ -0,0 +1,434 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// rawEventFrames shows server-sent event streams as their frames instead
+// of the text reassembled from them, toggled with Ctrl+Q
+var rawEventFrames bool
+
+var (
+	thinkingStyle = lipgloss.NewStyle().Italic(true).Foreground(lipgloss.Color("#888888"))
+	toolCallStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("#C678DD"))
+	eventStyle    = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("#61AFEF"))
+)
+
+// sseEvent is one event of a text/event-stream body
+type sseEvent struct {
+	event, data, id string
+	retry           string        // reconnection delay the server asks for, in ms
+	at              time.Duration // since the stream began, 0 when unknown
+}
+
+// isEventStream tells whether a content type is server-sent events
+func isEventStream(contentType string) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	return mediaType == "text/event-stream"
+}
+
+// parseSSE splits an event stream into its events. An event still being
+// received, not yet ended by a blank line, is left out.
+func parseSSE(body []byte) []sseEvent {
+	var events []sseEvent
+	var e sseEvent
+	var data []string
+	started := false
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(make([]byte, 64*1024), len(body)+1)
+	complete := bytes.HasSuffix(body, []byte("\n\n")) || bytes.HasSuffix(body, []byte("\r\n\r\n"))
+	for scanner.Scan() {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if line == "" {
+			if started {
+				e.data = strings.Join(data, "\n")
+				events = append(events, e)
+			}
+			e, data, started = sseEvent{}, nil, false
+			continue
+		}
+		if strings.HasPrefix(line, ":") {
+			continue // comment, often a keep-alive
+		}
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "event":
+			e.event, started = value, true
+		case "data":
+			data, started = append(data, value), true
+		case "id":
+			e.id, started = value, true
+		case "retry":
+			e.retry, started = value, true
+		}
+	}
+	if started && complete {
+		e.data = strings.Join(data, "\n")
+		events = append(events, e)
+	}
+	return events
+}
+
+// sseReader parses an event stream as it arrives, each event once,
+// noting when it was received
+type sseReader struct {
+	events []sseEvent
+	parsed int // bytes of the body up to the end of the last event
+	start  time.Time
+}
+
+// feed parses the events body, the stream received so far, completed
+// since the last call
+func (r *sseReader) feed(body []byte) {
+	if r.start.IsZero() {
+		r.start = time.Now()
+	}
+	if len(body) <= r.parsed {
+		return
+	}
+	// Events end with a blank line, after LF or CRLF line endings
+	rest := body[r.parsed:]
+	cut := -1
+	if i := bytes.LastIndex(rest, []byte("\n\n")); i >= 0 {
+		cut = i + 2
+	}
+	if i := bytes.LastIndex(rest, []byte("\n\r\n")); i >= 0 && i+3 > cut {
+		cut = i + 3
+	}
+	if cut < 0 {
+		return
+	}
+	at := time.Since(r.start)
+	for _, e := range parseSSE(rest[:cut]) {
+		e.at = at
+		r.events = append(r.events, e)
+	}
+	r.parsed += cut
+}
+
+// llmStream is the reply of a chat completion API put back together from
+// the deltas of its event stream
+type llmStream struct {
+	provider string
+	model    string
+	text     strings.Builder
+	thinking strings.Builder
+	tools    []*llmToolCall
+	stop     string
+	usage    map[string]float64
+	errors   []string
+}
+
+type llmToolCall struct {
+	name string
+	args strings.Builder
+}
+
+// tool returns the tool call at index, adding calls up to it
+func (s *llmStream) tool(index int) *llmToolCall {
+	for len(s.tools) <= index {
+		s.tools = append(s.tools, &llmToolCall{})
+	}
+	return s.tools[index]
+}
+
+// assembleLLMStream reassembles the text of an OpenAI (chat completions
+// or responses), Anthropic or Gemini stream; nil for other streams
+func assembleLLMStream(events []sseEvent) *llmStream {
+	s := &llmStream{usage: map[string]float64{}}
+	for _, e := range events {
+		var data map[string]interface{}
+		if json.Unmarshal([]byte(e.data), &data) != nil {
+			continue
+		}
+		typ := asString(data["type"])
+		switch {
+		case strings.HasPrefix(typ, "message_") || strings.HasPrefix(typ, "content_block_") || typ == "ping" || e.event == "error" && data["error"] != nil:
+			s.provider = "Anthropic"
+			s.anthropic(typ, data)
+		case strings.HasPrefix(typ, "response.") || typ == "error" && data["message"] != nil:
+			s.provider = "OpenAI responses"
+			s.openAIResponses(typ, data)
+		case data["choices"] != nil:
+			s.provider = "OpenAI chat"
+			s.openAIChat(data)
+		case data["candidates"] != nil:
+			s.provider = "Gemini"
+			s.gemini(data)
+		}
+	}
+	if s.provider == "" {
+		return nil
+	}
+	return s
+}
+
+func (s *llmStream) anthropic(typ string, data map[string]interface{}) {
+	switch typ {
+	case "message_start":
+		message := asMap(data["message"])
+		s.model = asString(message["model"])
+		s.addUsage(asMap(message["usage"]))
+	case "content_block_start":
+		if block := asMap(data["content_block"]); asString(block["type"]) == "tool_use" {
+			s.tool(int(viewNumber(data["index"]))).name = asString(block["name"])
+		}
+	case "content_block_delta":
+		delta := asMap(data["delta"])
+		switch asString(delta["type"]) {
+		case "text_delta":
+			s.text.WriteString(asString(delta["text"]))
+		case "thinking_delta":
+			s.thinking.WriteString(asString(delta["thinking"]))
+		case "input_json_delta":
+			s.tool(int(viewNumber(data["index"]))).args.WriteString(asString(delta["partial_json"]))
+		}
+	case "message_delta":
+		if stop := asString(asMap(data["delta"])["stop_reason"]); stop != "" {
+			s.stop = stop
+		}
+		// The output tokens of message_delta are a running total
+		s.setUsage(asMap(data["usage"]))
+	default:
+		if err := asMap(data["error"]); err != nil {
+			s.errors = append(s.errors, asString(err["type"])+": "+asString(err["message"]))
+		}
+	}
+}
+
+func (s *llmStream) openAIChat(data map[string]interface{}) {
+	if model := asString(data["model"]); model != "" {
+		s.model = model
+	}
+	for _, raw := range asList(data["choices"]) {
+		choice := asMap(raw)
+		if viewNumber(choice["index"]) != 0 {
+			continue // only the first of n choices is shown
+		}
+		delta := asMap(choice["delta"])
+		if delta == nil {
+			// Legacy completions stream text instead of deltas
+			s.text.WriteString(asString(choice["text"]))
+		}
+		s.text.WriteString(asString(delta["content"]))
+		s.thinking.WriteString(asString(delta["reasoning_content"]))
+		for _, rawCall := range asList(delta["tool_calls"]) {
+			call := asMap(rawCall)
+			tool := s.tool(int(viewNumber(call["index"])))
+			fn := asMap(call["function"])
+			if name := asString(fn["name"]); name != "" {
+				tool.name = name
+			}
+			tool.args.WriteString(asString(fn["arguments"]))
+		}
+		if stop := asString(choice["finish_reason"]); stop != "" {
+			s.stop = stop
+		}
+	}
+	s.setUsage(asMap(data["usage"]))
+	if err := asMap(data["error"]); err != nil {
+		s.errors = append(s.errors, asString(err["message"]))
+	}
+}
+
+func (s *llmStream) openAIResponses(typ string, data map[string]interface{}) {
+	switch typ {
+	case "response.output_text.delta":
+		s.text.WriteString(asString(data["delta"]))
+	case "response.reasoning_summary_text.delta", "response.reasoning_text.delta":
+		s.thinking.WriteString(asString(data["delta"]))
+	case "response.output_item.added":
+		if item := asMap(data["item"]); asString(item["type"]) == "function_call" {
+			s.tool(int(viewNumber(data["output_index"]))).name = asString(item["name"])
+		}
+	case "response.function_call_arguments.delta":
+		s.tool(int(viewNumber(data["output_index"]))).args.WriteString(asString(data["delta"]))
+	case "response.created", "response.completed", "response.incomplete", "response.failed":
+		response := asMap(data["response"])
+		if model := asString(response["model"]); model != "" {
+			s.model = model
+		}
+		if typ != "response.created" {
+			s.stop = asString(response["status"])
+		}
+		s.setUsage(asMap(response["usage"]))
+		if err := asMap(response["error"]); err != nil {
+			s.errors = append(s.errors, asString(err["message"]))
+		}
+	case "error":
+		s.errors = append(s.errors, asString(data["message"]))
+	}
+}
+
+func (s *llmStream) gemini(data map[string]interface{}) {
+	if model := asString(data["modelVersion"]); model != "" {
+		s.model = model
+	}
+	if candidates := asList(data["candidates"]); len(candidates) > 0 {
+		candidate := asMap(candidates[0])
+		for _, raw := range asList(asMap(candidate["content"])["parts"]) {
+			part := asMap(raw)
+			if thought, _ := part["thought"].(bool); thought {
+				s.thinking.WriteString(asString(part["text"]))
+			} else {
+				s.text.WriteString(asString(part["text"]))
+			}
+		}
+		if stop := asString(candidate["finishReason"]); stop != "" {
+			s.stop = stop
+		}
+	}
+	s.setUsage(asMap(data["usageMetadata"]))
+}
+
+// renderSSEEvent draws the nth event of a stream: its number, when it
+// arrived, its type and id on one line, then its data
+func renderSSEEvent(n int, e sseEvent) string {
+	var sb strings.Builder
+	head := []string{historyDimStyle.Render(fmt.Sprintf("#%d", n))}
+	if e.at > 0 {
+		head = append(head, historyDimStyle.Render("+"+formatDuration(e.at)))
+	}
+	// Events without a type are dispatched as "message", frames without
+	// data, setting only the retry delay say, not at all
+	switch {
+	case e.event != "":
+		head = append(head, eventStyle.Render(e.event))
+	case e.data != "":
+		head = append(head, eventStyle.Render("message"))
+	}
+	if e.id != "" {
+		head = append(head, historyDimStyle.Render("id ")+e.id)
+	}
+	if e.retry != "" {
+		head = append(head, historyDimStyle.Render("retry "+e.retry+"ms"))
+	}
+	sb.WriteString(strings.Join(head, "  "))
+	sb.WriteString("\n")
+	if e.data != "" {
+		for _, line := range strings.Split(e.data, "\n") {
+			sb.WriteString("  " + line + "\n")
+		}
+	}
+	sb.WriteString("\n")
+	return sb.String()
+}
+
+// addUsage adds up token counts reported in parts
+func (s *llmStream) addUsage(usage map[string]interface{}) {
+	for k, v := range usage {
+		if n, ok := v.(float64); ok {
+			s.usage[k] += n
+		}
+	}
+}
+
+// setUsage keeps token counts reported as totals
+func (s *llmStream) setUsage(usage map[string]interface{}) {
+	for k, v := range usage {
+		if n, ok := v.(float64); ok {
+			s.usage[k] = n
+		}
+	}
+}
+
+// maxShownEvents bounds the events listed of a stream, the latest being
+// shown, as long-lived streams can go on for hours
+const maxShownEvents = 500
+
+var liveStyle = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("#E06C75"))
+
+// renderEventStream shows an event stream as the text reassembled from
+// its events, wrapped to width, or the events themselves when
+// rawEventFrames is set or the stream isn't one lazyhttp knows how to
+// reassemble. live marks a stream still arriving.
+func renderEventStream(events []sseEvent, width int, live bool) string {
+	s := assembleLLMStream(events)
+	var sb strings.Builder
+	var hints []string
+	if live {
+		hints = append(hints, liveStyle.Render("● live")+historyDimStyle.Render(" • Ctrl+X: Stop"))
+	}
+	if s == nil || rawEventFrames {
+		fmt.Fprintf(&sb, "%s %d events", headerStyle.Render("Stream:"), len(events))
+		for i := len(events) - 1; i >= 0; i-- {
+			if events[i].id != "" {
+				sb.WriteString(historyDimStyle.Render(" • last id " + events[i].id))
+				break
+			}
+		}
+		if s != nil {
+			hints = append(hints, historyDimStyle.Render("Ctrl+Q: Reassembled text"))
+		}
+		for _, hint := range hints {
+			sb.WriteString(historyDimStyle.Render(" • ") + hint)
+		}
+		sb.WriteString("\n\n")
+		first := max(len(events)-maxShownEvents, 0)
+		if first > 0 {
+			sb.WriteString(historyDimStyle.Render(fmt.Sprintf("… %d earlier events not shown", first)))
+			sb.WriteString("\n\n")
+		}
+		for i, e := range events[first:] {
+			sb.WriteString(renderSSEEvent(first+i+1, e))
+		}
+		if live && len(events) == 0 {
+			sb.WriteString(historyDimStyle.Render("Waiting for events..."))
+			sb.WriteString("\n")
+		}
+		return sb.String()
+	}
+
+	summary := s.provider
+	if s.model != "" {
+		summary += ", " + s.model
+	}
+	hints = append(hints, historyDimStyle.Render("Ctrl+Q: Raw events"))
+	fmt.Fprintf(&sb, "%s %s (%d events)", headerStyle.Render("Stream:"), summary, len(events))
+	for _, hint := range hints {
+		sb.WriteString(historyDimStyle.Render(" • ") + hint)
+	}
+	sb.WriteString("\n\n")
+	if s.thinking.Len() > 0 {
+		sb.WriteString(thinkingStyle.Width(width).Render(strings.TrimSpace(s.thinking.String())))
+		sb.WriteString("\n\n")
+	}
+	text := s.text.String()
+	if live {
+		text += "▌"
+	}
+	sb.WriteString(lipgloss.NewStyle().Width(width).Render(text))
+	sb.WriteString("\n")
+	for _, t := range s.tools {
+		if t.name != "" || t.args.Len() > 0 {
+			fmt.Fprintf(&sb, "\n%s %s\n", toolCallStyle.Render("Tool call: "+t.name), t.args.String())
+		}
+	}
+	for _, err := range s.errors {
+		sb.WriteString("\n" + errorStyle.Render("Stream error: "+err) + "\n")
+	}
+	if !live || s.stop != "" {
+		var footer []string
+		if s.stop != "" {
+			footer = append(footer, "stop: "+s.stop)
+		}
+		for _, k := range sortedKeys(s.usage) {
+			if strings.HasSuffix(k, "tokens") || strings.HasSuffix(k, "TokenCount") {
+				footer = append(footer, fmt.Sprintf("%s: %s", k, formatUnits(s.usage[k])))
+			}
+		}
+		if len(footer) > 0 {
+			sb.WriteString("\n" + historyDimStyle.Render(strings.Join(footer, " • ")) + "\n")
+		}
+	}
+	return sb.String()
+}
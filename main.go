@@ -1,12 +1,19 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"net/http"
+	"net/http/httptrace"
+	"os"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/alecthomas/chroma"
 	"github.com/alecthomas/chroma/formatters"
@@ -17,11 +24,15 @@ import (
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 	"github.com/yosssi/gohtml"
+	"gopkg.in/yaml.v3"
 )
 
 const (
 	inputHeight = 1
 	padding     = 2
+
+	// defaultUserAgent mimics a browser to avoid some blocks
+	defaultUserAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/91.0.4472.124 Safari/537.36"
 )
 
 var (
@@ -47,20 +58,222 @@ var (
 			Foreground(lipgloss.Color("#61AFEF"))
 )
 
+// fetchMsg carries the raw outcome of a request; rendering happens in
+// renderResponse so it can take the current layout into account
 type fetchMsg struct {
-	response string
-	err      error
+	url        string // final URL of the request, after redirects
+	statusCode int
+	status     string
+	header     http.Header
+	body       []byte
+	wireSize   int64  // body bytes as received, before decompression
+	encoding   string // Content-Encoding that was removed from body
+	decodeErr  error  // decompression problem, body may be incomplete
+	charset    string // source charset body was transcoded from to UTF-8
+	charsetErr error
+	partial    bool  // body was cut short by a cancellation
+	total      int64 // Content-Length as announced by the server, -1 if unknown
+	timing     *requestTiming
+	err        error
+
+	// Headers as sent, cookies included, and the protocol used, for HAR
+	// recording
+	sent  http.Header
+	proto string
+
+	// events of an event stream, as they arrived, nil when parsed from
+	// the body afterwards
+	events []sseEvent
+
+	// Responses of a redirect chain, this one last, nil without
+	// redirects; why the last one wasn't followed, and the request that
+	// would follow it, see redirects.go
+	redirects    []redirectHop
+	redirectStop string
+	redirectNext *resolvedRequest
 }
 
+// mode selects which screen the application is showing
+type mode int
+
+const (
+	modeHTTP mode = iota
+	modeLab
+	modeGraphQL
+	modeGRPC
+	modeNetcat
+)
+
 // Model represents the application state
 type model struct {
+	mode      mode
 	textInput textinput.Model
 	viewport  viewport.Model
 	response  string
 	err       error
 	fetching  bool
-	width     int
-	height    int
+	cancel    context.CancelFunc
+
+	// Body streamed so far by the in-flight request, and the last progress
+	// reported, to render it again
+	streamBody     []byte
+	streamReceived int64
+	streamProgress fetchProgressMsg
+	streamEvents   sseReader
+
+	// In-flight download to disk, nil when not downloading
+	download *downloadState
+
+	// Request body upload in progress, nil otherwise
+	upload *uploadState
+
+	// The last successful response, for $response template extractions
+	// and re-rendering, its schema drift and what it breaks of the
+	// OpenAPI spec of its request
+	lastResponse   *fetchMsg
+	drift          []string
+	specViolations []string
+
+	// Custom views of the request the last response is for, and the tab
+	// shown, 0 being the response itself, and the display filter it's
+	// shown through
+	views   []string
+	viewTab int
+	filter  string
+
+	// What the display rules of the workspace do to the last response,
+	// see displayrules.go
+	display displayEffects
+
+	// Timing of the last request, shown instead of the response while
+	// showTiming is set
+	timing     *requestTiming
+	showTiming bool
+	// showCerts shows the certificate chain in place of the timing, see
+	// certificates.go
+	showCerts bool
+
+	// Fresh lookup of a host, shown instead of the response, see dns.go
+	dns dnsPanel
+
+	// Masking of displayed responses, toggled with Alt+M, see mask.go
+	mask maskState
+
+	// Alt+E presses since the last response, which GraphQL error it
+	// jumps to next
+	graphqlJump int
+
+	// Extractions of the saved request in flight, and its URL with
+	// secrets in the clear, to mask in errors
+	extract map[string]string
+	sentURL string
+
+	// Custom views of the request in flight, shown once it succeeds, and
+	// its expectations and watched values, checked once it completes
+	sentViews  []string
+	sentFilter string
+	sentExpect *expectations
+	sentWatch  []string
+	sentCost   *requestCost
+	sentSpec   *openAPIRef
+
+	// What the signed auth of the request in flight signed, and of the
+	// last request sent, shown with its timing
+	sentSigning *signingDebug
+	signing     *signingDebug
+
+	// The request a redirect of the last response leads to while asking
+	// whether to follow it, see redirects.go
+	redirectPrompt *resolvedRequest
+
+	// Daily usage of request quotas in the workspace, and the quota the
+	// user chose to go over today, see quota.go
+	usage         quotaUsage
+	quotaOverride string
+
+	// Last values of watched response paths by request, and the alert
+	// flashed in the status bar, see alert.go
+	watched  map[string]string
+	alert    string
+	alertSeq int
+
+	// Headers, body and settings sent along with the input line, see
+	// draft.go
+	draft *savedRequest
+
+	// Prompt for undefined template variables, nil when not shown
+	varPrompt *varPrompt
+
+	// Pane trying filter expressions on the last response, nil when not
+	// shown, see filterrepl.go
+	filterREPL *filterREPL
+
+	// Collections sidebar, the prompt naming a request to save, what to
+	// do when it is saved already and the revisions of a saved request
+	sidebar          sidebarModel
+	savePrompt       *textinput.Model
+	saveDuplicates   *saveDuplicates
+	requestRevisions *requestRevisions
+
+	// Workspace, environment and session pickers, nil when not shown
+	workspacePicker   *workspacePicker
+	environmentPicker *environmentPicker
+	sessionPicker     *sessionPicker
+
+	// HAR file browsed for replaying, see har.go, and the one recording
+	// this session, nil unless started with -record-har
+	har    harBrowser
+	harLog *harRecorder
+
+	// waterfall keeps the timing of the requests of the session, written
+	// out with Alt+W, see waterfall.go
+	waterfall []waterfallRow
+
+	// editorReply is where the response to a request sent from an editor
+	// goes, formatted to editorWidth, see editor.go
+	editorReply chan editorReply
+	editorWidth int
+
+	// notice is a one-off message for the status bar
+	notice string
+
+	// Requests sent this session, oldest first, and the one in flight
+	history       []historyEntry
+	pending       *historyEntry
+	showHistory   bool
+	historyFilter textinput.Model
+	historyIdx    int
+
+	// Follow-up actions suggested by the last response
+	suggestions     []suggestion
+	showSuggestions bool
+	suggestionIdx   int
+
+	// showSnippets shows the Ctrl+Y menu of languages to copy the request
+	// as, snippetIdx being the one chosen last
+	showSnippets bool
+	snippetIdx   int
+
+	// Output of the summarize command for the last response, nil when
+	// the pane isn't shown, see summarize.go
+	summary *summaryState
+
+	lab labModel
+
+	// Pane sizes of the workspace, see panes.go
+	panes paneLayout
+
+	// GraphQL editor, see graphql.go
+	graphql graphqlModel
+
+	// gRPC mode, see grpcmode.go
+	grpc grpcModel
+
+	// Raw TCP or TLS connection, see netcat.go
+	netcat netcatModel
+
+	width  int
+	height int
 }
 
 func initialModel() model {
@@ -73,7 +286,7 @@ func initialModel() model {
 	vp := viewport.New(0, 0)
 	vp.Style = lipgloss.NewStyle().
 		BorderStyle(lipgloss.RoundedBorder()).
-		BorderForeground(lipgloss.Color("#7D56F4")).
+		BorderForeground(lipgloss.Color(defaultResponseBorder)).
 		Padding(1, 2)
 
 	return model{
@@ -81,6 +294,12 @@ func initialModel() model {
 		viewport:  vp,
 		response:  "Response will appear here",
 		fetching:  false,
+		lab:       newLabModel(),
+		graphql:   newGraphQLModel(),
+		grpc:      newGRPCModel(),
+		watched:   map[string]string{},
+		usage:     newQuotaUsage(),
+		mask:      maskState{on: maskResponses},
 	}
 }
 
@@ -187,6 +406,8 @@ func detectContentType(body []byte, contentType string) string {
 	} else if strings.Contains(contentTypeLower, "text/xml") ||
 		strings.Contains(contentTypeLower, "application/xml") {
 		return "xml"
+	} else if strings.Contains(contentTypeLower, "yaml") {
+		return "yaml"
 	} else if strings.Contains(contentTypeLower, "text/plain") {
 		// For plain text, try to guess the format from content
 		return detectTextFormat(body)
@@ -222,6 +443,11 @@ func detectTextFormat(body []byte) string {
 		return "xml"
 	}
 
+	// Check for YAML
+	if looksLikeYAML(content) {
+		return "yaml"
+	}
+
 	// Check for CSS
 	if regexp.MustCompile(`[a-z0-9\-_\.#]+ {[^}]*}`).MatchString(content) {
 		return "css"
@@ -238,13 +464,72 @@ func detectTextFormat(body []byte) string {
 	return "text"
 }
 
+var (
+	yamlKeyPattern  = regexp.MustCompile(`^\s*("[^"]*"|'[^']*'|[A-Za-z0-9_.\-/]+)\s*:(\s|$)`)
+	yamlItemPattern = regexp.MustCompile(`^\s*- `)
+)
+
+// looksLikeYAML accepts documents with a YAML marker or whose significant
+// lines are (almost) all "key: value" mappings and "- item" sequences
+func looksLikeYAML(content string) bool {
+	trimmed := strings.TrimSpace(content)
+	if strings.HasPrefix(trimmed, "%YAML") || strings.HasPrefix(trimmed, "---\n") {
+		return true
+	}
+
+	lines, matches := 0, 0
+	for _, line := range strings.Split(trimmed, "\n") {
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+		lines++
+		if yamlKeyPattern.MatchString(line) || yamlItemPattern.MatchString(line) {
+			matches++
+		} else if strings.HasPrefix(line, " ") {
+			// Continuation of a multi-line scalar
+			matches++
+		}
+	}
+	return lines >= 2 && matches*10 >= lines*9 && yamlKeyPattern.MatchString(trimmed)
+}
+
+// formatYAML re-indents a YAML document consistently, keeping comments.
+// The original is returned when it doesn't parse.
+func formatYAML(body []byte) []byte {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(body, &doc); err != nil {
+		return body
+	}
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return body
+	}
+	enc.Close()
+	return buf.Bytes()
+}
+
 // prettyPrintContent applies syntax highlighting based on content type
 func prettyPrintContent(body []byte, detectedType string) string {
+	out, _ := prettyPrint(body, detectedType)
+	return out
+}
+
+// prettyPrint highlights body like prettyPrintContent, and says why when
+// it could only do part of it, "" when it did all
+func prettyPrint(body []byte, detectedType string) (string, string) {
 	// Get lexer based on detected type
 	var lexer chroma.Lexer
+	skipped := ""
 
 	switch detectedType {
 	case "json":
+		out, err := renderTypedJSON(body, jsonTypeAnnotations)
+		if err == nil {
+			return out, ""
+		}
+		skipped = "highlighted but not reindented, the body isn't valid JSON: " + err.Error()
 		lexer = lexers.Get("json")
 	case "html":
 		// For HTML, use gohtml first for proper indentation
@@ -257,6 +542,12 @@ func prettyPrintContent(body []byte, detectedType string) string {
 		lexer = lexers.Get("css")
 	case "javascript":
 		lexer = lexers.Get("javascript")
+	case "yaml":
+		// Reformatting is opt-in since it rewrites quoting and flow style
+		if os.Getenv("LAZYHTTP_YAML_REFORMAT") != "" {
+			body = formatYAML(body)
+		}
+		lexer = lexers.Get("yaml")
 	default:
 		// Try to detect by content
 		lexer = lexers.Analyse(string(body))
@@ -265,6 +556,7 @@ func prettyPrintContent(body []byte, detectedType string) string {
 	// Fallback if no lexer found
 	if lexer == nil {
 		lexer = lexers.Fallback
+		skipped = "none, no format recognized in the Content-Type or the body"
 	}
 
 	// Use a theme that works well in terminals
@@ -282,81 +574,500 @@ func prettyPrintContent(body []byte, detectedType string) string {
 	// Apply highlighting
 	iterator, err := lexer.Tokenise(nil, string(body))
 	if err != nil {
-		return string(body) // Fall back to raw content
+		return string(body), "none, highlighting failed: " + err.Error() // Fall back to raw content
 	}
 
 	var buf strings.Builder
 	if err := formatter.Format(&buf, style, iterator); err != nil {
-		return string(body)
+		return string(body), "none, highlighting failed: " + err.Error()
+	}
+
+	return buf.String(), skipped
+}
+
+// formatBytes renders a byte count in a short human readable form
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// newHTTPClient builds the client used by the TUI and headless runs,
+// keeping hosts within their rate limits
+func newHTTPClient(t requestTimeouts, version string, resolve connectOverrides, proxy string) *http.Client {
+	var rt http.RoundTripper = throttledTransport{roundTripperFor(t, version, resolve, proxy)}
+	if outboundPolicy != nil {
+		rt = policyTransport{outboundPolicy, rt}
 	}
+	return &http.Client{Jar: cookieJar, Transport: rt}
+}
+
+// progressInterval throttles how often streamed bytes are pushed to the UI
+const progressInterval = 100 * time.Millisecond
+
+// fetchProgressMsg reports body bytes as they arrive. The stream channel
+// delivers further progress and finally the fetchMsg.
+type fetchProgressMsg struct {
+	stream      <-chan tea.Msg
+	status      string
+	contentType string
+	chunk       []byte // newly decoded body bytes
+	received    int64  // bytes read from the wire so far
+	total       int64  // Content-Length, -1 if unknown
+}
 
-	return buf.String()
+// bodyContentType is the Content-Type sent with a body given as text,
+// unless the request sets one
+func bodyContentType(body string) string {
+	if json.Valid([]byte(body)) {
+		return "application/json"
+	}
+	return "text/plain; charset=utf-8"
 }
 
-func fetchURL(url string) tea.Cmd {
+// waitForFetch delivers the next message of a streaming fetch
+func waitForFetch(stream <-chan tea.Msg) tea.Cmd {
 	return func() tea.Msg {
-		// Create a request with custom User-Agent to avoid some blocks
-		req, err := http.NewRequest("GET", url, nil)
+		return <-stream
+	}
+}
+
+func fetchURL(ctx context.Context, r resolvedRequest) tea.Cmd {
+	stream := make(chan tea.Msg)
+	go streamFetch(ctx, r, stream)
+	return waitForFetch(stream)
+}
+
+// streamFetch performs the request and streams the body to the UI as it
+// comes in, ending with a fetchMsg holding the complete (or partial) body.
+// A body file is streamed from disk with upload progress.
+func streamFetch(ctx context.Context, r resolvedRequest, stream chan tea.Msg) {
+	cancelled := ctx
+	ctx, cancel := r.timeouts.withTotalTimeout(ctx)
+	defer cancel()
+	timing := newRequestTiming()
+	ctx = httptrace.WithClientTrace(ctx, timing.trace())
+	ctx = withThrottleNotice(ctx, func(host string, limit rateLimit, wait time.Duration) {
+		timing.addThrottled(wait)
+		stream <- throttleMsg{stream: stream, host: host, limit: limit, wait: wait}
+	})
+	var body io.Reader
+	var size int64
+	var contentType string
+	switch {
+	case r.bodyFile != "":
+		file, n, ct, err := openUploadBody(r.bodyFile)
 		if err != nil {
-			return fetchMsg{err: err}
+			stream <- fetchMsg{err: err}
+			return
 		}
+		defer file.Close()
+		body = &uploadReader{ctx: ctx, r: file, total: n, started: time.Now(), stream: stream}
+		size, contentType = n, ct
+	case r.body != "":
+		body = strings.NewReader(r.body)
+		size, contentType = int64(len(r.body)), bodyContentType(r.body)
+	}
 
-		// Add a common user agent
-		req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/91.0.4472.124 Safari/537.36")
+	target, resolve, err := unixSocketRequest(r.url, r.resolve)
+	if err != nil {
+		stream <- fetchMsg{err: err}
+		return
+	}
 
-		// Send the request
-		client := &http.Client{}
-		resp, err := client.Do(req)
-		if err != nil {
-			return fetchMsg{err: err}
+	// Create a request with custom User-Agent to avoid some blocks
+	req, err := http.NewRequestWithContext(ctx, r.method, target, body)
+	if err != nil {
+		stream <- fetchMsg{err: err}
+		return
+	}
+	if body != nil {
+		req.ContentLength = size
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	// Add a common user agent
+	req.Header.Set("User-Agent", defaultUserAgent)
+	req.Header.Set("Accept-Encoding", acceptEncoding)
+	version, err := parseHTTPVersion(r.httpVersion)
+	if err != nil {
+		stream <- fetchMsg{err: err}
+		return
+	}
+	timing.version = version
+	if r.redirects, err = parseRedirects(r.redirects); err != nil {
+		stream <- fetchMsg{err: err}
+		return
+	}
+	timing.resolve = resolve.target(requestAddr(req.URL))
+	proxy, err := proxyFunc(r.proxy)
+	if err != nil {
+		stream <- fetchMsg{err: err}
+		return
+	}
+	if proxy != nil && version != httpVersion2 && version != httpVersion3 && outboundPolicy == nil {
+		if p, _ := proxy(req); p != nil {
+			timing.proxy = p.Redacted()
 		}
-		defer resp.Body.Close()
+	}
+	client := newHTTPClient(r.timeouts, version, resolve, r.proxy)
+	hops := append([]redirectHop(nil), r.redirectedFrom...)
+	client.CheckRedirect = redirectChecker(r.redirects, &hops)
+	sess, err := requestSession(r.session, r.url)
+	if err != nil {
+		stream <- fetchMsg{err: err}
+		return
+	}
+	if sess != nil {
+		sess.apply(req, client)
+	}
+	for k, v := range r.headers {
+		req.Header.Set(k, v)
+	}
 
-		body, err := io.ReadAll(resp.Body)
+	// Send the request
+	resp, err := client.Do(req)
+	if err != nil {
+		timing.finish()
+		switch {
+		case cancelled.Err() != nil:
+			stream <- fetchMsg{err: errors.New("request cancelled before a response was received"), timing: timing}
+			return
+		case ctx.Err() != nil:
+			stream <- fetchMsg{err: fmt.Errorf("%w, no response yet", errTotalTimeout(r.timeouts.total())), timing: timing}
+			return
+		}
+		stream <- fetchMsg{err: describeHTTP2Error(describeTimeout(describeHandshakeError(describeCertificateError(describeResolverError(err))), r.timeouts)), timing: timing}
+		return
+	}
+	timing.gotResponse(resp)
+	resp.Body = withIdleTimeout(resp.Body, r.timeouts.idle())
+	defer resp.Body.Close()
+	if sess != nil {
+		sess.update(r)
+	}
+
+	msg := fetchMsg{
+		url:        resp.Request.URL.String(),
+		statusCode: resp.StatusCode,
+		status:     resp.Status,
+		header:     resp.Header,
+		total:      resp.ContentLength,
+		timing:     timing,
+		sent:       resp.Request.Header.Clone(),
+		proto:      resp.Proto,
+	}
+	if msg.redirectStop = redirectStopped(r.redirects, resp); len(hops) > 0 || msg.redirectStop != "" {
+		msg.redirects = append(hops, responseHop(resp))
+		// The URL sent is shown with its secrets masked
+		if len(r.redirectedFrom) == 0 {
+			msg.redirects[0].URL = r.display
+		}
+		if msg.redirectStop != "" {
+			msg.redirectNext = redirectRequest(r, resp, msg.redirects)
+		}
+	}
+	stream <- fetchProgressMsg{stream: stream, status: resp.Status, contentType: resp.Header.Get("Content-Type"), total: resp.ContentLength}
+
+	// Decompress while reading; the wire size is kept for display
+	wire := &countingReader{r: resp.Body}
+	var reader io.Reader = wire
+	if encoding := resp.Header.Get("Content-Encoding"); encoding != "" {
+		msg.encoding = encoding
+		if reader, err = newDecodingReader(wire, encoding); err != nil {
+			msg.decodeErr = err
+			reader = wire
+		}
+	}
+
+	// Read the body ourselves so that a cancelled request still keeps
+	// whatever arrived before the cancellation
+	var received bytes.Buffer
+	var pending []byte
+	lastSent := time.Now()
+	// Events are shown as soon as they arrive, not held back until the
+	// next read after a quiet spell
+	eachRead := isEventStream(resp.Header.Get("Content-Type"))
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := reader.Read(buf)
+		received.Write(buf[:n])
+		pending = append(pending, buf[:n]...)
+
+		if len(pending) > 0 && (err != nil || eachRead || time.Since(lastSent) >= progressInterval) {
+			stream <- fetchProgressMsg{stream: stream, status: resp.Status, contentType: resp.Header.Get("Content-Type"), chunk: pending, received: wire.n, total: resp.ContentLength}
+			pending = nil
+			lastSent = time.Now()
+		}
+
+		if err == io.EOF {
+			break
+		}
 		if err != nil {
-			return fetchMsg{err: err}
+			if cancelled.Err() != nil {
+				msg.partial = true
+			} else if ctx.Err() != nil {
+				timing.finish()
+				stream <- fetchMsg{err: fmt.Errorf("%w, %s of the body received", errTotalTimeout(r.timeouts.total()), formatBytes(wire.n)), timing: timing}
+				return
+			} else if wire.err != nil {
+				timing.finish()
+				stream <- fetchMsg{err: describeHTTP2Error(wire.err), timing: timing}
+				return
+			} else {
+				msg.decodeErr = err
+			}
+			break
 		}
+	}
 
-		// Get content type from header
-		contentType := resp.Header.Get("Content-Type")
+	msg.body = received.Bytes()
+	msg.wireSize = wire.n
 
-		// Create a header with response information
-		headerInfo := &strings.Builder{}
-		fmt.Fprintf(headerInfo, "%s %s\n",
-			headerStyle.Render("Status:"),
-			lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("#56B6C2")).Render(resp.Status))
+	// Legacy charsets are transcoded so they don't render as mojibake
+	msg.body, msg.charset, msg.charsetErr = transcodeToUTF8(msg.body, resp.Header.Get("Content-Type"))
+
+	timing.finish()
+	stream <- msg
+}
+
+// maxStreamPreview bounds how much of a body is shown while it streams in
+const maxStreamPreview = 1 << 20
+
+// renderStreaming shows the body received so far with a live byte counter,
+// unformatted but for event streams, whose events are listed or
+// reassembled as they arrive
+func renderStreaming(p fetchProgressMsg, body []byte, events []sseEvent, width int) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s %s\n", headerStyle.Render("Status:"),
+		lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("#56B6C2")).Render(p.status))
 
+	progress := formatBytes(p.received)
+	if p.total >= 0 {
+		progress += " of " + formatBytes(p.total)
+	}
+	fmt.Fprintf(&sb, "%s %s\n\n", headerStyle.Render("Receiving:"),
+		lipgloss.NewStyle().Foreground(lipgloss.Color("#FFCC00")).Render(progress))
+
+	switch {
+	case isEventStream(p.contentType):
+		sb.WriteString(renderEventStream(events, width, true))
+	case isBinary(body):
+		sb.WriteString(lipgloss.NewStyle().Foreground(lipgloss.Color("#888888")).
+			Render("Binary data, shown once the download completes"))
+	case len(body) > maxStreamPreview:
+		sb.Write(body[:maxStreamPreview])
+		sb.WriteString(lipgloss.NewStyle().Foreground(lipgloss.Color("#888888")).
+			Render("\n… preview truncated, the full body is shown once the download completes"))
+	default:
+		sb.Write(body)
+	}
+	return sb.String()
+}
+
+// renderResponse builds the viewport content for a response: a short
+// metadata header followed by the formatted body
+func renderResponse(r fetchMsg, width int, d displayEffects) string {
+	body := r.body
+
+	// Get content type from header
+	contentType := r.header.Get("Content-Type")
+
+	// Create a header with response information
+	headerInfo := &strings.Builder{}
+	statusColor := "#56B6C2"
+	if d.color != "" {
+		statusColor = d.color
+	}
+	proto := ""
+	if r.proto != "" {
+		proto = historyDimStyle.Render(" • " + r.proto)
+	}
+	if http3Offer(r.header) != "" {
+		proto += historyDimStyle.Render(" • HTTP/3 offered")
+	}
+	fmt.Fprintf(headerInfo, "%s %s%s\n",
+		headerStyle.Render("Status:"),
+		lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color(statusColor)).Render(r.status), proto)
+
+	// Display rules can have every header shown, not just the usual ones
+	if d.open == "headers" {
+		for _, name := range sortedKeys(r.header) {
+			for _, v := range r.header[name] {
+				fmt.Fprintf(headerInfo, "%s %s\n", headerStyle.Render(name+":"), v)
+			}
+		}
+	} else {
 		fmt.Fprintf(headerInfo, "%s %s\n",
 			headerStyle.Render("Content-Type:"),
 			lipgloss.NewStyle().Italic(true).Render(contentType))
 
-		if len(resp.Header.Get("Server")) > 0 {
+		if len(r.header.Get("Server")) > 0 {
 			fmt.Fprintf(headerInfo, "%s %s\n",
 				headerStyle.Render("Server:"),
-				resp.Header.Get("Server"))
+				r.header.Get("Server"))
+		}
+	}
+
+	if r.encoding != "" {
+		encoding := fmt.Sprintf("%s (%s → %s)", r.encoding, formatBytes(r.wireSize), formatBytes(int64(len(body))))
+		if r.decodeErr != nil {
+			encoding += " " + errorStyle.Render(r.decodeErr.Error())
 		}
+		fmt.Fprintf(headerInfo, "%s %s\n", headerStyle.Render("Encoding:"), encoding)
+	}
 
-		// Detect the actual content type from the body
-		detectedType := detectContentType(body, contentType)
+	if r.charset != "" {
+		fmt.Fprintf(headerInfo, "%s %s → utf-8\n", headerStyle.Render("Charset:"), r.charset)
+	} else if r.charsetErr != nil {
+		fmt.Fprintf(headerInfo, "%s %s\n", headerStyle.Render("Charset:"),
+			errorStyle.Render(fmt.Sprintf("not converted (%v)", r.charsetErr)))
+	}
 
-		// Add the detected type if it differs from content-type header
-		if !strings.Contains(strings.ToLower(contentType), detectedType) {
-			fmt.Fprintf(headerInfo, "%s %s\n",
-				headerStyle.Render("Detected Format:"),
-				lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("#FFCC00")).
-					Render(strings.ToUpper(detectedType)))
+	if r.partial {
+		total := "unknown"
+		if r.total >= 0 {
+			total = formatBytes(r.total)
 		}
+		fmt.Fprintf(headerInfo, "%s %s\n",
+			headerStyle.Render("Partial:"),
+			lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("#FFCC00")).
+				Render(fmt.Sprintf("cancelled after %s of %s", formatBytes(r.wireSize), total)))
+	}
 
+	if r.timing != nil && r.timing.unverified {
+		fmt.Fprintf(headerInfo, "%s %s\n", insecureBadgeStyle.Render("⚠ TLS NOT VERIFIED"),
+			errorStyle.Render("the server's certificate wasn't checked, this may not be the server you think • Alt+I: Verify"))
+	}
+
+	// Bodies contradicting their Content-Type get a warning, and are shown
+	// as what they look like
+	mismatch := sniffMismatch(r)
+	if mismatch != nil {
+		headerInfo.WriteString(mismatch.render())
+	}
+	// So are credentials it shouldn't hold, see secretscan.go
+	secrets := scanSecrets(body)
+	headerInfo.WriteString(renderSecretFindings(secrets))
+
+	if d.collapse {
+		headerInfo.WriteString("\n")
+		return headerInfo.String() + historyDimStyle.Render(fmt.Sprintf("Body of %s collapsed by a display rule • Ctrl+_: Expand", formatBytes(int64(len(body)))))
+	}
+
+	// Images are previewed inline (or described) instead of highlighted
+	if strings.HasPrefix(strings.ToLower(contentType), "image/") && (mismatch == nil || mismatch.sniffed == "image") {
 		headerInfo.WriteString("\n")
+		return headerInfo.String() + renderImage(body, width)
+	}
 
-		// Apply syntax highlighting based on detected type
-		formattedContent := prettyPrintContent(body, detectedType)
+	// MessagePack and CBOR are decoded to JSON before highlighting
+	if format := binaryFormat(contentType); format != "" {
+		decoded, err := decodeBinaryToJSON(body, format)
+		if err == nil {
+			fmt.Fprintf(headerInfo, "%s %s\n\n",
+				headerStyle.Render("Decoded:"),
+				lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("#FFCC00")).Render(strings.ToUpper(format)))
+			return headerInfo.String() + prettyPrintContent(decoded, "json")
+		}
+		fmt.Fprintf(headerInfo, "%s %s\n",
+			headerStyle.Render("Decoded:"),
+			errorStyle.Render(fmt.Sprintf("decoding failed: %v", err)))
+	}
+
+	// Protobuf is decoded to JSON with the loaded descriptors
+	if isProtobuf(contentType) {
+		decoded, name, err := decodeProtobuf(body, contentType)
+		if err == nil {
+			fmt.Fprintf(headerInfo, "%s %s\n\n",
+				headerStyle.Render("Decoded:"),
+				lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("#FFCC00")).Render("protobuf "+name))
+			return headerInfo.String() + prettyPrintContent(decoded, "json")
+		}
+		fmt.Fprintf(headerInfo, "%s %s\n",
+			headerStyle.Render("Decoded:"),
+			errorStyle.Render(fmt.Sprintf("protobuf decoding failed: %v", err)))
+	}
 
-		// Combine header and formatted content
-		formattedResponse := headerInfo.String() + formattedContent
+	// Binary bodies are shown as a hex dump rather than garbage
+	if isBinary(body) && d.format == "" {
+		fmt.Fprintf(headerInfo, "%s %s\n",
+			headerStyle.Render("Detected Format:"),
+			lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("#FFCC00")).Render("BINARY"))
+		fmt.Fprintf(headerInfo, "%s\n\n", renderFormatting("hex dump, the body is binary", "Show as text"))
+		return headerInfo.String() + hexDump(body)
+	}
 
-		return fetchMsg{response: formattedResponse}
+	// Event streams, chat completions in particular, are reassembled
+	if isEventStream(contentType) {
+		headerInfo.WriteString("\n")
+		events := r.events
+		if events == nil {
+			events = parseSSE(body)
+		}
+		return headerInfo.String() + renderEventStream(events, width, false)
 	}
+
+	// Detect the actual content type from the body
+	detectedType := detectContentType(body, contentType)
+	if mismatch != nil && mismatch.shownAs() != "" {
+		detectedType = mismatch.shownAs()
+	}
+
+	// Add the detected type if it differs from content-type header
+	if mismatch == nil && d.format == "" && !strings.Contains(strings.ToLower(contentType), detectedType) {
+		fmt.Fprintf(headerInfo, "%s %s\n",
+			headerStyle.Render("Detected Format:"),
+			lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("#FFCC00")).
+				Render(strings.ToUpper(detectedType)))
+	}
+
+	// Huge bodies would take seconds to highlight, on every redraw
+	if d.format == "" && len(body) > maxPrettyPrintBytes {
+		fmt.Fprintf(headerInfo, "%s\n\n", renderFormatting(
+			fmt.Sprintf("none, %s is over the %s pretty-printing limit", formatBytes(int64(len(body))), formatBytes(maxPrettyPrintBytes)),
+			"Format anyway"))
+		return headerInfo.String() + string(body)
+	}
+
+	var formattedContent, skipped string
+	switch {
+	case d.format == "text":
+		formattedContent = string(body)
+		if isBinary(body) {
+			formattedContent = visualizeRaw(body)
+		}
+	case d.format != "":
+		formattedContent, skipped = prettyPrint(body, d.format)
+	default:
+		// Apply syntax highlighting based on detected type
+		formattedContent, skipped = prettyPrint(body, detectedType)
+	}
+	switch {
+	case d.format != "":
+		next := nextFormat(d.format, autoFormat(r))
+		if next == "" {
+			next = "automatic"
+		}
+		forced := "forced to " + strings.ToUpper(d.format)
+		if skipped != "" {
+			forced += ", " + skipped
+		}
+		fmt.Fprintf(headerInfo, "%s\n", renderFormatting(forced, "Show as "+strings.ToUpper(next)))
+	case skipped != "":
+		fmt.Fprintf(headerInfo, "%s\n", renderFormatting(skipped, "Pick a format"))
+	}
+	headerInfo.WriteString("\n")
+
+	// Combine header and formatted content
+	return headerInfo.String() + highlightSecrets(formattedContent, secrets)
 }
 
 func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
@@ -367,45 +1078,511 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
+		if m, resized := m.resizePanes(msg); resized {
+			return m, nil
+		}
+		if m.showSuggestions {
+			return m.updateSuggestions(msg)
+		}
+		if m.showSnippets {
+			return m.updateSnippets(msg)
+		}
+		if m.showHistory {
+			return m.updateHistory(msg)
+		}
+		if m.varPrompt != nil {
+			return m.updateVarPrompt(msg)
+		}
+		if m.savePrompt != nil {
+			return m.updateSavePrompt(msg)
+		}
+		if m.saveDuplicates != nil {
+			return m.updateSaveDuplicates(msg)
+		}
+		if m.requestRevisions != nil {
+			return m.updateRequestRevisions(msg)
+		}
+		if m.redirectPrompt != nil {
+			return m.updateRedirectPrompt(msg)
+		}
+		if m.filterREPL != nil {
+			return m.updateFilterREPL(msg)
+		}
+		if m.workspacePicker != nil {
+			return m.updateWorkspacePicker(msg)
+		}
+		if m.environmentPicker != nil {
+			return m.updateEnvironmentPicker(msg)
+		}
+		if m.sessionPicker != nil {
+			return m.updateSessionPicker(msg)
+		}
+		if m.har.open {
+			return m.updateHAR(msg)
+		}
+		if m.sidebar.focused {
+			return m.updateSidebar(msg)
+		}
+		if m.mode == modeLab {
+			return m.updateLab(msg)
+		}
+		if m.mode == modeGraphQL {
+			return m.updateGraphQL(msg)
+		}
+		if m.mode == modeGRPC {
+			return m.updateGRPC(msg)
+		}
+		if m.mode == modeNetcat {
+			return m.updateNetcat(msg)
+		}
+		switch msg.String() {
+		case "alt+w":
+			return m.exportWaterfall(), nil
+		case "alt+r":
+			return m.toggleDNS()
+		case "alt+p":
+			return m.cycleFormat(), nil
+		case "alt+m":
+			return m.toggleMask(), nil
+		case "alt+i":
+			return m.toggleInsecure(), nil
+		case "alt+c":
+			return m.toggleCertificates(), nil
+		case "alt+e":
+			return m.jumpToGraphQLError(), nil
+		}
+
 		switch msg.Type {
 		case tea.KeyCtrlC, tea.KeyEsc:
+			if m.cancel != nil {
+				m.cancel()
+			}
+			if m.summary != nil && m.summary.cancel != nil {
+				m.summary.cancel()
+			}
 			return m, tea.Quit
-		case tea.KeyEnter:
+		case tea.KeyCtrlX:
+			// Abort the in-flight request; whatever has been received so
+			// far is still rendered, marked as partial
+			if m.fetching && m.cancel != nil {
+				m.cancel()
+				m.response = "Cancelling..."
+				m.viewport.SetContent(m.response)
+			}
+			return m, nil
+		case tea.KeyCtrlD:
 			if !m.fetching && m.textInput.Value() != "" {
-				url := m.textInput.Value()
-				if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
-					url = "https://" + url
+				return m.startDownload(m.textInput.Value())
+			}
+			return m, nil
+		case tea.KeyCtrlL:
+			if !m.fetching {
+				return m.enterLab(), nil
+			}
+			return m, nil
+		case tea.KeyCtrlBackslash:
+			if !m.fetching {
+				return m.enterGraphQL()
+			}
+			return m, nil
+		case tea.KeyCtrlCloseBracket:
+			if !m.fetching {
+				return m.openFilterREPL(), nil
+			}
+			return m, nil
+		case tea.KeyCtrlCaret:
+			if !m.fetching {
+				return m.enterGRPC()
+			}
+			return m, nil
+		case tea.KeyCtrlUnderscore:
+			// Bodies collapsed by a display rule can be looked at anyway
+			if m.display.collapsible && m.lastResponse != nil && !m.fetching && !m.showTiming && !m.dns.open {
+				m.display.collapse = !m.display.collapse
+				m.response = m.renderLastResponse()
+				m.viewport.SetContent(m.response)
+			}
+			return m, nil
+		case tea.KeyCtrlP:
+			if !m.fetching && m.textInput.Value() != "" {
+				var ok bool
+				if m, ok = m.expandHTTPie(); !ok {
+					return m, nil
 				}
-				m.fetching = true
-				m.response = "Fetching..."
 				m.err = nil
-				return m, fetchURL(url)
+				m.response = renderPreview(m.resolveInput(m.textInput.Value()))
+				m.viewport.SetContent(m.response)
+				m.viewport.GotoTop()
+			}
+			return m, nil
+		case tea.KeyCtrlY:
+			if !m.fetching && m.textInput.Value() != "" && !isCurlCommand(m.textInput.Value()) {
+				var ok bool
+				if m, ok = m.expandHTTPie(); !ok {
+					return m, nil
+				}
+				return m.openSnippets(), nil
+			}
+			return m, nil
+		case tea.KeyCtrlJ:
+			return m.toggleSummary()
+		case tea.KeyShiftUp:
+			return m.scrollSummary(-1), nil
+		case tea.KeyShiftDown:
+			return m.scrollSummary(1), nil
+		case tea.KeyCtrlB:
+			return m.toggleSidebar(), nil
+		case tea.KeyCtrlW:
+			if !m.fetching {
+				return m.openWorkspacePicker(), nil
+			}
+			return m, nil
+		case tea.KeyCtrlE:
+			if !m.fetching {
+				return m.openEnvironmentPicker(), nil
+			}
+			return m, nil
+		case tea.KeyCtrlO:
+			if !m.fetching {
+				return m.openSessionPicker(), nil
+			}
+			return m, nil
+		case tea.KeyCtrlN:
+			if !m.fetching {
+				return m.openHAR(), nil
+			}
+			return m, nil
+		case tea.KeyCtrlK:
+			if !m.fetching {
+				// From the certificate chain Ctrl+K goes to the timing
+				if !m.showTiming || !m.showCerts {
+					m.showTiming = !m.showTiming
+				}
+				m.showCerts = false
+				m.dns.open = false
+				switch {
+				case m.showTiming:
+					m.response = m.renderTimingView()
+				case m.lastResponse != nil && m.err == nil:
+					m.response = m.renderLastResponse()
+				default:
+					m.response = ""
+				}
+				m.viewport.SetContent(m.response)
+				m.viewport.GotoTop()
+			}
+			return m, nil
+		case tea.KeyCtrlT, tea.KeyCtrlF:
+			if msg.Type == tea.KeyCtrlT {
+				jsonTypeAnnotations = !jsonTypeAnnotations
+			} else {
+				nextStatsField()
+			}
+			if m.lastResponse != nil && !m.fetching && !m.showTiming && !m.dns.open {
+				m.response = m.renderLastResponse()
+				m.viewport.SetContent(m.response)
+			}
+			return m, nil
+		case tea.KeyCtrlQ:
+			// Switch event streams between reassembled text and raw frames
+			rawEventFrames = !rawEventFrames
+			switch {
+			case m.fetching && isEventStream(m.streamProgress.contentType):
+				m.response = renderStreaming(m.streamProgress, m.streamBody, m.streamEvents.events, m.viewport.Width-m.viewport.Style.GetHorizontalFrameSize())
+			case m.lastResponse != nil && !m.fetching && !m.showTiming && !m.dns.open:
+				m.response = m.renderLastResponse()
+			default:
+				return m, nil
+			}
+			m.viewport.SetContent(m.response)
+			return m, nil
+		case tea.KeyShiftTab:
+			// Cycle through the custom views of the response
+			if len(m.views) > 0 && m.lastResponse != nil && m.err == nil && !m.fetching && !m.showTiming && !m.dns.open {
+				m.viewTab = (m.viewTab + 1) % (len(m.views) + 1)
+				m.response = m.renderLastResponse()
+				m.viewport.SetContent(m.response)
+				m.viewport.GotoTop()
+			}
+			return m, nil
+		case tea.KeyTab:
+			if m.sidebar.open {
+				m.sidebar.focused = true
+				m.textInput.Blur()
+			}
+			return m, nil
+		case tea.KeyCtrlS:
+			if m.textInput.Value() != "" {
+				var ok bool
+				if m, ok = m.expandHTTPie(); !ok {
+					return m, nil
+				}
+				return m.openSavePrompt(), nil
+			}
+			return m, nil
+		case tea.KeyCtrlR:
+			if !m.fetching {
+				return m.openHistory(), nil
+			}
+			return m, nil
+		case tea.KeyCtrlG:
+			if len(m.suggestions) > 0 && !m.fetching {
+				m.showSuggestions = true
+				m.suggestionIdx = 0
+			}
+			return m, nil
+		case tea.KeyEnter:
+			if !m.fetching && m.textInput.Value() != "" {
+				if isCurlCommand(m.textInput.Value()) {
+					return m.importCurl(m.textInput.Value()), nil
+				}
+				if isGRPCLine(m.textInput.Value()) {
+					return m.enterGRPC()
+				}
+				if isNetcatLine(m.textInput.Value()) {
+					return m.enterNetcat(m.textInput.Value())
+				}
+				if isAssistantPrompt(m.textInput.Value()) {
+					return m.askAssistant(m.textInput.Value())
+				}
+				var ok bool
+				if m, ok = m.expandHTTPie(); !ok {
+					return m, nil
+				}
+				return m.startFetch(m.textInput.Value())
 			}
 		}
 
 	case tea.WindowSizeMsg:
 		m.width = msg.Width
 		m.height = msg.Height
-		m.viewport.Width = m.width - padding*2
-		m.viewport.Height = m.height - inputHeight - padding*3
-		m.textInput.Width = m.width - padding*2 - len(m.textInput.Prompt)
+		m = m.layout()
+		m.viewport.SetContent(m.response)
+
+	case graphqlSchemaMsg:
+		return m.setSchema(msg), nil
+	case subscriptionOpenMsg:
+		return m.openSubscription(msg)
+	case subscriptionResultMsg:
+		return m.addSubscriptionResult(msg)
+	case subscriptionEndMsg:
+		return m.endSubscription(msg), nil
+	case grpcServicesMsg:
+		return m.setGRPCServices(msg), nil
+	case grpcMessageMsg:
+		return m.addGRPCMessage(msg)
+	case grpcEndMsg:
+		return m.endGRPCCall(msg), nil
+	case netcatConnectedMsg:
+		return m.netcatConnected(msg)
+	case netcatDataMsg:
+		return m.netcatData(msg)
+	case rawResponseMsg:
+		m.lab.sending = false
+		if m.cancel != nil {
+			m.cancel()
+			m.cancel = nil
+		}
+		m.lab.last = &msg
+		m.response = renderRawResponse(msg, m.lab.hexView)
+		m.viewport.SetContent(m.response)
+		m.viewport.GotoTop()
+		return m, nil
+
+	case throttleMsg:
+		m.response = renderThrottled(msg)
+		m.viewport.SetContent(m.response)
+		return m, waitForFetch(msg.stream)
+
+	case uploadProgressMsg:
+		m.upload = &uploadState{sent: msg.sent, total: msg.total, started: msg.started}
+		return m, waitForFetch(msg.stream)
+
+	case fetchProgressMsg:
+		m.upload = nil
+		m.streamBody = append(m.streamBody, msg.chunk...)
+		if isEventStream(msg.contentType) {
+			m.streamEvents.feed(m.streamBody)
+		}
+		m.streamReceived = msg.received
+		m.streamProgress = msg
+		m.response = renderStreaming(msg, m.streamBody, m.streamEvents.events, m.viewport.Width-m.viewport.Style.GetHorizontalFrameSize())
+
+		// Follow the tail unless the user scrolled up
+		atBottom := m.viewport.AtBottom()
 		m.viewport.SetContent(m.response)
+		if atBottom {
+			m.viewport.GotoBottom()
+		}
+		return m, waitForFetch(msg.stream)
+
+	case downloadProgressMsg:
+		if m.download != nil {
+			m.download.path = msg.path
+			m.download.received = msg.received
+			m.download.total = msg.total
+			m.streamReceived = msg.received
+		}
+		return m, waitForFetch(msg.stream)
+
+	case downloadDoneMsg:
+		m.fetching = false
+		m.download = nil
+		m.streamReceived = 0
+		if m.cancel != nil {
+			m.cancel()
+			m.cancel = nil
+		}
+		m.response = renderDownloadDone(msg)
+		m.viewport.SetContent(m.response)
+		return m, nil
 
 	case fetchMsg:
+		sent := m.pending
+		if m.pending != nil {
+			msg.err = maskSecrets(msg.err, m.sentURL, m.pending.URL)
+		}
+		var drift []string
+		if m.pending != nil && msg.err == nil && !msg.partial {
+			drift, _ = trackSchema(urlSchemaKey(m.pending.Method, m.pending.URL), msg.body)
+		}
+		var violations []string
+		if m.sentSpec != nil && msg.err == nil && !msg.partial {
+			violations = checkOpenAPIResponse(m.sentSpec, &msg)
+		}
+		harErr := m.harLog.record(msg)
+		var alertCmd tea.Cmd
+		m, alertCmd = m.checkResponseAlerts(msg)
+		usageErr := m.tallyCost(msg)
+		if m.pending != nil {
+			m = m.recordWaterfall(m.pending.Method+" "+m.pending.URL, msg)
+		}
+		m = m.recordHistory(msg)
+		m.timing = msg.timing
+		m.signing = nil
+		if m.sentSigning != nil {
+			signing := *m.sentSigning
+			if msg.err == nil {
+				signing.expected = expectedSigning(&msg)
+			}
+			m.signing = &signing
+		}
 		m.fetching = false
+		m.upload = nil
+		if msg.err == nil && isEventStream(msg.header.Get("Content-Type")) {
+			m.streamEvents.feed(msg.body)
+			msg.events = m.streamEvents.events
+		}
+		m.streamBody = nil
+		m.streamEvents = sseReader{}
+		m.streamProgress = fetchProgressMsg{}
+		m.streamReceived = 0
+		if m.cancel != nil {
+			m.cancel()
+			m.cancel = nil
+		}
+		var rulesErr, maskErr error
 		if msg.err != nil {
 			m.err = msg.err
 			m.response = ""
+			m.suggestions = nil
+			m.display = displayEffects{}
+			m = m.applyDisplayEffects()
 		} else {
 			m.err = nil
-			m.response = msg.response
+			m.lastResponse = &msg
+			m.drift = drift
+			m.specViolations = violations
+			m.views, m.viewTab, m.filter = m.sentViews, 0, m.sentFilter
+			m.graphqlJump = 0
+			var rules []displayRule
+			rules, rulesErr = loadDisplayRules()
+			m.display = applyDisplayRules(rules, msg, msg.url)
+			m = m.applyDisplayEffects()
+			if m.mask.on {
+				if rules, err := loadMaskRules(); err != nil {
+					maskErr = err
+				} else {
+					m.mask.rules = rules
+				}
+			}
+			m.response = m.renderLastResponse()
+			m.suggestions = suggestFollowUps(msg)
+			if len(m.extract) > 0 && !msg.partial {
+				m.notice = extractVariables(m.extract, &msg)
+			}
+		}
+		m.extract = nil
+		if m.signing != nil && msg.err == nil && (msg.statusCode == 401 || msg.statusCode == 403) {
+			m.notice = "Signature rejected? Ctrl+K shows what was signed"
+		}
+		if rulesErr != nil {
+			m.notice = errorStyle.Render("Display rules: " + rulesErr.Error())
+		}
+		if maskErr != nil {
+			m.notice = errorStyle.Render("Masking rules: " + maskErr.Error())
+		}
+		if harErr != nil {
+			m.notice = errorStyle.Render("HAR recording failed: " + harErr.Error())
+		}
+		if usageErr != nil {
+			m.notice = errorStyle.Render("Recording quota usage failed: " + usageErr.Error())
+		}
+		m = m.promptRedirect(msg)
+		m = m.replyToEditor(msg, sent)
+		if m.showTiming {
+			m.response = m.renderTimingView()
+		}
+		m.viewport.SetContent(m.response)
+		return m, alertCmd
+
+	case editorSendMsg:
+		return m.sendFromEditor(msg)
+
+	case dnsLookupMsg:
+		return m.dnsLooked(msg), nil
+
+	case alertClearMsg:
+		if msg.seq == m.alertSeq {
+			m.alert = ""
 		}
+		return m, nil
+
+	case summaryChunkMsg:
+		return m.addSummaryChunk(msg)
+
+	case summaryDoneMsg:
+		return m.endSummary(msg), nil
+
+	case assistantMsg:
+		m = m.showAssistantDraft(msg)
 		m.viewport.SetContent(m.response)
 		return m, nil
+
+	case alertWebhookMsg:
+		m.notice = errorStyle.Render("Alert webhook failed: " + msg.err.Error())
+		return m, nil
+
+	case compareMsg:
+		m.fetching = false
+		if m.cancel != nil {
+			m.cancel()
+			m.cancel = nil
+		}
+		for i, r := range msg.results {
+			m = m.recordWaterfall(fmt.Sprintf("%s %s as %s", msg.method, msg.url, sessionLabel(msg.sessions[i])), r)
+		}
+		m.response = renderCompare(msg)
+		m.viewport.SetContent(m.response)
+		m.viewport.GotoTop()
+		return m, nil
 	}
 
 	m.textInput, cmd = m.textInput.Update(msg)
 	cmds = append(cmds, cmd)
+	if m.textInput.Value() == "" {
+		m.draft = nil
+	}
 
 	m.viewport, cmd = m.viewport.Update(msg)
 	cmds = append(cmds, cmd)
@@ -413,28 +1590,240 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	return m, tea.Batch(cmds...)
 }
 
+// renderLastResponse renders the last response for the viewport
+func (m model) renderLastResponse() string {
+	resp, filtered := m.displayedResponse()
+	masked, _ := m.maskedResponse()
+	graphqlErrors := renderGraphQLErrors(masked.body)
+	if len(m.views) == 0 {
+		return renderRedirects(resp) + renderDisplayLabels(m.display) + renderSpecViolations(m.specViolations) + renderDrift(m.drift) + graphqlErrors + filtered + renderResponse(resp, m.viewport.Width-m.viewport.Style.GetHorizontalFrameSize(), m.display)
+	}
+	tabs := renderViewTabs(m.views, m.viewTab)
+	if m.viewTab > 0 {
+		resp, masked := m.maskedResponse()
+		return tabs + masked + renderCustomView(m.views[m.viewTab-1], resp)
+	}
+	return tabs + renderRedirects(resp) + renderDisplayLabels(m.display) + renderSpecViolations(m.specViolations) + renderDrift(m.drift) + graphqlErrors + filtered + renderResponse(resp, m.viewport.Width-m.viewport.Style.GetHorizontalFrameSize(), m.display)
+}
+
+// renderTimingView renders the timing of the last request, and what it
+// signed for signed auth schemes
+func (m model) renderTimingView() string {
+	if m.showCerts {
+		return renderCertificates(m.timing)
+	}
+	if m.signing == nil {
+		return renderTiming(m.timing)
+	}
+	return renderTiming(m.timing) + "\n" + renderSigning(m.signing)
+}
+
+// layout sizes the components for the current window and mode
+func (m model) layout() model {
+	m.viewport.Width = m.width - padding*2
+	if m.sidebar.open && m.mode == modeHTTP {
+		m.viewport.Width -= m.panes.sidebarWidth() + 1
+	}
+	if m.summary != nil && m.mode == modeHTTP {
+		m.viewport.Width -= m.summaryWidth() + 1
+	}
+	// One row is reserved for the status bar
+	m.viewport.Height = m.height - inputHeight - padding*3 - 1
+	m.textInput.Width = m.width - padding*2 - len(m.textInput.Prompt)
+
+	if m.mode == modeLab {
+		m.lab.target.Width = m.width - padding*2 - len(m.lab.target.Prompt)
+		m.lab.editor.SetWidth(m.width - padding*4)
+		m.lab.editor.SetHeight(m.panes.editorHeight(labEditorHeight))
+		// Status line plus the editor and its spacing
+		m.viewport.Height -= m.lab.editor.Height() + 3
+	}
+	if m.mode == modeNetcat {
+		m.netcat.input.Width = m.width - padding*4 - len(m.netcat.input.Prompt)
+		// The status line and its spacing
+		m.viewport.Height -= 2
+	}
+	if m.filterREPL != nil {
+		m.filterREPL.input.Width = m.viewport.Width - len(m.filterREPL.input.Prompt) - 2
+		// The expression, its status line and a blank line
+		m.viewport.Height -= 3
+	}
+	if m.mode == modeGraphQL {
+		m.graphql.query.SetWidth(m.width - padding*4)
+		m.graphql.variables.SetWidth(m.width - padding*4)
+		// Status line, editors with their spacing and the panel under them
+		m.graphql.query.SetHeight(m.panes.editorHeight(graphqlQueryHeight))
+		m.viewport.Height -= m.graphql.query.Height() + graphqlVariablesHeight + graphqlPanelHeight + 5
+	}
+	if m.mode == modeGRPC {
+		m.grpc.request.SetWidth(m.width - padding*4)
+		m.grpc.metadata.SetWidth(m.width - padding*4)
+		// Status line, the method list, the editors and their labels and
+		// spacing
+		m.grpc.request.SetHeight(m.panes.editorHeight(grpcRequestHeight))
+		m.viewport.Height -= m.grpc.request.Height() + grpcMetadataHeight + grpcMethodsHeight + 6
+	}
+	if m.viewport.Height < 3 {
+		m.viewport.Height = 3
+	}
+	return m
+}
+
+// startFetch kicks off the request described by the input line (see
+// parseRequestLine) and the draft after expanding their templates
+func (m model) startFetch(line string) (model, tea.Cmd) {
+	r := m.resolveInput(line)
+	retry := func(m model) (model, tea.Cmd) { return m.startFetch(line) }
+	return m.send(r, line, retry)
+}
+
+// send starts a resolved request; line is what history records for it.
+// Requests with unresolved placeholders are held back and retried once
+// their variables are supplied.
+func (m model) send(r resolvedRequest, line string, retry func(model) (model, tea.Cmd)) (model, tea.Cmd) {
+	// Never send literal {{braces}} to the server
+	var blocked bool
+	if m, blocked = m.checkUnresolved(r.missing, retry); blocked {
+		m.viewport.SetContent(m.response)
+		return m, nil
+	}
+	if m, blocked = m.checkQuota(r); blocked {
+		m.viewport.SetContent(m.response)
+		return m, nil
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	m.fetching = true
+	m.cancel = cancel
+	m.dns.open = false
+	m.response = "Fetching..."
+	m.err = nil
+	m.notice = ""
+	m.redirectPrompt = nil
+	m.suggestions = nil
+	// History keeps the masked URL so secrets don't end up in it
+	m.pending = &historyEntry{Method: r.method, URL: r.display, Line: line, Time: time.Now()}
+	m.extract = r.extract
+	m.sentURL = r.url
+	m.harLog.begin(r)
+	m.sentViews, m.sentFilter = r.views, r.filter
+	m.sentExpect, m.sentWatch, m.sentCost, m.sentSpec = r.expect, r.watch, r.cost, r.openAPI
+	m.sentSigning = r.signing
+	return m, fetchURL(ctx, r)
+}
+
 func (m model) View() string {
 	if m.width == 0 {
 		return "Loading..."
 	}
 
+	if m.mode == modeLab {
+		container := lipgloss.NewStyle().
+			BorderStyle(lipgloss.RoundedBorder()).
+			BorderForeground(lipgloss.Color("#336699")).
+			Padding(1, 2).
+			Render(fmt.Sprintf("%s\n\n%s", titleStyle.Render("Request Lab"), m.labView()))
+		helpText := lipgloss.NewStyle().
+			Foreground(lipgloss.Color("#888888")).
+			Render("\nTab: Switch field • Ctrl+S: Send • Ctrl+N: Interactive session • Ctrl+T: TCP/TLS • Ctrl+E: Line endings • Ctrl+P: Preset • Ctrl+O: Text/Hex • Ctrl+X: Cancel • Esc: Back")
+		return container + "\n" + m.statusBar() + helpText
+	}
+	if m.mode == modeGraphQL {
+		container := lipgloss.NewStyle().
+			BorderStyle(lipgloss.RoundedBorder()).
+			BorderForeground(lipgloss.Color("#336699")).
+			Padding(1, 2).
+			Render(fmt.Sprintf("%s\n\n%s", titleStyle.Render("GraphQL"), m.graphqlView()))
+		helpText := lipgloss.NewStyle().
+			Foreground(lipgloss.Color("#888888")).
+			Render("\nTab: Complete/Switch field • Shift+Tab: Switch field • Ctrl+N/Ctrl+P: Choose completion • Ctrl+S: Send • Ctrl+R: Refresh schema • Alt+E: Next error in the data • Ctrl+X: Cancel • PgUp/PgDn: Scroll • Esc: Back")
+		return container + "\n" + m.statusBar() + helpText
+	}
+	if m.mode == modeGRPC {
+		container := lipgloss.NewStyle().
+			BorderStyle(lipgloss.RoundedBorder()).
+			BorderForeground(lipgloss.Color("#336699")).
+			Padding(1, 2).
+			Render(fmt.Sprintf("%s\n\n%s", titleStyle.Render("gRPC"), m.grpcView()))
+		helpText := lipgloss.NewStyle().
+			Foreground(lipgloss.Color("#888888")).
+			Render("\nTab/Shift+Tab: Switch field • ↑/↓: Choose method • Ctrl+S: Send • Ctrl+T: Template • Ctrl+R: Reflect • Ctrl+P: Protocol • Ctrl+X: Cancel • PgUp/PgDn: Scroll • Esc: Back")
+		return container + "\n" + m.statusBar() + helpText
+	}
+
+	if m.mode == modeNetcat {
+		container := lipgloss.NewStyle().
+			BorderStyle(lipgloss.RoundedBorder()).
+			BorderForeground(lipgloss.Color("#336699")).
+			Padding(1, 2).
+			Render(fmt.Sprintf("%s\n\n%s", titleStyle.Render("Netcat"), m.netcatView()))
+		helpText := lipgloss.NewStyle().
+			Foreground(lipgloss.Color("#888888")).
+			Render("\nEnter: Send line • ↑/↓: Sent lines • Ctrl+E: Line endings • Ctrl+O: Text/Hex • Ctrl+K: Clear • Ctrl+X: Disconnect • Ctrl+R: Reconnect • PgUp/PgDn: Scroll • Esc: Back")
+		return container + "\n" + m.statusBar() + helpText
+	}
+
 	title := titleStyle.Render("URL Fetcher")
 	input := m.textInput.View()
 	if m.fetching {
-		input += " " + lipgloss.NewStyle().Foreground(lipgloss.Color("#FFCC00")).Render("Loading...")
+		loading := "Loading..."
+		if m.streamReceived > 0 {
+			loading = fmt.Sprintf("Loading... %s", formatBytes(m.streamReceived))
+		}
+		input += " " + lipgloss.NewStyle().Foreground(lipgloss.Color("#FFCC00")).Render(loading)
 	}
 	inputBox := inputStyle.Render(input)
 
 	var responseView string
-	if m.err != nil {
+	if m.workspacePicker != nil {
+		responseView = renderWorkspacePicker(m.workspacePicker)
+	} else if m.environmentPicker != nil {
+		if m.environmentPicker.showHistory {
+			responseView = renderEnvironmentHistory(m.environmentPicker, m.viewport.Height)
+		} else {
+			responseView = renderEnvironmentPicker(m.environmentPicker)
+		}
+	} else if m.sessionPicker != nil {
+		responseView = renderSessionPicker(m.sessionPicker)
+	} else if m.har.open {
+		responseView = renderHAR(m.har, m.viewport.Height)
+	} else if m.savePrompt != nil {
+		responseView = headerStyle.Render("Save request") + "\n\n" + inputStyle.Render(m.savePrompt.View()) +
+			historyDimStyle.Render("\n\nSaved to the named collection, or \""+defaultCollection+"\" without one • Enter: Save • Esc: Cancel")
+	} else if m.saveDuplicates != nil {
+		responseView = renderSaveDuplicates(m.saveDuplicates)
+	} else if m.requestRevisions != nil {
+		responseView = renderRequestRevisions(m.requestRevisions, m.viewport.Height)
+	} else if m.varPrompt != nil {
+		responseView = renderVarPrompt(m.varPrompt)
+	} else if m.filterREPL != nil {
+		responseView = m.filterREPLView()
+	} else if m.showHistory {
+		responseView = renderHistory(m.history, m.historyFilter, m.historyIdx, m.viewport.Height)
+	} else if m.showSuggestions {
+		responseView = renderSuggestions(m.suggestions, m.suggestionIdx)
+	} else if m.download != nil {
+		responseView = renderDownload(m.download, m.viewport.Width-m.viewport.Style.GetHorizontalFrameSize())
+	} else if m.err != nil && !m.showTiming && !m.dns.open {
 		responseView = errorStyle.Render(fmt.Sprintf("Error: %v", m.err))
 	} else {
 		responseView = m.viewport.View()
 	}
 
+	if m.summary != nil {
+		responseView = lipgloss.JoinHorizontal(lipgloss.Top, lipgloss.PlaceHorizontal(m.viewport.Width, lipgloss.Left, responseView), " ", m.summaryView())
+	}
+	if m.sidebar.open {
+		height := lipgloss.Height(m.viewport.View()) - sidebarStyle.GetVerticalFrameSize()
+		responseView = lipgloss.JoinHorizontal(lipgloss.Top, m.sidebar.view(m.panes.sidebarWidth(), height), " ", responseView)
+	}
+
+	help := "\n↑/↓: Scroll • Enter: Fetch URL • Ctrl+D: Download • Ctrl+P: Preview • Ctrl+Y: Copy as code • Ctrl+J: Summarize • Ctrl+S: Save • Ctrl+B: Collections • Ctrl+W: Workspaces • Ctrl+E: Environments • Ctrl+O: Sessions • Ctrl+N: HAR • Ctrl+R: History • Ctrl+T: JSON types • Alt+P: Force format • Alt+M: Mask PII • Alt+I: Skip TLS verification • Alt+C: Certificates • Alt+E: Next GraphQL error • Ctrl+]: Filter • Ctrl+_: Expand collapsed body • Ctrl+K: Timing • Alt+W: Export waterfall • Alt+R: DNS lookup • Ctrl+X: Cancel • Ctrl+L: Request lab • Ctrl+\\: GraphQL • Ctrl+^: gRPC • Ctrl+C/Esc: Quit"
+	if len(m.suggestions) > 0 {
+		help += fmt.Sprintf(" • Ctrl+G: Suggestions (%d)", len(m.suggestions))
+	}
 	helpText := lipgloss.NewStyle().
 		Foreground(lipgloss.Color("#888888")).
-		Render("\n↑/↓: Scroll • Enter: Fetch URL • Ctrl+C/Esc: Quit")
+		Render(help)
 
 	// Create a border around everything
 	container := lipgloss.NewStyle().
@@ -444,20 +1833,169 @@ func (m model) View() string {
 		Render(fmt.Sprintf("%s\n\n%s\n\n%s", title, inputBox, responseView))
 
 	// Lay out the components
-	return container + helpText
+	return container + "\n" + m.statusBar() + helpText
 }
 
 func main() {
+	loadCurrentWorkspace()
+	detectProjectWorkspace()
+
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "init":
+			os.Exit(initCommand(os.Args[2:]))
+		case "run":
+			os.Exit(runCommand(os.Args[2:]))
+		case "serve":
+			os.Exit(serveCommand(os.Args[2:]))
+		case "import":
+			os.Exit(importCommand(os.Args[2:]))
+		case "export":
+			os.Exit(exportCommand(os.Args[2:]))
+		case "waterfall":
+			os.Exit(waterfallCommand(os.Args[2:]))
+		case "export-workspace":
+			os.Exit(exportWorkspaceCommand(os.Args[2:]))
+		case "import-workspace":
+			os.Exit(importWorkspaceCommand(os.Args[2:]))
+		case "import-cookies":
+			os.Exit(importCookiesCommand(os.Args[2:]))
+		case "doctor":
+			os.Exit(doctorCommand(os.Args[2:]))
+		}
+	}
+
+	protoPath := flag.String("proto", "", "`file` (.proto or protoc descriptor set) used to decode protobuf responses")
+	flag.StringVar(&protoMessage, "proto-message", "", "fully-qualified protobuf message `type` of responses")
+	policyPath := flag.String("egress-policy", "", "JSON `file` restricting what requests and server modes may connect to and accept")
+	flag.IntVar(&historyLimit, "history-size", historyLimit, "number of requests kept in the history")
+	flag.Func("var", "set a template variable (`name=value`, repeatable)", parseVarFlag)
+	registerTimeoutFlags(flag.CommandLine, &defaultTimeouts)
+	flag.Func("http-version", "force the HTTP `version` of requests, 1.1, 2 or 3 (default negotiated)", parseHTTPVersionFlag)
+	flag.Func("redirects", redirectsUsage, parseRedirectsFlag)
+	flag.BoolVar(&maskResponses, "mask", false, "start with responses masked: emails, phone numbers, tokens and the workspace's masking rules (Alt+M toggles)")
+	flag.BoolVar(&scanResponseSecrets, "scan-secrets", true, "flag likely secrets in responses, like AWS keys, JWTs and private keys")
+	flag.Func("proxy", proxyUsage, parseProxyFlag)
+	flag.BoolFunc("insecure", insecureUsage, parseInsecureFlag)
+	flag.Func("cacert", cacertUsage, parseCACertFlag)
+	flag.Func("tls-min", tlsMinUsage, parseTLSMinFlag)
+	flag.Func("tls-max", tlsMaxUsage, parseTLSMaxFlag)
+	flag.Func("ciphers", ciphersUsage, parseCiphersFlag)
+	flag.Func("pin", pinUsage, parsePinFlag)
+	flag.Func("resolve", "connect to another address than a host resolves to, `host:port:address` as with curl (repeatable)", parseResolveFlag)
+	flag.Func("resolver", resolverUsage, parseResolverFlag)
+	flag.Func("rate-limit", "hold requests to a host to a rate, `host=rate` like api.example.com=2/s (repeatable)", parseRateLimitFlag)
+	workspace := flag.String("workspace", "", "switch to the named workspace, creating it if needed")
+	remote := flag.String("remote", "", "open a read-only workspace from a git `URL` or .tar.gz URL")
+	flag.BoolVar(&allowRemoteSecrets, "allow-remote-secrets", false, allowRemoteSecretsUsage)
+	env := flag.String("env", "", "use the named environment of the workspace")
+	flag.StringVar(&activeSession, "session", "", "send requests in the named session, with its own cookies and headers")
+	harPath := flag.String("har", "", "open the HAR `file` to browse and replay its requests")
+	flag.Func("http", "open the .http or .rest `file` in the sidebar, as a collection (repeatable)", parseHTTPFlag)
+	recordHAR := flag.String("record-har", "", "record the requests of this session to a HAR `file`")
+	flag.Func("alert", "how to signal failed expectations and watched changes: `bell,flash` or none", parseAlertFlag)
+	flag.StringVar(&alertWebhook, "alert-webhook", "", "also post alerts as JSON to this `URL`")
+	flag.StringVar(&assistantURL, "assistant", "", "chat `URL` of an OpenAI-compatible or Anthropic API to draft requests from \"? question\" lines (off unless set)")
+	flag.StringVar(&assistantModel, "assistant-model", "", "`model` the assistant asks")
+	flag.StringVar(&assistantKey, "assistant-key", "", "API key of the assistant, as a secret `reference` such as env:OPENAI_API_KEY")
+	flag.StringVar(&summarizeCommand, "summarize", "", "shell `command` Ctrl+J pipes the response body to, showing its output beside the response")
+	listen := flag.String("listen", "", "accept requests sent from editors on the loopback `address`, like 127.0.0.1:7332")
+	flag.BoolVar(&incognito, "incognito", false, "don't persist anything (history, cookies, autosave) this session")
+	flag.Parse()
+
+	if *workspace != "" {
+		if err := useWorkspace(*workspace); err != nil {
+			fmt.Printf("Error switching workspace: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if *remote != "" {
+		warning, err := openRemoteWorkspace(*remote)
+		if err != nil {
+			fmt.Printf("Error opening remote workspace: %v\n", err)
+			os.Exit(1)
+		}
+		if warning != nil {
+			fmt.Printf("Warning: %v\n", warning)
+		}
+	}
+	if err := loadEnvironments(); err != nil {
+		fmt.Printf("Error loading environments: %v\n", err)
+	}
+	if err := loadRateLimits(); err != nil {
+		fmt.Printf("Error loading rate limits: %v\n", err)
+	}
+	if *env != "" {
+		if err := useEnvironment(*env); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if *policyPath != "" {
+		policy, err := loadEgressPolicy(*policyPath)
+		if err != nil {
+			fmt.Printf("Error loading egress policy: %v\n", err)
+			os.Exit(1)
+		}
+		serverPolicy, outboundPolicy = policy, policy
+	}
+
+	if *protoPath != "" {
+		files, err := loadProtoDescriptors(*protoPath)
+		if err != nil {
+			fmt.Printf("Error loading protobuf descriptors: %v\n", err)
+			os.Exit(1)
+		}
+		protoFiles, protoFile = files, *protoPath
+	}
+
+	if err := loadCookieJar(); err != nil {
+		fmt.Printf("Error loading cookies: %v\n", err)
+	}
+
+	m := initialModel()
+	history, err := loadHistory()
+	if err != nil {
+		fmt.Printf("Error loading history: %v\n", err)
+	}
+	m.history = history
+	if m.usage, err = loadQuotaUsage(); err != nil {
+		fmt.Printf("Error loading quota usage: %v\n", err)
+	}
+	if m.panes, err = loadLayout(); err != nil {
+		fmt.Printf("Error loading the layout: %v\n", err)
+	}
+	if *harPath != "" {
+		if m.har = m.har.load(*harPath); m.har.err != nil {
+			fmt.Printf("Error loading HAR file: %v\n", m.har.err)
+			os.Exit(1)
+		}
+		m = m.openHAR()
+	}
+	if *recordHAR != "" {
+		m.harLog = &harRecorder{path: *recordHAR}
+	}
+
 	fmt.Println("Starting URL Fetcher TUI...")
 
 	// Set up the program with mouse support
 	p := tea.NewProgram(
-		initialModel(),
+		m,
 		tea.WithAltScreen(),
 		tea.WithMouseCellMotion(),
 	)
+	if *listen != "" {
+		if err := listenForEditors(*listen, p); err != nil {
+			fmt.Printf("Error listening for editors: %v\n", err)
+			os.Exit(1)
+		}
+	}
 
 	if _, err := p.Run(); err != nil {
 		fmt.Printf("Error running program: %v\n", err)
 	}
+	if err := saveCookieJar(); err != nil {
+		fmt.Printf("Error saving cookies: %v\n", err)
+	}
 }
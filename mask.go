@@ -0,0 +1,393 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// maskRulesFile holds the masking rules of the workspace, redacting what
+// shouldn't be on a shared screen, e.g.
+// [{"builtin": "email"}, {"path": "$.users[*].address"}, {"pattern": "acct_\\w+"}]
+const maskRulesFile = "mask-rules.json"
+
+// defaultMask replaces masked values unless a rule says otherwise
+const defaultMask = "••••••"
+
+// maskResponses is set with -mask, starting with masking on
+var maskResponses bool
+
+var maskBadgeStyle = lipgloss.NewStyle().
+	Bold(true).
+	Foreground(lipgloss.Color("#FAFAFA")).
+	Background(lipgloss.Color("#2E8B57")).
+	Padding(0, 1)
+
+// maskState is whether displayed responses are masked, with the rules
+// last read
+type maskState struct {
+	on    bool
+	rules []maskRule
+}
+
+// maskRule redacts the values it matches in displayed responses. The
+// response itself is kept as received, for downloads and recordings.
+type maskRule struct {
+	// Builtin is one of the rules lazyhttp knows: email, phone or token
+	Builtin string `json:"builtin,omitempty"`
+
+	// Pattern is a regular expression masked wherever it matches, in
+	// strings of JSON bodies, other bodies and header values
+	Pattern string `json:"pattern,omitempty"`
+
+	// Path is a JSONPath of values masked whole, with .name, ['name'],
+	// [0], [*], .* and ..name; objects and arrays are masked field by field
+	Path string `json:"path,omitempty"`
+
+	// Replace is what masked text is replaced with
+	Replace string `json:"replace,omitempty"`
+
+	patterns []*regexp.Regexp
+	path     []maskStep
+}
+
+// builtinMasks are the patterns of the builtin rules
+var builtinMasks = map[string][]*regexp.Regexp{
+	"email": {regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)*\.[A-Za-z]{2,}`)},
+	// International numbers, or national ones with separators, so that
+	// dates, timestamps and IDs stay readable
+	"phone": {regexp.MustCompile(`\+\d{1,3}[\s.-]?\(?\d{1,4}\)?(?:[\s.-]?\d{2,4}){2,4}\b|\(\d{3}\)\s?\d{3}[\s.-]\d{4}\b|\b\d{3}[\s.-]\d{3}[\s.-]\d{4}\b`)},
+	"token": secretMaskPatterns(),
+}
+
+// secretMaskPatterns are the credential shapes of the secret scanner
+func secretMaskPatterns() []*regexp.Regexp {
+	var patterns []*regexp.Regexp
+	for _, p := range secretPatterns {
+		patterns = append(patterns, p.pattern)
+	}
+	return patterns
+}
+
+// defaultMaskRules apply when the workspace has no masking rules
+var defaultMaskRules = []maskRule{{Builtin: "email"}, {Builtin: "phone"}, {Builtin: "token"}}
+
+// compile checks a rule and prepares its patterns and path
+func (r *maskRule) compile() error {
+	set := 0
+	for _, s := range []string{r.Builtin, r.Pattern, r.Path} {
+		if s != "" {
+			set++
+		}
+	}
+	if set != 1 {
+		return errors.New("give one of builtin, pattern or path")
+	}
+	switch {
+	case r.Builtin != "":
+		patterns, ok := builtinMasks[r.Builtin]
+		if !ok {
+			return fmt.Errorf("unknown builtin %q, use email, phone or token", r.Builtin)
+		}
+		r.patterns = patterns
+	case r.Pattern != "":
+		re, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			return fmt.Errorf("pattern: %w", err)
+		}
+		r.patterns = []*regexp.Regexp{re}
+	default:
+		path, err := parseMaskPath(r.Path)
+		if err != nil {
+			return fmt.Errorf("path %s: %w", r.Path, err)
+		}
+		r.path = path
+	}
+	if r.Replace == "" {
+		r.Replace = defaultMask
+	}
+	return nil
+}
+
+// loadMaskRules reads the masking rules of the workspace, the builtin ones
+// when it has none. The file is read when masking is turned on and for
+// each response, so edits apply to the next one.
+func loadMaskRules() ([]maskRule, error) {
+	path, err := workspaceFile(maskRulesFile)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	rules := append([]maskRule(nil), defaultMaskRules...)
+	if err == nil {
+		rules = nil
+		if err := json.Unmarshal(data, &rules); err != nil {
+			return nil, fmt.Errorf("%s: %w", maskRulesFile, err)
+		}
+	}
+	for i := range rules {
+		if err := rules[i].compile(); err != nil {
+			return nil, fmt.Errorf("%s: rule %d: %w", maskRulesFile, i+1, err)
+		}
+	}
+	return rules, nil
+}
+
+// maskStep is a step of a masking path: a field, an index, any child
+// (wildcard), and each of those among descendants too (descend)
+type maskStep struct {
+	field    string
+	index    int // -1 for a field
+	wildcard bool
+	descend  bool
+}
+
+// parseMaskPath reads the JSONPath subset masking rules use
+func parseMaskPath(path string) ([]maskStep, error) {
+	rest, ok := strings.CutPrefix(strings.TrimSpace(path), "$")
+	if !ok {
+		return nil, errors.New("a path starts with $")
+	}
+	var steps []maskStep
+	for rest != "" {
+		step := maskStep{index: -1}
+		switch {
+		case strings.HasPrefix(rest, ".."):
+			step.descend = true
+			rest = rest[2:]
+			if strings.HasPrefix(rest, "[") {
+				break
+			}
+			fallthrough
+		case strings.HasPrefix(rest, "."):
+			rest = strings.TrimPrefix(rest, ".")
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			name := rest[:end]
+			if name == "" {
+				return nil, errors.New("expected a name after .")
+			}
+			step.field, step.wildcard = name, name == "*"
+			rest = rest[end:]
+			steps = append(steps, step)
+			continue
+		case !strings.HasPrefix(rest, "["):
+			return nil, fmt.Errorf("unexpected %q", rest)
+		}
+		end := strings.Index(rest, "]")
+		if end < 0 {
+			return nil, errors.New("missing ]")
+		}
+		inner := strings.TrimSpace(rest[1:end])
+		rest = rest[end+1:]
+		switch {
+		case inner == "*":
+			step.wildcard = true
+		case len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0]:
+			step.field = inner[1 : len(inner)-1]
+		default:
+			i, err := strconv.Atoi(inner)
+			if err != nil || i < 0 {
+				return nil, fmt.Errorf("expected an index, * or a quoted name in [%s]", inner)
+			}
+			step.index = i
+		}
+		steps = append(steps, step)
+	}
+	return steps, nil
+}
+
+// matchesKey reports whether a step selects the child at key, a field
+// name or an array index
+func (s maskStep) matchesKey(key interface{}) bool {
+	if s.wildcard {
+		return true
+	}
+	switch k := key.(type) {
+	case string:
+		return s.index < 0 && s.field == k
+	case int:
+		return s.index == k
+	}
+	return false
+}
+
+// maskPathMatches reports whether the value at location, the keys leading
+// to it, is selected by steps or inside what they select
+func maskPathMatches(steps []maskStep, location []interface{}) bool {
+	if len(steps) == 0 {
+		return true
+	}
+	if len(location) == 0 {
+		return false
+	}
+	s := steps[0]
+	if s.matchesKey(location[0]) && maskPathMatches(steps[1:], location[1:]) {
+		return true
+	}
+	return s.descend && maskPathMatches(steps, location[1:])
+}
+
+// masker redacts a response by a set of rules, counting what it masks
+type masker struct {
+	rules  []maskRule
+	masked int
+}
+
+// text masks the pattern matches of a string
+func (mk *masker) text(s string) string {
+	for _, r := range mk.rules {
+		for _, re := range r.patterns {
+			s = re.ReplaceAllStringFunc(s, func(string) string {
+				mk.masked++
+				return r.Replace
+			})
+		}
+	}
+	return s
+}
+
+// pathMask is the replacement of the value at location when a path rule
+// selects it
+func (mk *masker) pathMask(location []interface{}) (string, bool) {
+	for _, r := range mk.rules {
+		if r.path != nil && maskPathMatches(r.path, location) {
+			return r.Replace, true
+		}
+	}
+	return "", false
+}
+
+// json masks a JSON document, rewritten compactly with its fields in the
+// order they came in
+func (mk *masker) json(body []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var buf bytes.Buffer
+	if err := mk.jsonValue(dec, &buf, nil); err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, errInvalidJSON
+	}
+	return buf.Bytes(), nil
+}
+
+func (mk *masker) jsonValue(dec *json.Decoder, buf *bytes.Buffer, location []interface{}) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	delim, ok := tok.(json.Delim)
+	if !ok {
+		if replace, ok := mk.pathMask(location); ok && tok != nil {
+			mk.masked++
+			tok = replace
+		} else if s, ok := tok.(string); ok {
+			tok = mk.text(s)
+		}
+		buf.Write(marshalFilterResult(tok))
+		return nil
+	}
+	buf.WriteRune(rune(delim))
+	for i := 0; dec.More(); i++ {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		var key interface{} = i
+		if delim == '{' {
+			name, err := dec.Token()
+			if err != nil {
+				return err
+			}
+			key = name
+			buf.Write(marshalFilterResult(name))
+			buf.WriteByte(':')
+		}
+		if err := mk.jsonValue(dec, buf, append(location[:len(location):len(location)], key)); err != nil {
+			return err
+		}
+	}
+	end, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	buf.WriteRune(rune(end.(json.Delim)))
+	return nil
+}
+
+// maskResponse returns the response as shown while masking: JSON bodies
+// masked value by value so they stay JSON, others as text, and header
+// values. It also returns how many values were masked.
+func maskResponse(resp fetchMsg, rules []maskRule) (fetchMsg, int) {
+	mk := &masker{rules: rules}
+	if len(resp.body) > 0 && !isBinary(resp.body) {
+		if masked, err := mk.json(resp.body); err == nil {
+			resp.body = masked
+		} else {
+			mk.masked = 0
+			resp.body = []byte(mk.text(string(resp.body)))
+		}
+	}
+	header := resp.header.Clone()
+	for name, values := range header {
+		for i, v := range values {
+			values[i] = mk.text(v)
+		}
+		header[name] = values
+	}
+	resp.header = header
+	return resp, mk.masked
+}
+
+// renderMaskNote says the response is masked, and how much of it
+func renderMaskNote(masked int) string {
+	values := "values"
+	if masked == 1 {
+		values = "value"
+	}
+	return historyDimStyle.Render(fmt.Sprintf("Masked %d %s • downloads and recordings keep the raw response • Alt+M: Unmask", masked, values)) + "\n\n"
+}
+
+// maskedResponse is the last response as displayed, masked while masking
+// is on, with the note saying so
+func (m model) maskedResponse() (fetchMsg, string) {
+	resp := *m.lastResponse
+	if !m.mask.on {
+		return resp, ""
+	}
+	resp, masked := maskResponse(resp, m.mask.rules)
+	return resp, renderMaskNote(masked)
+}
+
+// toggleMask turns masking of displayed responses on or off
+func (m model) toggleMask() model {
+	m.mask.on = !m.mask.on
+	if m.mask.on {
+		rules, err := loadMaskRules()
+		if err != nil {
+			m.mask.on = false
+			m.notice = errorStyle.Render("Masking rules: " + err.Error())
+			return m
+		}
+		m.mask.rules = rules
+	}
+	if m.lastResponse != nil && m.err == nil && !m.fetching && !m.showTiming && !m.dns.open {
+		m.response = m.renderLastResponse()
+		m.viewport.SetContent(m.response)
+	}
+	return m
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+var mimeWarningStyle = lipgloss.NewStyle().
+	Bold(true).
+	Foreground(lipgloss.Color("#1E1E1E")).
+	Background(lipgloss.Color("#FFCC00")).
+	Padding(0, 1)
+
+// mimeMismatch is a body that isn't what its Content-Type says
+type mimeMismatch struct {
+	declared string // the media type of the header, "" when there is none
+	sniffed  string // the format the body looks like, as detectTextFormat names them
+	nosniff  bool   // X-Content-Type-Options: nosniff
+}
+
+// declaredFormat is the format a media type promises, "" for those whose
+// bodies can't be told apart by looking at them, like octet-stream
+func declaredFormat(mediaType string) string {
+	switch {
+	case mediaType == "application/json", strings.HasSuffix(mediaType, "+json"):
+		return "json"
+	case mediaType == "text/html":
+		return "html"
+	case mediaType == "application/xml", mediaType == "text/xml", strings.HasSuffix(mediaType, "+xml"):
+		return "xml"
+	case mediaType == "text/css":
+		return "css"
+	case mediaType == "application/javascript", mediaType == "text/javascript":
+		return "javascript"
+	case strings.HasPrefix(mediaType, "image/") && mediaType != "image/svg+xml":
+		return "image"
+	}
+	return ""
+}
+
+// sniffFormat is the format body looks like, "" for an empty one
+func sniffFormat(body []byte) string {
+	switch {
+	case len(body) == 0:
+		return ""
+	case isBinary(body):
+		if strings.HasPrefix(http.DetectContentType(body), "image/") {
+			return "image"
+		}
+		return "binary"
+	}
+	// Objects and arrays only, a bare number or string is just as likely text
+	if trimmed := bytes.TrimSpace(body); len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[') && json.Valid(trimmed) {
+		return "json"
+	}
+	return detectTextFormat(body)
+}
+
+// sniffMismatch compares the Content-Type of a response with what its body
+// looks like, nil when they agree or there is too little to tell. Only
+// contradictions count: JSON is valid JavaScript and YAML, and XHTML is
+// XML, so those aren't flagged.
+func sniffMismatch(r fetchMsg) *mimeMismatch {
+	sniffed := sniffFormat(r.body)
+	if sniffed == "" || r.partial {
+		return nil
+	}
+	m := &mimeMismatch{sniffed: sniffed, nosniff: strings.EqualFold(strings.TrimSpace(r.header.Get("X-Content-Type-Options")), "nosniff")}
+	contentType := r.header.Get("Content-Type")
+	if contentType == "" {
+		if sniffed == "text" {
+			return nil
+		}
+		return m
+	}
+	m.declared, _, _ = mime.ParseMediaType(contentType)
+	switch declaredFormat(m.declared) {
+	case "json":
+		if sniffed == "json" || json.Valid(r.body) {
+			return nil
+		}
+	case "html":
+		if sniffed != "json" && sniffed != "binary" && sniffed != "image" {
+			return nil
+		}
+	case "xml":
+		if sniffed == "xml" || sniffed == "html" {
+			return nil
+		}
+	case "css", "javascript":
+		if sniffed != "html" && sniffed != "xml" && sniffed != "binary" && sniffed != "image" {
+			return nil
+		}
+	case "image":
+		if sniffed == "image" {
+			return nil
+		}
+	default:
+		return nil
+	}
+	return m
+}
+
+// shownAs is the format a mismatched body is highlighted in, the sniffed
+// one when it's text
+func (m *mimeMismatch) shownAs() string {
+	if m.sniffed == "binary" || m.sniffed == "image" || m.sniffed == "text" {
+		return ""
+	}
+	return m.sniffed
+}
+
+// implications spells out what the mismatch means for clients, depending
+// on X-Content-Type-Options
+func (m *mimeMismatch) implications() []string {
+	var lines []string
+	format := strings.ToUpper(m.sniffed)
+	switch {
+	case m.declared == "":
+		lines = append(lines, "Without a Content-Type, browsers and clients guess the type from the body.")
+	case m.nosniff:
+		lines = append(lines, fmt.Sprintf("X-Content-Type-Options: nosniff is set, so browsers go by %s: a script or stylesheet served with it is blocked.", m.declared))
+	default:
+		lines = append(lines, fmt.Sprintf("X-Content-Type-Options: nosniff is missing, so browsers may sniff the body and handle it as %s instead.", format))
+	}
+	if m.sniffed == "html" && !m.nosniff {
+		lines = append(lines, "A sniffed HTML body can run scripts in the site's origin, a content-sniffing XSS risk if it echoes user input.")
+	}
+	switch declaredFormat(m.declared) {
+	case "json":
+		lines = append(lines, "Clients parsing it as JSON will fail, often because an error page or proxy answered instead of the API.")
+	case "image":
+		lines = append(lines, "Clients decoding it as an image will fail.")
+	}
+	return lines
+}
+
+// render is the warning banner over the response
+func (m *mimeMismatch) render() string {
+	title := fmt.Sprintf("⚠ Content-Type mismatch: %s, but the body looks like %s", m.declared, strings.ToUpper(m.sniffed))
+	if m.declared == "" {
+		title = fmt.Sprintf("⚠ No Content-Type, the body looks like %s", strings.ToUpper(m.sniffed))
+	}
+	var sb strings.Builder
+	sb.WriteString(mimeWarningStyle.Render(title))
+	sb.WriteString("\n")
+	for _, line := range m.implications() {
+		sb.WriteString(timingWarnStyle.Render("  " + line))
+		sb.WriteString("\n")
+	}
+	if f := m.shownAs(); f != "" {
+		sb.WriteString(historyDimStyle.Render("  Shown as " + strings.ToUpper(f) + ", as sniffed."))
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// monitorFile is the monitoring log inside the workspace directory, filled
+// by `lazyhttp run -record`
+const monitorFile = "monitor.jsonl"
+
+// monitorRetention is how long samples are kept in the monitoring log
+const monitorRetention = 8 * 7 * 24 * time.Hour
+
+// heatmapWindow is the period the heatmap covers
+const heatmapWindow = 4 * 7 * 24 * time.Hour
+
+// monitorSample records one request of a recorded headless run
+type monitorSample struct {
+	Key       string    `json:"key"` // see savedRequestSchemaKey
+	Time      time.Time `json:"time"`
+	LatencyMs int64     `json:"latency_ms"`
+	Status    int       `json:"status,omitempty"`
+	Failed    bool      `json:"failed,omitempty"` // an error or a missed expectation
+}
+
+// loadMonitorSamples reads the monitoring log of the workspace, skipping
+// lines that don't parse
+func loadMonitorSamples() ([]monitorSample, error) {
+	path, err := workspaceFile(monitorFile)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var samples []monitorSample
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var s monitorSample
+		if json.Unmarshal(scanner.Bytes(), &s) == nil {
+			samples = append(samples, s)
+		}
+	}
+	return samples, scanner.Err()
+}
+
+// recordMonitorSamples adds samples to the monitoring log, dropping those
+// older than monitorRetention; a no-op in incognito mode
+func recordMonitorSamples(samples []monitorSample) error {
+	if incognito || len(samples) == 0 {
+		return nil
+	}
+	existing, err := loadMonitorSamples()
+	if err != nil {
+		return err
+	}
+	cutoff := time.Now().Add(-monitorRetention)
+	var buf []byte
+	for _, s := range append(existing, samples...) {
+		if s.Time.Before(cutoff) {
+			continue
+		}
+		data, err := json.Marshal(s)
+		if err != nil {
+			return err
+		}
+		buf = append(append(buf, data...), '\n')
+	}
+	path, err := workspaceFile(monitorFile)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, buf, 0o600)
+}
+
+// heatmapCell aggregates the samples of one weekday and hour
+type heatmapCell struct {
+	latencies []int64 // of the requests that got a response
+	total     int
+	failed    int
+}
+
+func (c heatmapCell) median() int64 {
+	if len(c.latencies) == 0 {
+		return 0
+	}
+	sorted := append([]int64(nil), c.latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted[len(sorted)/2]
+}
+
+func (c heatmapCell) errorRate() float64 {
+	if c.total == 0 {
+		return 0
+	}
+	return float64(c.failed) / float64(c.total)
+}
+
+// heatmapShades run from good to bad
+var heatmapShades = []lipgloss.Style{
+	lipgloss.NewStyle().Foreground(lipgloss.Color("#2E7D32")),
+	lipgloss.NewStyle().Foreground(lipgloss.Color("#98C379")),
+	lipgloss.NewStyle().Foreground(lipgloss.Color("#E5C07B")),
+	lipgloss.NewStyle().Foreground(lipgloss.Color("#D19A66")),
+	lipgloss.NewStyle().Foreground(lipgloss.Color("#E06C75")),
+}
+
+// errorRateSteps are the upper bounds of the error rate shades but the last
+var errorRateSteps = []float64{0, 0.01, 0.05, 0.2}
+
+// heatmapDays lists the rows of the heatmap, Monday first
+var heatmapDays = []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday, time.Saturday, time.Sunday}
+
+// renderHeatmap draws the median latency and the error rate of a saved
+// request by weekday and hour of the day, local time, from the samples
+// recorded over the last heatmapWindow
+func renderHeatmap(name, key string, samples []monitorSample) string {
+	var grid [7][24]heatmapCell
+	count := 0
+	cutoff := time.Now().Add(-heatmapWindow)
+	for _, s := range samples {
+		if s.Key != key || s.Time.Before(cutoff) {
+			continue
+		}
+		t := s.Time.Local()
+		cell := &grid[(int(t.Weekday())+6)%7][t.Hour()]
+		cell.total++
+		if s.Failed {
+			cell.failed++
+		}
+		if s.Status != 0 {
+			cell.latencies = append(cell.latencies, s.LatencyMs)
+		}
+		count++
+	}
+
+	var sb strings.Builder
+	sb.WriteString(headerStyle.Render("Monitoring"))
+	sb.WriteString(historyDimStyle.Render(" " + name))
+	sb.WriteString("\n\n")
+	if count == 0 {
+		sb.WriteString("No samples recorded for this request in the last 4 weeks.\n\n")
+		sb.WriteString(historyDimStyle.Render("Record some by running its collection on a schedule with `lazyhttp run -record`, e.g. from cron."))
+		return sb.String()
+	}
+	fmt.Fprintf(&sb, "%d samples over the last 4 weeks, by weekday and hour (local time)\n", count)
+
+	// Latency shades split the range of the hourly medians in equal steps
+	var lo, hi int64 = -1, 0
+	for _, row := range grid {
+		for _, cell := range row {
+			if len(cell.latencies) == 0 {
+				continue
+			}
+			m := cell.median()
+			if lo < 0 || m < lo {
+				lo = m
+			}
+			hi = max(hi, m)
+		}
+	}
+	latencyShade := func(c heatmapCell) int {
+		if hi == lo {
+			return 0
+		}
+		return min(int(float64(c.median()-lo)/float64(hi-lo)*float64(len(heatmapShades))), len(heatmapShades)-1)
+	}
+	errorShade := func(c heatmapCell) int {
+		rate := c.errorRate()
+		for i, step := range errorRateSteps {
+			if rate <= step {
+				return i
+			}
+		}
+		return len(heatmapShades) - 1
+	}
+
+	sb.WriteString("\n")
+	sb.WriteString(headerStyle.Render("Median latency"))
+	sb.WriteString("\n")
+	writeHeatmap(&sb, grid, func(c heatmapCell) (int, bool) { return latencyShade(c), len(c.latencies) > 0 })
+	legend := make([]string, len(heatmapShades))
+	for i := range heatmapShades {
+		from := lo + (hi-lo)*int64(i)/int64(len(heatmapShades))
+		legend[i] = heatmapShades[i].Render("██") + fmt.Sprintf(" %dms+", from)
+	}
+	sb.WriteString("     " + strings.Join(legend, "  ") + "\n")
+
+	sb.WriteString("\n")
+	sb.WriteString(headerStyle.Render("Error rate"))
+	sb.WriteString("\n")
+	writeHeatmap(&sb, grid, func(c heatmapCell) (int, bool) { return errorShade(c), c.total > 0 })
+	labels := []string{"0%", "≤1%", "≤5%", "≤20%", ">20%"}
+	for i := range heatmapShades {
+		legend[i] = heatmapShades[i].Render("██") + " " + labels[i]
+	}
+	sb.WriteString("     " + strings.Join(legend, "  ") + "\n")
+
+	// Point out the worst hours, which the shades only hint at
+	var slowest, flakiest *heatmapCell
+	var slowestAt, flakiestAt string
+	for d, row := range grid {
+		for h := range row {
+			cell := &grid[d][h]
+			at := fmt.Sprintf("%s %02d:00", heatmapDays[d].String()[:3], h)
+			if len(cell.latencies) > 0 && (slowest == nil || cell.median() > slowest.median()) {
+				slowest, slowestAt = cell, at
+			}
+			if cell.failed > 0 && (flakiest == nil || cell.errorRate() > flakiest.errorRate()) {
+				flakiest, flakiestAt = cell, at
+			}
+		}
+	}
+	sb.WriteString("\n")
+	if slowest != nil {
+		fmt.Fprintf(&sb, "Slowest hour: %s, median %dms over %d samples\n", slowestAt, slowest.median(), len(slowest.latencies))
+	}
+	if flakiest != nil {
+		fmt.Fprintf(&sb, "Most errors: %s, %d of %d requests failed\n", flakiestAt, flakiest.failed, flakiest.total)
+	}
+	return sb.String()
+}
+
+// writeHeatmap draws one heatmap, two columns per hour; shade returns the
+// shade of a cell and whether it has samples at all
+func writeHeatmap(sb *strings.Builder, grid [7][24]heatmapCell, shade func(heatmapCell) (int, bool)) {
+	sb.WriteString("     ")
+	for h := 0; h < 24; h += 3 {
+		sb.WriteString(historyDimStyle.Render(fmt.Sprintf("%-6d", h)))
+	}
+	sb.WriteString("\n")
+	for d, row := range grid {
+		sb.WriteString(historyDimStyle.Render(fmt.Sprintf("%-5s", heatmapDays[d].String()[:3])))
+		for _, cell := range row {
+			if i, ok := shade(cell); ok {
+				sb.WriteString(heatmapShades[i].Render("██"))
+			} else {
+				sb.WriteString(historyDimStyle.Render("··"))
+			}
+		}
+		sb.WriteString("\n")
+	}
+}
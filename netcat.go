@@ -0,0 +1,402 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// netcatModel is an interactive TCP or TLS connection, as with netcat:
+// typed lines are sent with the chosen line ending, and whatever the
+// server sends is added to a transcript as it arrives. It talks to Redis,
+// SMTP or hand-written HTTP alike.
+type netcatModel struct {
+	addr       string
+	useTLS     bool
+	input      textinput.Model
+	lineEnding int
+	hexView    bool
+
+	// seq tells the messages of the current connection from those of
+	// earlier ones
+	seq        int
+	connecting bool
+	conn       net.Conn // nil when not connected
+	remote     string
+	tls        *tls.ConnectionState
+	done       chan struct{} // closed when the connection is dropped
+	closed     string        // why the last connection ended
+
+	transcript     []netcatChunk
+	sent, received int64
+
+	// lines are those sent, for ↑/↓ to bring back
+	lines   []string
+	lineIdx int
+}
+
+// netcatChunk is data sent or received at once
+type netcatChunk struct {
+	sent bool
+	data []byte
+}
+
+// netcatConnectedMsg reports the outcome of a connection attempt
+type netcatConnectedMsg struct {
+	seq  int
+	conn net.Conn
+	err  error
+}
+
+// netcatDataMsg carries data read from the connection, or why reading
+// ended
+type netcatDataMsg struct {
+	seq    int
+	data   []byte
+	err    error
+	stream chan netcatDataMsg
+}
+
+// isNetcatLine reports whether an input line names a raw connection,
+// tcp://host:port or tls://host:port
+func isNetcatLine(line string) bool {
+	line = strings.TrimSpace(line)
+	return strings.HasPrefix(line, "tcp://") || strings.HasPrefix(line, "tls://")
+}
+
+// openNetcat connects to addr and switches to the netcat mode
+func (m model) openNetcat(addr string, useTLS bool) (model, tea.Cmd) {
+	input := textinput.New()
+	input.Prompt = "> "
+	input.Placeholder = "line to send, Enter sends it. Escapes: \\r \\n \\t \\xHH \\\\"
+	input.CharLimit = 0
+	input.Focus()
+
+	m.netcat = netcatModel{addr: addr, useTLS: useTLS, input: input, lineEnding: m.netcat.lineEnding, seq: m.netcat.seq}
+	m.mode = modeNetcat
+	m.textInput.Blur()
+	m.lab.target.Blur()
+	m.lab.editor.Blur()
+	m.err = nil
+	m.suggestions = nil
+	m = m.layout()
+	return m.connectNetcat()
+}
+
+// connectNetcat (re)opens the connection of the netcat mode
+func (m model) connectNetcat() (model, tea.Cmd) {
+	m = m.disconnectNetcat("")
+	n := &m.netcat
+	n.seq++
+	n.connecting, n.closed = true, ""
+	ctx, cancel := context.WithTimeout(context.Background(), rawDialTimeout)
+	m.cancel = cancel
+	seq, addr, useTLS := n.seq, n.addr, n.useTLS
+	m.viewport.SetContent(m.renderNetcat())
+	return m, func() tea.Msg {
+		conn, err := dialRaw(ctx, addr, useTLS)
+		return netcatConnectedMsg{seq: seq, conn: conn, err: err}
+	}
+}
+
+// disconnectNetcat drops the connection, if any, for the given reason
+func (m model) disconnectNetcat(reason string) model {
+	n := &m.netcat
+	if n.conn != nil {
+		n.conn.Close()
+		close(n.done)
+		n.conn, n.done = nil, nil
+		n.closed = reason
+	}
+	if n.connecting && m.cancel != nil {
+		m.cancel()
+		m.cancel = nil
+	}
+	n.connecting = false
+	return m
+}
+
+// readNetcat passes what the server sends to the UI until the connection
+// ends or is dropped
+func readNetcat(seq int, conn net.Conn, stream chan netcatDataMsg, done chan struct{}) {
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := conn.Read(buf)
+		msg := netcatDataMsg{seq: seq, data: append([]byte(nil), buf[:n]...), err: err, stream: stream}
+		select {
+		case stream <- msg:
+		case <-done:
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func waitForNetcat(stream chan netcatDataMsg) tea.Cmd {
+	return func() tea.Msg {
+		return <-stream
+	}
+}
+
+// netcatConnected starts reading from a new connection
+func (m model) netcatConnected(msg netcatConnectedMsg) (model, tea.Cmd) {
+	n := &m.netcat
+	if msg.seq != n.seq {
+		if msg.conn != nil {
+			msg.conn.Close()
+		}
+		return m, nil
+	}
+	n.connecting = false
+	if m.cancel != nil {
+		m.cancel()
+		m.cancel = nil
+	}
+	if msg.err != nil {
+		n.closed = "Connection failed: " + msg.err.Error()
+		m.viewport.SetContent(m.renderNetcat())
+		return m, nil
+	}
+	n.conn, n.done = msg.conn, make(chan struct{})
+	n.remote = msg.conn.RemoteAddr().String()
+	n.tls = nil
+	if tlsConn, ok := msg.conn.(*tls.Conn); ok {
+		state := tlsConn.ConnectionState()
+		n.tls = &state
+	}
+	stream := make(chan netcatDataMsg)
+	go readNetcat(n.seq, n.conn, stream, n.done)
+	m.viewport.SetContent(m.renderNetcat())
+	return m, waitForNetcat(stream)
+}
+
+// netcatData adds what the server sent to the transcript
+func (m model) netcatData(msg netcatDataMsg) (model, tea.Cmd) {
+	if msg.seq != m.netcat.seq || m.netcat.conn == nil {
+		return m, nil
+	}
+	if len(msg.data) > 0 {
+		m.netcat.addChunk(netcatChunk{data: msg.data})
+		m.netcat.received += int64(len(msg.data))
+	}
+	var cmd tea.Cmd
+	if msg.err != nil {
+		reason := "Connection closed by the server"
+		if !isClosedConn(msg.err) {
+			reason = "Connection lost: " + msg.err.Error()
+		}
+		m = m.disconnectNetcat(reason)
+	} else {
+		cmd = waitForNetcat(msg.stream)
+	}
+	m.viewport.SetContent(m.renderNetcat())
+	m.viewport.GotoBottom()
+	return m, cmd
+}
+
+// isClosedConn reports whether a read ended because the peer closed
+func isClosedConn(err error) bool {
+	return errors.Is(err, io.EOF) || errors.Is(err, net.ErrClosed)
+}
+
+// addChunk appends to the transcript, merging with the previous chunk in
+// the same direction and dropping the oldest data beyond rawMaxResponse
+func (n *netcatModel) addChunk(c netcatChunk) {
+	if last := len(n.transcript) - 1; last >= 0 && n.transcript[last].sent == c.sent {
+		n.transcript[last].data = append(n.transcript[last].data, c.data...)
+	} else {
+		n.transcript = append(n.transcript, c)
+	}
+	size := 0
+	for _, c := range n.transcript {
+		size += len(c.data)
+	}
+	for size > rawMaxResponse && len(n.transcript) > 1 {
+		size -= len(n.transcript[0].data)
+		n.transcript = n.transcript[1:]
+	}
+}
+
+// sendNetcatLine sends the input line with the chosen line ending
+func (m model) sendNetcatLine() (model, tea.Cmd) {
+	n := &m.netcat
+	if n.conn == nil {
+		return m, nil
+	}
+	line := n.input.Value()
+	data := append(unescapeRaw(line), lineEndings[n.lineEnding].sep...)
+	if len(data) == 0 {
+		return m, nil
+	}
+	n.conn.SetWriteDeadline(time.Now().Add(rawDialTimeout))
+	written, err := n.conn.Write(data)
+	n.addChunk(netcatChunk{sent: true, data: data[:written]})
+	n.sent += int64(written)
+	if line != "" && (len(n.lines) == 0 || n.lines[len(n.lines)-1] != line) {
+		n.lines = append(n.lines, line)
+	}
+	n.lineIdx = len(n.lines)
+	n.input.SetValue("")
+	if err != nil {
+		m = m.disconnectNetcat("Sending failed: " + err.Error())
+	}
+	m.viewport.SetContent(m.renderNetcat())
+	m.viewport.GotoBottom()
+	return m, nil
+}
+
+// updateNetcat handles input in the netcat mode
+func (m model) updateNetcat(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	n := &m.netcat
+	var cmd tea.Cmd
+	switch msg.Type {
+	case tea.KeyCtrlC:
+		m = m.disconnectNetcat("")
+		return m, tea.Quit
+	case tea.KeyEsc:
+		m = m.disconnectNetcat("")
+		m.mode = modeHTTP
+		m.textInput.Focus()
+		m.response = "Response will appear here"
+		m.viewport.SetContent(m.response)
+		return m.layout(), nil
+	case tea.KeyEnter:
+		return m.sendNetcatLine()
+	case tea.KeyCtrlR:
+		return m.connectNetcat()
+	case tea.KeyCtrlX:
+		m = m.disconnectNetcat("Disconnected")
+		m.viewport.SetContent(m.renderNetcat())
+		return m, nil
+	case tea.KeyCtrlE:
+		n.lineEnding = (n.lineEnding + 1) % len(lineEndings)
+		return m, nil
+	case tea.KeyCtrlO:
+		n.hexView = !n.hexView
+		m.viewport.SetContent(m.renderNetcat())
+		m.viewport.GotoBottom()
+		return m, nil
+	case tea.KeyCtrlK:
+		n.transcript = nil
+		m.viewport.SetContent(m.renderNetcat())
+		return m, nil
+	case tea.KeyUp, tea.KeyDown:
+		if msg.Type == tea.KeyUp && n.lineIdx > 0 {
+			n.lineIdx--
+		} else if msg.Type == tea.KeyDown && n.lineIdx < len(n.lines) {
+			n.lineIdx++
+		}
+		if n.lineIdx < len(n.lines) {
+			n.input.SetValue(n.lines[n.lineIdx])
+		} else {
+			n.input.SetValue("")
+		}
+		n.input.CursorEnd()
+		return m, nil
+	case tea.KeyPgUp, tea.KeyPgDown:
+		m.viewport, cmd = m.viewport.Update(msg)
+		return m, cmd
+	}
+	n.input, cmd = n.input.Update(msg)
+	return m, cmd
+}
+
+// renderNetcat shows the connection and its transcript, sent data marked
+// with → and received data as is, control bytes made visible
+func (m model) renderNetcat() string {
+	n := m.netcat
+	var sb strings.Builder
+	switch {
+	case n.connecting:
+		fmt.Fprintf(&sb, "Connecting to %s...\n", n.addr)
+	case n.conn != nil:
+		fmt.Fprintf(&sb, "%s %s", headerStyle.Render("Connected:"), n.remote)
+		if n.tls != nil {
+			fmt.Fprintf(&sb, " • %s, %s", tls.VersionName(n.tls.Version), tls.CipherSuiteName(n.tls.CipherSuite))
+			if len(n.tls.PeerCertificates) > 0 {
+				fmt.Fprintf(&sb, ", %s", n.tls.PeerCertificates[0].Subject)
+			}
+		}
+		sb.WriteString("\n")
+	}
+	sb.WriteString("\n")
+
+	sentStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("#61AFEF"))
+	for _, c := range n.transcript {
+		switch {
+		case n.hexView && c.sent:
+			fmt.Fprintf(&sb, "%s\n%s\n", sentStyle.Render(fmt.Sprintf("→ sent %s", formatBytes(int64(len(c.data))))), hexDump(c.data))
+		case n.hexView:
+			fmt.Fprintf(&sb, "%s\n%s\n", headerStyle.Render(fmt.Sprintf("← received %s", formatBytes(int64(len(c.data))))), hexDump(c.data))
+		case c.sent:
+			for _, line := range strings.SplitAfter(visualizeRaw(c.data), "\n") {
+				if line != "" {
+					sb.WriteString(sentStyle.Render("→ ") + line)
+				}
+			}
+			if !strings.HasSuffix(sb.String(), "\n") {
+				sb.WriteString("\n")
+			}
+		default:
+			sb.WriteString(visualizeRaw(c.data))
+		}
+	}
+	if n.closed != "" {
+		if !strings.HasSuffix(sb.String(), "\n") {
+			sb.WriteString("\n")
+		}
+		sb.WriteString(historyDimStyle.Render(n.closed + " • Ctrl+R: Reconnect"))
+	}
+	return sb.String()
+}
+
+// netcatView is the netcat mode: the connection's status, the transcript
+// and the line being typed
+func (m model) netcatView() string {
+	n := m.netcat
+	transport := "TCP"
+	if n.useTLS {
+		transport = "TLS"
+	}
+	view := "text"
+	if n.hexView {
+		view = "hex"
+	}
+	status := fmt.Sprintf("%s %s over %s • %s %s • %s %s • %s %s • %s %s",
+		headerStyle.Render("Target:"), n.addr, transport,
+		headerStyle.Render("Line endings:"), lineEndings[n.lineEnding].name,
+		headerStyle.Render("Sent:"), formatBytes(n.sent),
+		headerStyle.Render("Received:"), formatBytes(n.received),
+		headerStyle.Render("View:"), view)
+	return fmt.Sprintf("%s\n\n%s\n\n%s", status, m.viewport.View(), inputStyle.Render(n.input.View()))
+}
+
+// enterNetcat opens the netcat mode on a tcp:// or tls:// input line; TLS
+// defaults to port 443, plain TCP needs one
+func (m model) enterNetcat(line string) (model, tea.Cmd) {
+	line = strings.TrimSpace(line)
+	addr, useTLS := strings.TrimPrefix(line, "tcp://"), strings.HasPrefix(line, "tls://")
+	if useTLS {
+		addr = strings.TrimPrefix(line, "tls://")
+	}
+	addr = strings.TrimSuffix(addr, "/")
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		if !useTLS {
+			m.notice = errorStyle.Render("Give the port to connect to, like tcp://localhost:6379")
+			return m, nil
+		}
+		addr = net.JoinHostPort(addr, "443")
+	}
+	return m.openNetcat(addr, useTLS)
+}
@@ -0,0 +1,574 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// openAPIMethods are the operations of a path item, in the order their
+// requests are generated
+var openAPIMethods = []string{"get", "post", "put", "patch", "delete", "head", "options", "trace"}
+
+// openAPIExampleDepth bounds the references expanded into one generated
+// example body
+const openAPIExampleDepth = 8
+
+// openAPIPathParam matches the {param} segments of a path template
+var openAPIPathParam = regexp.MustCompile(`\{([^{}]+)\}`)
+
+// openAPISpec is an OpenAPI 3 or Swagger 2.0 document, kept as decoded
+// since only parts of it are read
+type openAPISpec struct {
+	doc      map[string]interface{}
+	swagger  bool // Swagger 2.0 rather than OpenAPI 3
+	source   string
+	warnings []string
+}
+
+func (s *openAPISpec) warn(format string, a ...interface{}) {
+	w := fmt.Sprintf(format, a...)
+	if !containsString(s.warnings, w) {
+		s.warnings = append(s.warnings, w)
+	}
+}
+
+// readOpenAPI reads a spec from a file or an http(s) URL
+func readOpenAPI(source string) ([]byte, error) {
+	if !isURL(source) {
+		return os.ReadFile(source)
+	}
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Get(source)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("server returned %s", resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+func isURL(s string) bool {
+	return strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://")
+}
+
+// isOpenAPI tells whether a decoded document is an OpenAPI or Swagger
+// spec
+func isOpenAPI(data []byte) bool {
+	var probe struct {
+		OpenAPI string `yaml:"openapi"`
+		Swagger string `yaml:"swagger"`
+	}
+	return yaml.Unmarshal(data, &probe) == nil && (probe.OpenAPI != "" || probe.Swagger != "")
+}
+
+// importOpenAPI generates a collection from an OpenAPI 3 or Swagger 2.0
+// spec, in JSON or YAML, read from a file or a URL. Every operation
+// becomes a request in the folder of its first tag, with {{placeholders}}
+// for its path and required parameters, an example body and its auth.
+// The first server becomes the collection's base_url; with several, each
+// becomes an environment setting it.
+func importOpenAPI(source string) (importResult, error) {
+	data, err := readOpenAPI(source)
+	if err != nil {
+		return importResult{}, err
+	}
+	var decoded interface{}
+	if err := yaml.Unmarshal(data, &decoded); err != nil {
+		return importResult{}, err
+	}
+	doc := asMap(openAPINormalize(decoded))
+	s := &openAPISpec{doc: doc, source: source}
+	switch {
+	case strings.HasPrefix(asString(doc["openapi"]), "3."):
+	case asString(doc["swagger"]) == "2.0":
+		s.swagger = true
+	default:
+		return importResult{}, errors.New("not an OpenAPI 3 or Swagger 2.0 spec")
+	}
+
+	c := &collection{Name: asString(asMap(doc["info"])["title"])}
+	if c.Name == "" {
+		c.Name = "openapi"
+	}
+	result := importResult{collection: c, spec: doc}
+	servers := s.servers()
+	if len(servers) > 0 {
+		c.Variables = map[string]string{"base_url": servers[0].url}
+	} else {
+		s.warn("the spec names no server, set base_url in an environment or the collection")
+	}
+	if len(servers) > 1 {
+		for _, srv := range servers {
+			result.environments = append(result.environments, environment{Name: srv.name, Variables: map[string]string{"base_url": srv.url}})
+		}
+	}
+
+	paths := asMap(doc["paths"])
+	names := map[string]bool{}
+	for _, path := range sortedKeys(paths) {
+		item := s.resolve(paths[path])
+		for _, method := range openAPIMethods {
+			op := asMap(item[method])
+			if op == nil {
+				continue
+			}
+			r := s.request(path, method, item, op)
+			r.OpenAPI = &openAPIRef{Operation: strings.ToUpper(method) + " " + path}
+			// Keep names unique within their folder
+			base := r.Name
+			for n := 2; names[r.Folder+"/"+r.Name]; n++ {
+				r.Name = fmt.Sprintf("%s %d", base, n)
+			}
+			names[r.Folder+"/"+r.Name] = true
+			c.Requests = append(c.Requests, r)
+		}
+	}
+	if len(c.Requests) == 0 {
+		return importResult{}, errors.New("the spec defines no operations")
+	}
+	result.warnings = s.warnings
+	return result, nil
+}
+
+// openAPIServer is a server of the spec as the base_url it stands for
+type openAPIServer struct {
+	name, url string
+}
+
+func (s *openAPISpec) servers() []openAPIServer {
+	if s.swagger {
+		host := asString(s.doc["host"])
+		if host == "" {
+			return nil
+		}
+		scheme := "https"
+		if schemes := asList(s.doc["schemes"]); len(schemes) > 0 {
+			scheme = asString(schemes[0])
+		}
+		return []openAPIServer{{host, scheme + "://" + host + strings.TrimSuffix(asString(s.doc["basePath"]), "/")}}
+	}
+
+	var out []openAPIServer
+	for _, raw := range asList(s.doc["servers"]) {
+		srv := asMap(raw)
+		u := asString(srv["url"])
+		// Server variables take their defaults
+		vars := asMap(srv["variables"])
+		u = openAPIPathParam.ReplaceAllStringFunc(u, func(m string) string {
+			return asString(asMap(vars[m[1:len(m)-1]])["default"])
+		})
+		if !isURL(u) {
+			if base, err := url.Parse(s.source); err == nil && isURL(s.source) {
+				if ref, err := url.Parse(u); err == nil {
+					u = base.ResolveReference(ref).String()
+				}
+			} else {
+				s.warn("server %q is relative to where the spec is served, set base_url to its full URL", u)
+			}
+		}
+		name := slugify(strings.TrimSpace(asString(srv["description"])))
+		if name == "" {
+			if parsed, err := url.Parse(u); err == nil && parsed.Host != "" {
+				name = parsed.Host
+			} else {
+				name = fmt.Sprintf("server-%d", len(out)+1)
+			}
+		}
+		out = append(out, openAPIServer{name, strings.TrimSuffix(u, "/")})
+	}
+	return out
+}
+
+// request generates the request of an operation
+func (s *openAPISpec) request(path, method string, item, op map[string]interface{}) savedRequest {
+	r := savedRequest{Name: asString(op["summary"]), URL: "{{base_url}}" + openAPIPathParam.ReplaceAllString(path, "{{$1}}")}
+	if r.Name == "" {
+		r.Name = asString(op["operationId"])
+	}
+	if r.Name == "" {
+		r.Name = strings.ToUpper(method) + " " + path
+	}
+	if deprecated, _ := op["deprecated"].(bool); deprecated {
+		r.Name += " (deprecated)"
+	}
+	if tags := asList(op["tags"]); len(tags) > 0 {
+		r.Folder = asString(tags[0])
+	}
+	if method != "get" {
+		r.Method = strings.ToUpper(method)
+	}
+
+	// Operation parameters override those of the path by name and place
+	params := map[string]map[string]interface{}{}
+	var order []string
+	for _, list := range []interface{}{item["parameters"], op["parameters"]} {
+		for _, raw := range asList(list) {
+			p := s.resolve(raw)
+			key := asString(p["in"]) + ":" + asString(p["name"])
+			if params[key] == nil {
+				order = append(order, key)
+			}
+			params[key] = p
+		}
+	}
+	var query, cookies []string
+	var form url.Values
+	for _, key := range order {
+		p := params[key]
+		name, in := asString(p["name"]), asString(p["in"])
+		required, _ := p["required"].(bool)
+		if example := s.parameterExample(p); example != "" && in != "body" {
+			if r.Variables == nil {
+				r.Variables = map[string]string{}
+			}
+			r.Variables[name] = example
+		}
+		switch {
+		case in == "body":
+			r.Body = s.jsonBody(p["schema"], nil)
+			setOpenAPIHeader(&r, "Content-Type", "application/json")
+		case in == "formData":
+			if form == nil {
+				form = url.Values{}
+			}
+			form.Set(name, "{{"+name+"}}")
+		case !required:
+			// Optional parameters are left out
+		case in == "query":
+			query = append(query, url.QueryEscape(name)+"={{"+name+"}}")
+		case in == "header":
+			setOpenAPIHeader(&r, name, "{{"+name+"}}")
+		case in == "cookie":
+			cookies = append(cookies, name+"={{"+name+"}}")
+		}
+	}
+	if len(query) > 0 {
+		r.URL += "?" + strings.Join(query, "&")
+	}
+	if len(cookies) > 0 {
+		setOpenAPIHeader(&r, "Cookie", strings.Join(cookies, "; "))
+	}
+	if form != nil {
+		r.Body = openAPIForm(form)
+		setOpenAPIHeader(&r, "Content-Type", "application/x-www-form-urlencoded")
+	}
+
+	if body := s.resolve(op["requestBody"]); body != nil {
+		s.requestBody(&r, body)
+	}
+	r.Auth = s.auth(op)
+	return r
+}
+
+// requestBody fills in an example body of the first media type lazyhttp
+// can send, JSON preferred
+func (s *openAPISpec) requestBody(r *savedRequest, body map[string]interface{}) {
+	content := asMap(body["content"])
+	types := sortedKeys(content)
+	sort.SliceStable(types, func(i, j int) bool { return openAPIMediaRank(types[i]) < openAPIMediaRank(types[j]) })
+	if len(types) == 0 {
+		return
+	}
+	mediaType := types[0]
+	media := asMap(content[mediaType])
+	var example interface{}
+	if v, ok := media["example"]; ok {
+		example = v
+	} else if examples := asMap(media["examples"]); len(examples) > 0 {
+		example = s.resolve(examples[sortedKeys(examples)[0]])["value"]
+	}
+
+	switch rank := openAPIMediaRank(mediaType); {
+	case rank == 0:
+		r.Body = s.jsonBody(media["schema"], example)
+	case mediaType == "application/x-www-form-urlencoded":
+		if example == nil {
+			example = s.example(media["schema"], nil)
+		}
+		form := url.Values{}
+		for k, v := range asMap(example) {
+			form.Set(k, openAPIScalar(v))
+		}
+		r.Body = openAPIForm(form)
+	case mediaType == "multipart/form-data":
+		s.warn("%s: multipart bodies are not supported, the body was left out", r.Name)
+		return
+	case example != nil:
+		r.Body = openAPIScalar(example)
+	}
+	setOpenAPIHeader(r, "Content-Type", mediaType)
+}
+
+// openAPIMediaRank orders media types by preference for example bodies
+func openAPIMediaRank(mediaType string) int {
+	switch {
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		return 0
+	case mediaType == "application/x-www-form-urlencoded":
+		return 1
+	case strings.HasPrefix(mediaType, "text/") || strings.HasSuffix(mediaType, "xml"):
+		return 2
+	}
+	return 3
+}
+
+// jsonBody renders example, or one generated from schema, as indented JSON
+func (s *openAPISpec) jsonBody(schema, example interface{}) string {
+	if example == nil {
+		example = s.example(schema, nil)
+	}
+	if example == nil {
+		return ""
+	}
+	out, err := json.MarshalIndent(example, "", "  ")
+	if err != nil {
+		return ""
+	}
+	return string(out)
+}
+
+// example makes up a value matching schema: its example, default or first
+// enum value when given, otherwise one by type and format. seen lists the
+// references being expanded, so recursive schemas end.
+func (s *openAPISpec) example(raw interface{}, seen []string) interface{} {
+	if ref, ok := asMap(raw)["$ref"].(string); ok {
+		if containsString(seen, ref) {
+			return nil
+		}
+		seen = append(seen, ref)
+	}
+	schema := s.resolve(raw)
+	if schema == nil || len(seen) > openAPIExampleDepth {
+		return nil
+	}
+	for _, key := range []string{"example", "default"} {
+		if v, ok := schema[key]; ok {
+			return v
+		}
+	}
+	if enum := asList(schema["enum"]); len(enum) > 0 {
+		return enum[0]
+	}
+	if all := asList(schema["allOf"]); len(all) > 0 {
+		merged := map[string]interface{}{}
+		for _, sub := range all {
+			for k, v := range asMap(s.example(sub, seen)) {
+				merged[k] = v
+			}
+		}
+		return merged
+	}
+	for _, key := range []string{"oneOf", "anyOf"} {
+		if options := asList(schema[key]); len(options) > 0 {
+			return s.example(options[0], seen)
+		}
+	}
+
+	typ := asString(schema["type"])
+	if types := asList(schema["type"]); len(types) > 0 {
+		// OpenAPI 3.1 lists types, e.g. ["string", "null"]
+		typ = asString(types[0])
+	}
+	switch {
+	case typ == "object" || typ == "" && schema["properties"] != nil:
+		obj := map[string]interface{}{}
+		for name, prop := range asMap(schema["properties"]) {
+			if v := s.example(prop, seen); v != nil {
+				obj[name] = v
+			}
+		}
+		return obj
+	case typ == "array":
+		if item := s.example(schema["items"], seen); item != nil {
+			return []interface{}{item}
+		}
+		return []interface{}{}
+	case typ == "integer":
+		return 0
+	case typ == "number":
+		return 0.0
+	case typ == "boolean":
+		return false
+	case typ == "string":
+		switch asString(schema["format"]) {
+		case "date-time":
+			return "2024-01-01T00:00:00Z"
+		case "date":
+			return "2024-01-01"
+		case "uuid":
+			return "00000000-0000-0000-0000-000000000000"
+		case "email":
+			return "user@example.com"
+		case "uri", "url":
+			return "https://example.com"
+		}
+		return "string"
+	}
+	return nil
+}
+
+// parameterExample is the example or default value of a parameter, "" if
+// it has none
+func (s *openAPISpec) parameterExample(p map[string]interface{}) string {
+	for _, holder := range []map[string]interface{}{p, s.resolve(p["schema"])} {
+		for _, key := range []string{"example", "default"} {
+			if v, ok := holder[key]; ok {
+				return openAPIScalar(v)
+			}
+		}
+	}
+	return ""
+}
+
+// auth maps the first security scheme required by an operation, or the
+// spec's default, to placeholders for its credentials
+func (s *openAPISpec) auth(op map[string]interface{}) *requestAuth {
+	security, ok := op["security"]
+	if !ok {
+		security = s.doc["security"]
+	}
+	requirements := asList(security)
+	if len(requirements) == 0 {
+		return nil
+	}
+	names := sortedKeys(asMap(requirements[0]))
+	if len(names) == 0 {
+		return nil
+	}
+	schemes := asMap(asMap(s.doc["components"])["securitySchemes"])
+	if s.swagger {
+		schemes = asMap(s.doc["securityDefinitions"])
+	}
+	scheme := s.resolve(schemes[names[0]])
+	switch typ := asString(scheme["type"]); {
+	case typ == "basic" || typ == "http" && strings.EqualFold(asString(scheme["scheme"]), "basic"):
+		return &requestAuth{Type: "basic", Username: "{{username}}", Password: "{{password}}"}
+	case typ == "http" && strings.EqualFold(asString(scheme["scheme"]), "bearer"):
+		return &requestAuth{Type: "bearer", Token: "{{token}}"}
+	case typ == "oauth2" || typ == "openIdConnect":
+		return &requestAuth{Type: "bearer", Token: "{{access_token}}"}
+	case typ == "apiKey":
+		in := asString(scheme["in"])
+		if in == "cookie" {
+			s.warn("API key %q is sent as a cookie, which lazyhttp auth can't do; it is sent as a header instead", asString(scheme["name"]))
+		}
+		if in != "query" {
+			in = "header"
+		}
+		return &requestAuth{Type: "apikey", Key: asString(scheme["name"]), Value: "{{api_key}}", In: in}
+	default:
+		s.warn("security scheme %q (%s) is not supported and was left out", names[0], typ)
+		return nil
+	}
+}
+
+// resolve follows $ref pointers within the document. External references
+// aren't followed and resolve to nil.
+func (s *openAPISpec) resolve(v interface{}) map[string]interface{} {
+	m := asMap(v)
+	for hops := 0; m != nil && hops < 32; hops++ {
+		ref, ok := m["$ref"].(string)
+		if !ok {
+			return m
+		}
+		if !strings.HasPrefix(ref, "#/") {
+			s.warn("external reference %s is not supported and was left out", ref)
+			return nil
+		}
+		var target interface{} = s.doc
+		for _, part := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+			part = strings.ReplaceAll(strings.ReplaceAll(part, "~1", "/"), "~0", "~")
+			target = asMap(target)[part]
+		}
+		if target == nil {
+			s.warn("reference %s points nowhere", ref)
+		}
+		m = asMap(target)
+	}
+	return m
+}
+
+func setOpenAPIHeader(r *savedRequest, name, value string) {
+	if r.Headers == nil {
+		r.Headers = map[string]string{}
+	}
+	setHeaderFold(r.Headers, name, value)
+}
+
+// openAPIForm encodes form fields without escaping their placeholders
+func openAPIForm(form url.Values) string {
+	var fields []string
+	for _, name := range sortedKeys(form) {
+		value := form.Get(name)
+		if !templatePattern.MatchString(value) {
+			value = formEncode(value)
+		}
+		fields = append(fields, formEncode(name)+"="+value)
+	}
+	return strings.Join(fields, "&")
+}
+
+// openAPIScalar renders an example value as text, JSON for structures
+func openAPIScalar(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case nil:
+		return ""
+	case map[string]interface{}, []interface{}:
+		out, _ := json.Marshal(v)
+		return string(out)
+	}
+	return fmt.Sprint(v)
+}
+
+// openAPINormalize turns the maps YAML decodes with non-string keys, like
+// unquoted status codes, into maps keyed by strings as in JSON
+func openAPINormalize(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, item := range v {
+			v[k] = openAPINormalize(item)
+		}
+		return v
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			m[fmt.Sprint(k)] = openAPINormalize(item)
+		}
+		return m
+	case []interface{}:
+		for i, item := range v {
+			v[i] = openAPINormalize(item)
+		}
+	}
+	return v
+}
+
+func asMap(v interface{}) map[string]interface{} {
+	m, _ := v.(map[string]interface{})
+	return m
+}
+
+func asList(v interface{}) []interface{} {
+	l, _ := v.([]interface{})
+	return l
+}
+
+func asString(v interface{}) string {
+	s, _ := v.(string)
+	return s
+}
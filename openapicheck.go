@@ -0,0 +1,403 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// specsDir holds the OpenAPI specs collections were imported from, as
+// JSON named after their collection, to check responses against
+const specsDir = "specs"
+
+// maxSpecViolations bounds the violations reported for one response
+const maxSpecViolations = 50
+
+// openAPIRef ties a saved request to the operation of an imported spec
+type openAPIRef struct {
+	Spec      string `json:"spec"`      // file in specsDir
+	Operation string `json:"operation"` // e.g. "GET /pets/{petId}"
+}
+
+// saveOpenAPISpec keeps the spec of the collection named name in the
+// workspace and returns its file name
+func saveOpenAPISpec(name string, doc map[string]interface{}) (string, error) {
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	file := slugify(name) + ".json"
+	dir := filepath.Join(workspaceDir(), specsDir)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", err
+	}
+	return file, os.WriteFile(filepath.Join(dir, file), append(data, '\n'), 0o600)
+}
+
+// specCache keeps the specs read for checking responses, by path, until
+// their file changes
+var specCache = struct {
+	sync.Mutex
+	specs map[string]cachedSpec
+}{specs: map[string]cachedSpec{}}
+
+type cachedSpec struct {
+	modTime time.Time
+	spec    *openAPISpec
+}
+
+// loadOpenAPISpec reads a spec kept in the workspace
+func loadOpenAPISpec(file string) (*openAPISpec, error) {
+	path := filepath.Join(workspaceDir(), specsDir, file)
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	specCache.Lock()
+	defer specCache.Unlock()
+	if c, ok := specCache.specs[path]; ok && c.modTime.Equal(info.ModTime()) {
+		return c.spec, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	s := &openAPISpec{doc: doc, source: file, swagger: asString(doc["swagger"]) == "2.0"}
+	specCache.specs[path] = cachedSpec{info.ModTime(), s}
+	return s, nil
+}
+
+// checkOpenAPIResponse checks a response against the operation the
+// request was generated from and describes what the spec doesn't allow
+func checkOpenAPIResponse(ref *openAPIRef, resp *fetchMsg) []string {
+	s, err := loadOpenAPISpec(ref.Spec)
+	if err != nil {
+		return []string{"spec unavailable: " + err.Error()}
+	}
+	// A copy collects its own warnings, the cached spec being shared
+	check := *s
+	check.warnings = nil
+	return check.checkResponse(ref.Operation, resp)
+}
+
+// checkResponse validates the status, headers and body of a response to
+// operation, "METHOD /path" as in openAPIRef
+func (s *openAPISpec) checkResponse(operation string, resp *fetchMsg) []string {
+	method, path, _ := strings.Cut(operation, " ")
+	op := asMap(s.resolve(asMap(s.doc["paths"])[path])[strings.ToLower(method)])
+	if op == nil {
+		return []string{fmt.Sprintf("operation %s is not in the spec anymore", operation)}
+	}
+	responses := asMap(op["responses"])
+	code := strconv.Itoa(resp.statusCode)
+	spec := responses[code]
+	if spec == nil {
+		spec = responses[code[:1]+"XX"]
+	}
+	if spec == nil {
+		spec = responses["default"]
+	}
+	if spec == nil {
+		return []string{fmt.Sprintf("status %d is not documented, expected %s", resp.statusCode, strings.Join(sortedKeys(responses), ", "))}
+	}
+	r := s.resolve(spec)
+
+	c := &specCheck{spec: s}
+	for _, name := range sortedKeys(asMap(r["headers"])) {
+		h := s.resolve(asMap(r["headers"])[name])
+		values := resp.header.Values(name)
+		if len(values) == 0 {
+			if required, _ := h["required"].(bool); required {
+				c.fail("header %s is missing", http.CanonicalHeaderKey(name))
+			}
+			continue
+		}
+		schema := h["schema"]
+		if s.swagger {
+			schema = h
+		}
+		c.value(schema, headerScalar(s.resolve(schema), values[0]), "header "+http.CanonicalHeaderKey(name))
+	}
+
+	contentType := resp.header.Get("Content-Type")
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	var schema interface{}
+	if s.swagger {
+		schema = r["schema"]
+	} else if content := asMap(r["content"]); len(content) > 0 {
+		media, ok := specMedia(content, mediaType)
+		if !ok {
+			c.fail("content type %q is not documented, expected %s", contentType, strings.Join(sortedKeys(content), ", "))
+			return c.violations
+		}
+		schema = asMap(media)["schema"]
+	}
+	if schema == nil || len(resp.body) == 0 && resp.statusCode == http.StatusNoContent {
+		return c.violations
+	}
+	if !strings.Contains(mediaType, "json") {
+		return c.violations
+	}
+	var body interface{}
+	if err := json.Unmarshal(resp.body, &body); err != nil {
+		c.fail("body is not valid JSON: %v", err)
+		return c.violations
+	}
+	c.value(schema, body, "body")
+	return c.violations
+}
+
+// specMedia picks the documented media type matching a response's, with
+// wildcards like application/* and */*
+func specMedia(content map[string]interface{}, mediaType string) (interface{}, bool) {
+	if media, ok := content[mediaType]; ok {
+		return media, true
+	}
+	major, _, _ := strings.Cut(mediaType, "/")
+	for _, pattern := range []string{major + "/*", "*/*"} {
+		if media, ok := content[pattern]; ok {
+			return media, true
+		}
+	}
+	return nil, false
+}
+
+// headerScalar converts a header value to the type its schema expects,
+// leaving it a string when it doesn't parse
+func headerScalar(schema map[string]interface{}, value string) interface{} {
+	switch asString(schema["type"]) {
+	case "integer", "number":
+		if n, err := strconv.ParseFloat(value, 64); err == nil {
+			return n
+		}
+	case "boolean":
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b
+		}
+	}
+	return value
+}
+
+// specCheck collects the violations of a response
+type specCheck struct {
+	spec       *openAPISpec
+	violations []string
+}
+
+func (c *specCheck) fail(format string, a ...interface{}) {
+	if len(c.violations) < maxSpecViolations {
+		c.violations = append(c.violations, fmt.Sprintf(format, a...))
+	} else if len(c.violations) == maxSpecViolations {
+		c.violations = append(c.violations, "… and more")
+	}
+}
+
+// value validates v, found at path, against a JSON schema of the spec:
+// types, nullability, enums, required and additional properties, items,
+// bounds, lengths, patterns and the allOf/anyOf/oneOf combinators
+func (c *specCheck) value(raw interface{}, v interface{}, path string) {
+	schema := c.spec.resolve(raw)
+	if schema == nil {
+		return
+	}
+	for _, sub := range asList(schema["allOf"]) {
+		c.value(sub, v, path)
+	}
+	for _, key := range []string{"anyOf", "oneOf"} {
+		alternatives := asList(schema[key])
+		if len(alternatives) == 0 {
+			continue
+		}
+		matched := 0
+		for _, sub := range alternatives {
+			probe := &specCheck{spec: c.spec}
+			probe.value(sub, v, path)
+			if len(probe.violations) == 0 {
+				matched++
+			}
+		}
+		if matched == 0 {
+			c.fail("%s matches none of the schemas of %s", path, key)
+		} else if key == "oneOf" && matched > 1 {
+			c.fail("%s matches %d schemas of oneOf, expected exactly one", path, matched)
+		}
+	}
+
+	if v == nil {
+		nullable, _ := schema["nullable"].(bool)
+		nullable = nullable || schemaAllows(schema, "null") || schema["type"] == nil
+		if !nullable {
+			c.fail("%s is null, expected %s", path, schemaTypes(schema))
+		}
+		return
+	}
+	if enum := asList(schema["enum"]); len(enum) > 0 && !specEnumContains(enum, v) {
+		c.fail("%s is %s, expected one of %s", path, specJSON(v), specJSON(enum))
+	}
+	if schema["type"] != nil && !schemaAllows(schema, jsonTypeOf(v)) &&
+		!(jsonTypeOf(v) == "integer" && schemaAllows(schema, "number")) {
+		c.fail("%s is %s, expected %s", path, jsonTypeOf(v), schemaTypes(schema))
+		return
+	}
+
+	switch v := v.(type) {
+	case map[string]interface{}:
+		properties := asMap(schema["properties"])
+		for _, name := range asList(schema["required"]) {
+			if _, ok := v[asString(name)]; !ok {
+				c.fail("%s is missing required property %s", path, asString(name))
+			}
+		}
+		for _, name := range sortedKeys(v) {
+			if prop, ok := properties[name]; ok {
+				c.value(prop, v[name], path+"."+name)
+				continue
+			}
+			switch extra := schema["additionalProperties"].(type) {
+			case bool:
+				if !extra {
+					c.fail("%s has undocumented property %s", path, name)
+				}
+			case map[string]interface{}:
+				c.value(extra, v[name], path+"."+name)
+			}
+		}
+	case []interface{}:
+		if n, ok := specNumber(schema["minItems"]); ok && float64(len(v)) < n {
+			c.fail("%s has %d items, expected at least %v", path, len(v), n)
+		}
+		if n, ok := specNumber(schema["maxItems"]); ok && float64(len(v)) > n {
+			c.fail("%s has %d items, expected at most %v", path, len(v), n)
+		}
+		if items := schema["items"]; items != nil {
+			for i, item := range v {
+				c.value(items, item, fmt.Sprintf("%s.%d", path, i))
+			}
+		}
+	case string:
+		length := float64(len([]rune(v)))
+		if n, ok := specNumber(schema["minLength"]); ok && length < n {
+			c.fail("%s is shorter than %v characters", path, n)
+		}
+		if n, ok := specNumber(schema["maxLength"]); ok && length > n {
+			c.fail("%s is longer than %v characters", path, n)
+		}
+		if pattern := asString(schema["pattern"]); pattern != "" {
+			if re, err := regexp.Compile(pattern); err == nil && !re.MatchString(v) {
+				c.fail("%s %q doesn't match %s", path, v, pattern)
+			}
+		}
+	case float64:
+		if n, ok := specNumber(schema["minimum"]); ok && v < n {
+			c.fail("%s is %v, expected at least %v", path, v, n)
+		}
+		if n, ok := specNumber(schema["maximum"]); ok && v > n {
+			c.fail("%s is %v, expected at most %v", path, v, n)
+		}
+	}
+}
+
+// schemaAllows tells whether the type of a schema, a name or a list of
+// names in OpenAPI 3.1, includes typ
+func schemaAllows(schema map[string]interface{}, typ string) bool {
+	switch t := schema["type"].(type) {
+	case string:
+		return t == typ
+	case []interface{}:
+		for _, name := range t {
+			if name == typ {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func schemaTypes(schema map[string]interface{}) string {
+	if types := asList(schema["type"]); len(types) > 0 {
+		names := make([]string, len(types))
+		for i, t := range types {
+			names[i] = asString(t)
+		}
+		return strings.Join(names, " or ")
+	}
+	return asString(schema["type"])
+}
+
+// jsonTypeOf names the JSON schema type of a decoded value
+func jsonTypeOf(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		if v == math.Trunc(v) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	}
+	return "object"
+}
+
+func specNumber(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case int:
+		return float64(v), true
+	}
+	return 0, false
+}
+
+func specEnumContains(enum []interface{}, v interface{}) bool {
+	for _, e := range enum {
+		if specJSON(e) == specJSON(v) {
+			return true
+		}
+	}
+	return false
+}
+
+func specJSON(v interface{}) string {
+	out, _ := json.Marshal(v)
+	return string(out)
+}
+
+// renderSpecViolations lists what a response breaks of its spec above it
+func renderSpecViolations(violations []string) string {
+	if len(violations) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	summary := fmt.Sprintf("%d violations of the spec", len(violations))
+	if len(violations) == 1 {
+		summary = "1 violation of the spec"
+	}
+	fmt.Fprintf(&sb, "%s %s\n", headerStyle.Render("OpenAPI:"), errorStyle.Render(summary))
+	for _, v := range violations {
+		sb.WriteString(lipgloss.NewStyle().Foreground(lipgloss.Color("#E06C75")).Render("  " + v))
+		sb.WriteString("\n")
+	}
+	sb.WriteString("\n")
+	return sb.String()
+}
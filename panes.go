@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// layoutFile keeps the pane sizes chosen in the workspace, since what
+// suits a wide monitor doesn't suit a laptop terminal
+const layoutFile = "layout.json"
+
+// Bounds and steps of resizing
+const (
+	minSidebarWidth    = 20
+	minSummaryPercent  = 15
+	maxSummaryPercent  = 70
+	minEditorHeight    = 3
+	maxEditorHeight    = 40
+	sidebarWidthStep   = 2
+	summaryPercentStep = 5
+)
+
+// paneLayout holds the pane sizes changed from their defaults, zero
+// meaning the default
+type paneLayout struct {
+	// SidebarWidth is the width of the collections sidebar, border
+	// included
+	SidebarWidth int `json:"sidebar_width,omitempty"`
+
+	// SummaryPercent is the share of the summary pane in the width beside
+	// the sidebar
+	SummaryPercent int `json:"summary_percent,omitempty"`
+
+	// EditorHeight is the number of rows of the request editors of the
+	// lab, GraphQL and gRPC modes, the response getting the rest
+	EditorHeight int `json:"editor_height,omitempty"`
+}
+
+func (l paneLayout) sidebarWidth() int {
+	if l.SidebarWidth == 0 {
+		return sidebarWidth
+	}
+	return l.SidebarWidth
+}
+
+func (l paneLayout) summaryPercent() int {
+	if l.SummaryPercent == 0 {
+		return 33
+	}
+	return l.SummaryPercent
+}
+
+// editorHeight is the height of a request editor whose default is def
+func (l paneLayout) editorHeight(def int) int {
+	if l.EditorHeight == 0 {
+		return def
+	}
+	return l.EditorHeight
+}
+
+// loadLayout reads the pane sizes of the workspace
+func loadLayout() (paneLayout, error) {
+	var l paneLayout
+	path, err := workspaceFile(layoutFile)
+	if err != nil {
+		return l, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return l, nil
+	}
+	if err != nil {
+		return l, err
+	}
+	if err := json.Unmarshal(data, &l); err != nil {
+		return paneLayout{}, fmt.Errorf("%s: %w", layoutFile, err)
+	}
+	return l, nil
+}
+
+// saveLayout writes the pane sizes of the workspace; a no-op in incognito
+// sessions, whose changes last until they end
+func saveLayout(l paneLayout) error {
+	if incognito {
+		return nil
+	}
+	path, err := workspaceFile(layoutFile)
+	if err != nil {
+		return err
+	}
+	if l == (paneLayout{}) {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	data, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o600)
+}
+
+// resizePanes handles the resizing keys, in every mode: Alt+H and Alt+L
+// move the edge of the sidebar, or of the summary pane when the sidebar
+// is closed, Alt+K and Alt+J the edge between the request editor of the
+// lab, GraphQL and gRPC modes and the response, and Alt+0 restores the default
+// sizes. It reports whether the key was one of them.
+func (m model) resizePanes(msg tea.KeyMsg) (model, bool) {
+	l := m.panes
+	switch msg.String() {
+	case "alt+h", "alt+l":
+		step := 1
+		if msg.String() == "alt+h" {
+			step = -1
+		}
+		switch {
+		case m.sidebar.open && m.mode == modeHTTP:
+			width := l.sidebarWidth() + step*sidebarWidthStep
+			l.SidebarWidth = min(max(width, minSidebarWidth), max(m.width/2, minSidebarWidth))
+		case m.summary != nil && m.mode == modeHTTP:
+			// The summary pane is on the right, moving its edge left
+			// widens it
+			percent := l.summaryPercent() - step*summaryPercentStep
+			l.SummaryPercent = min(max(percent, minSummaryPercent), maxSummaryPercent)
+		default:
+			m.notice = "Alt+H/L resize the collections sidebar (Ctrl+B) or the summary pane (Ctrl+J)"
+			return m, true
+		}
+	case "alt+k", "alt+j":
+		if m.mode != modeLab && m.mode != modeGraphQL && m.mode != modeGRPC {
+			m.notice = "Alt+K/J resize the request editor of the request lab, the GraphQL editor and the gRPC mode"
+			return m, true
+		}
+		def := labEditorHeight
+		switch m.mode {
+		case modeGraphQL:
+			def = graphqlQueryHeight
+		case modeGRPC:
+			def = grpcRequestHeight
+		}
+		height := l.editorHeight(def) + 1
+		if msg.String() == "alt+k" {
+			height -= 2
+		}
+		l.EditorHeight = min(max(height, minEditorHeight), maxEditorHeight)
+	case "alt+0":
+		l = paneLayout{}
+	default:
+		return m, false
+	}
+
+	m.panes = l
+	if err := saveLayout(l); err != nil {
+		m.notice = errorStyle.Render("Saving the layout failed: " + err.Error())
+	}
+	m = m.layout()
+	m.viewport.SetContent(m.response)
+	return m, true
+}
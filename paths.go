@@ -0,0 +1,79 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// dataDir is where lazyhttp keeps its state, following the XDG base
+// directory spec: $XDG_DATA_HOME/lazyhttp or ~/.local/share/lazyhttp
+func dataDir() string {
+	if dir := os.Getenv("XDG_DATA_HOME"); dir != "" {
+		return filepath.Join(dir, "lazyhttp")
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		return filepath.Join(home, ".local", "share", "lazyhttp")
+	}
+	return ".lazyhttp"
+}
+
+// dataFile returns the path of a state file, creating the data directory
+func dataFile(name string) (string, error) {
+	dir := dataDir()
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, name), nil
+}
+
+// workspaceDir is where the current workspace keeps its collections,
+// history and schemas. The default workspace uses the data directory
+// itself so state from before workspaces existed stays where it was, and
+// a project workspace is the project's .lazyhttp directory.
+func workspaceDir() string {
+	if currentWorkspace == defaultWorkspace {
+		return dataDir()
+	}
+	if isProjectWorkspace(currentWorkspace) {
+		return projectWorkspace
+	}
+	if isRemoteWorkspace(currentWorkspace) {
+		return remoteWorkspace
+	}
+	return filepath.Join(dataDir(), workspacesDir, slugify(currentWorkspace))
+}
+
+// workspaceStateDir is where the current workspace keeps what lazyhttp
+// records locally, like history and schemas. That's the workspace
+// directory except for remote workspaces, whose content is replaced on
+// every fetch.
+func workspaceStateDir() string {
+	if isRemoteWorkspace(currentWorkspace) {
+		return remoteState
+	}
+	return workspaceDir()
+}
+
+// workspaceFile returns the path of a state file of the current workspace,
+// creating its directory
+func workspaceFile(name string) (string, error) {
+	dir := workspaceStateDir()
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, name), nil
+}
+
+// slugify turns a name into something safe to use as a file name
+func slugify(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '-', r == '_':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r + 'a' - 'A'
+		}
+		return '-'
+	}, name)
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// pinUsage is the help of -pin
+const pinUsage = "pin a `host=pin` to a certificate, by the SHA-256 fingerprint the certificate view shows, or to a public key as sha256//BASE64 of its SPKI (repeatable)"
+
+// pinsFile holds the pins of a workspace by host, e.g.
+//
+//	{"api.example.com": ["sha256//YLh1dUR9y6Kja30RrAn7JKnbQG/uEtLMkBgFF2Fuihg="]}
+const pinsFile = "pins.json"
+
+// flagPins are the pins given with -pin, by host
+var flagPins = map[string][]string{}
+
+// parsePinFlag adds a pin given as host=pin to -pin
+func parsePinFlag(s string) error {
+	host, pin, ok := strings.Cut(s, "=")
+	host = strings.ToLower(strings.TrimSpace(host))
+	if !ok || host == "" {
+		return fmt.Errorf("%q is not host=pin", s)
+	}
+	if net.ParseIP(strings.Trim(host, "[]")) != nil {
+		return fmt.Errorf("%s: IP addresses can't be pinned, TLS doesn't name them to the server", host)
+	}
+	pin = strings.TrimSpace(pin)
+	if _, err := parsePin(pin); err != nil {
+		return err
+	}
+	flagPins[host] = append(flagPins[host], pin)
+	return nil
+}
+
+// certPin is a parsed pin: a hash of a certificate's public key or of the
+// whole certificate
+type certPin struct {
+	spki bool
+	hash []byte
+}
+
+// parsePin reads a pin: sha256//BASE64 for a public key, as curl's
+// --pinnedpubkey takes them, or the hex SHA-256 fingerprint of a
+// certificate, colons allowed
+func parsePin(pin string) (certPin, error) {
+	if b64, ok := strings.CutPrefix(pin, "sha256//"); ok {
+		hash, err := base64.StdEncoding.DecodeString(b64)
+		if err != nil || len(hash) != sha256.Size {
+			return certPin{}, fmt.Errorf("%s is not a base64 SHA-256 hash", pin)
+		}
+		return certPin{spki: true, hash: hash}, nil
+	}
+	hash, err := hex.DecodeString(strings.ReplaceAll(pin, ":", ""))
+	if err != nil || len(hash) != sha256.Size {
+		return certPin{}, fmt.Errorf("%s is neither sha256//BASE64 nor a hex SHA-256 fingerprint", pin)
+	}
+	return certPin{hash: hash}, nil
+}
+
+// matches tells whether the pin is for cert
+func (p certPin) matches(cert *x509.Certificate) bool {
+	sum := sha256.Sum256(cert.Raw)
+	if p.spki {
+		sum = sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	}
+	return string(sum[:]) == string(p.hash)
+}
+
+// spkiPin is the public key pin of a certificate, as -pin takes it
+func spkiPin(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return "sha256//" + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// loadWorkspacePins reads the pins of the current workspace, nil when it
+// has none. The file is read for each connection, so edits apply to the
+// next one.
+func loadWorkspacePins() (map[string][]string, error) {
+	data, err := os.ReadFile(filepath.Join(workspaceDir(), pinsFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var pins map[string][]string
+	if err := json.Unmarshal(data, &pins); err != nil {
+		return nil, fmt.Errorf("%s: %w", pinsFile, err)
+	}
+	return pins, nil
+}
+
+// pinsFor are the pins of a host, from -pin and the workspace. A host is
+// also pinned by a "*.example.com" entry of its parent domain.
+func pinsFor(host string) ([]string, error) {
+	host = strings.ToLower(host)
+	workspace, err := loadWorkspacePins()
+	if err != nil {
+		return nil, err
+	}
+	var pins []string
+	for _, all := range []map[string][]string{flagPins, workspace} {
+		for pattern, list := range all {
+			pattern = strings.ToLower(pattern)
+			if pattern == host || strings.HasPrefix(pattern, "*.") && strings.HasSuffix(host, pattern[1:]) {
+				pins = append(pins, list...)
+			}
+		}
+	}
+	return pins, nil
+}
+
+// pinMismatchError is a server presenting no certificate its host is
+// pinned to
+type pinMismatchError struct {
+	host      string
+	expected  []string
+	presented []*x509.Certificate
+}
+
+func (e *pinMismatchError) Error() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "certificate pin mismatch for %s, the certificate was replaced or a proxy is intercepting the connection:", e.host)
+	for _, pin := range e.expected {
+		fmt.Fprintf(&sb, "\n  − %s (pinned)", pin)
+	}
+	for i, cert := range e.presented {
+		role := "presented"
+		if i == 0 {
+			role = "presented leaf"
+		}
+		sum := sha256.Sum256(cert.Raw)
+		fmt.Fprintf(&sb, "\n  + %s or %s (%s, %s)", spkiPin(cert), hex.EncodeToString(sum[:]), role, cert.Subject.String())
+	}
+	return sb.String()
+}
+
+// verifyPins fails a connection whose server presents no certificate its
+// host is pinned to. It runs after the usual verification, and also with
+// -insecure, so a self-signed certificate can be trusted by its pin.
+func verifyPins(cs tls.ConnectionState) error {
+	// TLS names no IP addresses, which can't be pinned
+	if cs.ServerName == "" {
+		return nil
+	}
+	pins, err := pinsFor(cs.ServerName)
+	if err != nil || len(pins) == 0 {
+		return err
+	}
+	for _, s := range pins {
+		pin, err := parsePin(s)
+		if err != nil {
+			return fmt.Errorf("pin of %s: %w", cs.ServerName, err)
+		}
+		for _, cert := range pinnableCertificates(cs) {
+			if pin.matches(cert) {
+				return nil
+			}
+		}
+	}
+	return &pinMismatchError{host: cs.ServerName, expected: pins, presented: cs.PeerCertificates}
+}
+
+// pinnableCertificates are the certificates of a connection a pin may
+// match. Anyone can send a copy of the real certificates along with their
+// own, so only the chains that verified count, and without verification
+// (-insecure) only the leaf, whose key the server proved it holds.
+func pinnableCertificates(cs tls.ConnectionState) []*x509.Certificate {
+	if len(cs.VerifiedChains) == 0 {
+		if len(cs.PeerCertificates) == 0 {
+			return nil
+		}
+		return cs.PeerCertificates[:1]
+	}
+	var certs []*x509.Certificate
+	for _, chain := range cs.VerifiedChains {
+		certs = append(certs, chain...)
+	}
+	return certs
+}
+
+// pinnedBy is the pin of host that cert matches, "" for none
+func pinnedBy(host string, cert *x509.Certificate) string {
+	pins, _ := pinsFor(host)
+	for _, s := range pins {
+		if pin, err := parsePin(s); err == nil && pin.matches(cert) {
+			return s
+		}
+	}
+	return ""
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// serverPolicy is the policy loaded with -egress-policy, nil when none
+var serverPolicy *egressPolicy
+
+// outboundPolicy also holds the requests lazyhttp sends to a policy. It is
+// set by -egress-policy, of the TUI and of `lazyhttp serve`, whose API lets
+// other programs trigger requests.
+var outboundPolicy *egressPolicy
+
+// egressPolicy restricts what lazyhttp's server modes (listeners, proxies,
+// mock servers) may connect to and how much they accept, so they can run
+// on shared hosts without becoming an SSRF pivot. Deny rules always win;
+// when an allow list is non-empty a target must match it.
+type egressPolicy struct {
+	AllowHosts []string `json:"allow_hosts"` // exact names or "*.example.com"
+	DenyHosts  []string `json:"deny_hosts"`
+	AllowCIDRs []string `json:"allow_cidrs"`
+	DenyCIDRs  []string `json:"deny_cidrs"`
+	AllowPorts []int    `json:"allow_ports"`
+	DenyPorts  []int    `json:"deny_ports"`
+
+	// BlockPrivate rejects loopback, private, link-local (including cloud
+	// metadata endpoints) and unspecified addresses
+	BlockPrivate bool `json:"block_private"`
+
+	// MaxRequestBytes caps incoming request bodies, 0 means unlimited
+	MaxRequestBytes int64 `json:"max_request_bytes"`
+
+	allowNets []*net.IPNet
+	denyNets  []*net.IPNet
+}
+
+// loadEgressPolicy reads and validates a JSON policy file
+func loadEgressPolicy(path string) (*egressPolicy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var p egressPolicy
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := p.compile(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &p, nil
+}
+
+func (p *egressPolicy) compile() error {
+	parse := func(cidrs []string) ([]*net.IPNet, error) {
+		var nets []*net.IPNet
+		for _, c := range cidrs {
+			// Bare addresses are accepted as single-host networks
+			if !strings.Contains(c, "/") {
+				if strings.Contains(c, ":") {
+					c += "/128"
+				} else {
+					c += "/32"
+				}
+			}
+			_, n, err := net.ParseCIDR(c)
+			if err != nil {
+				return nil, err
+			}
+			nets = append(nets, n)
+		}
+		return nets, nil
+	}
+
+	var err error
+	if p.allowNets, err = parse(p.AllowCIDRs); err != nil {
+		return err
+	}
+	p.denyNets, err = parse(p.DenyCIDRs)
+	return err
+}
+
+// matchHost compares a host name against exact and "*.domain" patterns
+func matchHost(patterns []string, host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, p := range patterns {
+		p = strings.ToLower(p)
+		if p == host || (strings.HasPrefix(p, "*.") && strings.HasSuffix(host, p[1:])) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsPort(ports []int, port int) bool {
+	for _, p := range ports {
+		if p == port {
+			return true
+		}
+	}
+	return false
+}
+
+// checkHost applies the name and port rules before anything is resolved
+func (p *egressPolicy) checkHost(host string, port int) error {
+	if p == nil {
+		return nil
+	}
+	if matchHost(p.DenyHosts, host) {
+		return fmt.Errorf("egress policy denies host %s", host)
+	}
+	if len(p.AllowHosts) > 0 && net.ParseIP(host) == nil && !matchHost(p.AllowHosts, host) {
+		return fmt.Errorf("egress policy does not allow host %s", host)
+	}
+	if containsPort(p.DenyPorts, port) {
+		return fmt.Errorf("egress policy denies port %d", port)
+	}
+	if len(p.AllowPorts) > 0 && !containsPort(p.AllowPorts, port) {
+		return fmt.Errorf("egress policy does not allow port %d", port)
+	}
+	return nil
+}
+
+// checkURL applies the name and port rules to the host a URL names
+func (p *egressPolicy) checkURL(u *url.URL) error {
+	_, portStr, err := net.SplitHostPort(requestAddr(u))
+	if err != nil {
+		return err
+	}
+	port, _ := strconv.Atoi(portStr)
+	return p.checkHost(u.Hostname(), port)
+}
+
+// policyTransport refuses requests for hosts and ports the outbound policy
+// rules out, before a proxy or resolver sees the name; dialControl vets
+// the addresses the rest resolve to
+type policyTransport struct {
+	policy *egressPolicy
+	base   http.RoundTripper
+}
+
+func (t policyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.policy.checkURL(req.URL); err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+	return t.base.RoundTrip(req)
+}
+
+// checkIP applies the address rules to a resolved IP
+func (p *egressPolicy) checkIP(ip net.IP) error {
+	if p == nil {
+		return nil
+	}
+	for _, n := range p.denyNets {
+		if n.Contains(ip) {
+			return fmt.Errorf("egress policy denies address %s (%s)", ip, n)
+		}
+	}
+	if p.BlockPrivate && (ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsUnspecified()) {
+		return fmt.Errorf("egress policy blocks private address %s", ip)
+	}
+	if len(p.allowNets) > 0 {
+		for _, n := range p.allowNets {
+			if n.Contains(ip) {
+				return nil
+			}
+		}
+		return fmt.Errorf("egress policy does not allow address %s", ip)
+	}
+	return nil
+}
+
+// dialControl is a net.Dialer Control hook enforcing the policy on the
+// address actually being dialed, after DNS resolution, which also defeats
+// DNS rebinding tricks
+func (p *egressPolicy) dialControl(network, address string, _ syscall.RawConn) error {
+	host, portStr, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	port, _ := strconv.Atoi(portStr)
+	if containsPort(p.DenyPorts, port) || (len(p.AllowPorts) > 0 && !containsPort(p.AllowPorts, port)) {
+		return fmt.Errorf("egress policy does not allow port %d", port)
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return fmt.Errorf("egress policy: unresolved address %s", address)
+	}
+	return p.checkIP(ip)
+}
+
+// dialer returns a dialer that refuses connections the policy forbids
+func (p *egressPolicy) dialer() *net.Dialer {
+	d := &net.Dialer{}
+	if p != nil {
+		d.Control = p.dialControl
+	}
+	return d
+}
+
+// limitRequests wraps a server handler so oversized request bodies are
+// rejected with 413 instead of being buffered
+func (p *egressPolicy) limitRequests(next http.Handler) http.Handler {
+	if p == nil || p.MaxRequestBytes <= 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ContentLength > p.MaxRequestBytes {
+			http.Error(w, "request body exceeds the configured limit", http.StatusRequestEntityTooLarge)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, p.MaxRequestBytes)
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,623 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// postmanCollection is the part of a Postman v2.0/v2.1 collection lazyhttp
+// understands, see https://schema.postman.com
+type postmanCollection struct {
+	Info struct {
+		Name   string `json:"name"`
+		Schema string `json:"schema"`
+	} `json:"info"`
+	Item     []postmanItem     `json:"item"`
+	Variable []postmanKeyValue `json:"variable"`
+	Auth     *postmanAuth      `json:"auth"`
+	Event    []json.RawMessage `json:"event"`
+}
+
+// postmanItem is a folder when it has items of its own, a request
+// otherwise
+type postmanItem struct {
+	Name    string            `json:"name"`
+	Item    []postmanItem     `json:"item"`
+	Request *postmanRequest   `json:"request"`
+	Auth    *postmanAuth      `json:"auth"`
+	Event   []json.RawMessage `json:"event"`
+}
+
+type postmanRequest struct {
+	Method string            `json:"method"`
+	Header []postmanKeyValue `json:"header"`
+	URL    postmanURL        `json:"url"`
+	Body   *postmanBody      `json:"body"`
+	Auth   *postmanAuth      `json:"auth"`
+}
+
+type postmanKeyValue struct {
+	Key      string          `json:"key"`
+	Value    json.RawMessage `json:"value"`
+	Disabled bool            `json:"disabled"`
+}
+
+// value returns the value as text; variables may hold numbers and
+// booleans
+func (kv postmanKeyValue) value() string {
+	var s string
+	if json.Unmarshal(kv.Value, &s) == nil {
+		return s
+	}
+	return string(kv.Value)
+}
+
+// postmanURL is either the raw URL or an object with its parts
+type postmanURL struct {
+	Raw      string
+	Protocol string
+	Host     []string
+	Path     []string
+	Query    []postmanKeyValue
+	Variable []postmanKeyValue
+}
+
+func (u *postmanURL) UnmarshalJSON(data []byte) error {
+	if json.Unmarshal(data, &u.Raw) == nil {
+		return nil
+	}
+	var obj struct {
+		Raw      string            `json:"raw"`
+		Protocol string            `json:"protocol"`
+		Host     json.RawMessage   `json:"host"`
+		Path     json.RawMessage   `json:"path"`
+		Query    []postmanKeyValue `json:"query"`
+		Variable []postmanKeyValue `json:"variable"`
+	}
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return err
+	}
+	u.Raw, u.Protocol, u.Query, u.Variable = obj.Raw, obj.Protocol, obj.Query, obj.Variable
+	u.Host = stringOrList(obj.Host, ".")
+	u.Path = stringOrList(obj.Path, "/")
+	return nil
+}
+
+// stringOrList decodes a list of strings that may also be given joined
+// by sep
+func stringOrList(data json.RawMessage, sep string) []string {
+	var list []string
+	if json.Unmarshal(data, &list) == nil {
+		return list
+	}
+	var s string
+	if json.Unmarshal(data, &s) == nil && s != "" {
+		return strings.Split(strings.Trim(s, sep), sep)
+	}
+	return nil
+}
+
+// String returns the URL, built from its parts when there is no raw form.
+// Path variables (:id) take their value, or become a placeholder when they
+// have none.
+func (u postmanURL) String() string {
+	raw := u.Raw
+	if raw == "" {
+		raw = strings.Join(u.Host, ".")
+		if u.Protocol != "" {
+			raw = u.Protocol + "://" + raw
+		}
+		if len(u.Path) > 0 {
+			raw += "/" + strings.Join(u.Path, "/")
+		}
+		var query []string
+		for _, q := range u.Query {
+			if !q.Disabled {
+				query = append(query, q.Key+"="+q.value())
+			}
+		}
+		if len(query) > 0 {
+			raw += "?" + strings.Join(query, "&")
+		}
+	}
+	for _, v := range u.Variable {
+		value := v.value()
+		if value == "" {
+			value = "{{" + v.Key + "}}"
+		}
+		pattern := regexp.MustCompile(`/:` + regexp.QuoteMeta(v.Key) + `([/?#]|$)`)
+		raw = pattern.ReplaceAllString(raw, "/"+strings.ReplaceAll(value, "$", "$$")+"$1")
+	}
+	return raw
+}
+
+type postmanBody struct {
+	Mode       string            `json:"mode"`
+	Raw        string            `json:"raw"`
+	URLEncoded []postmanKeyValue `json:"urlencoded"`
+	File       struct {
+		Src json.RawMessage `json:"src"`
+	} `json:"file"`
+	GraphQL struct {
+		Query     string `json:"query"`
+		Variables string `json:"variables"`
+	} `json:"graphql"`
+	Options struct {
+		Raw struct {
+			Language string `json:"language"`
+		} `json:"raw"`
+	} `json:"options"`
+	Disabled bool `json:"disabled"`
+}
+
+// postmanAuth holds the settings of its type under the type's name, as a
+// list of key/value pairs (v2.1) or an object (v2.0)
+type postmanAuth struct {
+	Type     string
+	settings map[string]json.RawMessage
+}
+
+func (a *postmanAuth) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &a.settings); err != nil {
+		return err
+	}
+	return json.Unmarshal(a.settings["type"], &a.Type)
+}
+
+// get returns a setting of the auth type
+func (a *postmanAuth) get(key string) string {
+	raw := a.settings[a.Type]
+	var pairs []postmanKeyValue
+	if json.Unmarshal(raw, &pairs) == nil {
+		for _, kv := range pairs {
+			if kv.Key == key {
+				return kv.value()
+			}
+		}
+		return ""
+	}
+	var obj map[string]json.RawMessage
+	if json.Unmarshal(raw, &obj) == nil {
+		return postmanKeyValue{Value: obj[key]}.value()
+	}
+	return ""
+}
+
+// postmanDynamicVariables maps Postman's dynamic variables to lazyhttp's
+var postmanDynamicVariables = map[string]string{
+	"$guid":         "$uuid",
+	"$randomUUID":   "$uuid",
+	"$timestamp":    "$timestamp",
+	"$isoTimestamp": "$isoTimestamp",
+	"$randomInt":    "$randomInt",
+}
+
+// importPostman converts a Postman v2.0 or v2.1 collection. Folders,
+// requests, collection variables and basic, bearer and API key auth are
+// carried over; scripts, multipart bodies and other auth types are not.
+func importPostman(path string) (importResult, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return importResult{}, err
+	}
+	var pc postmanCollection
+	if err := json.Unmarshal(data, &pc); err != nil {
+		return importResult{}, err
+	}
+	if !strings.Contains(pc.Info.Schema, "/v2.") {
+		return importResult{}, errors.New("not a Postman v2.0 or v2.1 collection, re-export it from Postman as v2.1")
+	}
+
+	c := &collection{Name: pc.Info.Name}
+	if c.Name == "" {
+		c.Name = "postman"
+	}
+	var warnings []string
+	warn := func(format string, a ...interface{}) { warnings = append(warnings, fmt.Sprintf(format, a...)) }
+	unknownDynamic := map[string]bool{}
+	templates := func(s string) string {
+		return templatePattern.ReplaceAllStringFunc(s, func(placeholder string) string {
+			name := templatePattern.FindStringSubmatch(placeholder)[1]
+			if !strings.HasPrefix(name, "$") {
+				return placeholder
+			}
+			if mapped, ok := postmanDynamicVariables[name]; ok {
+				return "{{" + mapped + "}}"
+			}
+			unknownDynamic[name] = true
+			return placeholder
+		})
+	}
+
+	for _, v := range pc.Variable {
+		if v.Disabled || v.Key == "" {
+			continue
+		}
+		if c.Variables == nil {
+			c.Variables = map[string]string{}
+		}
+		c.Variables[v.Key] = templates(v.value())
+	}
+
+	scripts := len(pc.Event)
+	var walk func(items []postmanItem, folder string, auth *postmanAuth)
+	walk = func(items []postmanItem, folder string, auth *postmanAuth) {
+		for _, item := range items {
+			scripts += len(item.Event)
+			itemAuth := auth
+			if item.Auth != nil && item.Auth.Type != "inherit" {
+				itemAuth = item.Auth
+			}
+			if item.Request == nil {
+				path := item.Name
+				if folder != "" {
+					path = folder + "/" + item.Name
+				}
+				walk(item.Item, path, itemAuth)
+				continue
+			}
+
+			pr := item.Request
+			if pr.Auth != nil && pr.Auth.Type != "inherit" {
+				itemAuth = pr.Auth
+			}
+			r := savedRequest{Name: item.Name, Folder: folder, URL: templates(pr.URL.String())}
+			if method := strings.ToUpper(pr.Method); method != "" && method != "GET" {
+				r.Method = method
+			}
+			for _, h := range pr.Header {
+				if h.Disabled || h.Key == "" {
+					continue
+				}
+				if r.Headers == nil {
+					r.Headers = map[string]string{}
+				}
+				r.Headers[h.Key] = templates(h.value())
+			}
+			if b := pr.Body; b != nil && !b.Disabled {
+				convertPostmanBody(&r, b, templates, func(format string, a ...interface{}) {
+					warn("%s: "+format, append([]interface{}{itemPath(r)}, a...)...)
+				})
+			}
+			if itemAuth != nil {
+				r.Auth = convertPostmanAuth(itemAuth, templates, func(format string, a ...interface{}) {
+					warn("%s: "+format, append([]interface{}{itemPath(r)}, a...)...)
+				})
+			}
+			c.Requests = append(c.Requests, r)
+		}
+	}
+	auth := pc.Auth
+	if auth != nil && auth.Type == "inherit" {
+		auth = nil
+	}
+	walk(pc.Item, "", auth)
+
+	if scripts > 0 {
+		warn("%d pre-request and test scripts were not imported", scripts)
+	}
+	if len(unknownDynamic) > 0 {
+		var names []string
+		for name := range unknownDynamic {
+			names = append(names, "{{"+name+"}}")
+		}
+		sort.Strings(names)
+		warn("dynamic variables without a lazyhttp equivalent were kept as they are: %s", strings.Join(names, ", "))
+	}
+	return importResult{collection: c, warnings: warnings}, nil
+}
+
+func itemPath(r savedRequest) string {
+	if r.Folder == "" {
+		return r.Name
+	}
+	return r.Folder + "/" + r.Name
+}
+
+// postmanContentTypes are set for raw bodies in languages lazyhttp doesn't
+// detect on its own
+var postmanContentTypes = map[string]string{
+	"xml":        "application/xml",
+	"html":       "text/html",
+	"javascript": "application/javascript",
+}
+
+func convertPostmanBody(r *savedRequest, b *postmanBody, templates func(string) string, warn func(string, ...interface{})) {
+	setDefault := func(name, value string) {
+		if r.Headers == nil {
+			r.Headers = map[string]string{}
+		}
+		if headerValue(r.Headers, name) == "" {
+			r.Headers[name] = value
+		}
+	}
+	switch b.Mode {
+	case "raw":
+		r.Body = templates(b.Raw)
+		if ct, ok := postmanContentTypes[b.Options.Raw.Language]; ok && r.Body != "" {
+			setDefault("Content-Type", ct)
+		}
+	case "urlencoded":
+		var fields []string
+		for _, kv := range b.URLEncoded {
+			if !kv.Disabled {
+				fields = append(fields, formEncode(templates(kv.Key))+"="+formEncode(templates(kv.value())))
+			}
+		}
+		r.Body = strings.Join(fields, "&")
+		setDefault("Content-Type", "application/x-www-form-urlencoded")
+	case "file":
+		var src string
+		if json.Unmarshal(b.File.Src, &src) == nil && src != "" {
+			r.BodyFile = src
+		} else {
+			warn("body file not set")
+		}
+	case "graphql":
+		body := map[string]interface{}{"query": b.GraphQL.Query}
+		if vars := strings.TrimSpace(b.GraphQL.Variables); vars != "" {
+			if json.Valid([]byte(vars)) {
+				body["variables"] = json.RawMessage(vars)
+			} else {
+				warn("GraphQL variables are not valid JSON and were left out")
+			}
+		}
+		data, _ := json.Marshal(body)
+		r.Body = templates(string(data))
+		setDefault("Content-Type", "application/json")
+	case "formdata":
+		warn("multipart form bodies are not supported and were left out")
+	case "":
+	default:
+		warn("%s bodies are not supported and were left out", b.Mode)
+	}
+}
+
+// formEncode escapes a form field, leaving {{placeholders}} alone so they
+// are still expanded
+func formEncode(s string) string {
+	var sb strings.Builder
+	last := 0
+	for _, loc := range templatePattern.FindAllStringIndex(s, -1) {
+		sb.WriteString(url.QueryEscape(s[last:loc[0]]))
+		sb.WriteString(s[loc[0]:loc[1]])
+		last = loc[1]
+	}
+	sb.WriteString(url.QueryEscape(s[last:]))
+	return sb.String()
+}
+
+func convertPostmanAuth(a *postmanAuth, templates func(string) string, warn func(string, ...interface{})) *requestAuth {
+	switch a.Type {
+	case "noauth":
+		return nil
+	case "basic":
+		return &requestAuth{Type: "basic", Username: templates(a.get("username")), Password: templates(a.get("password"))}
+	case "bearer":
+		return &requestAuth{Type: "bearer", Token: templates(a.get("token"))}
+	case "apikey":
+		in := "header"
+		if a.get("in") == "query" {
+			in = "query"
+		}
+		return &requestAuth{Type: "apikey", Key: templates(a.get("key")), Value: templates(a.get("value")), In: in}
+	case "oauth2":
+		if token := a.get("accessToken"); token != "" {
+			warn("OAuth 2.0 imported as its current access token, which won't be refreshed")
+			return &requestAuth{Type: "bearer", Token: templates(token)}
+		}
+	}
+	warn("%s auth is not supported and was left out", a.Type)
+	return nil
+}
+
+// postmanSchema is the schema URL of the collections lazyhttp exports
+const postmanSchema = "https://schema.getpostman.com/json/collection/v2.1.0/collection.json"
+
+// postmanExport and the types below are what exportPostman writes; unlike
+// the import types, they leave out what lazyhttp has no use for
+type postmanExport struct {
+	Info struct {
+		PostmanID string `json:"_postman_id"`
+		Name      string `json:"name"`
+		Schema    string `json:"schema"`
+	} `json:"info"`
+	Item     []*postmanExportItem `json:"item"`
+	Variable []postmanExportPair  `json:"variable,omitempty"`
+}
+
+type postmanExportItem struct {
+	Name    string               `json:"name"`
+	Item    []*postmanExportItem `json:"item,omitempty"`
+	Request *postmanExportReq    `json:"request,omitempty"`
+}
+
+type postmanExportReq struct {
+	Method string              `json:"method"`
+	Header []postmanExportPair `json:"header"`
+	URL    string              `json:"url"`
+	Body   *postmanExportBody  `json:"body,omitempty"`
+	Auth   *postmanExportAuth  `json:"auth,omitempty"`
+}
+
+type postmanExportPair struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+	Type  string `json:"type,omitempty"`
+}
+
+type postmanExportBody struct {
+	Mode    string                `json:"mode"`
+	Raw     string                `json:"raw,omitempty"`
+	File    *postmanExportFile    `json:"file,omitempty"`
+	Options *postmanExportOptions `json:"options,omitempty"`
+}
+
+type postmanExportFile struct {
+	Src string `json:"src"`
+}
+
+type postmanExportOptions struct {
+	Raw struct {
+		Language string `json:"language"`
+	} `json:"raw"`
+}
+
+type postmanExportAuth struct {
+	Type   string              `json:"type"`
+	Basic  []postmanExportPair `json:"basic,omitempty"`
+	Bearer []postmanExportPair `json:"bearer,omitempty"`
+	APIKey []postmanExportPair `json:"apikey,omitempty"`
+}
+
+// exportPostman converts a collection to Postman v2.1, folders becoming
+// nested items. Extractions, expectations, timeouts, sessions and request
+// variables have no Postman equivalent and are reported as warnings.
+func exportPostman(c *collection) ([]byte, []string, error) {
+	var warnings []string
+	warn := func(format string, a ...interface{}) { warnings = append(warnings, fmt.Sprintf(format, a...)) }
+	kept := map[string]bool{}
+	templates := func(s string) string {
+		return templatePattern.ReplaceAllStringFunc(s, func(placeholder string) string {
+			name := templatePattern.FindStringSubmatch(placeholder)[1]
+			switch {
+			case name == "$uuid":
+				return "{{$guid}}"
+			case strings.HasPrefix(name, "$env."), strings.HasPrefix(name, "$response."), strings.HasPrefix(name, "secret:"):
+				kept[placeholder] = true
+			}
+			return placeholder
+		})
+	}
+
+	var pc postmanExport
+	pc.Info.PostmanID = newUUID()
+	pc.Info.Name = c.Name
+	pc.Info.Schema = postmanSchema
+	for _, name := range sortedKeys(c.Variables) {
+		pc.Variable = append(pc.Variable, postmanExportPair{Key: name, Value: templates(c.Variables[name])})
+	}
+
+	folders := map[string]*postmanExportItem{}
+	var folder func(path string) *[]*postmanExportItem
+	folder = func(path string) *[]*postmanExportItem {
+		if path == "" {
+			return &pc.Item
+		}
+		if f, ok := folders[path]; ok {
+			return &f.Item
+		}
+		parent, name := "", path
+		if i := strings.LastIndex(path, "/"); i >= 0 {
+			parent, name = path[:i], path[i+1:]
+		}
+		f := &postmanExportItem{Name: name, Item: []*postmanExportItem{}}
+		siblings := folder(parent)
+		*siblings = append(*siblings, f)
+		folders[path] = f
+		return &f.Item
+	}
+
+	for _, r := range c.Requests {
+		req := &postmanExportReq{Method: r.method(), Header: []postmanExportPair{}, URL: templates(r.URL)}
+		for _, name := range sortedKeys(r.Headers) {
+			req.Header = append(req.Header, postmanExportPair{Key: name, Value: templates(r.Headers[name]), Type: "text"})
+		}
+		switch {
+		case r.BodyFile != "":
+			req.Body = &postmanExportBody{Mode: "file", File: &postmanExportFile{Src: r.BodyFile}}
+		case r.Body != "":
+			req.Body = &postmanExportBody{Mode: "raw", Raw: templates(r.Body)}
+			if json.Valid([]byte(r.Body)) || strings.Contains(headerValue(r.Headers, "Content-Type"), "json") {
+				req.Body.Options = &postmanExportOptions{}
+				req.Body.Options.Raw.Language = "json"
+			}
+		}
+		if a := r.Auth; a != nil {
+			switch a.Type {
+			case "basic":
+				req.Auth = &postmanExportAuth{Type: "basic", Basic: []postmanExportPair{
+					{Key: "username", Value: templates(a.Username), Type: "string"},
+					{Key: "password", Value: templates(a.Password), Type: "string"},
+				}}
+			case "bearer":
+				req.Auth = &postmanExportAuth{Type: "bearer", Bearer: []postmanExportPair{
+					{Key: "token", Value: templates(a.Token), Type: "string"},
+				}}
+			case "apikey":
+				in := a.In
+				if in == "" {
+					in = "header"
+				}
+				req.Auth = &postmanExportAuth{Type: "apikey", APIKey: []postmanExportPair{
+					{Key: "key", Value: templates(a.Key), Type: "string"},
+					{Key: "value", Value: templates(a.Value), Type: "string"},
+					{Key: "in", Value: in, Type: "string"},
+				}}
+			default:
+				warn("%s: %s auth is not supported and was left out", itemPath(r), a.Type)
+			}
+		}
+
+		var dropped []string
+		if len(r.Variables) > 0 {
+			dropped = append(dropped, "variables")
+		}
+		if len(r.Extract) > 0 {
+			dropped = append(dropped, "extractions")
+		}
+		if r.Expect != nil {
+			dropped = append(dropped, "expectations")
+		}
+		if r.Timeouts != nil {
+			dropped = append(dropped, "timeouts")
+		}
+		if r.Session != "" {
+			dropped = append(dropped, "session")
+		}
+		if len(r.DependsOn) > 0 {
+			dropped = append(dropped, "dependencies")
+		}
+		if len(r.Views) > 0 {
+			dropped = append(dropped, "views")
+		}
+		if len(r.Watch) > 0 {
+			dropped = append(dropped, "watched values")
+		}
+		if r.Cost != nil {
+			dropped = append(dropped, "cost")
+		}
+		if r.OpenAPI != nil {
+			dropped = append(dropped, "OpenAPI operation")
+		}
+		if len(dropped) > 0 {
+			warn("%s: %s left out, Postman has no equivalent", itemPath(r), strings.Join(dropped, ", "))
+		}
+
+		siblings := folder(r.Folder)
+		*siblings = append(*siblings, &postmanExportItem{Name: r.Name, Request: req})
+	}
+	if pc.Item == nil {
+		pc.Item = []*postmanExportItem{}
+	}
+
+	if len(kept) > 0 {
+		var names []string
+		for name := range kept {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		warn("placeholders Postman can't resolve were kept as they are: %s", strings.Join(names, ", "))
+	}
+	data, err := json.MarshalIndent(pc, "", "  ")
+	if err != nil {
+		return nil, nil, err
+	}
+	return append(data, '\n'), warnings, nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"slices"
+)
+
+// maxPrettyPrintBytes is the largest body highlighted without asking:
+// highlighting takes seconds beyond it, and happens again on every redraw
+const maxPrettyPrintBytes = 2 << 20
+
+// prettyFormats are the formats Alt+P forces a body to, in turn; text
+// shows it as is
+var prettyFormats = []string{"json", "html", "xml", "yaml", "css", "javascript", "text"}
+
+// autoFormat is the format a response is shown in when none is forced,
+// text for binary bodies
+func autoFormat(r fetchMsg) string {
+	if isBinary(r.body) {
+		return "text"
+	}
+	if m := sniffMismatch(r); m != nil && m.shownAs() != "" {
+		return m.shownAs()
+	}
+	return detectContentType(r.body, r.header.Get("Content-Type"))
+}
+
+// nextFormat is the format Alt+P goes to from current: the automatic one
+// first, lifting the limits, then the others until back to it, where ""
+// leaves the choice to detection again
+func nextFormat(current, auto string) string {
+	if current == "" {
+		return auto
+	}
+	next := prettyFormats[(slices.Index(prettyFormats, current)+1)%len(prettyFormats)]
+	if next == auto {
+		return ""
+	}
+	return next
+}
+
+// renderFormatting is the line explaining why a body isn't fully
+// formatted, with what Alt+P does about it
+func renderFormatting(note, action string) string {
+	return headerStyle.Render("Formatting:") + " " + timingWarnStyle.Render(note) + historyDimStyle.Render(" • Alt+P: "+action)
+}
+
+// cycleFormat forces the last response to the next format
+func (m model) cycleFormat() model {
+	if m.lastResponse == nil || m.err != nil || m.fetching || m.showTiming || m.dns.open {
+		return m
+	}
+	resp, _ := m.displayedResponse()
+	m.display.format = nextFormat(m.display.format, autoFormat(resp))
+	m.response = m.renderLastResponse()
+	m.viewport.SetContent(m.response)
+	return m
+}
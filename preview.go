@@ -0,0 +1,339 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// resolvedRequest is a request with its templates expanded, ready to send
+type resolvedRequest struct {
+	method   string
+	url      string // with secrets in the clear, for sending
+	display  string // with secrets masked
+	headers  map[string]string
+	body     string
+	bodyFile string
+
+	// Headers and body with secrets masked, for previews
+	displayHeaders map[string]string
+	displayBody    string
+
+	missing []unresolved
+	dynamic []string
+	vars    []usedVariable
+
+	// extract is applied to the response, see savedRequest.Extract
+	extract map[string]string
+
+	// views are the custom views offered on the response, filter the
+	// display filter it's shown through
+	views  []string
+	filter string
+
+	// expect and watch raise alerts on the response, see alert.go
+	expect *expectations
+	watch  []string
+
+	// cost is tallied against its quota once the request got a response
+	cost *requestCost
+
+	// openAPI is the spec operation the response is checked against
+	openAPI *openAPIRef
+
+	timeouts requestTimeouts
+
+	// httpVersion forces an HTTP version as typed, "" negotiating it
+	httpVersion string
+
+	// redirects is the redirect policy as typed, see parseRedirects, and
+	// redirectedFrom the responses that led to the request when it
+	// follows a redirect at the prompt
+	redirects      string
+	redirectedFrom []redirectHop
+
+	// resolve sends connections to other addresses, -resolve and the
+	// request's own
+	resolve connectOverrides
+
+	// proxy is the proxy the request or its environment sets, a URL or
+	// direct, "" leaving it to -proxy
+	proxy string
+
+	// session names the session the request is sent in, "" for none
+	session string
+
+	// inherited lists the defaults the request took from its workspace
+	// and folders, and where from
+	inherited []string
+
+	// signing is what a signed auth scheme signed, nil for other auth
+	signing *signingDebug
+}
+
+// resolveRequestLine expands the templates of an input line and splits it
+// into method, URL and body file
+func resolveRequestLine(line string, ctx templateContext) resolvedRequest {
+	exp := expandTemplate(line, ctx)
+	method, rawURL, bodyFile := parseRequestLine(exp.text)
+	_, display, _ := parseRequestLine(exp.masked)
+	return resolvedRequest{
+		method:   method,
+		url:      withScheme(rawURL),
+		display:  withScheme(display),
+		bodyFile: bodyFile,
+		missing:  exp.missing,
+		dynamic:  exp.dynamic,
+		vars:     ctx.usedVariables(exp.used),
+		timeouts: defaultTimeouts,
+		session:  activeSession,
+
+		httpVersion: defaultHTTPVersion,
+		redirects:   defaultRedirects,
+		resolve:     defaultResolve,
+		proxy:       environmentProxy(),
+	}
+}
+
+// resolveSavedRequest expands the templates of a saved request's URL,
+// headers, body and auth. The request's own variables take precedence,
+// those of its folders and then its collection come last.
+func resolveSavedRequest(r savedRequest, ctx templateContext) resolvedRequest {
+	for i := len(r.folderVars) - 1; i >= 0; i-- {
+		ctx = ctx.withBase(r.folderVars[i])
+	}
+	ctx = ctx.withBase(r.inherited).withVariables("request", r.Variables)
+	var missing []unresolved
+	r, inherited, err := r.withDefaults()
+	if err != nil {
+		missing = append(missing, unresolved{name: "defaults", err: err})
+	}
+	var dynamic, used []string
+	expand := func(s string) expansion {
+		exp := expandTemplate(s, ctx)
+		missing = append(missing, exp.missing...)
+		dynamic = append(dynamic, exp.dynamic...)
+		for _, name := range exp.used {
+			if !containsString(used, name) {
+				used = append(used, name)
+			}
+		}
+		return exp
+	}
+
+	u := expand(r.URL)
+	resolved := resolvedRequest{
+		method:   r.method(),
+		url:      withScheme(u.text),
+		display:  withScheme(u.masked),
+		bodyFile: expand(r.BodyFile).text,
+		extract:  r.Extract,
+		views:    r.Views,
+		filter:   r.Filter,
+		expect:   r.Expect,
+		watch:    r.Watch,
+		cost:     r.Cost,
+		openAPI:  r.OpenAPI,
+		timeouts: defaultTimeouts.merge(r.Timeouts),
+		session:  r.sessionName(),
+
+		httpVersion: defaultHTTPVersion,
+		redirects:   defaultRedirects,
+		proxy:       environmentProxy(),
+		inherited:   inherited,
+	}
+	if r.Proxy != "" {
+		resolved.proxy = expand(r.Proxy).text
+	}
+	if r.HTTPVersion != "" {
+		resolved.httpVersion = r.HTTPVersion
+	}
+	if r.Redirects != "" {
+		resolved.redirects = r.Redirects
+	}
+	if len(r.Resolve) > 0 {
+		overrides := make(map[string]string, len(r.Resolve))
+		for host, addr := range r.Resolve {
+			overrides[host] = expand(addr).text
+		}
+		resolved.resolve = defaultResolve.merge(overrides)
+	} else {
+		resolved.resolve = defaultResolve
+	}
+	body := expand(r.Body)
+	resolved.body, resolved.displayBody = body.text, body.masked
+	if len(r.Headers) > 0 {
+		resolved.headers = make(map[string]string, len(r.Headers))
+		resolved.displayHeaders = make(map[string]string, len(r.Headers))
+		for k, v := range r.Headers {
+			exp := expand(v)
+			resolved.headers[k], resolved.displayHeaders[k] = exp.text, exp.masked
+		}
+	}
+	if r.Auth != nil {
+		resolved.applyAuth(r.Auth, expand)
+	}
+	resolved.missing, resolved.dynamic = append(resolved.missing, missing...), dynamic
+	resolved.vars = ctx.usedVariables(used)
+	return resolved
+}
+
+// withScheme defaults to https when no scheme is given
+func withScheme(u string) string {
+	if !strings.HasPrefix(u, "http://") && !strings.HasPrefix(u, "https://") && !strings.HasPrefix(u, unixSocketScheme) {
+		return "https://" + u
+	}
+	return u
+}
+
+// templateContext builds the context templates of the input line resolve
+// against
+func (m model) templateContext() templateContext {
+	ctx := variableContext()
+	ctx.last = m.lastResponse
+	return ctx
+}
+
+// renderPreview shows the request an input line would send, without
+// sending it. Secret values are masked.
+func renderPreview(r resolvedRequest) string {
+	var sb strings.Builder
+	sb.WriteString(headerStyle.Render("Request preview"))
+	note := " (not sent)"
+	if activeEnvironment != "" {
+		note = fmt.Sprintf(" (not sent, environment %s)", activeEnvironment)
+	}
+	sb.WriteString(lipgloss.NewStyle().Foreground(lipgloss.Color("#888888")).Render(note))
+	sb.WriteString("\n\n")
+
+	fmt.Fprintf(&sb, "%s %s\n\n", lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("#56B6C2")).Render(r.method), r.display)
+
+	headers := [][2]string{{"User-Agent", defaultUserAgent}, {"Accept-Encoding", acceptEncoding}}
+	if r.bodyFile != "" {
+		if file, size, contentType, err := openUploadBody(r.bodyFile); err == nil {
+			file.Close()
+			headers = append(headers, [2]string{"Content-Type", contentType},
+				[2]string{"Content-Length", fmt.Sprint(size)})
+		}
+	}
+	jar := http.CookieJar(cookieJar)
+	sess, sessErr := requestSession(r.session, r.url)
+	if sess != nil {
+		jar = sess.jar
+		for _, name := range sortedKeys(sess.headers()) {
+			if headerValue(r.headers, name) == "" {
+				headers = append(headers, [2]string{name, sess.Headers[name]})
+			}
+		}
+	}
+	if u, err := url.Parse(r.url); err == nil {
+		var names []string
+		for _, c := range jar.Cookies(u) {
+			names = append(names, c.Name+"="+maskedValue)
+		}
+		if len(names) > 0 {
+			headers = append(headers, [2]string{"Cookie", strings.Join(names, "; ")})
+		}
+	}
+	for _, name := range sortedKeys(r.headers) {
+		headers = append(headers, [2]string{name, r.displayHeaders[name]})
+	}
+	for _, h := range headers {
+		if secretNamePattern.MatchString(h[0]) {
+			h[1] = maskedValue
+		}
+		fmt.Fprintf(&sb, "%s %s\n", headerStyle.Render(h[0]+":"), h[1])
+	}
+	if r.displayBody != "" {
+		fmt.Fprintf(&sb, "\n%s\n%s\n", headerStyle.Render("Body:"), r.displayBody)
+	}
+
+	if r.bodyFile != "" {
+		sb.WriteString("\n")
+		if file, size, _, err := openUploadBody(r.bodyFile); err != nil {
+			fmt.Fprintf(&sb, "%s %s\n", headerStyle.Render("Body:"), errorStyle.Render(err.Error()))
+		} else {
+			file.Close()
+			fmt.Fprintf(&sb, "%s %s (%s)\n", headerStyle.Render("Body:"), r.bodyFile, formatBytes(size))
+		}
+	}
+
+	fmt.Fprintf(&sb, "\n%s %s\n", headerStyle.Render("Timeouts:"), r.timeouts)
+	if len(r.inherited) > 0 {
+		fmt.Fprintf(&sb, "%s %s\n", headerStyle.Render("Inherited:"), strings.Join(r.inherited, " • "))
+	}
+	if len(r.resolve) > 0 {
+		fmt.Fprintf(&sb, "%s %s\n", headerStyle.Render("Connect to:"), r.resolve)
+	}
+	if r.proxy != "" {
+		if p, err := describeProxySetting(r.proxy); err != nil {
+			fmt.Fprintf(&sb, "%s %s\n", headerStyle.Render("Proxy:"), errorStyle.Render(err.Error()))
+		} else {
+			fmt.Fprintf(&sb, "%s %s\n", headerStyle.Render("Proxy:"), p)
+		}
+	}
+	if version, err := parseHTTPVersion(r.httpVersion); err != nil {
+		fmt.Fprintf(&sb, "%s %s\n", headerStyle.Render("HTTP version:"), errorStyle.Render(err.Error()))
+	} else {
+		fmt.Fprintf(&sb, "%s %s\n", headerStyle.Render("HTTP version:"), describeHTTPVersion(version))
+	}
+	if policy, err := parseRedirects(r.redirects); err != nil {
+		fmt.Fprintf(&sb, "%s %s\n", headerStyle.Render("Redirects:"), errorStyle.Render(err.Error()))
+	} else {
+		fmt.Fprintf(&sb, "%s %s\n", headerStyle.Render("Redirects:"), describeRedirects(policy))
+	}
+	switch {
+	case sessErr != nil:
+		fmt.Fprintf(&sb, "%s %s\n", headerStyle.Render("Session:"), errorStyle.Render(sessErr.Error()))
+	case sess != nil:
+		fmt.Fprintf(&sb, "%s %s for %s\n", headerStyle.Render("Session:"), sess.Name, sess.Host)
+	}
+	if r.cost != nil {
+		fmt.Fprintf(&sb, "%s %s\n", headerStyle.Render("Cost:"), r.cost.describe(r.url))
+	}
+
+	if r.signing != nil {
+		sb.WriteString("\n")
+		sb.WriteString(renderSigning(r.signing))
+	}
+
+	if len(r.vars) > 0 {
+		dim := lipgloss.NewStyle().Foreground(lipgloss.Color("#888888"))
+		fmt.Fprintf(&sb, "\n%s %s\n", headerStyle.Render("Variables:"), dim.Render("(request > extracted > session > environment > folder > collection)"))
+		for _, v := range r.vars {
+			from := v.source
+			if len(v.overrides) > 0 {
+				from += ", overrides " + strings.Join(v.overrides, ", ")
+			}
+			fmt.Fprintf(&sb, "  %s = %s %s\n", v.name, v.value, dim.Render("("+from+")"))
+		}
+	}
+
+	if len(r.missing) > 0 {
+		sb.WriteString("\n")
+		for _, u := range r.missing {
+			sb.WriteString(errorStyle.Render(fmt.Sprintf("Unresolved {{%s}}: %v", u.name, u.err)))
+			sb.WriteString("\n")
+		}
+	}
+	if len(r.dynamic) > 0 {
+		sb.WriteString("\n")
+		sb.WriteString(lipgloss.NewStyle().Foreground(lipgloss.Color("#FFCC00")).
+			Render("Regenerated when the request is sent: " + strings.Join(r.dynamic, ", ")))
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
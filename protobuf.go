@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"mime"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+var (
+	// protoFiles holds the descriptors loaded with -proto, nil when none,
+	// and protoFile is the file they were loaded from
+	protoFiles *protoregistry.Files
+	protoFile  string
+	// protoMessage is the default message type used to decode responses
+	protoMessage string
+)
+
+// isProtobuf reports whether a Content-Type denotes a protobuf payload
+func isProtobuf(contentType string) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case "application/x-protobuf", "application/protobuf", "application/vnd.google.protobuf", "application/x-google-protobuf":
+		return true
+	}
+	return false
+}
+
+// loadProtoDescriptors reads a compiled FileDescriptorSet (protoc -o) or,
+// for .proto sources, compiles one with protoc first
+func loadProtoDescriptors(path string) (*protoregistry.Files, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.HasSuffix(path, ".proto") {
+		data, err = compileProto(path)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var set descriptorpb.FileDescriptorSet
+	if err := proto.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("%s is not a descriptor set: %w", path, err)
+	}
+	return protodesc.NewFiles(&set)
+}
+
+// compileProto runs protoc to turn a .proto file into a descriptor set
+func compileProto(path string) ([]byte, error) {
+	if _, err := exec.LookPath("protoc"); err != nil {
+		return nil, fmt.Errorf("protoc is required to load .proto files (or pass a descriptor set built with protoc -o): %w", err)
+	}
+
+	out, err := os.CreateTemp("", "lazyhttp-*.pb")
+	if err != nil {
+		return nil, err
+	}
+	out.Close()
+	defer os.Remove(out.Name())
+
+	cmd := exec.Command("protoc",
+		"--include_imports",
+		"--descriptor_set_out="+out.Name(),
+		"-I", filepath.Dir(path),
+		filepath.Base(path))
+	cmd.Dir = filepath.Dir(path)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("protoc failed: %v: %s", err, strings.TrimSpace(string(output)))
+	}
+	return os.ReadFile(out.Name())
+}
+
+// decodeProtobuf turns a protobuf body into indented JSON. The message type
+// comes from the messageType/proto Content-Type parameter when the server
+// sends one, otherwise from -proto-message.
+func decodeProtobuf(body []byte, contentType string) ([]byte, string, error) {
+	if protoFiles == nil {
+		return nil, "", fmt.Errorf("no descriptors loaded (start with -proto <file.proto|descriptor.pb>)")
+	}
+
+	name := protoMessage
+	if _, params, err := mime.ParseMediaType(contentType); err == nil {
+		for _, key := range []string{"messagetype", "proto"} {
+			if v := params[key]; v != "" {
+				name = v
+			}
+		}
+	}
+	if name == "" {
+		return nil, "", fmt.Errorf("no message type (pass -proto-message or have the server send a messageType parameter)")
+	}
+
+	desc, err := protoFiles.FindDescriptorByName(protoreflect.FullName(name))
+	if err != nil {
+		return nil, name, fmt.Errorf("message %s: %w", name, err)
+	}
+	msgDesc, ok := desc.(protoreflect.MessageDescriptor)
+	if !ok {
+		return nil, name, fmt.Errorf("%s is not a message", name)
+	}
+
+	msg := dynamicpb.NewMessage(msgDesc)
+	if err := proto.Unmarshal(body, msg); err != nil {
+		return nil, name, err
+	}
+
+	out, err := protojson.MarshalOptions{Multiline: true, Indent: "  ", Resolver: protoTypes()}.Marshal(msg)
+	return out, name, err
+}
+
+// protoTypes exposes the loaded messages so Any fields can be expanded
+func protoTypes() *dynamicpb.Types {
+	return dynamicpb.NewTypes(protoFiles)
+}
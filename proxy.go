@@ -0,0 +1,179 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+	"golang.org/x/net/http/httpproxy"
+)
+
+// proxyUsage is the help of -proxy
+const proxyUsage = "send requests through this proxy `URL`, http://, https:// or socks5://[user:password@]host:port, or direct to ignore HTTP_PROXY and HTTPS_PROXY (default from the environment)"
+
+// proxyDirect is the -proxy value sending requests straight to their host
+const proxyDirect = "direct"
+
+// defaultProxy is the proxy set with -proxy, nil leaving it to the
+// HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables, and
+// directProxy set when -proxy direct ignores them
+var (
+	defaultProxy *url.URL
+	directProxy  bool
+)
+
+var proxyStyle = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("#56B6C2"))
+
+// parseProxyFlag sets the proxy of requests from -proxy
+func parseProxyFlag(s string) error {
+	s = strings.TrimSpace(s)
+	switch s {
+	case "", "env":
+		defaultProxy, directProxy = nil, false
+		return nil
+	case proxyDirect:
+		defaultProxy, directProxy = nil, true
+		return nil
+	}
+	u, err := parseProxyURL(s)
+	if err != nil {
+		return err
+	}
+	defaultProxy, directProxy = u, false
+	return nil
+}
+
+// parseProxyURL reads a proxy URL, http:// when it has no scheme as with
+// curl. socks5h:// resolves hosts at the proxy, as socks5:// does in Go.
+func parseProxyURL(s string) (*url.URL, error) {
+	if !strings.Contains(s, "://") {
+		s = "http://" + s
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy URL: %w", err)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %s://, use http://, https:// or socks5://", u.Scheme)
+	}
+	if u.Hostname() == "" {
+		return nil, errors.New("the proxy URL has no host")
+	}
+	return u, nil
+}
+
+// noProxy is the NO_PROXY list of the environment
+func noProxy() string {
+	if v := os.Getenv("NO_PROXY"); v != "" {
+		return v
+	}
+	return os.Getenv("no_proxy")
+}
+
+// requestProxy is the proxy of transports: the one of -proxy, or of the
+// environment. Hosts in NO_PROXY, and localhost, always go direct.
+func requestProxy(req *http.Request) (*url.URL, error) {
+	switch {
+	case directProxy:
+		return nil, nil
+	case defaultProxy != nil:
+		return explicitProxy(defaultProxy)(req)
+	}
+	return http.ProxyFromEnvironment(req)
+}
+
+// explicitProxy sends requests through u but for the hosts of NO_PROXY
+func explicitProxy(u *url.URL) func(*http.Request) (*url.URL, error) {
+	p := u.String()
+	proxy := (&httpproxy.Config{HTTPProxy: p, HTTPSProxy: p, NoProxy: noProxy()}).ProxyFunc()
+	return func(req *http.Request) (*url.URL, error) {
+		return proxy(req.URL)
+	}
+}
+
+// proxyFunc is the proxy of transports for the proxy a saved request or
+// environment sets: "" leaves it to requestProxy, direct goes straight to
+// the host, and a URL is used as -proxy would be
+func proxyFunc(setting string) (func(*http.Request) (*url.URL, error), error) {
+	switch setting = strings.TrimSpace(setting); setting {
+	case "":
+		return requestProxy, nil
+	case proxyDirect:
+		return nil, nil
+	}
+	if outboundPolicy != nil {
+		// As with -proxy, the proxy would connect out of the policy's reach
+		return nil, errors.New("egress policy does not allow proxies")
+	}
+	u, err := parseProxyURL(setting)
+	if err != nil {
+		return nil, fmt.Errorf("proxy %s: %w", setting, err)
+	}
+	return explicitProxy(u), nil
+}
+
+// describeProxySetting is how previews show the proxy a request or its
+// environment sets, with its password masked
+func describeProxySetting(setting string) (string, error) {
+	if _, err := proxyFunc(setting); err != nil {
+		return "", err
+	}
+	setting = strings.TrimSpace(setting)
+	if setting == proxyDirect {
+		return "direct, not through -proxy or HTTP_PROXY", nil
+	}
+	u, _ := parseProxyURL(setting)
+	return u.Redacted(), nil
+}
+
+// environmentProxy is the proxy the active environment sets, "" for none
+func environmentProxy() string {
+	if env := findEnvironment(activeEnvironment); env != nil {
+		return strings.TrimSpace(env.Proxy)
+	}
+	return ""
+}
+
+// describeProxy names the proxy requests go through, with its password
+// masked, "" for none. Saved requests may still set their own.
+func describeProxy() string {
+	if p := environmentProxy(); p != "" && outboundPolicy == nil {
+		if p == proxyDirect {
+			return ""
+		}
+		if u, err := parseProxyURL(p); err == nil {
+			p = u.Redacted()
+		}
+		return p + " (environment " + activeEnvironment + ")"
+	}
+	switch {
+	case outboundPolicy != nil || directProxy:
+		return ""
+	case defaultProxy != nil:
+		return defaultProxy.Redacted()
+	}
+	env := httpproxy.FromEnvironment()
+	redacted := func(p string) string {
+		if u, err := parseProxyURL(p); err == nil {
+			return u.Redacted()
+		}
+		return p
+	}
+	switch {
+	case env.HTTPSProxy == "" && env.HTTPProxy == "":
+		return ""
+	case env.HTTPSProxy == env.HTTPProxy:
+		return redacted(env.HTTPSProxy) + " (environment)"
+	case env.HTTPProxy == "":
+		return redacted(env.HTTPSProxy) + " (environment, https:// only)"
+	case env.HTTPSProxy == "":
+		return redacted(env.HTTPProxy) + " (environment, http:// only)"
+	}
+	return redacted(env.HTTPSProxy) + " for https://, " + redacted(env.HTTPProxy) + " for http:// (environment)"
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// usageFile tallies what the requests sent from the TUI cost, per day and
+// quota, between sessions
+const usageFile = "usage.json"
+
+// usageRetention is how many days of usage are kept
+const usageRetention = 31
+
+// quotaWarnRatio is the share of a daily limit from which the status bar
+// shows the quota in warning colors
+const quotaWarnRatio = 0.8
+
+var quotaWarnStyle = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("#E5C07B"))
+
+// requestCost annotates a saved request with what sending it costs, e.g.
+// {"quota": "search", "limit": 1000} for an API allowing 1000 calls a day,
+// or {"quota": "openai", "units_from": "body.usage.total_tokens"} to
+// count the tokens an LLM API reports
+type requestCost struct {
+	// Quota names what the request counts against, the host of its URL
+	// by default; requests naming the same quota share its tally
+	Quota string `json:"quota,omitempty"`
+
+	// Units is what one request costs, 1 by default
+	Units float64 `json:"units,omitempty"`
+
+	// UnitsFrom reads the cost from the response instead, as a path like
+	// those of extractions; Units applies when it can't be read
+	UnitsFrom string `json:"units_from,omitempty"`
+
+	// Limit is the daily allowance of the quota, none when 0
+	Limit float64 `json:"limit,omitempty"`
+
+	// Note is shown in the preview, e.g. "billed per 1k tokens"
+	Note string `json:"note,omitempty"`
+}
+
+// quota is the name of the quota of a request sent to rawURL
+func (c *requestCost) quota(rawURL string) string {
+	if c.Quota != "" {
+		return c.Quota
+	}
+	if u, err := url.Parse(rawURL); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return rawURL
+}
+
+// describe sums up the cost of a request sent to rawURL for the preview
+func (c *requestCost) describe(rawURL string) string {
+	units := formatUnits(c.units(nil))
+	if c.UnitsFrom != "" {
+		units = c.UnitsFrom
+	}
+	s := fmt.Sprintf("%s of quota %s", units, c.quota(rawURL))
+	if c.Limit > 0 {
+		s += fmt.Sprintf(" (%s a day)", formatUnits(c.Limit))
+	}
+	if c.Note != "" {
+		s += ", " + c.Note
+	}
+	return s
+}
+
+// units is what a request cost, read from its response when UnitsFrom is
+// set
+func (c *requestCost) units(resp *fetchMsg) float64 {
+	if c.UnitsFrom != "" && resp != nil {
+		value, _, err := templateContext{last: resp}.extract(c.UnitsFrom)
+		if err == nil {
+			if n, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+				return n
+			}
+		}
+	}
+	if c.Units > 0 {
+		return c.Units
+	}
+	return 1
+}
+
+// quotaUsage is the tally of the workspace: units used by day (local
+// date) and quota, and the last daily limit seen for each quota
+type quotaUsage struct {
+	Days   map[string]map[string]float64 `json:"days"`
+	Limits map[string]float64            `json:"limits,omitempty"`
+}
+
+func newQuotaUsage() quotaUsage {
+	return quotaUsage{Days: map[string]map[string]float64{}, Limits: map[string]float64{}}
+}
+
+func usageDay(t time.Time) string {
+	return t.Format(time.DateOnly)
+}
+
+// loadQuotaUsage reads the tally of the current workspace, empty in
+// incognito mode
+func loadQuotaUsage() (quotaUsage, error) {
+	usage := newQuotaUsage()
+	if incognito {
+		return usage, nil
+	}
+	path, err := workspaceFile(usageFile)
+	if err != nil {
+		return usage, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return usage, nil
+	}
+	if err != nil {
+		return usage, err
+	}
+	if err := json.Unmarshal(data, &usage); err != nil {
+		return newQuotaUsage(), fmt.Errorf("%s: %w", usageFile, err)
+	}
+	if usage.Days == nil {
+		usage.Days = map[string]map[string]float64{}
+	}
+	if usage.Limits == nil {
+		usage.Limits = map[string]float64{}
+	}
+	return usage, nil
+}
+
+// today is the usage of a quota so far today
+func (u quotaUsage) today(quota string) float64 {
+	return u.Days[usageDay(time.Now())][quota]
+}
+
+// add tallies units against a quota and saves the tally, dropping days
+// older than usageRetention; nothing is saved in incognito mode
+func (u quotaUsage) add(quota string, units, limit float64) error {
+	day := usageDay(time.Now())
+	if u.Days[day] == nil {
+		u.Days[day] = map[string]float64{}
+	}
+	u.Days[day][quota] += units
+	if limit > 0 {
+		u.Limits[quota] = limit
+	}
+	if incognito {
+		return nil
+	}
+	cutoff := usageDay(time.Now().AddDate(0, 0, -usageRetention))
+	for d := range u.Days {
+		if d < cutoff {
+			delete(u.Days, d)
+		}
+	}
+	data, err := json.MarshalIndent(u, "", "  ")
+	if err != nil {
+		return err
+	}
+	path, err := workspaceFile(usageFile)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o600)
+}
+
+// exhausted tells whether sending a request of cost c to rawURL would go
+// over the daily limit of its quota
+func (u quotaUsage) exhausted(c *requestCost, rawURL string) bool {
+	if c == nil || c.Limit <= 0 {
+		return false
+	}
+	used := u.today(c.quota(rawURL))
+	if c.UnitsFrom != "" {
+		return used >= c.Limit
+	}
+	return used+c.units(nil) > c.Limit
+}
+
+// formatUnits shows whole numbers of units without decimals
+func formatUnits(n float64) string {
+	return strconv.FormatFloat(n, 'f', -1, 64)
+}
+
+// describe sums up the usage of a quota today, with its limit if any
+func (u quotaUsage) describe(quota string) string {
+	s := quota + " " + formatUnits(u.today(quota))
+	if limit := u.Limits[quota]; limit > 0 {
+		s += "/" + formatUnits(limit)
+	}
+	return s
+}
+
+// renderQuotas is the status bar segment listing the quotas used today
+func (u quotaUsage) renderQuotas() string {
+	used := u.Days[usageDay(time.Now())]
+	if len(used) == 0 {
+		return ""
+	}
+	quotas := sortedKeys(used)
+	sort.SliceStable(quotas, func(i, j int) bool { return u.Limits[quotas[i]] > 0 && u.Limits[quotas[j]] == 0 })
+	parts := make([]string, len(quotas))
+	for i, quota := range quotas {
+		style := statusTextStyle
+		if limit := u.Limits[quota]; limit > 0 {
+			switch {
+			case used[quota] >= limit:
+				style = errorStyle
+			case used[quota] >= limit*quotaWarnRatio:
+				style = quotaWarnStyle
+			}
+		}
+		parts[i] = style.Render(u.describe(quota))
+	}
+	return statusTextStyle.Render("today: ") + strings.Join(parts, statusTextStyle.Render(", "))
+}
+
+// checkQuota holds back a request that would go over the daily limit of
+// its quota, unless the user already chose to go over it today by sending
+// it again
+func (m model) checkQuota(r resolvedRequest) (model, bool) {
+	if !m.usage.exhausted(r.cost, r.url) {
+		return m, false
+	}
+	quota := r.cost.quota(r.url)
+	override := usageDay(time.Now()) + " " + quota
+	if m.quotaOverride == override {
+		return m, false
+	}
+	m.quotaOverride = override
+	m.err = fmt.Errorf("request not sent, the daily quota %s is used up (%s of %s)\nSend it again to go over the limit anyway",
+		quota, formatUnits(m.usage.today(quota)), formatUnits(r.cost.Limit))
+	m.response = ""
+	return m, true
+}
+
+// tallyCost adds the cost of the request in flight to its quota, when the
+// server answered it
+func (m model) tallyCost(msg fetchMsg) error {
+	c := m.sentCost
+	if c == nil || msg.statusCode == 0 {
+		return nil
+	}
+	return m.usage.add(c.quota(m.sentURL), c.units(&msg), c.Limit)
+}
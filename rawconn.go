@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"time"
+)
+
+const (
+	rawDialTimeout = 10 * time.Second
+	// rawIdleTimeout ends a raw exchange once the server goes quiet
+	rawIdleTimeout = 2 * time.Second
+	rawMaxResponse = 1 << 20
+)
+
+// rawResponseMsg is the outcome of a raw TCP/TLS exchange
+type rawResponseMsg struct {
+	remote  string
+	tls     *tls.ConnectionState
+	sent    int
+	data    []byte
+	elapsed time.Duration
+	err     error
+}
+
+// dialRaw opens a plain TCP or TLS connection to addr (host:port)
+func dialRaw(ctx context.Context, addr string, useTLS bool) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: rawDialTimeout, Resolver: customResolver}
+	if !useTLS {
+		return dialer.DialContext(ctx, "tcp", addr)
+	}
+
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	cfg := tlsConfig()
+	cfg.ServerName = host
+	tlsDialer := &tls.Dialer{NetDialer: dialer, Config: cfg}
+	return tlsDialer.DialContext(ctx, "tcp", addr)
+}
+
+// sendRaw writes payload to addr byte for byte and collects whatever the
+// server sends back until it closes the connection, goes idle, or the
+// context is cancelled. Data read before a failure is always returned.
+func sendRaw(ctx context.Context, addr string, useTLS bool, payload []byte) rawResponseMsg {
+	start := time.Now()
+
+	conn, err := dialRaw(ctx, addr, useTLS)
+	if err != nil {
+		return rawResponseMsg{err: err, elapsed: time.Since(start)}
+	}
+	defer conn.Close()
+
+	result := rawResponseMsg{remote: conn.RemoteAddr().String()}
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		state := tlsConn.ConnectionState()
+		result.tls = &state
+	}
+
+	// Unblock reads as soon as the user cancels
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	// An empty payload just grabs whatever banner the server volunteers
+	if len(payload) > 0 {
+		result.sent, err = conn.Write(payload)
+		if err != nil {
+			result.err = err
+			result.elapsed = time.Since(start)
+			return result
+		}
+	}
+
+	buf := make([]byte, 32*1024)
+	for len(result.data) < rawMaxResponse {
+		conn.SetReadDeadline(time.Now().Add(rawIdleTimeout))
+		n, err := conn.Read(buf)
+		result.data = append(result.data, buf[:n]...)
+		if err != nil {
+			if ctx.Err() != nil {
+				result.err = ctx.Err()
+				break
+			}
+			// EOF and idle timeouts are the normal ways for an exchange to end
+			if !errors.Is(err, os.ErrDeadlineExceeded) && !errors.Is(err, net.ErrClosed) && !errors.Is(err, io.EOF) {
+				result.err = err
+			}
+			break
+		}
+	}
+
+	result.elapsed = time.Since(start)
+	return result
+}
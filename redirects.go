@@ -0,0 +1,239 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// redirectsUsage is the help of -redirects
+const redirectsUsage = "what to do with redirects: follow them, none to show the redirect itself, prompt to ask before each, or the most `hops` to follow (default follow, up to 10)"
+
+// Redirect policies other than following up to a number of hops
+const (
+	redirectsNone   = "none"
+	redirectsPrompt = "prompt"
+)
+
+// maxRedirects is how many redirects are followed by default, as many as
+// Go and browsers follow
+const maxRedirects = 10
+
+// defaultRedirects is set with -redirects and applies to every request;
+// saved requests can override it
+var defaultRedirects string
+
+// parseRedirects reads a redirect policy as typed: follow (""), none,
+// prompt or a number of hops
+func parseRedirects(s string) (string, error) {
+	switch s = strings.ToLower(strings.TrimSpace(s)); s {
+	case "", "follow", "yes", "on":
+		return "", nil
+	case redirectsNone, "no", "off", "0":
+		return redirectsNone, nil
+	case redirectsPrompt, "ask":
+		return redirectsPrompt, nil
+	}
+	if n, err := strconv.Atoi(s); err == nil && n > 0 {
+		return strconv.Itoa(n), nil
+	}
+	return "", fmt.Errorf("unknown redirect policy %q, use follow, none, prompt or a number of hops", s)
+}
+
+// parseRedirectsFlag sets defaultRedirects from -redirects
+func parseRedirectsFlag(s string) error {
+	policy, err := parseRedirects(s)
+	defaultRedirects = policy
+	return err
+}
+
+// redirectLimit is the number of redirects a policy follows by itself
+func redirectLimit(policy string) int {
+	switch policy {
+	case "":
+		return maxRedirects
+	case redirectsNone, redirectsPrompt:
+		return 0
+	}
+	n, _ := strconv.Atoi(policy)
+	return n
+}
+
+// describeRedirects is how previews show the redirect policy of a request
+func describeRedirects(policy string) string {
+	switch policy {
+	case "":
+		return fmt.Sprintf("followed, up to %d", maxRedirects)
+	case redirectsNone:
+		return "not followed"
+	case redirectsPrompt:
+		return "followed after asking"
+	}
+	return "followed, up to " + policy
+}
+
+// redirectHop is a response on the way to the final one: a redirect, its
+// target and the cookies it set
+type redirectHop struct {
+	Status   int      `json:"status"`
+	URL      string   `json:"url"`
+	Location string   `json:"location,omitempty"`
+	Cookies  []string `json:"cookies,omitempty"` // names only, values may be credentials
+}
+
+// responseHop describes a response as a hop of a redirect chain
+func responseHop(resp *http.Response) redirectHop {
+	hop := redirectHop{Status: resp.StatusCode, URL: resp.Request.URL.String(), Location: resp.Header.Get("Location")}
+	for _, c := range resp.Cookies() {
+		hop.Cookies = append(hop.Cookies, c.Name)
+	}
+	return hop
+}
+
+// isRedirect tells whether a response redirects somewhere
+func isRedirect(resp *http.Response) bool {
+	switch resp.StatusCode {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return resp.Header.Get("Location") != ""
+	}
+	return false
+}
+
+// redirectChecker is the CheckRedirect of a client following policy. It
+// records the redirects followed into hops, and stops at the first one
+// the policy doesn't follow, leaving it as the response.
+func redirectChecker(policy string, hops *[]redirectHop) func(*http.Request, []*http.Request) error {
+	limit := redirectLimit(policy)
+	return func(req *http.Request, via []*http.Request) error {
+		if len(via) > limit {
+			return http.ErrUseLastResponse
+		}
+		*hops = append(*hops, responseHop(req.Response))
+		return nil
+	}
+}
+
+// redirectStopped says why a redirect response wasn't followed, "" when
+// the response isn't one
+func redirectStopped(policy string, resp *http.Response) string {
+	if !isRedirect(resp) {
+		return ""
+	}
+	switch policy {
+	case redirectsNone:
+		return "not followed, redirects are off"
+	case redirectsPrompt:
+		return "not followed unless you press y"
+	}
+	return fmt.Sprintf("not followed, the limit of %d was reached", redirectLimit(policy))
+}
+
+// redirectRequest is the request a redirect response leads to, nil when
+// its Location doesn't parse. Like browsers, 301 and 302 turn a POST into
+// a GET and 303 turns anything but HEAD into one, dropping the body;
+// credentials aren't sent on to another host, nor from https to http,
+// where anyone on the path could read them.
+func redirectRequest(r resolvedRequest, resp *http.Response, hops []redirectHop) *resolvedRequest {
+	target, err := resp.Request.URL.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		return nil
+	}
+	next := r
+	next.url, next.display = target.String(), target.String()
+	if code := resp.StatusCode; code == http.StatusSeeOther && r.method != "HEAD" ||
+		(code == http.StatusMovedPermanently || code == http.StatusFound) && r.method == "POST" {
+		next.method, next.body, next.displayBody, next.bodyFile = "GET", "", "", ""
+	}
+	keepCredentials := strings.EqualFold(target.Host, resp.Request.URL.Host) &&
+		(target.Scheme == "https" || resp.Request.URL.Scheme != "https")
+	next.headers, next.displayHeaders = nil, nil
+	for name, value := range r.headers {
+		switch strings.ToLower(name) {
+		case "authorization", "proxy-authorization", "cookie", "www-authenticate":
+			if !keepCredentials {
+				continue
+			}
+		case "content-type", "content-length":
+			if next.method != r.method {
+				continue
+			}
+		}
+		if next.headers == nil {
+			next.headers, next.displayHeaders = map[string]string{}, map[string]string{}
+		}
+		next.headers[name], next.displayHeaders[name] = value, r.displayHeaders[name]
+	}
+	next.redirectedFrom = hops
+	return &next
+}
+
+// renderRedirects lists the responses that led to a response and the
+// response itself, each with its status, URL, Location and the cookies it
+// set, and why the last redirect wasn't followed if it wasn't
+func renderRedirects(msg fetchMsg) string {
+	if len(msg.redirects) == 0 {
+		return ""
+	}
+	warn := lipgloss.NewStyle().Foreground(lipgloss.Color("#FFCC00"))
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s %d followed\n", headerStyle.Render("Redirects:"), len(msg.redirects)-1)
+	for _, h := range msg.redirects {
+		status := strconv.Itoa(h.Status)
+		if h.Location != "" {
+			status = warn.Render(status)
+		}
+		fmt.Fprintf(&sb, "  %s %s", status, h.URL)
+		if h.Location != "" {
+			fmt.Fprintf(&sb, " %s %s", historyDimStyle.Render("→"), h.Location)
+		}
+		if len(h.Cookies) > 0 {
+			sb.WriteString(historyDimStyle.Render("  sets " + strings.Join(h.Cookies, ", ")))
+		}
+		sb.WriteString("\n")
+	}
+	if msg.redirectStop != "" {
+		sb.WriteString(warn.Render("  " + msg.redirectStop))
+		sb.WriteString("\n")
+	}
+	sb.WriteString("\n")
+	return sb.String()
+}
+
+// promptRedirect asks whether to follow the redirect of a response when
+// its request is sent with -redirects prompt. The prompt takes all keys
+// until answered, so a y typed into the request isn't taken for one.
+func (m model) promptRedirect(msg fetchMsg) model {
+	m.redirectPrompt = nil
+	if msg.err != nil || msg.redirectNext == nil || msg.redirectNext.redirects != redirectsPrompt {
+		return m
+	}
+	m.redirectPrompt = msg.redirectNext
+	m.textInput.Blur()
+	m.notice = fmt.Sprintf("%d to %s %s", msg.statusCode, msg.redirectNext.display,
+		historyDimStyle.Render("• y: Follow • n/esc: Stay"))
+	return m
+}
+
+// updateRedirectPrompt handles keys while the redirect prompt is open
+func (m model) updateRedirectPrompt(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "ctrl+c":
+		return m, tea.Quit
+	case "y":
+		next := *m.redirectPrompt
+		line := next.method + " " + next.display
+		retry := func(m model) (model, tea.Cmd) { return m.send(next, line, nil) }
+		m.textInput.Focus()
+		return m.send(next, line, retry)
+	case "n", "esc":
+		m.redirectPrompt = nil
+		m.textInput.Focus()
+		m.notice = ""
+		return m, nil
+	}
+	return m, nil
+}
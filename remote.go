@@ -0,0 +1,235 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// remoteDir caches remote workspaces inside the data directory, each in a
+// directory named after a hash of its URL holding the fetched content and
+// the local state (history, schemas, chosen environment)
+const remoteDir = "remote"
+
+// remoteWorkspace and remoteState are the content and state directories
+// of the remote workspace opened with -remote, if any
+var remoteWorkspace, remoteState string
+
+// remoteWorkspaceName is set along with remoteWorkspace
+var remoteWorkspaceName string
+
+var errReadOnlyWorkspace = errors.New("remote workspaces are read-only")
+
+// allowRemoteSecretsUsage is the help of -allow-remote-secrets
+const allowRemoteSecretsUsage = "let the -remote workspace read secrets (env:, keychain:, vault:) and {{$env.…}} variables, which its requests could send anywhere"
+
+// allowRemoteSecrets is set with -allow-remote-secrets. Without it the
+// environments and requests of a remote workspace, which whoever controls
+// its URL wrote, can't read the user's secrets.
+var allowRemoteSecrets bool
+
+// remoteSecretsRefused is why the current workspace can't read secrets,
+// nil when it can
+func remoteSecretsRefused() error {
+	if isRemoteWorkspace(currentWorkspace) && !allowRemoteSecrets {
+		return fmt.Errorf("%s can't read secrets or environment variables, its requests could send them anywhere; start with -allow-remote-secrets if you trust it", remoteWorkspaceName)
+	}
+	return nil
+}
+
+func isRemoteWorkspace(name string) bool {
+	return remoteWorkspace != "" && name == remoteWorkspaceName
+}
+
+// openRemoteWorkspace fetches a workspace from a git repository or a
+// .tar.gz over HTTP and switches to it. The content is fetched fresh every
+// time; when that fails a previously cached copy is used and the failure
+// returned as warning.
+func openRemoteWorkspace(source string) (warning, err error) {
+	sum := sha1.Sum([]byte(source))
+	base := filepath.Join(dataDir(), remoteDir, hex.EncodeToString(sum[:6]))
+	content := filepath.Join(base, "content")
+	if err := os.MkdirAll(base, 0o700); err != nil {
+		return nil, err
+	}
+
+	if fetchErr := fetchRemoteWorkspace(source, base, content); fetchErr != nil {
+		if _, err := os.Stat(content); err != nil {
+			return nil, fmt.Errorf("fetching %s: %w", source, fetchErr)
+		}
+		info, _ := os.Stat(filepath.Join(base, "fetched"))
+		when := "an earlier run"
+		if info != nil {
+			when = info.ModTime().Format(time.DateTime)
+		}
+		warning = fmt.Errorf("fetching %s failed, using the copy from %s: %w", source, when, fetchErr)
+	}
+
+	remoteWorkspace = content
+	remoteState = filepath.Join(base, "state")
+	remoteWorkspaceName = "remote:" + remoteDisplayName(source)
+	currentWorkspace = remoteWorkspaceName
+	return warning, nil
+}
+
+// fetchRemoteWorkspace downloads source next to content and swaps it in
+// once complete, so a failed fetch leaves the cached copy alone
+func fetchRemoteWorkspace(source, base, content string) error {
+	tmp, err := os.MkdirTemp(base, "fetch-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	dest := filepath.Join(tmp, "src")
+	if isGitSource(source) {
+		err = cloneGit(source, dest)
+	} else {
+		err = downloadTarball(source, dest)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := os.RemoveAll(content); err != nil {
+		return err
+	}
+	if err := os.Rename(workspaceRoot(dest), content); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(base, "fetched"), []byte(source+"\n"), 0o600)
+}
+
+// isGitSource tells git repositories from tarballs. Repositories are
+// URLs ending in .git, SSH or git:// URLs, or URLs prefixed with git+.
+func isGitSource(source string) bool {
+	source, _, _ = strings.Cut(source, "#")
+	for _, prefix := range []string{"git+", "git@", "git://", "ssh://"} {
+		if strings.HasPrefix(source, prefix) {
+			return true
+		}
+	}
+	return strings.HasSuffix(source, ".git")
+}
+
+// cloneGit makes a shallow clone, of the branch or tag after # if given
+func cloneGit(source, dest string) error {
+	source, ref, _ := strings.Cut(strings.TrimPrefix(source, "git+"), "#")
+	args := []string{"clone", "--quiet", "--depth", "1"}
+	if ref != "" {
+		args = append(args, "--branch", ref)
+	}
+	cmd := exec.Command("git", append(args, "--", source, dest)...)
+	// Never wait for credentials on a terminal the TUI is about to take
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("git clone: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// downloadTarball fetches and unpacks a .tar.gz
+func downloadTarball(source, dest string) error {
+	client := &http.Client{Timeout: 2 * time.Minute}
+	resp, err := client.Get(source)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("server returned %s", resp.Status)
+	}
+
+	return extractTarball(resp.Body, dest)
+}
+
+// extractTarball unpacks a .tar.gz into dest. Only regular files and
+// directories are extracted, and nothing outside dest.
+func extractTarball(r io.Reader, dest string) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return fmt.Errorf("not a .tar.gz: %w", err)
+	}
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		name := filepath.FromSlash(hdr.Name)
+		if !filepath.IsLocal(name) {
+			return fmt.Errorf("archive entry %q escapes the workspace", hdr.Name)
+		}
+		path := filepath.Join(dest, name)
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(path, 0o700); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+				return err
+			}
+			f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(f, tr)
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// workspaceRoot finds the workspace in fetched content: a .lazyhttp
+// directory, a directory with collections or environments, or else the
+// top. Archives wrapping everything in one directory are looked into.
+func workspaceRoot(dir string) string {
+	for {
+		if info, err := os.Stat(filepath.Join(dir, projectDirName)); err == nil && info.IsDir() {
+			return filepath.Join(dir, projectDirName)
+		}
+		for _, name := range []string{collectionsDir, environmentsFile} {
+			if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+				return dir
+			}
+		}
+		entries, err := os.ReadDir(dir)
+		if err != nil || len(entries) != 1 || !entries[0].IsDir() {
+			return dir
+		}
+		dir = filepath.Join(dir, entries[0].Name())
+	}
+}
+
+// remoteDisplayName shortens a source URL for the status bar
+func remoteDisplayName(source string) string {
+	name := strings.TrimPrefix(source, "git+")
+	if _, rest, ok := strings.Cut(name, "://"); ok {
+		name = rest
+	}
+	name = strings.TrimPrefix(name, "git@")
+	name, ref, _ := strings.Cut(name, "#")
+	name = strings.TrimSuffix(strings.Replace(name, ":", "/", 1), ".git")
+	if ref != "" {
+		name += "#" + ref
+	}
+	return name
+}
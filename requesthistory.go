@@ -0,0 +1,402 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+const (
+	// requestHistoryFile records every change seen to the saved requests
+	// of the workspace's collections, one JSON object per line, kept in
+	// the state directory so it never travels with the workspace
+	requestHistoryFile = "request-history.jsonl"
+
+	// requestSnapshotFile holds the requests of each collection file as
+	// last seen, to tell what changed since
+	requestSnapshotFile = "request-snapshot.json"
+)
+
+// requestHistoryLimit is the number of changes kept
+const requestHistoryLimit = 1000
+
+// requestChange is a saved request being added, changed or removed in a
+// collection file
+type requestChange struct {
+	Time    time.Time       `json:"time"`
+	User    string          `json:"user"`
+	File    string          `json:"file"` // relative to the workspace
+	Folder  string          `json:"folder,omitempty"`
+	Request string          `json:"request"`
+	Old     json.RawMessage `json:"old,omitempty"` // nil when added
+	New     json.RawMessage `json:"new,omitempty"` // nil when removed
+
+	// Via is how the change came about: "edit" when the file was found
+	// changed on load, "save", "import" or "revert"
+	Via string `json:"via"`
+}
+
+// requestKey identifies a request within its collection file
+func requestKey(folder, name string) string {
+	return folder + "/" + name
+}
+
+// collectionFileKey is the file of a collection relative to the
+// workspace, "" for files outside it and .http files, which aren't tracked
+func collectionFileKey(path string) string {
+	if filepath.Ext(path) != ".json" {
+		return ""
+	}
+	rel, err := filepath.Rel(workspaceDir(), path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return ""
+	}
+	return filepath.ToSlash(rel)
+}
+
+// trackCollectionFile records how the requests of the collection file at
+// path differ from when it was last seen. The first time a file is seen
+// only its requests are noted. Nothing is recorded in incognito sessions.
+func trackCollectionFile(path string, requests []savedRequest, via string) error {
+	file := collectionFileKey(path)
+	if incognito || file == "" {
+		return nil
+	}
+	snapshotPath, err := workspaceFile(requestSnapshotFile)
+	if err != nil {
+		return err
+	}
+	snapshot := map[string]map[string]json.RawMessage{}
+	data, err := os.ReadFile(snapshotPath)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return err
+	default:
+		if err := json.Unmarshal(data, &snapshot); err != nil {
+			return fmt.Errorf("%s: %w", requestSnapshotFile, err)
+		}
+	}
+
+	now := map[string]json.RawMessage{}
+	var order []string
+	for _, r := range requests {
+		definition, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		key := requestKey(r.Folder, r.Name)
+		if _, dup := now[key]; !dup {
+			order = append(order, key)
+		}
+		now[key] = definition
+	}
+	old, known := snapshot[file]
+	for key, definition := range old {
+		// The snapshot is indented, the definitions are compared compact
+		var compact bytes.Buffer
+		if json.Compact(&compact, definition) == nil {
+			old[key] = compact.Bytes()
+		}
+	}
+	if known {
+		var changes []requestChange
+		record := func(key string, before, after json.RawMessage) {
+			if bytes.Equal(before, after) {
+				return
+			}
+			// Folders nest with slashes too, the name is after the last
+			i := strings.LastIndex(key, "/")
+			changes = append(changes, requestChange{Time: time.Now(), User: localUser(), File: file,
+				Folder: key[:i], Request: key[i+1:], Old: before, New: after, Via: via})
+		}
+		for _, key := range order {
+			record(key, old[key], now[key])
+		}
+		for _, key := range sortedKeys(old) {
+			if _, ok := now[key]; !ok {
+				record(key, old[key], nil)
+			}
+		}
+		if err := appendRequestHistory(changes); err != nil {
+			return err
+		}
+		if len(changes) == 0 {
+			return nil
+		}
+	}
+	snapshot[file] = now
+	out, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(snapshotPath, out, 0o600)
+}
+
+// appendRequestHistory adds changes to the history file, dropping the
+// oldest beyond requestHistoryLimit
+func appendRequestHistory(changes []requestChange) error {
+	if len(changes) == 0 {
+		return nil
+	}
+	history, err := loadRequestHistory()
+	if err != nil {
+		return err
+	}
+	path, err := workspaceFile(requestHistoryFile)
+	if err != nil {
+		return err
+	}
+	flags := os.O_APPEND | os.O_CREATE | os.O_WRONLY
+	if len(history)+len(changes) > requestHistoryLimit {
+		changes = append(history, changes...)
+		changes = changes[len(changes)-requestHistoryLimit:]
+		flags = os.O_TRUNC | os.O_CREATE | os.O_WRONLY
+	}
+	var buf []byte
+	for _, c := range changes {
+		data, err := json.Marshal(c)
+		if err != nil {
+			return err
+		}
+		buf = append(append(buf, data...), '\n')
+	}
+	file, err := os.OpenFile(path, flags, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(buf); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// loadRequestHistory reads the changes recorded in the workspace, oldest
+// first
+func loadRequestHistory() ([]requestChange, error) {
+	path, err := workspaceFile(requestHistoryFile)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var history []requestChange
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 4<<20)
+	for scanner.Scan() {
+		var c requestChange
+		// Skip lines that don't parse, e.g. one cut short by a crash
+		if json.Unmarshal(scanner.Bytes(), &c) == nil {
+			history = append(history, c)
+		}
+	}
+	return history, scanner.Err()
+}
+
+// requestChanges are the recorded changes of a saved request, newest first
+func requestChanges(r savedRequest) ([]requestChange, error) {
+	history, err := loadRequestHistory()
+	if err != nil {
+		return nil, err
+	}
+	file := collectionFileKey(r.file)
+	var changes []requestChange
+	for i := len(history) - 1; i >= 0; i-- {
+		c := history[i]
+		if c.File == file && c.Folder == r.Folder && c.Request == r.Name {
+			changes = append(changes, c)
+		}
+	}
+	return changes, nil
+}
+
+// revertRequest sets a saved request back to its definition after change
+// c. The revert is recorded like any other change.
+func revertRequest(c requestChange) error {
+	if c.New == nil {
+		return errors.New("the request was removed then, pick an earlier revision")
+	}
+	if isRemoteWorkspace(currentWorkspace) {
+		return errReadOnlyWorkspace
+	}
+	var restored savedRequest
+	if err := json.Unmarshal(c.New, &restored); err != nil {
+		return err
+	}
+	path := filepath.Join(workspaceDir(), filepath.FromSlash(c.File))
+	coll, err := loadCollection(path)
+	if err != nil {
+		return err
+	}
+	replaced := false
+	for i := range coll.Requests {
+		if coll.Requests[i].Folder == c.Folder && coll.Requests[i].Name == c.Request {
+			coll.Requests[i] = restored
+			replaced = true
+		}
+	}
+	if !replaced {
+		coll.Requests = append(coll.Requests, restored)
+	}
+	return writeCollectionVia(path, coll, "revert")
+}
+
+// describeRequestChange says what a change did to a request, by the
+// fields that differ
+func describeRequestChange(c requestChange) string {
+	switch {
+	case c.Old == nil:
+		return "added"
+	case c.New == nil:
+		return "removed"
+	}
+	var before, after map[string]json.RawMessage
+	json.Unmarshal(c.Old, &before)
+	json.Unmarshal(c.New, &after)
+	var fields []string
+	for _, name := range sortedKeys(after) {
+		if !bytes.Equal(before[name], after[name]) {
+			fields = append(fields, name)
+		}
+	}
+	for _, name := range sortedKeys(before) {
+		if _, ok := after[name]; !ok {
+			fields = append(fields, name)
+		}
+	}
+	return "changed " + strings.Join(fields, ", ")
+}
+
+// requestDefinitionLines are the lines of a request definition as
+// indented JSON, to diff by line
+func requestDefinitionLines(definition json.RawMessage) []string {
+	if definition == nil {
+		return nil
+	}
+	var out bytes.Buffer
+	if json.Indent(&out, definition, "", "  ") != nil {
+		return strings.Split(string(definition), "\n")
+	}
+	return strings.Split(out.String(), "\n")
+}
+
+// requestRevisions lists the recorded changes of a saved request, to
+// compare its current definition with earlier ones and go back to one
+type requestRevisions struct {
+	request savedRequest
+	current json.RawMessage // the definition as it is now
+	changes []requestChange // newest first
+	idx     int
+	err     error
+}
+
+// openRequestRevisions shows the recorded changes of a saved request
+func (m model) openRequestRevisions(r savedRequest) model {
+	changes, err := requestChanges(r)
+	if collectionFileKey(r.file) == "" {
+		err = errors.New("only collection files in the workspace are tracked, not " + filepath.Base(r.file))
+	}
+	current, _ := json.Marshal(r)
+	m.requestRevisions = &requestRevisions{request: r, current: current, changes: changes, err: err}
+	return m
+}
+
+// updateRequestRevisions handles keys while the changes of a request are
+// listed
+func (m model) updateRequestRevisions(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	p := m.requestRevisions
+	switch msg.String() {
+	case "ctrl+c":
+		return m, tea.Quit
+	case "esc", "v":
+		m.requestRevisions = nil
+		return m, nil
+	case "up", "k":
+		if p.idx > 0 {
+			p.idx--
+		}
+	case "down", "j":
+		if p.idx < len(p.changes)-1 {
+			p.idx++
+		}
+	case "r":
+		if p.idx >= len(p.changes) {
+			return m, nil
+		}
+		c := p.changes[p.idx]
+		if err := revertRequest(c); err != nil {
+			p.err = err
+			return m, nil
+		}
+		m.notice = fmt.Sprintf("Reverted %q to how it was on %s", c.Request, c.Time.Local().Format("Jan 2 15:04"))
+		m.requestRevisions = nil
+		if m.sidebar.open {
+			m.sidebar = m.sidebar.reload()
+		}
+	}
+	return m, nil
+}
+
+// renderRequestRevisions lists the changes of a request, newest first,
+// and how the current definition differs from the selected revision
+func renderRequestRevisions(p *requestRevisions, height int) string {
+	var sb strings.Builder
+	sb.WriteString(headerStyle.Render("Revisions of " + itemPath(p.request)))
+	sb.WriteString("\n\n")
+	if p.err != nil {
+		sb.WriteString(errorStyle.Render("Error: " + p.err.Error()))
+		sb.WriteString("\n\n")
+	}
+	if len(p.changes) == 0 {
+		sb.WriteString(historyDimStyle.Render("No changes recorded yet. Saves are recorded as they happen, and edits to collection files when lazyhttp next lists them."))
+		sb.WriteString("\n")
+		sb.WriteString(historyDimStyle.Render("\nEsc: Back"))
+		return sb.String()
+	}
+
+	// Half the height lists the revisions, the rest shows the diff
+	rows := max(height/2-3, 1)
+	first := min(max(p.idx-rows/2, 0), max(len(p.changes)-rows, 0))
+	for i := first; i < min(first+rows, len(p.changes)); i++ {
+		c := p.changes[i]
+		line := fmt.Sprintf("%s %s %s", c.Time.Local().Format("Jan 2 15:04"), describeRequestChange(c),
+			historyDimStyle.Render("("+c.User+", "+c.Via+")"))
+		if i == p.idx {
+			sb.WriteString(selectedSuggestionStyle.Render("› ") + line)
+		} else {
+			sb.WriteString("  " + line)
+		}
+		sb.WriteString("\n")
+	}
+
+	c := p.changes[p.idx]
+	sb.WriteString("\n")
+	diff := diffLines(requestDefinitionLines(c.New), requestDefinitionLines(p.current))
+	if len(diff) == 0 {
+		sb.WriteString(historyDimStyle.Render("The current definition is the same as after this change."))
+		sb.WriteString("\n")
+	} else {
+		sb.WriteString(headerStyle.Render("Since then"))
+		sb.WriteString(historyDimStyle.Render(" (− after this change, + now)"))
+		sb.WriteString("\n")
+		writeDiffLines(&sb, diff)
+	}
+	sb.WriteString(historyDimStyle.Render("\n↑/↓: Select • r: Revert to it • Esc: Back"))
+	return sb.String()
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// connectOverrides send the connections of requests to given addresses
+// instead of what their hosts resolve to, like curl --resolve, keeping the
+// URL's host for the Host header, SNI and certificate checks. Keys are
+// host:port, or a bare host for every port; values are an address,
+// optionally with a port.
+type connectOverrides map[string]string
+
+// defaultResolve is set with -resolve and applies to every request; saved
+// requests add theirs
+var defaultResolve connectOverrides
+
+// parseResolveFlag reads a -resolve flag in curl's host:port:address form
+func parseResolveFlag(s string) error {
+	host, rest, ok := strings.Cut(s, ":")
+	port, addr, ok2 := strings.Cut(rest, ":")
+	if !ok || !ok2 || host == "" || port == "" || addr == "" {
+		return fmt.Errorf("expected host:port:address, like api.example.com:443:203.0.113.10, got %q", s)
+	}
+	if defaultResolve == nil {
+		defaultResolve = connectOverrides{}
+	}
+	defaultResolve[strings.ToLower(net.JoinHostPort(host, port))] = strings.Trim(addr, "[]")
+	return nil
+}
+
+// merge returns o with the overrides of other taking precedence
+func (o connectOverrides) merge(other map[string]string) connectOverrides {
+	if len(other) == 0 {
+		return o
+	}
+	merged := make(connectOverrides, len(o)+len(other))
+	for k, v := range o {
+		merged[k] = v
+	}
+	for k, v := range other {
+		merged[strings.ToLower(k)] = v
+	}
+	return merged
+}
+
+// target is where a connection to addr (host:port) goes, "" for the
+// address itself, unix: and a path for a Unix domain socket
+func (o connectOverrides) target(addr string) string {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return ""
+	}
+	to, ok := o[strings.ToLower(addr)]
+	if !ok {
+		if to, ok = o[strings.ToLower(host)]; !ok {
+			return ""
+		}
+	}
+	if strings.HasPrefix(to, unixSocketTarget) {
+		return to
+	}
+	if _, _, err := net.SplitHostPort(to); err != nil {
+		to = net.JoinHostPort(strings.Trim(to, "[]"), port)
+	}
+	return to
+}
+
+// requestAddr is the host:port a URL connects to
+func requestAddr(u *url.URL) string {
+	port := u.Port()
+	if port == "" {
+		port = "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+	}
+	return net.JoinHostPort(u.Hostname(), port)
+}
+
+// dialContext dials through d, to the overriding addresses
+func (o connectOverrides) dialContext(d *net.Dialer) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	if len(o) == 0 {
+		return d.DialContext
+	}
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		to := o.target(addr)
+		if socket, ok := strings.CutPrefix(to, unixSocketTarget); ok {
+			return d.DialContext(ctx, "unix", socket)
+		}
+		if to != "" {
+			addr = to
+		}
+		return d.DialContext(ctx, network, addr)
+	}
+}
+
+// String lists the overrides in a stable order, also keying the transports
+// they are dialed with
+func (o connectOverrides) String() string {
+	var pairs []string
+	for k, v := range o {
+		pairs = append(pairs, k+" → "+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ", ")
+}
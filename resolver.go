@@ -0,0 +1,237 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// customResolver resolves the hosts of requests when -resolver is set, nil
+// leaving them to the system resolver. resolverName describes it.
+var (
+	customResolver *net.Resolver
+	resolverName   string
+)
+
+// resolverUsage is the help of -resolver
+const resolverUsage = "resolve hosts with this DNS `server`: host[:port], tcp://host[:port] or a DNS-over-HTTPS https:// URL (default the system's)"
+
+// Limits of DNS-over-HTTPS queries
+const (
+	dohTimeout     = 5 * time.Second
+	maxDNSResponse = 64 << 10
+)
+
+// parseResolverFlag sets customResolver from -resolver: a nameserver as
+// host[:port], queried over UDP falling back to TCP for long answers,
+// tcp://host[:port] for TCP only, or the https:// URL of a DNS-over-HTTPS
+// endpoint (RFC 8484). /etc/hosts still applies.
+func parseResolverFlag(s string) error {
+	s = strings.TrimSpace(s)
+	switch {
+	case s == "" || s == "system":
+		customResolver, resolverName = nil, ""
+		return nil
+	case strings.HasPrefix(s, "https://"):
+		u, err := url.Parse(s)
+		if err != nil || u.Host == "" {
+			return fmt.Errorf("invalid DNS-over-HTTPS URL %q", s)
+		}
+		customResolver, resolverName = newDoHResolver(u.String()), "DNS over HTTPS "+u.String()
+		return nil
+	case strings.HasPrefix(s, "http://"):
+		return errors.New("DNS over HTTPS needs an https:// URL")
+	}
+	network := ""
+	addr := s
+	if rest, ok := strings.CutPrefix(s, "tcp://"); ok {
+		network, addr = "tcp", rest
+	} else {
+		addr = strings.TrimPrefix(s, "udp://")
+	}
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(strings.Trim(addr, "[]"), "53")
+	}
+	if host, _, _ := net.SplitHostPort(addr); host == "" {
+		return fmt.Errorf("invalid resolver %q, use host[:port], tcp://host[:port] or an https:// URL", s)
+	}
+	customResolver = newNameserverResolver(network, addr)
+	resolverName = addr
+	if network == "tcp" {
+		resolverName += " over TCP"
+	}
+	return nil
+}
+
+// newNameserverResolver queries the nameserver at addr instead of those of
+// /etc/resolv.conf, over the network given or the one Go asks for
+func newNameserverResolver(network, addr string) *net.Resolver {
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, asked, _ string) (net.Conn, error) {
+			if network != "" {
+				asked = network
+			}
+			var d net.Dialer
+			return d.DialContext(ctx, asked, addr)
+		},
+	}
+}
+
+// newDoHResolver sends the queries of Go's resolver to a DNS-over-HTTPS
+// endpoint. The resolver talks DNS over a stream, each message prefixed
+// with its length, to the end of a pipe that posts them. The endpoint
+// itself is resolved by the system.
+func newDoHResolver(endpoint string) *net.Resolver {
+	client := &http.Client{Timeout: dohTimeout}
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			conn, server := net.Pipe()
+			go serveDoH(ctx, client, endpoint, server)
+			return conn, nil
+		},
+	}
+}
+
+// serveDoH answers the queries written to conn from endpoint. Failures
+// are answered with SERVFAIL, what a nameserver does, and kept for the
+// DNS panel.
+func serveDoH(ctx context.Context, client *http.Client, endpoint string, conn net.Conn) {
+	defer conn.Close()
+	for {
+		var size [2]byte
+		if _, err := io.ReadFull(conn, size[:]); err != nil {
+			return
+		}
+		query := make([]byte, binary.BigEndian.Uint16(size[:]))
+		if _, err := io.ReadFull(conn, query); err != nil {
+			return
+		}
+		answer, err := queryDoH(ctx, client, endpoint, query)
+		recordDoHError(err)
+		if err != nil {
+			if answer = servFail(query); answer == nil {
+				return
+			}
+		}
+		binary.BigEndian.PutUint16(size[:], uint16(len(answer)))
+		if _, err := conn.Write(append(size[:], answer...)); err != nil {
+			return
+		}
+	}
+}
+
+// queryDoH posts a DNS message to endpoint (RFC 8484)
+func queryDoH(ctx context.Context, client *http.Client, endpoint string, query []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(query))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/dns-message")
+	req.Header.Set("Accept", "application/dns-message")
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("DNS over HTTPS: %s answered %s", endpoint, resp.Status)
+	}
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "application/dns-message") {
+		return nil, fmt.Errorf("DNS over HTTPS: %s answered %q, not application/dns-message", endpoint, ct)
+	}
+	answer, err := io.ReadAll(io.LimitReader(resp.Body, maxDNSResponse))
+	if err != nil {
+		return nil, err
+	}
+	if len(answer) < 12 {
+		return nil, fmt.Errorf("DNS over HTTPS: %s answered a truncated message", endpoint)
+	}
+	return answer, nil
+}
+
+// servFail is the SERVFAIL answer to a query: its header and question
+// with the response flag and code set, nil for a malformed query
+func servFail(query []byte) []byte {
+	if len(query) < 12 {
+		return nil
+	}
+	end := questionEnd(query)
+	if end == 0 {
+		return nil
+	}
+	// The question alone, without the EDNS record of the query
+	answer := bytes.Clone(query[:end])
+	answer[2] |= 0x80                 // QR, a response
+	answer[3] = answer[3]&0xf0 | 0x02 // RCODE 2, SERVFAIL
+	clear(answer[6:12])               // no answer, authority or additional records
+	return answer
+}
+
+// questionEnd is the offset past the first question of a message, 0 when
+// it can't be read
+func questionEnd(msg []byte) int {
+	i := 12
+	for i < len(msg) && msg[i] != 0 {
+		if msg[i]&0xc0 != 0 {
+			return 0
+		}
+		i += int(msg[i]) + 1
+	}
+	if i+5 > len(msg) {
+		return 0
+	}
+	return i + 5
+}
+
+// lastDoHError is the last failure of a DNS-over-HTTPS query, nil once
+// one succeeds again
+var (
+	dohMu        sync.Mutex
+	lastDoHError error
+)
+
+func recordDoHError(err error) {
+	dohMu.Lock()
+	lastDoHError = err
+	dohMu.Unlock()
+}
+
+func dohError() error {
+	dohMu.Lock()
+	defer dohMu.Unlock()
+	return lastDoHError
+}
+
+// describeResolverError names -resolver in lookup errors, which give the
+// nameserver of /etc/resolv.conf Go meant to dial instead, and the DNS over
+// HTTPS failure behind a SERVFAIL
+func describeResolverError(err error) error {
+	var dnsErr *net.DNSError
+	if customResolver == nil || !errors.As(err, &dnsErr) {
+		return err
+	}
+	dnsErr.Server = resolverName
+	if doh := dohError(); doh != nil && !dnsErr.IsNotFound {
+		dnsErr.Err = doh.Error()
+	}
+	return err
+}
+
+// activeResolver is the resolver requests use
+func activeResolver() *net.Resolver {
+	if customResolver != nil {
+		return customResolver
+	}
+	return net.DefaultResolver
+}
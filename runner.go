@@ -0,0 +1,631 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// runResult is the outcome of one request in a headless run
+type runResult struct {
+	Name      string   `json:"name"`
+	Method    string   `json:"method"`
+	URL       string   `json:"url"`
+	Status    int      `json:"status"`
+	LatencyMs int64    `json:"latency_ms"`
+	SizeBytes int64    `json:"size_bytes"`
+	Error     string   `json:"error,omitempty"`
+	Failures  []string `json:"failures,omitempty"`
+	Retries   int      `json:"retries,omitempty"`
+
+	// ThrottledMs is how long the request waited for the rate limit of
+	// its host, which LatencyMs leaves out
+	ThrottledMs int64 `json:"throttled_ms,omitempty"`
+
+	// Drift lists schema changes since the previous run; informational,
+	// it doesn't fail the request
+	Drift []string `json:"schema_drift,omitempty"`
+
+	// Redirects are the responses of a redirect chain, the final one
+	// last, and RedirectStop why its last redirect wasn't followed
+	Redirects    []redirectHop `json:"redirects,omitempty"`
+	RedirectStop string        `json:"redirect_stop,omitempty"`
+
+	// vars are the values the request extracted from its response
+	vars map[string]string
+
+	// sent is when the request was sent, zero when it was skipped
+	sent time.Time
+}
+
+func (r runResult) passed() bool {
+	return r.Error == "" && len(r.Failures) == 0
+}
+
+// runReport is the machine-readable summary written with -report-json
+type runReport struct {
+	Collection string      `json:"collection"`
+	StartedAt  time.Time   `json:"started_at"`
+	DurationMs int64       `json:"duration_ms"`
+	Passed     int         `json:"passed"`
+	Failed     int         `json:"failed"`
+	Results    []runResult `json:"results"`
+
+	// Circuits lists the hosts whose circuit breaker is open at the end
+	Circuits []circuitReport `json:"open_circuits,omitempty"`
+
+	// samples are recorded for monitoring with -record
+	samples []monitorSample
+}
+
+// runCommand implements `lazyhttp run`: execute a collection without the
+// TUI, check each request's budgets and exit non-zero on any failure
+func runCommand(args []string) int {
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	jsonPath := fs.String("report-json", "", "write a JSON report to `file`")
+	junitPath := fs.String("report-junit", "", "write a JUnit XML report to `file`")
+	var opts runOptions
+	fs.IntVar(&opts.parallel, "parallel", 1, "number of requests in flight at once")
+	fs.IntVar(&opts.perHost, "per-host", 0, "maximum concurrent requests per host (0 means no limit)")
+	fs.IntVar(&opts.retries, "retries", 0, "retry idempotent requests failing with a network error, 429 or 5xx up to `N` times, within a budget of a fifth of the run's requests")
+	breakerThreshold := fs.Int("breaker", 5, "stop sending to a host after `N` consecutive network errors, 429 or 5xx responses (0 disables)")
+	breakerCooldown := fs.Duration("breaker-cooldown", 30*time.Second, "time before a host whose circuit opened is probed again")
+	fs.BoolVar(&opts.record, "record", false, "add the latency and outcome of each request to the workspace's monitoring log, for scheduled runs")
+	env := fs.String("env", "", "resolve {{variables}} against the named environment of the current workspace")
+	fs.StringVar(&activeSession, "session", "", "send requests in the named session, unless they name their own")
+	fs.Func("var", "set a template variable (`name=value`, repeatable)", parseVarFlag)
+	registerTimeoutFlags(fs, &defaultTimeouts)
+	fs.Func("http-version", "force the HTTP `version` of requests, 1.1, 2 or 3 (default negotiated)", parseHTTPVersionFlag)
+	fs.Func("redirects", redirectsUsage, parseRedirectsFlag)
+	fs.Func("proxy", proxyUsage, parseProxyFlag)
+	fs.BoolFunc("insecure", insecureUsage, parseInsecureFlag)
+	fs.Func("cacert", cacertUsage, parseCACertFlag)
+	fs.Func("tls-min", tlsMinUsage, parseTLSMinFlag)
+	fs.Func("tls-max", tlsMaxUsage, parseTLSMaxFlag)
+	fs.Func("ciphers", ciphersUsage, parseCiphersFlag)
+	fs.Func("pin", pinUsage, parsePinFlag)
+	fs.Func("resolve", "connect to another address than a host resolves to, `host:port:address` as with curl (repeatable)", parseResolveFlag)
+	fs.Func("resolver", resolverUsage, parseResolverFlag)
+	fs.Func("rate-limit", "hold requests to a host to a rate, `host=rate` like api.example.com=2/s (repeatable)", parseRateLimitFlag)
+	remote := fs.String("remote", "", "use a read-only workspace from a git `URL` or .tar.gz URL")
+	fs.BoolVar(&allowRemoteSecrets, "allow-remote-secrets", false, allowRemoteSecretsUsage)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: lazyhttp run [flags] <collection.json | file.http | collection name>\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+	if insecureTLS.Load() {
+		fmt.Fprintln(os.Stderr, "Warning: -insecure: server certificates are not verified")
+	}
+
+	if *remote != "" {
+		warning, err := openRemoteWorkspace(*remote)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 2
+		}
+		if warning != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", warning)
+		}
+	}
+
+	// Headless runs only use the environment they are told to, not the one
+	// last picked in the TUI
+	err := loadEnvironments()
+	activeEnvironment = ""
+	if err == nil && *env != "" {
+		if findEnvironment(*env) == nil {
+			err = fmt.Errorf("no environment %q in %s", *env, filepath.Join(workspaceDir(), environmentsFile))
+		}
+		activeEnvironment = *env
+	}
+
+	// Collections of the workspace can be given by name
+	path := fs.Arg(0)
+	if _, statErr := os.Stat(path); errors.Is(statErr, os.ErrNotExist) {
+		if _, nameErr := os.Stat(collectionPath(path)); nameErr == nil {
+			path = collectionPath(path)
+		}
+	}
+	var c *collection
+	if err == nil {
+		c, err = loadCollection(path)
+	}
+	if err == nil {
+		err = c.validateDependencies()
+	}
+	if err == nil {
+		err = loadRateLimits()
+	}
+	if err == nil {
+		opts.breakers, err = loadCircuitBreakers(*breakerThreshold, *breakerCooldown)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+
+	report := runCollection(c, opts)
+	printRunSummary(os.Stdout, report)
+	if err := recordMonitorSamples(report.samples); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: recording samples: %v\n", err)
+	}
+	if err := opts.breakers.save(); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: saving circuit breakers: %v\n", err)
+	}
+
+	if *jsonPath != "" {
+		if err := writeJSONReport(*jsonPath, report); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing JSON report: %v\n", err)
+			return 2
+		}
+	}
+	if *junitPath != "" {
+		if err := writeJUnitReport(*junitPath, report); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing JUnit report: %v\n", err)
+			return 2
+		}
+	}
+
+	if report.Failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// runOptions controls the concurrency of a headless run, how it copes
+// with failing hosts and whether it is recorded for monitoring
+type runOptions struct {
+	parallel int              // requests in flight at once, at least 1
+	perHost  int              // concurrent requests per host, 0 for no limit
+	retries  int              // retries of an idempotent request, see retryBudget
+	breakers *circuitBreakers // nil when disabled
+	record   bool             // keep monitorSamples of the requests sent
+
+	// vars take precedence over the environment and -var flags, for runs
+	// started through the API of `lazyhttp serve`
+	vars map[string]string
+}
+
+// runCollection sends the requests of c through a pool of opts.parallel
+// workers. A request starts once all of its dependencies have passed and a
+// slot for its host is free; results keep the collection order.
+func runCollection(c *collection, opts runOptions) runReport {
+	report := runReport{Collection: c.Name, StartedAt: time.Now()}
+	ctx := variableContext().withVariables("API", opts.vars)
+
+	// Values extracted by requests that have completed, for the requests
+	// depending on them
+	var varsMu sync.Mutex
+	extracted := map[string]string{}
+
+	if opts.parallel < 1 {
+		opts.parallel = 1
+	}
+	workers := make(chan struct{}, opts.parallel)
+	budget := newRetryBudget(len(c.Requests))
+
+	var hostMu sync.Mutex
+	hostSlots := map[string]chan struct{}{}
+	hostSlot := func(rawURL string) chan struct{} {
+		if opts.perHost <= 0 {
+			return nil
+		}
+		host := rawURL
+		if u, err := url.Parse(rawURL); err == nil {
+			host = u.Host
+		}
+		hostMu.Lock()
+		defer hostMu.Unlock()
+		if hostSlots[host] == nil {
+			hostSlots[host] = make(chan struct{}, opts.perHost)
+		}
+		return hostSlots[host]
+	}
+
+	// done[i] is closed once request i has a result; sent[i] is when it
+	// was sent, zero when it was skipped
+	results := make([]runResult, len(c.Requests))
+	sent := make([]time.Time, len(c.Requests))
+	done := make([]chan struct{}, len(c.Requests))
+	index := map[string]int{}
+	for i, r := range c.Requests {
+		done[i] = make(chan struct{})
+		index[r.Name] = i
+	}
+
+	var wg sync.WaitGroup
+	for i, r := range c.Requests {
+		wg.Add(1)
+		go func(i int, r savedRequest) {
+			defer wg.Done()
+			defer close(done[i])
+
+			for _, dep := range r.DependsOn {
+				j := index[dep]
+				<-done[j]
+				if !results[j].passed() {
+					results[i] = runResult{Name: r.Name, Method: r.method(), URL: r.URL,
+						Error: fmt.Sprintf("skipped: dependency %q failed", dep)}
+					return
+				}
+			}
+
+			varsMu.Lock()
+			vars := make(map[string]string, len(extracted))
+			for k, v := range extracted {
+				vars[k] = v
+			}
+			varsMu.Unlock()
+
+			resolved := resolveSavedRequest(r, ctx.withVariables("extracted", vars))
+			if len(resolved.missing) > 0 {
+				var problems []string
+				for _, u := range resolved.missing {
+					problems = append(problems, fmt.Sprintf("{{%s}}: %v", u.name, u.err))
+				}
+				results[i] = runResult{Name: r.Name, Method: r.method(), URL: r.URL,
+					Error: "unresolved " + strings.Join(problems, ", ")}
+				return
+			}
+			schemaKey := savedRequestSchemaKey(c.Name, r)
+			r.URL, r.Headers, r.Body, r.BodyFile = resolved.url, resolved.headers, resolved.body, resolved.bodyFile
+			r.Resolve, r.Proxy = resolved.resolve, resolved.proxy
+			r.Timeouts, r.HTTPVersion, r.Redirects = &resolved.timeouts, resolved.httpVersion, resolved.redirects
+
+			// Take the host slot before a worker so a busy host doesn't
+			// hold workers that other hosts could use
+			if slot := hostSlot(r.URL); slot != nil {
+				slot <- struct{}{}
+				defer func() { <-slot }()
+			}
+			workers <- struct{}{}
+			defer func() { <-workers }()
+
+			host := requestHost(r.URL)
+			if ok, why := opts.breakers.allow(host); !ok {
+				opts.breakers.skip(host)
+				results[i] = runResult{Name: r.Name, Method: r.method(), URL: resolved.display, Error: "skipped: " + why}
+				return
+			}
+			sent[i] = time.Now()
+			for attempt := 0; ; attempt++ {
+				results[i] = runRequest(r, schemaKey)
+				results[i].Retries = attempt
+				failed := breakerFailure(results[i])
+				opts.breakers.record(host, failed)
+				if !failed || attempt == opts.retries || !idempotentMethod(r.method()) {
+					break
+				}
+				if ok, _ := opts.breakers.allow(host); !ok || !budget.take() {
+					break
+				}
+				time.Sleep(retryBackoff << attempt)
+			}
+			if sess, _ := requestSession(resolved.session, resolved.url); sess != nil && results[i].Status != 0 {
+				if err := sess.update(resolved); err != nil {
+					fmt.Fprintf(os.Stderr, "Warning: saving session %q: %v\n", sess.Name, err)
+				}
+			}
+			// Reports show the URL with secrets masked
+			results[i].URL = resolved.display
+			if len(results[i].Redirects) > 0 {
+				results[i].Redirects[0].URL = resolved.display
+			}
+			if results[i].Error != "" {
+				results[i].Error = maskSecrets(errors.New(results[i].Error), resolved.url, resolved.display).Error()
+			}
+
+			varsMu.Lock()
+			for k, v := range results[i].vars {
+				extracted[k] = v
+			}
+			varsMu.Unlock()
+		}(i, r)
+	}
+	wg.Wait()
+
+	for i, result := range results {
+		results[i].sent = sent[i]
+		if result.passed() {
+			report.Passed++
+		} else {
+			report.Failed++
+		}
+		if opts.record && !sent[i].IsZero() {
+			report.samples = append(report.samples, monitorSample{
+				Key:       savedRequestSchemaKey(c.Name, c.Requests[i]),
+				Time:      sent[i],
+				LatencyMs: result.LatencyMs,
+				Status:    result.Status,
+				Failed:    !result.passed(),
+			})
+		}
+	}
+	report.Results = results
+	report.Circuits = opts.breakers.report()
+	report.DurationMs = time.Since(report.StartedAt).Milliseconds()
+	return report
+}
+
+// maxSchemaBody bounds how much of a JSON body is kept for schema tracking
+const maxSchemaBody = 10 << 20
+
+// runRequest sends a single request and checks it against its budgets.
+// Latency covers everything up to the last body byte. JSON bodies are
+// tracked for schema drift under schemaKey.
+func runRequest(r savedRequest, schemaKey string) runResult {
+	result := runResult{Name: r.Name, Method: r.method(), URL: r.URL}
+	timeouts := defaultTimeouts.merge(r.Timeouts)
+
+	var body io.Reader
+	var contentType string
+	var bodySize int64
+	switch {
+	case r.BodyFile != "":
+		file, n, ct, err := openUploadBody(r.BodyFile)
+		if err != nil {
+			result.Error = err.Error()
+			return result
+		}
+		defer file.Close()
+		body, contentType, bodySize = file, ct, n
+	case r.Body != "":
+		body = strings.NewReader(r.Body)
+	}
+	var throttled time.Duration
+	ctx, cancel := timeouts.withTotalTimeout(context.Background())
+	defer cancel()
+	ctx = withThrottleNotice(ctx, func(_ string, _ rateLimit, wait time.Duration) {
+		throttled += wait
+	})
+	target, resolve, err := unixSocketRequest(r.URL, defaultResolve.merge(r.Resolve))
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	req, err := http.NewRequestWithContext(ctx, r.method(), target, body)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	req.Header.Set("User-Agent", defaultUserAgent)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+		req.ContentLength = bodySize
+	}
+	version, err := parseHTTPVersion(r.HTTPVersion)
+	if r.HTTPVersion == "" {
+		version = defaultHTTPVersion
+	}
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	redirects, err := parseRedirects(r.Redirects)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	client := newHTTPClient(timeouts, version, resolve, r.Proxy)
+	var hops []redirectHop
+	client.CheckRedirect = redirectChecker(redirects, &hops)
+	sess, err := requestSession(r.sessionName(), r.URL)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	if sess != nil {
+		sess.apply(req, client)
+	}
+	for k, v := range r.Headers {
+		req.Header.Set(k, v)
+	}
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil && ctx.Err() != nil {
+		result.Error = fmt.Sprintf("%v, no response yet", errTotalTimeout(timeouts.total()))
+		return result
+	}
+	if err != nil {
+		result.Error = describeHTTP2Error(describeTimeout(describeHandshakeError(describeCertificateError(describeResolverError(err))), timeouts)).Error()
+		return result
+	}
+	resp.Body = withIdleTimeout(resp.Body, timeouts.idle())
+	if result.RedirectStop = redirectStopped(redirects, resp); len(hops) > 0 || result.RedirectStop != "" {
+		result.Redirects = append(hops, responseHop(resp))
+	}
+	// Nobody is there to ask in a headless run
+	if redirects == redirectsPrompt && result.RedirectStop != "" {
+		result.RedirectStop = "not followed, only the TUI asks whether to"
+	}
+	var kept bytes.Buffer
+	var sink io.Writer = io.Discard
+	if len(r.Extract) > 0 || r.OpenAPI != nil || strings.Contains(strings.ToLower(resp.Header.Get("Content-Type")), "json") {
+		sink = &limitedBuffer{buf: &kept, limit: maxSchemaBody}
+	}
+	size, err := io.Copy(sink, resp.Body)
+	resp.Body.Close()
+	result.LatencyMs = (time.Since(start) - throttled).Milliseconds()
+	result.ThrottledMs = throttled.Milliseconds()
+	result.Status = resp.StatusCode
+	result.SizeBytes = size
+	if err != nil && ctx.Err() != nil {
+		result.Error = fmt.Sprintf("%v, %s of the body received", errTotalTimeout(timeouts.total()), formatBytes(size))
+		return result
+	}
+	if err != nil {
+		result.Error = describeHTTP2Error(err).Error()
+		return result
+	}
+
+	if kept.Len() > 0 && int64(kept.Len()) == size {
+		result.Drift, _ = trackSchema(schemaKey, kept.Bytes())
+	}
+
+	if e := r.Expect; e != nil {
+		result.Failures = append(result.Failures, e.check(resp.StatusCode, result.LatencyMs, size)...)
+	}
+	if r.OpenAPI != nil && int64(kept.Len()) == size {
+		for _, v := range checkOpenAPIResponse(r.OpenAPI, &fetchMsg{statusCode: resp.StatusCode, header: resp.Header, body: kept.Bytes()}) {
+			result.Failures = append(result.Failures, "openapi: "+v)
+		}
+	}
+
+	// A failed extraction fails the request so dependents are skipped
+	// instead of being sent with placeholders
+	if len(r.Extract) > 0 {
+		var problems []string
+		result.vars, problems = applyExtractions(r.Extract, &fetchMsg{statusCode: resp.StatusCode, header: resp.Header, body: kept.Bytes()})
+		for _, p := range problems {
+			result.Failures = append(result.Failures, "extract "+p)
+		}
+	}
+	return result
+}
+
+// limitedBuffer keeps the first limit bytes written to it and discards
+// the rest
+type limitedBuffer struct {
+	buf   *bytes.Buffer
+	limit int
+}
+
+func (l *limitedBuffer) Write(p []byte) (int, error) {
+	if room := l.limit - l.buf.Len(); room > 0 {
+		if len(p) > room {
+			l.buf.Write(p[:room])
+		} else {
+			l.buf.Write(p)
+		}
+	}
+	return len(p), nil
+}
+
+func printRunSummary(w io.Writer, report runReport) {
+	for _, r := range report.Results {
+		mark := "PASS"
+		if !r.passed() {
+			mark = "FAIL"
+		}
+		fmt.Fprintf(w, "%s  %-6s %-40s %3d %6dms %10s\n",
+			mark, r.Method, r.Name, r.Status, r.LatencyMs, formatBytes(r.SizeBytes))
+		if r.Error != "" {
+			fmt.Fprintf(w, "      error: %s\n", r.Error)
+		}
+		for _, f := range r.Failures {
+			fmt.Fprintf(w, "      %s\n", f)
+		}
+		for _, d := range r.Drift {
+			fmt.Fprintf(w, "      schema drift: %s\n", d)
+		}
+		for j, h := range r.Redirects {
+			if h.Location == "" {
+				continue
+			}
+			fmt.Fprintf(w, "      redirect: %d %s -> %s", h.Status, h.URL, h.Location)
+			if len(h.Cookies) > 0 {
+				fmt.Fprintf(w, " (sets %s)", strings.Join(h.Cookies, ", "))
+			}
+			if j == len(r.Redirects)-1 && r.RedirectStop != "" {
+				fmt.Fprintf(w, ", %s", r.RedirectStop)
+			}
+			fmt.Fprintln(w)
+		}
+		if r.Retries > 0 {
+			fmt.Fprintf(w, "      retried %d time(s)\n", r.Retries)
+		}
+		if r.ThrottledMs > 0 {
+			fmt.Fprintf(w, "      waited %dms for the host's rate limit\n", r.ThrottledMs)
+		}
+	}
+	if len(report.Circuits) > 0 {
+		fmt.Fprintln(w)
+	}
+	for _, c := range report.Circuits {
+		fmt.Fprintf(w, "Circuit open for %s after %d consecutive failures, %d requests skipped; probed again from %s\n",
+			c.Host, c.Failures, c.Skipped, c.OpenUntil.Local().Format("15:04:05"))
+	}
+	fmt.Fprintf(w, "\n%d passed, %d failed in %dms\n", report.Passed, report.Failed, report.DurationMs)
+}
+
+func writeJSONReport(path string, report runReport) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+type junitTestSuite struct {
+	XMLName   xml.Name        `xml:"testsuite"`
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Errors    int             `xml:"errors,attr"`
+	Time      string          `xml:"time,attr"`
+	Timestamp string          `xml:"timestamp,attr"`
+	Cases     []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Error     *junitFailure `xml:"error,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+func writeJUnitReport(path string, report runReport) error {
+	suite := junitTestSuite{
+		Name:      report.Collection,
+		Tests:     len(report.Results),
+		Time:      fmt.Sprintf("%.3f", float64(report.DurationMs)/1000),
+		Timestamp: report.StartedAt.Format(time.RFC3339),
+	}
+	for _, r := range report.Results {
+		tc := junitTestCase{
+			Name:      r.Name,
+			Classname: report.Collection,
+			Time:      fmt.Sprintf("%.3f", float64(r.LatencyMs)/1000),
+		}
+		detail := fmt.Sprintf("%s %s -> %d in %dms, %d bytes", r.Method, r.URL, r.Status, r.LatencyMs, r.SizeBytes)
+		if r.Error != "" {
+			suite.Errors++
+			tc.Error = &junitFailure{Message: r.Error, Text: detail}
+		} else if len(r.Failures) > 0 {
+			suite.Failures++
+			tc.Failure = &junitFailure{Message: strings.Join(r.Failures, "; "), Text: detail}
+		}
+		suite.Cases = append(suite.Cases, tc)
+	}
+
+	data, err := xml.MarshalIndent(suite, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append([]byte(xml.Header), append(data, '\n')...), 0o644)
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// saveDuplicates offers what to do when a request about to be saved is
+// already saved under another name: update one of those, save it as the
+// next version of one, or add it anyway
+type saveDuplicates struct {
+	collection string // where the request was to be saved
+	request    savedRequest
+	matches    []duplicate
+	idx        int
+}
+
+// duplicate is a saved request and the name of its collection
+type duplicate struct {
+	request    savedRequest
+	collection string
+}
+
+// label is where the request is: collection/folder/name
+func (d duplicate) label() string {
+	parts := []string{d.collection}
+	if d.request.Folder != "" {
+		parts = append(parts, d.request.Folder)
+	}
+	return strings.Join(append(parts, d.request.Name), "/")
+}
+
+// requestSignature is what near-identical requests share: the method and
+// URL template, without query or trailing slash
+func requestSignature(r savedRequest) string {
+	u := withScheme(strings.TrimSpace(r.URL))
+	if i := strings.IndexAny(u, "?#"); i >= 0 {
+		u = u[:i]
+	}
+	return r.method() + " " + strings.TrimSuffix(u, "/")
+}
+
+// findDuplicates lists the saved requests with the signature of r. Saving
+// over a request of the same name is an update and finds none. Only
+// collection files are looked at, since .http files aren't written to.
+func findDuplicates(collectionName string, r savedRequest) []duplicate {
+	collections, _ := listCollections()
+	target := collectionPath(collectionName)
+	sig := requestSignature(r)
+	var matches []duplicate
+	for _, c := range collections {
+		for _, saved := range c.Requests {
+			switch {
+			case filepath.Ext(saved.file) != ".json":
+			case saved.file == target && saved.Name == r.Name && saved.Folder == r.Folder:
+				return nil
+			case requestSignature(saved) == sig:
+				matches = append(matches, duplicate{saved, c.Name})
+			}
+		}
+	}
+	return matches
+}
+
+// versionSuffix matches the " v2" ending the names of request versions
+var versionSuffix = regexp.MustCompile(` v(\d+)$`)
+
+// nextVersionName is the name of the next version of a request in its
+// collection: "list users v2" after "list users", "v3" after "v2"
+func nextVersionName(of savedRequest) string {
+	base := versionSuffix.ReplaceAllString(of.Name, "")
+	taken := map[string]bool{}
+	if c, err := loadCollection(of.file); err == nil {
+		for _, r := range c.Requests {
+			if r.Folder == of.Folder {
+				taken[r.Name] = true
+			}
+		}
+	}
+	n := 2
+	if m := versionSuffix.FindStringSubmatch(of.Name); m != nil {
+		n, _ = strconv.Atoi(m[1])
+		n++
+	}
+	for taken[base+" v"+strconv.Itoa(n)] {
+		n++
+	}
+	return base + " v" + strconv.Itoa(n)
+}
+
+// replaceSavedRequest writes r in place of the request of the same name
+// and folder in the collection file it was loaded from
+func replaceSavedRequest(file string, r savedRequest) error {
+	if isRemoteWorkspace(currentWorkspace) {
+		return errReadOnlyWorkspace
+	}
+	c, err := loadCollection(file)
+	if err != nil {
+		return err
+	}
+	for i := range c.Requests {
+		if c.Requests[i].Name == r.Name && c.Requests[i].Folder == r.Folder {
+			c.Requests[i] = r
+			return writeCollection(file, c)
+		}
+	}
+	return fmt.Errorf("%s is no longer in %s", r.Name, c.Name)
+}
+
+// saveRequest saves r to the named collection, first offering what to do
+// about near-identical requests saved already
+func (m model) saveRequest(collectionName string, r savedRequest) model {
+	if matches := findDuplicates(collectionName, r); len(matches) > 0 {
+		m.saveDuplicates = &saveDuplicates{collection: collectionName, request: r, matches: matches}
+		m.textInput.Blur()
+		return m
+	}
+	return m.finishSave(saveToCollection(collectionName, r), fmt.Sprintf("Saved %q to %s", r.Name, collectionName))
+}
+
+// finishSave reports how saving went and shows the result in the sidebar
+func (m model) finishSave(err error, notice string) model {
+	if err != nil {
+		m.notice = errorStyle.Render(fmt.Sprintf("Save failed: %v", err))
+	} else {
+		m.notice = notice
+	}
+	if m.sidebar.open {
+		m.sidebar = m.sidebar.reload()
+	}
+	return m
+}
+
+// updateSaveDuplicates handles keys while near-identical requests are
+// offered
+func (m model) updateSaveDuplicates(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	d := m.saveDuplicates
+	switch msg.String() {
+	case "ctrl+c":
+		return m, tea.Quit
+	case "esc":
+		m.saveDuplicates = nil
+		m.textInput.Focus()
+		m.notice = "Not saved"
+		return m, nil
+	case "up", "k":
+		if d.idx > 0 {
+			d.idx--
+		}
+		return m, nil
+	case "down", "j":
+		if d.idx < len(d.matches)-1 {
+			d.idx++
+		}
+		return m, nil
+	case "enter", "u":
+		// The existing request takes the new definition under its own
+		// name and place
+		existing := d.matches[d.idx]
+		r := d.request
+		r.Name, r.Folder = existing.request.Name, existing.request.Folder
+		m.saveDuplicates = nil
+		m.textInput.Focus()
+		return m.finishSave(replaceSavedRequest(existing.request.file, r), "Updated "+existing.label()), nil
+	case "v":
+		existing := d.matches[d.idx]
+		r := d.request
+		r.Name, r.Folder = nextVersionName(existing.request), existing.request.Folder
+		m.saveDuplicates = nil
+		m.textInput.Focus()
+		return m.finishSave(saveToCollection(existing.collection, r), fmt.Sprintf("Saved %q next to %q in %s", r.Name, existing.request.Name, existing.collection)), nil
+	case "a":
+		m.saveDuplicates = nil
+		m.textInput.Focus()
+		return m.finishSave(saveToCollection(d.collection, d.request), fmt.Sprintf("Saved %q to %s", d.request.Name, d.collection)), nil
+	}
+	return m, nil
+}
+
+// renderSaveDuplicates lists the near-identical requests with what can be
+// done about them
+func renderSaveDuplicates(d *saveDuplicates) string {
+	var sb strings.Builder
+	sb.WriteString(headerStyle.Render("Already saved"))
+	sb.WriteString("\n\n")
+	fmt.Fprintf(&sb, "%s is saved %s:\n\n", requestSignature(d.request), pluralTimes(len(d.matches)))
+	for i, dup := range d.matches {
+		r, label := dup.request, dup.label()
+		if i == d.idx {
+			sb.WriteString(selectedSuggestionStyle.Render("› ") + label)
+		} else {
+			sb.WriteString("  " + label)
+		}
+		if len(r.Headers) > 0 || r.Body != "" || r.Auth != nil {
+			var has []string
+			if n := len(r.Headers); n > 0 {
+				has = append(has, fmt.Sprintf("%d header(s)", n))
+			}
+			if r.Body != "" {
+				has = append(has, "a body")
+			}
+			if r.Auth != nil {
+				has = append(has, r.Auth.describe())
+			}
+			sb.WriteString(historyDimStyle.Render(" with " + strings.Join(has, ", ")))
+		}
+		sb.WriteString("\n")
+	}
+	fmt.Fprintf(&sb, "\n%s",
+		historyDimStyle.Render(fmt.Sprintf("↑/↓: Select • Enter/u: Update it • v: Save as its next version • a: Add %q anyway • Esc: Cancel", d.request.Name)))
+	return sb.String()
+}
+
+// pluralTimes says how many times something is there, in words
+func pluralTimes(n int) string {
+	switch n {
+	case 1:
+		return "already"
+	case 2:
+		return "twice already"
+	}
+	return fmt.Sprintf("%d times already", n)
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// schemaDir is where inferred schemas are stored inside the workspace
+// state directory
+const schemaDir = "schemas"
+
+// inferredSchema maps every path of a JSON document to the types seen
+// there, e.g. "$.items[].id" -> "number". Array elements share one path so
+// the schema doesn't depend on the length of lists.
+type inferredSchema struct {
+	Key     string            `json:"key"`
+	Fields  map[string]string `json:"fields"`
+	Updated time.Time         `json:"updated"`
+}
+
+// inferSchema builds the schema of a JSON body
+func inferSchema(body []byte) (map[string]string, error) {
+	var data interface{}
+	if err := json.Unmarshal(body, &data); err != nil {
+		return nil, err
+	}
+	types := map[string]map[string]bool{}
+	collectTypes(data, "$", types)
+
+	fields := make(map[string]string, len(types))
+	for path, set := range types {
+		var names []string
+		for name := range set {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		fields[path] = strings.Join(names, "|")
+	}
+	return fields, nil
+}
+
+func collectTypes(v interface{}, path string, types map[string]map[string]bool) {
+	add := func(t string) {
+		if types[path] == nil {
+			types[path] = map[string]bool{}
+		}
+		types[path][t] = true
+	}
+	switch v := v.(type) {
+	case map[string]interface{}:
+		add("object")
+		for k, child := range v {
+			collectTypes(child, path+"."+k, types)
+		}
+	case []interface{}:
+		add("array")
+		for _, child := range v {
+			collectTypes(child, path+"[]", types)
+		}
+	case string:
+		add("string")
+	case float64:
+		add("number")
+	case bool:
+		add("boolean")
+	case nil:
+		add("null")
+	}
+}
+
+// schemaDrift lists the differences between a stored schema and a new one
+func schemaDrift(old, new map[string]string) []string {
+	var drift []string
+	for path, t := range new {
+		prev, ok := old[path]
+		switch {
+		case underEmptyArray(path, old, new):
+		case !ok:
+			drift = append(drift, fmt.Sprintf("added %s (%s)", path, t))
+		case prev != t:
+			drift = append(drift, fmt.Sprintf("retyped %s: %s → %s", path, prev, t))
+		}
+	}
+	for path, t := range old {
+		if _, ok := new[path]; !ok && !underEmptyArray(path, old, new) {
+			drift = append(drift, fmt.Sprintf("removed %s (%s)", path, t))
+		}
+	}
+	// Sort by path so related changes end up together
+	sort.Slice(drift, func(i, j int) bool {
+		return driftPath(drift[i]) < driftPath(drift[j])
+	})
+	return drift
+}
+
+// underEmptyArray reports whether path lies inside an array that is empty
+// in one of the schemas; an empty list says nothing about its elements
+func underEmptyArray(path string, old, new map[string]string) bool {
+	for i := strings.Index(path, "[]"); i >= 0; {
+		elem := path[:i+2]
+		if _, inOld := old[elem]; !inOld {
+			return true
+		}
+		if _, inNew := new[elem]; !inNew {
+			return true
+		}
+		next := strings.Index(path[i+2:], "[]")
+		if next < 0 {
+			break
+		}
+		i += 2 + next
+	}
+	return false
+}
+
+func driftPath(d string) string {
+	_, rest, _ := strings.Cut(d, " ")
+	return rest
+}
+
+func schemaFile(key string) (string, error) {
+	dir := filepath.Join(workspaceStateDir(), schemaDir)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", err
+	}
+	sum := sha1.Sum([]byte(key))
+	return filepath.Join(dir, hex.EncodeToString(sum[:8])+".json"), nil
+}
+
+// trackSchema infers the schema of body, compares it with the one stored
+// for key by earlier responses and stores the new one. It returns the
+// drift; the first response for a key only records its schema. Bodies
+// that aren't JSON are ignored, and nothing is stored in incognito
+// sessions.
+func trackSchema(key string, body []byte) ([]string, error) {
+	if incognito {
+		return nil, nil
+	}
+	fields, err := inferSchema(body)
+	if err != nil {
+		return nil, nil
+	}
+
+	path, err := schemaFile(key)
+	if err != nil {
+		return nil, err
+	}
+	var drift []string
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		var stored inferredSchema
+		if err := json.Unmarshal(data, &stored); err == nil {
+			drift = schemaDrift(stored.Fields, fields)
+		}
+	case !errors.Is(err, os.ErrNotExist):
+		return nil, err
+	}
+
+	out, err := json.MarshalIndent(inferredSchema{Key: key, Fields: fields, Updated: time.Now()}, "", "  ")
+	if err != nil {
+		return drift, err
+	}
+	return drift, os.WriteFile(path, out, 0o600)
+}
+
+// savedRequestSchemaKey identifies a saved request across runs
+func savedRequestSchemaKey(collection string, r savedRequest) string {
+	return "collection:" + collection + "/" + r.Name
+}
+
+// urlSchemaKey identifies an ad-hoc request by method and URL without the
+// query string
+func urlSchemaKey(method, url string) string {
+	url, _, _ = strings.Cut(url, "?")
+	return "url:" + method + " " + url
+}
+
+// renderDrift warns about schema changes above a response
+func renderDrift(drift []string) string {
+	if len(drift) == 0 {
+		return ""
+	}
+	warn := lipgloss.NewStyle().Foreground(lipgloss.Color("#FFCC00"))
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s %s\n", headerStyle.Render("Schema drift:"),
+		warn.Render(fmt.Sprintf("%d changes since the last response", len(drift))))
+	for _, d := range drift {
+		sb.WriteString(warn.Render("  " + d))
+		sb.WriteString("\n")
+	}
+	sb.WriteString("\n")
+	return sb.String()
+}
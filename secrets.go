@@ -0,0 +1,107 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// secretProvider reads secrets from one kind of store
+type secretProvider interface {
+	readSecret(ref string) (string, error)
+}
+
+// secretProviders by the prefix of the secret references they read:
+//
+//	env:NAME                   an environment variable of lazyhttp
+//	keychain:service/account   the OS keychain (macOS Keychain, or the
+//	                           Secret Service through secret-tool elsewhere)
+//	vault:path#field           HashiCorp Vault, see vaultProvider
+var secretProviders = map[string]secretProvider{
+	"env":      envProvider{},
+	"keychain": keychainProvider{},
+	"vault":    vaultProvider{},
+}
+
+// defaultSecretProvider reads {{secret:…}} references without a prefix
+const defaultSecretProvider = "vault"
+
+// readSecret reads a secret from the store its reference names. Values
+// are read on every use and never written anywhere.
+func readSecret(spec string) (string, error) {
+	kind, ref, _ := strings.Cut(spec, ":")
+	provider, ok := secretProviders[kind]
+	if !ok {
+		return "", fmt.Errorf("unknown secret source %q, expected env:, keychain: or vault:", spec)
+	}
+	return provider.readSecret(ref)
+}
+
+// readSecretReference reads the secret of a {{secret:…}} placeholder, the
+// default provider's when the reference doesn't name one
+func readSecretReference(ref string) (string, error) {
+	if kind, _, ok := strings.Cut(ref, ":"); !ok || secretProviders[kind] == nil {
+		ref = defaultSecretProvider + ":" + ref
+	}
+	return readSecret(ref)
+}
+
+type envProvider struct{}
+
+func (envProvider) readSecret(name string) (string, error) {
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return "", fmt.Errorf("environment variable %s is not set", name)
+	}
+	return value, nil
+}
+
+type keychainProvider struct{}
+
+func (keychainProvider) readSecret(ref string) (string, error) {
+	service, account, _ := strings.Cut(ref, "/")
+	return keychainLookup(service, account)
+}
+
+// keychainLookup reads a password from the OS keychain
+func keychainLookup(service, account string) (string, error) {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		args := []string{"find-generic-password", "-w", "-s", service}
+		if account != "" {
+			args = append(args, "-a", account)
+		}
+		cmd = exec.Command("security", args...)
+	case "windows":
+		return "", fmt.Errorf("the keychain isn't supported on Windows, use env: instead")
+	default:
+		args := []string{"lookup", "service", service}
+		if account != "" {
+			args = append(args, "account", account)
+		}
+		cmd = exec.Command("secret-tool", args...)
+	}
+
+	out, err := cmd.Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+			err = errors.New(strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return "", fmt.Errorf("reading %q from the keychain: %w", strings.TrimSuffix(service+"/"+account, "/"), err)
+	}
+	return strings.TrimSuffix(string(out), "\n"), nil
+}
+
+// maskSecrets replaces a URL sent with secrets in the clear by its masked
+// form in error messages, which often quote it
+func maskSecrets(err error, url, display string) error {
+	if err == nil || url == display || !strings.Contains(err.Error(), url) {
+		return err
+	}
+	return errors.New(strings.ReplaceAll(err.Error(), url, display))
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// maxSecretScanBytes bounds how much of a body is scanned for secrets
+const maxSecretScanBytes = 2 << 20
+
+// scanResponseSecrets is cleared with -scan-secrets=false
+var scanResponseSecrets = true
+
+var (
+	secretMatchStyle = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("#FFFFFF")).Background(lipgloss.Color("#C0392B"))
+	secretKindStyle  = lipgloss.NewStyle().Foreground(lipgloss.Color("#E06C75"))
+)
+
+// secretPatterns are credentials recognizable by their shape, most
+// specific first
+var secretPatterns = []struct {
+	kind    string
+	pattern *regexp.Regexp
+}{
+	{"Private key", regexp.MustCompile(`-----BEGIN (?:[A-Z0-9]+ )*PRIVATE KEY(?: BLOCK)?-----`)},
+	{"AWS access key ID", regexp.MustCompile(`\b(?:AKIA|ASIA|AGPA|AIDA|AROA|ANPA|ANVA)[A-Z0-9]{16}\b`)},
+	{"AWS secret access key", regexp.MustCompile(`(?i)aws_?secret_?(?:access_?)?key["']?\s*[:=]\s*["']?([A-Za-z0-9/+=]{40})\b`)},
+	{"JWT", regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{8,}\.eyJ[A-Za-z0-9_-]{8,}\.[A-Za-z0-9_-]{8,}`)},
+	{"GitHub token", regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{60,})\b`)},
+	{"Slack token", regexp.MustCompile(`\bxox[abposr]-[A-Za-z0-9-]{10,}`)},
+	{"Stripe secret key", regexp.MustCompile(`\b[sr]k_live_[A-Za-z0-9]{20,}\b`)},
+	{"Google API key", regexp.MustCompile(`\bAIza[A-Za-z0-9_-]{35}\b`)},
+	{"Bearer token", regexp.MustCompile(`(?i)\bbearer\s+([A-Za-z0-9._~+/-]{20,}=*)`)},
+}
+
+// entropyCandidate is a run of characters that could be a key or token;
+// longer ones are content, like base64 images, rather than credentials
+var entropyCandidate = regexp.MustCompile(`[A-Za-z0-9+/_=-]{16,128}`)
+
+// minUnnamedSecret is the shortest high-entropy string flagged without a
+// secret-looking name before it
+const minUnnamedSecret = 24
+
+// secretKeyHint are field names whose values are secrets whatever their
+// shape
+var secretKeyHint = regexp.MustCompile(`(?i)(secret|token|passw(or)?d|api_?key|private_?key|credential|client_?secret)["']?\s*[:=]\s*["']?$`)
+
+// secretFinding is a likely secret found in a response
+type secretFinding struct {
+	kind  string
+	value string
+	line  int // 1-based
+}
+
+// scanSecrets looks through a body for credentials it shouldn't hold:
+// known token formats, private keys, and high-entropy strings
+func scanSecrets(body []byte) []secretFinding {
+	if !scanResponseSecrets || len(body) == 0 || isBinary(body) {
+		return nil
+	}
+	if len(body) > maxSecretScanBytes {
+		body = body[:maxSecretScanBytes]
+	}
+	text := string(body)
+	var findings []secretFinding
+	taken := map[string]bool{}
+	add := func(kind string, start, end int) {
+		value := text[start:end]
+		if taken[value] {
+			return
+		}
+		taken[value] = true
+		findings = append(findings, secretFinding{kind: kind, value: value, line: 1 + strings.Count(text[:start], "\n")})
+	}
+	for _, p := range secretPatterns {
+		for _, m := range p.pattern.FindAllStringSubmatchIndex(text, -1) {
+			// Patterns with a group match the secret within its context
+			if len(m) > 2 && m[2] >= 0 {
+				add(p.kind, m[2], m[3])
+			} else {
+				add(p.kind, m[0], m[1])
+			}
+		}
+	}
+	for _, m := range entropyCandidate.FindAllStringIndex(text, -1) {
+		value := text[m[0]:m[1]]
+		if taken[value] || coveredBy(value, findings) || !mixedCharacters(value) {
+			continue
+		}
+		named := secretKeyHint.MatchString(text[max(0, m[0]-40):m[0]])
+		e := shannonEntropy(value)
+		if named && e >= 3.5 || len(value) >= minUnnamedSecret && e >= 4.5 && hasUpperAndLower(value) {
+			kind := "High-entropy string"
+			if named {
+				kind = "Secret-named value"
+			}
+			add(kind, m[0], m[1])
+		}
+	}
+	return findings
+}
+
+// coveredBy reports whether value is part of something already found, as
+// the parts of a JWT are
+func coveredBy(value string, findings []secretFinding) bool {
+	for _, f := range findings {
+		if strings.Contains(f.value, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// mixedCharacters tells generated strings, which mix letters and digits,
+// from words and numbers
+func mixedCharacters(s string) bool {
+	return strings.ContainsAny(s, "0123456789") && strings.IndexFunc(s, unicode.IsLetter) >= 0
+}
+
+// hasUpperAndLower leaves out identifiers like user_1234abcd, whose
+// characters are all different without being random
+func hasUpperAndLower(s string) bool {
+	return strings.IndexFunc(s, unicode.IsUpper) >= 0 && strings.IndexFunc(s, unicode.IsLower) >= 0
+}
+
+// shannonEntropy is the entropy of s in bits per character. Random base64
+// approaches 6, hex 4, and words or identifiers stay well below 4.
+func shannonEntropy(s string) float64 {
+	counts := map[rune]int{}
+	for _, r := range s {
+		counts[r]++
+	}
+	n := float64(len(s))
+	var e float64
+	for _, c := range counts {
+		p := float64(c) / n
+		e -= p * math.Log2(p)
+	}
+	return e
+}
+
+// renderSecretFindings is the warning over a response holding secrets
+func renderSecretFindings(findings []secretFinding) string {
+	if len(findings) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	sb.WriteString(mimeWarningStyle.Render(fmt.Sprintf("⚠ %d possible secret(s) in the response", len(findings))))
+	sb.WriteString("\n")
+	for _, f := range findings {
+		fmt.Fprintf(&sb, "  %s %s %s\n",
+			secretKindStyle.Render(fmt.Sprintf("%-22s", f.kind)),
+			historyDimStyle.Render(fmt.Sprintf("line %-5d", f.line)),
+			secretMatchStyle.Render(truncateSecret(f.value)))
+	}
+	return sb.String()
+}
+
+// truncateSecret keeps long matches, like private key headers or JWTs,
+// to one line
+func truncateSecret(s string) string {
+	if len(s) <= 60 {
+		return s
+	}
+	return s[:40] + "…" + s[len(s)-12:]
+}
+
+// highlightSecrets marks the findings in the rendered body. Values the
+// highlighting split with colors can't be found again and stay unmarked.
+func highlightSecrets(rendered string, findings []secretFinding) string {
+	for _, f := range findings {
+		if !strings.Contains(f.value, "\n") {
+			rendered = strings.ReplaceAll(rendered, f.value, secretMatchStyle.Render(f.value))
+		}
+	}
+	return rendered
+}
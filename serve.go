@@ -0,0 +1,598 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unicode/utf8"
+)
+
+// `lazyhttp serve` is a companion daemon whose REST API drives the same
+// workspace as the TUI: editors, scripts and CI agents list and run saved
+// requests, read the history, and collect the webhooks posted to it.
+//
+//	GET  /api/health
+//	GET  /api/collections
+//	GET  /api/collections/{collection}
+//	POST /api/collections/{collection}/run
+//	POST /api/collections/{collection}/requests/{request}/run
+//	GET  /api/history?limit=N&q=filter
+//	GET  /api/hooks?after=ID&wait=30s
+//	POST /api/send, see editor.go
+//	ANY  /hooks/...
+
+// defaultServeAddr is where the daemon listens unless told otherwise, only
+// reachable from this machine
+const defaultServeAddr = "127.0.0.1:7331"
+
+// maxHookEvents is how many webhook events the daemon keeps, dropping the
+// oldest; maxHookBody is how much of each body it keeps
+const (
+	maxHookEvents = 500
+	maxHookBody   = 1 << 20
+)
+
+// maxHookWait bounds how long a GET /api/hooks waits for new events
+const maxHookWait = time.Minute
+
+// hookEvent is a request received on /hooks/, as the API lists it
+type hookEvent struct {
+	ID      int64       `json:"id"`
+	Time    time.Time   `json:"time"`
+	Remote  string      `json:"remote"`
+	Method  string      `json:"method"`
+	Path    string      `json:"path"` // after /hooks
+	Query   string      `json:"query,omitempty"`
+	Headers http.Header `json:"headers"`
+
+	// Body holds text bodies and BodyBase64 the others
+	Body       string `json:"body,omitempty"`
+	BodyBase64 string `json:"body_base64,omitempty"`
+	Truncated  bool   `json:"truncated,omitempty"`
+}
+
+// hookLog keeps the newest webhook events and wakes the API calls waiting
+// for them
+type hookLog struct {
+	mu     sync.Mutex
+	events []hookEvent
+	lastID int64
+	added  chan struct{} // closed and replaced when an event is added
+}
+
+func (l *hookLog) add(e hookEvent) hookEvent {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.lastID++
+	e.ID = l.lastID
+	l.events = append(l.events, e)
+	if len(l.events) > maxHookEvents {
+		l.events = l.events[len(l.events)-maxHookEvents:]
+	}
+	if l.added != nil {
+		close(l.added)
+		l.added = nil
+	}
+	return e
+}
+
+// since returns the events after the given ID, and a channel closed once
+// there are more
+func (l *hookLog) since(after int64) ([]hookEvent, <-chan struct{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	events := []hookEvent{}
+	for _, e := range l.events {
+		if e.ID > after {
+			events = append(events, e)
+		}
+	}
+	if l.added == nil {
+		l.added = make(chan struct{})
+	}
+	return events, l.added
+}
+
+// daemon is the state of `lazyhttp serve`
+type daemon struct {
+	token string     // required as a bearer token by the API, "" for none
+	host  string     // listened on, the one name besides loopback's that tokenless calls may use
+	env   string     // environment of runs that don't name one
+	opts  runOptions // how runs are sent
+	hooks hookLog
+
+	// runMu queues runs, which share the environments and sessions of the
+	// process
+	runMu sync.Mutex
+}
+
+// serveCommand implements `lazyhttp serve`
+func serveCommand(args []string) int {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	addr := fs.String("addr", defaultServeAddr, "`address` to listen on")
+	tokenRef := fs.String("token", "", "bearer token the API requires, as a secret `reference` such as env:LAZYHTTP_TOKEN (required off loopback)")
+	var d daemon
+	fs.StringVar(&d.env, "env", "", "resolve {{variables}} against the named environment, unless a run names its own")
+	fs.StringVar(&activeSession, "session", "", "send requests in the named session, unless they name their own")
+	fs.Func("var", "set a template variable (`name=value`, repeatable)", parseVarFlag)
+	fs.IntVar(&d.opts.parallel, "parallel", 1, "number of requests of a run in flight at once")
+	fs.IntVar(&d.opts.perHost, "per-host", 0, "maximum concurrent requests per host (0 means no limit)")
+	fs.IntVar(&d.opts.retries, "retries", 0, "retry idempotent requests failing with a network error, 429 or 5xx up to `N` times")
+	breakerThreshold := fs.Int("breaker", 5, "stop sending to a host after `N` consecutive network errors, 429 or 5xx responses (0 disables)")
+	breakerCooldown := fs.Duration("breaker-cooldown", 30*time.Second, "time before a host whose circuit opened is probed again")
+	registerTimeoutFlags(fs, &defaultTimeouts)
+	fs.Func("http-version", "force the HTTP `version` of requests, 1.1, 2 or 3 (default negotiated)", parseHTTPVersionFlag)
+	fs.Func("redirects", redirectsUsage, parseRedirectsFlag)
+	fs.Func("proxy", proxyUsage, parseProxyFlag)
+	fs.BoolFunc("insecure", insecureUsage, parseInsecureFlag)
+	fs.Func("cacert", cacertUsage, parseCACertFlag)
+	fs.Func("tls-min", tlsMinUsage, parseTLSMinFlag)
+	fs.Func("tls-max", tlsMaxUsage, parseTLSMaxFlag)
+	fs.Func("ciphers", ciphersUsage, parseCiphersFlag)
+	fs.Func("pin", pinUsage, parsePinFlag)
+	fs.Func("resolve", "connect to another address than a host resolves to, `host:port:address` as with curl (repeatable)", parseResolveFlag)
+	fs.Func("resolver", resolverUsage, parseResolverFlag)
+	fs.Func("rate-limit", "hold requests to a host to a rate, `host=rate` like api.example.com=2/s (repeatable)", parseRateLimitFlag)
+	policyPath := fs.String("egress-policy", "", "JSON `file` restricting what triggered requests may connect to and what the daemon accepts")
+	remote := fs.String("remote", "", "serve a read-only workspace from a git `URL` or .tar.gz URL")
+	fs.BoolVar(&allowRemoteSecrets, "allow-remote-secrets", false, allowRemoteSecretsUsage)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: lazyhttp serve [flags]\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return 2
+	}
+	if err := d.setup(*addr, *tokenRef, *policyPath, *remote, *breakerThreshold, *breakerCooldown); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+
+	ln, err := net.Listen("tcp", *addr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	srv := &http.Server{
+		Handler:           serverPolicy.limitRequests(d.handler()),
+		ReadHeaderTimeout: 10 * time.Second,
+		// Waiting API calls end with the daemon
+		BaseContext: func(net.Listener) context.Context { return ctx },
+	}
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdown)
+	}()
+
+	fmt.Printf("Serving workspace %q on http://%s\n", currentWorkspace, ln.Addr())
+	if d.token == "" {
+		fmt.Println("The API is open to every local user, set -token to require one")
+	}
+	if err := srv.Serve(ln); !errors.Is(err, http.ErrServerClosed) {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// setup loads what the runs of the daemon need, as `lazyhttp run` does
+func (d *daemon) setup(addr, tokenRef, policyPath, remote string, breakerThreshold int, breakerCooldown time.Duration) error {
+	if tokenRef != "" {
+		token, err := readSecret(tokenRef)
+		if err != nil {
+			return fmt.Errorf("reading the token: %w", err)
+		}
+		if token == "" {
+			return errors.New("the token is empty")
+		}
+		d.token = token
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); d.token == "" && host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return fmt.Errorf("listening on %s exposes the workspace to the network, set -token", addr)
+	}
+	d.host = host
+
+	if policyPath != "" {
+		policy, err := loadEgressPolicy(policyPath)
+		if err != nil {
+			return err
+		}
+		serverPolicy, outboundPolicy = policy, policy
+	}
+	if remote != "" {
+		warning, err := openRemoteWorkspace(remote)
+		if err != nil {
+			return err
+		}
+		if warning != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", warning)
+		}
+	}
+	if err := loadEnvironments(); err != nil {
+		return err
+	}
+	if d.env != "" && findEnvironment(d.env) == nil {
+		return fmt.Errorf("no environment %q in %s", d.env, filepath.Join(workspaceDir(), environmentsFile))
+	}
+	if err := loadRateLimits(); err != nil {
+		return err
+	}
+	d.opts.breakers, err = loadCircuitBreakers(breakerThreshold, breakerCooldown)
+	return err
+}
+
+func (d *daemon) handler() http.Handler {
+	api := http.NewServeMux()
+	api.HandleFunc("GET /api/health", d.handleHealth)
+	api.HandleFunc("GET /api/collections", d.handleCollections)
+	api.HandleFunc("GET /api/collections/{collection}", d.handleCollection)
+	api.HandleFunc("POST /api/collections/{collection}/run", d.handleRun)
+	api.HandleFunc("POST /api/collections/{collection}/requests/{request}/run", d.handleRun)
+	api.HandleFunc("GET /api/history", d.handleHistory)
+	api.HandleFunc("GET /api/hooks", d.handleHooks)
+	api.HandleFunc("POST /api/send", d.handleSend)
+
+	mux := http.NewServeMux()
+	mux.Handle("/api/", authorizeAPI(d.token, d.host, api))
+	mux.HandleFunc("/hooks/", d.receiveHook)
+	return mux
+}
+
+// authorizeAPI checks the bearer token of API calls, if any. Calls from web
+// pages are refused: any site open in a browser could otherwise send
+// requests through lazyhttp. Without a token, calls must also name a
+// loopback host or the one listened on, or a site could rebind its own
+// name to 127.0.0.1 and read the API as same-origin.
+func authorizeAPI(token, host string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Origin") != "" {
+			writeAPIError(w, http.StatusForbidden, errors.New("calls from web pages are refused"))
+			return
+		}
+		if token == "" && !localHost(r.Host, host) {
+			writeAPIError(w, http.StatusForbidden, fmt.Errorf("calls for host %q are refused, use localhost or set -token", r.Host))
+			return
+		}
+		if token != "" {
+			given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="lazyhttp"`)
+				writeAPIError(w, http.StatusUnauthorized, errors.New("missing or wrong bearer token"))
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// localHost tells whether the Host header of a call names loopback or the
+// host listened on, with any port
+func localHost(header, listened string) bool {
+	name := header
+	if h, _, err := net.SplitHostPort(header); err == nil {
+		name = h
+	}
+	name = strings.ToLower(strings.Trim(name, "[]"))
+	switch name {
+	case "localhost", "127.0.0.1", "::1", strings.ToLower(strings.Trim(listened, "[]")):
+		return true
+	}
+	return false
+}
+
+// writeAPIResult answers an API call with v as JSON
+func writeAPIResult(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+func writeAPIError(w http.ResponseWriter, status int, err error) {
+	writeAPIResult(w, status, map[string]string{"error": err.Error()})
+}
+
+func (d *daemon) handleHealth(w http.ResponseWriter, r *http.Request) {
+	d.hooks.mu.Lock()
+	lastHook := d.hooks.lastID
+	d.hooks.mu.Unlock()
+	writeAPIResult(w, http.StatusOK, map[string]any{
+		"workspace":    currentWorkspace,
+		"directory":    workspaceDir(),
+		"environment":  d.env,
+		"last_hook_id": lastHook,
+	})
+}
+
+// requestSummary describes a saved request in API answers
+type requestSummary struct {
+	Name      string   `json:"name"`
+	Folder    string   `json:"folder,omitempty"`
+	Method    string   `json:"method"`
+	URL       string   `json:"url"`
+	DependsOn []string `json:"depends_on,omitempty"`
+}
+
+type collectionSummary struct {
+	Name     string           `json:"name"`
+	Requests []requestSummary `json:"requests"`
+}
+
+func summarizeCollection(c *collection) collectionSummary {
+	s := collectionSummary{Name: c.Name, Requests: []requestSummary{}}
+	for _, r := range c.Requests {
+		s.Requests = append(s.Requests, requestSummary{Name: r.Name, Folder: r.Folder, Method: r.method(), URL: r.URL, DependsOn: r.DependsOn})
+	}
+	return s
+}
+
+func (d *daemon) handleCollections(w http.ResponseWriter, r *http.Request) {
+	collections, err := listCollections()
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+	summaries := []collectionSummary{}
+	for _, c := range collections {
+		summaries = append(summaries, summarizeCollection(c))
+	}
+	writeAPIResult(w, http.StatusOK, summaries)
+}
+
+// findCollection reads the collection of the workspace with the given
+// name, compared as the file names of collections are
+func findCollection(name string) (*collection, error) {
+	collections, err := listCollections()
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range collections {
+		if c.Name == name || slugify(c.Name) == slugify(name) {
+			return c, nil
+		}
+	}
+	return nil, fmt.Errorf("no collection %q in workspace %q", name, currentWorkspace)
+}
+
+func (d *daemon) handleCollection(w http.ResponseWriter, r *http.Request) {
+	c, err := findCollection(r.PathValue("collection"))
+	if err != nil {
+		writeAPIError(w, http.StatusNotFound, err)
+		return
+	}
+	writeAPIResult(w, http.StatusOK, summarizeCollection(c))
+}
+
+// runCall is the optional body of a run
+type runCall struct {
+	Env  string            `json:"env"`
+	Vars map[string]string `json:"vars"`
+}
+
+// handleRun runs a collection, or one of its requests after those it
+// depends on, and answers with the report `lazyhttp run -report-json`
+// writes
+func (d *daemon) handleRun(w http.ResponseWriter, r *http.Request) {
+	var call runCall
+	if err := json.NewDecoder(r.Body).Decode(&call); err != nil && err != io.EOF {
+		writeAPIError(w, http.StatusBadRequest, fmt.Errorf("reading the body: %w", err))
+		return
+	}
+	c, err := findCollection(r.PathValue("collection"))
+	if err != nil {
+		writeAPIError(w, http.StatusNotFound, err)
+		return
+	}
+	if err := c.validateDependencies(); err != nil {
+		writeAPIError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	if name := r.PathValue("request"); name != "" {
+		if c, err = c.withDependencies(name, r.URL.Query().Get("folder")); err != nil {
+			writeAPIError(w, http.StatusNotFound, err)
+			return
+		}
+	}
+
+	report, err := d.run(c, call)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeAPIResult(w, http.StatusOK, report)
+}
+
+// withDependencies is the collection reduced to the named request and
+// those it depends on, directly or not. Requests of the same name are told
+// apart by folder.
+func (c *collection) withDependencies(name, folder string) (*collection, error) {
+	index := map[string]int{}
+	target := -1
+	for i, r := range c.Requests {
+		index[r.Name] = i
+		if r.Name == name && (folder == "" || r.Folder == folder) {
+			if target >= 0 {
+				return nil, fmt.Errorf("%q names more than one request of %s, give its ?folder=", name, c.Name)
+			}
+			target = i
+		}
+	}
+	if target < 0 {
+		return nil, fmt.Errorf("no request %q in %s", name, c.Name)
+	}
+
+	keep := make([]bool, len(c.Requests))
+	var visit func(i int)
+	visit = func(i int) {
+		if keep[i] {
+			return
+		}
+		keep[i] = true
+		for _, dep := range c.Requests[i].DependsOn {
+			visit(index[dep])
+		}
+	}
+	visit(target)
+
+	sub := &collection{Name: c.Name, Variables: c.Variables}
+	for i, r := range c.Requests {
+		if keep[i] {
+			sub.Requests = append(sub.Requests, r)
+		}
+	}
+	return sub, nil
+}
+
+// run sends the requests of c and adds them to the history, as if they
+// had been sent from the TUI
+func (d *daemon) run(c *collection, call runCall) (runReport, error) {
+	d.runMu.Lock()
+	defer d.runMu.Unlock()
+
+	// Environments are read again so changes made in the TUI apply
+	if err := loadEnvironments(); err != nil {
+		return runReport{}, err
+	}
+	activeEnvironment = d.env
+	if call.Env != "" {
+		if findEnvironment(call.Env) == nil {
+			return runReport{}, fmt.Errorf("no environment %q in %s", call.Env, filepath.Join(workspaceDir(), environmentsFile))
+		}
+		activeEnvironment = call.Env
+	}
+
+	opts := d.opts
+	opts.vars = call.Vars
+	report := runCollection(c, opts)
+	if err := opts.breakers.save(); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: saving circuit breakers: %v\n", err)
+	}
+	for i, result := range report.Results {
+		if result.sent.IsZero() {
+			continue
+		}
+		entry := historyEntry{Method: result.Method, URL: result.URL, Line: c.Requests[i].requestLine(),
+			Status: result.Status, Error: result.Error, Time: result.sent}
+		if err := appendHistory(entry); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: saving history: %v\n", err)
+		}
+	}
+	return report, nil
+}
+
+// handleHistory lists the history newest first, fuzzy filtered with ?q=
+// as in the TUI
+func (d *daemon) handleHistory(w http.ResponseWriter, r *http.Request) {
+	limit := 50
+	if s := r.URL.Query().Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			writeAPIError(w, http.StatusBadRequest, fmt.Errorf("limit %q isn't a positive number", s))
+			return
+		}
+		limit = n
+	}
+	history, err := loadHistory()
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+	entries := []historyEntry{}
+	for _, match := range filterHistory(history, r.URL.Query().Get("q")) {
+		if len(entries) == limit {
+			break
+		}
+		entries = append(entries, history[match.index])
+	}
+	writeAPIResult(w, http.StatusOK, entries)
+}
+
+// receiveHook keeps a request posted to /hooks/ for the API to list
+func (d *daemon) receiveHook(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxHookBody+1))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	e := hookEvent{
+		Time:    time.Now(),
+		Remote:  r.RemoteAddr,
+		Method:  r.Method,
+		Path:    strings.TrimPrefix(r.URL.Path, "/hooks"),
+		Query:   r.URL.RawQuery,
+		Headers: r.Header,
+	}
+	if len(body) > maxHookBody {
+		body, e.Truncated = body[:maxHookBody], true
+	}
+	if utf8.Valid(body) {
+		e.Body = string(body)
+	} else {
+		e.BodyBase64 = base64.StdEncoding.EncodeToString(body)
+	}
+	e = d.hooks.add(e)
+	writeAPIResult(w, http.StatusOK, map[string]int64{"id": e.ID})
+}
+
+// handleHooks lists the webhook events after ?after=, waiting up to ?wait=
+// for one when there are none yet
+func (d *daemon) handleHooks(w http.ResponseWriter, r *http.Request) {
+	var after int64
+	var wait time.Duration
+	var err error
+	if s := r.URL.Query().Get("after"); s != "" {
+		if after, err = strconv.ParseInt(s, 10, 64); err != nil {
+			writeAPIError(w, http.StatusBadRequest, fmt.Errorf("after %q isn't an event ID", s))
+			return
+		}
+	}
+	if s := r.URL.Query().Get("wait"); s != "" {
+		if wait, err = time.ParseDuration(s); err != nil {
+			writeAPIError(w, http.StatusBadRequest, err)
+			return
+		}
+		wait = min(wait, maxHookWait)
+	}
+
+	events, added := d.hooks.since(after)
+	if len(events) == 0 && wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case <-added:
+			events, _ = d.hooks.since(after)
+		case <-timer.C:
+		case <-r.Context().Done():
+			return
+		}
+	}
+	writeAPIResult(w, http.StatusOK, events)
+}
@@ -0,0 +1,355 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// sessionsDir holds the named sessions in the data directory, one
+// directory per host as with httpie: sessions/api-example-com/admin.json
+const sessionsDir = "sessions"
+
+// session is who lazyhttp acts as towards one host: the cookies the host
+// set and default headers such as Authorization. Requests sent in a
+// session use its cookies instead of the shared jar and get its headers
+// unless they set their own, and the headers they send are remembered for
+// the next ones. Sessions of the same name for different hosts are
+// separate, so "admin" can log in to several APIs.
+type session struct {
+	Name    string            `json:"name"`
+	Host    string            `json:"host"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Cookies []storedCookie    `json:"cookies,omitempty"`
+
+	mu  sync.Mutex
+	jar *persistentJar
+}
+
+// activeSession names the session requests are sent in unless a saved
+// request names its own, "" for none. It is set with -session or the
+// session picker and not remembered, so each lazyhttp running side by
+// side can act as someone else.
+var activeSession string
+
+// openSessions caches the sessions used so far by file
+var openSessions sync.Map // path -> *session
+
+func sessionPath(name, host string) string {
+	return filepath.Join(dataDir(), sessionsDir, slugify(host), slugify(name)+".json")
+}
+
+// openSession returns the named session for host, loading it on first use
+// and starting it empty when it doesn't exist yet
+func openSession(name, host string) (*session, error) {
+	path := sessionPath(name, host)
+	if s, ok := openSessions.Load(path); ok {
+		return s.(*session), nil
+	}
+	s := &session{Name: name, Host: host, jar: newPersistentJar()}
+	data, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return nil, err
+	default:
+		if err := json.Unmarshal(data, s); err != nil {
+			return nil, fmt.Errorf("session %q for %s: %w", name, host, err)
+		}
+		for _, c := range s.Cookies {
+			if !c.expired() {
+				s.jar.add(c)
+			}
+		}
+	}
+	actual, _ := openSessions.LoadOrStore(path, s)
+	return actual.(*session), nil
+}
+
+// requestSession returns the session a request to rawURL is sent in, nil
+// when it isn't sent in one
+func requestSession(name, rawURL string) (*session, error) {
+	if name == "" {
+		return nil, nil
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return nil, err
+	}
+	return openSession(name, u.Host)
+}
+
+// sessionName is the session a saved request is sent in
+func (r savedRequest) sessionName() string {
+	if r.Session != "" {
+		return r.Session
+	}
+	return activeSession
+}
+
+// headers returns a copy of the session's default headers
+func (s *session) headers() map[string]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make(map[string]string, len(s.Headers))
+	for k, v := range s.Headers {
+		out[k] = v
+	}
+	return out
+}
+
+// apply readies req and its client to be sent in the session: the
+// session's headers go in under those the request sets afterwards, and
+// its cookies are used instead of the shared jar
+func (s *session) apply(req *http.Request, client *http.Client) {
+	for k, v := range s.headers() {
+		req.Header.Set(k, v)
+	}
+	client.Jar = s.jar
+}
+
+// update remembers the headers a request was sent with and saves the
+// session with its cookies. As with httpie, headers describing the body or
+// making the request conditional are left out, and so are those holding
+// secrets, which are read from their store on every use.
+func (s *session) update(r resolvedRequest) error {
+	s.mu.Lock()
+	for k, v := range r.headers {
+		lower := strings.ToLower(k)
+		if strings.HasPrefix(lower, "content-") || strings.HasPrefix(lower, "if-") || v != r.displayHeaders[k] {
+			continue
+		}
+		if s.Headers == nil {
+			s.Headers = map[string]string{}
+		}
+		setHeaderFold(s.Headers, k, v)
+	}
+	s.Cookies = s.jar.snapshot()
+	sort.Slice(s.Cookies, func(i, j int) bool { return s.Cookies[i].key() < s.Cookies[j].key() })
+	data, err := json.MarshalIndent(s, "", "  ")
+	s.mu.Unlock()
+	if err != nil || incognito {
+		return err
+	}
+
+	path := sessionPath(s.Name, s.Host)
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	// Sessions hold credentials, keep them private
+	return os.WriteFile(path, data, 0o600)
+}
+
+// listSessions returns the names of the saved sessions with the hosts
+// each has been used with
+func listSessions() (map[string][]string, error) {
+	files, err := filepath.Glob(filepath.Join(dataDir(), sessionsDir, "*", "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sessions := map[string][]string{}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		var s session
+		if err := json.Unmarshal(data, &s); err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		sessions[s.Name] = append(sessions[s.Name], s.Host)
+	}
+	return sessions, nil
+}
+
+// sessionPicker lists the saved sessions, with "no session" first; typing
+// filters them, and a name that matches none starts a new session. Two
+// sessions marked with Tab compare the request in the input line instead.
+type sessionPicker struct {
+	hosts  map[string][]string
+	filter textinput.Model
+	idx    int
+	marked []string
+	err    error
+}
+
+// toggleMark marks or unmarks a session for comparison, dropping the
+// oldest mark beyond two
+func (p *sessionPicker) toggleMark(name string) {
+	for i, marked := range p.marked {
+		if marked == name {
+			p.marked = append(p.marked[:i], p.marked[i+1:]...)
+			return
+		}
+	}
+	p.marked = append(p.marked, name)
+	if len(p.marked) > 2 {
+		p.marked = p.marked[1:]
+	}
+}
+
+func (p *sessionPicker) isMarked(name string) bool {
+	for _, marked := range p.marked {
+		if marked == name {
+			return true
+		}
+	}
+	return false
+}
+
+// matches returns the session names matching the filter, "" standing for
+// no session
+func (p *sessionPicker) matches() []string {
+	query := strings.ToLower(strings.TrimSpace(p.filter.Value()))
+	var out []string
+	if query == "" {
+		out = append(out, "")
+	}
+	names := make([]string, 0, len(p.hosts))
+	for name := range p.hosts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if strings.Contains(strings.ToLower(name), query) {
+			out = append(out, name)
+		}
+	}
+	return out
+}
+
+func (m model) openSessionPicker() model {
+	filter := textinput.New()
+	filter.Prompt = "Session: "
+	filter.Placeholder = "filter, or a new name"
+	filter.Focus()
+	hosts, err := listSessions()
+	p := &sessionPicker{hosts: hosts, filter: filter, err: err}
+	for i, name := range p.matches() {
+		if name == activeSession {
+			p.idx = i
+		}
+	}
+	m.sessionPicker = p
+	m.textInput.Blur()
+	return m
+}
+
+// updateSessionPicker handles keys while the picker is open
+func (m model) updateSessionPicker(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	p := m.sessionPicker
+	matches := p.matches()
+	switch msg.Type {
+	case tea.KeyCtrlC:
+		return m, tea.Quit
+	case tea.KeyEsc, tea.KeyCtrlO:
+		m.sessionPicker = nil
+		m.textInput.Focus()
+		return m, nil
+	case tea.KeyUp:
+		if p.idx > 0 {
+			p.idx--
+		}
+		return m, nil
+	case tea.KeyDown:
+		if p.idx < len(matches)-1 {
+			p.idx++
+		}
+		return m, nil
+	case tea.KeyTab:
+		if p.idx < len(matches) {
+			p.toggleMark(matches[p.idx])
+		}
+		return m, nil
+	case tea.KeyEnter:
+		if len(p.marked) == 2 {
+			line := strings.TrimSpace(m.textInput.Value())
+			if line == "" {
+				p.err = errors.New("enter the request to compare in the input line first")
+				return m, nil
+			}
+			m.sessionPicker = nil
+			m.textInput.Focus()
+			return m.startCompare(line, [2]string{p.marked[0], p.marked[1]})
+		}
+		name := strings.TrimSpace(p.filter.Value())
+		if p.idx < len(matches) {
+			name = matches[p.idx]
+		}
+		m.sessionPicker = nil
+		m.textInput.Focus()
+		activeSession = name
+		switch {
+		case name == "":
+			m.notice = "No session, using the shared cookie jar"
+		case p.hosts[name] == nil:
+			m.notice = fmt.Sprintf("Started session %q, saved once a request is sent", name)
+		default:
+			m.notice = fmt.Sprintf("Using session %q", name)
+		}
+		return m, nil
+	}
+
+	var cmd tea.Cmd
+	p.filter, cmd = p.filter.Update(msg)
+	p.idx = 0
+	return m, cmd
+}
+
+// renderSessionPicker draws the session picker
+func renderSessionPicker(p *sessionPicker) string {
+	var sb strings.Builder
+	sb.WriteString(headerStyle.Render("Sessions"))
+	sb.WriteString("\n\n")
+	sb.WriteString(p.filter.View())
+	sb.WriteString("\n\n")
+	if p.err != nil {
+		sb.WriteString(errorStyle.Render(p.err.Error()))
+		sb.WriteString("\n")
+	}
+
+	matches := p.matches()
+	for i, name := range matches {
+		label := name
+		if name == "" {
+			label = "(none)"
+		} else {
+			hosts := append([]string(nil), p.hosts[name]...)
+			sort.Strings(hosts)
+			label += historyDimStyle.Render(" " + strings.Join(hosts, ", "))
+		}
+		if name == activeSession {
+			label += historyDimStyle.Render(" (active)")
+		}
+		mark := "  "
+		if p.isMarked(name) {
+			mark = selectedSuggestionStyle.Render("✓ ")
+		}
+		if i == p.idx {
+			sb.WriteString(selectedSuggestionStyle.Render("› ") + mark + label)
+		} else {
+			sb.WriteString("  " + mark + label)
+		}
+		sb.WriteString("\n")
+	}
+	if name := strings.TrimSpace(p.filter.Value()); len(matches) == 0 && name != "" {
+		sb.WriteString(historyDimStyle.Render(fmt.Sprintf("Enter starts session %q", name)))
+		sb.WriteString("\n")
+	}
+	if len(p.marked) == 2 {
+		sb.WriteString(historyDimStyle.Render("\n↑/↓: Select • Tab: Unmark • Enter: Compare the two • Esc: Close"))
+	} else {
+		sb.WriteString(historyDimStyle.Render("\n↑/↓: Select • Tab: Mark two to compare • Enter: Use • Esc: Close"))
+	}
+	return sb.String()
+}
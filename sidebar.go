@@ -0,0 +1,366 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// sidebarWidth is the default width of the collections sidebar, border
+// included
+const sidebarWidth = 34
+
+var (
+	sidebarStyle = lipgloss.NewStyle().
+			BorderStyle(lipgloss.RoundedBorder()).
+			BorderForeground(lipgloss.Color("#336699")).
+			Padding(0, 1)
+
+	sidebarFocusedStyle = sidebarStyle.BorderForeground(lipgloss.Color("#7D56F4"))
+
+	collectionNameStyle = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("#61AFEF"))
+	folderNameStyle     = lipgloss.NewStyle().Foreground(lipgloss.Color("#E5C07B"))
+	methodStyle         = lipgloss.NewStyle().Foreground(lipgloss.Color("#56B6C2"))
+)
+
+// sidebarItem is a row of the sidebar: a collection, a folder or a request
+type sidebarItem struct {
+	key     string // collection and folder path, identifies folders across reloads
+	label   string
+	depth   int
+	parent  int           // index of the enclosing folder row, -1 for collections
+	request *savedRequest // nil for collections and folders
+}
+
+func (i sidebarItem) isFolder() bool {
+	return i.request == nil
+}
+
+// sidebarModel lists the saved collections as a tree of folders and
+// requests
+type sidebarModel struct {
+	open        bool
+	focused     bool
+	collections []*collection
+	collapsed   map[string]bool
+	items       []sidebarItem
+	idx         int
+	err         error
+}
+
+// folderNode is a folder of a collection while the tree is built
+type folderNode struct {
+	name     string
+	folders  []*folderNode
+	requests []*savedRequest
+}
+
+func (f *folderNode) child(name string) *folderNode {
+	for _, c := range f.folders {
+		if c.name == name {
+			return c
+		}
+	}
+	c := &folderNode{name: name}
+	f.folders = append(f.folders, c)
+	return c
+}
+
+// reload reads the collections from disk
+func (s sidebarModel) reload() sidebarModel {
+	s.collections, s.err = listCollections()
+	return s.rebuild()
+}
+
+// rebuild flattens the tree into rows, skipping collapsed folders, and
+// keeps the selection in range
+func (s sidebarModel) rebuild() sidebarModel {
+	s.items = nil
+	for _, c := range s.collections {
+		root := &folderNode{name: c.Name}
+		for i := range c.Requests {
+			node := root
+			for _, part := range strings.Split(c.Requests[i].Folder, "/") {
+				if part = strings.TrimSpace(part); part != "" {
+					node = node.child(part)
+				}
+			}
+			node.requests = append(node.requests, &c.Requests[i])
+		}
+		s.addFolder(root, c.Name, 0, -1)
+	}
+	if s.idx >= len(s.items) {
+		s.idx = len(s.items) - 1
+	}
+	if s.idx < 0 {
+		s.idx = 0
+	}
+	return s
+}
+
+func (s *sidebarModel) addFolder(f *folderNode, key string, depth, parent int) {
+	s.items = append(s.items, sidebarItem{key: key, label: f.name, depth: depth, parent: parent})
+	if s.collapsed[key] {
+		return
+	}
+	self := len(s.items) - 1
+	for _, sub := range f.folders {
+		s.addFolder(sub, key+"/"+sub.name, depth+1, self)
+	}
+	for _, r := range f.requests {
+		s.items = append(s.items, sidebarItem{key: key, label: r.Name, depth: depth + 1, parent: self, request: r})
+	}
+}
+
+// collectionOf returns the name of the collection row i belongs to
+func (s sidebarModel) collectionOf(i int) string {
+	for s.items[i].parent >= 0 {
+		i = s.items[i].parent
+	}
+	return s.items[i].label
+}
+
+// setCollapsed folds or unfolds the selected folder
+func (s sidebarModel) setCollapsed(collapsed bool) sidebarModel {
+	if s.collapsed == nil {
+		s.collapsed = map[string]bool{}
+	}
+	s.collapsed[s.items[s.idx].key] = collapsed
+	return s.rebuild()
+}
+
+// toggleSidebar opens and focuses the sidebar, or closes it
+func (m model) toggleSidebar() model {
+	if m.sidebar.open {
+		m.sidebar.open = false
+		m.sidebar.focused = false
+		m.textInput.Focus()
+	} else {
+		m.sidebar = m.sidebar.reload()
+		m.sidebar.open = true
+		m.sidebar.focused = true
+		m.textInput.Blur()
+	}
+	return m.layout()
+}
+
+// updateSidebar handles keys while the sidebar has focus
+func (m model) updateSidebar(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.Type {
+	case tea.KeyCtrlC:
+		return m, tea.Quit
+	case tea.KeyEsc, tea.KeyCtrlB:
+		return m.toggleSidebar(), nil
+	case tea.KeyTab:
+		m.sidebar.focused = false
+		m.textInput.Focus()
+		return m, nil
+	case tea.KeyUp:
+		if m.sidebar.idx > 0 {
+			m.sidebar.idx--
+		}
+		return m, nil
+	case tea.KeyDown:
+		if m.sidebar.idx < len(m.sidebar.items)-1 {
+			m.sidebar.idx++
+		}
+		return m, nil
+	case tea.KeyHome:
+		m.sidebar.idx = 0
+		return m, nil
+	case tea.KeyEnd:
+		m.sidebar.idx = len(m.sidebar.items) - 1
+		return m, nil
+	}
+
+	if m.sidebar.idx >= len(m.sidebar.items) {
+		return m, nil
+	}
+	item := m.sidebar.items[m.sidebar.idx]
+	collapsed := m.sidebar.collapsed[item.key]
+	switch msg.String() {
+	case "enter", " ":
+		if !item.isFolder() {
+			if !m.fetching {
+				return m.runSaved(*item.request)
+			}
+		} else {
+			m.sidebar = m.sidebar.setCollapsed(!collapsed)
+		}
+	case "p":
+		// Preview the saved request, its own variables included
+		if !item.isFolder() && !m.fetching {
+			m.err = nil
+			m.response = renderPreview(resolveSavedRequest(*item.request, m.templateContext()))
+			m.viewport.SetContent(m.response)
+			m.viewport.GotoTop()
+		}
+	case "m":
+		// Show how the request fared in recorded runs by time of day
+		if !item.isFolder() {
+			collection := m.sidebar.collectionOf(m.sidebar.idx)
+			samples, err := loadMonitorSamples()
+			m.err = err
+			m.response = renderHeatmap(collection+" / "+itemPath(*item.request), savedRequestSchemaKey(collection, *item.request), samples)
+			m.viewport.SetContent(m.response)
+			m.viewport.GotoTop()
+		}
+	case "v":
+		// Compare the saved request with its earlier revisions
+		if !item.isFolder() {
+			return m.openRequestRevisions(*item.request), nil
+		}
+	case "right", "l":
+		if item.isFolder() && collapsed {
+			m.sidebar = m.sidebar.setCollapsed(false)
+		}
+	case "left", "h":
+		// Fold an open folder, otherwise move up to the enclosing one
+		if item.isFolder() && !collapsed {
+			m.sidebar = m.sidebar.setCollapsed(true)
+		} else if item.parent >= 0 {
+			m.sidebar.idx = item.parent
+		}
+	}
+	return m, nil
+}
+
+// runSaved sends a saved request, showing it in the input line and keeping
+// the rest as the draft
+func (m model) runSaved(r savedRequest) (model, tea.Cmd) {
+	line := r.requestLine()
+	m.draft = &r
+	m.textInput.SetValue(line)
+	m.textInput.CursorEnd()
+	retry := func(m model) (model, tea.Cmd) { return m.runSaved(r) }
+	return m.send(resolveSavedRequest(r, m.templateContext()), line, retry)
+}
+
+// sidebarView draws the sidebar with the given width, border included,
+// and inner height
+func (s sidebarModel) view(width, height int) string {
+	inner := width - sidebarStyle.GetHorizontalFrameSize()
+
+	var lines []string
+	switch {
+	case s.err != nil:
+		lines = append(lines, errorStyle.Width(inner).Render(s.err.Error()))
+	case len(s.items) == 0:
+		lines = append(lines, historyDimStyle.Width(inner).Render("No saved requests yet. Press Ctrl+S to save the current request."))
+	}
+
+	// Keep the selection in view
+	start := 0
+	if s.idx >= height {
+		start = s.idx - height + 1
+	}
+	for i := start; i < len(s.items) && len(lines) < height; i++ {
+		item := s.items[i]
+		prefix := strings.Repeat("  ", item.depth) + " "
+		if s.focused && i == s.idx {
+			prefix = strings.Repeat("  ", item.depth) + selectedSuggestionStyle.Render("›")
+		}
+		width := inner - 1 - 2*item.depth
+
+		var line string
+		switch {
+		case !item.isFolder():
+			method := fmt.Sprintf("%-4s", item.request.method())
+			line = methodStyle.Render(method) + " " + truncate(item.label, width-len(method)-1)
+		case item.depth == 0:
+			line = collectionNameStyle.Render(truncate(folderMarker(s.collapsed[item.key])+item.label, width))
+		default:
+			line = folderNameStyle.Render(truncate(folderMarker(s.collapsed[item.key])+item.label, width))
+		}
+		lines = append(lines, prefix+line)
+	}
+
+	style := sidebarStyle
+	if s.focused {
+		style = sidebarFocusedStyle
+	}
+	return style.Width(inner).Height(height).Render(strings.Join(lines, "\n"))
+}
+
+func folderMarker(collapsed bool) string {
+	if collapsed {
+		return "▸ "
+	}
+	return "▾ "
+}
+
+// truncate shortens s to n runes with an ellipsis
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if n <= 0 {
+		return ""
+	}
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n-1]) + "…"
+}
+
+// openSavePrompt asks where to save the request in the input line
+func (m model) openSavePrompt() model {
+	input := textinput.New()
+	input.Prompt = "Save as: "
+	input.Placeholder = "collection/folder/request name"
+	input.Focus()
+	m.savePrompt = &input
+	m.textInput.Blur()
+	return m
+}
+
+// updateSavePrompt handles keys while the save prompt is open
+func (m model) updateSavePrompt(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.Type {
+	case tea.KeyCtrlC:
+		return m, tea.Quit
+	case tea.KeyEsc:
+		m.savePrompt = nil
+		m.textInput.Focus()
+		return m, nil
+	case tea.KeyEnter:
+		name := strings.TrimSpace(m.savePrompt.Value())
+		if name == "" {
+			return m, nil
+		}
+		m.savePrompt = nil
+		m.textInput.Focus()
+
+		// collection/folder/.../name
+		collectionName, folder := defaultCollection, ""
+		if parts := strings.Split(name, "/"); len(parts) > 1 {
+			for i := range parts {
+				parts[i] = strings.TrimSpace(parts[i])
+			}
+			if parts[0] != "" {
+				collectionName = parts[0]
+			}
+			folder = strings.Trim(strings.Join(parts[1:len(parts)-1], "/"), "/")
+			name = parts[len(parts)-1]
+		}
+
+		// Templates are saved unexpanded so the request keeps working
+		// when variables change
+		var r savedRequest
+		if m.draft != nil {
+			r = *m.draft
+		}
+		r = r.withLine(m.textInput.Value())
+		r.Name, r.Folder, r.URL = name, folder, withScheme(r.URL)
+		if r.Method == "GET" {
+			r.Method = ""
+		}
+		return m.saveRequest(collectionName, r), nil
+	}
+
+	var cmd tea.Cmd
+	input, cmd := m.savePrompt.Update(msg)
+	m.savePrompt = &input
+	return m, cmd
+}
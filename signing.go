@@ -0,0 +1,611 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"mime"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// signingDebug is what a signed auth scheme signed, to diagnose the
+// signatures servers reject: the canonical request or signature base it
+// built, and the signature. Secret values are masked in it.
+type signingDebug struct {
+	scheme    string
+	steps     []signingStep
+	signature string
+
+	// expected is what the server says it signed, when its error tells,
+	// as AWS does
+	expected []signingStep
+}
+
+// signingStep is one string built while signing
+type signingStep struct {
+	label, text string
+}
+
+// signedBody reads the body the request sends, for hashing
+func (r *resolvedRequest) signedBody() ([]byte, error) {
+	if r.bodyFile == "" {
+		return []byte(r.body), nil
+	}
+	file, _, _, err := openUploadBody(r.bodyFile)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return io.ReadAll(file)
+}
+
+// setSignedContentType sets the Content-Type lazyhttp sends with a body
+// anyway as a header of the request, so signatures cover it
+func (r *resolvedRequest) setSignedContentType() {
+	if headerValue(r.headers, "Content-Type") != "" {
+		return
+	}
+	contentType := ""
+	switch {
+	case r.bodyFile != "":
+		if file, _, ct, err := openUploadBody(r.bodyFile); err == nil {
+			file.Close()
+			contentType = ct
+		}
+	case r.body != "":
+		contentType = bodyContentType(r.body)
+	}
+	if contentType != "" {
+		r.setHeader("Content-Type", contentType, contentType)
+	}
+}
+
+// signingURLs parses the URL of the request, with its secrets in the clear
+// and masked
+func (r *resolvedRequest) signingURLs() (u, display *url.URL, err error) {
+	if u, err = url.Parse(r.url); err != nil {
+		return nil, nil, err
+	}
+	if display, err = url.Parse(r.display); err != nil {
+		display = u
+	}
+	return u, display, nil
+}
+
+// AWS Signature Version 4
+
+// awsHost tells the service and region from hosts like
+// sqs.eu-west-1.amazonaws.com or bucket.s3.eu-west-1.amazonaws.com
+var awsHost = regexp.MustCompile(`(?:^|\.)([a-z0-9-]+)(?:\.([a-z]{2}(?:-gov)?-[a-z]+-\d))?\.amazonaws\.com(?:\.cn)?$`)
+
+// signAWS signs the request with AWS Signature Version 4, taking the
+// region and service from the host unless the auth gives them
+func (r *resolvedRequest) signAWS(a *requestAuth, expand func(string) expansion) error {
+	accessKey, secretKey, token := expand(a.AccessKey), expand(a.SecretKey), expand(a.SessionToken)
+	region, service := expand(a.Region).text, expand(a.Service).text
+	if accessKey.text == "" || secretKey.text == "" {
+		return errors.New("aws-sigv4 auth needs an access_key and a secret_key")
+	}
+	u, display, err := r.signingURLs()
+	if err != nil {
+		return err
+	}
+	if m := awsHost.FindStringSubmatch(strings.ToLower(u.Hostname())); m != nil {
+		if service == "" {
+			service = m[1]
+		}
+		if region == "" {
+			region = m[2]
+		}
+		if region == "" {
+			region = "us-east-1" // global services like IAM
+		}
+	}
+	if region == "" || service == "" {
+		return fmt.Errorf("aws-sigv4 auth needs a region and a service, which %s doesn't tell", u.Hostname())
+	}
+	body, err := r.signedBody()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	amzDate, date := now.Format("20060102T150405Z"), now.Format("20060102")
+	payloadHash := hex.EncodeToString(sha256Sum(body))
+	r.setHeader("X-Amz-Date", amzDate, amzDate)
+	r.setHeader("X-Amz-Content-Sha256", payloadHash, payloadHash)
+	if token.text != "" {
+		r.setHeader("X-Amz-Security-Token", token.text, token.masked)
+	}
+	r.setSignedContentType()
+
+	signed := []string{"host"}
+	for name := range r.headers {
+		lower := strings.ToLower(name)
+		if lower == "content-type" || strings.HasPrefix(lower, "x-amz-") {
+			signed = append(signed, lower)
+		}
+	}
+	sort.Strings(signed)
+	canonical := awsCanonicalRequest(r.method, u, r.headers, signed, payloadHash, service)
+	shown := awsCanonicalRequest(r.method, display, r.displayHeaders, signed, payloadHash, service)
+	shown = strings.ReplaceAll(shown, awsURIEncode(maskedValue, true), maskedValue)
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	stringToSign, signature := awsSignature(secretKey.text, amzDate, region, service, canonical)
+
+	// The path goes out encoded as it was signed, which escapes more
+	// than Go does, e.g. the colons of ARNs
+	if path := awsURIEncode(u.Path, false); path != u.EscapedPath() {
+		u.RawPath, display.RawPath = path, awsURIEncode(display.Path, false)
+		r.url, r.display = u.String(), display.String()
+	}
+
+	authorization := "AWS4-HMAC-SHA256 Credential=%s/" + scope + ", SignedHeaders=" + strings.Join(signed, ";") + ", Signature=" + signature
+	r.setHeader("Authorization", fmt.Sprintf(authorization, accessKey.text), fmt.Sprintf(authorization, accessKey.masked))
+	r.signing = &signingDebug{
+		scheme: "AWS Signature Version 4",
+		steps: []signingStep{
+			{"Canonical request", shown},
+			{"String to sign", stringToSign},
+		},
+		signature: signature,
+	}
+	return nil
+}
+
+// awsSignature signs a canonical request made at amzDate, returning the
+// string to sign and the hex signature
+func awsSignature(secretKey, amzDate, region, service, canonical string) (stringToSign, signature string) {
+	date := amzDate[:8]
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	stringToSign = "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(sha256Sum([]byte(canonical)))
+	key := []byte("AWS4" + secretKey)
+	for _, part := range []string{date, region, service, "aws4_request"} {
+		key = hmacSum(sha256.New, key, []byte(part))
+	}
+	return stringToSign, hex.EncodeToString(hmacSum(sha256.New, key, []byte(stringToSign)))
+}
+
+// awsCanonicalRequest builds the canonical request of AWS Signature
+// Version 4. Paths are encoded twice, except for S3.
+func awsCanonicalRequest(method string, u *url.URL, headers map[string]string, signed []string, payloadHash, service string) string {
+	path := awsURIEncode(u.Path, false)
+	if path == "" {
+		path = "/"
+	}
+	if service != "s3" {
+		path = awsURIEncode(path, false)
+	}
+
+	// Parameters sort by encoded name, then by encoded value
+	type param struct{ key, value string }
+	var params []param
+	for key, values := range u.Query() {
+		for _, value := range values {
+			params = append(params, param{awsURIEncode(key, true), awsURIEncode(value, true)})
+		}
+	}
+	sort.Slice(params, func(i, j int) bool {
+		if params[i].key != params[j].key {
+			return params[i].key < params[j].key
+		}
+		return params[i].value < params[j].value
+	})
+	query := make([]string, len(params))
+	for i, p := range params {
+		query[i] = p.key + "=" + p.value
+	}
+
+	var sb strings.Builder
+	sb.WriteString(method + "\n" + path + "\n" + strings.Join(query, "&") + "\n")
+	for _, name := range signed {
+		value := u.Host
+		if name != "host" {
+			value = headerValue(headers, name)
+		}
+		sb.WriteString(name + ":" + strings.Join(strings.Fields(value), " ") + "\n")
+	}
+	sb.WriteString("\n" + strings.Join(signed, ";") + "\n" + payloadHash)
+	return sb.String()
+}
+
+// awsURIEncode percent-encodes all but the unreserved characters of RFC
+// 3986, and slashes unless encodeSlash
+func awsURIEncode(s string, encodeSlash bool) string {
+	var sb strings.Builder
+	for _, b := range []byte(s) {
+		switch {
+		case 'A' <= b && b <= 'Z', 'a' <= b && b <= 'z', '0' <= b && b <= '9', b == '-', b == '_', b == '.', b == '~':
+			sb.WriteByte(b)
+		case b == '/' && !encodeSlash:
+			sb.WriteByte(b)
+		default:
+			fmt.Fprintf(&sb, "%%%02X", b)
+		}
+	}
+	return sb.String()
+}
+
+// Hawk
+
+// signHawk signs the request with Hawk, a MAC over its method, URL, the
+// hash of its payload and a timestamp and nonce
+func (r *resolvedRequest) signHawk(a *requestAuth, expand func(string) expansion) error {
+	id, key, ext := expand(a.KeyID), expand(a.Secret), expand(a.Ext)
+	if id.text == "" || key.text == "" {
+		return errors.New("hawk auth needs a key_id and a secret")
+	}
+	var newHash func() hash.Hash
+	switch a.Algorithm {
+	case "", "sha256":
+		newHash = sha256.New
+	case "sha1":
+		newHash = sha1.New
+	default:
+		return fmt.Errorf("hawk auth: unknown algorithm %q, expected sha256 or sha1", a.Algorithm)
+	}
+	u, display, err := r.signingURLs()
+	if err != nil {
+		return err
+	}
+	body, err := r.signedBody()
+	if err != nil {
+		return err
+	}
+	r.setSignedContentType()
+
+	var steps []signingStep
+	payloadHash := ""
+	if len(body) > 0 {
+		contentType, _, _ := mime.ParseMediaType(headerValue(r.headers, "Content-Type"))
+		h := newHash()
+		h.Write([]byte("hawk.1.payload\n" + contentType + "\n"))
+		h.Write(body)
+		h.Write([]byte("\n"))
+		payloadHash = base64.StdEncoding.EncodeToString(h.Sum(nil))
+		steps = append(steps, signingStep{"Payload hash input", fmt.Sprintf("hawk.1.payload\n%s\n<body, %s>\n", contentType, formatBytes(int64(len(body))))})
+	}
+
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	nonce := randomToken(6)
+	escapedExt := strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(ext.text)
+	normalized := hawkNormalized(r.method, u, ts, nonce, payloadHash, escapedExt)
+	mac := base64.StdEncoding.EncodeToString(hmacSum(newHash, []byte(key.text), []byte(normalized)))
+
+	header := func(id, ext string) string {
+		fields := []string{`id="` + id + `"`, `ts="` + ts + `"`, `nonce="` + nonce + `"`}
+		if payloadHash != "" {
+			fields = append(fields, `hash="`+payloadHash+`"`)
+		}
+		if ext != "" {
+			fields = append(fields, `ext="`+strings.ReplaceAll(ext, `"`, `\"`)+`"`)
+		}
+		return "Hawk " + strings.Join(append(fields, `mac="`+mac+`"`), ", ")
+	}
+	shownExt := strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(ext.masked)
+	r.setHeader("Authorization", header(id.text, escapedExt), header(id.masked, shownExt))
+	r.signing = &signingDebug{
+		scheme:    "Hawk",
+		steps:     append(steps, signingStep{"Normalized string", hawkNormalized(r.method, display, ts, nonce, payloadHash, shownExt)}),
+		signature: mac,
+	}
+	return nil
+}
+
+// hawkNormalized is the string a Hawk MAC is computed over
+func hawkNormalized(method string, u *url.URL, ts, nonce, payloadHash, ext string) string {
+	resource := u.EscapedPath()
+	if resource == "" {
+		resource = "/"
+	}
+	if u.RawQuery != "" {
+		resource += "?" + u.RawQuery
+	}
+	port := u.Port()
+	if port == "" {
+		port = "443"
+		if u.Scheme == "http" {
+			port = "80"
+		}
+	}
+	return strings.Join([]string{"hawk.1.header", ts, nonce, method, resource, strings.ToLower(u.Hostname()), port, payloadHash, ext}, "\n") + "\n"
+}
+
+// HTTP Message Signatures, RFC 9421
+
+// httpSignatureLabel names the signature in Signature-Input and Signature
+const httpSignatureLabel = "sig1"
+
+// signHTTPMessage signs the request with HTTP Message Signatures (RFC
+// 9421). The body is covered through a Content-Digest header.
+func (r *resolvedRequest) signHTTPMessage(a *requestAuth, expand func(string) expansion) error {
+	keyID, secret := expand(a.KeyID), expand(a.Secret)
+	if secret.text == "" {
+		return errors.New("http-signature auth needs a secret")
+	}
+	alg := a.Algorithm
+	if alg == "" {
+		alg = "hmac-sha256"
+	}
+	u, display, err := r.signingURLs()
+	if err != nil {
+		return err
+	}
+	body, err := r.signedBody()
+	if err != nil {
+		return err
+	}
+	components := a.Components
+	if len(body) > 0 {
+		digest := "sha-256=:" + base64.StdEncoding.EncodeToString(sha256Sum(body)) + ":"
+		r.setHeader("Content-Digest", digest, digest)
+		r.setSignedContentType()
+		if components == nil {
+			components = []string{"@method", "@target-uri", "content-type", "content-digest"}
+		}
+	} else if components == nil {
+		components = []string{"@method", "@target-uri"}
+	}
+
+	quoted := make([]string, len(components))
+	for i, c := range components {
+		quoted[i] = strconv.Quote(strings.ToLower(c))
+	}
+	params := func(keyID string) string {
+		return fmt.Sprintf("(%s);created=%d;keyid=%s;alg=%s", strings.Join(quoted, " "), time.Now().Unix(), strconv.Quote(keyID), strconv.Quote(alg))
+	}
+	signatureParams, shownParams := params(keyID.text), params(keyID.masked)
+	base, err := httpSignatureBase(r.method, u, r.headers, components, signatureParams)
+	if err != nil {
+		return err
+	}
+	shown, _ := httpSignatureBase(r.method, display, r.displayHeaders, components, shownParams)
+
+	sig, err := signHTTPMessageBase(alg, secret.text, []byte(base))
+	if err != nil {
+		return err
+	}
+	signature := base64.StdEncoding.EncodeToString(sig)
+	r.setHeader("Signature-Input", httpSignatureLabel+"="+signatureParams, httpSignatureLabel+"="+shownParams)
+	r.setHeader("Signature", httpSignatureLabel+"=:"+signature+":", httpSignatureLabel+"=:"+signature+":")
+	r.signing = &signingDebug{
+		scheme:    "HTTP Message Signatures (" + alg + ")",
+		steps:     []signingStep{{"Signature base", shown}},
+		signature: signature,
+	}
+	return nil
+}
+
+// httpSignatureBase builds the signature base of RFC 9421: a line per
+// covered component, then the signature parameters
+func httpSignatureBase(method string, u *url.URL, headers map[string]string, components []string, params string) (string, error) {
+	var sb strings.Builder
+	for _, c := range components {
+		name := strings.ToLower(c)
+		var value string
+		switch name {
+		case "@method":
+			value = method
+		case "@target-uri":
+			value = u.String()
+		case "@authority":
+			value = strings.ToLower(u.Host)
+		case "@scheme":
+			value = strings.ToLower(u.Scheme)
+		case "@path", "@request-target":
+			value = u.EscapedPath()
+			if value == "" {
+				value = "/"
+			}
+			if name == "@request-target" && u.RawQuery != "" {
+				value += "?" + u.RawQuery
+			}
+		case "@query":
+			value = "?" + u.RawQuery
+		default:
+			if strings.HasPrefix(name, "@") {
+				return "", fmt.Errorf("http-signature auth: component %s isn't supported", name)
+			}
+			value = headerValue(headers, name)
+			if value == "" {
+				return "", fmt.Errorf("http-signature auth: component %s: the request has no such header", name)
+			}
+			value = strings.TrimSpace(value)
+		}
+		fmt.Fprintf(&sb, "%q: %s\n", name, value)
+	}
+	sb.WriteString(`"@signature-params": ` + params)
+	return sb.String(), nil
+}
+
+// signHTTPMessageBase signs a signature base with a shared secret for
+// hmac-sha256, or a PEM private key for the other algorithms
+func signHTTPMessageBase(alg, secret string, base []byte) ([]byte, error) {
+	if alg == "hmac-sha256" {
+		return hmacSum(sha256.New, []byte(secret), base), nil
+	}
+	block, _ := pem.Decode([]byte(secret))
+	if block == nil {
+		return nil, fmt.Errorf("http-signature auth: %s needs a PEM private key as the secret", alg)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		if rsaKey, rsaErr := x509.ParsePKCS1PrivateKey(block.Bytes); rsaErr == nil {
+			key, err = rsaKey, nil
+		} else if ecKey, ecErr := x509.ParseECPrivateKey(block.Bytes); ecErr == nil {
+			key, err = ecKey, nil
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("http-signature auth: reading the private key: %w", err)
+	}
+
+	switch k := key.(type) {
+	case ed25519.PrivateKey:
+		if alg == "ed25519" {
+			return ed25519.Sign(k, base), nil
+		}
+	case *rsa.PrivateKey:
+		if alg == "rsa-pss-sha512" {
+			digest := sha512.Sum512(base)
+			return rsa.SignPSS(rand.Reader, k, crypto.SHA512, digest[:], &rsa.PSSOptions{SaltLength: 64})
+		}
+	case *ecdsa.PrivateKey:
+		if alg == "ecdsa-p256-sha256" && k.Curve == elliptic.P256() {
+			// The signature is r and s side by side, not ASN.1
+			digest := sha256Sum(base)
+			sigR, sigS, err := ecdsa.Sign(rand.Reader, k, digest)
+			if err != nil {
+				return nil, err
+			}
+			sig := make([]byte, 64)
+			sigR.FillBytes(sig[:32])
+			sigS.FillBytes(sig[32:])
+			return sig, nil
+		}
+	}
+	return nil, fmt.Errorf("http-signature auth: unknown algorithm %q for a %T key, expected hmac-sha256, ed25519, rsa-pss-sha512 or ecdsa-p256-sha256", alg, key)
+}
+
+func sha256Sum(data []byte) []byte {
+	sum := sha256.Sum256(data)
+	return sum[:]
+}
+
+func hmacSum(newHash func() hash.Hash, key, data []byte) []byte {
+	mac := hmac.New(newHash, key)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+// randomToken is n random letters and digits
+func randomToken(n int) string {
+	const alphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+	b := make([]byte, n)
+	rand.Read(b)
+	for i := range b {
+		b[i] = alphabet[int(b[i])%len(alphabet)]
+	}
+	return string(b)
+}
+
+// awsExpectedPatterns find what AWS says it signed in its
+// SignatureDoesNotMatch errors: XML elements from S3, a message from the
+// other services
+var awsExpectedPatterns = []struct {
+	label   string
+	pattern *regexp.Regexp
+}{
+	{"Canonical request", regexp.MustCompile(`(?s)<CanonicalRequest>(.*?)</CanonicalRequest>`)},
+	{"String to sign", regexp.MustCompile(`(?s)<StringToSign>(.*?)</StringToSign>`)},
+	{"Canonical request", regexp.MustCompile(`(?s)Canonical String for this request should have been\s*'(.*?)'`)},
+	{"String to sign", regexp.MustCompile(`(?s)String-to-Sign should have been\s*'(.*?)'`)},
+}
+
+// expectedSigning reads what the server says it signed from a response
+// rejecting a signature
+func expectedSigning(resp *fetchMsg) []signingStep {
+	if resp == nil || resp.statusCode != 401 && resp.statusCode != 403 {
+		return nil
+	}
+	text := string(resp.body)
+	var data map[string]interface{}
+	if json.Unmarshal(resp.body, &data) == nil {
+		if msg := asString(data["message"]); msg != "" {
+			text = msg
+		} else if msg := asString(data["Message"]); msg != "" {
+			text = msg
+		}
+	}
+	var steps []signingStep
+	seen := map[string]bool{}
+	for _, p := range awsExpectedPatterns {
+		if m := p.pattern.FindStringSubmatch(text); m != nil && !seen[p.label] {
+			seen[p.label] = true
+			steps = append(steps, signingStep{p.label, strings.NewReplacer("&amp;", "&", "&lt;", "<", "&gt;", ">", "&quot;", `"`).Replace(m[1])})
+		}
+	}
+	return steps
+}
+
+var (
+	signingOursStyle   = lipgloss.NewStyle().Foreground(lipgloss.Color("#E06C75"))
+	signingServerStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("#98C379"))
+)
+
+// renderSigning shows what a signed request signed, and where the server
+// says it signed something else
+func renderSigning(d *signingDebug) string {
+	if d == nil {
+		return ""
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s %s\n", headerStyle.Render("Signing:"), d.scheme)
+	for _, step := range d.steps {
+		fmt.Fprintf(&sb, "\n%s\n", historyDimStyle.Render(step.label))
+		for _, line := range strings.Split(step.text, "\n") {
+			sb.WriteString("  " + line + "\n")
+		}
+	}
+	fmt.Fprintf(&sb, "\n%s %s\n", historyDimStyle.Render("Signature"), d.signature)
+
+	for _, expected := range d.expected {
+		var ours string
+		for _, step := range d.steps {
+			if step.label == expected.label {
+				ours = step.text
+			}
+		}
+		fmt.Fprintf(&sb, "\n%s\n", historyDimStyle.Render(expected.label+" the server expected"))
+		if ours == expected.text {
+			sb.WriteString(signingServerStyle.Render("  the same as ours, so the secret key or the scope differs"))
+			sb.WriteString("\n")
+			continue
+		}
+		oursLines, theirLines := strings.Split(ours, "\n"), strings.Split(expected.text, "\n")
+		for i := 0; i < max(len(oursLines), len(theirLines)); i++ {
+			var a, b string
+			if i < len(oursLines) {
+				a = oursLines[i]
+			}
+			if i < len(theirLines) {
+				b = theirLines[i]
+			}
+			if a == b {
+				sb.WriteString("  " + b + "\n")
+				continue
+			}
+			if i < len(oursLines) {
+				sb.WriteString(signingOursStyle.Render("- "+a) + "\n")
+			}
+			if i < len(theirLines) {
+				sb.WriteString(signingServerStyle.Render("+ "+b) + "\n")
+			}
+		}
+	}
+	return sb.String()
+}
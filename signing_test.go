@@ -0,0 +1,105 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// The requests, credentials and signatures of the AWS Signature Version 4
+// test suite, and cases it leaves out checked against the AWS SDK for Go
+func TestAWSSignature(t *testing.T) {
+	const (
+		secretKey = "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"
+		amzDate   = "20150830T123600Z"
+		region    = "us-east-1"
+	)
+	tests := []struct {
+		name, method, url, service, body string
+		canonicalURI, canonicalQuery     string
+		signature                        string
+	}{
+		{
+			name: "get-vanilla", method: "GET", url: "https://example.amazonaws.com/", service: "service",
+			canonicalURI: "/",
+			signature:    "5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31",
+		},
+		{
+			name: "get-vanilla-query-order-key-case", method: "GET", url: "https://example.amazonaws.com/?Param2=value2&Param1=value1", service: "service",
+			canonicalURI: "/", canonicalQuery: "Param1=value1&Param2=value2",
+			signature: "b97d918cfa904a5beff61c982a1b6f458b799221646efd99d3219ec94cdf2500",
+		},
+		{
+			name: "get-vanilla-query-order-key", method: "GET", url: "https://example.amazonaws.com/?Param1=value2&Param1=Value1", service: "service",
+			canonicalURI: "/", canonicalQuery: "Param1=Value1&Param1=value2",
+			signature: "eedbc4e291e521cf13422ffca22be7d2eb8146eecf653089df300a15b2382bd1",
+		},
+		{
+			name: "post-vanilla", method: "POST", url: "https://example.amazonaws.com/", service: "service",
+			canonicalURI: "/",
+			signature:    "5da7c1a2acd57cee7505fc6676e4e544621c30862966e37dddb68e92efbe5d6b",
+		},
+		{
+			name: "query keys sorted before joining", method: "GET", url: "https://example.amazonaws.com/?a-b=1&a=1", service: "service",
+			canonicalURI: "/", canonicalQuery: "a=1&a-b=1",
+			signature: "9eaf58d2125c2abe89525e5101e6c5b6408f16eca6778b44281055cbef154d44",
+		},
+		{
+			name: "utf-8 path encoded twice", method: "GET", url: "https://example.amazonaws.com/%E1%88%B4", service: "service",
+			canonicalURI: "/%25E1%2588%25B4",
+			signature:    "697b34846207a3f72246f99d74ae1ee4fe54f44bb06730c58a0d339eb079596d",
+		},
+		{
+			name: "lambda ARN path", method: "POST", url: "https://lambda.us-east-1.amazonaws.com/2015-03-31/functions/arn:aws:lambda:us-east-1:123456789012:function:f/invocations", service: "lambda", body: "{}",
+			canonicalURI: "/2015-03-31/functions/arn%253Aaws%253Alambda%253Aus-east-1%253A123456789012%253Afunction%253Af/invocations",
+			signature:    "2762ab54fdab6ff5f9e2819ab570d17e30a842fab3b0a721ecb19f20e10b433d",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, err := url.Parse(tt.url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			payloadHash := hex.EncodeToString(sha256Sum([]byte(tt.body)))
+			canonical := awsCanonicalRequest(tt.method, u, map[string]string{"X-Amz-Date": amzDate}, []string{"host", "x-amz-date"}, payloadHash, tt.service)
+			lines := strings.Split(canonical, "\n")
+			if lines[1] != tt.canonicalURI {
+				t.Errorf("canonical URI = %q, want %q", lines[1], tt.canonicalURI)
+			}
+			if lines[2] != tt.canonicalQuery {
+				t.Errorf("canonical query = %q, want %q", lines[2], tt.canonicalQuery)
+			}
+			if _, signature := awsSignature(secretKey, amzDate, region, tt.service, canonical); signature != tt.signature {
+				t.Errorf("signature = %s, want %s\ncanonical request:\n%s", signature, tt.signature, canonical)
+			}
+		})
+	}
+}
+
+func TestHTTPMessageSignatureCurves(t *testing.T) {
+	for _, curve := range []elliptic.Curve{elliptic.P256(), elliptic.P384(), elliptic.P521()} {
+		key, err := ecdsa.GenerateKey(curve, rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		secret := string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+		sig, err := signHTTPMessageBase("ecdsa-p256-sha256", secret, []byte("base"))
+		switch name := curve.Params().Name; {
+		case curve == elliptic.P256() && (err != nil || len(sig) != 64):
+			t.Errorf("%s: got a %d byte signature, %v", name, len(sig), err)
+		case curve != elliptic.P256() && err == nil:
+			t.Errorf("%s: signed with ecdsa-p256-sha256, want an error", name)
+		}
+	}
+}
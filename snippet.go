@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// snippetLanguage renders a resolved request as code sending the same.
+// masked leaves secret values out, for display.
+type snippetLanguage struct {
+	name   string
+	render func(r resolvedRequest, masked bool) string
+}
+
+// snippetLanguages are offered by the Ctrl+Y menu, in order
+var snippetLanguages = []snippetLanguage{
+	{"curl", curlCommand},
+	{"Go (net/http)", goSnippet},
+	{"Python (requests)", pythonSnippet},
+	{"JavaScript (fetch)", javaScriptSnippet},
+}
+
+// snippetTarget is the URL and body of a request, masked or not
+func snippetTarget(r resolvedRequest, masked bool) (target, body string) {
+	if masked {
+		return r.display, r.displayBody
+	}
+	return r.url, r.body
+}
+
+// goSnippet renders a request as a Go program using net/http
+func goSnippet(r resolvedRequest, masked bool) string {
+	target, body := snippetTarget(r, masked)
+	imports := []string{"fmt", "io", "log", "net/http"}
+	var sb strings.Builder
+	bodyArg := "nil"
+	switch {
+	case r.bodyFile != "":
+		imports = append(imports, "os")
+		fmt.Fprintf(&sb, "\tbody, err := os.Open(%s)\n\tif err != nil {\n\t\tlog.Fatal(err)\n\t}\n\tdefer body.Close()\n\n", strconv.Quote(r.bodyFile))
+		bodyArg = "body"
+	case body != "":
+		imports = append(imports, "strings")
+		bodyArg = "strings.NewReader(" + goString(body) + ")"
+	}
+	fmt.Fprintf(&sb, "\treq, err := http.NewRequest(%s, %s, %s)\n\tif err != nil {\n\t\tlog.Fatal(err)\n\t}\n",
+		strconv.Quote(r.method), strconv.Quote(target), bodyArg)
+	for _, h := range sentHeaders(r, masked) {
+		fmt.Fprintf(&sb, "\treq.Header.Set(%s, %s)\n", strconv.Quote(h[0]), strconv.Quote(h[1]))
+	}
+	sb.WriteString("\n")
+	client := "http.DefaultClient"
+	if r.timeouts.ConnectMs > 0 {
+		imports = append(imports, "net", "time")
+		fmt.Fprintf(&sb, "\tclient := &http.Client{Transport: &http.Transport{\n\t\tDialContext: (&net.Dialer{Timeout: %d * time.Millisecond}).DialContext,\n\t}}\n", r.timeouts.ConnectMs)
+		client = "client"
+	}
+	fmt.Fprintf(&sb, "\tresp, err := %s.Do(req)\n", client)
+	sb.WriteString("\tif err != nil {\n\t\tlog.Fatal(err)\n\t}\n\tdefer resp.Body.Close()\n\n")
+	sb.WriteString("\tdata, err := io.ReadAll(resp.Body)\n\tif err != nil {\n\t\tlog.Fatal(err)\n\t}\n")
+	sb.WriteString("\tfmt.Println(resp.Status)\n\tfmt.Println(string(data))\n}\n")
+
+	sort.Strings(imports)
+	var program strings.Builder
+	program.WriteString("package main\n\nimport (\n")
+	for _, imp := range imports {
+		fmt.Fprintf(&program, "\t%q\n", imp)
+	}
+	program.WriteString(")\n\nfunc main() {\n")
+	program.WriteString(sb.String())
+	return program.String()
+}
+
+// goString quotes s as a Go string literal, a raw one for multi-line
+// text when it can be
+func goString(s string) string {
+	if strings.Contains(s, "\n") && !strings.ContainsAny(s, "`\r") && strconv.CanBackquote(strings.ReplaceAll(s, "\n", "")) {
+		return "`" + s + "`"
+	}
+	return strconv.Quote(s)
+}
+
+// pythonMethods have a function of their own in requests
+var pythonMethods = map[string]bool{"GET": true, "POST": true, "PUT": true, "PATCH": true, "DELETE": true, "HEAD": true, "OPTIONS": true}
+
+// pythonSnippet renders a request as a Python script using requests
+func pythonSnippet(r resolvedRequest, masked bool) string {
+	target, body := snippetTarget(r, masked)
+	var sb strings.Builder
+	sb.WriteString("import requests\n\n")
+	if pythonMethods[r.method] {
+		fmt.Fprintf(&sb, "response = requests.%s(\n    %s,\n", strings.ToLower(r.method), strconv.Quote(target))
+	} else {
+		fmt.Fprintf(&sb, "response = requests.request(\n    %s,\n    %s,\n", strconv.Quote(r.method), strconv.Quote(target))
+	}
+	if headers := sentHeaders(r, masked); len(headers) > 0 {
+		sb.WriteString("    headers={\n")
+		for _, h := range headers {
+			fmt.Fprintf(&sb, "        %s: %s,\n", strconv.Quote(h[0]), strconv.Quote(h[1]))
+		}
+		sb.WriteString("    },\n")
+	}
+	switch {
+	case r.bodyFile != "":
+		fmt.Fprintf(&sb, "    data=open(%s, \"rb\"),\n", strconv.Quote(r.bodyFile))
+	case body != "":
+		fmt.Fprintf(&sb, "    data=%s,\n", pythonString(body))
+	}
+	if r.timeouts.ConnectMs > 0 {
+		fmt.Fprintf(&sb, "    timeout=(%s, None),\n", strconv.FormatFloat(float64(r.timeouts.ConnectMs)/1000, 'f', -1, 64))
+	}
+	sb.WriteString(")\nprint(response.status_code, response.reason)\nprint(response.text)\n")
+	return sb.String()
+}
+
+// pythonString quotes s as a Python string literal, triple-quoted for
+// multi-line text when it can be
+func pythonString(s string) string {
+	if strings.Contains(s, "\n") && !strings.ContainsAny(s, "\\\r") && !strings.Contains(s, `"""`) && !strings.HasSuffix(s, `"`) {
+		return `"""` + s + `"""`
+	}
+	return strconv.Quote(s)
+}
+
+// javaScriptSnippet renders a request as a fetch call, for Node.js 18 or
+// later as an ES module (browsers refuse to set Cookie and User-Agent)
+func javaScriptSnippet(r resolvedRequest, masked bool) string {
+	target, body := snippetTarget(r, masked)
+	var sb strings.Builder
+	if r.bodyFile != "" {
+		sb.WriteString("import { readFileSync } from \"node:fs\";\n\n")
+	}
+	fmt.Fprintf(&sb, "const response = await fetch(%s, {\n", javaScriptString(target))
+	fmt.Fprintf(&sb, "  method: %s,\n", javaScriptString(r.method))
+	if headers := sentHeaders(r, masked); len(headers) > 0 {
+		sb.WriteString("  headers: {\n")
+		for _, h := range headers {
+			fmt.Fprintf(&sb, "    %s: %s,\n", javaScriptString(h[0]), javaScriptString(h[1]))
+		}
+		sb.WriteString("  },\n")
+	}
+	switch {
+	case r.bodyFile != "":
+		fmt.Fprintf(&sb, "  body: readFileSync(%s),\n", javaScriptString(r.bodyFile))
+	case body != "":
+		fmt.Fprintf(&sb, "  body: %s,\n", javaScriptString(body))
+	}
+	if r.timeouts.ConnectMs > 0 {
+		// fetch has no connect timeout, this one bounds the whole request
+		fmt.Fprintf(&sb, "  signal: AbortSignal.timeout(%d),\n", r.timeouts.ConnectMs)
+	}
+	sb.WriteString("});\nconsole.log(response.status, response.statusText);\nconsole.log(await response.text());\n")
+	return sb.String()
+}
+
+// javaScriptString quotes s as a JavaScript string literal, a template
+// literal for multi-line text when it can be
+func javaScriptString(s string) string {
+	if strings.Contains(s, "\n") && !strings.ContainsAny(s, "`\\\r") && !strings.Contains(s, "${") {
+		return "`" + s + "`"
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// openSnippets opens the menu of languages to copy the request in the
+// input line as, on the last one chosen
+func (m model) openSnippets() model {
+	m.showSnippets = true
+	m.response = renderSnippetMenu(m.snippetIdx)
+	m.viewport.SetContent(m.response)
+	m.viewport.GotoTop()
+	return m
+}
+
+func (m model) updateSnippets(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.Type {
+	case tea.KeyCtrlC:
+		return m, tea.Quit
+	case tea.KeyEsc, tea.KeyCtrlY:
+		m.showSnippets = false
+		m.response = ""
+		m.viewport.SetContent(m.response)
+		return m, nil
+	case tea.KeyUp:
+		if m.snippetIdx > 0 {
+			m.snippetIdx--
+		}
+	case tea.KeyDown:
+		if m.snippetIdx < len(snippetLanguages)-1 {
+			m.snippetIdx++
+		}
+	case tea.KeyEnter:
+		m.showSnippets = false
+		return m.exportSnippet(m.textInput.Value(), snippetLanguages[m.snippetIdx])
+	}
+	m.response = renderSnippetMenu(m.snippetIdx)
+	m.viewport.SetContent(m.response)
+	return m, nil
+}
+
+// renderSnippetMenu draws the menu of snippet languages
+func renderSnippetMenu(selected int) string {
+	var sb strings.Builder
+	sb.WriteString(headerStyle.Render("Copy request as"))
+	sb.WriteString("\n\n")
+	for i, lang := range snippetLanguages {
+		if i == selected {
+			sb.WriteString(selectedSuggestionStyle.Render("› " + lang.name))
+		} else {
+			sb.WriteString(suggestionStyle.Render(lang.name))
+		}
+		sb.WriteString("\n")
+	}
+	sb.WriteString(historyDimStyle.Render("\n↑/↓: Select • Enter: Copy • Esc: Close"))
+	return sb.String()
+}
+
+// exportSnippet copies the request in the input line as code in lang,
+// with its variables and secrets resolved, and shows it with the secrets
+// masked
+func (m model) exportSnippet(line string, lang snippetLanguage) (model, tea.Cmd) {
+	r := m.resolveInput(line)
+	var blocked bool
+	retry := func(m model) (model, tea.Cmd) { return m.exportSnippet(line, lang) }
+	if m, blocked = m.checkUnresolved(r.missing, retry); blocked {
+		m.viewport.SetContent(m.response)
+		return m, nil
+	}
+	code := lang.render(r, false)
+	where := copyToClipboard(code)
+
+	var sb strings.Builder
+	sb.WriteString(headerStyle.Render(lang.name))
+	sb.WriteString(lipgloss.NewStyle().Foreground(lipgloss.Color("#888888")).Render(" (copied to " + where + ")"))
+	sb.WriteString("\n\n")
+	display := lang.render(r, true)
+	sb.WriteString(display)
+	sb.WriteString("\n")
+	if display != code {
+		sb.WriteString("\n")
+		sb.WriteString(curlWarningStyle.Render("⚠ The copied code holds the secret values masked here"))
+		sb.WriteString("\n")
+	}
+	if len(r.dynamic) > 0 {
+		sb.WriteString("\n")
+		sb.WriteString(curlWarningStyle.Render("Values generated for this copy only: " + strings.Join(r.dynamic, ", ")))
+		sb.WriteString("\n")
+	}
+	m.err = nil
+	m.response = sb.String()
+	m.viewport.SetContent(m.response)
+	m.viewport.GotoTop()
+	m.notice = "Copied as " + lang.name + " to " + where
+	return m, nil
+}
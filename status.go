@@ -0,0 +1,76 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// incognito disables everything lazyhttp would otherwise persist (history,
+// cookies, autosave) for the whole session
+var incognito bool
+
+var (
+	statusTextStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("#888888"))
+
+	workspaceStyle   = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("#61AFEF"))
+	environmentStyle = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("#98C379"))
+	sessionStyle     = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("#E5C07B"))
+
+	uploadStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("#FFCC00"))
+
+	incognitoStyle = lipgloss.NewStyle().
+			Bold(true).
+			Foreground(lipgloss.Color("#FAFAFA")).
+			Background(lipgloss.Color("#C678DD")).
+			Padding(0, 1)
+)
+
+// statusBar renders the one-line session status shown under the main
+// container
+func (m model) statusBar() string {
+	var segments []string
+	if m.alert != "" {
+		segments = append(segments, alertStyle.Render(m.alert))
+	}
+	if incognito {
+		segments = append(segments,
+			incognitoStyle.Render("INCOGNITO")+" "+statusTextStyle.Render("nothing is being recorded"))
+	}
+	if insecureTLS.Load() {
+		segments = append(segments,
+			insecureBadgeStyle.Render("INSECURE TLS")+" "+statusTextStyle.Render("certificates aren't verified"))
+	}
+	if m.mask.on {
+		segments = append(segments, maskBadgeStyle.Render("MASKED"))
+	}
+	if p := describeProxy(); p != "" {
+		segments = append(segments, statusTextStyle.Render("proxy: ")+proxyStyle.Render(p))
+	}
+	if currentWorkspace != defaultWorkspace {
+		segment := statusTextStyle.Render("workspace: ") + workspaceStyle.Render(currentWorkspace)
+		if isRemoteWorkspace(currentWorkspace) {
+			segment += statusTextStyle.Render(" (read-only)")
+		}
+		segments = append(segments, segment)
+	}
+	if activeEnvironment != "" {
+		segments = append(segments, statusTextStyle.Render("env: ")+environmentStyle.Render(activeEnvironment))
+	}
+	if s := m.draftSummary(); s != "" {
+		segments = append(segments, statusTextStyle.Render("with "+s))
+	}
+	if activeSession != "" {
+		segments = append(segments, statusTextStyle.Render("session: ")+sessionStyle.Render(activeSession))
+	}
+	if s := m.usage.renderQuotas(); s != "" {
+		segments = append(segments, s)
+	}
+	if m.notice != "" {
+		segments = append(segments, statusTextStyle.Render(m.notice))
+	}
+	if m.upload != nil {
+		segments = append(segments, uploadStyle.Render(renderUpload(m.upload)))
+	}
+	return strings.Join(segments, statusTextStyle.Render(" • "))
+}
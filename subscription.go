@@ -0,0 +1,407 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"golang.org/x/net/websocket"
+)
+
+// The WebSocket subprotocols of GraphQL subscriptions: that of the
+// graphql-ws library, and the older one of subscriptions-transport-ws,
+// confusingly named graphql-ws too. Both are offered, the server picks.
+const (
+	graphqlTransportWS = "graphql-transport-ws"
+	legacyGraphQLWS    = "graphql-ws"
+)
+
+// connectionAckTimeout bounds the wait for the server to accept the
+// connection
+const connectionAckTimeout = 10 * time.Second
+
+// maxShownResults bounds the results of a subscription kept and shown
+const maxShownResults = 500
+
+// isSubscription reports whether the first operation of a GraphQL
+// document is a subscription
+func isSubscription(query string) bool {
+	tokens, _ := gqlTokens(query)
+	for _, t := range tokens {
+		if t.kind == 'n' && t.text != "fragment" {
+			return t.text == "subscription"
+		}
+		if t.text == "{" {
+			return false
+		}
+	}
+	return false
+}
+
+// websocketURL is the WebSocket URL of an HTTP endpoint
+func websocketURL(u string) string {
+	if rest, ok := strings.CutPrefix(u, "https://"); ok {
+		return "wss://" + rest
+	}
+	if rest, ok := strings.CutPrefix(u, "http://"); ok {
+		return "ws://" + rest
+	}
+	return u
+}
+
+// subscriptionResult is one message of a subscription: a result, or
+// errors the server sent
+type subscriptionResult struct {
+	at      time.Duration // since the subscription started
+	errors  bool
+	payload json.RawMessage
+}
+
+// gqlSubscription is a subscription running or ended
+type gqlSubscription struct {
+	seq      int
+	url      string
+	protocol string
+	started  time.Time
+	results  []subscriptionResult
+	dropped  int // results no longer kept
+	running  bool
+	ended    string // how it ended
+	err      error
+}
+
+// subscriptionSeq numbers subscriptions, so messages of one stopped can be
+// told apart
+var subscriptionSeq int
+
+// subscriptionOpenMsg tells that the server accepted the subscription
+type subscriptionOpenMsg struct {
+	stream   <-chan tea.Msg
+	seq      int
+	protocol string
+}
+
+// subscriptionResultMsg delivers a result of a subscription
+type subscriptionResultMsg struct {
+	stream <-chan tea.Msg
+	seq    int
+	result subscriptionResult
+}
+
+// subscriptionEndMsg ends a subscription: completed by the server,
+// stopped, or failed
+type subscriptionEndMsg struct {
+	seq   int
+	ended string
+	err   error
+}
+
+// subscriptionMessage is a message of either subprotocol
+type subscriptionMessage struct {
+	ID      string          `json:"id,omitempty"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// subscribe runs the subscription in the editor over a WebSocket to the
+// endpoint, with the headers, session and cookies a request to it would
+// have, streaming its results into the response view until it's stopped
+func (m model) subscribe() (model, tea.Cmd) {
+	variables := strings.TrimSpace(m.graphql.variables.Value())
+	r := m.graphqlRequest(m.graphql.query.Value(), variables)
+	m.draft = &r
+	m.textInput.SetValue(r.requestLine())
+	m.textInput.CursorEnd()
+	resolved := resolveSavedRequest(r, m.templateContext())
+	var blocked bool
+	retry := func(m model) (model, tea.Cmd) { return m.subscribe() }
+	if m, blocked = m.checkUnresolved(resolved.missing, retry); blocked {
+		m.viewport.SetContent(m.response)
+		return m, nil
+	}
+	var payload json.RawMessage = []byte(resolved.body)
+	if !json.Valid(payload) {
+		m.err = errors.New("the variables aren't valid JSON")
+		return m, nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	subscriptionSeq++
+	m.fetching = true
+	m.cancel = cancel
+	m.err = nil
+	m.notice = ""
+	m.showTiming, m.showCerts = false, false
+	m.graphql.sub = &gqlSubscription{seq: subscriptionSeq, url: websocketURL(resolved.url), started: time.Now(), running: true}
+	m.response = renderSubscription(m.graphql.sub)
+	m.viewport.SetContent(m.response)
+
+	stream := make(chan tea.Msg)
+	go runSubscription(ctx, subscriptionSeq, resolved, payload, stream)
+	return m, waitForFetch(stream)
+}
+
+// subscriptionHeader is the header of the WebSocket handshake: that of
+// the request, less what describes its body, with the session's headers
+// and the cookies for the endpoint
+func subscriptionHeader(r resolvedRequest) (http.Header, error) {
+	req, err := http.NewRequest(http.MethodGet, r.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	client := &http.Client{Jar: cookieJar}
+	sess, err := requestSession(r.session, r.url)
+	if err != nil {
+		return nil, err
+	}
+	if sess != nil {
+		sess.apply(req, client)
+	}
+	req.Header.Set("User-Agent", defaultUserAgent)
+	for k, v := range r.headers {
+		if !strings.HasPrefix(strings.ToLower(k), "content-") {
+			req.Header.Set(k, v)
+		}
+	}
+	for _, c := range client.Jar.Cookies(req.URL) {
+		req.AddCookie(c)
+	}
+	return req.Header, nil
+}
+
+// runSubscription opens the WebSocket, subscribes with payload, the query
+// and variables, and streams the results until the server completes the
+// subscription or ctx is cancelled, which stops it
+func runSubscription(ctx context.Context, seq int, r resolvedRequest, payload json.RawMessage, stream chan tea.Msg) {
+	end := func(ended string, err error) {
+		stream <- subscriptionEndMsg{seq: seq, ended: ended, err: err}
+	}
+	endpoint, err := url.Parse(r.url)
+	if err != nil {
+		end("", err)
+		return
+	}
+	origin := endpoint.Scheme + "://" + endpoint.Host
+	config, err := websocket.NewConfig(websocketURL(r.url), origin)
+	if err != nil {
+		end("", err)
+		return
+	}
+	config.Protocol = []string{graphqlTransportWS, legacyGraphQLWS}
+	config.TlsConfig = tlsConfig()
+	if config.Header, err = subscriptionHeader(r); err != nil {
+		end("", err)
+		return
+	}
+	ws, err := config.DialContext(ctx)
+	if err != nil {
+		if ctx.Err() != nil {
+			end("Stopped before the server answered", nil)
+			return
+		}
+		end("", fmt.Errorf("opening the WebSocket: %w", err))
+		return
+	}
+	defer ws.Close()
+	ctx, done := context.WithCancel(ctx)
+	defer done()
+
+	// A server that names no subprotocol is taken to speak the current one
+	protocol := graphqlTransportWS
+	if len(config.Protocol) == 1 {
+		protocol = config.Protocol[0]
+	}
+	legacy := protocol == legacyGraphQLWS
+	send := func(msg subscriptionMessage) error {
+		return websocket.JSON.Send(ws, msg)
+	}
+	receive := func() (subscriptionMessage, error) {
+		var msg subscriptionMessage
+		err := websocket.JSON.Receive(ws, &msg)
+		return msg, err
+	}
+
+	// Stopping closes the socket, which ends the reads below, telling the
+	// server first once subscribed so it can clean up
+	var subscribed atomic.Bool
+	start, stop, next := "subscribe", "complete", "next"
+	if legacy {
+		start, stop, next = "start", "stop", "data"
+	}
+	const id = "1"
+	go func() {
+		<-ctx.Done()
+		if subscribed.Load() {
+			send(subscriptionMessage{ID: id, Type: stop})
+		}
+		ws.Close()
+	}()
+
+	if err := send(subscriptionMessage{Type: "connection_init", Payload: json.RawMessage("{}")}); err != nil {
+		end("", err)
+		return
+	}
+	ws.SetReadDeadline(time.Now().Add(connectionAckTimeout))
+	for acked := false; !acked; {
+		msg, err := receive()
+		switch {
+		case err != nil && ctx.Err() != nil:
+			end("Stopped before the server accepted the connection", nil)
+			return
+		case err != nil:
+			end("", fmt.Errorf("waiting for the server to accept the connection: %w", err))
+			return
+		case msg.Type == "connection_ack":
+			acked = true
+		case msg.Type == "connection_error":
+			end("", fmt.Errorf("the server refused the connection: %s", msg.Payload))
+			return
+		case msg.Type == "ping":
+			send(subscriptionMessage{Type: "pong"})
+		}
+	}
+	ws.SetReadDeadline(time.Time{})
+
+	if err := send(subscriptionMessage{ID: id, Type: start, Payload: payload}); err != nil {
+		end("", err)
+		return
+	}
+	subscribed.Store(true)
+	stream <- subscriptionOpenMsg{stream: stream, seq: seq, protocol: protocol}
+
+	started := time.Now()
+	for {
+		msg, err := receive()
+		if err != nil {
+			if ctx.Err() != nil {
+				end("Stopped", nil)
+			} else {
+				end("", fmt.Errorf("the server closed the connection: %w", err))
+			}
+			return
+		}
+		switch msg.Type {
+		case next, "error":
+			stream <- subscriptionResultMsg{stream: stream, seq: seq, result: subscriptionResult{
+				at: time.Since(started), errors: msg.Type == "error", payload: msg.Payload}}
+			// In the current protocol errors end the subscription
+			if msg.Type == "error" && !legacy {
+				end("Ended by an error", nil)
+				return
+			}
+		case "complete":
+			end("Completed by the server", nil)
+			return
+		case "ping":
+			send(subscriptionMessage{Type: "pong"})
+		}
+	}
+}
+
+// addSubscriptionResult shows a result of the running subscription,
+// following the newest unless the view was scrolled up
+func (m model) addSubscriptionResult(msg subscriptionResultMsg) (model, tea.Cmd) {
+	s := m.graphql.sub
+	if s == nil || s.seq != msg.seq {
+		return m, waitForFetch(msg.stream)
+	}
+	s.results = append(s.results, msg.result)
+	if len(s.results) > maxShownResults {
+		s.dropped += len(s.results) - maxShownResults
+		s.results = s.results[len(s.results)-maxShownResults:]
+	}
+	m.response = renderSubscription(s)
+	atBottom := m.viewport.AtBottom()
+	m.viewport.SetContent(m.response)
+	if atBottom {
+		m.viewport.GotoBottom()
+	}
+	return m, waitForFetch(msg.stream)
+}
+
+// openSubscription notes the subprotocol the server speaks
+func (m model) openSubscription(msg subscriptionOpenMsg) (model, tea.Cmd) {
+	if s := m.graphql.sub; s != nil && s.seq == msg.seq {
+		s.protocol = msg.protocol
+		m.response = renderSubscription(s)
+		m.viewport.SetContent(m.response)
+	}
+	return m, waitForFetch(msg.stream)
+}
+
+// endSubscription records how the subscription ended
+func (m model) endSubscription(msg subscriptionEndMsg) model {
+	s := m.graphql.sub
+	if s == nil || s.seq != msg.seq {
+		return m
+	}
+	s.running, s.ended, s.err = false, msg.ended, msg.err
+	m.fetching = false
+	if m.cancel != nil {
+		m.cancel()
+		m.cancel = nil
+	}
+	m.response = renderSubscription(s)
+	atBottom := m.viewport.AtBottom()
+	m.viewport.SetContent(m.response)
+	if atBottom {
+		m.viewport.GotoBottom()
+	}
+	return m
+}
+
+// renderSubscription lists the results of a subscription, oldest first
+func renderSubscription(s *gqlSubscription) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s %s", headerStyle.Render("Subscription:"), s.url)
+	if s.protocol != "" {
+		sb.WriteString(historyDimStyle.Render(" • " + s.protocol))
+	}
+	fmt.Fprintf(&sb, historyDimStyle.Render(" • %d results"), len(s.results)+s.dropped)
+	if s.running {
+		sb.WriteString(historyDimStyle.Render(" • ") + liveStyle.Render("● live") + historyDimStyle.Render(" • Ctrl+X: Stop"))
+	}
+	sb.WriteString("\n\n")
+	if s.dropped > 0 {
+		sb.WriteString(historyDimStyle.Render(fmt.Sprintf("… %d earlier results not shown", s.dropped)))
+		sb.WriteString("\n\n")
+	}
+	for i, r := range s.results {
+		head := historyDimStyle.Render(fmt.Sprintf("#%d", s.dropped+i+1)) + "  " + historyDimStyle.Render("+"+formatDuration(r.at))
+		if r.errors {
+			head += "  " + errorStyle.Render("errors")
+		}
+		sb.WriteString(head)
+		sb.WriteString("\n")
+		body, err := prettyPrintJSON(r.payload)
+		if err != nil {
+			body = string(r.payload)
+		}
+		for _, line := range strings.Split(strings.TrimRight(body, "\n"), "\n") {
+			sb.WriteString("  " + line + "\n")
+		}
+		sb.WriteString("\n")
+	}
+	switch {
+	case s.err != nil:
+		sb.WriteString(errorStyle.Render("Error: " + s.err.Error()))
+		sb.WriteString("\n")
+	case !s.running:
+		sb.WriteString(historyDimStyle.Render(s.ended))
+		sb.WriteString("\n")
+	case s.protocol == "":
+		sb.WriteString(historyDimStyle.Render("Connecting..."))
+		sb.WriteString("\n")
+	case len(s.results) == 0:
+		sb.WriteString(historyDimStyle.Render("Waiting for results..."))
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
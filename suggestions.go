@@ -0,0 +1,240 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// maxSuggestions keeps the follow-up menu small
+const maxSuggestions = 6
+
+// suggestion is a follow-up action derived from a response. When fetch is
+// set the URL is requested right away, otherwise it is only placed in the
+// input for editing.
+type suggestion struct {
+	label string
+	url   string
+	fetch bool
+}
+
+var (
+	linkNextPattern = regexp.MustCompile(`<([^>]+)>\s*;[^,]*rel="?next"?`)
+
+	suggestionStyle         = lipgloss.NewStyle().PaddingLeft(2)
+	selectedSuggestionStyle = lipgloss.NewStyle().
+				PaddingLeft(1).
+				Bold(true).
+				Foreground(lipgloss.Color("#FAFAFA")).
+				Background(lipgloss.Color("#7D56F4"))
+)
+
+// suggestFollowUps inspects a response and proposes the next requests a
+// user is likely to make
+func suggestFollowUps(r fetchMsg) []suggestion {
+	base, err := url.Parse(r.url)
+	if err != nil {
+		return nil
+	}
+
+	var out []suggestion
+	add := func(s suggestion) {
+		for _, existing := range out {
+			if existing.url == s.url {
+				return
+			}
+		}
+		if s.url != "" && s.url != r.url && len(out) < maxSuggestions {
+			out = append(out, s)
+		}
+	}
+
+	// Unauthorized: offer to retry with Basic credentials embedded in the
+	// URL, which net/http turns into an Authorization header
+	if r.statusCode == 401 {
+		challenge := r.header.Get("WWW-Authenticate")
+		if challenge == "" || strings.HasPrefix(strings.ToLower(challenge), "basic") {
+			withAuth := *base
+			withAuth.User = url.UserPassword("user", "password")
+			label := "Retry with Basic credentials"
+			if challenge != "" {
+				label += " (" + challenge + ")"
+			}
+			add(suggestion{label: label, url: withAuth.String()})
+		}
+	}
+
+	if loc := r.header.Get("Location"); loc != "" {
+		if target, err := base.Parse(loc); err == nil {
+			add(suggestion{label: "Follow Location: " + target.String(), url: target.String(), fetch: true})
+		}
+	}
+
+	if m := linkNextPattern.FindStringSubmatch(r.header.Get("Link")); m != nil {
+		if target, err := base.Parse(m[1]); err == nil {
+			add(suggestion{label: "Next page (Link header)", url: target.String(), fetch: true})
+		}
+	}
+
+	var data interface{}
+	if json.Unmarshal(r.body, &data) != nil {
+		return out
+	}
+
+	if next := jsonNextPage(data); next != "" {
+		if target, err := base.Parse(next); err == nil {
+			add(suggestion{label: "Next page", url: target.String(), fetch: true})
+		}
+	}
+
+	// A list fetched with ?page=N is most likely paginated even when the
+	// payload doesn't say so
+	if _, isList := data.([]interface{}); isList {
+		q := base.Query()
+		if page, err := strconv.Atoi(q.Get("page")); err == nil {
+			q.Set("page", strconv.Itoa(page+1))
+			next := *base
+			next.RawQuery = q.Encode()
+			add(suggestion{label: fmt.Sprintf("Next page (page=%d)", page+1), url: next.String(), fetch: true})
+		}
+	}
+
+	for _, s := range itemSuggestions(base, data) {
+		add(s)
+	}
+
+	return out
+}
+
+// jsonNextPage looks for the usual places APIs put a next page link
+func jsonNextPage(data interface{}) string {
+	obj, ok := data.(map[string]interface{})
+	if !ok {
+		return ""
+	}
+
+	for _, path := range [][]string{
+		{"next"},
+		{"next_page_url"},
+		{"nextPage"},
+		{"links", "next"},
+		{"_links", "next", "href"},
+		{"paging", "next"},
+		{"meta", "next"},
+	} {
+		if s, ok := lookupJSONPath(obj, path).(string); ok && s != "" {
+			return s
+		}
+	}
+	return ""
+}
+
+// itemSuggestions offers a GET of the canonical URL of an id-bearing item:
+// either an explicit self link or the collection URL plus the id
+func itemSuggestions(base *url.URL, data interface{}) []suggestion {
+	item, ok := data.(map[string]interface{})
+	label := "GET this item"
+	if !ok {
+		list, isList := data.([]interface{})
+		if !isList || len(list) == 0 {
+			return nil
+		}
+		if item, ok = list[0].(map[string]interface{}); !ok {
+			return nil
+		}
+		label = "GET first item"
+	}
+
+	for _, path := range [][]string{{"url"}, {"self"}, {"href"}, {"_links", "self", "href"}, {"links", "self"}} {
+		if s, ok := lookupJSONPath(item, path).(string); ok && s != "" {
+			if target, err := base.Parse(s); err == nil {
+				return []suggestion{{label: label + ": " + target.String(), url: target.String(), fetch: true}}
+			}
+		}
+	}
+
+	var id string
+	switch v := item["id"].(type) {
+	case string:
+		id = v
+	case float64:
+		id = strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return nil
+	}
+
+	// Already looking at the item itself
+	if strings.HasSuffix(strings.TrimSuffix(base.Path, "/"), "/"+id) {
+		return nil
+	}
+
+	target := *base
+	target.RawQuery = ""
+	target.Path = strings.TrimSuffix(base.Path, "/") + "/" + url.PathEscape(id)
+	return []suggestion{{label: fmt.Sprintf("%s (id %s)", label, id), url: target.String(), fetch: true}}
+}
+
+// lookupJSONPath walks nested objects following path
+func lookupJSONPath(data interface{}, path []string) interface{} {
+	current := data
+	for _, key := range path {
+		obj, ok := current.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		current = obj[key]
+	}
+	return current
+}
+
+// updateSuggestions handles keys while the follow-up menu is open
+func (m model) updateSuggestions(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.Type {
+	case tea.KeyCtrlC:
+		return m, tea.Quit
+	case tea.KeyEsc, tea.KeyCtrlG:
+		m.showSuggestions = false
+	case tea.KeyUp:
+		if m.suggestionIdx > 0 {
+			m.suggestionIdx--
+		}
+	case tea.KeyDown:
+		if m.suggestionIdx < len(m.suggestions)-1 {
+			m.suggestionIdx++
+		}
+	case tea.KeyEnter:
+		s := m.suggestions[m.suggestionIdx]
+		m.showSuggestions = false
+		m.textInput.SetValue(s.url)
+		m.textInput.CursorEnd()
+		m.draft = nil
+		if s.fetch {
+			return m.startFetch(s.url)
+		}
+	}
+	return m, nil
+}
+
+// renderSuggestions draws the follow-up menu
+func renderSuggestions(suggestions []suggestion, selected int) string {
+	var sb strings.Builder
+	sb.WriteString(headerStyle.Render("Suggested follow-ups"))
+	sb.WriteString("\n\n")
+	for i, s := range suggestions {
+		if i == selected {
+			sb.WriteString(selectedSuggestionStyle.Render("› " + s.label))
+		} else {
+			sb.WriteString(suggestionStyle.Render(s.label))
+		}
+		sb.WriteString("\n")
+	}
+	sb.WriteString(lipgloss.NewStyle().Foreground(lipgloss.Color("#888888")).
+		Render("\n↑/↓: Select • Enter: Run • Esc: Close"))
+	return sb.String()
+}
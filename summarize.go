@@ -0,0 +1,247 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// summarizeCommand is run by the shell with the body of the last response
+// on stdin, its output being shown in a pane beside the response. Any
+// program reading stdin fits: an LLM CLI, jq, a script of the user's. It
+// is off unless -summarize sets it.
+var summarizeCommand string
+
+// summarizeTimeout bounds a run of the summarize command
+const summarizeTimeout = 2 * time.Minute
+
+// maxSummaryOutput bounds the output kept of the summarize command
+const maxSummaryOutput = 1 << 20
+
+// summaryPaneMinWidth is the narrowest the summary pane gets, border
+// included; it takes a third of the response area otherwise
+const summaryPaneMinWidth = 30
+
+var summaryStyle = lipgloss.NewStyle().
+	BorderStyle(lipgloss.RoundedBorder()).
+	BorderForeground(lipgloss.Color("#336699")).
+	Padding(0, 1)
+
+// summaryState is the summary pane: the output of the summarize command
+// for a response, so far while it runs
+type summaryState struct {
+	status  string // of the response summarized
+	output  []byte
+	running bool
+	err     error
+	cancel  context.CancelFunc
+	seq     int // tells the run shown from cancelled ones
+	offset  int // first line shown
+}
+
+// summaryChunkMsg delivers output of the summarize command as it comes
+type summaryChunkMsg struct {
+	seq    int
+	chunk  []byte
+	stream <-chan tea.Msg
+}
+
+// summaryDoneMsg ends a run of the summarize command
+type summaryDoneMsg struct {
+	seq    int
+	err    error
+	stderr string
+}
+
+// summarySeq numbers runs of the summarize command
+var summarySeq int
+
+// toggleSummary pipes the last response to the summarize command and
+// opens the pane showing its output, or closes the pane, stopping the
+// command if it still runs
+func (m model) toggleSummary() (model, tea.Cmd) {
+	if m.summary != nil {
+		if m.summary.cancel != nil {
+			m.summary.cancel()
+		}
+		m.summary = nil
+		m = m.layout()
+		m.viewport.SetContent(m.response)
+		return m, nil
+	}
+	switch {
+	case summarizeCommand == "":
+		m.notice = errorStyle.Render("No summarize command, start lazyhttp with -summarize \"command\"")
+		return m, nil
+	case m.lastResponse == nil || m.fetching:
+		m.notice = errorStyle.Render("No response to summarize")
+		return m, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), summarizeTimeout)
+	summarySeq++
+	m.summary = &summaryState{status: m.lastResponse.status, running: true, cancel: cancel, seq: summarySeq}
+	m = m.layout()
+	m.viewport.SetContent(m.response)
+
+	stream := make(chan tea.Msg)
+	go runSummarize(ctx, summarySeq, *m.lastResponse, stream)
+	return m, waitForFetch(stream)
+}
+
+// runSummarize runs the summarize command on a response, streaming its
+// output and ending with a summaryDoneMsg. The status and content type of
+// the response are passed along as LAZYHTTP_STATUS and
+// LAZYHTTP_CONTENT_TYPE.
+func runSummarize(ctx context.Context, seq int, resp fetchMsg, stream chan tea.Msg) {
+	cmd := exec.CommandContext(ctx, "sh", "-c", summarizeCommand)
+	cmd.Stdin = bytes.NewReader(resp.body)
+	cmd.Env = append(os.Environ(),
+		"LAZYHTTP_STATUS="+strconv.Itoa(resp.statusCode),
+		"LAZYHTTP_CONTENT_TYPE="+resp.header.Get("Content-Type"))
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err == nil {
+		err = cmd.Start()
+	}
+	if err != nil {
+		stream <- summaryDoneMsg{seq: seq, err: err}
+		return
+	}
+
+	buf := make([]byte, 4096)
+	for {
+		n, readErr := stdout.Read(buf)
+		if n > 0 {
+			stream <- summaryChunkMsg{seq: seq, chunk: append([]byte(nil), buf[:n]...), stream: stream}
+		}
+		if readErr != nil {
+			break
+		}
+	}
+	err = cmd.Wait()
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		err = fmt.Errorf("timed out after %s", summarizeTimeout)
+	} else if ctx.Err() != nil {
+		err = nil
+	}
+	stream <- summaryDoneMsg{seq: seq, err: err, stderr: strings.TrimSpace(stderr.String())}
+}
+
+// addSummaryChunk appends output of the summarize command to the pane;
+// output of runs since replaced is dropped, the stream still drained
+func (m model) addSummaryChunk(msg summaryChunkMsg) (model, tea.Cmd) {
+	if m.summary != nil && m.summary.seq == msg.seq && len(m.summary.output) < maxSummaryOutput {
+		m.summary.output = append(m.summary.output, msg.chunk...)
+	}
+	return m, waitForFetch(msg.stream)
+}
+
+// endSummary records how the summarize command ended
+func (m model) endSummary(msg summaryDoneMsg) model {
+	if m.summary == nil || m.summary.seq != msg.seq {
+		return m
+	}
+	m.summary.running = false
+	m.summary.cancel()
+	m.summary.cancel = nil
+	if msg.err != nil {
+		m.summary.err = msg.err
+		if msg.stderr != "" {
+			m.summary.err = fmt.Errorf("%w: %s", msg.err, msg.stderr)
+		}
+	}
+	return m
+}
+
+// scrollSummary scrolls the summary pane by delta lines, stopping at the
+// last screenful
+func (m model) scrollSummary(delta int) model {
+	if m.summary != nil {
+		_, room := m.summaryLayout()
+		last := max(len(m.summaryBody())-room, 0)
+		m.summary.offset = min(max(m.summary.offset+delta, 0), last)
+	}
+	return m
+}
+
+// summaryLayout is the inner height of the summary pane and the lines of
+// it left for the output, under its title and above its hint
+func (m model) summaryLayout() (height, room int) {
+	height = m.viewport.Height - summaryStyle.GetVerticalFrameSize()
+	return height, max(height-summaryHeaderLines-1, 1)
+}
+
+// summaryHeaderLines are the title, the command and a blank line
+const summaryHeaderLines = 3
+
+// summaryBody is the output of the summarize command, wrapped to the
+// pane, and how the command failed
+func (m model) summaryBody() []string {
+	s := m.summary
+	inner := m.summaryWidth() - summaryStyle.GetHorizontalFrameSize()
+	text := strings.ReplaceAll(string(s.output), "\r", "")
+	if len(s.output) >= maxSummaryOutput {
+		text += "\n[output cut at " + formatBytes(maxSummaryOutput) + "]"
+	}
+	var body []string
+	if text != "" {
+		body = strings.Split(lipgloss.NewStyle().Width(inner).Render(strings.TrimRight(text, "\n")), "\n")
+	}
+	if s.err != nil {
+		body = append(body, strings.Split(errorStyle.Width(inner).Render("Error: "+s.err.Error()), "\n")...)
+	} else if !s.running && text == "" {
+		body = append(body, historyDimStyle.Render("No output"))
+	}
+	return body
+}
+
+// summaryWidth is the width of the summary pane, border included
+func (m model) summaryWidth() int {
+	width := m.width - padding*2
+	if m.sidebar.open {
+		width -= m.panes.sidebarWidth() + 1
+	}
+	return max(width*m.panes.summaryPercent()/100, summaryPaneMinWidth)
+}
+
+// summaryView draws the summary pane
+func (m model) summaryView() string {
+	s := m.summary
+	inner := m.summaryWidth() - summaryStyle.GetHorizontalFrameSize()
+	height, room := m.summaryLayout()
+
+	title := headerStyle.Render("Summary")
+	switch {
+	case s.running:
+		title += historyDimStyle.Render(" running...")
+	case s.status != "":
+		title += historyDimStyle.Render(" of " + s.status)
+	}
+	lines := []string{title, historyDimStyle.Render(truncate(summarizeCommand, inner)), ""}
+
+	// A resize can leave the offset past the last screenful
+	body := m.summaryBody()
+	offset := min(s.offset, max(len(body)-room, 0))
+	end := min(offset+room, len(body))
+	lines = append(lines, body[offset:end]...)
+	hint := "Shift+↑/↓: Scroll • Ctrl+J: Close"
+	if len(body) > room {
+		hint = fmt.Sprintf("%d-%d of %d • ", offset+1, end, len(body)) + hint
+	}
+	for len(lines) < height-1 {
+		lines = append(lines, "")
+	}
+	lines = append(lines, historyDimStyle.Render(truncate(hint, inner)))
+	return summaryStyle.Width(inner).Height(height).Render(strings.Join(lines, "\n"))
+}
@@ -0,0 +1,361 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// templateVars holds the variables set with -var name=value
+var templateVars = map[string]string{}
+
+// extractedVars holds the values saved requests extracted from their
+// responses this session, see savedRequest.Extract
+var extractedVars = map[string]string{}
+
+// templatePattern matches {{name}} placeholders
+var templatePattern = regexp.MustCompile(`\{\{\s*([^{}]*?)\s*\}\}`)
+
+// secretNamePattern flags variables whose values are masked in previews
+var secretNamePattern = regexp.MustCompile(`(?i)(token|secret|password|passwd|api_?key|auth|credential)`)
+
+// maskedValue replaces secret values in previews
+const maskedValue = "••••••••"
+
+// templateContext is everything a placeholder can resolve against
+type templateContext struct {
+	layers []variableLayer // lowest precedence first
+	last   *fetchMsg       // previous response, for $response extractions
+}
+
+// variableLayer is one source of variables, e.g. the active environment
+type variableLayer struct {
+	source string // shown in previews
+	vars   map[string]string
+
+	// secrets are variables whose values are read from a secret store,
+	// see readSecret
+	secrets map[string]string
+}
+
+func (l variableLayer) has(name string) bool {
+	_, isVar := l.vars[name]
+	_, isSecret := l.secrets[name]
+	return isVar || isSecret
+}
+
+// withVariables returns the context with another layer of variables taking
+// precedence over the existing ones
+func (c templateContext) withVariables(source string, vars map[string]string) templateContext {
+	return c.withLayer(variableLayer{source: source, vars: vars})
+}
+
+// withBase returns the context with a layer under the existing ones
+func (c templateContext) withBase(l variableLayer) templateContext {
+	if len(l.vars) == 0 && len(l.secrets) == 0 {
+		return c
+	}
+	c.layers = append([]variableLayer{l}, c.layers...)
+	return c
+}
+
+func (c templateContext) withLayer(l variableLayer) templateContext {
+	if len(l.vars) == 0 && len(l.secrets) == 0 {
+		return c
+	}
+	c.layers = append(c.layers[:len(c.layers):len(c.layers)], l)
+	return c
+}
+
+var errUndefinedVariable = errors.New("undefined variable")
+
+// lookup finds a variable in the layer with the highest precedence and
+// returns the index of that layer. Secrets are read from their store on
+// every lookup so their values aren't kept around.
+func (c templateContext) lookup(name string) (value string, layer int, secret bool, err error) {
+	for i := len(c.layers) - 1; i >= 0; i-- {
+		if spec, ok := c.layers[i].secrets[name]; ok {
+			if err := remoteSecretsRefused(); err != nil {
+				return "", i, true, fmt.Errorf("secret %s: %w", name, err)
+			}
+			value, err := readSecret(spec)
+			if err != nil {
+				err = fmt.Errorf("secret %s: %w", name, err)
+			}
+			return value, i, true, err
+		}
+		if value, ok := c.layers[i].vars[name]; ok {
+			return value, i, false, nil
+		}
+	}
+	return "", -1, false, fmt.Errorf("%w %q", errUndefinedVariable, name)
+}
+
+// usedVariable is a variable a request resolved, where its value came from
+// and which sources it overrides
+type usedVariable struct {
+	name, value, source string
+	overrides           []string
+}
+
+// usedVariables describes the given variables, secret values masked
+func (c templateContext) usedVariables(names []string) []usedVariable {
+	var used []usedVariable
+	for _, name := range names {
+		value, layer, secret, err := c.lookup(name)
+		if err != nil {
+			continue
+		}
+		source := c.layers[layer].source
+		if spec, ok := c.layers[layer].secrets[name]; ok {
+			source += ", secret from " + spec
+		}
+		if secret || secretNamePattern.MatchString(name) {
+			value = maskedValue
+		}
+		v := usedVariable{name: name, value: value, source: source}
+		for i := layer - 1; i >= 0; i-- {
+			if c.layers[i].has(name) {
+				v.overrides = append(v.overrides, c.layers[i].source)
+			}
+		}
+		used = append(used, v)
+	}
+	return used
+}
+
+// expansion is the result of expanding one template
+type expansion struct {
+	text    string       // the expanded text, secrets in the clear
+	masked  string       // the same with secret values masked
+	missing []unresolved // placeholders that could not be resolved
+	dynamic []string     // $functions whose values change on every send
+	used    []string     // variables resolved, each once
+}
+
+// unresolved is a placeholder left in place and why
+type unresolved struct {
+	name string
+	err  error
+}
+
+// expandTemplate replaces every {{placeholder}} in s. Placeholders that
+// can't be resolved are left as they are and reported in missing.
+//
+// Supported placeholders:
+//
+//	{{name}}                     a variable, see templateContext.lookup
+//	{{secret:kv/data/api#token}} a secret, read when the request is sent,
+//	                             see readSecretReference
+//	{{$env.NAME}}                an environment variable of lazyhttp itself
+//	{{$uuid}}, {{$timestamp}},
+//	{{$isoTimestamp}}, {{$randomInt}}
+//	{{$response.status}}         the status code of the previous response
+//	{{$response.header.Name}}    a header of the previous response
+//	{{$response.body.a.0.b}}     a value from the previous JSON response
+func expandTemplate(s string, ctx templateContext) expansion {
+	var exp expansion
+	var text, masked strings.Builder
+	last := 0
+	for _, loc := range templatePattern.FindAllStringSubmatchIndex(s, -1) {
+		text.WriteString(s[last:loc[0]])
+		masked.WriteString(s[last:loc[0]])
+		last = loc[1]
+
+		name := s[loc[2]:loc[3]]
+		value, secret, err := ctx.resolve(name)
+		if err != nil {
+			exp.missing = append(exp.missing, unresolved{name: name, err: err})
+			text.WriteString(s[loc[0]:loc[1]])
+			masked.WriteString(s[loc[0]:loc[1]])
+			continue
+		}
+		switch {
+		case strings.HasPrefix(name, "secret:"):
+		case !strings.HasPrefix(name, "$"):
+			if !containsString(exp.used, name) {
+				exp.used = append(exp.used, name)
+			}
+		case !strings.HasPrefix(name, "$env.") && !strings.HasPrefix(name, "$response."):
+			exp.dynamic = append(exp.dynamic, name)
+		}
+		text.WriteString(value)
+		if secret {
+			masked.WriteString(maskedValue)
+		} else {
+			masked.WriteString(value)
+		}
+	}
+	text.WriteString(s[last:])
+	masked.WriteString(s[last:])
+	exp.text, exp.masked = text.String(), masked.String()
+	return exp
+}
+
+// resolve looks up a single placeholder
+func (c templateContext) resolve(name string) (value string, secret bool, err error) {
+	if ref, ok := strings.CutPrefix(name, "secret:"); ok {
+		if err := remoteSecretsRefused(); err != nil {
+			return "", true, err
+		}
+		value, err := readSecretReference(ref)
+		return value, true, err
+	}
+	if !strings.HasPrefix(name, "$") {
+		value, _, secret, err := c.lookup(name)
+		if err != nil {
+			return "", false, err
+		}
+		return value, secret || secretNamePattern.MatchString(name), nil
+	}
+
+	switch {
+	case strings.HasPrefix(name, "$env."):
+		if err := remoteSecretsRefused(); err != nil {
+			return "", true, err
+		}
+		env := strings.TrimPrefix(name, "$env.")
+		value, ok := os.LookupEnv(env)
+		if !ok {
+			return "", false, fmt.Errorf("environment variable %s is not set", env)
+		}
+		return value, secretNamePattern.MatchString(env), nil
+	case strings.HasPrefix(name, "$response."):
+		return c.extract(strings.TrimPrefix(name, "$response."))
+	}
+
+	switch name {
+	case "$uuid":
+		return newUUID(), false, nil
+	case "$timestamp":
+		return strconv.FormatInt(time.Now().Unix(), 10), false, nil
+	case "$isoTimestamp":
+		return time.Now().UTC().Format(time.RFC3339), false, nil
+	case "$randomInt":
+		n, _ := rand.Int(rand.Reader, big.NewInt(1000))
+		return n.String(), false, nil
+	}
+	return "", false, fmt.Errorf("unknown function %q", name)
+}
+
+// newUUID returns a random (version 4) UUID
+func newUUID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// extract pulls a value out of the previous response
+func (c templateContext) extract(path string) (string, bool, error) {
+	if c.last == nil {
+		return "", false, fmt.Errorf("no previous response")
+	}
+	switch {
+	case path == "status":
+		return strconv.Itoa(c.last.statusCode), false, nil
+	case strings.HasPrefix(path, "header."):
+		name := strings.TrimPrefix(path, "header.")
+		values := c.last.header.Values(name)
+		if len(values) == 0 {
+			return "", false, fmt.Errorf("previous response has no %s header", name)
+		}
+		return values[0], secretNamePattern.MatchString(name), nil
+	case path == "body" || strings.HasPrefix(path, "body."):
+		var data interface{}
+		if err := json.Unmarshal(c.last.body, &data); err != nil {
+			return "", false, fmt.Errorf("previous response is not JSON")
+		}
+		var keys []string
+		if path != "body" {
+			keys = strings.Split(strings.TrimPrefix(path, "body."), ".")
+		}
+		value, ok := walkJSON(data, keys)
+		if !ok {
+			return "", false, fmt.Errorf("%s not found in the previous response", path)
+		}
+		secret := len(keys) > 0 && secretNamePattern.MatchString(keys[len(keys)-1])
+		switch v := value.(type) {
+		case string:
+			return v, secret, nil
+		case nil:
+			return "null", secret, nil
+		default:
+			out, _ := json.Marshal(v)
+			return string(out), secret, nil
+		}
+	}
+	return "", false, fmt.Errorf("unknown extraction %q", path)
+}
+
+// applyExtractions evaluates a saved request's extractions against its
+// response. Paths are those of {{$response.…}} without the prefix, e.g.
+// "body.data.token" or "header.Location".
+func applyExtractions(extract map[string]string, resp *fetchMsg) (values map[string]string, problems []string) {
+	ctx := templateContext{last: resp}
+	values = map[string]string{}
+	for _, name := range sortedKeys(extract) {
+		value, _, err := ctx.extract(extract[name])
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", name, err))
+			continue
+		}
+		values[name] = value
+	}
+	return values, problems
+}
+
+// walkJSON follows keys through objects and, for numeric keys, arrays
+func walkJSON(data interface{}, keys []string) (interface{}, bool) {
+	current := data
+	for _, key := range keys {
+		switch v := current.(type) {
+		case map[string]interface{}:
+			next, ok := v[key]
+			if !ok {
+				return nil, false
+			}
+			current = next
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil, false
+			}
+			current = v[i]
+		default:
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// parseVarFlag handles one -var name=value flag
+func parseVarFlag(s string) error {
+	name, value, ok := strings.Cut(s, "=")
+	if !ok || strings.TrimSpace(name) == "" {
+		return fmt.Errorf("expected name=value, got %q", s)
+	}
+	templateVars[strings.TrimSpace(name)] = value
+	return nil
+}
+
+// extractVariables applies extractions in the TUI, keeping the values for
+// the session, and describes the outcome for the status bar
+func extractVariables(extract map[string]string, resp *fetchMsg) string {
+	values, problems := applyExtractions(extract, resp)
+	for name, value := range values {
+		extractedVars[name] = value
+	}
+	if len(problems) > 0 {
+		return errorStyle.Render("Extraction failed: " + strings.Join(problems, "; "))
+	}
+	return "Extracted " + strings.Join(sortedKeys(values), ", ")
+}
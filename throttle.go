@@ -0,0 +1,249 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// rateLimitsFile holds the per-host rate limits of the workspace, e.g.
+// {"api.example.com": "2/s", "*.partner.example": "100/m"}
+const rateLimitsFile = "rate-limits.json"
+
+// rateLimit allows n requests per period to the hosts matching pattern:
+// a host name, a host:port, or "*.example.com" for its subdomains
+type rateLimit struct {
+	pattern string
+	n       int
+	per     time.Duration
+}
+
+func (l rateLimit) String() string {
+	switch l.per {
+	case time.Second:
+		return fmt.Sprintf("%d/s", l.n)
+	case time.Minute:
+		return fmt.Sprintf("%d/m", l.n)
+	case time.Hour:
+		return fmt.Sprintf("%d/h", l.n)
+	}
+	return fmt.Sprintf("%d/%s", l.n, l.per)
+}
+
+// matches reports whether the limit covers host, a host:port
+func (l rateLimit) matches(host string) bool {
+	name := requestHostname(host)
+	if suffix, ok := strings.CutPrefix(l.pattern, "*."); ok {
+		return strings.HasSuffix(name, "."+suffix)
+	}
+	return strings.EqualFold(l.pattern, host) || strings.EqualFold(l.pattern, name)
+}
+
+// requestHostname is host without its port
+func requestHostname(host string) string {
+	if i := strings.LastIndex(host, ":"); i >= 0 && !strings.Contains(host[i:], "]") {
+		host = host[:i]
+	}
+	return strings.ToLower(strings.Trim(host, "[]"))
+}
+
+// parseRate reads a rate like "2/s", "100/m", "5000/h" or "1/10s"
+func parseRate(s string) (n int, per time.Duration, err error) {
+	count, period, ok := strings.Cut(strings.TrimSpace(s), "/")
+	if !ok {
+		return 0, 0, fmt.Errorf("rate %q: expected requests/period, like 2/s", s)
+	}
+	if n, err = strconv.Atoi(count); err != nil || n <= 0 {
+		return 0, 0, fmt.Errorf("rate %q: the number of requests must be a positive integer", s)
+	}
+	if period == "" || period[0] < '0' || period[0] > '9' {
+		period = "1" + period
+	}
+	if per, err = time.ParseDuration(period); err != nil || per <= 0 {
+		return 0, 0, fmt.Errorf("rate %q: unknown period, use s, m, h or a duration like 10s", s)
+	}
+	return n, per, nil
+}
+
+// flagRateLimits are given with -rate-limit and take precedence over
+// those of the workspace
+var flagRateLimits []rateLimit
+
+// parseRateLimitFlag reads a -rate-limit flag, host=rate
+func parseRateLimitFlag(s string) error {
+	host, rate, ok := strings.Cut(s, "=")
+	if !ok || strings.TrimSpace(host) == "" {
+		return fmt.Errorf("expected host=rate, like api.example.com=2/s, got %q", s)
+	}
+	n, per, err := parseRate(rate)
+	if err != nil {
+		return err
+	}
+	flagRateLimits = append(flagRateLimits, rateLimit{pattern: strings.ToLower(strings.TrimSpace(host)), n: n, per: per})
+	return nil
+}
+
+// hostThrottle holds requests back to keep each host within its rate
+// limit. It counts every request made through newHTTPClient, so sends from
+// the TUI, downloads, comparisons and headless runs share the limits of
+// the process.
+type hostThrottle struct {
+	mu     sync.Mutex
+	limits []rateLimit
+	sent   map[string][]time.Time // send times granted, by limit and host
+}
+
+var throttle = &hostThrottle{sent: map[string][]time.Time{}}
+
+// loadRateLimits reads the rate limits of the current workspace, after
+// those given with -rate-limit. Exact hosts are matched before wildcards,
+// longer wildcards first.
+func loadRateLimits() error {
+	limits := append([]rateLimit(nil), flagRateLimits...)
+	path, err := workspaceFile(rateLimitsFile)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	var fileErr error
+	if err == nil {
+		var rates map[string]string
+		if err := json.Unmarshal(data, &rates); err != nil {
+			fileErr = fmt.Errorf("%s: %w", path, err)
+		}
+		var workspace []rateLimit
+		for host, rate := range rates {
+			n, per, err := parseRate(rate)
+			if err != nil {
+				fileErr = fmt.Errorf("%s: %s: %w", path, host, err)
+				continue
+			}
+			workspace = append(workspace, rateLimit{pattern: strings.ToLower(host), n: n, per: per})
+		}
+		sort.Slice(workspace, func(i, j int) bool {
+			a, b := workspace[i].pattern, workspace[j].pattern
+			if wa, wb := strings.HasPrefix(a, "*."), strings.HasPrefix(b, "*."); wa != wb {
+				return wb
+			}
+			if len(a) != len(b) {
+				return len(a) > len(b)
+			}
+			return a < b
+		})
+		limits = append(limits, workspace...)
+	}
+
+	throttle.mu.Lock()
+	throttle.limits = limits
+	throttle.mu.Unlock()
+	return fileErr
+}
+
+// reserve grants the next request to host a send time within its limit,
+// returning how long it has to wait for it
+func (t *hostThrottle) reserve(host string) (time.Duration, rateLimit, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var limit rateLimit
+	found := false
+	for _, l := range t.limits {
+		if l.matches(host) {
+			limit, found = l, true
+			break
+		}
+	}
+	if !found {
+		return 0, limit, false
+	}
+
+	// A sliding window of the last n send times: the next request goes
+	// once the oldest of them is a period ago
+	key := limit.pattern + " " + strings.ToLower(host)
+	now := time.Now()
+	sent := t.sent[key]
+	at := now
+	if len(sent) >= limit.n {
+		if next := sent[len(sent)-limit.n].Add(limit.per); next.After(now) {
+			at = next
+		}
+	}
+	sent = append(sent, at)
+	if len(sent) > limit.n {
+		sent = sent[len(sent)-limit.n:]
+	}
+	t.sent[key] = sent
+	return at.Sub(now), limit, true
+}
+
+// throttleNoticeKey carries the function told of requests being held back
+type throttleNoticeKey struct{}
+
+// withThrottleNotice has notice called for requests made with ctx that
+// wait for their rate limit, before they wait
+func withThrottleNotice(ctx context.Context, notice func(host string, limit rateLimit, wait time.Duration)) context.Context {
+	return context.WithValue(ctx, throttleNoticeKey{}, notice)
+}
+
+// wait holds a request to host back until its rate limit lets it go, or
+// ctx is done
+func (t *hostThrottle) wait(ctx context.Context, host string) error {
+	d, limit, ok := t.reserve(host)
+	if !ok || d <= 0 {
+		return nil
+	}
+	if notice, ok := ctx.Value(throttleNoticeKey{}).(func(string, rateLimit, time.Duration)); ok {
+		notice(host, limit, d)
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// throttledTransport waits for the rate limit of each request's host,
+// redirects included, before sending it
+type throttledTransport struct {
+	base http.RoundTripper
+}
+
+func (t throttledTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := throttle.wait(req.Context(), req.URL.Host); err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+	return t.base.RoundTrip(req)
+}
+
+// throttleMsg tells the TUI that the request in flight waits for the rate
+// limit of its host
+type throttleMsg struct {
+	stream <-chan tea.Msg
+	host   string
+	limit  rateLimit
+	wait   time.Duration
+}
+
+// renderThrottled says what the request in flight is waiting for
+func renderThrottled(msg throttleMsg) string {
+	return timingWarnStyle.Render(fmt.Sprintf("Rate limited: waiting %s for %s (%s, set for %s)",
+		formatDuration(msg.wait), msg.host, msg.limit, msg.limit.pattern)) + "\n\nCtrl+X cancels the request."
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Limits used for the phases a request doesn't set, Go's own for connect
+// and TLS. Response headers, idle bodies and the whole request aren't
+// limited by default.
+const (
+	defaultConnectTimeout = 30 * time.Second
+	defaultTLSTimeout     = 10 * time.Second
+)
+
+// requestTimeouts bound the phases of a request separately, so a slow
+// connect can be told from a slow first byte. Zero means the default.
+type requestTimeouts struct {
+	ConnectMs        int64 `json:"connect_ms,omitempty"`         // TCP connection established
+	TLSMs            int64 `json:"tls_ms,omitempty"`             // TLS handshake done
+	ResponseHeaderMs int64 `json:"response_header_ms,omitempty"` // headers received after the request was written
+	IdleMs           int64 `json:"idle_ms,omitempty"`            // longest pause while reading the body
+	TotalMs          int64 `json:"total_ms,omitempty"`           // the whole request, redirects and body included
+}
+
+// defaultTimeouts are set with the -*-timeout flags and apply to every
+// request; saved requests can override them
+var defaultTimeouts requestTimeouts
+
+// merge returns t with the fields set in o taking precedence
+func (t requestTimeouts) merge(o *requestTimeouts) requestTimeouts {
+	if o == nil {
+		return t
+	}
+	for _, f := range [][2]*int64{
+		{&t.ConnectMs, &o.ConnectMs}, {&t.TLSMs, &o.TLSMs},
+		{&t.ResponseHeaderMs, &o.ResponseHeaderMs}, {&t.IdleMs, &o.IdleMs},
+		{&t.TotalMs, &o.TotalMs},
+	} {
+		if *f[1] > 0 {
+			*f[0] = *f[1]
+		}
+	}
+	return t
+}
+
+func (t requestTimeouts) connect() time.Duration {
+	if t.ConnectMs > 0 {
+		return time.Duration(t.ConnectMs) * time.Millisecond
+	}
+	return defaultConnectTimeout
+}
+
+func (t requestTimeouts) tls() time.Duration {
+	if t.TLSMs > 0 {
+		return time.Duration(t.TLSMs) * time.Millisecond
+	}
+	return defaultTLSTimeout
+}
+
+func (t requestTimeouts) responseHeader() time.Duration {
+	return time.Duration(t.ResponseHeaderMs) * time.Millisecond
+}
+
+func (t requestTimeouts) idle() time.Duration {
+	return time.Duration(t.IdleMs) * time.Millisecond
+}
+
+func (t requestTimeouts) total() time.Duration {
+	return time.Duration(t.TotalMs) * time.Millisecond
+}
+
+// withTotalTimeout bounds ctx by the total timeout, when there is one
+func (t requestTimeouts) withTotalTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if t.TotalMs <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, t.total())
+}
+
+// String summarizes the timeouts for previews
+func (t requestTimeouts) String() string {
+	limit := func(d time.Duration) string {
+		if d <= 0 {
+			return "none"
+		}
+		return d.String()
+	}
+	return fmt.Sprintf("connect %s • TLS %s • response headers %s • idle %s • total %s",
+		limit(t.connect()), limit(t.tls()), limit(t.responseHeader()), limit(t.idle()), limit(t.total()))
+}
+
+// registerTimeoutFlags adds the -*-timeout flags setting t
+func registerTimeoutFlags(fs *flag.FlagSet, t *requestTimeouts) {
+	fs.Var(msFlag{&t.ConnectMs}, "connect-timeout", "`limit` for establishing the TCP connection (default 30s)")
+	fs.Var(msFlag{&t.TLSMs}, "tls-timeout", "`limit` for the TLS handshake (default 10s)")
+	fs.Var(msFlag{&t.ResponseHeaderMs}, "header-timeout", "`limit` for the response headers to arrive once the request is sent")
+	fs.Var(msFlag{&t.IdleMs}, "idle-timeout", "`limit` for the body to go without new data")
+	fs.Var(msFlag{&t.TotalMs}, "timeout", "`limit` for the whole request, from connecting to the last body byte")
+}
+
+// msFlag is a duration flag kept in milliseconds, like the collection
+// fields it mirrors
+type msFlag struct{ ms *int64 }
+
+func (f msFlag) String() string {
+	if f.ms == nil || *f.ms == 0 {
+		return ""
+	}
+	return (time.Duration(*f.ms) * time.Millisecond).String()
+}
+
+func (f msFlag) Set(s string) error {
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*f.ms = d.Milliseconds()
+	return nil
+}
+
+// transports are shared between requests with the same timeouts so their
+// connections are reused
+var transports sync.Map // transportKey -> *http.Transport
+
+// transportKey tells transports apart by what their connections are set
+// up with
+type transportKey struct {
+	timeouts requestTimeouts
+	insecure bool
+}
+
+func transportFor(t requestTimeouts) *http.Transport {
+	t.TotalMs = 0
+	key := transportKey{t, insecureTLS.Load()}
+	if tr, ok := transports.Load(key); ok {
+		return tr.(*http.Transport)
+	}
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	tr.DialContext = t.dialer().DialContext
+	tr.TLSClientConfig = tlsConfig()
+	tr.TLSClientConfig.InsecureSkipVerify = key.insecure
+	tr.Proxy = requestProxy
+	if outboundPolicy != nil {
+		// A proxy would connect on our behalf, out of the policy's reach
+		tr.Proxy = nil
+	}
+	tr.TLSHandshakeTimeout = t.tls()
+	tr.ResponseHeaderTimeout = t.responseHeader()
+	actual, _ := transports.LoadOrStore(key, tr)
+	return actual.(*http.Transport)
+}
+
+// dialer connects within the connect timeout, resolving hosts with
+// -resolver and refusing the addresses the outbound policy forbids when
+// there is one
+func (t requestTimeouts) dialer() *net.Dialer {
+	d := &net.Dialer{Timeout: t.connect(), KeepAlive: 30 * time.Second, Resolver: customResolver}
+	if outboundPolicy != nil {
+		d.Control = outboundPolicy.dialControl
+	}
+	return d
+}
+
+// describeTimeout names the phase that timed out, which the errors of
+// net/http leave for the reader to work out
+func describeTimeout(err error, t requestTimeouts) error {
+	var opErr *net.OpError
+	switch {
+	case err == nil:
+		return nil
+	case errors.As(err, &opErr) && opErr.Op == "dial" && opErr.Timeout():
+		return fmt.Errorf("connect timeout: no connection within %s: %w", t.connect(), err)
+	case strings.Contains(err.Error(), "TLS handshake timeout"):
+		return fmt.Errorf("TLS timeout: handshake not done within %s: %w", t.tls(), err)
+	case strings.Contains(err.Error(), "timeout awaiting response headers"):
+		return fmt.Errorf("response header timeout: connected, but no response headers within %s: %w", t.responseHeader(), err)
+	}
+	return err
+}
+
+// errTotalTimeout is a request running out of its total timeout
+type errTotalTimeout time.Duration
+
+func (e errTotalTimeout) Error() string {
+	return fmt.Sprintf("total timeout: the request didn't complete within %s", time.Duration(e))
+}
+
+// errIdleTimeout ends a body read that went quiet for too long
+type errIdleTimeout time.Duration
+
+func (e errIdleTimeout) Error() string {
+	return fmt.Sprintf("idle timeout: no body data for %s", time.Duration(e))
+}
+
+// idleReader fails once the body it reads goes without data for longer
+// than the idle timeout, by closing it from a timer
+type idleReader struct {
+	body  io.ReadCloser
+	limit time.Duration
+	timer *time.Timer
+	fired atomic.Bool
+}
+
+// withIdleTimeout limits the pauses while body is read; limit 0 leaves it
+// alone
+func withIdleTimeout(body io.ReadCloser, limit time.Duration) io.ReadCloser {
+	if limit <= 0 {
+		return body
+	}
+	r := &idleReader{body: body, limit: limit}
+	r.timer = time.AfterFunc(limit, func() {
+		r.fired.Store(true)
+		body.Close()
+	})
+	return r
+}
+
+func (r *idleReader) Read(p []byte) (int, error) {
+	n, err := r.body.Read(p)
+	if r.fired.Load() {
+		return n, errIdleTimeout(r.limit)
+	}
+	if err == nil {
+		r.timer.Reset(r.limit)
+	} else {
+		r.timer.Stop()
+	}
+	return n, err
+}
+
+func (r *idleReader) Close() error {
+	r.timer.Stop()
+	return r.body.Close()
+}
@@ -0,0 +1,374 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// requestTiming records the phases of a request through httptrace. Dial
+// attempts are kept individually: when a host has both IPv6 and IPv4
+// addresses the dialer races them (Happy Eyeballs, RFC 8305) and the
+// attempts show which family won and how long the others took.
+type requestTiming struct {
+	mu sync.Mutex
+
+	start, end        time.Time
+	dnsStart, dnsDone time.Time
+	addrs             []string
+	dnsErr            error
+	dials             []dialAttempt
+	tlsStart, tlsDone time.Time
+	tlsErr            error
+	tlsState          tls.ConnectionState // what the handshake negotiated
+	reused            bool
+	remote            string // address of the connection used
+	wrote, firstByte  time.Time
+	throttled         time.Duration // held back by the host's rate limit
+
+	// certs is the certificate chain the server presented, leaf first,
+	// also when it didn't verify; verified is set when it did. serverName
+	// is the host it was presented for, to look up its pins, and pinnable
+	// are the certificates a pin may match.
+	certs      []*x509.Certificate
+	verified   bool
+	serverName string
+	pinnable   []*x509.Certificate
+
+	// The HTTP version forced, "" when negotiated, and the protocol the
+	// response came in, with what TLS negotiated through ALPN
+	version string
+	proto   string
+	alpn    string
+
+	// http3 describes the HTTP/3 endpoints the response advertised
+	http3 string
+
+	// unverified is set when the response came over TLS without the
+	// server's certificate being verified, see -insecure
+	unverified bool
+
+	// resolve is the address a connect override dialed instead of the
+	// host's, "" for none
+	resolve string
+
+	// proxy is the proxy the request went through, "" for none
+	proxy string
+}
+
+type dialAttempt struct {
+	addr        string
+	start, done time.Time
+	err         error
+}
+
+func newRequestTiming() *requestTiming {
+	return &requestTiming{start: time.Now()}
+}
+
+// trace returns the hooks filling t. Dials race on separate goroutines,
+// hence the lock.
+func (t *requestTiming) trace() *httptrace.ClientTrace {
+	lock := func() func() {
+		t.mu.Lock()
+		return t.mu.Unlock
+	}
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			defer lock()()
+			t.dnsStart = time.Now()
+		},
+		DNSDone: func(info httptrace.DNSDoneInfo) {
+			defer lock()()
+			t.dnsDone = time.Now()
+			t.dnsErr = info.Err
+			for _, a := range info.Addrs {
+				t.addrs = append(t.addrs, a.String())
+			}
+		},
+		ConnectStart: func(network, addr string) {
+			defer lock()()
+			t.dials = append(t.dials, dialAttempt{addr: addr, start: time.Now()})
+		},
+		ConnectDone: func(network, addr string, err error) {
+			defer lock()()
+			for i := range t.dials {
+				if t.dials[i].addr == addr && t.dials[i].done.IsZero() {
+					t.dials[i].done, t.dials[i].err = time.Now(), err
+					break
+				}
+			}
+		},
+		TLSHandshakeStart: func() {
+			defer lock()()
+			t.tlsStart = time.Now()
+		},
+		TLSHandshakeDone: func(state tls.ConnectionState, err error) {
+			defer lock()()
+			t.tlsDone, t.tlsErr, t.tlsState = time.Now(), err, state
+			t.certs, t.verified, t.serverName = state.PeerCertificates, len(state.VerifiedChains) > 0, state.ServerName
+			t.pinnable = pinnableCertificates(state)
+			var certErr *tls.CertificateVerificationError
+			if errors.As(err, &certErr) {
+				t.certs = certErr.UnverifiedCertificates
+			}
+			var pinErr *pinMismatchError
+			if errors.As(err, &pinErr) {
+				t.certs, t.serverName, t.pinnable = pinErr.presented, pinErr.host, nil
+			}
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			defer lock()()
+			t.reused = info.Reused
+			if info.Conn != nil {
+				t.remote = info.Conn.RemoteAddr().String()
+			}
+		},
+		WroteRequest: func(httptrace.WroteRequestInfo) {
+			defer lock()()
+			t.wrote = time.Now()
+		},
+		GotFirstResponseByte: func() {
+			defer lock()()
+			t.firstByte = time.Now()
+		},
+	}
+}
+
+// gotResponse records the protocol of the response
+func (t *requestTiming) gotResponse(resp *http.Response) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.proto = resp.Proto
+	if resp.TLS != nil {
+		t.alpn = resp.TLS.NegotiatedProtocol
+		t.unverified = insecureTLS.Load()
+		// Reused connections had no handshake to record the chain
+		if t.certs == nil {
+			t.certs, t.verified, t.serverName = resp.TLS.PeerCertificates, len(resp.TLS.VerifiedChains) > 0, resp.TLS.ServerName
+			t.pinnable = pinnableCertificates(*resp.TLS)
+		}
+	}
+	t.http3 = http3Offer(resp.Header)
+}
+
+// addThrottled records time the request waited for its rate limit
+func (t *requestTiming) addThrottled(d time.Duration) {
+	t.mu.Lock()
+	t.throttled += d
+	t.mu.Unlock()
+}
+
+// finish marks the end of the request, once the body is read or it failed
+func (t *requestTiming) finish() {
+	t.mu.Lock()
+	t.end = time.Now()
+	t.mu.Unlock()
+}
+
+// addressFamily tells IPv4 from IPv6 by a host:port or bare address, and
+// Unix domain sockets by their path
+func addressFamily(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+		if net.ParseIP(addr) == nil {
+			return "Unix"
+		}
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.To4() == nil {
+		return "IPv6"
+	}
+	return "IPv4"
+}
+
+var (
+	timingWinStyle  = lipgloss.NewStyle().Foreground(lipgloss.Color("#98C379"))
+	timingLoseStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("#888888"))
+	timingWarnStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("#FFCC00"))
+)
+
+// renderTiming draws the timing view, toggled with Ctrl+K
+func renderTiming(t *requestTiming) string {
+	if t == nil {
+		return "No request sent yet."
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	since := func(at time.Time) string {
+		return "+" + formatDuration(at.Sub(t.start))
+	}
+	var sb strings.Builder
+	row := func(label, value string) {
+		fmt.Fprintf(&sb, "%s %s\n", headerStyle.Render(fmt.Sprintf("%-15s", label)), value)
+	}
+	sb.WriteString(headerStyle.Render("Timing"))
+	sb.WriteString("\n\n")
+
+	if t.throttled > 0 {
+		row("Rate limited", timingWarnStyle.Render("waited "+formatDuration(t.throttled)))
+	}
+
+	if t.proxy != "" {
+		row("Proxy", t.proxy+timingLoseStyle.Render(" (the lookup and connection below are the proxy's)"))
+	}
+	if socket, ok := strings.CutPrefix(t.resolve, unixSocketTarget); ok {
+		row("Connect to", socket+timingLoseStyle.Render(" (Unix domain socket)"))
+	} else if t.resolve != "" {
+		row("Connect to", t.resolve+timingLoseStyle.Render(" (resolve override, the host isn't looked up)"))
+	}
+	switch {
+	case !t.dnsDone.IsZero() && t.dnsErr != nil:
+		row("DNS lookup", errorStyle.Render(describeResolverError(t.dnsErr).Error()))
+	case !t.dnsDone.IsZero():
+		via := ""
+		if customResolver != nil {
+			via = timingLoseStyle.Render(" (" + resolverName + ")")
+		}
+		row("DNS lookup", fmt.Sprintf("%s → %s%s", formatDuration(t.dnsDone.Sub(t.dnsStart)), strings.Join(t.addrs, ", "), via))
+	case len(t.dials) > 0 && t.resolve == "":
+		row("DNS lookup", timingLoseStyle.Render("none, the host is an address"))
+	}
+
+	if t.reused {
+		row("Connect", timingLoseStyle.Render("reused connection to "+t.remote))
+	} else if len(t.dials) > 0 {
+		families := map[string]bool{}
+		for _, d := range t.dials {
+			families[addressFamily(d.addr)] = true
+		}
+		note := ""
+		if len(families) > 1 {
+			note = " (IPv6 and IPv4 raced)"
+		} else if len(t.dials) > 1 {
+			note = " (addresses tried in turn)"
+		}
+		row("Connect", fmt.Sprintf("%d attempt(s)%s", len(t.dials), note))
+		for _, d := range t.dials {
+			took := "still running"
+			if !d.done.IsZero() {
+				took = formatDuration(d.done.Sub(d.start))
+			}
+			line := fmt.Sprintf(" %-4s %-42s started %-8s took %s", addressFamily(d.addr), d.addr, since(d.start), took)
+			switch {
+			case d.err == nil && !d.done.IsZero() && d.addr == t.remote:
+				sb.WriteString(timingWinStyle.Render("  ✓" + line + "  won"))
+			case d.err == nil:
+				sb.WriteString(timingLoseStyle.Render("  ·" + line + "  connected, not used"))
+			case isCancelledDial(d.err):
+				sb.WriteString(timingLoseStyle.Render("  ✗" + line + "  cancelled, another attempt won"))
+			default:
+				sb.WriteString(errorStyle.Render("  ✗" + line + "  " + d.err.Error()))
+			}
+			sb.WriteString("\n")
+		}
+		if hint := happyEyeballsHint(t); hint != "" {
+			sb.WriteString(timingWarnStyle.Render("  " + hint))
+			sb.WriteString("\n")
+		}
+	}
+
+	if !t.tlsStart.IsZero() {
+		if t.tlsErr != nil {
+			row("TLS handshake", errorStyle.Render(t.tlsErr.Error()))
+		} else if !t.tlsDone.IsZero() {
+			row("TLS handshake", formatDuration(t.tlsDone.Sub(t.tlsStart)))
+			row("TLS", fmt.Sprintf("%s, %s", tls.VersionName(t.tlsState.Version), tls.CipherSuiteName(t.tlsState.CipherSuite)))
+		}
+	}
+	if restricted := describeTLSRestrictions(); restricted != "" && !t.tlsStart.IsZero() {
+		row("TLS offered", timingLoseStyle.Render(restricted))
+	}
+	if t.unverified {
+		row("Certificate", insecureBadgeStyle.Render("NOT VERIFIED")+timingLoseStyle.Render(" (-insecure or Alt+I)"))
+	}
+	if t.proto != "" {
+		row("Protocol", describeProtocol(t))
+	} else if t.version != "" {
+		row("Protocol", describeHTTPVersion(t.version))
+	}
+	if t.http3 != "" && t.proto != "HTTP/3.0" {
+		row("HTTP/3", "offered through Alt-Svc, "+t.http3+timingLoseStyle.Render(" (not used, force it with -http-version 3)"))
+	}
+	if !t.wrote.IsZero() {
+		row("Request sent", since(t.wrote))
+	}
+	if !t.firstByte.IsZero() {
+		value := since(t.firstByte)
+		if !t.wrote.IsZero() {
+			value += fmt.Sprintf(" (server %s)", formatDuration(t.firstByte.Sub(t.wrote)))
+		}
+		row("First byte", value)
+	}
+	if !t.end.IsZero() {
+		row("Total", formatDuration(t.end.Sub(t.start)))
+	}
+	return sb.String()
+}
+
+// describeProtocol is the protocol a response came in and how it was
+// chosen
+func describeProtocol(t *requestTiming) string {
+	var how []string
+	switch {
+	case t.alpn != "":
+		how = append(how, "ALPN "+t.alpn)
+	case t.proto == "HTTP/2.0":
+		how = append(how, "prior knowledge, h2c")
+	case t.version == "":
+		how = append(how, "no TLS to negotiate HTTP/2 over")
+	}
+	if t.version != "" {
+		how = append(how, "forced")
+	}
+	return t.proto + timingLoseStyle.Render(" ("+strings.Join(how, ", ")+")")
+}
+
+// isCancelledDial reports whether a dial attempt was abandoned because
+// another one connected first
+func isCancelledDial(err error) bool {
+	return errors.Is(err, context.Canceled) || strings.Contains(err.Error(), "operation was canceled")
+}
+
+// happyEyeballsHint points out a family that failed on its own, typically
+// a broken IPv6 path that only works thanks to the IPv4 fallback
+func happyEyeballsHint(t *requestTiming) string {
+	failed := map[string]bool{}
+	won := ""
+	for _, d := range t.dials {
+		switch {
+		case d.err == nil && d.addr == t.remote:
+			won = addressFamily(d.addr)
+		case d.err != nil && !isCancelledDial(d.err):
+			failed[addressFamily(d.addr)] = true
+		}
+	}
+	for _, family := range []string{"IPv6", "IPv4"} {
+		if failed[family] && won != "" && won != family {
+			return fmt.Sprintf("%s attempts failed and %s took over: the %s path to this host looks broken", family, won, family)
+		}
+	}
+	return ""
+}
+
+// formatDuration rounds durations for display
+func formatDuration(d time.Duration) string {
+	switch {
+	case d < time.Millisecond:
+		return d.Round(time.Microsecond).String()
+	case d < time.Second:
+		return d.Round(100 * time.Microsecond).String()
+	}
+	return d.Round(time.Millisecond).String()
+}
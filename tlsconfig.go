@@ -0,0 +1,242 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// insecureUsage is the help of -insecure
+const insecureUsage = "skip the verification of server certificates, for self-signed development servers; Alt+I toggles it in the TUI"
+
+// cacertUsage is the help of -cacert
+const cacertUsage = "trust the certificate authorities of a PEM `file` besides the system's (repeatable)"
+
+// tlsMinUsage, tlsMaxUsage and ciphersUsage are the help of -tls-min,
+// -tls-max and -ciphers
+const (
+	tlsMinUsage  = "the oldest TLS `version` to offer: 1.0, 1.1, 1.2 or 1.3 (default 1.2)"
+	tlsMaxUsage  = "the newest TLS `version` to offer: 1.0, 1.1, 1.2 or 1.3 (default 1.3)"
+	ciphersUsage = "the comma-separated cipher `suites` to offer up to TLS 1.2, weak ones included, e.g. TLS_RSA_WITH_3DES_EDE_CBC_SHA; TLS 1.3 suites can't be chosen, so this caps the version at 1.2 unless -tls-max is given"
+)
+
+// insecureTLS skips the verification of server certificates, set with
+// -insecure and toggled with Alt+I. Transports are kept per setting, so
+// connections verified before are never reused unverified or the
+// other way round.
+var insecureTLS atomic.Bool
+
+// extraCAs are the certificate authorities trusted besides those of the
+// system, added with -cacert from caFiles; nil for the system's alone
+var (
+	extraCAs *x509.CertPool
+	caFiles  []string
+)
+
+// tlsMinVersion, tlsMaxVersion and cipherSuites narrow down what TLS
+// connections offer, as set with -tls-min, -tls-max and -ciphers, to
+// check that a server refuses old versions or weak ciphers. Zero values
+// and nil leave Go's defaults.
+var (
+	tlsMinVersion, tlsMaxVersion uint16
+	cipherSuites                 []uint16
+)
+
+// tlsVersions are the TLS versions -tls-min and -tls-max take
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+var insecureBadgeStyle = lipgloss.NewStyle().
+	Bold(true).
+	Foreground(lipgloss.Color("#FFFFFF")).
+	Background(lipgloss.Color("#C0392B")).
+	Padding(0, 1)
+
+// parseInsecureFlag sets -insecure
+func parseInsecureFlag(s string) error {
+	v, err := strconv.ParseBool(s)
+	if err != nil {
+		return err
+	}
+	insecureTLS.Store(v)
+	return nil
+}
+
+// parseCACertFlag trusts the certificate authorities of a PEM file, as
+// -cacert gives them, on top of those of the system
+func parseCACertFlag(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if extraCAs == nil {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		extraCAs = pool
+	}
+	if !extraCAs.AppendCertsFromPEM(data) {
+		return fmt.Errorf("%s holds no PEM certificates", path)
+	}
+	caFiles = append(caFiles, path)
+	return nil
+}
+
+// parseTLSVersion reads a version given to -tls-min or -tls-max
+func parseTLSVersion(s string) (uint16, error) {
+	v, ok := tlsVersions[strings.TrimPrefix(strings.TrimPrefix(strings.ToLower(s), "tls"), "v")]
+	if !ok {
+		return 0, fmt.Errorf("unknown TLS version %q, want 1.0, 1.1, 1.2 or 1.3", s)
+	}
+	return v, nil
+}
+
+// parseTLSMinFlag sets -tls-min
+func parseTLSMinFlag(s string) (err error) {
+	tlsMinVersion, err = parseTLSVersion(s)
+	return err
+}
+
+// parseTLSMaxFlag sets -tls-max
+func parseTLSMaxFlag(s string) (err error) {
+	tlsMaxVersion, err = parseTLSVersion(s)
+	return err
+}
+
+// parseCiphersFlag sets -ciphers from the IANA names of cipher suites,
+// as Go and the timing view name them
+func parseCiphersFlag(s string) error {
+	known := map[string]*tls.CipherSuite{}
+	for _, c := range append(tls.CipherSuites(), tls.InsecureCipherSuites()...) {
+		known[c.Name] = c
+	}
+	cipherSuites = nil
+	for _, name := range strings.Split(s, ",") {
+		name = strings.ToUpper(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		c, ok := known[name]
+		if !ok {
+			return fmt.Errorf("unknown cipher suite %s", name)
+		}
+		if slices.Equal(c.SupportedVersions, []uint16{tls.VersionTLS13}) {
+			return fmt.Errorf("%s is a TLS 1.3 suite, which can't be chosen", name)
+		}
+		cipherSuites = append(cipherSuites, c.ID)
+	}
+	if len(cipherSuites) == 0 {
+		return errors.New("no cipher suites given")
+	}
+	return nil
+}
+
+// tlsConfig is the TLS configuration of connections to servers
+func tlsConfig() *tls.Config {
+	return withTLSSettings(&tls.Config{})
+}
+
+// withTLSSettings applies -insecure, -cacert, -tls-min, -tls-max,
+// -ciphers and the pins to the configuration of a connection, for dialers
+// that build their own
+func withTLSSettings(cfg *tls.Config) *tls.Config {
+	cfg = cfg.Clone()
+	cfg.RootCAs, cfg.InsecureSkipVerify = extraCAs, insecureTLS.Load()
+	cfg.VerifyConnection = verifyPins
+	cfg.MinVersion, cfg.MaxVersion = tlsMinVersion, tlsMaxVersion
+	// Go offers 1.2 and newer unless told otherwise
+	if cfg.MinVersion == 0 && cfg.MaxVersion != 0 && cfg.MaxVersion < tls.VersionTLS12 {
+		cfg.MinVersion = tls.VersionTLS10
+	}
+	if cipherSuites != nil {
+		cfg.CipherSuites = cipherSuites
+		// TLS 1.3 would pick its own suites and skip the ones asked for
+		if cfg.MaxVersion == 0 {
+			cfg.MaxVersion = tls.VersionTLS12
+		}
+	}
+	return cfg
+}
+
+// tlsRestricted tells whether -tls-min, -tls-max or -ciphers narrowed down
+// what connections offer
+func tlsRestricted() bool {
+	return tlsMinVersion != 0 || tlsMaxVersion != 0 || cipherSuites != nil
+}
+
+// describeTLSRestrictions lists what -tls-min, -tls-max and -ciphers
+// offer, "" when they're not given
+func describeTLSRestrictions() string {
+	var parts []string
+	cfg := tlsConfig()
+	switch {
+	case cfg.MinVersion != 0 && cfg.MinVersion == cfg.MaxVersion:
+		parts = append(parts, "only "+tls.VersionName(cfg.MinVersion))
+	case cfg.MinVersion != 0 && cfg.MaxVersion != 0:
+		parts = append(parts, tls.VersionName(cfg.MinVersion)+" to "+tls.VersionName(cfg.MaxVersion))
+	case cfg.MinVersion != 0:
+		parts = append(parts, tls.VersionName(cfg.MinVersion)+" or newer")
+	case cfg.MaxVersion != 0:
+		parts = append(parts, tls.VersionName(cfg.MaxVersion)+" or older")
+	}
+	if len(cipherSuites) > 0 {
+		names := make([]string, len(cipherSuites))
+		for i, id := range cipherSuites {
+			names[i] = tls.CipherSuiteName(id)
+		}
+		parts = append(parts, "ciphers "+strings.Join(names, ", "))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// toggleInsecure turns the verification of server certificates off or
+// back on for the following requests
+func (m model) toggleInsecure() model {
+	insecureTLS.Store(!insecureTLS.Load())
+	if insecureTLS.Load() {
+		m.notice = errorStyle.Render("⚠ Server certificates are no longer verified: anyone in between can read and change requests • Alt+I: Verify again")
+	} else {
+		m.notice = "Server certificates are verified again"
+	}
+	return m
+}
+
+// describeCertificateError adds what to do about certificates that don't
+// verify, like those of self-signed development servers
+func describeCertificateError(err error) error {
+	var certErr *tls.CertificateVerificationError
+	if !errors.As(err, &certErr) {
+		return err
+	}
+	var unknown x509.UnknownAuthorityError
+	if errors.As(err, &unknown) {
+		return fmt.Errorf("%w (trust its CA with -cacert, or skip verification with -insecure, Alt+I in the TUI)", err)
+	}
+	return fmt.Errorf("%w (-insecure, Alt+I in the TUI, skips verification)", err)
+}
+
+// describeHandshakeError says what was offered when a server refuses the
+// handshake after -tls-min, -tls-max or -ciphers narrowed it down, which
+// is what checking that weak settings are refused looks like
+func describeHandshakeError(err error) error {
+	// Alerts from the server come as a "remote error"
+	var opErr *net.OpError
+	if !tlsRestricted() || !errors.As(err, &opErr) || opErr.Op != "remote error" {
+		return err
+	}
+	return fmt.Errorf("%w (offered %s)", err, describeTLSRestrictions())
+}
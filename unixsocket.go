@@ -0,0 +1,49 @@
+package main
+
+import (
+	"errors"
+	"strings"
+)
+
+// unixSocketScheme starts the URLs of requests sent over a Unix domain
+// socket, the socket path followed by the request path after a colon:
+// unix:///var/run/docker.sock:/v1.41/containers/json
+const unixSocketScheme = "unix://"
+
+// unixSocketHost is the host of requests over a socket, for the Host
+// header, as curl --unix-socket sends it
+const unixSocketHost = "localhost"
+
+// unixSocketTarget marks connectOverrides targets that are a socket path
+const unixSocketTarget = "unix:"
+
+// parseUnixSocketURL splits a unix:// URL into its socket and the http://
+// URL of the request sent over it; ok is false for other URLs
+func parseUnixSocketURL(raw string) (socket, target string, ok bool) {
+	rest, ok := strings.CutPrefix(raw, unixSocketScheme)
+	if !ok {
+		return "", "", false
+	}
+	socket, path, _ := strings.Cut(rest, ":")
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return socket, "http://" + unixSocketHost + path, true
+}
+
+// unixSocketRequest turns a unix:// URL into the http:// one sent, with
+// the connections to its host going to the socket; other URLs are left
+// as they are
+func unixSocketRequest(raw string, resolve connectOverrides) (string, connectOverrides, error) {
+	socket, target, ok := parseUnixSocketURL(raw)
+	switch {
+	case !ok:
+		return raw, resolve, nil
+	case socket == "":
+		return "", nil, errors.New("a unix:// URL names its socket, then the path after a colon: unix:///var/run/docker.sock:/v1.41/containers/json")
+	case outboundPolicy != nil:
+		// The policy vets addresses, a local daemon would be out of its reach
+		return "", nil, errors.New("egress policy does not allow Unix domain sockets")
+	}
+	return target, resolve.merge(map[string]string{unixSocketHost + ":80": unixSocketTarget + socket}), nil
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// parseRequestLine splits the input line into an optional method, the URL
+// and an optional @file whose contents are sent as the body, e.g.
+// "PUT example.com/upload @backup.tar.gz"
+func parseRequestLine(line string) (method, url, bodyFile string) {
+	fields := strings.Fields(line)
+	if len(fields) > 1 && isMethodToken(fields[0]) {
+		method, fields = fields[0], fields[1:]
+	}
+	if len(fields) > 1 && strings.HasPrefix(fields[len(fields)-1], "@") {
+		bodyFile, fields = fields[len(fields)-1][1:], fields[:len(fields)-1]
+	}
+	url = strings.Join(fields, " ")
+	if method == "" {
+		method = "GET"
+		if bodyFile != "" {
+			method = "POST"
+		}
+	}
+	return method, url, bodyFile
+}
+
+func isMethodToken(s string) bool {
+	for _, r := range s {
+		if r < 'A' || r > 'Z' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// uploadState tracks how much of a request body has been sent
+type uploadState struct {
+	sent    int64
+	total   int64
+	started time.Time
+}
+
+// uploadProgressMsg reports request body bytes handed to the connection
+type uploadProgressMsg struct {
+	stream  <-chan tea.Msg
+	sent    int64
+	total   int64
+	started time.Time
+}
+
+// uploadReader counts the body bytes the transport reads and reports them
+// to the UI, throttled to progressInterval. Reports stop once ctx is done:
+// the transport may still be reading after the UI has the response.
+type uploadReader struct {
+	ctx      context.Context
+	r        io.Reader
+	n        int64
+	total    int64
+	started  time.Time
+	lastSent time.Time
+	stream   chan tea.Msg
+}
+
+func (u *uploadReader) Read(p []byte) (int, error) {
+	n, err := u.r.Read(p)
+	u.n += int64(n)
+	if err != nil || time.Since(u.lastSent) >= progressInterval {
+		select {
+		case u.stream <- uploadProgressMsg{stream: u.stream, sent: u.n, total: u.total, started: u.started}:
+		case <-u.ctx.Done():
+		}
+		u.lastSent = time.Now()
+	}
+	return n, err
+}
+
+// openUploadBody opens a file to be sent as a request body and guesses its
+// content type from the extension
+func openUploadBody(path string) (*os.File, int64, string, error) {
+	if strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			path = filepath.Join(home, path[2:])
+		}
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, 0, "", err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, 0, "", err
+	}
+	if info.IsDir() {
+		file.Close()
+		return nil, 0, "", fmt.Errorf("%s is a directory", path)
+	}
+	contentType := mime.TypeByExtension(filepath.Ext(path))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	return file, info.Size(), contentType, nil
+}
+
+// renderUpload is the status bar segment of an in-flight upload
+func renderUpload(u *uploadState) string {
+	progress := formatBytes(u.sent)
+	if u.total > 0 {
+		progress += fmt.Sprintf(" of %s (%d%%)", formatBytes(u.total), u.sent*100/u.total)
+	}
+	rate := bytesPerSecond(u.sent, time.Since(u.started))
+	return fmt.Sprintf("Uploading %s • %s/s", progress, formatBytes(int64(rate)))
+}
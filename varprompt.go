@@ -0,0 +1,111 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// varPrompt asks for the values of undefined variables before a request
+// is sent, one variable at a time
+type varPrompt struct {
+	names []string // variables still without a value, current first
+	input textinput.Model
+
+	// retry sends the blocked request again once all values are set
+	retry func(model) (model, tea.Cmd)
+}
+
+// checkUnresolved blocks a request whose templates didn't fully resolve.
+// Undefined variables can be supplied through a prompt; anything else
+// (a failed extraction, an unset environment variable, a secret that
+// can't be read) is an error.
+func (m model) checkUnresolved(missing []unresolved, retry func(model) (model, tea.Cmd)) (model, bool) {
+	if len(missing) == 0 {
+		return m, false
+	}
+
+	var names, problems []string
+	seen := map[string]bool{}
+	for _, u := range missing {
+		if !errors.Is(u.err, errUndefinedVariable) {
+			problems = append(problems, fmt.Sprintf("{{%s}}: %v", u.name, u.err))
+		} else if !seen[u.name] {
+			seen[u.name] = true
+			names = append(names, u.name)
+		}
+	}
+	if len(problems) > 0 {
+		m.err = fmt.Errorf("request not sent, unresolved placeholders:\n  %s", strings.Join(problems, "\n  "))
+		m.response = ""
+		return m, true
+	}
+
+	m.err = nil
+	m.varPrompt = &varPrompt{names: names, input: newVarInput(names[0]), retry: retry}
+	m.textInput.Blur()
+	return m, true
+}
+
+func newVarInput(name string) textinput.Model {
+	input := textinput.New()
+	input.Prompt = name + " = "
+	input.Focus()
+	if secretNamePattern.MatchString(name) {
+		input.EchoMode = textinput.EchoPassword
+	}
+	return input
+}
+
+// updateVarPrompt handles keys while the variable prompt is open. The
+// values are kept for the rest of the session.
+func (m model) updateVarPrompt(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	p := m.varPrompt
+	switch msg.Type {
+	case tea.KeyCtrlC:
+		return m, tea.Quit
+	case tea.KeyEsc:
+		m.varPrompt = nil
+		m.textInput.Focus()
+		return m, nil
+	case tea.KeyEnter:
+		templateVars[p.names[0]] = p.input.Value()
+		if len(p.names) > 1 {
+			m.varPrompt = &varPrompt{names: p.names[1:], input: newVarInput(p.names[1]), retry: p.retry}
+			return m, nil
+		}
+		m.varPrompt = nil
+		m.textInput.Focus()
+		return p.retry(m)
+	}
+
+	var cmd tea.Cmd
+	next := *p
+	next.input, cmd = p.input.Update(msg)
+	m.varPrompt = &next
+	return m, cmd
+}
+
+// renderVarPrompt draws the prompt for the next undefined variable
+func renderVarPrompt(p *varPrompt) string {
+	var sb strings.Builder
+	sb.WriteString(errorStyle.Render(fmt.Sprintf("Request not sent: {{%s}} is not defined", p.names[0])))
+	sb.WriteString("\n\n")
+	if len(p.names) > 1 {
+		sb.WriteString(lipgloss.NewStyle().Foreground(lipgloss.Color("#888888")).
+			Render(fmt.Sprintf("Also undefined: %s", strings.Join(p.names[1:], ", "))))
+		sb.WriteString("\n\n")
+	}
+	sb.WriteString(inputStyle.Render(p.input.View()))
+	sb.WriteString("\n")
+	sb.WriteString(lipgloss.NewStyle().Foreground(lipgloss.Color("#888888")).
+		Render("\nEnter: Set for this session and send • Esc: Cancel"))
+	sb.WriteString("\n")
+	sb.WriteString(lipgloss.NewStyle().Foreground(lipgloss.Color("#888888")).
+		Render(environmentHint()))
+	return sb.String()
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// vaultProvider reads secrets from HashiCorp Vault over its HTTP API.
+// References are a secret's API path and the field to take from it, e.g.
+// "kv/data/api#token" for the token field of KV v2 secret api in mount kv.
+// The field may be left out for secrets with a single one.
+//
+// The server and token come from VAULT_ADDR and VAULT_TOKEN (or the token
+// helper's ~/.vault-token), with VAULT_NAMESPACE for Vault Enterprise, as
+// for the vault command.
+type vaultProvider struct{}
+
+// vaultTimeout bounds a secret read, which holds up sending the request
+const vaultTimeout = 10 * time.Second
+
+func (vaultProvider) readSecret(ref string) (string, error) {
+	path, field, _ := strings.Cut(ref, "#")
+	path = strings.Trim(path, "/")
+
+	addr := strings.TrimSuffix(os.Getenv("VAULT_ADDR"), "/")
+	if addr == "" {
+		return "", fmt.Errorf("vault: VAULT_ADDR is not set")
+	}
+	token, err := vaultToken()
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequest("GET", addr+"/v1/"+path, nil)
+	if err != nil {
+		return "", fmt.Errorf("vault: %w", err)
+	}
+	req.Header.Set("X-Vault-Token", token)
+	if ns := os.Getenv("VAULT_NAMESPACE"); ns != "" {
+		req.Header.Set("X-Vault-Namespace", ns)
+	}
+	resp, err := (&http.Client{Timeout: vaultTimeout}).Do(req)
+	if err != nil {
+		return "", fmt.Errorf("vault: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var secret struct {
+		Data   map[string]interface{} `json:"data"`
+		Errors []string               `json:"errors"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&secret); err != nil && resp.StatusCode == http.StatusOK {
+		return "", fmt.Errorf("vault: reading %s: %w", path, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		msg := resp.Status
+		if len(secret.Errors) > 0 {
+			msg += ": " + strings.Join(secret.Errors, "; ")
+		}
+		return "", fmt.Errorf("vault: reading %s: %s", path, msg)
+	}
+
+	// KV v2 wraps the fields with metadata in another data object
+	fields := secret.Data
+	if inner, ok := fields["data"].(map[string]interface{}); ok {
+		if _, hasMeta := fields["metadata"]; hasMeta {
+			fields = inner
+		}
+	}
+	if field == "" {
+		if len(fields) != 1 {
+			return "", fmt.Errorf("vault: %s has fields %s, name one with #field", path, strings.Join(vaultFieldNames(fields), ", "))
+		}
+		for name := range fields {
+			field = name
+		}
+	}
+	value, ok := fields[field]
+	if !ok {
+		return "", fmt.Errorf("vault: %s has no field %q (has %s)", path, field, strings.Join(vaultFieldNames(fields), ", "))
+	}
+	if s, ok := value.(string); ok {
+		return s, nil
+	}
+	out, _ := json.Marshal(value)
+	return string(out), nil
+}
+
+// vaultToken finds the token the vault command would use
+func vaultToken() (string, error) {
+	if token := os.Getenv("VAULT_TOKEN"); token != "" {
+		return token, nil
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		if data, err := os.ReadFile(filepath.Join(home, ".vault-token")); err == nil {
+			return strings.TrimSpace(string(data)), nil
+		}
+	}
+	return "", fmt.Errorf("vault: no token, set VAULT_TOKEN or run vault login")
+}
+
+func vaultFieldNames(fields map[string]interface{}) []string {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
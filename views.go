@@ -0,0 +1,235 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// viewsDir holds the custom response views of the workspace, one Go
+// template per file named <view>.tmpl. A saved request lists the views
+// that apply to its responses, shown as extra tabs next to the response.
+const viewsDir = "views"
+
+// viewExt is the file extension of view templates
+const viewExt = ".tmpl"
+
+var (
+	viewTabStyle         = lipgloss.NewStyle().Foreground(lipgloss.Color("#888888")).Padding(0, 1)
+	viewSelectedTabStyle = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("#FFFFFF")).Background(lipgloss.Color("#7D56F4")).Padding(0, 1)
+	geoPointStyle        = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("#E06C75"))
+)
+
+// renderViewTabs draws the tab bar above a response with custom views,
+// the response itself being the first tab
+func renderViewTabs(views []string, selected int) string {
+	tabs := make([]string, 0, len(views)+1)
+	for i, name := range append([]string{"Response"}, views...) {
+		if i == selected {
+			tabs = append(tabs, viewSelectedTabStyle.Render(name))
+		} else {
+			tabs = append(tabs, viewTabStyle.Render(name))
+		}
+	}
+	return strings.Join(tabs, " ") + historyDimStyle.Render("  Shift+Tab: Next view") + "\n\n"
+}
+
+// renderCustomView renders a response through the named view, or
+// describes why it can't
+func renderCustomView(name string, resp fetchMsg) string {
+	path := filepath.Join(workspaceDir(), viewsDir, name+viewExt)
+	text, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return errorStyle.Render(fmt.Sprintf("View %q not found, expected its template in %s", name, path))
+	}
+	if err != nil {
+		return errorStyle.Render(err.Error())
+	}
+	tmpl, err := template.New(name).Funcs(viewFuncs).Option("missingkey=zero").Parse(string(text))
+	if err != nil {
+		return errorStyle.Render("View template error: " + err.Error())
+	}
+	var sb strings.Builder
+	if err := tmpl.Execute(&sb, viewData(resp)); err != nil {
+		return sb.String() + "\n" + errorStyle.Render("View error: "+err.Error())
+	}
+	return sb.String()
+}
+
+// viewData is what a view template sees as its dot: .status, .headers
+// (first value by canonical name), .body (decoded JSON, nil otherwise),
+// .text (the raw body), .url and .latency (in milliseconds)
+func viewData(resp fetchMsg) map[string]interface{} {
+	headers := map[string]string{}
+	for name, values := range resp.header {
+		if len(values) > 0 {
+			headers[name] = values[0]
+		}
+	}
+	var body interface{}
+	json.Unmarshal(resp.body, &body)
+	return map[string]interface{}{
+		"status":  resp.statusCode,
+		"headers": headers,
+		"body":    body,
+		"text":    string(resp.body),
+		"url":     resp.url,
+		"latency": responseLatency(resp),
+	}
+}
+
+// viewFuncs are the functions available to view templates besides the
+// text/template builtins
+var viewFuncs = template.FuncMap{
+	// get follows a dotted path, with numbers indexing arrays:
+	// {{get "data.items.0.name" .body}}
+	"get": func(path string, data interface{}) interface{} {
+		value, _ := walkJSON(data, strings.Split(path, "."))
+		return value
+	},
+	"json": func(v interface{}) string {
+		out, _ := json.Marshal(v)
+		return string(out)
+	},
+	"pretty": func(v interface{}) string {
+		out, _ := json.MarshalIndent(v, "", "  ")
+		return string(out)
+	},
+	"num":   viewNumber,
+	"bytes": func(v interface{}) string { return formatBytes(int64(viewNumber(v))) },
+	// pad left-aligns a value in width columns, right-aligns it when
+	// width is negative
+	"pad": func(width int, v interface{}) string {
+		if width < 0 {
+			return fmt.Sprintf("%*s", -width, fmt.Sprint(v))
+		}
+		return fmt.Sprintf("%-*s", width, fmt.Sprint(v))
+	},
+	"trunc": func(n int, v interface{}) string {
+		s := []rune(fmt.Sprint(v))
+		if len(s) <= n {
+			return string(s)
+		}
+		return string(s[:max(n-1, 0)]) + "…"
+	},
+	"bold": func(v interface{}) string { return lipgloss.NewStyle().Bold(true).Render(fmt.Sprint(v)) },
+	"dim":  func(v interface{}) string { return historyDimStyle.Render(fmt.Sprint(v)) },
+	"color": func(color string, v interface{}) string {
+		return lipgloss.NewStyle().Foreground(lipgloss.Color(color)).Render(fmt.Sprint(v))
+	},
+	// bar draws value as a share of total over width columns
+	"bar": func(value, total interface{}, width int) string {
+		v, t := viewNumber(value), viewNumber(total)
+		filled := 0
+		if t > 0 {
+			filled = int(math.Round(math.Max(0, math.Min(v/t, 1)) * float64(width)))
+		}
+		return strings.Repeat("█", filled) + historyDimStyle.Render(strings.Repeat("░", width-filled))
+	},
+	"point":  func(lat, lon interface{}) []geoPoint { return []geoPoint{{viewNumber(lat), viewNumber(lon)}} },
+	"points": viewPoints,
+	"geomap": renderGeoMap,
+}
+
+// viewNumber converts what JSON and templates hold into a number, 0 when
+// it isn't one
+func viewNumber(v interface{}) float64 {
+	switch v := v.(type) {
+	case float64:
+		return v
+	case int:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case string:
+		f, _ := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return f
+	}
+	return 0
+}
+
+// geoPoint is a latitude and longitude in degrees
+type geoPoint struct {
+	lat, lon float64
+}
+
+// viewPoints collects the coordinates of the objects of a list, read from
+// the named fields: {{geomap (points .body.stores "lat" "lng")}}
+func viewPoints(list interface{}, latPath, lonPath string) []geoPoint {
+	items, _ := list.([]interface{})
+	var out []geoPoint
+	for _, item := range items {
+		lat, okLat := walkJSON(item, strings.Split(latPath, "."))
+		lon, okLon := walkJSON(item, strings.Split(lonPath, "."))
+		if okLat && okLon {
+			out = append(out, geoPoint{viewNumber(lat), viewNumber(lon)})
+		}
+	}
+	return out
+}
+
+// Size of the map drawn by geomap, an equirectangular projection of 5°
+// per column and 10° per row
+const (
+	geoMapColumns = 72
+	geoMapRows    = 18
+)
+
+// renderGeoMap plots points on a latitude/longitude grid with the equator
+// and the prime meridian drawn in, followed by their coordinates
+func renderGeoMap(points []geoPoint) string {
+	var grid [geoMapRows][geoMapColumns]rune
+	for r := range grid {
+		for c := range grid[r] {
+			switch {
+			case r == geoMapRows/2 && c == geoMapColumns/2:
+				grid[r][c] = '┼'
+			case r == geoMapRows/2:
+				grid[r][c] = '─'
+			case c == geoMapColumns/2:
+				grid[r][c] = '│'
+			default:
+				grid[r][c] = '·'
+			}
+		}
+	}
+	plotted := map[[2]int]bool{}
+	for _, p := range points {
+		if p.lat < -90 || p.lat > 90 || p.lon < -180 || p.lon > 180 {
+			continue
+		}
+		r := min(int((90-p.lat)/180*geoMapRows), geoMapRows-1)
+		c := min(int((p.lon+180)/360*geoMapColumns), geoMapColumns-1)
+		plotted[[2]int{r, c}] = true
+	}
+
+	var sb strings.Builder
+	sb.WriteString(historyDimStyle.Render(" 90°N") + "\n")
+	for r, row := range grid {
+		for c, ch := range row {
+			if plotted[[2]int{r, c}] {
+				sb.WriteString(geoPointStyle.Render("●"))
+			} else {
+				sb.WriteString(historyDimStyle.Render(string(ch)))
+			}
+		}
+		sb.WriteString("\n")
+	}
+	sb.WriteString(historyDimStyle.Render(fmt.Sprintf(" 90°S%*s", geoMapColumns-5, "180°W … 180°E")))
+	for i, p := range points {
+		if i == 10 {
+			fmt.Fprintf(&sb, "\n… and %d more", len(points)-i)
+			break
+		}
+		fmt.Fprintf(&sb, "\n%s %.4f, %.4f", geoPointStyle.Render("●"), p.lat, p.lon)
+	}
+	return sb.String()
+}
@@ -0,0 +1,356 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"html"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// waterfallRow is a request drawn in a waterfall: when it started and the
+// time it spent in each phase
+type waterfallRow struct {
+	label   string
+	status  int
+	err     string
+	started time.Time
+	total   float64 // milliseconds
+	timings harTimings
+}
+
+// waterfallGroup is a series of requests drawn from their own start, so
+// runs recorded at different times line up for comparison
+type waterfallGroup struct {
+	name string
+	rows []waterfallRow
+}
+
+// maxWaterfallRows bounds the requests of the session kept for Alt+W
+const maxWaterfallRows = 200
+
+// waterfallPhases are the phases of a request in the order they happen,
+// with the colors browser devtools use for them
+var waterfallPhases = []struct{ name, color string }{
+	{"Blocked", "#A0A0A0"},
+	{"DNS", "#1F9E8E"},
+	{"Connect", "#E69138"},
+	{"TLS", "#9B59B6"},
+	{"Send", "#4A90D9"},
+	{"Wait", "#46A758"},
+	{"Receive", "#2D6FD6"},
+}
+
+// phases lists the milliseconds spent in each of waterfallPhases, 0 for
+// those that didn't happen. HAR counts TLS in the connection; here it's
+// drawn on its own.
+func (t harTimings) phases() []float64 {
+	pos := func(v float64) float64 { return max(v, 0) }
+	connect := pos(t.Connect)
+	if t.SSL > 0 {
+		connect = max(connect-t.SSL, 0)
+	}
+	return []float64{pos(t.Blocked), pos(t.DNS), connect, pos(t.SSL), pos(t.Send), pos(t.Wait), pos(t.Receive)}
+}
+
+// waterfallRowOf is the row of a HAR entry
+func waterfallRowOf(e harEntry) waterfallRow {
+	started, _ := time.Parse(time.RFC3339Nano, e.StartedDateTime)
+	return waterfallRow{label: e.label(), status: e.Response.Status, err: e.Error, started: started, total: max(e.Time, 0), timings: e.Timings}
+}
+
+// waterfallRowFromFetch is the row of a request sent in the TUI
+func waterfallRowFromFetch(label string, msg fetchMsg) waterfallRow {
+	row := waterfallRow{label: label, status: msg.statusCode, started: time.Now()}
+	if msg.err != nil {
+		row.err = msg.err.Error()
+	}
+	row.timings = harTimings{Blocked: -1, DNS: -1, Connect: -1, SSL: -1}
+	if t := msg.timing; t != nil {
+		t.mu.Lock()
+		row.started = t.start
+		row.total, row.timings = harTimingsOf(t)
+		t.mu.Unlock()
+	}
+	return row
+}
+
+// recordWaterfall keeps a request of the session for Alt+W
+func (m model) recordWaterfall(label string, msg fetchMsg) model {
+	m.waterfall = append(m.waterfall, waterfallRowFromFetch(label, msg))
+	if len(m.waterfall) > maxWaterfallRows {
+		m.waterfall = m.waterfall[len(m.waterfall)-maxWaterfallRows:]
+	}
+	return m
+}
+
+// exportWaterfall writes the waterfall of the requests sent this session
+// as an HTML file in the current directory
+func (m model) exportWaterfall() model {
+	if len(m.waterfall) == 0 {
+		m.notice = "No requests sent yet to draw a waterfall of"
+		return m
+	}
+	path := "waterfall-" + time.Now().Format("20060102-150405") + ".html"
+	groups := []waterfallGroup{{name: "This session", rows: m.waterfall}}
+	if err := writeWaterfall(path, "lazyhttp waterfall", groups); err != nil {
+		m.notice = errorStyle.Render("Writing the waterfall failed: " + err.Error())
+		return m
+	}
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	m.notice = fmt.Sprintf("Waterfall of %d requests written to %s", len(m.waterfall), path)
+	return m
+}
+
+// writeWaterfall writes the waterfall to path, as SVG when it ends with
+// .svg and as HTML otherwise
+func writeWaterfall(path, title string, groups []waterfallGroup) error {
+	page := renderWaterfallHTML(title, groups)
+	if strings.EqualFold(filepath.Ext(path), ".svg") {
+		page = renderWaterfallSVG(title, groups)
+	}
+	return os.WriteFile(path, []byte(page), 0o644)
+}
+
+// waterfallCommand implements `lazyhttp waterfall`: draw the requests of
+// HAR files, one group per file, as a standalone HTML page or SVG image
+func waterfallCommand(args []string) int {
+	fs := flag.NewFlagSet("waterfall", flag.ExitOnError)
+	output := fs.String("o", "", "write to `file`, SVG when it ends with .svg, instead of HTML to stdout")
+	format := fs.String("format", "", "`html` or svg, by default taken from -o")
+	title := fs.String("title", "", "title of the page, by default the files drawn")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: lazyhttp waterfall [flags] <file.har> [file.har...]\n\n")
+		fmt.Fprintf(fs.Output(), "Several files are drawn one under the other on the same time scale, each from its own start.\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+	var groups []waterfallGroup
+	for _, path := range fs.Args() {
+		entries, err := loadHAR(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 2
+		}
+		group := waterfallGroup{name: filepath.Base(path)}
+		for _, e := range entries {
+			group.rows = append(group.rows, waterfallRowOf(e))
+		}
+		groups = append(groups, group)
+	}
+	if *title == "" {
+		var names []string
+		for _, g := range groups {
+			names = append(names, g.name)
+		}
+		*title = "Waterfall of " + strings.Join(names, " vs ")
+	}
+
+	svg := strings.EqualFold(filepath.Ext(*output), ".svg")
+	switch *format {
+	case "":
+	case "svg":
+		svg = true
+	case "html":
+		svg = false
+	default:
+		fmt.Fprintf(os.Stderr, "Error: unknown format %q, use html or svg\n", *format)
+		return 2
+	}
+	if *output == "" {
+		page := renderWaterfallHTML(*title, groups)
+		if svg {
+			page = renderWaterfallSVG(*title, groups)
+		}
+		io.WriteString(os.Stdout, page)
+		return 0
+	}
+	if svg != strings.EqualFold(filepath.Ext(*output), ".svg") {
+		fmt.Fprintf(os.Stderr, "Error: -format %s doesn't match the extension of %s\n", *format, *output)
+		return 2
+	}
+	if err := writeWaterfall(*output, *title, groups); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+	return 0
+}
+
+// Dimensions of the waterfall image, in pixels
+const (
+	waterfallWidth     = 1200
+	waterfallLabels    = 380 // column of the request labels
+	waterfallTotals    = 80  // column of the total times
+	waterfallRowHeight = 22
+	waterfallHeader    = 28 // rows naming a group
+	waterfallAxis      = 30
+)
+
+// waterfallSpan is the milliseconds the longest group takes, the time
+// scale of all of them
+func waterfallSpan(groups []waterfallGroup) float64 {
+	span := 1.0
+	for _, g := range groups {
+		for _, r := range g.rows {
+			span = max(span, msBetween(g.rows[0].started, r.started)+r.total)
+		}
+	}
+	return span
+}
+
+// msBetween is the milliseconds from one time to another
+func msBetween(from, to time.Time) float64 {
+	return float64(to.Sub(from).Microseconds()) / 1000
+}
+
+// waterfallTicks picks the time axis marks, 4 to 10 of them
+func waterfallTicks(span float64) (step float64, n int) {
+	step = math.Pow(10, math.Floor(math.Log10(span))-1)
+	for _, f := range []float64{1, 2, 5, 10} {
+		if span/(step*f) <= 10 {
+			step *= f
+			break
+		}
+	}
+	return step, int(span / step)
+}
+
+// waterfallStatusColor draws failures in red and redirects in yellow
+func waterfallStatusColor(r waterfallRow) string {
+	switch {
+	case r.err != "" || r.status >= 400:
+		return "#D93025"
+	case r.status >= 300:
+		return "#B8860B"
+	}
+	return "#333333"
+}
+
+// renderWaterfallSVG draws the groups as a standalone SVG image, each
+// phase of a request with its duration as a tooltip
+func renderWaterfallSVG(title string, groups []waterfallGroup) string {
+	rows := 0
+	for _, g := range groups {
+		rows += len(g.rows)
+	}
+	height := 40 + waterfallAxis + len(groups)*waterfallHeader + rows*waterfallRowHeight + 40
+	span := waterfallSpan(groups)
+	barWidth := float64(waterfallWidth - waterfallLabels - waterfallTotals)
+	x := func(at float64) float64 { return waterfallLabels + at/span*barWidth }
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="sans-serif" font-size="12">`+"\n",
+		waterfallWidth, height, waterfallWidth, height)
+	fmt.Fprintf(&sb, `<rect width="100%%" height="100%%" fill="#FFFFFF"/>`+"\n")
+	fmt.Fprintf(&sb, `<text x="8" y="24" font-size="16" font-weight="bold">%s</text>`+"\n", html.EscapeString(title))
+
+	// Time axis, with a grid line per mark
+	y := 40 + waterfallAxis
+	step, n := waterfallTicks(span)
+	for i := 0; i <= n; i++ {
+		at := float64(i) * step
+		fmt.Fprintf(&sb, `<line x1="%.1f" y1="%d" x2="%.1f" y2="%d" stroke="#E0E0E0"/>`+"\n", x(at), y-6, x(at), height-40)
+		fmt.Fprintf(&sb, `<text x="%.1f" y="%d" text-anchor="middle" fill="#666666">%s</text>`+"\n",
+			x(at), y-10, formatDuration(time.Duration(at*float64(time.Millisecond))))
+	}
+
+	for _, g := range groups {
+		fmt.Fprintf(&sb, `<text x="8" y="%d" font-weight="bold">%s</text>`+"\n", y+18, html.EscapeString(fmt.Sprintf("%s (%d requests)", g.name, len(g.rows))))
+		y += waterfallHeader
+		for i, r := range g.rows {
+			if i%2 == 1 {
+				fmt.Fprintf(&sb, `<rect x="0" y="%d" width="%d" height="%d" fill="#F7F7F7"/>`+"\n", y, waterfallWidth, waterfallRowHeight)
+			}
+			label := truncate(r.label, 56)
+			if r.status > 0 {
+				label = fmt.Sprintf("%d %s", r.status, truncate(r.label, 52))
+			}
+			fmt.Fprintf(&sb, `<text x="8" y="%d" fill="%s"><title>%s</title>%s</text>`+"\n",
+				y+15, waterfallStatusColor(r), html.EscapeString(r.label+waterfallError(r)), html.EscapeString(label))
+
+			at := msBetween(g.rows[0].started, r.started)
+			for p, d := range r.timings.phases() {
+				if d > 0 {
+					fmt.Fprintf(&sb, `<rect x="%.1f" y="%d" width="%.1f" height="%d" fill="%s"><title>%s %s</title></rect>`+"\n",
+						x(at), y+5, max(d/span*barWidth, 1), waterfallRowHeight-10, waterfallPhases[p].color,
+						waterfallPhases[p].name, formatDuration(time.Duration(d*float64(time.Millisecond))))
+				}
+				at += d
+			}
+			fmt.Fprintf(&sb, `<text x="%d" y="%d" text-anchor="end" fill="#666666">%s</text>`+"\n",
+				waterfallWidth-8, y+15, formatDuration(time.Duration(r.total*float64(time.Millisecond))))
+			y += waterfallRowHeight
+		}
+	}
+
+	// Legend
+	lx := 8
+	for _, p := range waterfallPhases {
+		fmt.Fprintf(&sb, `<rect x="%d" y="%d" width="12" height="12" fill="%s"/><text x="%d" y="%d">%s</text>`+"\n",
+			lx, height-26, p.color, lx+16, height-16, p.name)
+		lx += 90
+	}
+	sb.WriteString("</svg>\n")
+	return sb.String()
+}
+
+// waterfallError is why a request got no response, for its tooltip
+func waterfallError(r waterfallRow) string {
+	if r.err == "" {
+		return ""
+	}
+	return ": " + r.err
+}
+
+// renderWaterfallHTML is a standalone page with the waterfall and a table
+// of the phases of each request, to paste numbers from
+func renderWaterfallHTML(title string, groups []waterfallGroup) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>%s</title>\n", html.EscapeString(title))
+	sb.WriteString(`<style>
+body { font-family: sans-serif; margin: 24px; color: #333; }
+svg { max-width: 100%; height: auto; }
+table { border-collapse: collapse; margin: 8px 0 32px; font-size: 13px; }
+th, td { padding: 4px 8px; border-bottom: 1px solid #E0E0E0; text-align: right; white-space: nowrap; }
+th:nth-child(2), td:nth-child(2) { text-align: left; max-width: 520px; overflow: hidden; text-overflow: ellipsis; }
+.error { color: #D93025; }
+</style>
+</head>
+<body>
+`)
+	fmt.Fprintf(&sb, "<p>Generated by lazyhttp on %s. Times are in milliseconds; TLS is shown apart from Connect.</p>\n", time.Now().Format("2006-01-02 15:04:05 MST"))
+	sb.WriteString(renderWaterfallSVG(title, groups))
+	for _, g := range groups {
+		fmt.Fprintf(&sb, "<h2>%s</h2>\n<table>\n<tr><th>#</th><th>Request</th><th>Status</th><th>Start</th>", html.EscapeString(g.name))
+		for _, p := range waterfallPhases {
+			fmt.Fprintf(&sb, "<th>%s</th>", p.name)
+		}
+		sb.WriteString("<th>Total</th></tr>\n")
+		for i, r := range g.rows {
+			status := fmt.Sprint(r.status)
+			if r.err != "" {
+				status = `<span class="error">` + html.EscapeString(r.err) + "</span>"
+			}
+			fmt.Fprintf(&sb, "<tr><td>%d</td><td title=\"%s\">%s</td><td>%s</td><td>%.1f</td>",
+				i+1, html.EscapeString(r.label), html.EscapeString(r.label), status, msBetween(g.rows[0].started, r.started))
+			for _, d := range r.timings.phases() {
+				fmt.Fprintf(&sb, "<td>%.1f</td>", d)
+			}
+			fmt.Fprintf(&sb, "<td>%.1f</td></tr>\n", r.total)
+		}
+		sb.WriteString("</table>\n")
+	}
+	sb.WriteString("</body>\n</html>\n")
+	return sb.String()
+}
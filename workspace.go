@@ -0,0 +1,277 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+const (
+	defaultWorkspace = "default"
+
+	// workspacesDir holds one directory per workspace besides the default
+	workspacesDir = "workspaces"
+
+	// workspaceNameFile keeps a workspace's name inside its directory, and
+	// currentWorkspaceFile records the workspace used last
+	workspaceNameFile    = "workspace-name"
+	currentWorkspaceFile = "current-workspace"
+
+	// projectDirName is the directory `lazyhttp init` creates to keep a
+	// workspace inside a project's repository
+	projectDirName = ".lazyhttp"
+)
+
+// currentWorkspace names the workspace whose collections, history and
+// schemas are in use
+var currentWorkspace = defaultWorkspace
+
+// projectWorkspace is the .lazyhttp directory of the project lazyhttp was
+// started in, if any
+var projectWorkspace string
+
+// detectProjectWorkspace looks for a .lazyhttp directory in the working
+// directory and its parents and, when there is one, switches to it
+func detectProjectWorkspace() {
+	dir, err := os.Getwd()
+	if err != nil {
+		return
+	}
+	for {
+		candidate := filepath.Join(dir, projectDirName)
+		if info, err := os.Stat(candidate); err == nil && info.IsDir() && candidate != dataDir() {
+			projectWorkspace = candidate
+			currentWorkspace = projectWorkspaceName()
+			return
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return
+		}
+		dir = parent
+	}
+}
+
+// projectWorkspaceName names the project workspace after its project
+func projectWorkspaceName() string {
+	if projectWorkspace == "" {
+		return ""
+	}
+	return "project:" + filepath.Base(filepath.Dir(projectWorkspace))
+}
+
+func isProjectWorkspace(name string) bool {
+	return projectWorkspace != "" && name == projectWorkspaceName()
+}
+
+// listWorkspaces returns the names of all workspaces, the default first
+func listWorkspaces() ([]string, error) {
+	dirs, err := os.ReadDir(filepath.Join(dataDir(), workspacesDir))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	var names []string
+	for _, d := range dirs {
+		if !d.IsDir() {
+			continue
+		}
+		// Directory names are slugs, the real name is kept inside
+		name := d.Name()
+		if data, err := os.ReadFile(filepath.Join(dataDir(), workspacesDir, d.Name(), workspaceNameFile)); err == nil {
+			name = strings.TrimSpace(string(data))
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if projectWorkspace != "" {
+		names = append([]string{projectWorkspaceName()}, names...)
+	}
+	if remoteWorkspace != "" {
+		names = append([]string{remoteWorkspaceName}, names...)
+	}
+	return append([]string{defaultWorkspace}, names...), nil
+}
+
+// loadCurrentWorkspace restores the workspace used last
+func loadCurrentWorkspace() {
+	if data, err := os.ReadFile(filepath.Join(dataDir(), currentWorkspaceFile)); err == nil {
+		if name := strings.TrimSpace(string(data)); name != "" {
+			currentWorkspace = name
+		}
+	}
+}
+
+// useWorkspace makes name the current workspace, creating it if needed,
+// and remembers it for the next start. Project and remote workspaces
+// aren't remembered, they come from the working directory and -remote.
+func useWorkspace(name string) error {
+	currentWorkspace = name
+	if isProjectWorkspace(name) || isRemoteWorkspace(name) {
+		return nil
+	}
+	if name != defaultWorkspace {
+		file, err := workspaceFile(workspaceNameFile)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(file, []byte(name+"\n"), 0o600); err != nil {
+			return err
+		}
+	}
+	if incognito {
+		return nil
+	}
+	file, err := dataFile(currentWorkspaceFile)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(file, []byte(name+"\n"), 0o600)
+}
+
+// workspacePicker lists the workspaces; typing filters them, and a name
+// that matches none creates a new workspace
+type workspacePicker struct {
+	names  []string
+	filter textinput.Model
+	idx    int
+	err    error
+}
+
+func (p *workspacePicker) matches() []string {
+	query := strings.ToLower(strings.TrimSpace(p.filter.Value()))
+	var out []string
+	for _, name := range p.names {
+		if strings.Contains(strings.ToLower(name), query) {
+			out = append(out, name)
+		}
+	}
+	return out
+}
+
+func (m model) openWorkspacePicker() model {
+	filter := textinput.New()
+	filter.Prompt = "Workspace: "
+	filter.Placeholder = "filter, or a new name"
+	filter.Focus()
+	names, err := listWorkspaces()
+	m.workspacePicker = &workspacePicker{names: names, filter: filter, err: err}
+	m.textInput.Blur()
+	return m
+}
+
+// updateWorkspacePicker handles keys while the picker is open
+func (m model) updateWorkspacePicker(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	p := m.workspacePicker
+	matches := p.matches()
+	switch msg.Type {
+	case tea.KeyCtrlC:
+		return m, tea.Quit
+	case tea.KeyEsc, tea.KeyCtrlW:
+		m.workspacePicker = nil
+		m.textInput.Focus()
+		return m, nil
+	case tea.KeyUp:
+		if p.idx > 0 {
+			p.idx--
+		}
+		return m, nil
+	case tea.KeyDown:
+		if p.idx < len(matches)-1 {
+			p.idx++
+		}
+		return m, nil
+	case tea.KeyEnter:
+		name := strings.TrimSpace(p.filter.Value())
+		if p.idx < len(matches) {
+			name = matches[p.idx]
+		}
+		if name == "" {
+			return m, nil
+		}
+		m.workspacePicker = nil
+		m.textInput.Focus()
+		return m.switchWorkspace(name), nil
+	}
+
+	var cmd tea.Cmd
+	p.filter, cmd = p.filter.Update(msg)
+	p.idx = 0
+	return m, cmd
+}
+
+// switchWorkspace moves the session to another workspace, swapping in its
+// history, collections and environments
+func (m model) switchWorkspace(name string) model {
+	if err := useWorkspace(name); err != nil {
+		m.notice = errorStyle.Render(fmt.Sprintf("Switching workspace failed: %v", err))
+		return m
+	}
+	history, err := loadHistory()
+	m.history = history
+	envErr := loadEnvironments()
+	if err := loadRateLimits(); err != nil && envErr == nil {
+		envErr = fmt.Errorf("rate limits: %w", err)
+	}
+	usage, usageErr := loadQuotaUsage()
+	m.usage, m.quotaOverride = usage, ""
+	panes, layoutErr := loadLayout()
+	m.panes = panes
+	m = m.layout()
+	m.lastResponse = nil
+	m.drift = nil
+	m.specViolations = nil
+	m.suggestions = nil
+	if m.sidebar.open {
+		m.sidebar = m.sidebar.reload()
+	}
+	m.notice = fmt.Sprintf("Switched to workspace %q", name)
+	if err != nil {
+		m.notice = errorStyle.Render(fmt.Sprintf("Loading history failed: %v", err))
+	} else if envErr != nil {
+		m.notice = errorStyle.Render(fmt.Sprintf("Loading environments failed: %v", envErr))
+	} else if usageErr != nil {
+		m.notice = errorStyle.Render(fmt.Sprintf("Loading quota usage failed: %v", usageErr))
+	} else if layoutErr != nil {
+		m.notice = errorStyle.Render(fmt.Sprintf("Loading the layout failed: %v", layoutErr))
+	}
+	return m
+}
+
+// renderWorkspacePicker draws the workspace picker
+func renderWorkspacePicker(p *workspacePicker) string {
+	var sb strings.Builder
+	sb.WriteString(headerStyle.Render("Workspaces"))
+	sb.WriteString("\n\n")
+	sb.WriteString(p.filter.View())
+	sb.WriteString("\n\n")
+	if p.err != nil {
+		sb.WriteString(errorStyle.Render(p.err.Error()))
+		sb.WriteString("\n")
+	}
+
+	matches := p.matches()
+	for i, name := range matches {
+		label := name
+		if name == currentWorkspace {
+			label += historyDimStyle.Render(" (current)")
+		}
+		if i == p.idx {
+			sb.WriteString(selectedSuggestionStyle.Render("› ") + label)
+		} else {
+			sb.WriteString("  " + label)
+		}
+		sb.WriteString("\n")
+	}
+	if name := strings.TrimSpace(p.filter.Value()); len(matches) == 0 && name != "" {
+		sb.WriteString(historyDimStyle.Render(fmt.Sprintf("Enter creates workspace %q", name)))
+		sb.WriteString("\n")
+	}
+	sb.WriteString(historyDimStyle.Render("\n↑/↓: Select • Enter: Switch • Esc: Close"))
+	return sb.String()
+}